@@ -0,0 +1,110 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrAccessDenied is wrapped by AccessError.
+var ErrAccessDenied = errors.New("access denied")
+
+// AccessError is returned, when GoSNMP.AccessErrors is set, for responses
+// with the error status noAccess, authorizationError or notWritable: the
+// agent accepted the credentials but its access control, e.g. the VACM
+// views of an SNMPv3 group, forbids the operation on the OID. Unlike
+// timeouts and ReportErrors it is not fixed by retrying or by other
+// credentials of the same group.
+type AccessError struct {
+	// Status is the error status of the response.
+	Status SNMPError
+
+	// Operation is the PDU type of the request, e.g. GetRequest or
+	// SetRequest.
+	Operation PDUType
+
+	// OID is the name of the variable the error index points to, "" when
+	// the index is 0 or out of range.
+	OID string
+
+	// Index is the error index of the response, 1 for the first variable.
+	Index int
+
+	// ContextName and SecurityName are the SNMPv3 context and USM user
+	// name of the request, "" for other versions.
+	ContextName  string
+	SecurityName string
+
+	// CorrelationID identifies the operation of the request, see
+	// GoSNMP.CorrelationID.
+	CorrelationID string
+}
+
+func (e *AccessError) Error() string {
+	msg := fmt.Sprintf("%v: %s", ErrAccessDenied, e.Status)
+	if e.OID != "" {
+		msg += fmt.Sprintf(" for %s of %s", requestName(e.Operation), e.OID)
+	} else {
+		msg += fmt.Sprintf(" for %s", requestName(e.Operation))
+	}
+	if e.SecurityName != "" {
+		msg += fmt.Sprintf(" (user %q, context %q)", e.SecurityName, e.ContextName)
+	}
+	return msg
+}
+
+// Unwrap returns ErrAccessDenied.
+func (e *AccessError) Unwrap() error {
+	return ErrAccessDenied
+}
+
+// requestName returns the name of a request PDU type.
+func requestName(t PDUType) string {
+	switch t {
+	case GetRequest:
+		return "GetRequest"
+	case GetNextRequest:
+		return "GetNextRequest"
+	case GetBulkRequest:
+		return "GetBulkRequest"
+	case SetRequest:
+		return "SetRequest"
+	}
+	return fmt.Sprintf("PDUType(0x%x)", byte(t))
+}
+
+// isAccessStatus reports whether status is an access control failure.
+func isAccessStatus(status SNMPError) bool {
+	switch status {
+	case NoAccess, AuthorizationError, NotWritable:
+		return true
+	}
+	return false
+}
+
+// accessError returns the AccessError of the response to request, or nil.
+func (x *GoSNMP) accessError(request, response *SnmpPacket) error {
+	if response == nil || response.PDUType != GetResponse || !isAccessStatus(response.Error) {
+		return nil
+	}
+	e := &AccessError{
+		Status:    response.Error,
+		Operation: request.PDUType,
+		Index:     int(response.ErrorIndex),
+	}
+	if i := e.Index - 1; i >= 0 && i < len(response.Variables) {
+		e.OID = response.Variables[i].Name
+	} else if i >= 0 && i < len(request.Variables) {
+		e.OID = request.Variables[i].Name
+	}
+	if request.Version == Version3 {
+		e.ContextName = request.ContextName
+		if sp, ok := request.SecurityParameters.(*UsmSecurityParameters); ok {
+			e.SecurityName = sp.UserName
+		}
+	}
+	return e
+}
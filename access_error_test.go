@@ -0,0 +1,156 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// viewAgent is a v3 NoAuthNoPriv agent whose view excludes the snmpModules
+// subtree, answered with noAccess, and which answers sets with notWritable.
+func viewAgent(t *testing.T, srvr *net.UDPConn, engineID string) {
+	decoder := &GoSNMP{
+		Version:            Version3,
+		SecurityModel:      UserSecurityModel,
+		MsgFlags:           NoAuthNoPriv,
+		SecurityParameters: &UsmSecurityParameters{UserName: "user", AuthoritativeEngineID: engineID},
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := srvr.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req, err := decoder.SnmpDecodePacket(buf[:n])
+		if err != nil {
+			t.Errorf("agent decode: %s", err)
+			return
+		}
+		resp := &SnmpPacket{
+			Version:       Version3,
+			MsgFlags:      NoAuthNoPriv,
+			SecurityModel: UserSecurityModel,
+			SecurityParameters: &UsmSecurityParameters{
+				AuthoritativeEngineID:    engineID,
+				AuthoritativeEngineBoots: 1,
+				AuthoritativeEngineTime:  10,
+				UserName:                 "user",
+			},
+			MsgID:           req.MsgID,
+			RequestID:       req.RequestID,
+			ContextEngineID: req.ContextEngineID,
+			ContextName:     req.ContextName,
+			PDUType:         GetResponse,
+		}
+		for i, v := range req.Variables {
+			switch {
+			case req.PDUType == SetRequest:
+				resp.Error, resp.ErrorIndex = NotWritable, uint8(i+1)
+			case strings.HasPrefix(v.Name, ".1.3.6.1.6.3."):
+				resp.Error, resp.ErrorIndex = NoAccess, uint8(i+1)
+			}
+			if resp.Error != NoError {
+				break
+			}
+		}
+		if resp.Error != NoError {
+			for _, v := range req.Variables {
+				resp.Variables = append(resp.Variables, SnmpPDU{Name: v.Name, Type: Null})
+			}
+		} else {
+			resp.Variables = []SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "agent"}}
+		}
+		out, err := resp.MarshalMsg()
+		if err != nil {
+			t.Errorf("agent marshal: %s", err)
+			return
+		}
+		if _, err = srvr.WriteTo(out, addr); err != nil {
+			return
+		}
+	}
+}
+
+func TestAccessErrors(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	engineID := authorativeEngineID(t)
+	go viewAgent(t, srvr, engineID)
+
+	x := &GoSNMP{
+		Version:            Version3,
+		Target:             srvr.LocalAddr().(*net.UDPAddr).IP.String(),
+		Port:               uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Timeout:            time.Millisecond * 500,
+		MaxOids:            MaxOids,
+		SecurityModel:      UserSecurityModel,
+		MsgFlags:           NoAuthNoPriv,
+		ContextName:        "vrf1",
+		SecurityParameters: &UsmSecurityParameters{UserName: "user", AuthoritativeEngineID: engineID},
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	denied := []string{".1.3.6.1.2.1.1.5.0", ".1.3.6.1.6.3.15.1.1.1.0"}
+
+	// by default the status is only reported in the response
+	result, err := x.Get(denied)
+	require.NoError(t, err)
+	assert.Equal(t, NoAccess, result.Error)
+
+	x.AccessErrors = true
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+
+	result, err = x.Get(denied)
+	require.Error(t, err)
+	require.NotNil(t, result)
+	assert.True(t, errors.Is(err, ErrAccessDenied))
+	var accessErr *AccessError
+	require.True(t, errors.As(err, &accessErr))
+	assert.Equal(t, NoAccess, accessErr.Status)
+	assert.Equal(t, GetRequest, accessErr.Operation)
+	assert.Equal(t, ".1.3.6.1.6.3.15.1.1.1.0", accessErr.OID)
+	assert.Equal(t, 2, accessErr.Index)
+	assert.Equal(t, "vrf1", accessErr.ContextName)
+	assert.Equal(t, "user", accessErr.SecurityName)
+	id, ok := CorrelationIDOf(err)
+	assert.True(t, ok)
+	assert.NotEmpty(t, id)
+	assert.Equal(t, `access denied: NoAccess for GetRequest of .1.3.6.1.6.3.15.1.1.1.0 (user "user", context "vrf1")`, err.Error())
+
+	_, err = x.Set([]SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "new"}})
+	require.True(t, errors.As(err, &accessErr))
+	assert.Equal(t, NotWritable, accessErr.Status)
+	assert.Equal(t, SetRequest, accessErr.Operation)
+	assert.Equal(t, ".1.3.6.1.2.1.1.5.0", accessErr.OID)
+
+	// a walk of a forbidden subtree fails rather than returning nothing
+	err = x.Walk(".1.3.6.1.6.3.15", func(SnmpPDU) error { return nil })
+	assert.True(t, errors.Is(err, ErrAccessDenied))
+
+	// asynchronous requests fail alike
+	errch := make(chan error, 1)
+	require.NoError(t, x.GetAsync(denied, func(_ *SnmpPacket, err error) { errch <- err }))
+	select {
+	case err = <-errch:
+		assert.True(t, errors.As(err, &accessErr))
+		assert.Equal(t, ".1.3.6.1.6.3.15.1.1.1.0", accessErr.OID)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no response")
+	}
+}
@@ -0,0 +1,545 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//
+// Answering requests ie GoSNMP acting as an Agent
+//
+
+// DefaultAgentMaxMsgSize is the largest response of an Agent whose
+// MaxMsgSize is unset, the payload of a UDP datagram in a 1500 byte
+// Ethernet frame.
+const DefaultAgentMaxMsgSize = 1472
+
+// AgentHandler serves the variables of an Agent.
+type AgentHandler interface {
+	// Get returns the variable oid, or a variable of type NoSuchObject or
+	// NoSuchInstance named oid if there is none.
+	Get(oid string) (SnmpPDU, error)
+
+	// GetNext returns the first variable after oid in lexicographic order,
+	// or a variable of type EndOfMibView named oid if there is none.
+	GetNext(oid string) (SnmpPDU, error)
+}
+
+// AgentSetHandler is an AgentHandler whose variables can be written. The
+// Agent processes a SetRequest in phases so that, as RFC 3416 section
+// 4.2.5 requires, either all of its variables are set or none are:
+//
+//  1. TestSet is called for every variable, the request fails without
+//     changes if one returns an error status.
+//  2. CommitSet is called for every variable.
+//  3. If a CommitSet fails, UndoSet is called for the variables already
+//     committed, in reverse order, with the values Get returned before the
+//     request, and the request fails with CommitFailed. If an UndoSet fails
+//     too, it fails with UndoFailed.
+//
+// The Agent serializes requests, so handlers see no request in between the
+// phases of a SetRequest.
+type AgentSetHandler interface {
+	AgentHandler
+
+	// TestSet checks that pdu can be set without changing anything,
+	// returning NoError or the status of the failure, e.g. NotWritable,
+	// WrongType, WrongValue or NoCreation.
+	TestSet(pdu SnmpPDU) SNMPError
+
+	// CommitSet sets the variable of pdu.
+	CommitSet(pdu SnmpPDU) error
+
+	// UndoSet restores the variable set by CommitSet to previous, which is
+	// of type NoSuchObject or NoSuchInstance if the variable was created.
+	UndoSet(pdu, previous SnmpPDU) error
+}
+
+// Agent answers the GetRequest, GetNextRequest, GetBulkRequest and
+// SetRequest PDUs of SNMPv1, SNMPv2c and SNMPv3 managers on UDP, serving
+// the variables of Handler:
+//
+//	a := gosnmp.NewAgent()
+//	a.Params = &gosnmp.GoSNMP{Community: "public"}
+//	a.Handler = handler
+//	err := a.Listen("0.0.0.0:161")
+//
+// Requests with another community than Params.Community or WriteCommunity
+// are dropped, unless access is controlled by VACM. SNMPv1 requests are
+// answered with the SNMPv1 error statuses as per RFC 3584 section 4.4.
+// SNMPv3 requests are answered if Users is set, see Users.
+type Agent struct {
+	// Params holds the Community and Logger of the agent.
+	Params *GoSNMP
+
+	// Handler serves the variables. Without a Handler the agent has none.
+	Handler AgentHandler
+
+	// WriteCommunity is the community of SetRequests, which must be
+	// served by an AgentSetHandler. SetRequests are refused without it.
+	// Requests with WriteCommunity can also read.
+	WriteCommunity string
+
+	// MaxMsgSize is the largest response sent, DefaultAgentMaxMsgSize if
+	// unset. GetBulkRequests are answered with fewer repetitions to fit,
+	// other requests that do not fit with TooBig.
+	MaxMsgSize int
+
+	// Users are the USM users of SNMPv3 requests, with the keys localized
+	// to the Engine of the agent; a user of any engine may be used. The
+	// agent is the authoritative engine of its requests as per RFC 3414:
+	// it answers discovery and reports the USM errors of requests. All the
+	// users can read, the authenticated users can also write, unless
+	// access is controlled by VACM. SNMPv3 requests are dropped without
+	// Users.
+	Users *UsmUserTable
+
+	// Engine is the SNMPv3 engine of the agent, whose engine ID, boots and
+	// time authenticate its responses. Listen creates an engine with a
+	// RandomEngineID if Users is set without Engine, persist its boots
+	// with an EngineBootsStore for managers to keep trusting the agent
+	// after it restarts.
+	Engine *LocalEngine
+
+	// VACM, if set, controls the access of requests in place of
+	// Params.Community, WriteCommunity and the access of Users: requests of
+	// communities without a group are dropped, those of users without
+	// access answered with AuthorizationError. Variables outside the read
+	// view are not seen, those outside the write view cannot be set.
+	VACM *VACM
+
+	// NotifyTargets are the managers Notify and Watch send notifications
+	// to.
+	NotifyTargets []NotifyTarget
+
+	// ProxyTargets are the backend agents the requests matching them are
+	// forwarded to, by community or SNMPv3 context, see ProxyTarget.
+	ProxyTargets []ProxyTarget
+
+	// usmStats counts the SNMPv3 requests reported, by USM error
+	usmStats usmStatsCounters
+	// salt is the last salt of the encrypted responses
+	salt uint64
+
+	mu        sync.Mutex
+	conn      *net.UDPConn
+	listening chan bool
+	done      chan bool
+	finish    int32 // set to 1 when closing
+	started   time.Time
+
+	// notify serializes the notifications, a session sends one at a time
+	notify sync.Mutex
+
+	// serve serializes the requests reaching the handler
+	serve sync.Mutex
+}
+
+// NewAgent returns an initialized Agent.
+func NewAgent() *Agent {
+	return &Agent{
+		listening: make(chan bool, 1),
+		done:      make(chan bool, 1),
+	}
+}
+
+// Listening returns a channel receiving once the agent is ready to answer
+// requests.
+func (a *Agent) Listening() <-chan bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.listening
+}
+
+// Close stops the agent, Listen returns once the request in progress is
+// answered.
+func (a *Agent) Close() {
+	if !atomic.CompareAndSwapInt32(&a.finish, 0, 1) {
+		return
+	}
+	a.mu.Lock()
+	conn := a.conn
+	a.mu.Unlock()
+	if conn == nil {
+		return
+	}
+	conn.Close()
+	<-a.done
+}
+
+// LocalAddr returns the address the agent listens on, or nil before Listen.
+func (a *Agent) LocalAddr() net.Addr {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.conn == nil {
+		return nil
+	}
+	return a.conn.LocalAddr()
+}
+
+// Listen answers requests on the UDP address addr, e.g. "0.0.0.0:161",
+// until Close is called.
+func (a *Agent) Listen(addr string) error {
+	if err := a.init(); err != nil {
+		return err
+	}
+	udpAddr, err := net.ResolveUDPAddr(udp, addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP(udp, udpAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	a.mu.Lock()
+	a.conn = conn
+	a.mu.Unlock()
+	a.listening <- true
+
+	var buf [rxBufSize]byte
+	for {
+		n, remote, err := conn.ReadFromUDP(buf[:])
+		if atomic.LoadInt32(&a.finish) == 1 {
+			a.done <- true
+			return nil
+		}
+		if err != nil {
+			a.Params.Logger.Printf("Agent: error in read %s\n", err)
+			continue
+		}
+		out, err := a.answer(buf[:n])
+		if err != nil {
+			a.Params.Logger.Printf("Agent: request from %s dropped: %s\n", remote, err)
+			continue
+		}
+		if _, err = conn.WriteToUDP(out, remote); err != nil {
+			a.Params.Logger.Printf("Agent: error sending response to %s: %s\n", remote, err)
+		}
+	}
+}
+
+// answer returns the encoded response to the request msg.
+func (a *Agent) answer(msg []byte) ([]byte, error) {
+	// the values of the request refer to msg, handlers may keep them
+	msg = append([]byte(nil), msg...)
+	if version, _, _, err := peekMessage(msg); err == nil && version == Version3 {
+		return a.answerV3(msg)
+	}
+	req, err := (&GoSNMP{Logger: a.Params.Logger}).SnmpDecodePacket(msg)
+	if err != nil {
+		return nil, err
+	}
+	if req.Version != Version1 && req.Version != Version2c {
+		return nil, fmt.Errorf("%s requests are not supported", req.Version)
+	}
+	if target, ok := a.proxyTarget(req); ok {
+		resp, err := a.forward(req, target)
+		if err != nil {
+			return nil, err
+		}
+		return a.marshalResponse(req, resp)
+	}
+	access, err := a.communityAccess(req.Community)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.respond(req, access)
+	if err != nil {
+		return nil, err
+	}
+	return a.marshalResponse(req, resp)
+}
+
+// agentAccess is the access of the principal of a request, the views of
+// the VACM of the agent or, without, everything.
+type agentAccess struct {
+	vacm        *VACM
+	read, write string
+	canWrite    bool // without vacm
+}
+
+func (ac agentAccess) readable(oid string) bool {
+	return ac.vacm == nil || ac.vacm.InView(ac.read, oid)
+}
+
+func (ac agentAccess) writable(oid string) bool {
+	if ac.vacm == nil {
+		return ac.canWrite
+	}
+	return ac.vacm.InView(ac.write, oid)
+}
+
+// communityAccess returns the access of the requests with community.
+func (a *Agent) communityAccess(community string) (agentAccess, error) {
+	if a.VACM == nil {
+		write := a.WriteCommunity != "" && community == a.WriteCommunity
+		if !write && community != a.Params.Community {
+			return agentAccess{}, fmt.Errorf("unknown community %q", community)
+		}
+		return agentAccess{canWrite: write}, nil
+	}
+	access, err := a.VACM.accessOf(vacmPrincipal{name: community}, NoAuthNoPriv)
+	if err != nil {
+		return agentAccess{}, fmt.Errorf("community %q: %w", community, err)
+	}
+	return agentAccess{vacm: a.VACM, read: access.ReadView, write: access.WriteView}, nil
+}
+
+// respond returns the response to the authorized request req, with the
+// access of its principal.
+func (a *Agent) respond(req *SnmpPacket, access agentAccess) (*SnmpPacket, error) {
+	a.serve.Lock()
+	defer a.serve.Unlock()
+	if hook, ok := a.Handler.(AgentRequestHook); ok {
+		hook.BeginRequest()
+	}
+	var resp *SnmpPacket
+	var err error
+	switch req.PDUType {
+	case GetRequest, GetNextRequest:
+		resp, err = a.get(req, access)
+	case GetBulkRequest:
+		if req.Version == Version1 {
+			return nil, fmt.Errorf("GetBulkRequest in an SNMPv1 message")
+		}
+		resp, err = a.getBulk(req, access)
+	case SetRequest:
+		resp, err = a.set(req, access)
+	default:
+		return nil, fmt.Errorf("unexpected PDU type 0x%x", byte(req.PDUType))
+	}
+	return resp, err
+}
+
+// maxMsgSize returns the largest response of the agent.
+func (a *Agent) maxMsgSize() int {
+	if a.MaxMsgSize > 0 {
+		return a.MaxMsgSize
+	}
+	return DefaultAgentMaxMsgSize
+}
+
+// marshalResponse encodes resp, or a TooBig response to req if it does not
+// fit.
+func (a *Agent) marshalResponse(req, resp *SnmpPacket) ([]byte, error) {
+	if resp.Version == Version1 {
+		v1ErrorStatus(resp)
+	}
+	out, err := a.marshal(resp)
+	if err != nil || len(out) <= a.maxMsgSize() {
+		return out, err
+	}
+	tooBig := req.Response(nil)
+	tooBig.Error = TooBig
+	return a.marshal(tooBig)
+}
+
+// marshal encodes resp, with the clock of the engine of the agent for
+// SNMPv3.
+func (a *Agent) marshal(resp *SnmpPacket) ([]byte, error) {
+	if resp.Version == Version3 {
+		if err := a.secure(resp); err != nil {
+			return nil, err
+		}
+	}
+	return resp.marshalMsg()
+}
+
+// get answers a GetRequest or GetNextRequest.
+func (a *Agent) get(req *SnmpPacket, access agentAccess) (*SnmpPacket, error) {
+	vars := make([]SnmpPDU, 0, len(req.Variables))
+	for i, v := range req.Variables {
+		pdu, err := a.lookup(access, req.PDUType, v.Name)
+		if err != nil {
+			a.Params.Logger.Printf("Agent: error reading %s: %s\n", v.Name, err)
+			return req.ErrorResponse(GenErr, i+1)
+		}
+		if req.Version == Version1 && isException(pdu.Type) {
+			return req.ErrorResponse(NoSuchName, i+1)
+		}
+		vars = append(vars, pdu)
+	}
+	return req.Response(vars), nil
+}
+
+// lookup returns the variable oid for a GetRequest, or the variable after
+// it for the other requests, among the variables readable with access.
+func (a *Agent) lookup(access agentAccess, t PDUType, oid string) (SnmpPDU, error) {
+	if a.Handler == nil {
+		if t == GetRequest {
+			return SnmpPDU{Name: oid, Type: NoSuchObject}, nil
+		}
+		return SnmpPDU{Name: oid, Type: EndOfMibView}, nil
+	}
+	if t == GetRequest {
+		if !access.readable(oid) {
+			return SnmpPDU{Name: oid, Type: NoSuchObject}, nil
+		}
+		return a.Handler.Get(oid)
+	}
+	for {
+		pdu, err := a.Handler.GetNext(oid)
+		if err != nil || pdu.Type == EndOfMibView || access.readable(pdu.Name) {
+			return pdu, err
+		}
+		if !oidLess(oid, pdu.Name) {
+			return SnmpPDU{}, fmt.Errorf("GetNext of %s returned %s", oid, pdu.Name)
+		}
+		oid = pdu.Name
+	}
+}
+
+// getBulk answers a GetBulkRequest as per RFC 3416 section 4.2.3, with the
+// repetitions that fit into the MaxMsgSize of the agent.
+func (a *Agent) getBulk(req *SnmpPacket, access agentAccess) (*SnmpPacket, error) {
+	nonRepeaters := int(req.NonRepeaters)
+	if nonRepeaters > len(req.Variables) {
+		nonRepeaters = len(req.Variables)
+	}
+	var vars []SnmpPDU
+	for i, v := range req.Variables[:nonRepeaters] {
+		pdu, err := a.lookup(access, GetNextRequest, v.Name)
+		if err != nil {
+			a.Params.Logger.Printf("Agent: error reading %s: %s\n", v.Name, err)
+			return req.ErrorResponse(GenErr, i+1)
+		}
+		vars = append(vars, pdu)
+	}
+
+	resp := req.Response(nil)
+	size, err := headerSize(resp)
+	if err != nil {
+		return nil, err
+	}
+	if size, err = varbindsSize(size, vars); err != nil {
+		return nil, err
+	}
+	repeaters := req.Variables[nonRepeaters:]
+	last := make([]SnmpPDU, len(repeaters))
+	copy(last, repeaters)
+	for r := uint32(0); r < req.MaxRepetitions && len(repeaters) > 0; r++ {
+		row := make([]SnmpPDU, 0, len(repeaters))
+		ended := true
+		for i, prev := range last {
+			pdu := prev
+			if r == 0 || prev.Type != EndOfMibView {
+				if pdu, err = a.lookup(access, GetNextRequest, prev.Name); err != nil {
+					a.Params.Logger.Printf("Agent: error reading %s: %s\n", prev.Name, err)
+					return req.ErrorResponse(GenErr, nonRepeaters+i+1)
+				}
+			}
+			if pdu.Type != EndOfMibView {
+				ended = false
+			}
+			row = append(row, pdu)
+		}
+		rowSize, err := varbindsSize(size, row)
+		if err != nil {
+			return nil, err
+		}
+		if rowSize > a.maxMsgSize() {
+			break
+		}
+		size = rowSize
+		vars = append(vars, row...)
+		copy(last, row)
+		if ended {
+			break
+		}
+	}
+	resp.Variables = vars
+	return resp, nil
+}
+
+// headerSize returns the size of resp without variables, with room for the
+// longer length encodings of a larger message.
+func headerSize(resp *SnmpPacket) (int, error) {
+	empty := *resp
+	empty.Variables = nil
+	out, err := empty.marshalMsg()
+	return len(out) + 8, err
+}
+
+// varbindsSize returns size plus the size of the encoded vars.
+func varbindsSize(size int, vars []SnmpPDU) (int, error) {
+	for i := range vars {
+		vb, err := marshalVarbind(&vars[i])
+		if err != nil {
+			return 0, err
+		}
+		size += len(vb)
+	}
+	return size, nil
+}
+
+// set answers a SetRequest, in phases as described by AgentSetHandler.
+func (a *Agent) set(req *SnmpPacket, access agentAccess) (*SnmpPacket, error) {
+	handler, ok := a.Handler.(AgentSetHandler)
+	if !ok || access.vacm == nil && !access.canWrite {
+		if len(req.Variables) == 0 {
+			return req.ErrorResponse(NoAccess, 0)
+		}
+		return req.ErrorResponse(NoAccess, 1)
+	}
+	for i, v := range req.Variables {
+		if !access.writable(v.Name) {
+			return req.ErrorResponse(NoAccess, i+1)
+		}
+	}
+	for i, v := range req.Variables {
+		if status := handler.TestSet(v); status != NoError {
+			return req.ErrorResponse(status, i+1)
+		}
+	}
+	previous := make([]SnmpPDU, len(req.Variables))
+	for i, v := range req.Variables {
+		prev, err := handler.Get(v.Name)
+		if err != nil {
+			a.Params.Logger.Printf("Agent: error reading %s: %s\n", v.Name, err)
+			return req.ErrorResponse(GenErr, i+1)
+		}
+		previous[i] = prev
+	}
+	for i, v := range req.Variables {
+		err := handler.CommitSet(v)
+		if err == nil {
+			continue
+		}
+		a.Params.Logger.Printf("Agent: error setting %s: %s\n", v.Name, err)
+		for j := i - 1; j >= 0; j-- {
+			if err = handler.UndoSet(req.Variables[j], previous[j]); err != nil {
+				a.Params.Logger.Printf("Agent: error undoing set of %s: %s\n", req.Variables[j].Name, err)
+				return req.ErrorResponse(UndoFailed, 0)
+			}
+		}
+		return req.ErrorResponse(CommitFailed, i+1)
+	}
+	return req.Response(append([]SnmpPDU(nil), req.Variables...)), nil
+}
+
+// v1ErrorStatus maps the SNMPv2 error statuses of resp to those of SNMPv1,
+// RFC 3584 section 4.4.
+func v1ErrorStatus(resp *SnmpPacket) {
+	switch resp.Error {
+	case WrongValue, WrongEncoding, WrongType, WrongLength, InconsistentValue:
+		resp.Error = BadValue
+	case NoAccess, NotWritable, NoCreation, InconsistentName, AuthorizationError:
+		resp.Error = NoSuchName
+	case ResourceUnavailable, CommitFailed, UndoFailed:
+		resp.Error = GenErr
+	}
+}
+
+// isException reports whether t is one of the SNMPv2 exceptions in place of
+// a value.
+func isException(t Asn1BER) bool {
+	return t == NoSuchObject || t == NoSuchInstance || t == EndOfMibView
+}
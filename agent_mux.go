@@ -0,0 +1,216 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gosnmp/gosnmp/oids"
+)
+
+// AgentMux is an AgentHandler dispatching to the handlers registered for
+// subtrees of the OID tree, like the subagents of an extensible agent:
+//
+//	mux := gosnmp.NewAgentMux()
+//	err := mux.Register(".1.3.6.1.2.1.1", systemGroup)
+//	err = mux.Register(".1.3.6.1.4.1.99999", appMetrics)
+//	agent.Handler = mux
+//
+// A variable belongs to the handler registered for the longest root it is
+// in, so a handler can be registered inside the subtree of another to
+// serve part of it. GetNext traverses the handlers in lexicographic order,
+// skipping the variables a handler returns outside its part of the tree,
+// and ends with EndOfMibView after the last variable of the last handler.
+//
+// Handlers of SetRequests must be AgentSetHandlers, setting the variables
+// of other handlers fails with NotWritable and those outside any subtree
+// with NoCreation.
+type AgentMux struct {
+	mu    sync.RWMutex
+	roots []agentRegistration // sorted by root
+}
+
+type agentRegistration struct {
+	root    string
+	handler AgentHandler
+}
+
+// NewAgentMux returns an AgentMux without registrations.
+func NewAgentMux() *AgentMux {
+	return &AgentMux{}
+}
+
+// Register serves the subtree below root with h, which may be registered
+// while the agent is running.
+func (m *AgentMux) Register(root string, h AgentHandler) error {
+	if h == nil {
+		return fmt.Errorf("no handler for %s", root)
+	}
+	root = dottedOID(root)
+	if _, err := marshalObjectIdentifier(root); err != nil {
+		return fmt.Errorf("invalid root %q: %w", root, err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := sort.Search(len(m.roots), func(i int) bool { return !oidLess(m.roots[i].root, root) })
+	if i < len(m.roots) && m.roots[i].root == root {
+		return fmt.Errorf("%s is already registered", root)
+	}
+	m.roots = append(m.roots, agentRegistration{})
+	copy(m.roots[i+1:], m.roots[i:])
+	m.roots[i] = agentRegistration{root: root, handler: h}
+	return nil
+}
+
+// Unregister removes the handler of root, reporting whether there was one.
+func (m *AgentMux) Unregister(root string) bool {
+	root = dottedOID(root)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.roots {
+		if r.root == root {
+			m.roots = append(m.roots[:i], m.roots[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// owner returns the registration of the longest root oid is in, or false.
+// The caller holds m.mu.
+func (m *AgentMux) owner(oid string) (agentRegistration, bool) {
+	var owner agentRegistration
+	found := false
+	for _, r := range m.roots {
+		if oids.Under(oid, r.root) && (!found || len(r.root) > len(owner.root)) {
+			owner, found = r, true
+		}
+	}
+	return owner, found
+}
+
+// Get returns the variable oid from the handler it belongs to.
+func (m *AgentMux) Get(oid string) (SnmpPDU, error) {
+	m.mu.RLock()
+	r, ok := m.owner(oid)
+	m.mu.RUnlock()
+	if !ok {
+		return SnmpPDU{Name: oid, Type: NoSuchObject}, nil
+	}
+	return r.handler.Get(oid)
+}
+
+// GetNext returns the first variable after oid of all handlers.
+func (m *AgentMux) GetNext(oid string) (SnmpPDU, error) {
+	m.mu.RLock()
+	roots := append([]agentRegistration(nil), m.roots...)
+	m.mu.RUnlock()
+
+	next := SnmpPDU{Name: oid, Type: EndOfMibView}
+	for _, r := range roots {
+		// registrations are sorted, those after a variable found cannot
+		// hold an earlier one
+		if next.Type != EndOfMibView && !oidLess(r.root, next.Name) {
+			break
+		}
+		cur := oid
+		for {
+			pdu, err := r.handler.GetNext(cur)
+			if err != nil {
+				return SnmpPDU{}, err
+			}
+			if pdu.Type == EndOfMibView || !oids.Under(pdu.Name, r.root) || !oidLess(cur, pdu.Name) {
+				break
+			}
+			if next.Type != EndOfMibView && !oidLess(pdu.Name, next.Name) {
+				break
+			}
+			m.mu.RLock()
+			owner, _ := m.owner(pdu.Name)
+			m.mu.RUnlock()
+			if owner.root == r.root {
+				next = pdu
+				break
+			}
+			// in the subtree of a handler registered below r
+			cur = pdu.Name
+		}
+	}
+	return next, nil
+}
+
+// BeginRequest calls the BeginRequest of the handlers that are an
+// AgentRequestHook.
+func (m *AgentMux) BeginRequest() {
+	m.mu.RLock()
+	roots := append([]agentRegistration(nil), m.roots...)
+	m.mu.RUnlock()
+	for _, r := range roots {
+		if hook, ok := r.handler.(AgentRequestHook); ok {
+			hook.BeginRequest()
+		}
+	}
+}
+
+// setHandler returns the AgentSetHandler pdu belongs to, or the status of
+// the failure.
+func (m *AgentMux) setHandler(pdu SnmpPDU) (AgentSetHandler, SNMPError) {
+	m.mu.RLock()
+	r, ok := m.owner(pdu.Name)
+	m.mu.RUnlock()
+	if !ok {
+		return nil, NoCreation
+	}
+	h, ok := r.handler.(AgentSetHandler)
+	if !ok {
+		return nil, NotWritable
+	}
+	return h, NoError
+}
+
+// TestSet checks pdu with the handler it belongs to.
+func (m *AgentMux) TestSet(pdu SnmpPDU) SNMPError {
+	h, status := m.setHandler(pdu)
+	if status != NoError {
+		return status
+	}
+	return h.TestSet(pdu)
+}
+
+// CommitSet sets pdu with the handler it belongs to.
+func (m *AgentMux) CommitSet(pdu SnmpPDU) error {
+	h, status := m.setHandler(pdu)
+	if status != NoError {
+		return fmt.Errorf("no writable handler for %s: %s", pdu.Name, status)
+	}
+	return h.CommitSet(pdu)
+}
+
+// UndoSet restores pdu with the handler it belongs to.
+func (m *AgentMux) UndoSet(pdu, previous SnmpPDU) error {
+	h, status := m.setHandler(pdu)
+	if status != NoError {
+		return fmt.Errorf("no writable handler for %s: %s", pdu.Name, status)
+	}
+	return h.UndoSet(pdu, previous)
+}
+
+// Register serves the subtree below root with h, see AgentMux. The Handler
+// of the agent must be unset, it then becomes an AgentMux, or be an
+// AgentMux.
+func (a *Agent) Register(root string, h AgentHandler) error {
+	a.serve.Lock()
+	if a.Handler == nil {
+		a.Handler = NewAgentMux()
+	}
+	mux, ok := a.Handler.(*AgentMux)
+	a.serve.Unlock()
+	if !ok {
+		return fmt.Errorf("the agent Handler is a %T, not an AgentMux", a.Handler)
+	}
+	return mux.Register(root, h)
+}
@@ -0,0 +1,88 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func handlerOf(pdus ...SnmpPDU) *testAgentHandler {
+	h := &testAgentHandler{vars: map[string]SnmpPDU{}}
+	for _, pdu := range pdus {
+		h.vars[pdu.Name] = pdu
+	}
+	return h
+}
+
+func TestAgentMux(t *testing.T) {
+	app := handlerOf(
+		SnmpPDU{Name: ".1.3.6.1.4.1.99999.1.0", Type: Integer, Value: 1},
+		// hidden by the handler registered for .1.3.6.1.4.1.99999.2
+		SnmpPDU{Name: ".1.3.6.1.4.1.99999.2.1.0", Type: Integer, Value: 2},
+		SnmpPDU{Name: ".1.3.6.1.4.1.99999.2.2.0", Type: Integer, Value: 2},
+		SnmpPDU{Name: ".1.3.6.1.4.1.99999.3.0", Type: Integer, Value: 3},
+		// outside the subtree of the handler
+		SnmpPDU{Name: ".1.3.6.1.4.1.99999999.1.0", Type: Integer, Value: 4},
+	)
+	queues := handlerOf(SnmpPDU{Name: ".1.3.6.1.4.1.99999.2.5.0", Type: Gauge32, Value: uint(7)})
+	system := struct{ AgentHandler }{handlerOf(SnmpPDU{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: []byte("router")})}
+
+	a := NewAgent()
+	a.WriteCommunity = "private"
+	require.NoError(t, a.Register("1.3.6.1.4.1.99999", app))
+	require.NoError(t, a.Register(".1.3.6.1.4.1.99999.2", queues))
+	require.NoError(t, a.Register(".1.3.6.1.2.1.1", system))
+	require.Error(t, a.Register(".1.3.6.1.2.1.1", system))
+	require.Error(t, a.Register(".1.3.6.1.x", system))
+	x := startAgent(t, a, Version2c, "private")
+
+	all, err := x.BulkWalkAll(".1.3")
+	require.NoError(t, err)
+	var names []string
+	for _, pdu := range all {
+		names = append(names, pdu.Name)
+	}
+	assert.Equal(t, []string{".1.3.6.1.2.1.1.5.0", ".1.3.6.1.4.1.99999.1.0", ".1.3.6.1.4.1.99999.2.5.0", ".1.3.6.1.4.1.99999.3.0"}, names)
+
+	result, err := x.Get([]string{".1.3.6.1.4.1.99999.2.1.0", ".1.3.6.1.4.1.99999.3.0", ".1.3.6.1.2.1.2.1.0"})
+	require.NoError(t, err)
+	assert.Equal(t, NoSuchObject, result.Variables[0].Type)
+	assert.Equal(t, 3, result.Variables[1].Value)
+	assert.Equal(t, NoSuchObject, result.Variables[2].Type)
+
+	result, err = x.GetNext([]string{".1.3.6.1.4.1.99999.3.0"})
+	require.NoError(t, err)
+	assert.Equal(t, EndOfMibView, result.Variables[0].Type)
+
+	result, err = x.Set([]SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "core"}})
+	require.NoError(t, err)
+	assert.Equal(t, NotWritable, result.Error)
+	result, err = x.Set([]SnmpPDU{{Name: ".1.3.6.1.2.1.2.1.0", Type: Integer, Value: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, NoCreation, result.Error)
+	result, err = x.Set([]SnmpPDU{{Name: ".1.3.6.1.4.1.99999.1.0", Type: Integer, Value: 5}})
+	require.NoError(t, err)
+	assert.Equal(t, NoError, result.Error)
+	v, err := app.Get(".1.3.6.1.4.1.99999.1.0")
+	require.NoError(t, err)
+	assert.Equal(t, 5, v.Value)
+
+	mux := a.Handler.(*AgentMux)
+	assert.True(t, mux.Unregister(".1.3.6.1.4.1.99999.2"))
+	assert.False(t, mux.Unregister(".1.3.6.1.4.1.99999.2"))
+	result, err = x.GetNext([]string{".1.3.6.1.4.1.99999.1.0"})
+	require.NoError(t, err)
+	assert.Equal(t, ".1.3.6.1.4.1.99999.2.1.0", result.Variables[0].Name)
+
+	other := NewAgent()
+	other.Handler = app
+	assert.Error(t, other.Register(".1.3.6.1.2.1.1", system))
+}
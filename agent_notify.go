@@ -0,0 +1,208 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// NotifyTarget is a manager the notifications of an Agent are sent to.
+type NotifyTarget struct {
+	// Session is the connected session the notifications are sent on. Its
+	// Version selects the notification: SNMPv1 traps are translated as
+	// per RFC 3584 section 3.2, with the agent-addr of snmpTrapAddress.0.
+	// SNMPv3 traps are authoritative for the LocalEngine of the session,
+	// e.g. the Engine of the agent.
+	Session *GoSNMP
+
+	// Inform sends InformRequests, acknowledged by the manager, instead of
+	// traps to SNMPv2c and SNMPv3 sessions.
+	Inform bool
+}
+
+// NotifyError is returned by Notify when notifications could not be sent
+// to some of the targets.
+type NotifyError struct {
+	// Errors holds the error of each failed target by its index.
+	Errors map[int]error
+}
+
+func (e *NotifyError) Error() string {
+	indexes := e.Indexes()
+	return fmt.Sprintf("notifying %d targets failed, target %d: %s", len(indexes), indexes[0], e.Errors[indexes[0]])
+}
+
+// Indexes returns the indexes of the failed targets in ascending order.
+func (e *NotifyError) Indexes() []int {
+	out := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		out = append(out, i)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// uptime returns the sysUpTime of the agent, in hundredths of a second
+// since it started listening or first notified.
+func (a *Agent) uptime() uint32 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.started.IsZero() {
+		a.started = time.Now()
+	}
+	return uint32(time.Since(a.started) / (10 * time.Millisecond))
+}
+
+// Notify sends the notification trapOID with vars, e.g. linkDown with the
+// ifIndex of an interface, to the NotifyTargets of the agent. sysUpTime.0
+// and snmpTrapOID.0 are prepended to vars. With a VACM, a target is only
+// notified if its community or user may see trapOID and vars in its
+// notify view.
+//
+// Targets are notified in order, a failure does not stop the others, and
+// Notify returns once the informs are acknowledged, so a handler serving a
+// request should rather notify from another goroutine.
+func (a *Agent) Notify(trapOID string, vars ...SnmpPDU) error {
+	trapOID = dottedOID(trapOID)
+	if _, err := marshalObjectIdentifier(trapOID); err != nil {
+		return fmt.Errorf("invalid notification %q: %w", trapOID, err)
+	}
+	notification := &SnmpPacket{
+		PDUType: SNMPv2Trap,
+		Variables: append([]SnmpPDU{
+			{Name: sysUpTimeOID, Type: TimeTicks, Value: a.uptime()},
+			{Name: snmpTrapOIDOID, Type: ObjectIdentifier, Value: trapOID},
+		}, vars...),
+	}
+
+	a.notify.Lock()
+	defer a.notify.Unlock()
+	failed := &NotifyError{Errors: make(map[int]error)}
+	for i, target := range a.NotifyTargets {
+		if target.Session == nil {
+			failed.Errors[i] = errors.New("no session")
+			continue
+		}
+		if !a.notifyAllowed(target.Session, trapOID, vars) {
+			continue
+		}
+		if err := a.sendNotification(target, notification); err != nil {
+			failed.Errors[i] = err
+		}
+	}
+	if len(failed.Errors) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// notifyAllowed reports whether the VACM of the agent, if any, lets the
+// principal of x see the notification trapOID with vars.
+func (a *Agent) notifyAllowed(x *GoSNMP, trapOID string, vars []SnmpPDU) bool {
+	if a.VACM == nil {
+		return true
+	}
+	allowed := func(oid string) bool {
+		return a.VACM.CommunityAllowed(x.Community, VACMNotify, oid)
+	}
+	if x.Version == Version3 {
+		sp, ok := x.SecurityParameters.(*UsmSecurityParameters)
+		if !ok {
+			return false
+		}
+		allowed = func(oid string) bool {
+			return a.VACM.UserAllowed(sp.UserName, x.MsgFlags, VACMNotify, oid)
+		}
+	}
+	if !allowed(trapOID) {
+		return false
+	}
+	for _, v := range vars {
+		if !allowed(v.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *Agent) sendNotification(target NotifyTarget, notification *SnmpPacket) error {
+	x := target.Session
+	switch {
+	case x.Version == Version1:
+		trap, err := (&V1TrapTranslator{}).Translate(notification, nil)
+		if err != nil {
+			return err
+		}
+		_, err = x.SendV1Trap(trap)
+		return err
+	case target.Inform:
+		_, err := x.SendInform(SnmpTrap{Variables: notification.Variables})
+		return err
+	}
+	_, err := x.SendTrap(SnmpTrap{Variables: notification.Variables})
+	return err
+}
+
+// Watch reads the variable oid from the Handler every interval and
+// notifies trapOID with the variable when its value changes, e.g. to send
+// a notification whenever a status changes, until stop is called. Errors
+// reading the variable or notifying are logged.
+func (a *Agent) Watch(oid string, interval time.Duration, trapOID string) (stop func(), err error) {
+	oid = dottedOID(oid)
+	if _, err := marshalObjectIdentifier(oid); err != nil {
+		return nil, fmt.Errorf("invalid OID %q: %w", oid, err)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid interval %s", interval)
+	}
+	if a.Params == nil {
+		a.Params = Default
+	}
+	last, err := a.read(oid)
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			pdu, err := a.read(oid)
+			if err != nil {
+				a.Params.Logger.Printf("Agent: error watching %s: %s\n", oid, err)
+				continue
+			}
+			if pdu.Type == last.Type && reflect.DeepEqual(pdu.Value, last.Value) {
+				continue
+			}
+			last = pdu
+			if err = a.Notify(trapOID, pdu); err != nil {
+				a.Params.Logger.Printf("Agent: error notifying %s of %s: %s\n", trapOID, oid, err)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }, nil
+}
+
+// read returns the variable oid of the Handler, as a GetRequest would.
+func (a *Agent) read(oid string) (SnmpPDU, error) {
+	a.serve.Lock()
+	defer a.serve.Unlock()
+	if hook, ok := a.Handler.(AgentRequestHook); ok {
+		hook.BeginRequest()
+	}
+	return a.lookup(agentAccess{}, GetRequest, oid)
+}
@@ -0,0 +1,128 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// notifyReceiver runs a TrapListener, returning its port and the
+// notifications received.
+func notifyReceiver(t *testing.T) (uint16, func() []*SnmpPacket) {
+	var mu sync.Mutex
+	var traps []*SnmpPacket
+	e := NewEndpoint()
+	e.TrapListener = NewTrapListener()
+	e.TrapListener.Params = &GoSNMP{Community: "public", Version: Version2c}
+	e.TrapListener.OnNewTrap = func(p *SnmpPacket, _ *net.UDPAddr) {
+		mu.Lock()
+		traps = append(traps, p)
+		mu.Unlock()
+	}
+	port := startEndpoint(t, e)
+	return port, func() []*SnmpPacket {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*SnmpPacket(nil), traps...)
+	}
+}
+
+func notifySession(t *testing.T, port uint16, version SnmpVersion, community string) *GoSNMP {
+	x := &GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      port,
+		Community: community,
+		Version:   version,
+		Timeout:   time.Second,
+	}
+	require.NoError(t, x.Connect())
+	t.Cleanup(func() { x.Conn.Close() })
+	return x
+}
+
+func TestAgentNotify(t *testing.T) {
+	port, received := notifyReceiver(t)
+	a := NewAgent()
+	a.NotifyTargets = []NotifyTarget{
+		{Session: notifySession(t, port, Version2c, "public")},
+		{Session: notifySession(t, port, Version2c, "public"), Inform: true},
+		{Session: notifySession(t, port, Version1, "public")},
+	}
+	linkDown := ".1.3.6.1.6.3.1.1.5.3"
+	ifIndex := SnmpPDU{Name: ".1.3.6.1.2.1.2.2.1.1.2", Type: Integer, Value: 2}
+	require.NoError(t, a.Notify(linkDown, ifIndex))
+
+	require.Eventually(t, func() bool { return len(received()) == 3 }, time.Second, time.Millisecond)
+	traps := received()
+	for _, p := range traps {
+		assert.Equal(t, linkDown, p.TrapOID)
+	}
+	assert.Equal(t, SNMPv2Trap, traps[0].PDUType)
+	assert.True(t, traps[1].IsInform)
+	assert.Equal(t, Trap, traps[2].PDUType)
+	assert.Equal(t, 2, traps[2].GenericTrap, "linkDown")
+
+	a.NotifyTargets = append(a.NotifyTargets, NotifyTarget{})
+	err := a.Notify(linkDown)
+	var nerr *NotifyError
+	require.ErrorAs(t, err, &nerr)
+	assert.Equal(t, []int{3}, nerr.Indexes())
+	assert.Error(t, a.Notify("linkDown"))
+}
+
+func TestAgentNotifyVACM(t *testing.T) {
+	port, received := notifyReceiver(t)
+	v := NewVACM()
+	require.NoError(t, v.AddView("linkTraps", ViewSubtree{OID: ".1.3.6.1.6.3.1.1.5"}, ViewSubtree{OID: ".1.3.6.1.2.1.2.2.1"}))
+	require.NoError(t, v.AddCommunity("public", "nms"))
+	require.NoError(t, v.SetAccess("nms", VACMAccess{NotifyView: "linkTraps"}))
+	a := NewAgent()
+	a.VACM = v
+	a.NotifyTargets = []NotifyTarget{
+		{Session: notifySession(t, port, Version2c, "public")},
+		{Session: notifySession(t, port, Version2c, "other")},
+	}
+
+	require.NoError(t, a.Notify(".1.3.6.1.6.3.1.1.5.3", SnmpPDU{Name: ".1.3.6.1.2.1.2.2.1.1.2", Type: Integer, Value: 2}))
+	require.NoError(t, a.Notify(".1.3.6.1.6.3.1.1.5.3", SnmpPDU{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "router"}))
+	require.NoError(t, a.Notify(".1.3.6.1.4.1.99999.0.1"))
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, received(), 1, "only the notification in the view of public")
+}
+
+func TestAgentWatch(t *testing.T) {
+	port, received := notifyReceiver(t)
+	h := &testAgentHandler{vars: testAgentVars()}
+	a := NewAgent()
+	a.Handler = h
+	a.Params = &GoSNMP{Logger: NewLogger(nil)}
+	a.NotifyTargets = []NotifyTarget{{Session: notifySession(t, port, Version2c, "public")}}
+
+	stop, err := a.Watch(".1.3.6.1.2.1.1.5.0", 5*time.Millisecond, ".1.3.6.1.4.1.99999.0.1")
+	require.NoError(t, err)
+	defer stop()
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, received(), "no change")
+
+	require.NoError(t, h.CommitSet(SnmpPDU{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "core"}))
+	require.Eventually(t, func() bool { return len(received()) == 1 }, time.Second, time.Millisecond)
+	trap := received()[0]
+	assert.Equal(t, ".1.3.6.1.4.1.99999.0.1", trap.TrapOID)
+	assert.Equal(t, ".1.3.6.1.2.1.1.5.0", trap.Variables[2].Name)
+	stop()
+	stop()
+
+	_, err = a.Watch(".1.3.6.1.2.1.1.5.0", 0, ".1.3.6.1.4.1.99999.0.1")
+	assert.Error(t, err)
+}
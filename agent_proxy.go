@@ -0,0 +1,105 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ProxyTarget is a backend agent an Agent forwards requests to, as the proxy
+// forwarder application of RFC 3413 section 3.5 does. The requests matched
+// by a target are answered with the response of the backend, instead of
+// the variables of the Handler, whatever the VACM of the agent.
+type ProxyTarget struct {
+	// Community matches the SNMPv1 and SNMPv2c requests of that community,
+	// which need not be a community of the agent.
+	Community string
+
+	// ContextEngineID and ContextName match the authenticated SNMPv3
+	// requests to that context engine ID and context name, an empty one
+	// matching any. A target with neither matches no SNMPv3 request.
+	ContextEngineID string
+	ContextName     string
+
+	// Session is the connected session the requests are forwarded on, in
+	// its version, with its credentials and context. Requests and responses
+	// are translated between versions as per RFC 3584 section 4: a
+	// GetBulkRequest is forwarded to an SNMPv1 agent as a GetNextRequest,
+	// and the exceptions and Counter64 values of the responses to SNMPv1
+	// requests answered with NoSuchName. The agent answers one request at a
+	// time, so the Timeout of the session bounds the wait of the others.
+	Session *GoSNMP
+}
+
+// proxyTarget returns the first ProxyTarget matching the request req.
+func (a *Agent) proxyTarget(req *SnmpPacket) (ProxyTarget, bool) {
+	for _, target := range a.ProxyTargets {
+		if req.Version != Version3 {
+			if target.Community != "" && target.Community == req.Community {
+				return target, true
+			}
+			continue
+		}
+		if target.ContextEngineID == "" && target.ContextName == "" {
+			continue
+		}
+		if (target.ContextEngineID == "" || target.ContextEngineID == req.ContextEngineID) &&
+			(target.ContextName == "" || target.ContextName == req.ContextName) {
+			return target, true
+		}
+	}
+	return ProxyTarget{}, false
+}
+
+// forward sends the request req to the backend of target and returns the
+// response to req, translated between their versions.
+func (a *Agent) forward(req *SnmpPacket, target ProxyTarget) (*SnmpPacket, error) {
+	x := target.Session
+	if x == nil {
+		return nil, errors.New("proxy target without session")
+	}
+	pduType, nonRepeaters, maxRepetitions := req.PDUType, req.NonRepeaters, req.MaxRepetitions
+	switch pduType {
+	case GetRequest, GetNextRequest, SetRequest:
+	case GetBulkRequest:
+		if req.Version == Version1 {
+			return nil, fmt.Errorf("GetBulkRequest in an SNMPv1 message")
+		}
+		if x.Version == Version1 {
+			// RFC 3584 section 4.2.2.1, a single repetition
+			pduType, nonRepeaters, maxRepetitions = GetNextRequest, 0, 0
+		}
+	default:
+		return nil, fmt.Errorf("unexpected PDU type 0x%x", byte(pduType))
+	}
+	vars := make([]SnmpPDU, 0, len(req.Variables))
+	for _, v := range req.Variables {
+		if pduType != SetRequest {
+			v = SnmpPDU{Name: v.Name, Type: Null}
+		}
+		vars = append(vars, v)
+	}
+
+	result, err := x.send(x.mkSnmpPacket(pduType, vars, nonRepeaters, maxRepetitions), true)
+	if err != nil {
+		return nil, fmt.Errorf("forwarding to %s: %w", x.Target, err)
+	}
+	if result.Error != NoError {
+		index := int(result.ErrorIndex)
+		if index > len(req.Variables) {
+			index = 0
+		}
+		return req.ErrorResponse(result.Error, index)
+	}
+	if req.Version == Version1 {
+		for i, v := range result.Variables {
+			if isException(v.Type) || v.Type == Counter64 {
+				return req.ErrorResponse(NoSuchName, i+1)
+			}
+		}
+	}
+	return req.Response(result.Variables), nil
+}
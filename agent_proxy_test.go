@@ -0,0 +1,92 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentProxy(t *testing.T) {
+	v2Backend := &testAgentHandler{vars: testAgentVars()}
+	v2Backend.vars[".1.3.6.1.2.1.31.1.1.1.6.1"] = SnmpPDU{Name: ".1.3.6.1.2.1.31.1.1.1.6.1", Type: Counter64, Value: uint64(1 << 40)}
+	v2 := NewAgent()
+	v2.Handler = v2Backend
+	v2.WriteCommunity = "private"
+	toV2 := startAgent(t, v2, Version2c, "private")
+
+	v1 := NewAgent()
+	v1.Handler = &testAgentHandler{vars: testAgentVars()}
+	toV1 := startAgent(t, v1, Version1, "public")
+
+	users := NewUsmUserTable()
+	require.NoError(t, users.Add(UsmUser{UserName: "operator"}))
+	proxy := NewAgent()
+	proxy.Users = users
+	proxy.ProxyTargets = []ProxyTarget{
+		{Community: "core", ContextName: "core", Session: toV2},
+		{Community: "legacy", Session: toV1},
+	}
+	x := startAgent(t, proxy, Version2c, "core")
+
+	// the requests of a community are forwarded, sets included
+	result, err := x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("router"), result.Variables[0].Value)
+	result, err = x.Set([]SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "core"}})
+	require.NoError(t, err)
+	assert.Equal(t, NoError, result.Error)
+	v, err := v2Backend.Get(".1.3.6.1.2.1.1.5.0")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("core"), v.Value)
+	result, err = x.Set([]SnmpPDU{{Name: ".1.3.6.1.2.1.1.99.0", Type: OctetString, Value: "new"}})
+	require.NoError(t, err)
+	assert.Equal(t, NoCreation, result.Error)
+	assert.Equal(t, uint8(1), result.ErrorIndex)
+
+	// GetBulk is forwarded to an SNMPv1 agent as GetNext
+	x.Community = "legacy"
+	result, err = x.GetBulk([]string{".1.3.6.1.2.1.1.1.0", ".1.3.6.1.2.1.1.5.0"}, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, result.Variables, 2)
+	assert.Equal(t, ".1.3.6.1.2.1.1.4.0", result.Variables[0].Name)
+	assert.Equal(t, ".1.3.6.1.2.1.1.7.0", result.Variables[1].Name)
+
+	// the other requests are answered by the proxy itself
+	x.Community = "public"
+	result, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, NoSuchObject, result.Variables[0].Type)
+
+	// exceptions and Counter64 are NoSuchName for SNMPv1 managers
+	x.Version = Version1
+	x.Community = "core"
+	result, err = x.Get([]string{".1.3.6.1.2.1.1.5.0", ".1.3.6.1.2.1.1.99.0"})
+	require.NoError(t, err)
+	assert.Equal(t, NoSuchName, result.Error)
+	assert.Equal(t, uint8(2), result.ErrorIndex)
+	result, err = x.Get([]string{".1.3.6.1.2.1.31.1.1.1.6.1"})
+	require.NoError(t, err)
+	assert.Equal(t, NoSuchName, result.Error)
+
+	// SNMPv3 requests are forwarded by context
+	x.Version = Version3
+	x.SecurityModel = UserSecurityModel
+	x.MsgFlags = NoAuthNoPriv | Reportable
+	x.SecurityParameters = &UsmSecurityParameters{UserName: "operator"}
+	x.ContextName = "core"
+	result, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("core"), result.Variables[0].Value)
+	assert.Equal(t, proxy.Engine.EngineID(), result.ContextEngineID)
+	result, err = x.GetBulk([]string{".1.3.6.1.2.1.31.1.1.1.6"}, 0, 5)
+	require.NoError(t, err)
+	assert.Equal(t, Counter64, result.Variables[0].Type)
+}
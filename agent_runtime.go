@@ -0,0 +1,152 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"expvar"
+	"math"
+	"runtime"
+	"time"
+
+	"github.com/gosnmp/gosnmp/oids"
+)
+
+// maxExpvarName bounds the names of the expvar variables served, whose
+// octets are part of their OIDs.
+const maxExpvarName = 96
+
+// processStart is the time the uptime of NewRuntimeVariables counts from.
+var processStart = time.Now() //nolint:gochecknoglobals
+
+// NewRuntimeVariables returns AgentVariables serving the statistics of the
+// Go runtime of the process below root, e.g. a subtree of the enterprise
+// of the application, read at most once per ttl, as ReadMemStats stops the
+// world:
+//
+//	vars, err := gosnmp.NewRuntimeVariables(".1.3.6.1.4.1.99999.10", time.Second)
+//	...
+//	err = agent.Register(".1.3.6.1.4.1.99999.10", vars)
+//
+// The variables are scalars, root.N.0 for N:
+//
+//	1  goroutines       Gauge32    runtime.NumGoroutine
+//	2  heapAlloc        Gauge32    KiB of allocated heap objects
+//	3  heapSys          Gauge32    KiB of heap obtained from the OS
+//	4  heapObjects      Gauge32    allocated heap objects
+//	5  stackInuse       Gauge32    KiB of stack spans in use
+//	6  sys              Gauge32    KiB obtained from the OS in total
+//	7  totalAlloc       Counter64  bytes allocated for heap objects
+//	8  mallocs          Counter64  heap objects allocated
+//	9  frees            Counter64  heap objects freed
+//	10 numGC            Counter32  completed GC cycles
+//	11 gcPauseTotal     Counter64  microseconds of GC stop-the-world pauses
+//	12 gcLastPause      Gauge32    microseconds of the last GC pause
+//	13 numCPU           Gauge32    runtime.NumCPU
+//	14 gomaxprocs       Gauge32    runtime.GOMAXPROCS
+//	15 uptime           TimeTicks  since the package was initialized
+func NewRuntimeVariables(root string, ttl time.Duration) (*AgentVariables, error) {
+	root = dottedOID(root)
+	vars := NewAgentVariables()
+	err := vars.Table(root, ttl, func() ([]SnmpPDU, error) {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		var lastPause uint64
+		if m.NumGC > 0 {
+			lastPause = m.PauseNs[(m.NumGC+255)%256]
+		}
+		scalar := func(n uint32, t Asn1BER, value interface{}) SnmpPDU {
+			return SnmpPDU{Name: oids.Join(root, n, 0), Type: t, Value: value}
+		}
+		return []SnmpPDU{
+			scalar(1, Gauge32, gauge32(uint64(runtime.NumGoroutine()))),
+			scalar(2, Gauge32, gauge32(m.HeapAlloc/1024)),
+			scalar(3, Gauge32, gauge32(m.HeapSys/1024)),
+			scalar(4, Gauge32, gauge32(m.HeapObjects)),
+			scalar(5, Gauge32, gauge32(m.StackInuse/1024)),
+			scalar(6, Gauge32, gauge32(m.Sys/1024)),
+			scalar(7, Counter64, m.TotalAlloc),
+			scalar(8, Counter64, m.Mallocs),
+			scalar(9, Counter64, m.Frees),
+			scalar(10, Counter32, m.NumGC),
+			scalar(11, Counter64, m.PauseTotalNs/1000),
+			scalar(12, Gauge32, gauge32(lastPause/1000)),
+			scalar(13, Gauge32, gauge32(uint64(runtime.NumCPU()))),
+			scalar(14, Gauge32, gauge32(uint64(runtime.GOMAXPROCS(0)))),
+			scalar(15, TimeTicks, uint32(time.Since(processStart)/(10*time.Millisecond))),
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// NewExpvarVariables returns AgentVariables serving the variables published
+// with the expvar package below root, read at most once per ttl, so that
+// the counters an application already exports over HTTP are also available
+// over SNMP. The variables form a table indexed by the name of the variable,
+// an OCTET STRING, whose entry is root.1:
+//
+//	1  name     OCTET STRING  the name of the variable
+//	2  value    OCTET STRING  its JSON value, Var.String
+//	3  integer  Counter64     its value if an expvar.Int, not negative,
+//	                          or an expvar.Float, truncated
+//
+// The members of an expvar.Map are rows of their own named "map.key". The
+// memstats variable, served by NewRuntimeVariables, and variables whose
+// names are longer than 96 octets are skipped.
+func NewExpvarVariables(root string, ttl time.Duration) (*AgentVariables, error) {
+	root = dottedOID(root)
+	entry := oids.Join(root, 1)
+	vars := NewAgentVariables()
+	err := vars.Table(root, ttl, func() ([]SnmpPDU, error) {
+		var rows []SnmpPDU
+		var add func(name string, v expvar.Var)
+		add = func(name string, v expvar.Var) {
+			if m, ok := v.(*expvar.Map); ok {
+				m.Do(func(kv expvar.KeyValue) { add(name+"."+kv.Key, kv.Value) })
+				return
+			}
+			if len(name) > maxExpvarName {
+				return
+			}
+			index := RowIndex{}.OctetString(name).subids
+			column := func(c uint32) string {
+				return oids.Join(oids.Join(entry, c), index...)
+			}
+			rows = append(rows,
+				SnmpPDU{Name: column(1), Type: OctetString, Value: []byte(name)},
+				SnmpPDU{Name: column(2), Type: OctetString, Value: []byte(v.String())})
+			switch v := v.(type) {
+			case *expvar.Int:
+				if n := v.Value(); n >= 0 {
+					rows = append(rows, SnmpPDU{Name: column(3), Type: Counter64, Value: uint64(n)})
+				}
+			case *expvar.Float:
+				if f := v.Value(); f >= 0 && f < math.MaxUint64 {
+					rows = append(rows, SnmpPDU{Name: column(3), Type: Counter64, Value: uint64(f)})
+				}
+			}
+		}
+		expvar.Do(func(kv expvar.KeyValue) {
+			if kv.Key != "memstats" {
+				add(kv.Key, kv.Value)
+			}
+		})
+		return rows, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// gauge32 returns n as a Gauge32 value, capped at its maximum.
+func gauge32(n uint64) uint32 {
+	if n > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(n)
+}
@@ -0,0 +1,81 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp/oids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimeVariables(t *testing.T) {
+	const runtimeRoot, expvarRoot = ".1.3.6.1.4.1.99999.10", ".1.3.6.1.4.1.99999.11"
+	// expvar variables cannot be unpublished, reuse them with -count
+	requests, _ := expvar.Get("gosnmp_test_requests").(*expvar.Int)
+	if requests == nil {
+		requests = expvar.NewInt("gosnmp_test_requests")
+	}
+	requests.Set(42)
+	queues, _ := expvar.Get("gosnmp_test_queues").(*expvar.Map)
+	if queues == nil {
+		queues = expvar.NewMap("gosnmp_test_queues")
+	}
+	inbound := new(expvar.Int)
+	inbound.Set(7)
+	queues.Set("inbound", inbound)
+
+	a := NewAgent()
+	rt, err := NewRuntimeVariables(runtimeRoot, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, a.Register(runtimeRoot, rt))
+	ev, err := NewExpvarVariables(expvarRoot, 0)
+	require.NoError(t, err)
+	require.NoError(t, a.Register(expvarRoot, ev))
+	x := startAgent(t, a, Version2c, "public")
+
+	result, err := x.Get([]string{runtimeRoot + ".1.0", runtimeRoot + ".13.0", runtimeRoot + ".15.0"})
+	require.NoError(t, err)
+	assert.Equal(t, Gauge32, result.Variables[0].Type)
+	assert.NotZero(t, result.Variables[0].Value, "goroutines")
+	assert.NotZero(t, result.Variables[1].Value, "numCPU")
+	assert.Equal(t, TimeTicks, result.Variables[2].Type)
+
+	scalars, err := x.BulkWalkAll(runtimeRoot)
+	require.NoError(t, err)
+	assert.Len(t, scalars, 15)
+
+	column := func(c uint32, name string) string {
+		return oids.Join(oids.Join(expvarRoot, 1, c), RowIndex{}.OctetString(name).subids...)
+	}
+	result, err = x.Get([]string{
+		column(1, "gosnmp_test_requests"),
+		column(3, "gosnmp_test_requests"),
+		column(2, "gosnmp_test_queues.inbound"),
+		column(3, "gosnmp_test_queues.inbound"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("gosnmp_test_requests"), result.Variables[0].Value)
+	assert.Equal(t, uint64(42), result.Variables[1].Value)
+	assert.Equal(t, []byte("7"), result.Variables[2].Value)
+	assert.Equal(t, uint64(7), result.Variables[3].Value)
+
+	requests.Add(1)
+	result, err = x.Get([]string{column(3, "gosnmp_test_requests")})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(43), result.Variables[0].Value, "read again with a ttl of 0")
+
+	all, err := x.BulkWalkAll(expvarRoot)
+	require.NoError(t, err)
+	for _, pdu := range all {
+		assert.NotContains(t, pdu.Name, oids.Join("", RowIndex{}.OctetString("memstats").subids...))
+	}
+}
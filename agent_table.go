@@ -0,0 +1,374 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gosnmp/gosnmp/oids"
+)
+
+// RowIndex builds the index of a table row from the values of its INDEX
+// clause, encoded as per RFC 2578 section 7.7, e.g. the index of an
+// ipNetToMediaEntry:
+//
+//	index := gosnmp.RowIndex{}.Integer(ifIndex).IPAddress(ip)
+//
+// The zero RowIndex is empty.
+type RowIndex struct {
+	subids []uint32
+	err    error
+}
+
+func (i RowIndex) append(subids ...uint32) RowIndex {
+	all := make([]uint32, 0, len(i.subids)+len(subids))
+	all = append(all, i.subids...)
+	return RowIndex{subids: append(all, subids...), err: i.err}
+}
+
+// Integer appends an INTEGER or Unsigned32 value, one sub-identifier.
+func (i RowIndex) Integer(n uint32) RowIndex {
+	return i.append(n)
+}
+
+// OctetString appends an OCTET STRING of variable size, prefixed by its
+// length.
+func (i RowIndex) OctetString(s string) RowIndex {
+	return i.append(octetSubids(s, true)...)
+}
+
+// ImpliedOctetString appends an OCTET STRING of fixed size, or the last
+// value of an INDEX clause marked IMPLIED, without its length.
+func (i RowIndex) ImpliedOctetString(s string) RowIndex {
+	return i.append(octetSubids(s, false)...)
+}
+
+// IPAddress appends an IpAddress, four sub-identifiers. ip must be an IPv4
+// address.
+func (i RowIndex) IPAddress(ip net.IP) RowIndex {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		if i.err == nil {
+			i.err = fmt.Errorf("%v is not an IPv4 address", ip)
+		}
+		return i
+	}
+	return i.append(uint32(ip4[0]), uint32(ip4[1]), uint32(ip4[2]), uint32(ip4[3]))
+}
+
+// ObjectIdentifier appends an OBJECT IDENTIFIER, prefixed by its number of
+// sub-identifiers.
+func (i RowIndex) ObjectIdentifier(oid string) RowIndex {
+	subids, err := parseSubids(oid)
+	if err != nil {
+		if i.err == nil {
+			i.err = err
+		}
+		return i
+	}
+	return i.append(append([]uint32{uint32(len(subids))}, subids...)...)
+}
+
+// String returns the sub-identifiers of the index, e.g. "2.10.0.0.1".
+func (i RowIndex) String() string {
+	return strings.TrimPrefix(oids.Join("", i.subids...), ".")
+}
+
+// Err returns the error of the first value that could not be encoded.
+func (i RowIndex) Err() error {
+	return i.err
+}
+
+func octetSubids(s string, withLength bool) []uint32 {
+	subids := make([]uint32, 0, len(s)+1)
+	if withLength {
+		subids = append(subids, uint32(len(s)))
+	}
+	for j := 0; j < len(s); j++ {
+		subids = append(subids, uint32(s[j]))
+	}
+	return subids
+}
+
+func parseSubids(oid string) ([]uint32, error) {
+	oid = strings.TrimPrefix(oid, ".")
+	if oid == "" {
+		return nil, nil
+	}
+	var subids []uint32
+	for _, part := range strings.Split(oid, ".") {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", oid)
+		}
+		subids = append(subids, uint32(n))
+	}
+	return subids, nil
+}
+
+// AgentColumn is a column of an AgentTable.
+type AgentColumn struct {
+	// ID is the last sub-identifier of the column below the table entry.
+	ID uint32
+	// Type is the type of the values of the column.
+	Type Asn1BER
+}
+
+// AgentRow is a row of an AgentTable: its index and the values of the
+// columns, in the order of the columns of the table.
+type AgentRow struct {
+	Index  RowIndex
+	Values []interface{}
+}
+
+// AgentTable is an AgentHandler serving a conceptual table from its rows,
+// e.g. a custom ifTable:
+//
+//	t, err := gosnmp.NewAgentTable(oids.IfTable+".1",
+//		gosnmp.AgentColumn{ID: 1, Type: gosnmp.Integer},
+//		gosnmp.AgentColumn{ID: 2, Type: gosnmp.OctetString})
+//	err = t.SetRow(gosnmp.RowIndex{}.Integer(1), 1, "lo")
+//	err = agent.Register(oids.IfTable+".1", t)
+//
+// The variables of a row are named after the entry, the column ID and the
+// row index, and are served column by column in the order of the indexes,
+// so GetNext and GetBulk walk the table as RFC 3416 requires. A nil value
+// leaves the cell of a row empty.
+type AgentTable struct {
+	// Load, if set, returns the rows of the table, replacing those set
+	// before. It is called at most once per request, so the variables of a
+	// request, e.g. the rows of a GetBulkRequest, are one snapshot.
+	Load func() ([]AgentRow, error)
+
+	entry   string
+	columns []AgentColumn
+	order   []int // the columns by ID
+
+	mu     sync.Mutex
+	rows   []agentTableRow // sorted by index
+	loaded bool
+}
+
+type agentTableRow struct {
+	index  string
+	values []interface{} // by column of the table
+}
+
+// NewAgentTable returns an empty table of the entry OID with columns.
+func NewAgentTable(entry string, columns ...AgentColumn) (*AgentTable, error) {
+	entry = dottedOID(entry)
+	if _, err := marshalObjectIdentifier(entry); err != nil {
+		return nil, fmt.Errorf("invalid entry %q: %w", entry, err)
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("a table requires at least 1 column")
+	}
+	t := &AgentTable{entry: entry, columns: append([]AgentColumn(nil), columns...)}
+	for i, c := range t.columns {
+		for _, other := range t.columns[:i] {
+			if c.ID == other.ID {
+				return nil, fmt.Errorf("duplicate column %d", c.ID)
+			}
+		}
+		t.order = append(t.order, i)
+	}
+	sort.Slice(t.order, func(i, j int) bool { return t.columns[t.order[i]].ID < t.columns[t.order[j]].ID })
+	return t, nil
+}
+
+// SetRow adds the row index, or replaces its values, one per column of the
+// table in the order they were given to NewAgentTable.
+func (t *AgentTable) SetRow(index RowIndex, values ...interface{}) error {
+	row, err := t.row(AgentRow{Index: index, Values: values})
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	i := t.search(row.index)
+	if i < len(t.rows) && t.rows[i].index == row.index {
+		t.rows[i] = row
+		return nil
+	}
+	t.rows = append(t.rows, agentTableRow{})
+	copy(t.rows[i+1:], t.rows[i:])
+	t.rows[i] = row
+	return nil
+}
+
+// SetRows replaces the rows of the table.
+func (t *AgentTable) SetRows(rows []AgentRow) error {
+	sorted, err := t.sortedRows(rows)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rows = sorted
+	return nil
+}
+
+// DeleteRow removes the row index, reporting whether there was one.
+func (t *AgentTable) DeleteRow(index RowIndex) bool {
+	key := index.String()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	i := t.search(key)
+	if i == len(t.rows) || t.rows[i].index != key {
+		return false
+	}
+	t.rows = append(t.rows[:i], t.rows[i+1:]...)
+	return true
+}
+
+// Len returns the number of rows.
+func (t *AgentTable) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.rows)
+}
+
+func (t *AgentTable) row(r AgentRow) (agentTableRow, error) {
+	if err := r.Index.Err(); err != nil {
+		return agentTableRow{}, fmt.Errorf("invalid index: %w", err)
+	}
+	if len(r.Index.subids) == 0 {
+		return agentTableRow{}, errors.New("empty index")
+	}
+	if len(r.Values) != len(t.columns) {
+		return agentTableRow{}, fmt.Errorf("row %s has %d values for %d columns", r.Index, len(r.Values), len(t.columns))
+	}
+	return agentTableRow{index: r.Index.String(), values: append([]interface{}(nil), r.Values...)}, nil
+}
+
+func (t *AgentTable) sortedRows(rows []AgentRow) ([]agentTableRow, error) {
+	sorted := make([]agentTableRow, 0, len(rows))
+	for _, r := range rows {
+		row, err := t.row(r)
+		if err != nil {
+			return nil, err
+		}
+		sorted = append(sorted, row)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return oidLess(sorted[i].index, sorted[j].index) })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].index == sorted[i-1].index {
+			return nil, fmt.Errorf("duplicate row %s", sorted[i].index)
+		}
+	}
+	return sorted, nil
+}
+
+// search returns the position of the first row whose index is not before
+// index. The caller holds t.mu.
+func (t *AgentTable) search(index string) int {
+	return sort.Search(len(t.rows), func(i int) bool { return !oidLess(t.rows[i].index, index) })
+}
+
+// BeginRequest makes the next variable read call Load again.
+func (t *AgentTable) BeginRequest() {
+	t.mu.Lock()
+	t.loaded = false
+	t.mu.Unlock()
+}
+
+// load reads the rows with Load once per request. The caller holds t.mu.
+func (t *AgentTable) load() error {
+	if t.Load == nil || t.loaded {
+		return nil
+	}
+	rows, err := t.Load()
+	if err != nil {
+		return fmt.Errorf("error loading table %s: %w", t.entry, err)
+	}
+	if t.rows, err = t.sortedRows(rows); err != nil {
+		return fmt.Errorf("error loading table %s: %w", t.entry, err)
+	}
+	t.loaded = true
+	return nil
+}
+
+func (t *AgentTable) variable(c int, row agentTableRow) SnmpPDU {
+	return SnmpPDU{
+		Name:  t.entry + "." + strconv.FormatUint(uint64(t.columns[c].ID), 10) + "." + row.index,
+		Type:  t.columns[c].Type,
+		Value: row.values[c],
+	}
+}
+
+// Get returns the variable oid.
+func (t *AgentTable) Get(oid string) (SnmpPDU, error) {
+	oid = dottedOID(oid)
+	missing := SnmpPDU{Name: oid, Type: NoSuchObject}
+	suffix, ok := oids.Index(oid, t.entry)
+	if !ok {
+		return missing, nil
+	}
+	parts := strings.SplitN(suffix, ".", 2)
+	id, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return missing, nil
+	}
+	c := -1
+	for i, column := range t.columns {
+		if uint64(column.ID) == id {
+			c = i
+		}
+	}
+	if c < 0 {
+		return missing, nil
+	}
+	missing.Type = NoSuchInstance
+	if len(parts) < 2 {
+		return missing, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err = t.load(); err != nil {
+		return SnmpPDU{}, err
+	}
+	i := t.search(parts[1])
+	if i == len(t.rows) || t.rows[i].index != parts[1] || t.rows[i].values[c] == nil {
+		return missing, nil
+	}
+	return t.variable(c, t.rows[i]), nil
+}
+
+// GetNext returns the first variable after oid.
+func (t *AgentTable) GetNext(oid string) (SnmpPDU, error) {
+	oid = dottedOID(oid)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.load(); err != nil {
+		return SnmpPDU{}, err
+	}
+
+	for _, c := range t.order {
+		column := t.entry + "." + strconv.FormatUint(uint64(t.columns[c].ID), 10)
+		first := 0
+		if index, ok := oids.Index(oid, column); ok {
+			// the rows after the index of oid
+			first = sort.Search(len(t.rows), func(i int) bool { return oidLess(index, t.rows[i].index) })
+		} else if !oidLess(oid, column) {
+			// oid is the column or after it
+			if oid != column {
+				continue
+			}
+		}
+		for i := first; i < len(t.rows); i++ {
+			if t.rows[i].values[c] != nil {
+				return t.variable(c, t.rows[i]), nil
+			}
+		}
+	}
+	return SnmpPDU{Name: oid, Type: EndOfMibView}, nil
+}
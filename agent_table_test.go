@@ -0,0 +1,140 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRowIndex(t *testing.T) {
+	ip := net.ParseIP("10.0.0.1")
+	assert.Equal(t, "2.10.0.0.1", RowIndex{}.Integer(2).IPAddress(ip).String())
+	assert.Equal(t, "3.101.116.104.7", RowIndex{}.OctetString("eth").Integer(7).String())
+	assert.Equal(t, "101.116.104", RowIndex{}.ImpliedOctetString("eth").String())
+	assert.Equal(t, "0", RowIndex{}.OctetString("").String())
+	assert.Equal(t, "3.1.3.6", RowIndex{}.ObjectIdentifier(".1.3.6").String())
+
+	index := RowIndex{}.Integer(1)
+	assert.Equal(t, "1.2", index.Integer(2).String())
+	assert.Equal(t, "1.3", index.Integer(3).String(), "indexes do not share sub-identifiers")
+
+	assert.Error(t, RowIndex{}.IPAddress(net.ParseIP("::1")).Err())
+	assert.Error(t, RowIndex{}.ObjectIdentifier("1.x").Integer(1).Err())
+}
+
+func TestAgentTable(t *testing.T) {
+	const entry = ".1.3.6.1.4.1.99999.2.1"
+	table, err := NewAgentTable(entry,
+		AgentColumn{ID: 3, Type: Counter32},
+		AgentColumn{ID: 2, Type: OctetString})
+	require.NoError(t, err)
+	_, err = NewAgentTable(entry, AgentColumn{ID: 2}, AgentColumn{ID: 2})
+	require.Error(t, err, "duplicate column")
+
+	// rows are served in index order, whatever the order they were set in
+	require.NoError(t, table.SetRow(RowIndex{}.Integer(10), uint(100), "eth1"))
+	require.NoError(t, table.SetRow(RowIndex{}.Integer(2), uint(20), "eth0"))
+	require.NoError(t, table.SetRow(RowIndex{}.Integer(1), nil, "lo"))
+	require.NoError(t, table.SetRow(RowIndex{}.Integer(10), uint(101), "eth1"))
+	require.Error(t, table.SetRow(RowIndex{}.Integer(3), uint(1)), "missing value")
+	require.Error(t, table.SetRow(RowIndex{}, uint(1), "x"), "empty index")
+	assert.Equal(t, 3, table.Len())
+
+	a := NewAgent()
+	require.NoError(t, a.Register(entry, table))
+	x := startAgent(t, a, Version2c, "public")
+
+	all, err := x.BulkWalkAll(entry)
+	require.NoError(t, err)
+	var names []string
+	for _, v := range all {
+		names = append(names, v.Name)
+	}
+	assert.Equal(t, []string{
+		entry + ".2.1", entry + ".2.2", entry + ".2.10",
+		entry + ".3.2", entry + ".3.10",
+	}, names)
+	assert.Equal(t, uint(101), all[4].Value)
+
+	result, err := x.Get([]string{entry + ".2.2", entry + ".3.1", entry + ".2.7", entry + ".4.1"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("eth0"), result.Variables[0].Value)
+	assert.Equal(t, NoSuchInstance, result.Variables[1].Type, "empty cell")
+	assert.Equal(t, NoSuchInstance, result.Variables[2].Type)
+	assert.Equal(t, NoSuchObject, result.Variables[3].Type)
+
+	// GetNext from inside and between the columns
+	result, err = x.GetNext([]string{entry + ".2.2", entry + ".2.10", entry + ".2.3.1", entry + ".1"})
+	require.NoError(t, err)
+	names = nil
+	for _, v := range result.Variables {
+		names = append(names, v.Name)
+	}
+	assert.Equal(t, []string{entry + ".2.10", entry + ".3.2", entry + ".2.10", entry + ".2.1"}, names)
+
+	assert.True(t, table.DeleteRow(RowIndex{}.Integer(2)))
+	assert.False(t, table.DeleteRow(RowIndex{}.Integer(2)))
+	all, err = x.WalkAll(entry + ".3")
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, entry+".3.10", all[0].Name)
+}
+
+func TestAgentTableLoad(t *testing.T) {
+	const entry = ".1.3.6.1.4.1.99999.3.1"
+	table, err := NewAgentTable(entry, AgentColumn{ID: 1, Type: OctetString}, AgentColumn{ID: 2, Type: Gauge32})
+	require.NoError(t, err)
+	var loads int32
+	var failing int32
+	table.Load = func() ([]AgentRow, error) {
+		if atomic.LoadInt32(&failing) != 0 {
+			return nil, errors.New("no data")
+		}
+		n := uint(atomic.AddInt32(&loads, 1))
+		return []AgentRow{
+			{Index: RowIndex{}.OctetString("b"), Values: []interface{}{"b", n}},
+			{Index: RowIndex{}.OctetString("a"), Values: []interface{}{"a", n}},
+			{Index: RowIndex{}.OctetString("ab"), Values: []interface{}{"ab", n}},
+		}, nil
+	}
+
+	a := NewAgent()
+	require.NoError(t, a.Register(entry, table))
+	x := startAgent(t, a, Version2c, "public")
+
+	result, err := x.GetBulk([]string{entry}, 0, 10)
+	require.NoError(t, err)
+	var names []string
+	for _, v := range result.Variables[:6] {
+		names = append(names, v.Name)
+		if v.Type == Gauge32 {
+			assert.Equal(t, uint(1), v.Value, "one snapshot per request")
+		}
+	}
+	// length prefixed strings sort by length first
+	assert.Equal(t, []string{
+		entry + ".1.1.97", entry + ".1.1.98", entry + ".1.2.97.98",
+		entry + ".2.1.97", entry + ".2.1.98", entry + ".2.2.97.98",
+	}, names)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+
+	result, err = x.Get([]string{entry + ".2.1.97"})
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), result.Variables[0].Value, "loaded again for each request")
+
+	atomic.StoreInt32(&failing, 1)
+	result, err = x.Get([]string{entry + ".2.1.97"})
+	require.NoError(t, err)
+	assert.Equal(t, GenErr, result.Error)
+}
@@ -0,0 +1,410 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAgentHandler serves a map of variables, failing the commit of the
+// variable failCommit and the undo of failUndo.
+type testAgentHandler struct {
+	mu         sync.Mutex
+	vars       map[string]SnmpPDU
+	failCommit string
+	failUndo   string
+	commits    []string
+}
+
+func (h *testAgentHandler) Get(oid string) (SnmpPDU, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if v, ok := h.vars[oid]; ok {
+		return v, nil
+	}
+	return SnmpPDU{Name: oid, Type: NoSuchObject}, nil
+}
+
+func (h *testAgentHandler) GetNext(oid string) (SnmpPDU, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	names := make([]string, 0, len(h.vars))
+	for name := range h.vars {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return oidLess(names[i], names[j]) })
+	for _, name := range names {
+		if oidLess(oid, name) {
+			return h.vars[name], nil
+		}
+	}
+	return SnmpPDU{Name: oid, Type: EndOfMibView}, nil
+}
+
+func (h *testAgentHandler) TestSet(pdu SnmpPDU) SNMPError {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	v, ok := h.vars[pdu.Name]
+	switch {
+	case !ok:
+		return NoCreation
+	case v.Type != pdu.Type:
+		return WrongType
+	}
+	return NoError
+}
+
+func (h *testAgentHandler) CommitSet(pdu SnmpPDU) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if pdu.Name == h.failCommit {
+		return errors.New("commit failed")
+	}
+	h.commits = append(h.commits, pdu.Name)
+	h.vars[pdu.Name] = pdu
+	return nil
+}
+
+func (h *testAgentHandler) UndoSet(pdu, previous SnmpPDU) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if pdu.Name == h.failUndo {
+		return errors.New("undo failed")
+	}
+	h.vars[pdu.Name] = previous
+	return nil
+}
+
+// startAgent runs a on an ephemeral port and returns a session of version
+// querying it with community.
+func startAgent(t *testing.T, a *Agent, version SnmpVersion, community string) *GoSNMP {
+	if a.Params == nil {
+		a.Params = &GoSNMP{Community: "public", Logger: NewLogger(log.New(ioutil.Discard, "", 0))}
+	}
+	errch := make(chan error, 1)
+	go func() {
+		errch <- a.Listen("127.0.0.1:0")
+	}()
+	select {
+	case <-a.Listening():
+	case err := <-errch:
+		t.Fatalf("error in listen: %v", err)
+	}
+	t.Cleanup(a.Close)
+
+	a.mu.Lock()
+	port := a.conn.LocalAddr().(*net.UDPAddr).Port
+	a.mu.Unlock()
+	x := &GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(port),
+		Community: community,
+		Version:   version,
+		Timeout:   time.Second,
+		MaxOids:   MaxOids,
+	}
+	if version == Version3 {
+		x.SecurityModel = UserSecurityModel
+		x.SecurityParameters = &UsmSecurityParameters{UserName: community}
+	}
+	require.NoError(t, x.Connect())
+	t.Cleanup(func() { x.Conn.Close() })
+	return x
+}
+
+func testAgentVars() map[string]SnmpPDU {
+	vars := map[string]SnmpPDU{}
+	for _, v := range []SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.1.0", Type: OctetString, Value: []byte("test agent")},
+		{Name: ".1.3.6.1.2.1.1.4.0", Type: OctetString, Value: []byte("admin")},
+		{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: []byte("router")},
+		{Name: ".1.3.6.1.2.1.1.7.0", Type: Integer, Value: 72},
+		{Name: ".1.3.6.1.2.1.2.1.0", Type: Integer, Value: 2},
+	} {
+		vars[v.Name] = v
+	}
+	return vars
+}
+
+func TestAgentGet(t *testing.T) {
+	a := NewAgent()
+	a.Handler = &testAgentHandler{vars: testAgentVars()}
+	x := startAgent(t, a, Version2c, "public")
+
+	result, err := x.Get([]string{".1.3.6.1.2.1.1.5.0", ".1.3.6.1.2.1.1.6.0"})
+	require.NoError(t, err)
+	require.Len(t, result.Variables, 2)
+	assert.Equal(t, []byte("router"), result.Variables[0].Value)
+	assert.Equal(t, NoSuchObject, result.Variables[1].Type)
+
+	all, err := x.BulkWalkAll(".1.3.6.1.2.1")
+	require.NoError(t, err)
+	require.Len(t, all, 5)
+	assert.Equal(t, ".1.3.6.1.2.1.2.1.0", all[4].Name)
+
+	result, err = x.GetBulk([]string{".1.3.6.1.2.1.1.1.0", ".1.3.6.1.2.1.1.5.0"}, 1, 3)
+	require.NoError(t, err)
+	names := make([]string, len(result.Variables))
+	for i, v := range result.Variables {
+		names[i] = v.Name
+	}
+	assert.Equal(t, []string{".1.3.6.1.2.1.1.4.0", ".1.3.6.1.2.1.1.7.0", ".1.3.6.1.2.1.2.1.0", ".1.3.6.1.2.1.2.1.0"}, names)
+	assert.Equal(t, EndOfMibView, result.Variables[3].Type)
+
+	// SNMPv1 has no exceptions
+	v1 := startAgent(t, NewAgent(), Version1, "public")
+	result, err = v1.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, NoSuchName, result.Error)
+	assert.Equal(t, uint8(1), result.ErrorIndex)
+}
+
+func TestAgentGetBulkMaxMsgSize(t *testing.T) {
+	vars := map[string]SnmpPDU{}
+	for i := 1; i <= 100; i++ {
+		v := SnmpPDU{Name: ".1.3.6.1.2.1.2.2.1.2." + strconv.Itoa(i), Type: OctetString, Value: []byte("interface description")}
+		vars[v.Name] = v
+	}
+	a := NewAgent()
+	a.MaxMsgSize = 484
+	a.Handler = &testAgentHandler{vars: vars}
+	x := startAgent(t, a, Version2c, "public")
+
+	result, err := x.GetBulk([]string{".1.3.6.1.2.1.2.2.1.2"}, 0, 100)
+	require.NoError(t, err)
+	assert.NotEmpty(t, result.Variables)
+	assert.Less(t, len(result.Variables), 100)
+	out, err := result.MarshalMsg()
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(out), 484)
+}
+
+func TestAgentCommunities(t *testing.T) {
+	a := NewAgent()
+	a.WriteCommunity = "private"
+	a.Handler = &testAgentHandler{vars: testAgentVars()}
+	x := startAgent(t, a, Version2c, "wrong")
+	x.Timeout = 100 * time.Millisecond
+	_, err := x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	assert.Error(t, err, "requests with unknown communities are dropped")
+
+	x.Community = "public"
+	result, err := x.Set([]SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "core"}})
+	require.NoError(t, err)
+	assert.Equal(t, NoAccess, result.Error)
+
+	x.Community = "private"
+	result, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("router"), result.Variables[0].Value)
+}
+
+func TestAgentSet(t *testing.T) {
+	h := &testAgentHandler{vars: testAgentVars()}
+	a := NewAgent()
+	a.WriteCommunity = "private"
+	a.Handler = h
+	x := startAgent(t, a, Version2c, "private")
+
+	set := func(pdus ...SnmpPDU) *SnmpPacket {
+		t.Helper()
+		result, err := x.Set(pdus)
+		require.NoError(t, err)
+		return result
+	}
+	value := func(oid string) string {
+		v, err := h.Get(oid)
+		require.NoError(t, err)
+		return string(v.Value.([]byte))
+	}
+	sysContact := SnmpPDU{Name: ".1.3.6.1.2.1.1.4.0", Type: OctetString, Value: "noc"}
+	sysName := SnmpPDU{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "core"}
+
+	result := set(sysContact, sysName)
+	assert.Equal(t, NoError, result.Error)
+	assert.Equal(t, "noc", value(sysContact.Name))
+	assert.Equal(t, "core", value(sysName.Name))
+
+	// a failed test sets nothing
+	h.mu.Lock()
+	h.commits = nil
+	h.mu.Unlock()
+	result = set(SnmpPDU{Name: sysContact.Name, Type: OctetString, Value: "ops"}, SnmpPDU{Name: ".1.3.6.1.2.1.1.7.0", Type: OctetString, Value: "x"})
+	assert.Equal(t, WrongType, result.Error)
+	assert.Equal(t, uint8(2), result.ErrorIndex)
+	h.mu.Lock()
+	assert.Empty(t, h.commits)
+	h.failCommit = sysName.Name
+	h.mu.Unlock()
+	assert.Equal(t, "noc", value(sysContact.Name))
+
+	// a failed commit undoes the others
+	result = set(SnmpPDU{Name: sysContact.Name, Type: OctetString, Value: "ops"}, SnmpPDU{Name: sysName.Name, Type: OctetString, Value: "edge"})
+	assert.Equal(t, CommitFailed, result.Error)
+	assert.Equal(t, uint8(2), result.ErrorIndex)
+	assert.Equal(t, "noc", value(sysContact.Name))
+	assert.Equal(t, "core", value(sysName.Name))
+
+	h.mu.Lock()
+	h.failUndo = sysContact.Name
+	h.mu.Unlock()
+	result = set(SnmpPDU{Name: sysContact.Name, Type: OctetString, Value: "ops"}, SnmpPDU{Name: sysName.Name, Type: OctetString, Value: "edge"})
+	assert.Equal(t, UndoFailed, result.Error)
+	assert.Equal(t, uint8(0), result.ErrorIndex)
+
+	// SNMPv1 gets the SNMPv1 error statuses
+	x.Version = Version1
+	result = set(SnmpPDU{Name: ".1.3.6.1.2.1.1.7.0", Type: OctetString, Value: "x"})
+	assert.Equal(t, BadValue, result.Error)
+	result = set(SnmpPDU{Name: ".1.3.6.1.2.1.1.9.0", Type: Integer, Value: 1})
+	assert.Equal(t, NoSuchName, result.Error)
+}
+
+func TestAgentRand(t *testing.T) {
+	a := NewAgent()
+	a.Params = &GoSNMP{Rand: constReader(7)}
+	a.Users = NewUsmUserTable()
+	require.NoError(t, a.init())
+	assert.Equal(t, "\x80\x00\x00\x00\x05\x07\x07\x07\x07\x07\x07\x07\x07", a.Engine.EngineID())
+	salt, err := a.nextSalt()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0x0707070707070707), salt, "read from the Rand of Params")
+}
+
+func TestAgentUsm(t *testing.T) {
+	users := NewUsmUserTable()
+	require.NoError(t, users.Add(UsmUser{UserName: "reader"}))
+	require.NoError(t, users.Add(UsmUser{
+		UserName:                 "admin",
+		AuthenticationProtocol:   SHA,
+		AuthenticationPassphrase: "authpassword",
+		PrivacyProtocol:          AES,
+		PrivacyPassphrase:        "privpassword",
+	}))
+	h := &testAgentHandler{vars: testAgentVars()}
+	a := NewAgent()
+	a.Users = users
+	a.Handler = h
+	x := startAgent(t, a, Version3, "reader")
+	require.NotNil(t, a.Engine, "Listen creates an engine")
+	usm := func(user string, flags SnmpV3MsgFlags, auth, priv string) {
+		x.MsgFlags = flags | Reportable
+		x.SecurityModel = UserSecurityModel
+		x.SecurityParameters = &UsmSecurityParameters{
+			UserName:                 user,
+			AuthenticationProtocol:   SHA,
+			AuthenticationPassphrase: auth,
+			PrivacyProtocol:          AES,
+			PrivacyPassphrase:        priv,
+		}
+		if flags&AuthNoPriv == 0 {
+			x.SecurityParameters = &UsmSecurityParameters{UserName: user}
+		}
+	}
+
+	usm("admin", AuthPriv, "authpassword", "privpassword")
+	result, err := x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("router"), result.Variables[0].Value)
+	assert.Equal(t, a.Engine.EngineID(), result.ContextEngineID)
+	result, err = x.Set([]SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "core"}})
+	require.NoError(t, err)
+	assert.Equal(t, NoError, result.Error)
+	v, err := h.Get(".1.3.6.1.2.1.1.5.0")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("core"), v.Value)
+
+	// unauthenticated users only read
+	usm("reader", NoAuthNoPriv, "", "")
+	result, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("core"), result.Variables[0].Value)
+	result, err = x.Set([]SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "edge"}})
+	require.NoError(t, err)
+	assert.Equal(t, NoAccess, result.Error)
+
+	// USM errors are reported
+	usm("nobody", NoAuthNoPriv, "", "")
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	assert.ErrorIs(t, err, ErrUnknownUsername)
+	usm("admin", AuthPriv, "wrongpassword", "privpassword")
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	assert.ErrorIs(t, err, ErrWrongDigest)
+	usm("reader", AuthNoPriv, "authpassword", "")
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	assert.ErrorIs(t, err, ErrUnknownSecurityLevel)
+
+	stats := a.UsmStats()
+	assert.Equal(t, uint32(1), stats.UnknownUserNames)
+	assert.Equal(t, uint32(1), stats.WrongDigests)
+	assert.Equal(t, uint32(1), stats.UnsupportedSecLevels)
+	assert.NotZero(t, stats.UnknownEngineIDs, "discovery is reported")
+}
+
+func TestAgentUsmNotInTimeWindow(t *testing.T) {
+	users := NewUsmUserTable()
+	require.NoError(t, users.Add(UsmUser{
+		UserName:                 "admin",
+		AuthenticationProtocol:   SHA,
+		AuthenticationPassphrase: "authpassword",
+	}))
+	a := NewAgent()
+	a.Users = users
+	a.Handler = &testAgentHandler{vars: testAgentVars()}
+	x := startAgent(t, a, Version3, "reader")
+	x.MsgFlags = AuthNoPriv | Reportable
+	x.SecurityModel = UserSecurityModel
+	x.SecurityParameters = &UsmSecurityParameters{
+		UserName:                 "admin",
+		AuthoritativeEngineID:    a.Engine.EngineID(),
+		AuthoritativeEngineBoots: 7,
+		AuthenticationProtocol:   SHA,
+		AuthenticationPassphrase: "authpassword",
+	}
+
+	// the manager synchronizes with the report and retries
+	result, err := x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("router"), result.Variables[0].Value)
+	assert.Equal(t, uint32(1), a.UsmStats().NotInTimeWindows)
+}
+
+func TestPeekUsmHeader(t *testing.T) {
+	sp := &UsmSecurityParameters{
+		AuthoritativeEngineID: "\x80\x00\x00\x00\x05engine",
+		UserName:              "admin",
+		Logger:                NewLogger(nil),
+	}
+	msg, err := (&SnmpPacket{
+		Version:            Version3,
+		MsgFlags:           Reportable,
+		SecurityModel:      UserSecurityModel,
+		SecurityParameters: sp,
+		MsgID:              42,
+		PDUType:            GetRequest,
+		Variables:          []SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: Null}},
+	}).marshalMsg()
+	require.NoError(t, err)
+	h, err := peekUsmHeader(msg)
+	require.NoError(t, err)
+	assert.Equal(t, usmHeader{msgID: 42, flags: Reportable, securityModel: UserSecurityModel, engineID: sp.AuthoritativeEngineID, userName: "admin"}, h)
+
+	_, err = peekUsmHeader(msg[:20])
+	assert.Error(t, err)
+}
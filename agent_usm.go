@@ -0,0 +1,367 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// usmTimeWindow is the number of seconds the engine time of an
+// authenticated request may differ from that of the agent, RFC 3414
+// section 3.2 step 7.
+const usmTimeWindow = 150
+
+// usmStatsCounters are the usmStats counters of RFC 3414 section 5 of an
+// authoritative engine, updated atomically.
+type usmStatsCounters struct {
+	unsupportedSecLevels uint32
+	notInTimeWindows     uint32
+	unknownUserNames     uint32
+	unknownEngineIDs     uint32
+	wrongDigests         uint32
+	decryptionErrors     uint32
+}
+
+// UsmStats returns the usmStats counters of the agent, the SNMPv3 requests
+// it reported by USM error. It is safe to call while the agent runs.
+func (a *Agent) UsmStats() UsmStats {
+	return UsmStats{
+		UnsupportedSecLevels: atomic.LoadUint32(&a.usmStats.unsupportedSecLevels),
+		NotInTimeWindows:     atomic.LoadUint32(&a.usmStats.notInTimeWindows),
+		UnknownUserNames:     atomic.LoadUint32(&a.usmStats.unknownUserNames),
+		UnknownEngineIDs:     atomic.LoadUint32(&a.usmStats.unknownEngineIDs),
+		WrongDigests:         atomic.LoadUint32(&a.usmStats.wrongDigests),
+		DecryptionErrors:     atomic.LoadUint32(&a.usmStats.decryptionErrors),
+	}
+}
+
+// init completes the settings of the agent before it answers requests.
+func (a *Agent) init() error {
+	if a.Params == nil {
+		a.Params = Default
+	}
+	a.uptime()
+	if a.Users == nil || a.Engine != nil {
+		return nil
+	}
+	engineID, err := a.Params.RandomEngineID(0)
+	if err != nil {
+		return err
+	}
+	a.Engine, err = NewLocalEngine(engineID, nil)
+	return err
+}
+
+// usmHeader holds the fields of an SNMPv3 message readable without
+// credentials.
+type usmHeader struct {
+	msgID         uint32
+	flags         SnmpV3MsgFlags
+	securityModel SnmpV3SecurityModel
+	engineID      string
+	userName      string
+}
+
+// peekUsmHeader returns the header of the SNMPv3 message msg, and the
+// authoritative engine ID and user name of its USM security parameters.
+func peekUsmHeader(msg []byte) (usmHeader, error) {
+	var h usmHeader
+	var logger Logger
+	cursor := 0
+	enter := func(tag byte) error {
+		if cursor >= len(msg) || msg[cursor] != tag {
+			return errors.New("invalid SNMPv3 header")
+		}
+		_, count, err := parseLength(msg[cursor:])
+		cursor += count
+		return err
+	}
+	field := func(name string) (interface{}, error) {
+		if cursor >= len(msg) {
+			return nil, fmt.Errorf("truncated before the %s", name)
+		}
+		value, count, err := parseRawField(logger, msg[cursor:], name)
+		cursor += count
+		return value, err
+	}
+
+	if err := enter(byte(Sequence)); err != nil {
+		return h, err
+	}
+	if _, err := field("version"); err != nil {
+		return h, err
+	}
+	if err := enter(byte(Sequence)); err != nil {
+		return h, err
+	}
+	raw, err := field("msgID")
+	if err != nil {
+		return h, err
+	}
+	msgID, _ := raw.(int)
+	h.msgID = uint32(msgID)
+	if _, err = field("msgMaxSize"); err != nil {
+		return h, err
+	}
+	if raw, err = field("msgFlags"); err != nil {
+		return h, err
+	}
+	if flags, _ := raw.(string); len(flags) == 1 {
+		h.flags = SnmpV3MsgFlags(flags[0])
+	}
+	if raw, err = field("msgSecurityModel"); err != nil {
+		return h, err
+	}
+	model, _ := raw.(int)
+	h.securityModel = SnmpV3SecurityModel(model)
+	if h.securityModel != UserSecurityModel {
+		return h, nil
+	}
+
+	if err = enter(byte(OctetString)); err != nil {
+		return h, err
+	}
+	if err = enter(byte(Sequence)); err != nil {
+		return h, err
+	}
+	if raw, err = field("msgAuthoritativeEngineID"); err != nil {
+		return h, err
+	}
+	h.engineID, _ = raw.(string)
+	for _, name := range []string{"msgAuthoritativeEngineBoots", "msgAuthoritativeEngineTime"} {
+		if _, err = field(name); err != nil {
+			return h, err
+		}
+	}
+	if raw, err = field("msgUserName"); err != nil {
+		return h, err
+	}
+	h.userName, _ = raw.(string)
+	return h, nil
+}
+
+// answerV3 returns the encoded response to the SNMPv3 request msg, or the
+// Report of the USM error of the request, as per RFC 3414 section 3.2.
+func (a *Agent) answerV3(msg []byte) ([]byte, error) {
+	if a.Users == nil || a.Engine == nil {
+		return nil, errors.New("SNMPv3 requests require Users")
+	}
+	h, err := peekUsmHeader(msg)
+	if err != nil {
+		return nil, err
+	}
+	if h.securityModel != UserSecurityModel {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownSecurityModels, h.securityModel)
+	}
+	if h.flags.SecurityLevel() == 0 {
+		// dropped, RFC 3412 section 7.2 step 5
+		return nil, ErrInvalidMsgFlags
+	}
+	engineID := a.Engine.EngineID()
+	if h.engineID != engineID {
+		// discovery, RFC 3414 section 4
+		return a.usmReport(msg, h, usmStatsUnknownEngineIDs, &a.usmStats.unknownEngineIDs, false)
+	}
+	user, ok := a.Users.Lookup(engineID, h.userName)
+	if !ok {
+		return a.usmReport(msg, h, usmStatsUnknownUserNames, &a.usmStats.unknownUserNames, false)
+	}
+	if h.flags&AuthNoPriv != 0 && user.AuthenticationProtocol <= NoAuth ||
+		h.flags&AuthPriv == AuthPriv && user.PrivacyProtocol <= NoPriv {
+		return a.usmReport(msg, h, usmStatsUnsupportedSecLevels, &a.usmStats.unsupportedSecLevels, false)
+	}
+
+	x := &GoSNMP{
+		Version:              Version3,
+		SecurityModel:        UserSecurityModel,
+		UsmUsers:             a.Users,
+		StrictAuthentication: true,
+		Logger:               a.Params.Logger,
+	}
+	req := new(SnmpPacket)
+	cursor, err := x.unmarshalHeader(msg, req)
+	if err != nil {
+		return nil, err
+	}
+	if err = x.testAuthentication(msg, req, true); err != nil {
+		return a.usmReport(msg, h, usmStatsWrongDigests, &a.usmStats.wrongDigests, false)
+	}
+	if h.flags&AuthNoPriv != 0 {
+		sp, ok := req.SecurityParameters.(*UsmSecurityParameters)
+		if !ok {
+			return nil, errors.New("no USM security parameters")
+		}
+		boots, engineTime, err := a.Engine.Clock()
+		if err != nil {
+			return nil, err
+		}
+		sp.mu.Lock()
+		reqBoots, reqTime := sp.AuthoritativeEngineBoots, int64(sp.AuthoritativeEngineTime)
+		sp.mu.Unlock()
+		if boots == maxEngineBoots || reqBoots != boots ||
+			reqTime < int64(engineTime)-usmTimeWindow || reqTime > int64(engineTime)+usmTimeWindow {
+			return a.usmReport(msg, h, usmStatsNotInTimeWindows, &a.usmStats.notInTimeWindows, true)
+		}
+	}
+	plain, cursor, err := x.decryptPacket(msg, cursor, req)
+	if err != nil {
+		return a.usmReport(msg, h, usmStatsDecryptionErrors, &a.usmStats.decryptionErrors, false)
+	}
+	if err = x.unmarshalPayload(plain, cursor, req); err != nil {
+		return nil, err
+	}
+	if target, ok := a.proxyTarget(req); ok {
+		resp, err := a.forward(req, target)
+		if err != nil {
+			return nil, err
+		}
+		return a.marshalResponse(req, resp)
+	}
+	if req.ContextEngineID != "" && req.ContextEngineID != engineID {
+		return nil, fmt.Errorf("unknown context engine ID %x", req.ContextEngineID)
+	}
+
+	var resp *SnmpPacket
+	if access, err := a.userAccess(h.userName, h.flags); err != nil {
+		a.Params.Logger.Printf("Agent: user %q refused: %s\n", h.userName, err)
+		resp, err = req.ErrorResponse(AuthorizationError, 0)
+		if err != nil {
+			return nil, err
+		}
+	} else if resp, err = a.respond(req, access); err != nil {
+		return nil, err
+	}
+	resp.ContextEngineID = engineID
+	return a.marshalResponse(req, resp)
+}
+
+// userAccess returns the access of the SNMPv3 requests of userName with
+// flags.
+func (a *Agent) userAccess(userName string, flags SnmpV3MsgFlags) (agentAccess, error) {
+	if a.VACM == nil {
+		return agentAccess{canWrite: flags&AuthNoPriv != 0}, nil
+	}
+	access, err := a.VACM.accessOf(vacmPrincipal{user: true, name: userName}, flags)
+	if err != nil {
+		return agentAccess{}, err
+	}
+	return agentAccess{vacm: a.VACM, read: access.ReadView, write: access.WriteView}, nil
+}
+
+// secure sets the clock of the engine of the agent, and a new salt if
+// encrypted, in the security parameters of the SNMPv3 response resp.
+func (a *Agent) secure(resp *SnmpPacket) error {
+	sp, ok := resp.SecurityParameters.(*UsmSecurityParameters)
+	if !ok {
+		return errors.New("no USM security parameters")
+	}
+	boots, engineTime, err := a.Engine.Clock()
+	if err != nil {
+		return err
+	}
+	sp.mu.Lock()
+	sp.AuthoritativeEngineID = a.Engine.EngineID()
+	sp.AuthoritativeEngineBoots = boots
+	sp.AuthoritativeEngineTime = engineTime
+	sp.mu.Unlock()
+	if resp.MsgFlags&AuthPriv != AuthPriv {
+		return nil
+	}
+	salt, err := a.nextSalt()
+	if err != nil {
+		return err
+	}
+	if sp.PrivacyProtocol == DES {
+		return sp.usmSetSalt(uint32(salt))
+	}
+	return sp.usmSetSalt(salt)
+}
+
+// nextSalt returns a salt never used by the agent for encrypting, counting
+// from a value read from the Rand of its Params.
+func (a *Agent) nextSalt() (uint64, error) {
+	for {
+		salt := atomic.LoadUint64(&a.salt)
+		next := salt + 1
+		if salt == 0 {
+			var b [8]byte
+			if _, err := io.ReadFull(a.Params.randReader(), b[:]); err != nil {
+				return 0, fmt.Errorf("error creating a cryptographically secure salt: %w", err)
+			}
+			next = binary.BigEndian.Uint64(b[:]) | 1
+		}
+		if atomic.CompareAndSwapUint64(&a.salt, salt, next) {
+			return next, nil
+		}
+	}
+}
+
+// usmReport counts the USM error of the request msg in counter and returns
+// the Report of it, unauthenticated unless auth is set, if the request is
+// reportable.
+func (a *Agent) usmReport(msg []byte, h usmHeader, oid string, counter *uint32, auth bool) ([]byte, error) {
+	n := atomic.AddUint32(counter, 1)
+	if h.flags&Reportable == 0 {
+		return nil, fmt.Errorf("%s without the reportable flag", oid)
+	}
+	boots, engineTime, err := a.Engine.Clock()
+	if err != nil {
+		return nil, err
+	}
+	sp := &UsmSecurityParameters{
+		AuthoritativeEngineID:    a.Engine.EngineID(),
+		AuthoritativeEngineBoots: boots,
+		AuthoritativeEngineTime:  engineTime,
+		UserName:                 h.userName,
+		Logger:                   a.Params.Logger,
+	}
+	flags := NoAuthNoPriv
+	if auth {
+		user, keys, err := a.Users.localized(sp.AuthoritativeEngineID, h.userName)
+		if err != nil {
+			return nil, err
+		}
+		flags = AuthNoPriv
+		sp.AuthenticationProtocol = user.AuthenticationProtocol
+		sp.AuthenticationPassphrase = user.AuthenticationPassphrase
+		sp.SecretKey = keys.auth
+	}
+	report := &SnmpPacket{
+		Version:            Version3,
+		MsgFlags:           flags,
+		SecurityModel:      UserSecurityModel,
+		SecurityParameters: sp,
+		MsgID:              h.msgID,
+		ContextEngineID:    sp.AuthoritativeEngineID,
+		PDUType:            Report,
+		RequestID:          plainRequestID(msg, h),
+		Variables:          []SnmpPDU{{Name: oid, Type: Counter32, Value: uint(n)}},
+		Logger:             a.Params.Logger,
+	}
+	return report.marshalMsg()
+}
+
+// plainRequestID returns the request ID of the unauthenticated SNMPv3
+// request msg, or 0 if it cannot be read without credentials.
+func plainRequestID(msg []byte, h usmHeader) uint32 {
+	if h.flags&AuthNoPriv != 0 {
+		return 0
+	}
+	x := &GoSNMP{Version: Version3, SecurityModel: UserSecurityModel}
+	req := new(SnmpPacket)
+	cursor, err := x.unmarshalHeader(msg, req)
+	if err != nil {
+		return 0
+	}
+	plain, cursor, err := x.decryptPacket(msg, cursor, req)
+	if err != nil || x.unmarshalPayload(plain, cursor, req) != nil {
+		return 0
+	}
+	return req.RequestID
+}
@@ -0,0 +1,227 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gosnmp/gosnmp/oids"
+)
+
+// AgentRequestHook is implemented by AgentHandlers that need to know where
+// requests begin, e.g. to serve all the variables of a request from one
+// snapshot. The Agent calls BeginRequest before reading or setting the
+// variables of each request, and an AgentMux calls that of its handlers.
+type AgentRequestHook interface {
+	BeginRequest()
+}
+
+// AgentVariables is an AgentHandler serving static values, scalars read
+// from callbacks and tables read from providers, e.g. to expose the gauges
+// of an application:
+//
+//	vars := gosnmp.NewAgentVariables()
+//	err := vars.Static(gosnmp.SnmpPDU{Name: oids.SysName, Type: gosnmp.OctetString, Value: "app1"})
+//	err = vars.Scalar(".1.3.6.1.4.1.99999.1.1.0", gosnmp.Gauge32, 0, func() (interface{}, error) {
+//		return uint(queue.Len()), nil
+//	})
+//	err = agent.Register(".1.3.6.1.4.1.99999", vars)
+//
+// Callbacks and providers run when a request reads them, at most once per
+// request, and their values are kept for their time to live: the
+// variables of a request, e.g. the rows of a table returned by a
+// GetBulkRequest, are a consistent snapshot, and values are cached across
+// requests with a positive time to live.
+type AgentVariables struct {
+	mu      sync.Mutex
+	entries []*agentVariable // sorted by name
+}
+
+type agentVariable struct {
+	name string
+
+	// a static value, a scalar callback or a table provider
+	static   *SnmpPDU
+	typ      Asn1BER
+	scalar   func() (interface{}, error)
+	table    func() ([]SnmpPDU, error)
+	ttl      time.Duration
+	cached   []SnmpPDU // sorted
+	cachedAt time.Time
+	valid    bool
+}
+
+// NewAgentVariables returns AgentVariables without variables.
+func NewAgentVariables() *AgentVariables {
+	return &AgentVariables{}
+}
+
+// Static serves pdu, replacing the value of a static variable of the same
+// name.
+func (v *AgentVariables) Static(pdu SnmpPDU) error {
+	pdu.Name = dottedOID(pdu.Name)
+	return v.add(&agentVariable{name: pdu.Name, static: &pdu}, true)
+}
+
+// Scalar serves the variable oid of type t with the value returned by fn,
+// read again once older than ttl, or for every request if ttl is 0.
+func (v *AgentVariables) Scalar(oid string, t Asn1BER, ttl time.Duration, fn func() (interface{}, error)) error {
+	if fn == nil {
+		return fmt.Errorf("no callback for %s", oid)
+	}
+	return v.add(&agentVariable{name: dottedOID(oid), typ: t, scalar: fn, ttl: ttl}, false)
+}
+
+// Table serves the variables below root returned by fn, e.g. the columns
+// of a table, read again once older than ttl, or for every request if ttl
+// is 0. Variables outside root are ignored.
+func (v *AgentVariables) Table(root string, ttl time.Duration, fn func() ([]SnmpPDU, error)) error {
+	if fn == nil {
+		return fmt.Errorf("no provider for %s", root)
+	}
+	return v.add(&agentVariable{name: dottedOID(root), table: fn, ttl: ttl}, false)
+}
+
+// Remove stops serving the variable or table name, reporting whether it
+// was served.
+func (v *AgentVariables) Remove(name string) bool {
+	name = dottedOID(name)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for i, e := range v.entries {
+		if e.name == name {
+			v.entries = append(v.entries[:i], v.entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (v *AgentVariables) add(e *agentVariable, replaceStatic bool) error {
+	if _, err := marshalObjectIdentifier(e.name); err != nil {
+		return fmt.Errorf("invalid OID %q: %w", e.name, err)
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	i := sort.Search(len(v.entries), func(i int) bool { return !oidLess(v.entries[i].name, e.name) })
+	if i < len(v.entries) && v.entries[i].name == e.name {
+		if replaceStatic && v.entries[i].static != nil {
+			v.entries[i] = e
+			return nil
+		}
+		return fmt.Errorf("%s is already served", e.name)
+	}
+	for _, other := range v.entries {
+		if (other.table != nil && oids.Under(e.name, other.name)) || (e.table != nil && oids.Under(other.name, e.name)) {
+			return fmt.Errorf("%s overlaps the table %s", e.name, other.name)
+		}
+	}
+	v.entries = append(v.entries, nil)
+	copy(v.entries[i+1:], v.entries[i:])
+	v.entries[i] = e
+	return nil
+}
+
+// BeginRequest expires the values read for earlier requests that are older
+// than their time to live.
+func (v *AgentVariables) BeginRequest() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := time.Now()
+	for _, e := range v.entries {
+		if e.valid && now.Sub(e.cachedAt) >= e.ttl {
+			e.valid = false
+			e.cached = nil
+		}
+	}
+}
+
+// values returns the sorted variables of e, reading them if needed. The
+// caller holds v.mu.
+func (e *agentVariable) values() ([]SnmpPDU, error) {
+	if e.static != nil {
+		return []SnmpPDU{*e.static}, nil
+	}
+	if e.valid {
+		return e.cached, nil
+	}
+	var vars []SnmpPDU
+	if e.scalar != nil {
+		value, err := e.scalar()
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", e.name, err)
+		}
+		vars = []SnmpPDU{{Name: e.name, Type: e.typ, Value: value}}
+	} else {
+		all, err := e.table()
+		if err != nil {
+			return nil, fmt.Errorf("error reading table %s: %w", e.name, err)
+		}
+		for _, pdu := range all {
+			pdu.Name = dottedOID(pdu.Name)
+			if oids.Under(pdu.Name, e.name) && pdu.Name != e.name {
+				vars = append(vars, pdu)
+			}
+		}
+		sort.Slice(vars, func(i, j int) bool { return oidLess(vars[i].Name, vars[j].Name) })
+	}
+	e.cached, e.cachedAt, e.valid = vars, time.Now(), true
+	return vars, nil
+}
+
+// Get returns the variable oid.
+func (v *AgentVariables) Get(oid string) (SnmpPDU, error) {
+	oid = dottedOID(oid)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, e := range v.entries {
+		if e.name != oid && (e.table == nil || !oids.Under(oid, e.name)) {
+			continue
+		}
+		vars, err := e.values()
+		if err != nil {
+			return SnmpPDU{}, err
+		}
+		i := sort.Search(len(vars), func(i int) bool { return !oidLess(vars[i].Name, oid) })
+		if i < len(vars) && vars[i].Name == oid {
+			return vars[i], nil
+		}
+		return SnmpPDU{Name: oid, Type: NoSuchInstance}, nil
+	}
+	return SnmpPDU{Name: oid, Type: NoSuchObject}, nil
+}
+
+// GetNext returns the first variable after oid.
+func (v *AgentVariables) GetNext(oid string) (SnmpPDU, error) {
+	oid = dottedOID(oid)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, e := range v.entries {
+		if !oidLess(oid, e.name) && (e.table == nil || !oids.Under(oid, e.name)) {
+			continue
+		}
+		vars, err := e.values()
+		if err != nil {
+			return SnmpPDU{}, err
+		}
+		i := sort.Search(len(vars), func(i int) bool { return oidLess(oid, vars[i].Name) })
+		if i < len(vars) {
+			return vars[i], nil
+		}
+	}
+	return SnmpPDU{Name: oid, Type: EndOfMibView}, nil
+}
+
+// dottedOID returns oid with a leading dot.
+func dottedOID(oid string) string {
+	if strings.HasPrefix(oid, ".") {
+		return oid
+	}
+	return "." + oid
+}
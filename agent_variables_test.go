@@ -0,0 +1,99 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentVariables(t *testing.T) {
+	var depthReads, tableReads, uptimeReads int32
+	vars := NewAgentVariables()
+	require.NoError(t, vars.Static(SnmpPDU{Name: "1.3.6.1.4.1.99999.1.0", Type: OctetString, Value: "app1"}))
+	require.NoError(t, vars.Scalar(".1.3.6.1.4.1.99999.2.0", Gauge32, 0, func() (interface{}, error) {
+		return uint(atomic.AddInt32(&depthReads, 1)), nil
+	}))
+	require.NoError(t, vars.Scalar(".1.3.6.1.4.1.99999.3.0", TimeTicks, time.Hour, func() (interface{}, error) {
+		atomic.AddInt32(&uptimeReads, 1)
+		return uint32(4200), nil
+	}))
+	require.NoError(t, vars.Table(".1.3.6.1.4.1.99999.4", 0, func() ([]SnmpPDU, error) {
+		atomic.AddInt32(&tableReads, 1)
+		return []SnmpPDU{
+			{Name: ".1.3.6.1.4.1.99999.4.1.2.2", Type: OctetString, Value: "b"},
+			{Name: ".1.3.6.1.4.1.99999.4.1.2.1", Type: OctetString, Value: "a"},
+			{Name: ".1.3.6.1.4.1.99999.4.1.3.1", Type: Counter32, Value: uint(10)},
+			{Name: ".1.3.6.1.4.1.99999.4.1.3.2", Type: Counter32, Value: uint(20)},
+			{Name: ".1.3.6.1.4.1.99999.5.0", Type: Integer, Value: 1}, // outside the table
+		}, nil
+	}))
+
+	none := func() ([]SnmpPDU, error) { return nil, nil }
+	require.Error(t, vars.Scalar(".1.3.6.1.4.1.99999.2.0", Gauge32, 0, func() (interface{}, error) { return nil, nil }), "already served")
+	require.Error(t, vars.Scalar(".1.3.6.1.4.1.99999.7.0", Gauge32, 0, nil))
+	require.Error(t, vars.Static(SnmpPDU{Name: ".1.3.6.1.4.1.99999.4.1.2.3", Type: Integer, Value: 1}), "inside a table")
+	require.Error(t, vars.Table(".1.3.6.1.4.1.99999", 0, none), "covering other variables")
+	require.NoError(t, vars.Static(SnmpPDU{Name: ".1.3.6.1.4.1.99999.1.0", Type: OctetString, Value: "app2"}))
+
+	a := NewAgent()
+	require.NoError(t, a.Register(".1.3.6.1.4.1.99999", vars))
+	x := startAgent(t, a, Version2c, "public")
+
+	all, err := x.BulkWalkAll(".1.3.6.1.4.1.99999.1")
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, []byte("app2"), all[0].Value)
+
+	// the walk read ahead into the other variables
+	atomic.StoreInt32(&depthReads, 0)
+	atomic.StoreInt32(&tableReads, 0)
+	result, err := x.GetBulk([]string{".1.3.6.1.4.1.99999.2.0", ".1.3.6.1.4.1.99999.4"}, 1, 10)
+	require.NoError(t, err)
+	var names []string
+	for _, v := range result.Variables {
+		names = append(names, v.Name)
+	}
+	assert.Equal(t, []string{
+		".1.3.6.1.4.1.99999.3.0",
+		".1.3.6.1.4.1.99999.4.1.2.1", ".1.3.6.1.4.1.99999.4.1.2.2",
+		".1.3.6.1.4.1.99999.4.1.3.1", ".1.3.6.1.4.1.99999.4.1.3.2",
+	}, names[:5])
+	assert.Equal(t, int32(1), atomic.LoadInt32(&tableReads), "one read of the table per request")
+
+	for i := 0; i < 2; i++ {
+		result, err = x.Get([]string{".1.3.6.1.4.1.99999.2.0", ".1.3.6.1.4.1.99999.2.0", ".1.3.6.1.4.1.99999.3.0"})
+		require.NoError(t, err)
+		assert.Equal(t, result.Variables[0].Value, result.Variables[1].Value, "a snapshot per request")
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&depthReads), "once per request")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&uptimeReads), "cached for its time to live")
+
+	result, err = x.Get([]string{".1.3.6.1.4.1.99999.4.1.2.9", ".1.3.6.1.4.1.99999.9.0"})
+	require.NoError(t, err)
+	assert.Equal(t, NoSuchInstance, result.Variables[0].Type)
+	assert.Equal(t, NoSuchObject, result.Variables[1].Type)
+
+	require.NoError(t, vars.Table(".1.3.6.1.4.1.99999.6", 0, func() ([]SnmpPDU, error) {
+		return nil, errors.New("backend down")
+	}))
+	result, err = x.Get([]string{".1.3.6.1.4.1.99999.6.1.0"})
+	require.NoError(t, err)
+	assert.Equal(t, GenErr, result.Error)
+
+	assert.True(t, vars.Remove(".1.3.6.1.4.1.99999.6"))
+	assert.False(t, vars.Remove(".1.3.6.1.4.1.99999.6"))
+	result, err = x.GetNext([]string{".1.3.6.1.4.1.99999.4.1.3.2"})
+	require.NoError(t, err)
+	assert.Equal(t, EndOfMibView, result.Variables[0].Type)
+}
@@ -0,0 +1,550 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrAsyncMode is returned by the synchronous requests of a session once it
+// made asynchronous requests, whose dispatcher reads the connection.
+var ErrAsyncMode = errors.New("session is in asynchronous mode")
+
+// AsyncCallback receives the result of an asynchronous request, or the
+// error it failed with, as a synchronous request would return them. It is
+// called on the goroutine reading the responses of the session, or of the
+// timer of the request, and should not block.
+type AsyncCallback func(result *SnmpPacket, err error)
+
+// GetAsync sends an SNMP GET request without waiting for its response:
+// callback is called once with the response, or the error of the request
+// after its retries. An error is returned, and callback not called, if the
+// request could not be sent.
+//
+// The first asynchronous request of a session, after the SNMPv3 engine
+// discovery, starts a goroutine reading the responses of all the requests
+// in flight, so that a poller needs no goroutine per outstanding request.
+// From then on the connection belongs to it: the synchronous requests of
+// the session and its views fail with ErrAsyncMode until the connection is
+// closed, which fails the requests in flight and ends asynchronous mode.
+//
+// SNMPv3 requests are stamped with the engine boots and time at which they
+// are sent, estimated from the latest response. Should the agent report
+// them out of its time window, e.g. after a reboot, the estimate is
+// resynchronized once and the requests in flight replayed, each at most
+// once, rather than failed.
+//
+// BeforeSend, StrictBER, AccessErrors, WireLog and SessionStats apply as to
+// synchronous requests. AfterReceive is called with a nil request, as
+// responses are matched to their requests only once decoded.
+func (x *GoSNMP) GetAsync(oids []string, callback AsyncCallback) error {
+	return x.sendAsync(GetRequest, oids, 0, 0, callback)
+}
+
+// GetNextAsync sends an SNMP GETNEXT request without waiting for its
+// response, see GetAsync.
+func (x *GoSNMP) GetNextAsync(oids []string, callback AsyncCallback) error {
+	return x.sendAsync(GetNextRequest, oids, 0, 0, callback)
+}
+
+// GetBulkAsync sends an SNMP GETBULK request without waiting for its
+// response, see GetAsync.
+func (x *GoSNMP) GetBulkAsync(oids []string, nonRepeaters uint8, maxRepetitions uint32, callback AsyncCallback) error {
+	if x.Version == Version1 {
+		return fmt.Errorf("GETBULK not supported in SNMPv1")
+	}
+	return x.sendAsync(GetBulkRequest, oids, nonRepeaters, maxRepetitions, callback)
+}
+
+func (x *GoSNMP) sendAsync(pduType PDUType, oids []string, nonRepeaters uint8, maxRepetitions uint32, callback AsyncCallback) error {
+	if callback == nil {
+		return errors.New("asynchronous requests require a callback")
+	}
+	if len(oids) > x.MaxOids {
+		return fmt.Errorf("oid count (%d) is greater than MaxOids (%d)", len(oids), x.MaxOids)
+	}
+	d, err := x.asyncDispatcher()
+	if err != nil {
+		return err
+	}
+	pdus := make([]SnmpPDU, 0, len(oids))
+	for _, oid := range oids {
+		pdus = append(pdus, SnmpPDU{Name: oid, Type: Null})
+	}
+	return d.send(x, x.mkSnmpPacket(pduType, pdus, nonRepeaters, maxRepetitions), callback)
+}
+
+// asyncSlot holds the dispatcher of a session and its views, see GetAsync.
+type asyncSlot struct {
+	// mu serializes starting and stopping the dispatcher
+	mu sync.Mutex
+	// d is the *dispatcher reading the connection, nil if none
+	d atomic.Value
+}
+
+// load returns the dispatcher of the slot, or nil.
+func (a *asyncSlot) load() *dispatcher {
+	d, _ := a.d.Load().(*dispatcher)
+	return d
+}
+
+// asyncSlot returns the slot of the dispatcher shared by the session and its
+// views, creating it on first use.
+func (x *GoSNMP) asyncSlot() *asyncSlot {
+	s := x.shared()
+	viewLockMu.Lock()
+	defer viewLockMu.Unlock()
+	if s.async == nil {
+		s.async = &asyncSlot{}
+	}
+	return s.async
+}
+
+// asyncDispatcher returns the dispatcher of the session, starting it on
+// first use.
+func (x *GoSNMP) asyncDispatcher() (*dispatcher, error) {
+	slot := x.asyncSlot()
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+	if d := slot.load(); d != nil {
+		return d, nil
+	}
+	s := x.shared()
+	if s.Conn == nil {
+		return nil, fmt.Errorf("&GoSNMP.Conn is missing. Provide a connection or use Connect()")
+	}
+	if x.Version == Version3 {
+		if x.SecurityParameters == nil {
+			return nil, errors.New("SNMPV3 SecurityParameters must be set to send")
+		}
+		// discover the engine while the session is still synchronous
+		unlock := x.lockConn(x.requestOpts)
+		err := x.negotiateInitialSecurityParameters(x.mkSnmpPacket(GetRequest, nil, 0, 0))
+		unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := s.Conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	d := &dispatcher{x: s, slot: slot, pending: make(map[uint32]*asyncRequest)}
+	if sp, ok := x.SecurityParameters.(*UsmSecurityParameters); ok {
+		sp.mu.Lock()
+		d.clock = engineClock{boots: sp.AuthoritativeEngineBoots, time: sp.AuthoritativeEngineTime, received: time.Now()}
+		sp.mu.Unlock()
+	}
+	slot.d.Store(d)
+	go d.read()
+	return d, nil
+}
+
+// isAsync reports whether the session or one of its views made
+// asynchronous requests.
+func (x *GoSNMP) isAsync() bool {
+	slot := x.shared().async
+	return slot != nil && slot.load() != nil
+}
+
+// dispatcher correlates the responses read from the connection of a session
+// with the asynchronous requests in flight of the session and its views.
+type dispatcher struct {
+	// x is the session whose connection is read
+	x    *GoSNMP
+	slot *asyncSlot
+
+	mu sync.Mutex
+	// pending are the requests in flight by message ID for SNMPv3, as
+	// Reports need not carry the request ID, by request ID otherwise
+	pending map[uint32]*asyncRequest
+	// err is the error the reader stopped with
+	err error
+	// clock is the clock of the SNMPv3 engine of the agent, advanced to
+	// stamp each request with the engine time it is sent at
+	clock engineClock
+	// epoch counts the resynchronizations of clock with the Reports of the
+	// agent
+	epoch int
+
+	// writeLock serializes the encoding and writing of requests, queued by
+	// the priority of their call, see WithPriority
+	writeLock priorityLock
+}
+
+// asyncRequest is an asynchronous request in flight, forgotten once it is
+// answered or its last retry timed out.
+type asyncRequest struct {
+	// x is the session or view sending the request
+	x        *GoSNMP
+	packet   *SnmpPacket
+	msg      []byte
+	attempt  int
+	retries  int
+	timeout  time.Duration
+	timer    *time.Timer
+	trace    RequestTrace
+	callback AsyncCallback
+
+	// epoch is the epoch of the clock the request was stamped with
+	epoch int
+	// replayed is set once the request was replayed after a
+	// usmStatsNotInTimeWindows Report
+	replayed bool
+
+	// wire retains the messages of the request for the WireLog of x
+	wire *WireOperation
+}
+
+// key returns the key of packet in pending.
+func (d *dispatcher) key(packet *SnmpPacket) uint32 {
+	if d.x.Version == Version3 {
+		return packet.MsgID
+	}
+	return packet.RequestID
+}
+
+// send encodes packetOut, a request of x, and writes it, the response going
+// to callback.
+func (d *dispatcher) send(x *GoSNMP, packetOut *SnmpPacket, callback AsyncCallback) error {
+	d.writeLock.lock(x.priority(packetOut.opts))
+	defer d.writeLock.unlock()
+
+	req := &asyncRequest{x: x, packet: packetOut, retries: x.retries(packetOut.opts), timeout: x.timeout(packetOut.opts), callback: callback}
+	if x.WireLog != nil {
+		req.wire = x.newWireOperation(packetOut)
+	}
+	if err := d.prepare(req); err != nil {
+		return err
+	}
+	return d.start(req)
+}
+
+// prepare encodes the request req with new IDs and, for SNMPv3, the engine
+// boots and time at present. It is called with writeLock held.
+func (d *dispatcher) prepare(req *asyncRequest) error {
+	x := req.x
+	packet := req.packet
+	packet.RequestID = atomic.AddUint32(&x.requestID, 1) & 0x7FFFFFFF
+	if x.Version == Version3 {
+		packet.MsgID = atomic.AddUint32(&x.msgID, 1) & 0x7FFFFFFF
+		d.stamp(req)
+		if err := x.initPacket(packet); err != nil {
+			return err
+		}
+	}
+	msg, err := packet.marshalMsg()
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	if err = x.checkMsgMaxSize(msg); err != nil {
+		return err
+	}
+	if x.BeforeSend != nil {
+		msg = x.BeforeSend(packet, msg)
+	}
+	req.msg = msg
+	return nil
+}
+
+// stamp sets the engine boots and time of the USM security parameters of
+// req to those of the clock, advanced by the time elapsed since it was
+// received: a session pipelining requests for longer than the time window
+// would otherwise send stale times.
+func (d *dispatcher) stamp(req *asyncRequest) {
+	sp, ok := req.packet.SecurityParameters.(*UsmSecurityParameters)
+	if !ok {
+		return
+	}
+	d.mu.Lock()
+	clock, epoch := d.clock, d.epoch
+	d.mu.Unlock()
+	if clock.received.IsZero() {
+		return
+	}
+	engineTime := int64(clock.time) + int64(time.Since(clock.received)/time.Second)
+	if engineTime > maxEngineTime {
+		engineTime = maxEngineTime
+	}
+	sp.mu.Lock()
+	sp.AuthoritativeEngineBoots = clock.boots
+	sp.AuthoritativeEngineTime = uint32(engineTime)
+	sp.mu.Unlock()
+	req.epoch = epoch
+}
+
+// start registers the prepared request req as in flight and writes it. It is
+// called with writeLock held.
+func (d *dispatcher) start(req *asyncRequest) error {
+	key := d.key(req.packet)
+	d.mu.Lock()
+	if d.err != nil {
+		d.mu.Unlock()
+		return d.err
+	}
+	d.pending[key] = req
+	req.trace.sent(req.attempt, req.packet.RequestID, time.Now().Add(req.timeout))
+	req.timer = time.AfterFunc(req.timeout, func() { d.expire(key) })
+	d.mu.Unlock()
+
+	if err := d.write(req.msg); err != nil {
+		d.mu.Lock()
+		delete(d.pending, key)
+		req.timer.Stop()
+		d.mu.Unlock()
+		return wrapSocketError("write", err)
+	}
+	d.recordWire(req, CaptureSent, req.msg)
+	return nil
+}
+
+func (d *dispatcher) write(msg []byte) error {
+	s := d.x.shared()
+	if uconn, ok := s.Conn.(net.PacketConn); ok && s.uaddr != nil {
+		_, err := uconn.WriteTo(msg, s.uaddr)
+		return err
+	}
+	_, err := s.Conn.Write(msg)
+	return err
+}
+
+// expire retransmits the request of key whose attempt timed out, or fails
+// it after the last retry.
+func (d *dispatcher) expire(key uint32) {
+	d.mu.Lock()
+	req, ok := d.pending[key]
+	if !ok {
+		d.mu.Unlock()
+		return
+	}
+	x := req.x
+	reqID := req.packet.RequestID
+	req.trace.record(req.attempt, AttemptTimeout, reqID, errors.New("timeout"))
+	if req.attempt >= req.retries {
+		delete(d.pending, key)
+		d.mu.Unlock()
+		x.expired(1)
+		d.finish(req, nil, &RequestError{
+			Err:   fmt.Errorf("request timeout (after %d retries)", req.attempt),
+			Trace: req.trace,
+		})
+		return
+	}
+	req.attempt++
+	if x.exponentialTimeout(req.packet.opts) {
+		req.timeout *= 2
+	}
+	req.trace.sent(req.attempt, reqID, time.Now().Add(req.timeout))
+	req.timer = time.AfterFunc(req.timeout, func() { d.expire(key) })
+	d.mu.Unlock()
+
+	d.writeLock.lock(x.priority(req.packet.opts))
+	err := d.write(req.msg)
+	d.writeLock.unlock()
+	if err != nil {
+		x.Logger.Printf("ERROR retransmitting request %d: %s", reqID, err)
+		return
+	}
+	d.recordWire(req, CaptureSent, req.msg)
+}
+
+// recordWire retains msg in the WireOperation of req, if any.
+func (d *dispatcher) recordWire(req *asyncRequest, direction CaptureDirection, msg []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if req.wire != nil {
+		req.wire.record(direction, msg)
+	}
+}
+
+// finish counts req in the SessionStats of its session, retains it in its
+// WireLog and calls its callback with result and err.
+func (d *dispatcher) finish(req *asyncRequest, result *SnmpPacket, err error) {
+	d.mu.Lock()
+	op := req.wire
+	req.wire = nil
+	trace := req.trace
+	d.mu.Unlock()
+	req.x.SessionStats.record(trace, result, err)
+	if op != nil {
+		req.x.endWireOperation(op, err)
+	}
+	req.callback(result, err)
+}
+
+// read delivers the responses of the connection to their requests until
+// the connection fails.
+func (d *dispatcher) read() {
+	x := d.x
+	for {
+		raw, err := x.receive()
+		if err != nil {
+			d.stop(wrapSocketError("read", err))
+			d.slot.mu.Lock()
+			if d.slot.load() == d {
+				d.slot.d.Store((*dispatcher)(nil))
+			}
+			d.slot.mu.Unlock()
+			return
+		}
+		msg := raw
+		if x.AfterReceive != nil {
+			msg = x.AfterReceive(nil, msg)
+		}
+		result, err := d.decode(msg)
+		if err != nil {
+			x.Logger.Printf("ERROR on asynchronous response: %s", err)
+			continue
+		}
+		key := d.key(result)
+		d.mu.Lock()
+		req, ok := d.pending[key]
+		d.mu.Unlock()
+		if !ok {
+			x.Logger.Printf("ERROR out of order: unexpected request ID %d", result.RequestID)
+			continue
+		}
+		d.recordWire(req, CaptureReceived, raw)
+		if result.Version == Version3 {
+			if err = req.x.checkDowngrade(req.packet, result); err != nil {
+				// the request is retransmitted or times out, as when
+				// synchronous
+				x.Logger.Printf("ERROR on v3 response: %s", err)
+				d.mu.Lock()
+				req.trace.record(req.attempt, AttemptDecodeError, req.packet.RequestID, err)
+				d.mu.Unlock()
+				continue
+			}
+		}
+		d.mu.Lock()
+		ok = d.pending[key] == req
+		if ok {
+			delete(d.pending, key)
+			req.timer.Stop()
+		}
+		d.mu.Unlock()
+		if !ok {
+			// timed out meanwhile
+			continue
+		}
+		if result.Version == Version3 {
+			if reportOID(result) == usmStatsNotInTimeWindows && d.resync(req, result) {
+				continue
+			}
+			if result.PDUType == Report {
+				d.finish(req, result, newReportError(result))
+				continue
+			}
+			d.advance(result)
+		}
+		if req.x.AccessErrors {
+			err = req.x.accessError(req.packet, result)
+		}
+		d.finish(req, result, err)
+	}
+}
+
+// resync handles the usmStatsNotInTimeWindow Report of the request req, as
+// when a pipelining session outlived the time window or the agent rebooted.
+// The first such Report resynchronizes the clock with the boots and time it
+// carries, once, and replays all the requests in flight stamped with the
+// stale clock, whose own Reports are then dropped as out of order. It
+// returns false, the Report failing req, if req was replayed already.
+func (d *dispatcher) resync(req *asyncRequest, report *SnmpPacket) bool {
+	if req.replayed {
+		return false
+	}
+	sp, ok := report.SecurityParameters.(*UsmSecurityParameters)
+	if !ok {
+		return false
+	}
+	sp.mu.Lock()
+	clock := engineClock{boots: sp.AuthoritativeEngineBoots, time: sp.AuthoritativeEngineTime, received: time.Now()}
+	sp.mu.Unlock()
+
+	stale := []*asyncRequest{req}
+	d.mu.Lock()
+	if req.epoch == d.epoch {
+		d.x.Logger.Print("WARNING detected out-of-time-window ERROR, resynchronizing")
+		d.clock = clock
+		d.epoch++
+		for key, other := range d.pending {
+			if other.epoch < d.epoch {
+				delete(d.pending, key)
+				other.timer.Stop()
+				stale = append(stale, other)
+			}
+		}
+	}
+	d.mu.Unlock()
+	if err := d.x.SecurityParameters.setSecurityParameters(sp); err != nil {
+		d.x.Logger.Printf("ERROR storing security parameters: %s", err)
+	}
+
+	d.writeLock.lock(req.x.priority(req.packet.opts))
+	defer d.writeLock.unlock()
+	for _, r := range stale {
+		r.replayed = true
+		err := d.prepare(r)
+		if err == nil {
+			err = d.start(r)
+		}
+		if err != nil {
+			d.finish(r, nil, &RequestError{Err: err, Trace: r.trace})
+		}
+	}
+	return true
+}
+
+// advance advances the clock to the boots and time of the authenticated
+// response result, if they are ahead of it.
+func (d *dispatcher) advance(result *SnmpPacket) {
+	sp, ok := result.SecurityParameters.(*UsmSecurityParameters)
+	if !ok || result.MsgFlags&AuthNoPriv == 0 {
+		return
+	}
+	sp.mu.Lock()
+	boots, engineTime := sp.AuthoritativeEngineBoots, sp.AuthoritativeEngineTime
+	sp.mu.Unlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	estimated := int64(d.clock.time) + int64(now.Sub(d.clock.received)/time.Second)
+	if boots > d.clock.boots || boots == d.clock.boots && int64(engineTime) > estimated {
+		d.clock = engineClock{boots: boots, time: engineTime, received: now}
+	}
+}
+
+// decode decodes and, for SNMPv3, authenticates and decrypts the message
+// msg, see decodeResponse.
+func (d *dispatcher) decode(msg []byte) (*SnmpPacket, error) {
+	x := d.x
+	result := &SnmpPacket{Logger: x.Logger, MsgFlags: x.msgFlags()}
+	if x.SecurityParameters != nil {
+		result.SecurityParameters = x.SecurityParameters.Copy()
+	}
+	if err := x.decodeResponse(msg, result, &x.Logger); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// stop fails the requests in flight, and those sent later, with err.
+func (d *dispatcher) stop(err error) {
+	d.mu.Lock()
+	d.err = err
+	pending := d.pending
+	d.pending = make(map[uint32]*asyncRequest)
+	d.mu.Unlock()
+	for _, req := range pending {
+		req.timer.Stop()
+		d.finish(req, nil, &RequestError{Err: err, Trace: req.trace})
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAsync(t *testing.T) {
+	a := NewAgent()
+	a.Handler = &testAgentHandler{vars: testAgentVars()}
+	x := startAgent(t, a, Version2c, "public")
+
+	oids := []string{".1.3.6.1.2.1.1.1.0", ".1.3.6.1.2.1.1.4.0", ".1.3.6.1.2.1.1.5.0"}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	got := map[string]interface{}{}
+	for i := 0; i < 30; i++ {
+		oid := oids[i%len(oids)]
+		wg.Add(1)
+		require.NoError(t, x.GetAsync([]string{oid}, func(result *SnmpPacket, err error) {
+			defer wg.Done()
+			if assert.NoError(t, err) {
+				mu.Lock()
+				got[result.Variables[0].Name] = result.Variables[0].Value
+				mu.Unlock()
+			}
+		}))
+	}
+	wg.Add(1)
+	require.NoError(t, x.GetNextAsync([]string{".1.3.6.1.2.1.1.5.0"}, func(result *SnmpPacket, err error) {
+		defer wg.Done()
+		if assert.NoError(t, err) {
+			assert.Equal(t, ".1.3.6.1.2.1.1.7.0", result.Variables[0].Name)
+		}
+	}))
+	wg.Wait()
+	assert.Equal(t, []byte("router"), got[".1.3.6.1.2.1.1.5.0"])
+	assert.Len(t, got, 3)
+
+	// the connection belongs to the dispatcher
+	_, err := x.Get(oids)
+	assert.ErrorIs(t, err, ErrAsyncMode)
+
+	// closing the connection ends asynchronous mode
+	require.NoError(t, x.Conn.Close())
+	require.Eventually(t, func() bool { return !x.isAsync() }, time.Second, 10*time.Millisecond)
+	require.NoError(t, x.Connect())
+	_, err = x.Get(oids)
+	assert.NoError(t, err)
+}
+
+func TestGetAsyncV3(t *testing.T) {
+	users := NewUsmUserTable()
+	require.NoError(t, users.Add(UsmUser{
+		UserName:                 "admin",
+		AuthenticationProtocol:   SHA,
+		AuthenticationPassphrase: "authpassword",
+		PrivacyProtocol:          AES,
+		PrivacyPassphrase:        "privpassword",
+	}))
+	a := NewAgent()
+	a.Users = users
+	a.Handler = &testAgentHandler{vars: testAgentVars()}
+	x := startAgent(t, a, Version3, "admin")
+	x.MsgFlags = AuthPriv | Reportable
+	x.SecurityParameters = &UsmSecurityParameters{
+		UserName:                 "admin",
+		AuthenticationProtocol:   SHA,
+		AuthenticationPassphrase: "authpassword",
+		PrivacyProtocol:          AES,
+		PrivacyPassphrase:        "privpassword",
+	}
+
+	done := make(chan *SnmpPacket, 1)
+	require.NoError(t, x.GetBulkAsync([]string{".1.3.6.1.2.1.1"}, 0, 2, func(result *SnmpPacket, err error) {
+		assert.NoError(t, err)
+		done <- result
+	}))
+	select {
+	case result := <-done:
+		require.Len(t, result.Variables, 2)
+		assert.Equal(t, []byte("test agent"), result.Variables[0].Value)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no response")
+	}
+}
+
+func TestGetAsyncTimeout(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	stats := NewSessionStatsCollector()
+	x := &GoSNMP{
+		Target:       "127.0.0.1",
+		Port:         uint16(conn.LocalAddr().(*net.UDPAddr).Port),
+		Community:    "public",
+		Version:      Version2c,
+		Timeout:      50 * time.Millisecond,
+		Retries:      1,
+		MaxOids:      MaxOids,
+		Logger:       NewLogger(log.New(ioutil.Discard, "", 0)),
+		SessionStats: stats,
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	errch := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, x.GetAsync([]string{".1.3.6.1.2.1.1.5.0"}, func(_ *SnmpPacket, err error) {
+			errch <- err
+		}))
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errch:
+			var reqErr *RequestError
+			require.True(t, errors.As(err, &reqErr))
+			assert.Contains(t, err.Error(), "after 1 retries")
+			assert.Len(t, reqErr.Trace, 4, "two attempts timed out")
+		case <-time.After(2 * time.Second):
+			t.Fatal("request did not time out")
+		}
+	}
+	assert.Equal(t, uint64(2), stats.Snapshot().ExpiredCorrelations, "both requests are forgotten")
+
+	// requests in flight fail with the connection
+	x.Timeout = time.Minute
+	require.NoError(t, x.GetAsync([]string{".1.3.6.1.2.1.1.5.0"}, func(_ *SnmpPacket, err error) {
+		errch <- err
+	}))
+	require.NoError(t, x.Conn.Close())
+	select {
+	case err := <-errch:
+		assert.Error(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("request did not fail")
+	}
+}
+
+func TestGetAsyncPriority(t *testing.T) {
+	a := NewAgent()
+	a.Handler = &testAgentHandler{vars: testAgentVars()}
+	x := startAgent(t, a, Version2c, "public")
+
+	done := make(chan error, 1)
+	require.NoError(t, x.GetAsync([]string{".1.3.6.1.2.1.1.5.0"}, func(_ *SnmpPacket, err error) {
+		done <- err
+	}))
+	require.NoError(t, <-done)
+	ui := x.WithOptions(WithPriority(PriorityInteractive))
+	bulk := x.WithOptions(WithPriority(PriorityBackground))
+
+	// requests get their IDs once their turn to be written comes
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	ids := map[string][]uint32{}
+	queue := func(name string, view *GoSNMP) {
+		l := &x.async.load().writeLock
+		l.mu.Lock()
+		queued := len(l.waiting)
+		l.mu.Unlock()
+		wg.Add(1)
+		go func() {
+			assert.NoError(t, view.GetAsync([]string{".1.3.6.1.2.1.1.5.0"}, func(result *SnmpPacket, err error) {
+				defer wg.Done()
+				if assert.NoError(t, err) {
+					mu.Lock()
+					ids[name] = append(ids[name], result.RequestID)
+					mu.Unlock()
+				}
+			}))
+		}()
+		require.Eventually(t, func() bool {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			return len(l.waiting) == queued+1
+		}, time.Second, time.Millisecond)
+	}
+
+	x.async.load().writeLock.lock(PriorityNormal)
+	for i := 0; i < 3; i++ {
+		queue("bulk", bulk)
+	}
+	queue("ui", ui)
+	x.async.load().writeLock.unlock()
+	wg.Wait()
+
+	require.Len(t, ids["ui"], 1)
+	require.Len(t, ids["bulk"], 3)
+	for _, id := range ids["bulk"] {
+		assert.Less(t, ids["ui"][0], id, "the interactive request overtook the queued background ones")
+	}
+}
+
+func TestGetAsyncV3Pipelining(t *testing.T) {
+	users := NewUsmUserTable()
+	require.NoError(t, users.Add(UsmUser{
+		UserName:                 "admin",
+		AuthenticationProtocol:   SHA,
+		AuthenticationPassphrase: "authpassword",
+		PrivacyProtocol:          AES,
+		PrivacyPassphrase:        "privpassword",
+	}))
+	a := NewAgent()
+	a.Users = users
+	a.Handler = &testAgentHandler{vars: testAgentVars()}
+	x := startAgent(t, a, Version3, "admin")
+	x.MsgFlags = AuthPriv | Reportable
+	x.SecurityParameters = &UsmSecurityParameters{
+		UserName:                 "admin",
+		AuthenticationProtocol:   SHA,
+		AuthenticationPassphrase: "authpassword",
+		PrivacyProtocol:          AES,
+		PrivacyPassphrase:        "privpassword",
+	}
+
+	getAll := func(n int) {
+		t.Helper()
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			require.NoError(t, x.GetAsync([]string{".1.3.6.1.2.1.1.5.0"}, func(result *SnmpPacket, err error) {
+				defer wg.Done()
+				if assert.NoError(t, err) {
+					assert.Equal(t, []byte("router"), result.Variables[0].Value)
+				}
+			}))
+		}
+		wg.Wait()
+	}
+	getAll(1)
+	d := x.async.load()
+
+	// requests are stamped with the engine time they are sent at, well
+	// past the time window of the clock learned
+	d.mu.Lock()
+	d.clock.received = d.clock.received.Add(-200 * time.Second)
+	d.mu.Unlock()
+	a.Engine.mu.Lock()
+	a.Engine.start = a.Engine.start.Add(-200 * time.Second)
+	a.Engine.mu.Unlock()
+	getAll(5)
+	assert.Zero(t, a.UsmStats().NotInTimeWindows)
+
+	// after a reboot of the agent, the clock is resynchronized once and
+	// each request replayed once
+	a.Engine.mu.Lock()
+	a.Engine.boots++
+	a.Engine.start = time.Now()
+	a.Engine.mu.Unlock()
+	getAll(10)
+	assert.Equal(t, uint32(10), a.UsmStats().NotInTimeWindows)
+	d.mu.Lock()
+	assert.Equal(t, 1, d.epoch)
+	d.mu.Unlock()
+}
+
+func TestGetAsyncView(t *testing.T) {
+	a := NewAgent()
+	a.Handler = &testAgentHandler{vars: testAgentVars()}
+	x := startAgent(t, a, Version2c, "public")
+	view := x.WithOptions(WithTimeout(time.Second))
+
+	done := make(chan error, 1)
+	require.NoError(t, x.GetAsync([]string{".1.3.6.1.2.1.1.5.0"}, func(_ *SnmpPacket, err error) {
+		done <- err
+	}))
+	require.NoError(t, <-done)
+
+	// the view made before shares the dispatcher reading the connection
+	_, err := view.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	assert.ErrorIs(t, err, ErrAsyncMode)
+	require.NoError(t, view.GetAsync([]string{".1.3.6.1.2.1.1.5.0"}, func(_ *SnmpPacket, err error) {
+		done <- err
+	}))
+	require.NoError(t, <-done)
+	assert.Same(t, x.async.load(), view.shared().async.load())
+}
+
+func TestGetAsyncHooks(t *testing.T) {
+	a := NewAgent()
+	a.Handler = &testAgentHandler{vars: testAgentVars()}
+	x := startAgent(t, a, Version2c, "public")
+	stats := NewSessionStatsCollector()
+	x.SessionStats = stats
+	x.WireLog = NewWireLog(4)
+	x.StrictBER = true
+	var mu sync.Mutex
+	var sent, received int
+	x.BeforeSend = func(_ *SnmpPacket, msg []byte) []byte {
+		mu.Lock()
+		sent++
+		mu.Unlock()
+		return msg
+	}
+	x.AfterReceive = func(request *SnmpPacket, msg []byte) []byte {
+		assert.Nil(t, request)
+		mu.Lock()
+		received++
+		mu.Unlock()
+		return msg
+	}
+
+	done := make(chan error, 1)
+	require.NoError(t, x.GetAsync([]string{".1.3.6.1.2.1.1.5.0"}, func(_ *SnmpPacket, err error) {
+		done <- err
+	}))
+	require.NoError(t, <-done)
+
+	mu.Lock()
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, 1, received)
+	mu.Unlock()
+	assert.Equal(t, uint64(1), stats.Snapshot().Requests)
+	ops := x.WireLog.Operations()
+	require.Len(t, ops, 1)
+	assert.Equal(t, GetRequest, ops[0].PDUType)
+	require.Len(t, ops[0].Messages, 2)
+	assert.Equal(t, CaptureSent, ops[0].Messages[0].Direction)
+	assert.Equal(t, CaptureReceived, ops[0].Messages[1].Direction)
+}
@@ -0,0 +1,229 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrBERViolation is wrapped by the *BERViolation errors of ValidateBER.
+var ErrBERViolation = errors.New("non-canonical BER encoding")
+
+// BERRule identifies the encoding rule broken by a message, see
+// ValidateBER.
+type BERRule int
+
+const (
+	// BERTruncated is a TLV running past the end of its enclosing
+	// encoding.
+	BERTruncated BERRule = iota + 1
+
+	// BERTrailingData is data after the end of the message.
+	BERTrailingData
+
+	// BERHighTagNumber is a tag using the multi-octet form, which SNMP
+	// never needs.
+	BERHighTagNumber
+
+	// BERIndefiniteLength is a length in the indefinite form.
+	BERIndefiniteLength
+
+	// BERNonMinimalLength is a length in the long form that fits the short
+	// form, or with leading zero octets.
+	BERNonMinimalLength
+
+	// BERConstructedPrimitive is a universal type other than SEQUENCE in
+	// the constructed form, e.g. a segmented OCTET STRING.
+	BERConstructedPrimitive
+
+	// BEREmptyInteger is an integer type without content octets.
+	BEREmptyInteger
+
+	// BERNonMinimalInteger is an integer with a redundant leading 0x00 or
+	// 0xff octet.
+	BERNonMinimalInteger
+
+	// BEREmptyOID is an OBJECT IDENTIFIER without content octets.
+	BEREmptyOID
+
+	// BERNonMinimalSubidentifier is an OID sub-identifier with a leading
+	// 0x80 octet.
+	BERNonMinimalSubidentifier
+
+	// BERTruncatedSubidentifier is an OID whose last octet has the
+	// continuation bit set.
+	BERTruncatedSubidentifier
+
+	// BERInvalidLength is a content length not allowed for the type, e.g.
+	// a NULL with content or an IpAddress of 5 octets.
+	BERInvalidLength
+)
+
+func (r BERRule) String() string {
+	switch r {
+	case BERTruncated:
+		return "truncated"
+	case BERTrailingData:
+		return "trailing data"
+	case BERHighTagNumber:
+		return "high tag number"
+	case BERIndefiniteLength:
+		return "indefinite length"
+	case BERNonMinimalLength:
+		return "non-minimal length"
+	case BERConstructedPrimitive:
+		return "constructed primitive type"
+	case BEREmptyInteger:
+		return "empty integer"
+	case BERNonMinimalInteger:
+		return "non-minimal integer"
+	case BEREmptyOID:
+		return "empty OID"
+	case BERNonMinimalSubidentifier:
+		return "non-minimal sub-identifier"
+	case BERTruncatedSubidentifier:
+		return "truncated sub-identifier"
+	case BERInvalidLength:
+		return "invalid length for type"
+	}
+	return "BERRule(" + strconv.Itoa(int(r)) + ")"
+}
+
+// BERViolation is returned by ValidateBER, and for received messages when
+// GoSNMP.StrictBER is set. It wraps ErrBERViolation.
+type BERViolation struct {
+	Rule BERRule
+
+	// Offset is the offset in the message of the TLV breaking the rule.
+	Offset int
+
+	// Tag is the tag of that TLV.
+	Tag Asn1BER
+}
+
+func (e *BERViolation) Error() string {
+	return fmt.Sprintf("%s: %s in tag 0x%02x at offset %d", ErrBERViolation, e.Rule, byte(e.Tag), e.Offset)
+}
+
+func (e *BERViolation) Unwrap() error {
+	return ErrBERViolation
+}
+
+// ValidateBER checks that msg is a single TLV encoded with the minimal
+// lengths and integers DER requires, as most agents send them.
+// The decoder accepts laxer encodings; rejecting them helps spotting crafted
+// or anomalous SNMP traffic. The encrypted ScopedPDU of an authPriv message
+// is checked as an OCTET STRING only.
+func ValidateBER(msg []byte) error {
+	end, err := validateTLV(msg, 0)
+	if err != nil {
+		return err
+	}
+	if end != len(msg) {
+		return &BERViolation{Rule: BERTrailingData, Offset: end, Tag: Asn1BER(msg[end])}
+	}
+	return nil
+}
+
+// validateTLV checks the TLV at offset off of data, which ends where the
+// enclosing encoding does, and returns the offset following it.
+func validateTLV(data []byte, off int) (int, error) {
+	var tag byte
+	if off < len(data) {
+		tag = data[off]
+	}
+	fail := func(rule BERRule) (int, error) {
+		return 0, &BERViolation{Rule: rule, Offset: off, Tag: Asn1BER(tag)}
+	}
+	if off+2 > len(data) {
+		return fail(BERTruncated)
+	}
+	if tag&0x1f == 0x1f {
+		return fail(BERHighTagNumber)
+	}
+
+	length, start := int(data[off+1]), off+2
+	if length == 0x80 {
+		return fail(BERIndefiniteLength)
+	}
+	if length > 0x80 {
+		n := length & 0x7f
+		if n > 4 || start+n > len(data) {
+			return fail(BERTruncated)
+		}
+		if data[start] == 0 {
+			return fail(BERNonMinimalLength)
+		}
+		length = 0
+		for _, b := range data[start : start+n] {
+			length = length<<8 | int(b)
+		}
+		if length < 0x80 {
+			return fail(BERNonMinimalLength)
+		}
+		start += n
+	}
+	end := start + length
+	if end > len(data) || end < start {
+		return fail(BERTruncated)
+	}
+	content := data[start:end]
+
+	if tag&0x20 != 0 {
+		if tag&0xc0 == 0 && tag != byte(Sequence) {
+			return fail(BERConstructedPrimitive)
+		}
+		for next := start; next < end; {
+			var err error
+			if next, err = validateTLV(data[:end], next); err != nil {
+				return 0, err
+			}
+		}
+		return end, nil
+	}
+
+	switch Asn1BER(tag) {
+	case Integer, Counter32, Gauge32, TimeTicks, Counter64, Uinteger32:
+		if len(content) == 0 {
+			return fail(BEREmptyInteger)
+		}
+		if len(content) > 1 && content[0] == 0x00 && content[1]&0x80 == 0 {
+			return fail(BERNonMinimalInteger)
+		}
+		// the unsigned types are often sent without the leading zero octet
+		// of values above 2^31-1, only INTEGER is signed
+		if len(content) > 1 && Asn1BER(tag) == Integer && content[0] == 0xff && content[1]&0x80 != 0 {
+			return fail(BERNonMinimalInteger)
+		}
+	case ObjectIdentifier:
+		if len(content) == 0 {
+			return fail(BEREmptyOID)
+		}
+		for i, b := range content {
+			if b == 0x80 && (i == 0 || content[i-1]&0x80 == 0) {
+				return fail(BERNonMinimalSubidentifier)
+			}
+		}
+		if content[len(content)-1]&0x80 != 0 {
+			return fail(BERTruncatedSubidentifier)
+		}
+	case Null, NoSuchObject, NoSuchInstance, EndOfMibView:
+		if len(content) != 0 {
+			return fail(BERInvalidLength)
+		}
+	case Boolean:
+		if len(content) != 1 {
+			return fail(BERInvalidLength)
+		}
+	case IPAddress:
+		// RFC 2578: IpAddress is an OCTET STRING of size 4, IPv6 has none
+		if len(content) != 4 {
+			return fail(BERInvalidLength)
+		}
+	}
+	return end, nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || marshal
+// +build all marshal
+
+package gosnmp
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateBERAcceptsMarshaled(t *testing.T) {
+	packets := []*SnmpPacket{
+		{
+			Version:   Version2c,
+			Community: "public",
+			PDUType:   GetResponse,
+			RequestID: 0x7fffffff,
+			Variables: []SnmpPDU{
+				{Name: ".1.3.6.1.2.1.1.1.0", Type: OctetString, Value: []byte("router")},
+				{Name: ".1.3.6.1.2.1.1.2.0", Type: ObjectIdentifier, Value: ".1.3.6.1.4.1.2021.250.10"},
+				{Name: ".1.3.6.1.2.1.1.3.0", Type: TimeTicks, Value: uint32(0x80)},
+				{Name: ".1.3.6.1.2.1.2.2.1.10.1", Type: Counter32, Value: uint(0xffffffff)},
+				{Name: ".1.3.6.1.2.1.31.1.1.1.6.1", Type: Counter64, Value: uint64(1) << 63},
+				{Name: ".1.3.6.1.2.1.4.20.1.1.10.0.0.1", Type: IPAddress, Value: "10.0.0.1"},
+				{Name: ".1.3.6.1.4.1.9.1", Type: Integer, Value: 128},
+				{Name: ".1.3.6.1.4.1.9.2", Type: Integer, Value: 0},
+				{Name: ".1.3.6.1.4.1.9.5", Type: Integer, Value: -1},
+				{Name: ".1.3.6.1.4.1.9.6", Type: Integer, Value: -129},
+				{Name: ".1.3.6.1.4.1.9.3", Type: Null},
+				{Name: ".1.3.6.1.4.1.9.4", Type: NoSuchObject},
+			},
+		},
+		{
+			Version:   Version1,
+			Community: "public",
+			PDUType:   Trap,
+			SnmpTrap: SnmpTrap{
+				Enterprise:   ".1.3.6.1.4.1.9",
+				AgentAddress: "192.0.2.1",
+				GenericTrap:  6,
+				SpecificTrap: 300,
+				Timestamp:    1 << 24,
+			},
+		},
+	}
+	for _, p := range packets {
+		out, err := p.marshalMsg()
+		require.NoError(t, err)
+		assert.NoError(t, ValidateBER(out))
+	}
+}
+
+func TestValidateBERViolations(t *testing.T) {
+	public := []byte{0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c'}
+	// response wraps the value of sysUpTime.0 in a GetResponse
+	response := func(value ...byte) []byte {
+		vb := append([]byte{0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x03, 0x00}, value...)
+		vb = append([]byte{0x30, byte(len(vb))}, vb...)
+		vbl := append([]byte{0x30, byte(len(vb))}, vb...)
+		pdu := append([]byte{0x02, 0x01, 0x01, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00}, vbl...)
+		return v2cMessage(public, append([]byte{0xa2, byte(len(pdu))}, pdu...), nil)
+	}
+	require.NoError(t, ValidateBER(response(0x43, 0x01, 0x05)))
+
+	tests := []struct {
+		name   string
+		msg    []byte
+		rule   BERRule
+		offset int
+		tag    Asn1BER
+	}{
+		{"empty", nil, BERTruncated, 0, 0},
+		{"trailing", v2cMessage(public, []byte{0xa2, 0x00}, []byte{0x00}), BERTrailingData, 15, 0},
+		{"truncated", response(0x43, 0x05, 0x05), BERTruncated, 38, TimeTicks},
+		{"high tag", response(0x5f, 0x01, 0x05), BERHighTagNumber, 38, 0x5f},
+		{"indefinite", response(0x43, 0x80, 0x05, 0x00, 0x00), BERIndefiniteLength, 38, TimeTicks},
+		{"long form", response(0x43, 0x81, 0x01, 0x05), BERNonMinimalLength, 38, TimeTicks},
+		{"length zeros", response(0x04, 0x82, 0x00, 0x01, 'a'), BERNonMinimalLength, 38, OctetString},
+		{"constructed string", response(0x24, 0x03, 0x04, 0x01, 'a'), BERConstructedPrimitive, 38, 0x24},
+		{"empty integer", response(0x02, 0x00), BEREmptyInteger, 38, Integer},
+		{"leading zero", response(0x43, 0x02, 0x00, 0x05), BERNonMinimalInteger, 38, TimeTicks},
+		{"leading ones", response(0x02, 0x02, 0xff, 0xfb), BERNonMinimalInteger, 38, Integer},
+		{"empty oid", response(0x06, 0x00), BEREmptyOID, 38, ObjectIdentifier},
+		{"oid padding", response(0x06, 0x03, 0x2b, 0x80, 0x01), BERNonMinimalSubidentifier, 38, ObjectIdentifier},
+		{"oid truncated", response(0x06, 0x02, 0x2b, 0x81), BERTruncatedSubidentifier, 38, ObjectIdentifier},
+		{"null content", response(0x05, 0x01, 0x00), BERInvalidLength, 38, Null},
+		{"ip length", response(0x40, 0x05, 10, 0, 0, 0, 1), BERInvalidLength, 38, IPAddress},
+		{"ipv6 address", response(append([]byte{0x40, 0x10}, net.ParseIP("2001:db8::1")...)...), BERInvalidLength, 38, IPAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateBER(tt.msg)
+			var v *BERViolation
+			require.True(t, errors.As(err, &v), "%v", err)
+			assert.True(t, errors.Is(err, ErrBERViolation))
+			assert.Equal(t, tt.rule, v.Rule, v.Rule.String())
+			assert.Equal(t, tt.offset, v.Offset)
+			assert.Equal(t, tt.tag, v.Tag)
+		})
+	}
+}
+
+func TestStrictBERResponses(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	// a GetResponse with request ID 0 answers any request, its value has a
+	// redundant leading zero octet
+	public := []byte{0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c'}
+	pdu := []byte{0xa2, 0x1b, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00,
+		0x30, 0x10, 0x30, 0x0e, 0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x03, 0x00,
+		0x43, 0x02, 0x00, 0x05}
+	reply := v2cMessage(public, pdu, nil)
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			_, addr, err := srvr.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if _, err := srvr.WriteTo(append([]byte(nil), reply...), addr); err != nil {
+				return
+			}
+		}
+	}()
+
+	x := &GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Version:   Version2c,
+		Community: "public",
+		Timeout:   100 * time.Millisecond,
+		MaxOids:   MaxOids,
+		Logger:    NewLogger(nil),
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	result, err := x.Get([]string{".1.3.6.1.2.1.1.3.0"})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(5), result.Variables[0].Value)
+
+	x.StrictBER = true
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.3.0"})
+	var v *BERViolation
+	require.True(t, errors.As(err, &v), "%v", err)
+	assert.Equal(t, BERNonMinimalInteger, v.Rule)
+	assert.Equal(t, 38, v.Offset)
+}
@@ -0,0 +1,214 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// Capture files store raw SNMP messages for later replay, e.g. through
+// SnmpDecodePacket in regression suites. All integers are big endian.
+//
+//	file   = magic[8] version[2] flags[2] extLen[4] ext[extLen] record*
+//	record = recLen[4] metaLen[2] meta[metaLen] payload[recLen-2-metaLen]
+//	meta   = unixNano[8] direction[1] addrLen[1] addr[addrLen] ...
+//
+// Newer writers may append fields to ext and meta, and set flags in the
+// compatible range, without breaking older readers: readers skip what they
+// do not understand. A flag in the incompatible range (the high byte) marks
+// a change older readers cannot handle, and they refuse the file.
+const (
+	captureMagic      = "GOSNMPCP"
+	captureMetaMinLen = 10
+	captureMaxRecord  = 1 << 24
+)
+
+// CaptureVersion is the capture format version written by this package.
+const CaptureVersion uint16 = 1
+
+// CaptureFlagsIncompatible is the range of capture flags an older reader must
+// understand to decode the file.
+const CaptureFlagsIncompatible uint16 = 0xff00
+
+// capture format errors
+var (
+	ErrCaptureBadMagic     = errors.New("not a gosnmp capture file")
+	ErrCaptureUnsupported  = errors.New("unsupported capture file features")
+	ErrCaptureRecordTooBig = errors.New("capture record too large")
+)
+
+// CaptureDirection tells whether a captured message was sent or received.
+type CaptureDirection uint8
+
+// Capture directions.
+const (
+	CaptureReceived CaptureDirection = 0
+	CaptureSent     CaptureDirection = 1
+)
+
+// CaptureRecord is one captured SNMP message.
+type CaptureRecord struct {
+	Time      time.Time
+	Direction CaptureDirection
+
+	// Addr is the remote address, in "host:port" form.
+	Addr string
+
+	// Data is the raw BER encoded message.
+	Data []byte
+}
+
+// CaptureWriter writes capture files.
+type CaptureWriter struct {
+	w io.Writer
+}
+
+// NewCaptureWriter writes a capture file header to w and returns a writer
+// for the records.
+func NewCaptureWriter(w io.Writer) (*CaptureWriter, error) {
+	hdr := make([]byte, 0, 16)
+	hdr = append(hdr, captureMagic...)
+	hdr = appendUint16(hdr, CaptureVersion)
+	hdr = appendUint16(hdr, 0)
+	hdr = appendUint32(hdr, 0)
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return &CaptureWriter{w: w}, nil
+}
+
+// Write appends rec to the capture file.
+func (c *CaptureWriter) Write(rec CaptureRecord) error {
+	if len(rec.Addr) > 255 {
+		return fmt.Errorf("capture address %q is too long", rec.Addr)
+	}
+	metaLen := captureMetaMinLen + len(rec.Addr)
+	recLen := 2 + metaLen + len(rec.Data)
+	if recLen > captureMaxRecord {
+		return ErrCaptureRecordTooBig
+	}
+
+	buf := make([]byte, 0, 4+recLen)
+	buf = appendUint32(buf, uint32(recLen))
+	buf = appendUint16(buf, uint16(metaLen))
+	buf = appendUint64(buf, uint64(rec.Time.UnixNano()))
+	buf = append(buf, byte(rec.Direction), byte(len(rec.Addr)))
+	buf = append(buf, rec.Addr...)
+	buf = append(buf, rec.Data...)
+	_, err := c.w.Write(buf)
+	return err
+}
+
+// CaptureReader reads capture files written by any version of this package
+// that does not use incompatible features.
+type CaptureReader struct {
+	r       *bufio.Reader
+	version uint16
+	flags   uint16
+}
+
+// NewCaptureReader reads and checks the capture file header from r.
+func NewCaptureReader(r io.Reader) (*CaptureReader, error) {
+	c := &CaptureReader{r: bufio.NewReader(r)}
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(c.r, hdr); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrCaptureBadMagic
+		}
+		return nil, err
+	}
+	if string(hdr[:8]) != captureMagic {
+		return nil, ErrCaptureBadMagic
+	}
+	c.version = binary.BigEndian.Uint16(hdr[8:])
+	c.flags = binary.BigEndian.Uint16(hdr[10:])
+	if c.version == 0 {
+		return nil, fmt.Errorf("%w: version 0", ErrCaptureUnsupported)
+	}
+	if c.flags&CaptureFlagsIncompatible != 0 {
+		return nil, fmt.Errorf("%w: version %d flags %#04x", ErrCaptureUnsupported, c.version, c.flags)
+	}
+	extLen := binary.BigEndian.Uint32(hdr[12:])
+	if extLen > captureMaxRecord {
+		return nil, ErrCaptureRecordTooBig
+	}
+	if _, err := io.CopyN(ioutil.Discard, c.r, int64(extLen)); err != nil {
+		return nil, fmt.Errorf("capture header: %w", noEOF(err))
+	}
+	return c, nil
+}
+
+// Version returns the format version of the capture file.
+func (c *CaptureReader) Version() uint16 {
+	return c.version
+}
+
+// Flags returns the flags of the capture file.
+func (c *CaptureReader) Flags() uint16 {
+	return c.flags
+}
+
+// Next returns the next record, or io.EOF at the end of the file.
+func (c *CaptureReader) Next() (CaptureRecord, error) {
+	var rec CaptureRecord
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(c.r, lenBuf[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return rec, fmt.Errorf("capture record: %w", err)
+		}
+		return rec, err
+	}
+	recLen := binary.BigEndian.Uint32(lenBuf[:])
+	if recLen > captureMaxRecord {
+		return rec, ErrCaptureRecordTooBig
+	}
+	buf := make([]byte, recLen)
+	if _, err := io.ReadFull(c.r, buf); err != nil {
+		return rec, fmt.Errorf("capture record: %w", noEOF(err))
+	}
+	if len(buf) < 2 {
+		return rec, errors.New("capture record: truncated")
+	}
+	metaLen := int(binary.BigEndian.Uint16(buf))
+	if metaLen < captureMetaMinLen || 2+metaLen > len(buf) {
+		return rec, fmt.Errorf("capture record: invalid metadata length %d", metaLen)
+	}
+	meta := buf[2 : 2+metaLen]
+	rec.Time = time.Unix(0, int64(binary.BigEndian.Uint64(meta)))
+	rec.Direction = CaptureDirection(meta[8])
+	addrLen := int(meta[9])
+	if captureMetaMinLen+addrLen > len(meta) {
+		return rec, fmt.Errorf("capture record: invalid address length %d", addrLen)
+	}
+	rec.Addr = string(meta[captureMetaMinLen : captureMetaMinLen+addrLen])
+	// any further metadata was added by a newer version and is skipped
+	rec.Data = buf[2+metaLen:]
+	return rec, nil
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v>>32)), uint32(v))
+}
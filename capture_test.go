@@ -0,0 +1,123 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || marshal
+// +build all marshal
+
+package gosnmp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureV1 is a version 1 capture file holding a GetBulk request. It must
+// stay readable by every later version of the format.
+const captureV1 = "474f534e4d504350000100000000000000000046001716345785d8a00000010d3132372e302e302e313a313631" +
+	"302b02010104067075626c6963a51e02047d8968da02010002010a3010300e060a2b0601020101090103340500"
+
+func TestCaptureRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewCaptureWriter(&buf)
+	require.NoError(t, err)
+
+	records := []CaptureRecord{
+		{Time: time.Unix(1600000000, 0), Direction: CaptureSent, Addr: "127.0.0.1:161", Data: ciscoGetbulkRequestBytes()},
+		{Time: time.Unix(1600000000, 5000), Direction: CaptureReceived, Addr: "[::1]:161", Data: ciscoGetbulkResponseBytes()},
+	}
+	for _, rec := range records {
+		require.NoError(t, w.Write(rec))
+	}
+
+	r, err := NewCaptureReader(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, CaptureVersion, r.Version())
+	for _, want := range records {
+		got, err := r.Next()
+		require.NoError(t, err)
+		assert.True(t, want.Time.Equal(got.Time))
+		assert.Equal(t, want.Direction, got.Direction)
+		assert.Equal(t, want.Addr, got.Addr)
+		assert.Equal(t, want.Data, got.Data)
+	}
+	_, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestCaptureV1Replay(t *testing.T) {
+	file, err := hex.DecodeString(captureV1)
+	require.NoError(t, err)
+
+	r, err := NewCaptureReader(bytes.NewReader(file))
+	require.NoError(t, err)
+	rec, err := r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, CaptureSent, rec.Direction)
+	assert.Equal(t, "127.0.0.1:161", rec.Addr)
+	assert.True(t, time.Unix(1600000000, 0).Equal(rec.Time))
+
+	packet, err := Default.SnmpDecodePacket(rec.Data)
+	require.NoError(t, err)
+	assert.Equal(t, GetBulkRequest, packet.PDUType)
+	require.Len(t, packet.Variables, 1)
+	assert.Equal(t, ".1.3.6.1.2.1.1.9.1.3.52", packet.Variables[0].Name)
+}
+
+func TestCaptureForwardCompatible(t *testing.T) {
+	// a hypothetical newer writer: version 2, a compatible flag, header
+	// extension data and extra per-record metadata
+	file := []byte(captureMagic)
+	file = appendUint16(file, 2)
+	file = appendUint16(file, 0x0001)
+	file = appendUint32(file, 3)
+	file = append(file, 0xaa, 0xbb, 0xcc)
+	meta := appendUint64(nil, uint64(time.Unix(1600000000, 0).UnixNano()))
+	meta = append(meta, byte(CaptureReceived), 4)
+	meta = append(meta, "host"...)
+	meta = append(meta, 0xde, 0xad, 0xbe, 0xef)
+	data := []byte{0x30, 0x00}
+	file = appendUint32(file, uint32(2+len(meta)+len(data)))
+	file = appendUint16(file, uint16(len(meta)))
+	file = append(file, meta...)
+	file = append(file, data...)
+
+	r, err := NewCaptureReader(bytes.NewReader(file))
+	require.NoError(t, err)
+	assert.Equal(t, uint16(2), r.Version())
+	assert.Equal(t, uint16(1), r.Flags())
+	rec, err := r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "host", rec.Addr)
+	assert.Equal(t, data, rec.Data)
+	_, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestCaptureRejects(t *testing.T) {
+	_, err := NewCaptureReader(bytes.NewReader([]byte("not a capture file")))
+	assert.ErrorIs(t, err, ErrCaptureBadMagic)
+	_, err = NewCaptureReader(bytes.NewReader(nil))
+	assert.ErrorIs(t, err, ErrCaptureBadMagic)
+
+	file := []byte(captureMagic)
+	file = appendUint16(file, 3)
+	file = appendUint16(file, 0x0100)
+	file = appendUint32(file, 0)
+	_, err = NewCaptureReader(bytes.NewReader(file))
+	assert.ErrorIs(t, err, ErrCaptureUnsupported)
+
+	// truncated record
+	good, err := hex.DecodeString(captureV1)
+	require.NoError(t, err)
+	r, err := NewCaptureReader(bytes.NewReader(good[:len(good)-4]))
+	require.NoError(t, err)
+	_, err = r.Next()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,117 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"fmt"
+
+	"github.com/gosnmp/gosnmp/oids"
+)
+
+// sysObjectIDOID identifies the model of a device.
+const sysObjectIDOID = oids.SysObjectID
+
+// CollectionPlan records what collecting a set of subtrees learned about a
+// device: which subtrees exist, how many values they hold and the GetBulk
+// max-repetitions fetching them. A plan learned with LearnPlan on one device
+// can be stored as JSON and given to CollectPlan for the other devices of the
+// same model, skipping the probing of each of them:
+//
+//	plan, err := first.LearnPlan([]string{ifTable, ipAddrTable, entPhysicalTable})
+//	...
+//	for _, device := range sameModel {
+//		err = device.CollectPlan(plan, walkFn)
+//	}
+type CollectionPlan struct {
+	// Model is the sysObjectID.0 of the device the plan was learned on,
+	// for choosing the plan of a device.
+	Model string `json:"model,omitempty"`
+
+	Subtrees []PlannedSubtree `json:"subtrees"`
+}
+
+// PlannedSubtree is a subtree of a CollectionPlan.
+type PlannedSubtree struct {
+	Root string `json:"root"`
+
+	// Missing is true if the device had no values below Root, such
+	// subtrees are skipped by CollectPlan.
+	Missing bool `json:"missing,omitempty"`
+
+	// Values is the number of values below Root.
+	Values int `json:"values"`
+
+	// MaxRepetitions is the GetBulk max-repetitions of the walk: one more
+	// than Values, so that small tables are fetched by a single request, up
+	// to the MaxRepetitions of the session lowered to fit the msgMaxSize of
+	// the agent. It is 0 for SNMPv1, which walks with GetNext.
+	MaxRepetitions uint32 `json:"max_repetitions,omitempty"`
+}
+
+// LearnPlan walks the subtrees below roots and returns the CollectionPlan
+// for collecting them again from this device or others of its model.
+func (x *GoSNMP) LearnPlan(roots []string) (*CollectionPlan, error) {
+	plan := &CollectionPlan{}
+	result, err := x.Get([]string{sysObjectIDOID})
+	if err != nil {
+		return nil, fmt.Errorf("error getting sysObjectID: %w", err)
+	}
+	if len(result.Variables) == 1 && result.Variables[0].Type == ObjectIdentifier {
+		plan.Model, _ = result.Variables[0].Value.(string)
+	}
+
+	for _, root := range roots {
+		root = walkRoot(root)
+		values := 0
+		count := func(SnmpPDU) error {
+			values++
+			return nil
+		}
+		if x.Version == Version1 {
+			err = x.Walk(root, count)
+		} else {
+			err = x.BulkWalk(root, count)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error walking %s: %w", root, err)
+		}
+
+		subtree := PlannedSubtree{Root: root, Missing: values == 0, Values: values}
+		if x.Version != Version1 {
+			reps := x.capMaxRepetitions([]SnmpPDU{{Name: root}}, 0, x.maxRepetitions(x.requestOpts))
+			if uint32(values)+1 < reps {
+				reps = uint32(values) + 1
+			}
+			subtree.MaxRepetitions = reps
+		}
+		plan.Subtrees = append(plan.Subtrees, subtree)
+	}
+	return plan, nil
+}
+
+// CollectPlan walks the subtrees of plan that are not missing, calling
+// walkFn for every value as the walks do, with the max-repetitions of the
+// plan rather than of the session. The device is not probed: the plan must
+// come from a device of the same model, see CollectionPlan.Model.
+func (x *GoSNMP) CollectPlan(plan *CollectionPlan, walkFn WalkFunc) error {
+	for _, subtree := range plan.Subtrees {
+		if subtree.Missing {
+			continue
+		}
+		var err error
+		if x.Version == Version1 || subtree.MaxRepetitions == 0 {
+			err = x.Walk(subtree.Root, walkFn)
+		} else {
+			o := callOptions(x.requestOpts, []RequestOption{WithMaxRepetitions(subtree.MaxRepetitions)})
+			err = x.queueWalk(o, func() error {
+				return x.walk(o, GetBulkRequest, subtree.Root, walkFn)
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("error walking %s: %w", subtree.Root, err)
+		}
+	}
+	return nil
+}
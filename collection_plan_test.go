@@ -0,0 +1,84 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"encoding/json"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectionPlan(t *testing.T) {
+	mib := []SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.2.0", Type: ObjectIdentifier, Value: ".1.3.6.1.4.1.9.1.1208"},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.1", Type: OctetString, Value: "lo"},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.2", Type: OctetString, Value: "eth0"},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.3", Type: OctetString, Value: "eth1"},
+		{Name: ".1.3.6.1.2.1.2.2.1.3.1", Type: Integer, Value: 24},
+	}
+	device := func() (*GoSNMP, *int32) {
+		srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		require.NoError(t, err)
+		t.Cleanup(func() { srvr.Close() })
+		requests := new(int32)
+		go bulkAgent(t, srvr, mib, requests)
+
+		x := &GoSNMP{
+			Target:         "127.0.0.1",
+			Port:           uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+			Version:        Version2c,
+			Community:      "public",
+			Timeout:        time.Second,
+			MaxOids:        MaxOids,
+			MaxRepetitions: 2,
+		}
+		require.NoError(t, x.Connect())
+		t.Cleanup(func() { x.Conn.Close() })
+		return x, requests
+	}
+
+	first, _ := device()
+	plan, err := first.LearnPlan([]string{"1.3.6.1.2.1.2.2.1.2", ".1.3.6.1.2.1.47.1.1.1.1.2"})
+	require.NoError(t, err)
+	assert.Equal(t, &CollectionPlan{
+		Model: ".1.3.6.1.4.1.9.1.1208",
+		Subtrees: []PlannedSubtree{
+			{Root: ".1.3.6.1.2.1.2.2.1.2", Values: 3, MaxRepetitions: 2},
+			{Root: ".1.3.6.1.2.1.47.1.1.1.1.2", Missing: true, MaxRepetitions: 1},
+		},
+	}, plan)
+
+	// the plan survives storage, and with a larger session MaxRepetitions
+	// ifDescr fits a single request
+	first.MaxRepetitions = 10
+	plan, err = first.LearnPlan([]string{".1.3.6.1.2.1.2.2.1.2", ".1.3.6.1.2.1.47.1.1.1.1.2"})
+	require.NoError(t, err)
+	stored, err := json.Marshal(plan)
+	require.NoError(t, err)
+	loaded := &CollectionPlan{}
+	require.NoError(t, json.Unmarshal(stored, loaded))
+	assert.Equal(t, plan, loaded)
+	assert.Equal(t, uint32(4), loaded.Subtrees[0].MaxRepetitions)
+
+	second, requests := device()
+	var names []string
+	err = second.CollectPlan(loaded, func(pdu SnmpPDU) error {
+		names = append(names, pdu.Name)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{".1.3.6.1.2.1.2.2.1.2.1", ".1.3.6.1.2.1.2.2.1.2.2", ".1.3.6.1.2.1.2.2.1.2.3"}, names)
+	// one GetBulk, the missing subtree is not probed
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+	assert.Equal(t, uint32(2), second.maxRepetitions(second.requestOpts))
+}
@@ -0,0 +1,147 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxSensibleTimeout is the Timeout above which ValidateConfig warns.
+const maxSensibleTimeout = 30 * time.Second
+
+// Warning is a questionable, but valid, setting of a session found by
+// ValidateConfig.
+type Warning struct {
+	// Field is the name of the GoSNMP field, e.g. "Timeout".
+	Field   string
+	Message string
+}
+
+func (w Warning) String() string {
+	return w.Field + ": " + w.Message
+}
+
+// ValidateConfig checks the configuration of x as Connect does, without
+// opening a socket or changing x, so that e.g. a credentials file can be
+// checked before it is deployed. The error is the one Connect would fail
+// with before dialing. The warnings flag settings that work but are
+// probably mistakes or insecure: weak authentication or privacy protocols,
+// cleartext communities, huge timeouts, no retries and disabled limits.
+// They are returned even with an error.
+func ValidateConfig(x *GoSNMP) ([]Warning, error) {
+	if x == nil {
+		return nil, errors.New("nil GoSNMP")
+	}
+	warnings := configWarnings(x)
+
+	// validateParameters defaults fields and localizes keys, do it on a copy
+	c := *x
+	if x.SecurityParameters != nil {
+		c.SecurityParameters = x.SecurityParameters.Copy()
+	}
+	if err := c.validateParameters(); err != nil {
+		return warnings, err
+	}
+	return warnings, c.validateEndpoint()
+}
+
+// validateEndpoint checks what netConnect needs of the session.
+func (x *GoSNMP) validateEndpoint() error {
+	switch x.Version {
+	case Version1, Version2c, Version3:
+	default:
+		return fmt.Errorf("unknown SNMP version %d", x.Version)
+	}
+	if x.endpoint != nil {
+		return nil
+	}
+	if x.Target == "" {
+		return errors.New("field Target is empty")
+	}
+	if x.isDTLSTransport() && x.DTLSDialer == nil {
+		return errors.New("the dtlsudp transport requires a DTLSDialer")
+	}
+	if x.isDTLSTransport() && x.LocalAddr != "" {
+		return errDTLSLocalAddr
+	}
+	return nil
+}
+
+// configWarnings returns the warnings of ValidateConfig for x.
+func configWarnings(x *GoSNMP) []Warning {
+	var w []Warning
+	warn := func(field, format string, args ...interface{}) {
+		w = append(w, Warning{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if x.endpoint == nil && !knownTransport(x.Transport) {
+		warn("Transport", "%q is not an SNMP transport, it is dialed as is", x.Transport)
+	}
+	switch {
+	case x.Timeout <= 0:
+		warn("Timeout", "not set, every request times out at once")
+	case x.Timeout > maxSensibleTimeout:
+		warn("Timeout", "%s is above %s, a dead target stalls the poller", x.Timeout, maxSensibleTimeout)
+	}
+	if x.Retries <= 0 {
+		warn("Retries", "no retries, a single lost datagram fails the request")
+	}
+	if x.MaxOidLength < 0 {
+		warn("MaxOidLength", "disabled, received OIDs are not limited")
+	}
+	if x.MaxOidEncodedLength < 0 {
+		warn("MaxOidEncodedLength", "disabled, received OIDs are not limited")
+	}
+
+	if x.Version != Version3 {
+		warn("Version", "%s sends the community in cleartext, consider SNMPv3 with authPriv", x.Version)
+		switch x.Community {
+		case "public", "private":
+			warn("Community", "%q is a well-known default", x.Community)
+		}
+		return w
+	}
+
+	switch x.MsgFlags.SecurityLevel() {
+	case SecurityLevelNoAuthNoPriv:
+		warn("MsgFlags", "noAuthNoPriv, messages are neither authenticated nor encrypted")
+	case SecurityLevelAuthNoPriv:
+		warn("MsgFlags", "authNoPriv, messages are not encrypted")
+	}
+	if x.AllowDowngradeTo != nil {
+		warn("AllowDowngradeTo", "responses at %s are accepted", x.AllowDowngradeTo.SecurityLevel())
+	}
+	if x.AcceptDowngradedResponses {
+		warn("AcceptDowngradedResponses", "responses below the security level of the request are accepted")
+	}
+	if usp, ok := x.SecurityParameters.(*UsmSecurityParameters); ok {
+		if x.MsgFlags&AuthNoPriv != 0 {
+			switch usp.AuthenticationProtocol {
+			case MD5, SHA:
+				warn("SecurityParameters", "authentication protocol %s is weak, prefer SHA256 or above", usp.AuthenticationProtocol)
+			}
+		}
+		if x.MsgFlags&privacyFlag != 0 && usp.PrivacyProtocol == DES {
+			warn("SecurityParameters", "privacy protocol %s is weak, prefer AES", usp.PrivacyProtocol)
+		}
+	}
+	return w
+}
+
+// knownTransport reports whether netConnect has a case for transport.
+func knownTransport(transport string) bool {
+	if transport == "" {
+		return true // defaults to udp
+	}
+	for _, t := range []string{udp, tcp, tlsTransport, dtlsTransport} {
+		if s := strings.TrimPrefix(transport, t); s != transport && (s == "" || s == "4" || s == "6") {
+			return true
+		}
+	}
+	return false
+}
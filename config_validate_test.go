@@ -0,0 +1,116 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func warningFields(warnings []Warning) []string {
+	var fields []string
+	for _, w := range warnings {
+		fields = append(fields, w.Field)
+	}
+	return fields
+}
+
+func TestValidateConfig(t *testing.T) {
+	usp := &UsmSecurityParameters{
+		UserName:                 "user",
+		AuthenticationProtocol:   SHA256,
+		AuthenticationPassphrase: "authpassword",
+		PrivacyProtocol:          AES,
+		PrivacyPassphrase:        "privpassword",
+	}
+	x := &GoSNMP{
+		Target:             "192.0.2.1",
+		Port:               161,
+		Version:            Version3,
+		SecurityModel:      UserSecurityModel,
+		MsgFlags:           AuthPriv,
+		Timeout:            Default.Timeout,
+		Retries:            Default.Retries,
+		SecurityParameters: usp,
+	}
+	warnings, err := ValidateConfig(x)
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("ValidateConfig() = %v, %v, want no warnings", warnings, err)
+	}
+	if x.Transport != "" || x.MaxOids != 0 || x.Context != nil || x.Conn != nil {
+		t.Error("ValidateConfig changed the session")
+	}
+	if usp.PrivacyKey != nil {
+		t.Error("ValidateConfig localized the keys of the session")
+	}
+
+	usp.AuthenticationProtocol, usp.PrivacyProtocol = MD5, DES
+	x.Timeout, x.Retries = time.Minute, 0
+	x.MaxOidLength = -1
+	warnings, err = ValidateConfig(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Timeout", "Retries", "MaxOidLength", "SecurityParameters", "SecurityParameters"}
+	if got := warningFields(warnings); !reflect.DeepEqual(got, want) {
+		t.Errorf("warnings %v, want fields %v", warnings, want)
+	}
+
+	x.MsgFlags = privacyFlag
+	if _, err = ValidateConfig(x); !errors.Is(err, ErrInvalidMsgFlags) {
+		t.Errorf("ValidateConfig() = %v, want ErrInvalidMsgFlags", err)
+	}
+	x.MsgFlags = AuthPriv
+	usp.PrivacyPassphrase = ""
+	if _, err = ValidateConfig(x); err == nil {
+		t.Error("no error without a privacy passphrase")
+	}
+}
+
+func TestValidateConfigCommunity(t *testing.T) {
+	x := &GoSNMP{
+		Target:    "192.0.2.1",
+		Transport: "udp6",
+		Version:   Version2c,
+		Community: "public",
+		Timeout:   Default.Timeout,
+		Retries:   Default.Retries,
+	}
+	warnings, err := ValidateConfig(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := warningFields(warnings), []string{"Version", "Community"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("warnings %v, want fields %v", warnings, want)
+	}
+
+	for _, tt := range []struct {
+		modify func(*GoSNMP)
+		err    bool
+	}{
+		{func(x *GoSNMP) { x.Target = "" }, true},
+		{func(x *GoSNMP) { x.MaxOids = -1 }, true},
+		{func(x *GoSNMP) { x.Version = 2 }, true},
+		{func(x *GoSNMP) { x.Transport = "dtlsudp" }, true},
+		{func(x *GoSNMP) {
+			x.Transport, x.LocalAddr = "dtlsudp", "192.0.2.2:0"
+			x.DTLSDialer = func(context.Context, string, string) (net.Conn, error) { return nil, nil }
+		}, true},
+		{func(x *GoSNMP) { x.Transport = "tls4" }, false},
+	} {
+		c := *x
+		tt.modify(&c)
+		if _, err := ValidateConfig(&c); (err != nil) != tt.err {
+			t.Errorf("%s %s: ValidateConfig() = %v", c.Target, c.Transport, err)
+		}
+	}
+}
@@ -0,0 +1,418 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosnmp/gosnmp/oids"
+)
+
+// conformanceEndOID is past the objects of any agent, GetNext of it reaches
+// the end of the MIB view.
+const conformanceEndOID = ".2.0"
+
+// conformanceBulkRepetitions are the max-repetitions of the GetBulk limits
+// check.
+var conformanceBulkRepetitions = []uint32{10, 100, 1000} //nolint:gochecknoglobals
+
+// ConformanceStatus is the outcome of a ConformanceCheck.
+type ConformanceStatus uint8
+
+const (
+	// ConformancePass means the agent behaved as the RFCs require.
+	ConformancePass ConformanceStatus = iota
+	// ConformanceFail means it did not, Detail says how.
+	ConformanceFail
+	// ConformanceSkipped means the check does not apply to the session or
+	// the device, e.g. GetBulk over SNMPv1.
+	ConformanceSkipped
+)
+
+func (s ConformanceStatus) String() string {
+	switch s {
+	case ConformancePass:
+		return "pass"
+	case ConformanceFail:
+		return "fail"
+	case ConformanceSkipped:
+		return "skipped"
+	}
+	return fmt.Sprintf("ConformanceStatus(%d)", uint8(s))
+}
+
+// MarshalText encodes the status by name.
+func (s ConformanceStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ConformanceCheck is the result of one probe of Conformance.
+type ConformanceCheck struct {
+	Name   string            `json:"name"`
+	Status ConformanceStatus `json:"status"`
+	// Detail describes what the agent returned.
+	Detail string `json:"detail,omitempty"`
+}
+
+// ConformanceReport describes how a device answered the probes of
+// Conformance. It is JSON serializable, to be kept per device type or
+// attached to interoperability issues.
+type ConformanceReport struct {
+	Time      time.Time `json:"time"`
+	Target    string    `json:"target"`
+	Version   string    `json:"version"`
+	Transport string    `json:"transport"`
+
+	// SysDescr and SysObjectID identify the device.
+	SysDescr    string `json:"sys_descr,omitempty"`
+	SysObjectID string `json:"sys_object_id,omitempty"`
+
+	Checks []ConformanceCheck `json:"checks"`
+}
+
+// Failed returns the checks that failed.
+func (r *ConformanceReport) Failed() []ConformanceCheck {
+	var failed []ConformanceCheck
+	for _, c := range r.Checks {
+		if c.Status == ConformanceFail {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
+
+// WriteJSON writes the report to w as indented JSON.
+func (r *ConformanceReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// conformanceProbe returns the status and detail of a check.
+type conformanceProbe func() (ConformanceStatus, string)
+
+// Conformance probes the device with requests whose answers the RFCs define
+// and reports how it answered: Get of present, missing and reordered
+// objects, GetNext ordering and the end of the MIB view, GetBulk
+// non-repeaters and max-repetitions limits, Counter64 support and, for
+// SNMPv3, each security level up to MsgFlags. It helps to characterize a new
+// device type and to file precise interoperability issues.
+//
+// The probes read only standard objects of SNMPv2-MIB and IF-MIB. Failing
+// checks are reported rather than returned as errors; if the first Get gets
+// no valid response the other checks are skipped. Conformance must not be
+// used concurrently with other requests of the session, as it changes
+// MsgFlags while probing security levels.
+func (x *GoSNMP) Conformance() (*ConformanceReport, error) {
+	if x.shared().Conn == nil {
+		return nil, fmt.Errorf("&GoSNMP.Conn is missing. Provide a connection or use Connect()")
+	}
+	report := &ConformanceReport{
+		Time:      time.Now(),
+		Target:    x.Target,
+		Version:   x.Version.String(),
+		Transport: x.Transport,
+	}
+	add := func(name string, status ConformanceStatus, detail string) {
+		report.Checks = append(report.Checks, ConformanceCheck{Name: name, Status: status, Detail: detail})
+	}
+
+	getStatus, detail := x.probeGet(report)
+	add("get", getStatus, detail)
+	probes := []struct {
+		name  string
+		probe conformanceProbe
+		v2    bool
+	}{
+		{"get-order", x.probeGetOrder, false},
+		{"get-missing", x.probeGetMissing, false},
+		{"getnext-order", x.probeGetNextOrder, false},
+		{"getnext-end-of-mib", x.probeEndOfMib, false},
+		{"getbulk-non-repeaters", x.probeBulkNonRepeaters, true},
+		{"getbulk-limits", x.probeBulkLimits, true},
+		{"counter64", x.probeCounter64, true},
+	}
+	for _, p := range probes {
+		switch {
+		case getStatus == ConformanceFail:
+			add(p.name, ConformanceSkipped, "get failed")
+		case p.v2 && x.Version == Version1:
+			add(p.name, ConformanceSkipped, "not supported in SNMPv1")
+		default:
+			status, detail := p.probe()
+			add(p.name, status, detail)
+		}
+	}
+	if x.Version == Version3 {
+		for _, level := range []SnmpV3MsgFlags{NoAuthNoPriv, AuthNoPriv, AuthPriv} {
+			name := "v3-" + level.SecurityLevel().String()
+			switch {
+			case getStatus == ConformanceFail:
+				add(name, ConformanceSkipped, "get failed")
+			case level > x.MsgFlags&AuthPriv:
+				add(name, ConformanceSkipped, "above the configured security level")
+			default:
+				status, detail := x.probeSecurityLevel(level)
+				add(name, status, detail)
+			}
+		}
+	}
+	return report, nil
+}
+
+func (x *GoSNMP) probeGet(report *ConformanceReport) (ConformanceStatus, string) {
+	names := []string{oids.SysDescr, oids.SysObjectID, oids.SysUpTime}
+	result, err := x.Get(names)
+	if err != nil {
+		return ConformanceFail, err.Error()
+	}
+	if result.Error != NoError {
+		return ConformanceFail, fmt.Sprintf("error-status %s", result.Error)
+	}
+	if detail := sameNames(result.Variables, names); detail != "" {
+		return ConformanceFail, detail
+	}
+	for _, v := range result.Variables {
+		switch {
+		case v.Name == oids.SysDescr && v.Type == OctetString:
+			if b, ok := v.Value.([]byte); ok {
+				report.SysDescr = string(b)
+			}
+		case v.Name == oids.SysObjectID && v.Type == ObjectIdentifier:
+			report.SysObjectID, _ = v.Value.(string)
+		case v.Name == oids.SysUpTime && v.Type != TimeTicks:
+			return ConformanceFail, fmt.Sprintf("sysUpTime.0 of type %s", v.Type)
+		}
+	}
+	return ConformancePass, ""
+}
+
+// probeGetOrder checks that variables are returned in the order requested,
+// not sorted.
+func (x *GoSNMP) probeGetOrder() (ConformanceStatus, string) {
+	names := []string{oids.SysUpTime, oids.SysObjectID, oids.SysDescr}
+	result, err := x.Get(names)
+	if err != nil {
+		return ConformanceFail, err.Error()
+	}
+	if detail := sameNames(result.Variables, names); detail != "" {
+		return ConformanceFail, detail
+	}
+	return ConformancePass, ""
+}
+
+// probeGetMissing gets the sysDescr object rather than its instance, which
+// must be noSuchName in SNMPv1 and a noSuchInstance or noSuchObject exception
+// otherwise.
+func (x *GoSNMP) probeGetMissing() (ConformanceStatus, string) {
+	result, err := x.Get([]string{oids.SysUpTime, strings.TrimSuffix(oids.SysDescr, ".0")})
+	if err != nil {
+		return ConformanceFail, err.Error()
+	}
+	if x.Version == Version1 {
+		if result.Error != NoSuchName || result.ErrorIndex != 2 {
+			return ConformanceFail, fmt.Sprintf("error-status %s, error-index %d, want noSuchName, 2", result.Error, result.ErrorIndex)
+		}
+		return ConformancePass, ""
+	}
+	if result.Error != NoError {
+		return ConformanceFail, fmt.Sprintf("error-status %s, want an exception", result.Error)
+	}
+	if len(result.Variables) != 2 {
+		return ConformanceFail, fmt.Sprintf("%d variables, want 2", len(result.Variables))
+	}
+	if t := result.Variables[1].Type; t != NoSuchInstance && t != NoSuchObject {
+		return ConformanceFail, fmt.Sprintf("type %s, want NoSuchInstance or NoSuchObject", t)
+	}
+	return ConformancePass, result.Variables[1].Type.String()
+}
+
+// probeGetNextOrder checks that GetNext returns the lexicographic successor
+// of each variable, in the order requested.
+func (x *GoSNMP) probeGetNextOrder() (ConformanceStatus, string) {
+	names := []string{oids.SysUpTime, oids.SysDescr}
+	result, err := x.GetNext(names)
+	if err != nil {
+		return ConformanceFail, err.Error()
+	}
+	if result.Error != NoError {
+		return ConformanceFail, fmt.Sprintf("error-status %s", result.Error)
+	}
+	if len(result.Variables) != len(names) {
+		return ConformanceFail, fmt.Sprintf("%d variables, want %d", len(result.Variables), len(names))
+	}
+	for i, v := range result.Variables {
+		if !oidLess(names[i], v.Name) {
+			return ConformanceFail, fmt.Sprintf("GetNext of %s returned %s", names[i], v.Name)
+		}
+	}
+	return ConformancePass, ""
+}
+
+// probeEndOfMib checks the end of the MIB view: noSuchName in SNMPv1, an
+// endOfMibView exception otherwise.
+func (x *GoSNMP) probeEndOfMib() (ConformanceStatus, string) {
+	result, err := x.GetNext([]string{conformanceEndOID})
+	if err != nil {
+		return ConformanceFail, err.Error()
+	}
+	if x.Version == Version1 {
+		if result.Error != NoSuchName {
+			return ConformanceFail, fmt.Sprintf("error-status %s, want noSuchName", result.Error)
+		}
+		return ConformancePass, ""
+	}
+	if result.Error != NoError {
+		return ConformanceFail, fmt.Sprintf("error-status %s, want endOfMibView", result.Error)
+	}
+	if len(result.Variables) != 1 || result.Variables[0].Type != EndOfMibView {
+		return ConformanceFail, fmt.Sprintf("returned %s, want endOfMibView", describeVariables(result.Variables))
+	}
+	return ConformancePass, ""
+}
+
+// probeBulkNonRepeaters checks that a non-repeater is returned once,
+// followed by the repetitions in increasing order.
+func (x *GoSNMP) probeBulkNonRepeaters() (ConformanceStatus, string) {
+	const reps = 3
+	result, err := x.GetBulk([]string{strings.TrimSuffix(oids.SysUpTime, ".0"), oids.System}, 1, reps)
+	if err != nil {
+		return ConformanceFail, err.Error()
+	}
+	if result.Error != NoError {
+		return ConformanceFail, fmt.Sprintf("error-status %s", result.Error)
+	}
+	vars := result.Variables
+	if len(vars) < 2 || len(vars) > 1+reps {
+		return ConformanceFail, fmt.Sprintf("%d variables, want 2 to %d", len(vars), 1+reps)
+	}
+	if vars[0].Name != oids.SysUpTime {
+		return ConformanceFail, fmt.Sprintf("non-repeater returned %s, want %s", vars[0].Name, oids.SysUpTime)
+	}
+	if detail := increasing(oids.System, vars[1:]); detail != "" {
+		return ConformanceFail, detail
+	}
+	return ConformancePass, ""
+}
+
+// probeBulkLimits requests growing numbers of repetitions of MIB-2, which an
+// agent must answer, if need be with fewer repetitions or tooBig.
+func (x *GoSNMP) probeBulkLimits() (ConformanceStatus, string) {
+	var details []string
+	for _, reps := range conformanceBulkRepetitions {
+		result, err := x.GetBulk([]string{oids.MIB2}, 0, reps)
+		if err != nil {
+			return ConformanceFail, fmt.Sprintf("%s; max-repetitions %d: %s", strings.Join(details, ", "), reps, err)
+		}
+		switch {
+		case result.Error == TooBig:
+			details = append(details, fmt.Sprintf("%d: tooBig", reps))
+		case result.Error != NoError:
+			return ConformanceFail, fmt.Sprintf("max-repetitions %d: error-status %s", reps, result.Error)
+		case len(result.Variables) > int(reps):
+			return ConformanceFail, fmt.Sprintf("max-repetitions %d: %d variables", reps, len(result.Variables))
+		default:
+			if detail := increasing(oids.MIB2, result.Variables); detail != "" {
+				return ConformanceFail, fmt.Sprintf("max-repetitions %d: %s", reps, detail)
+			}
+			details = append(details, fmt.Sprintf("%d: %d", reps, len(result.Variables)))
+		}
+	}
+	return ConformancePass, "max-repetitions: variables " + strings.Join(details, ", ")
+}
+
+// probeCounter64 checks that ifHCInOctets, if implemented, is a Counter64.
+func (x *GoSNMP) probeCounter64() (ConformanceStatus, string) {
+	column := oids.IfXTable + ".1.6"
+	result, err := x.GetNext([]string{column})
+	if err != nil {
+		return ConformanceFail, err.Error()
+	}
+	if result.Error != NoError {
+		return ConformanceFail, fmt.Sprintf("error-status %s", result.Error)
+	}
+	if len(result.Variables) != 1 || !oids.Under(result.Variables[0].Name, column) {
+		return ConformanceSkipped, "ifHCInOctets not implemented"
+	}
+	if t := result.Variables[0].Type; t != Counter64 {
+		return ConformanceFail, fmt.Sprintf("ifHCInOctets of type %s", t)
+	}
+	return ConformancePass, ""
+}
+
+// probeSecurityLevel gets sysUpTime.0 at level, which the agent must answer
+// or refuse with a report.
+func (x *GoSNMP) probeSecurityLevel(level SnmpV3MsgFlags) (ConformanceStatus, string) {
+	flags := x.MsgFlags
+	defer func() { x.MsgFlags = flags }()
+	x.MsgFlags = flags&^AuthPriv | level
+
+	_, err := x.Get([]string{oids.SysUpTime})
+	var reportErr *ReportError
+	switch {
+	case err == nil:
+		return ConformancePass, "accepted"
+	case errors.As(err, &reportErr), errors.Is(err, ErrSecurityDowngrade):
+		return ConformancePass, "refused: " + err.Error()
+	}
+	return ConformanceFail, err.Error()
+}
+
+// sameNames describes how the names of vars differ from names, or returns
+// "".
+func sameNames(vars []SnmpPDU, names []string) string {
+	got := make([]string, 0, len(vars))
+	for _, v := range vars {
+		got = append(got, v.Name)
+	}
+	if strings.Join(got, " ") != strings.Join(names, " ") {
+		return fmt.Sprintf("returned %s, want %s", strings.Join(got, " "), strings.Join(names, " "))
+	}
+	return ""
+}
+
+// increasing describes the first variable of vars, starting after root, that
+// is not in increasing order before the end of the MIB view, or returns "".
+func increasing(root string, vars []SnmpPDU) string {
+	prev := root
+	for _, v := range vars {
+		if v.Type == EndOfMibView {
+			return ""
+		}
+		if !oidLess(prev, v.Name) {
+			return fmt.Sprintf("%s returned after %s", v.Name, prev)
+		}
+		prev = v.Name
+	}
+	return ""
+}
+
+func describeVariables(vars []SnmpPDU) string {
+	s := make([]string, 0, len(vars))
+	for _, v := range vars {
+		s = append(s, v.Name+" "+v.Type.String())
+	}
+	return strings.Join(s, ", ")
+}
+
+// oidLess reports whether OID a is before b in lexicographic order.
+func oidLess(a, b string) bool {
+	as := strings.Split(strings.TrimPrefix(a, "."), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "."), ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, _ := strconv.ParseUint(as[i], 10, 32)
+		y, _ := strconv.ParseUint(bs[i], 10, 32)
+		if x != y {
+			return x < y
+		}
+	}
+	return len(as) < len(bs)
+}
@@ -0,0 +1,87 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func conformanceSession(t *testing.T, mib []SnmpPDU) *GoSNMP {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { srvr.Close() })
+	if mib != nil {
+		var requests int32
+		// the agent reads its own copy, the test may change mib
+		go bulkAgent(t, srvr, append([]SnmpPDU(nil), mib...), &requests)
+	}
+
+	x := &GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Community: "public",
+		Version:   Version2c,
+		Timeout:   time.Second,
+		MaxOids:   MaxOids,
+	}
+	require.NoError(t, x.Connect())
+	t.Cleanup(func() { x.Conn.Close() })
+	return x
+}
+
+func TestConformance(t *testing.T) {
+	mib := []SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.1.0", Type: OctetString, Value: "Linux router 5.10"},
+		{Name: ".1.3.6.1.2.1.1.2.0", Type: ObjectIdentifier, Value: ".1.3.6.1.4.1.8072.3.2.10"},
+		{Name: ".1.3.6.1.2.1.1.3.0", Type: TimeTicks, Value: uint32(4242)},
+		{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "router"},
+		{Name: ".1.3.6.1.2.1.31.1.1.1.6.1", Type: Counter64, Value: uint64(1) << 40},
+	}
+	report, err := conformanceSession(t, mib).Conformance()
+	require.NoError(t, err)
+	assert.Equal(t, "Linux router 5.10", report.SysDescr)
+	assert.Equal(t, ".1.3.6.1.4.1.8072.3.2.10", report.SysObjectID)
+	names := make([]string, 0, len(report.Checks))
+	for _, c := range report.Checks {
+		names = append(names, c.Name)
+		assert.Equal(t, ConformancePass, c.Status, "%s: %s", c.Name, c.Detail)
+	}
+	assert.Equal(t, []string{"get", "get-order", "get-missing", "getnext-order", "getnext-end-of-mib",
+		"getbulk-non-repeaters", "getbulk-limits", "counter64"}, names)
+	assert.Empty(t, report.Failed())
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteJSON(&buf))
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, "pass", decoded["checks"].([]interface{})[0].(map[string]interface{})["status"])
+
+	// a device reporting ifHCInOctets as a Counter32
+	mib[4] = SnmpPDU{Name: ".1.3.6.1.2.1.31.1.1.1.6.1", Type: Counter32, Value: uint32(7)}
+	report, err = conformanceSession(t, mib).Conformance()
+	require.NoError(t, err)
+	assert.Equal(t, []ConformanceCheck{{Name: "counter64", Status: ConformanceFail, Detail: "ifHCInOctets of type Counter32"}}, report.Failed())
+
+	// no further probes once Get goes unanswered
+	x := conformanceSession(t, nil)
+	x.Timeout = 10 * time.Millisecond
+	report, err = x.Conformance()
+	require.NoError(t, err)
+	require.Len(t, report.Checks, 8)
+	assert.Equal(t, ConformanceFail, report.Checks[0].Status)
+	for _, c := range report.Checks[1:] {
+		assert.Equal(t, ConformanceSkipped, c.Status, c.Name)
+	}
+}
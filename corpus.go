@@ -0,0 +1,266 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A corpus is a directory of captured messages, e.g. contributed by users
+// for devices that needed interoperability fixes, each with what decoding it
+// must give. Every *.json file below the directory is a CorpusCase:
+//
+//	{
+//	  "description": "ifPhysAddress returned as a raw OctetString",
+//	  "vendor": "kyocera",
+//	  "packet": "3081c2020101...",
+//	  "expect": {
+//	    "version": "2c",
+//	    "pdu_type": "GetResponse",
+//	    "variables": [
+//	      {"name": ".1.3.6.1.2.1.1.7.0", "type": "Integer", "value": "104"}
+//	    ]
+//	  }
+//	}
+//
+// Addresses and communities should be anonymized before contributing a
+// capture.
+
+// CorpusCase is a captured message and the expected result of decoding it.
+type CorpusCase struct {
+	Description string `json:"description,omitempty"`
+	Vendor      string `json:"vendor,omitempty"`
+
+	// Packet is the hex encoded message. Alternatively Capture names a
+	// capture file, relative to the case file, and Record the index of the
+	// record holding the message, see NewCaptureReader.
+	Packet  string `json:"packet,omitempty"`
+	Capture string `json:"capture,omitempty"`
+	Record  int    `json:"record,omitempty"`
+
+	Expect CorpusExpect `json:"expect"`
+}
+
+// CorpusExpect is the expected result of decoding the message of a
+// CorpusCase. Fields left empty are not checked.
+type CorpusExpect struct {
+	// Error, if set, is part of the error decoding must fail with.
+	Error string `json:"error,omitempty"`
+
+	// Version is "1", "2c" or "3".
+	Version   string  `json:"version,omitempty"`
+	PDUType   string  `json:"pdu_type,omitempty"`
+	Community string  `json:"community,omitempty"`
+	RequestID *uint32 `json:"request_id,omitempty"`
+
+	// ErrorStatus is the error-status of the PDU, e.g. "NoError".
+	ErrorStatus string `json:"error_status,omitempty"`
+
+	// Variables, if set, are all the variables of the message.
+	Variables []CorpusVariable `json:"variables,omitempty"`
+}
+
+// CorpusVariable is an expected variable. Type is the name of its
+// Asn1BER, e.g. "Counter64". Value is the value as printed by
+// CorpusValue; if omitted it is not checked.
+type CorpusVariable struct {
+	Name  string  `json:"name"`
+	Type  string  `json:"type"`
+	Value *string `json:"value,omitempty"`
+}
+
+// CorpusResult is the outcome of a CorpusCase run by RunCorpus.
+type CorpusResult struct {
+	// Name is the path of the case file relative to the corpus directory,
+	// without the .json extension.
+	Name string
+	Case CorpusCase
+
+	// Err describes how decoding differed from the expectations, or is nil.
+	Err error
+}
+
+// pduTypeNames are the names of PDU types in corpus cases.
+//
+//nolint:gochecknoglobals
+var pduTypeNames = map[PDUType]string{
+	GetRequest:     "GetRequest",
+	GetNextRequest: "GetNextRequest",
+	GetResponse:    "GetResponse",
+	SetRequest:     "SetRequest",
+	Trap:           "Trap",
+	GetBulkRequest: "GetBulkRequest",
+	InformRequest:  "InformRequest",
+	SNMPv2Trap:     "SNMPv2Trap",
+	Report:         "Report",
+}
+
+// RunCorpus decodes the message of every case of the corpus in dir with
+// x.SnmpDecodePacket, e.g. &GoSNMP{} or a session with the credentials of
+// SNMPv3 messages, and checks the expectations of the case. An error is
+// returned only if the corpus cannot be read.
+func RunCorpus(x *GoSNMP, dir string) ([]CorpusResult, error) {
+	var results []CorpusResult
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		result := CorpusResult{Name: filepath.ToSlash(strings.TrimSuffix(rel, ".json"))}
+		if err = json.Unmarshal(data, &result.Case); err != nil {
+			return fmt.Errorf("error parsing corpus case %s: %w", path, err)
+		}
+		result.Err = result.Case.run(x, filepath.Dir(path))
+		results = append(results, result)
+		return nil
+	})
+	return results, err
+}
+
+// run decodes the message of the case, whose capture file is relative to
+// dir, and checks the expectations.
+func (c *CorpusCase) run(x *GoSNMP, dir string) error {
+	msg, err := c.message(dir)
+	if err != nil {
+		return err
+	}
+	packet, err := x.SnmpDecodePacket(msg)
+	want := c.Expect
+	if want.Error != "" {
+		if err == nil {
+			return fmt.Errorf("decoded without error, want an error containing %q", want.Error)
+		}
+		if !strings.Contains(err.Error(), want.Error) {
+			return fmt.Errorf("error %q, want an error containing %q", err, want.Error)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error decoding: %w", err)
+	}
+
+	var diffs []string
+	check := func(field, got, want string) {
+		if want != "" && got != want {
+			diffs = append(diffs, fmt.Sprintf("%s %q, want %q", field, got, want))
+		}
+	}
+	check("version", packet.Version.String(), want.Version)
+	pduType, ok := pduTypeNames[packet.PDUType]
+	if !ok {
+		pduType = fmt.Sprintf("%#x", byte(packet.PDUType))
+	}
+	check("pdu_type", pduType, want.PDUType)
+	check("community", packet.Community, want.Community)
+	check("error_status", packet.Error.String(), want.ErrorStatus)
+	if want.RequestID != nil && packet.RequestID != *want.RequestID {
+		diffs = append(diffs, fmt.Sprintf("request_id %d, want %d", packet.RequestID, *want.RequestID))
+	}
+	if want.Variables != nil {
+		if len(packet.Variables) != len(want.Variables) {
+			diffs = append(diffs, fmt.Sprintf("%d variables, want %d", len(packet.Variables), len(want.Variables)))
+		} else {
+			for i, v := range packet.Variables {
+				w := want.Variables[i]
+				check(fmt.Sprintf("variable %d name", i), v.Name, w.Name)
+				check(fmt.Sprintf("variable %d type", i), v.Type.String(), w.Type)
+				if w.Value != nil && CorpusValue(v) != *w.Value {
+					diffs = append(diffs, fmt.Sprintf("variable %d value %q, want %q", i, CorpusValue(v), *w.Value))
+				}
+			}
+		}
+	}
+	if len(diffs) > 0 {
+		return errors.New(strings.Join(diffs, "; "))
+	}
+	return nil
+}
+
+// message returns the raw message of the case.
+func (c *CorpusCase) message(dir string) ([]byte, error) {
+	if c.Capture == "" {
+		msg, err := hex.DecodeString(strings.Join(strings.Fields(c.Packet), ""))
+		if err != nil {
+			return nil, fmt.Errorf("error decoding packet: %w", err)
+		}
+		return msg, nil
+	}
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(c.Capture)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := NewCaptureReader(f)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; ; i++ {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("capture %s has %d records, want record %d", c.Capture, i, c.Record)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if i == c.Record {
+			return rec.Data, nil
+		}
+	}
+}
+
+// CorpusValue prints the value of a variable as corpus cases give it:
+// integers in decimal, OIDs and IP addresses as strings, octet strings as
+// text if printable and as "0x" followed by hex otherwise, and exceptions
+// and Null as "".
+func CorpusValue(pdu SnmpPDU) string {
+	switch pdu.Type {
+	case Null, NoSuchObject, NoSuchInstance, EndOfMibView:
+		return ""
+	case Integer, Counter32, Gauge32, TimeTicks, Counter64, Uinteger32:
+		return ToBigInt(pdu.Value).String()
+	}
+	switch v := pdu.Value.(type) {
+	case []byte:
+		if printable(v) {
+			return string(v)
+		}
+		return "0x" + hex.EncodeToString(v)
+	case string:
+		return v
+	}
+	return fmt.Sprint(pdu.Value)
+}
+
+func printable(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
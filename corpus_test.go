@@ -0,0 +1,59 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || marshal
+// +build all marshal
+
+package gosnmp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCorpus decodes the captures contributed to testdata/corpus.
+func TestCorpus(t *testing.T) {
+	results, err := RunCorpus(&GoSNMP{}, filepath.Join("testdata", "corpus"))
+	require.NoError(t, err)
+	require.NotEmpty(t, results)
+	for _, result := range results {
+		result := result
+		t.Run(result.Name, func(t *testing.T) {
+			assert.NoError(t, result.Err, result.Case.Description)
+		})
+	}
+}
+
+func TestCorpusMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "corpus")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	kase := `{"packet": "` + "3081c202010104067075626c6963a281b402043f9770440201000201003081a5300d06082b060102010107000201683012060a2b060102010202010a014104102833713012060a2b060102010202010501420405f5e100301906082b06010201010400040d41646d696e6973747261746f72300f060b2b060102012b0501010f0105003015060d2b06010201041501017f00000140047f0000013017060d2b060104011702050101010402040600159937762b301006082b06010201010300430413019254" + `",
+		"expect": {"version": "1", "pdu_type": "GetResponse", "variables": [{"name": ".1.3.6.1.2.1.1.7.0", "type": "Integer"}]}}`
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "case.json"), []byte(kase), 0o600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0o600))
+
+	results, err := RunCorpus(&GoSNMP{}, dir)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "case", results[0].Name)
+	require.Error(t, results[0].Err)
+	assert.Contains(t, results[0].Err.Error(), `version "2c", want "1"`)
+	assert.Contains(t, results[0].Err.Error(), "8 variables, want 1")
+	assert.NotContains(t, results[0].Err.Error(), "pdu_type")
+}
+
+func TestCorpusValue(t *testing.T) {
+	assert.Equal(t, "Administrator", CorpusValue(SnmpPDU{Type: OctetString, Value: []byte("Administrator")}))
+	assert.Equal(t, "0x00159937762b", CorpusValue(SnmpPDU{Type: OctetString, Value: []byte{0, 0x15, 0x99, 0x37, 0x76, 0x2b}}))
+	assert.Equal(t, "18446744073709551615", CorpusValue(SnmpPDU{Type: Counter64, Value: uint64(18446744073709551615)}))
+	assert.Equal(t, "-5", CorpusValue(SnmpPDU{Type: Integer, Value: -5}))
+	assert.Equal(t, "", CorpusValue(SnmpPDU{Type: NoSuchObject}))
+}
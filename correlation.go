@@ -0,0 +1,126 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// WithCorrelationID sets the correlation ID of a call instead of generating
+// one, e.g. to reuse the ID of the job a poller runs the call for.
+func WithCorrelationID(id string) RequestOption {
+	return func(o *requestOptions) {
+		o.correlationID = &id
+	}
+}
+
+// CorrelationID returns the correlation ID of the operation in progress, or
+// "" outside of one. Every request and every walk is one operation with an
+// ID of its own, shared by all its messages, retries and discovery. Call it
+// from hooks such as OnSent or BeforeSend to attribute metrics to the
+// operation; the same ID prefixes the log lines of the operation and is set
+// on the RequestError, ReportError or AccessError it fails with.
+func (x *GoSNMP) CorrelationID() string {
+	return x.correlationID
+}
+
+// CorrelationIDOf returns the correlation ID of the operation err was
+// returned by, if any.
+func CorrelationIDOf(err error) (string, bool) {
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) && reqErr.CorrelationID != "" {
+		return reqErr.CorrelationID, true
+	}
+	var reportErr *ReportError
+	if errors.As(err, &reportErr) && reportErr.CorrelationID != "" {
+		return reportErr.CorrelationID, true
+	}
+	var accessErr *AccessError
+	if errors.As(err, &accessErr) && accessErr.CorrelationID != "" {
+		return accessErr.CorrelationID, true
+	}
+	return "", false
+}
+
+// beginOperation returns the options o of a call with an operation started,
+// unless o already belong to one. The ID is that of WithCorrelationID or made
+// of the random session ID and a sequence number, e.g. "1a2b3c4d-17". o are
+// not modified.
+func (x *GoSNMP) beginOperation(o *requestOptions) *requestOptions {
+	if o != nil && o.operationID != "" {
+		return o
+	}
+	c := callOptions(o, nil)
+	if c.correlationID != nil {
+		c.operationID = *c.correlationID
+	}
+	if c.operationID == "" {
+		c.operationID = fmt.Sprintf("%08x-%d", x.random, atomic.AddUint32(&x.operationSeq, 1))
+	}
+	c.logger = x.Logger
+	if x.Logger.enabled() {
+		c.logger = NewLogger(&correlatedLogger{base: x.Logger, id: c.operationID})
+	}
+	return c
+}
+
+// callLogger returns the logger of a call with options o, prefixing the lines
+// of its operation with the correlation ID.
+func (x *GoSNMP) callLogger(o *requestOptions) *Logger {
+	if o != nil && o.operationID != "" {
+		return &o.logger
+	}
+	return &x.Logger
+}
+
+// holdOperation sets the operation of a call with options o as the one in
+// progress for the hooks of x, see CorrelationID, and returns the function
+// clearing it. The caller holds the connection of x.
+func (x *GoSNMP) holdOperation(o *requestOptions) func() {
+	prev := x.correlationID
+	x.correlationID = o.operationID
+	return func() { x.correlationID = prev }
+}
+
+// annotateError sets the correlation ID of the operation of a call with
+// options o on the typed errors of err.
+func annotateError(o *requestOptions, err error) {
+	if o == nil || o.operationID == "" {
+		return
+	}
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) && reqErr.CorrelationID == "" {
+		reqErr.CorrelationID = o.operationID
+	}
+	var reportErr *ReportError
+	if errors.As(err, &reportErr) && reportErr.CorrelationID == "" {
+		reportErr.CorrelationID = o.operationID
+	}
+	var accessErr *AccessError
+	if errors.As(err, &accessErr) && accessErr.CorrelationID == "" {
+		accessErr.CorrelationID = o.operationID
+	}
+}
+
+// correlatedLogger prefixes log lines with a correlation ID.
+type correlatedLogger struct {
+	base Logger
+	id   string
+}
+
+func (l *correlatedLogger) Print(v ...interface{}) {
+	l.base.Printf("[%s] %s", l.id, fmt.Sprint(v...))
+}
+
+func (l *correlatedLogger) Printf(format string, v ...interface{}) {
+	l.base.Printf("[%s] %s", l.id, fmt.Sprintf(format, v...))
+}
+
+// Enabled implements LoggerEnabler.
+func (l *correlatedLogger) Enabled() bool {
+	return l.base.enabled()
+}
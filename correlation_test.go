@@ -0,0 +1,146 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorrelationID(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	engineID := "\x80\x00\x00\x09\x03agent"
+	go contextAgent(t, srvr, engineID)
+
+	var logs bytes.Buffer
+	var sent []string
+	x := &GoSNMP{
+		Version:       Version3,
+		Target:        srvr.LocalAddr().(*net.UDPAddr).IP.String(),
+		Port:          uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Timeout:       time.Millisecond * 500,
+		MaxOids:       MaxOids,
+		SecurityModel: UserSecurityModel,
+		MsgFlags:      NoAuthNoPriv,
+		Logger:        NewLogger(log.New(&logs, "", 0)),
+		SecurityParameters: &UsmSecurityParameters{
+			UserName:                 "user",
+			AuthoritativeEngineID:    engineID,
+			AuthoritativeEngineBoots: 1,
+			AuthoritativeEngineTime:  10,
+		},
+	}
+	x.OnSent = func(x *GoSNMP) { sent = append(sent, x.CorrelationID()) }
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	_, err = x.GetWithOptions([]string{".1.3.6.1.2.1.1.5.0"}, WithCorrelationID("job-42"))
+	require.NoError(t, err)
+	results, err := x.WalkAll(".1.3.6.1.2.1.1.5")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	// one ID per operation, shared by all requests of a walk
+	require.Len(t, sent, 4)
+	assert.NotEmpty(t, sent[0])
+	assert.Equal(t, "job-42", sent[1])
+	assert.NotEqual(t, sent[0], sent[2])
+	assert.Equal(t, sent[2], sent[3])
+	assert.Empty(t, x.CorrelationID(), "no operation in progress")
+
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		if strings.Contains(line, "SEND INIT") {
+			assert.Regexp(t, `^\[(`+sent[0]+`|job-42|`+sent[2]+`)\] `, line)
+		}
+	}
+	assert.Contains(t, logs.String(), "[job-42] ")
+
+	// failed operations carry their ID
+	silent, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	require.NoError(t, err)
+	defer silent.Close()
+	x.Port = uint16(silent.LocalAddr().(*net.UDPAddr).Port)
+	x.Timeout = 50 * time.Millisecond
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+	_, err = x.GetWithOptions([]string{".1.3.6.1.2.1.1.5.0"}, WithCorrelationID("job-43"))
+	require.Error(t, err)
+	id, ok := CorrelationIDOf(err)
+	assert.True(t, ok)
+	assert.Equal(t, "job-43", id)
+	assert.Equal(t, "job-43", x.DebugSnapshot().RecentErrors[0].CorrelationID)
+
+	_, ok = CorrelationIDOf(errors.New("other"))
+	assert.False(t, ok)
+}
+
+func TestCorrelationIDConcurrent(t *testing.T) {
+	a := NewAgent()
+	a.Handler = &testAgentHandler{vars: testAgentVars()}
+	x := startAgent(t, a, Version2c, "public")
+	var logs bytes.Buffer
+	var logsMu sync.Mutex
+	x.Logger = NewLogger(log.New(writerFunc(func(p []byte) (int, error) {
+		logsMu.Lock()
+		defer logsMu.Unlock()
+		return logs.Write(p)
+	}), "", 0))
+	logger := x.Logger
+	var mu sync.Mutex
+	var sent []string
+	x.OnSent = func(x *GoSNMP) {
+		mu.Lock()
+		sent = append(sent, x.CorrelationID())
+		mu.Unlock()
+	}
+	// a view serializes the requests of x on its connection
+	_ = x.WithOptions()
+
+	const calls = 8
+	var want []string
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		id := fmt.Sprintf("job-%d", i)
+		want = append(want, id)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := x.GetWithOptions([]string{".1.3.6.1.2.1.1.1.0"}, WithCorrelationID(id))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	sort.Strings(sent)
+	assert.Equal(t, want, sent)
+	assert.Empty(t, x.CorrelationID())
+	assert.Equal(t, logger, x.Logger, "the logger of the session is not replaced")
+	assert.Equal(t, calls, strings.Count(logs.String(), "] SEND INIT\n"))
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
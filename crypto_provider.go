@@ -0,0 +1,76 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des" //nolint:gosec
+	"crypto/hmac"
+	"fmt"
+	"hash"
+)
+
+// CryptoProvider supplies the MACs and ciphers USM authenticates, encrypts
+// and decrypts messages with, e.g. from a FIPS validated module or a
+// hardware accelerator. Set it as UsmSecurityParameters.CryptoProvider; if
+// nil the Go standard library is used. Key localization (RFC 3414 section
+// 2.6) always uses the hashes of the standard library.
+type CryptoProvider interface {
+	// NewHMAC returns an HMAC of hash h keyed with key.
+	NewHMAC(h crypto.Hash, key []byte) (hash.Hash, error)
+	// NewAESCipher returns an AES block cipher for a 16, 24 or 32 byte key.
+	NewAESCipher(key []byte) (cipher.Block, error)
+	// NewDESCipher returns a DES block cipher for an 8 byte key.
+	NewDESCipher(key []byte) (cipher.Block, error)
+}
+
+// StdCryptoProvider is the CryptoProvider of the Go standard library, e.g.
+// to embed in a provider replacing only some of the primitives.
+type StdCryptoProvider struct{}
+
+// NewHMAC implements CryptoProvider.
+func (StdCryptoProvider) NewHMAC(h crypto.Hash, key []byte) (hash.Hash, error) {
+	if !h.Available() {
+		return nil, fmt.Errorf("hash %v is not available", h)
+	}
+	return hmac.New(h.New, key), nil
+}
+
+// NewAESCipher implements CryptoProvider.
+func (StdCryptoProvider) NewAESCipher(key []byte) (cipher.Block, error) {
+	return aes.NewCipher(key)
+}
+
+// NewDESCipher implements CryptoProvider.
+func (StdCryptoProvider) NewDESCipher(key []byte) (cipher.Block, error) {
+	return des.NewCipher(key) //nolint:gosec
+}
+
+// cryptoProvider returns the CryptoProvider of the parameters.
+func (sp *UsmSecurityParameters) cryptoProvider() CryptoProvider {
+	if sp.CryptoProvider != nil {
+		return sp.CryptoProvider
+	}
+	return StdCryptoProvider{}
+}
+
+// digestProvider calculates the digest of a message with the HMAC of p,
+// truncated to 12 bytes for MD5 and SHA as digestRFC3414 does.
+func digestProvider(p CryptoProvider, h SnmpV3AuthProtocol, packet []byte, authKey []byte) ([]byte, error) {
+	mac, err := p.NewHMAC(h.HashType(), authKey)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = mac.Write(packet); err != nil {
+		return nil, err
+	}
+	digest := mac.Sum(nil)
+	if (h == MD5 || h == SHA) && len(digest) > 12 {
+		digest = digest[:12]
+	}
+	return digest, nil
+}
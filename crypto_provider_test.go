@@ -0,0 +1,111 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"crypto"
+	"crypto/cipher"
+	"hash"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingProvider counts the primitives requested from the standard
+// library provider it embeds.
+type countingProvider struct {
+	StdCryptoProvider
+	hmacs, aes, des int32
+}
+
+func (p *countingProvider) NewHMAC(h crypto.Hash, key []byte) (hash.Hash, error) {
+	atomic.AddInt32(&p.hmacs, 1)
+	return p.StdCryptoProvider.NewHMAC(h, key)
+}
+
+func (p *countingProvider) NewAESCipher(key []byte) (cipher.Block, error) {
+	atomic.AddInt32(&p.aes, 1)
+	return p.StdCryptoProvider.NewAESCipher(key)
+}
+
+func (p *countingProvider) NewDESCipher(key []byte) (cipher.Block, error) {
+	atomic.AddInt32(&p.des, 1)
+	return p.StdCryptoProvider.NewDESCipher(key)
+}
+
+func TestCryptoProvider(t *testing.T) {
+	engineID := authorativeEngineID(t)
+	session := func(auth SnmpV3AuthProtocol, priv SnmpV3PrivProtocol, provider CryptoProvider) *GoSNMP {
+		x := &GoSNMP{
+			Version:       Version3,
+			SecurityModel: UserSecurityModel,
+			MsgFlags:      AuthPriv,
+			SecurityParameters: &UsmSecurityParameters{
+				UserName:                 "user",
+				AuthenticationProtocol:   auth,
+				AuthenticationPassphrase: "authpassword",
+				PrivacyProtocol:          priv,
+				PrivacyPassphrase:        "privpassword",
+				AuthoritativeEngineID:    engineID,
+				AuthoritativeEngineBoots: 1,
+				AuthoritativeEngineTime:  10,
+				CryptoProvider:           provider,
+			},
+		}
+		require.NoError(t, x.validateParameters())
+		require.NoError(t, x.SecurityParameters.(*UsmSecurityParameters).initSecurityKeys())
+		return x
+	}
+	// verify authenticates msg as the receive path does
+	verify := func(x *GoSNMP, msg []byte) error {
+		msg = append([]byte(nil), msg...)
+		result := &SnmpPacket{Logger: x.Logger, SecurityParameters: x.SecurityParameters.Copy()}
+		if _, err := x.unmarshalHeader(msg, result); err != nil {
+			return err
+		}
+		return x.testAuthentication(msg, result, false)
+	}
+	pdus := []SnmpPDU{{Name: ".1.3.6.1.2.1.1.1.0", Type: Null}}
+
+	for _, auth := range []SnmpV3AuthProtocol{MD5, SHA, SHA256, SHA512} {
+		for _, priv := range []SnmpV3PrivProtocol{DES, AES, AES256C} {
+			provider := &countingProvider{}
+			custom := session(auth, priv, provider)
+			std := session(auth, priv, nil)
+
+			// messages of either side are understood by the other
+			out, err := custom.SnmpEncodePacket(GetRequest, pdus, 0, 0)
+			require.NoError(t, err, "%s %s", auth, priv)
+			// decoding decrypts in place
+			packet, err := std.SnmpDecodePacket(append([]byte(nil), out...))
+			require.NoError(t, err, "%s %s", auth, priv)
+			assert.Equal(t, pdus[0].Name, packet.Variables[0].Name)
+			assert.NoError(t, verify(std, out), "%s %s", auth, priv)
+			out[len(out)-1] ^= 1
+			assert.Error(t, verify(custom, out), "tampered %s %s", auth, priv)
+
+			out, err = std.SnmpEncodePacket(GetRequest, pdus, 0, 0)
+			require.NoError(t, err)
+			packet, err = custom.SnmpDecodePacket(append([]byte(nil), out...))
+			require.NoError(t, err, "%s %s", auth, priv)
+			assert.Equal(t, pdus[0].Name, packet.Variables[0].Name)
+			assert.NoError(t, verify(custom, out), "%s %s", auth, priv)
+
+			assert.NotZero(t, provider.hmacs)
+			if priv == DES {
+				assert.Equal(t, int32(2), provider.des)
+				assert.Zero(t, provider.aes)
+			} else {
+				assert.Equal(t, int32(2), provider.aes)
+				assert.Zero(t, provider.des)
+			}
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// recentErrorsSize is the number of errors kept for DebugSnapshot.
+const recentErrorsSize = 16
+
+// redacted replaces secrets in a DebugSnapshot.
+const redacted = "<redacted>"
+
+// DebugSnapshot is a redacted, JSON serializable view of the state of a
+// session, meant to be attached to bug reports. Communities, passphrases and
+// keys are never included.
+type DebugSnapshot struct {
+	Time   time.Time   `json:"time"`
+	Config DebugConfig `json:"config"`
+
+	// Engine is the SNMPv3 engine the session talks to, as learned by
+	// discovery, and CachedEngine the entry of the EngineCache if any.
+	Engine       *DebugEngine `json:"engine,omitempty"`
+	CachedEngine *DebugEngine `json:"cached_engine,omitempty"`
+	Discovery    *DebugEngine `json:"last_discovery,omitempty"`
+
+	// AgentMsgMaxSize is the msgMaxSize advertised by the agent.
+	AgentMsgMaxSize uint32 `json:"agent_msg_max_size,omitempty"`
+
+	// PathMaxSize is the response size learned by MTUProbe.
+	PathMaxSize uint32 `json:"path_max_size,omitempty"`
+
+	// SecurityDowngrade describes a downgrade permitted by AllowDowngradeTo.
+	SecurityDowngrade string `json:"security_downgrade,omitempty"`
+
+	OIDStats map[string]OIDStats `json:"oid_stats,omitempty"`
+
+	// RecentErrors are the last errors returned by requests, oldest first.
+	RecentErrors []DebugError `json:"recent_errors,omitempty"`
+
+	// Quirks lists the device workarounds and non-default behaviours enabled
+	// on the session.
+	Quirks []string `json:"quirks,omitempty"`
+}
+
+// DebugConfig is the redacted configuration of a session.
+type DebugConfig struct {
+	Target             string        `json:"target"`
+	Port               uint16        `json:"port"`
+	Transport          string        `json:"transport"`
+	LocalAddr          string        `json:"local_addr,omitempty"`
+	Version            string        `json:"version"`
+	Community          string        `json:"community,omitempty"`
+	Timeout            time.Duration `json:"timeout_ns"`
+	Retries            int           `json:"retries"`
+	ExponentialTimeout bool          `json:"exponential_timeout,omitempty"`
+	MaxOids            int           `json:"max_oids"`
+	MaxRepetitions     uint32        `json:"max_repetitions"`
+	NonRepeaters       int           `json:"non_repeaters,omitempty"`
+
+	SecurityModel   SnmpV3SecurityModel `json:"security_model,omitempty"`
+	SecurityLevel   string              `json:"security_level,omitempty"`
+	UserName        string              `json:"user_name,omitempty"`
+	AuthProtocol    string              `json:"auth_protocol,omitempty"`
+	PrivProtocol    string              `json:"priv_protocol,omitempty"`
+	ContextName     string              `json:"context_name,omitempty"`
+	ContextEngineID string              `json:"context_engine_id,omitempty"`
+}
+
+// DebugEngine describes an SNMPv3 authoritative engine.
+type DebugEngine struct {
+	// EngineID is hex encoded.
+	EngineID    string    `json:"engine_id"`
+	EngineBoots uint32    `json:"engine_boots"`
+	EngineTime  uint32    `json:"engine_time"`
+	Updated     time.Time `json:"updated,omitempty"`
+}
+
+// DebugError is an error returned by a request.
+type DebugError struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+	// Trace is the attempt trace of the request, see RequestTrace.
+	Trace string `json:"trace,omitempty"`
+	// CorrelationID identifies the operation, see GoSNMP.CorrelationID.
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// WriteJSON writes the snapshot to w as indented JSON.
+func (s *DebugSnapshot) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// errorLog keeps the last errors of a session and its views.
+type errorLog struct {
+	mu      sync.Mutex
+	entries []DebugError
+}
+
+func (l *errorLog) add(err error) {
+	e := DebugError{Time: time.Now(), Error: err.Error()}
+	var rerr *RequestError
+	if errors.As(err, &rerr) {
+		e.Trace = rerr.Trace.String()
+	}
+	e.CorrelationID, _ = CorrelationIDOf(err)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) == recentErrorsSize {
+		copy(l.entries, l.entries[1:])
+		l.entries = l.entries[:recentErrorsSize-1]
+	}
+	l.entries = append(l.entries, e)
+}
+
+//nolint:gochecknoglobals
+var errorLogInit sync.Mutex
+
+// recordError keeps err for DebugSnapshot.
+func (x *GoSNMP) recordError(err error) {
+	errorLogInit.Lock()
+	if x.recentErrors == nil {
+		x.recentErrors = &errorLog{}
+	}
+	l := x.recentErrors
+	errorLogInit.Unlock()
+	l.add(err)
+}
+
+// DebugSnapshot returns a redacted snapshot of the session state for bug
+// reports: its configuration without secrets, the SNMPv3 engine it learned,
+// collected OID statistics, recent errors and enabled quirks.
+func (x *GoSNMP) DebugSnapshot() *DebugSnapshot {
+	s := &DebugSnapshot{
+		Time: time.Now(),
+		Config: DebugConfig{
+			Target:             x.Target,
+			Port:               x.Port,
+			Transport:          x.Transport,
+			LocalAddr:          x.LocalAddr,
+			Version:            x.Version.String(),
+			Timeout:            x.Timeout,
+			Retries:            x.Retries,
+			ExponentialTimeout: x.ExponentialTimeout,
+			MaxOids:            x.MaxOids,
+			MaxRepetitions:     x.MaxRepetitions,
+			NonRepeaters:       x.NonRepeaters,
+		},
+	}
+	if x.Community != "" {
+		s.Config.Community = redacted
+	}
+
+	if x.Version == Version3 {
+		s.Config.SecurityModel = x.SecurityModel
+		s.Config.SecurityLevel = x.msgFlags().SecurityLevel().String()
+		s.Config.ContextName = x.ContextName
+		s.Config.ContextEngineID = hex.EncodeToString([]byte(x.ContextEngineID))
+		if sp, ok := x.SecurityParameters.(*UsmSecurityParameters); ok {
+			sp.mu.Lock()
+			s.Config.UserName = sp.UserName
+			s.Config.AuthProtocol = sp.AuthenticationProtocol.String()
+			s.Config.PrivProtocol = sp.PrivacyProtocol.String()
+			if sp.AuthoritativeEngineID != "" {
+				s.Engine = &DebugEngine{
+					EngineID:    hex.EncodeToString([]byte(sp.AuthoritativeEngineID)),
+					EngineBoots: sp.AuthoritativeEngineBoots,
+					EngineTime:  sp.AuthoritativeEngineTime,
+				}
+			}
+			sp.mu.Unlock()
+		}
+		if x.EngineCache != nil {
+			if info, ok := x.EngineCache.Get(x.engineCacheAddress()); ok {
+				s.CachedEngine = &DebugEngine{
+					EngineID:    hex.EncodeToString([]byte(info.EngineID)),
+					EngineBoots: info.EngineBoots,
+					EngineTime:  info.EngineTime,
+					Updated:     info.Updated,
+				}
+			}
+		}
+		if d := x.LastDiscovery(); d != nil {
+			s.Discovery = &DebugEngine{
+				EngineID:    hex.EncodeToString([]byte(d.EngineID)),
+				EngineBoots: d.EngineBoots,
+				EngineTime:  d.EngineTime,
+			}
+		}
+		s.AgentMsgMaxSize = x.AgentMsgMaxSize()
+		if d := x.SecurityDowngrade(); d != nil {
+			s.SecurityDowngrade = d.Error()
+		}
+	}
+
+	s.PathMaxSize = x.PathMaxSize()
+	if x.OIDStats != nil {
+		s.OIDStats = x.OIDStats.Snapshot()
+	}
+	if x.recentErrors != nil {
+		x.recentErrors.mu.Lock()
+		s.RecentErrors = append([]DebugError(nil), x.recentErrors.entries...)
+		x.recentErrors.mu.Unlock()
+	}
+	s.Quirks = x.quirks()
+	return s
+}
+
+// quirks lists the workarounds and non-default behaviours of the session.
+func (x *GoSNMP) quirks() []string {
+	var q []string
+	for opt := range x.AppOpts {
+		q = append(q, "AppOpts:"+opt)
+	}
+	sort.Strings(q)
+	flags := []struct {
+		on   bool
+		name string
+	}{
+		{x.UseUnconnectedUDPSocket, "UseUnconnectedUDPSocket"},
+		{x.BeforeSend != nil, "BeforeSend"},
+		{x.AfterReceive != nil, "AfterReceive"},
+		{x.ShortResponses != ShortResponseAsIs, "ShortResponses"},
+		{x.AcceptDowngradedResponses, "AcceptDowngradedResponses"},
+		{x.AllowDowngradeTo != nil, "AllowDowngradeTo"},
+		{x.StrictAuthentication, "StrictAuthentication"},
+		{x.TimelinessWindow > 0, "TimelinessWindow"},
+		{x.MaxOidLength < 0, "MaxOidLength disabled"},
+		{x.MaxOidEncodedLength < 0, "MaxOidEncodedLength disabled"},
+	}
+	for _, f := range flags {
+		if f.on {
+			q = append(q, f.name)
+		}
+	}
+	return q
+}
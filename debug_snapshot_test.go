@@ -0,0 +1,90 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugSnapshot(t *testing.T) {
+	// a silent agent
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	cache := NewMemoryEngineCache()
+	x := &GoSNMP{
+		Target:        "127.0.0.1",
+		Port:          uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Version:       Version3,
+		Community:     "public",
+		Timeout:       20 * time.Millisecond,
+		Retries:       1,
+		MaxOids:       MaxOids,
+		SecurityModel: UserSecurityModel,
+		MsgFlags:      AuthPriv,
+		SecurityParameters: &UsmSecurityParameters{
+			UserName:                 "operator",
+			AuthenticationProtocol:   SHA,
+			AuthenticationPassphrase: "authpassword",
+			PrivacyProtocol:          AES,
+			PrivacyPassphrase:        "privpassword",
+			AuthoritativeEngineID:    "\x80\x00\x1f\x88\x04sw1",
+			AuthoritativeEngineBoots: 3,
+			AuthoritativeEngineTime:  1000,
+		},
+		EngineCache:             cache,
+		OIDStats:                NewOIDStatsCollector(),
+		AppOpts:                 map[string]interface{}{"c": true},
+		UseUnconnectedUDPSocket: true,
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+	cache.Put(x.engineCacheAddress(), EngineInfo{EngineID: "\x80\x00\x1f\x88\x04sw1", EngineBoots: 3, EngineTime: 900})
+
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.Error(t, err)
+
+	s := x.DebugSnapshot()
+	assert.Equal(t, "<redacted>", s.Config.Community)
+	assert.Equal(t, "operator", s.Config.UserName)
+	assert.Equal(t, "SHA", s.Config.AuthProtocol)
+	assert.Equal(t, "AES", s.Config.PrivProtocol)
+	assert.Equal(t, "authPriv", s.Config.SecurityLevel)
+	require.NotNil(t, s.Engine)
+	assert.Equal(t, "80001f8804737731", s.Engine.EngineID)
+	assert.Equal(t, uint32(3), s.Engine.EngineBoots)
+	require.NotNil(t, s.CachedEngine)
+	assert.Equal(t, uint32(900), s.CachedEngine.EngineTime)
+	require.Len(t, s.RecentErrors, 1)
+	assert.Contains(t, s.RecentErrors[0].Trace, "timeout")
+	assert.Equal(t, []string{"AppOpts:c", "UseUnconnectedUDPSocket"}, s.Quirks)
+
+	var buf bytes.Buffer
+	require.NoError(t, s.WriteJSON(&buf))
+	out := buf.String()
+	for _, secret := range []string{"public", "authpassword", "privpassword"} {
+		assert.NotContains(t, out, secret)
+	}
+	var decoded DebugSnapshot
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, s.Config, decoded.Config)
+
+	// the error log is bounded
+	for i := 0; i < recentErrorsSize+4; i++ {
+		x.recordError(ErrDecryption)
+	}
+	assert.Len(t, x.DebugSnapshot().RecentErrors, recentErrorsSize)
+}
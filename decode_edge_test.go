@@ -0,0 +1,72 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || marshal
+// +build all marshal
+
+package gosnmp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// v2cMessage wraps an encoded community and PDU in a v2c message.
+func v2cMessage(community, pdu, trailer []byte) []byte {
+	body := append([]byte{0x02, 0x01, 0x01}, community...)
+	body = append(body, pdu...)
+	out := append([]byte{0x30, byte(len(body))}, body...)
+	return append(out, trailer...)
+}
+
+func TestDecodeEdgeCases(t *testing.T) {
+	// GetResponse, request ID 1, no error, empty variable bindings
+	emptyResponse := []byte{0xa2, 0x0b, 0x02, 0x01, 0x01, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00, 0x30, 0x00}
+	// the same without the variable bindings, which are mandatory
+	noVarbinds := []byte{0xa2, 0x09, 0x02, 0x01, 0x01, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00}
+	public := []byte{0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c'}
+
+	tests := []struct {
+		name      string
+		msg       []byte
+		community string
+		err       error
+	}{
+		{"empty community", v2cMessage([]byte{0x04, 0x00}, emptyResponse, nil), "", nil},
+		{"empty variable bindings", v2cMessage(public, emptyResponse, nil), "public", nil},
+		{"multi-segment community", v2cMessage([]byte{0x24, 0x0a, 0x04, 0x03, 'p', 'u', 'b', 0x04, 0x03, 'l', 'i', 'c'}, emptyResponse, nil), "public", nil},
+		{"nested segments", v2cMessage([]byte{0x24, 0x0a, 0x24, 0x05, 0x04, 0x03, 'p', 'u', 'b', 0x04, 0x01, 'l'}, emptyResponse, nil), "publ", nil},
+		{"trailing data", v2cMessage(public, emptyResponse, []byte{0x00, 0x00, 0xff}), "", ErrTrailingData},
+		{"missing pdu", v2cMessage(public, nil, nil), "", ErrMissingPDU},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			x := &GoSNMP{Logger: Default.Logger}
+			packet, err := x.SnmpDecodePacket(test.msg)
+			if test.err != nil {
+				assert.ErrorIs(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.community, packet.Community)
+			assert.Equal(t, GetResponse, packet.PDUType)
+			assert.Empty(t, packet.Variables)
+		})
+	}
+
+	// malformed messages fail without panicking
+	for _, msg := range [][]byte{
+		v2cMessage([]byte{0x04, 0x05, 'a'}, nil, nil),
+		v2cMessage([]byte{0x24, 0x03, 0x02, 0x01, 0x00}, emptyResponse, nil),
+		v2cMessage([]byte{0x24, 0x09, 0x04, 0x03, 'p'}, nil, nil),
+		v2cMessage(public, noVarbinds, nil),
+		v2cMessage(public, []byte{0xa2, 0x00}, nil),
+		v2cMessage(public, []byte{0xa2, 0x03, 0x02, 0x01}, nil),
+	} {
+		_, err := (&GoSNMP{Logger: Default.Logger}).SnmpDecodePacket(msg)
+		assert.Error(t, err, "%x", msg)
+	}
+}
@@ -0,0 +1,560 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+// Package displayhint applies the DISPLAY-HINT clauses of textual
+// conventions, RFC 2579 section 3.1, to the values of variables: octet
+// strings such as "1x:" for MAC addresses and integers such as "d-2" for
+// fixed-point decimals are rendered as human-readable strings, and strings
+// entered in that form are parsed back into the values to set.
+//
+// Hints holds the hints of the objects of the MIBs loaded by the application,
+// the metadata gosnmp itself does not parse:
+//
+//	hints := displayhint.NewHints()
+//	err := hints.Add(".1.3.6.1.2.1.2.2.1.6", "1x:") // ifPhysAddress
+//	...
+//	fmt.Println(hints.Format(pdu)) // 00:1a:2b:3c:4d:5e
+//	pdu, err = hints.PDU(".1.3.6.1.2.1.2.2.1.6.1", gosnmp.OctetString, "00:1a:2b:3c:4d:5f")
+//	_, err = x.Set([]gosnmp.SnmpPDU{pdu})
+//
+// Other renderings, e.g. enumerations, plug in as Formatters.
+package displayhint
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// Hints of common textual conventions.
+//
+//nolint:gochecknoglobals
+var (
+	// DisplayString of SNMPv2-TC.
+	DisplayString = MustParse("255a")
+	// PhysAddress and MacAddress of SNMPv2-TC.
+	PhysAddress = MustParse("1x:")
+	// DateAndTime of SNMPv2-TC.
+	DateAndTime = MustParse("2d-1d-1d,1d:1d:1d.1d,1a1d:1d")
+	// InetAddressIPv4 of INET-ADDRESS-MIB.
+	InetAddressIPv4 = MustParse("1d.1d.1d.1d")
+	// InetAddressIPv6 of INET-ADDRESS-MIB.
+	InetAddressIPv6 = MustParse("2x:2x:2x:2x:2x:2x:2x:2x")
+	// SnmpAdminString of SNMP-FRAMEWORK-MIB.
+	SnmpAdminString = MustParse("255t")
+)
+
+// Formatter renders the values of variables as strings and parses them
+// back. Hint is the Formatter of DISPLAY-HINT clauses.
+type Formatter interface {
+	// Format returns the value of pdu as a string.
+	Format(pdu gosnmp.SnmpPDU) (string, error)
+
+	// Parse returns the value of type t represented by s, as set in an
+	// SnmpPDU of type t.
+	Parse(t gosnmp.Asn1BER, s string) (interface{}, error)
+}
+
+// octetSpec is one octet-format specification of an octet string hint.
+type octetSpec struct {
+	repeat     bool
+	length     int
+	format     byte
+	separator  byte // 0 if none
+	terminator byte // 0 if none
+}
+
+// Hint is a parsed DISPLAY-HINT: an integer-format, applying to INTEGER and
+// the unsigned types, or an octet-format, applying to OCTET STRINGs.
+type Hint struct {
+	text string
+
+	// octets are the specifications of an octet-format, the last one
+	// applying to the remaining octets
+	octets []octetSpec
+
+	// format and decimals are the integer-format: 'd', 'x', 'o' or 'b',
+	// with decimals implied digits for "d-N"
+	format   byte
+	decimals int
+}
+
+// Parse parses the DISPLAY-HINT hint, e.g. "1x:" or "d-2".
+func Parse(hint string) (*Hint, error) {
+	if hint == "" {
+		return nil, errors.New("displayhint: empty hint")
+	}
+	h := &Hint{text: hint}
+	if isIntegerFormat(hint[0]) {
+		return h, h.parseInteger(hint)
+	}
+	return h, h.parseOctets(hint)
+}
+
+// MustParse is like Parse but panics if hint cannot be parsed.
+func MustParse(hint string) *Hint {
+	h, err := Parse(hint)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+func isIntegerFormat(c byte) bool {
+	return c == 'd' || c == 'x' || c == 'o' || c == 'b'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (h *Hint) parseInteger(hint string) error {
+	h.format = hint[0]
+	if len(hint) == 1 {
+		return nil
+	}
+	if h.format != 'd' || hint[1] != '-' {
+		return fmt.Errorf("displayhint: invalid integer-format %q", hint)
+	}
+	n, err := strconv.Atoi(hint[2:])
+	if err != nil || n < 0 {
+		return fmt.Errorf("displayhint: invalid integer-format %q", hint)
+	}
+	h.decimals = n
+	return nil
+}
+
+func (h *Hint) parseOctets(hint string) error {
+	for i := 0; i < len(hint); {
+		var spec octetSpec
+		if hint[i] == '*' {
+			spec.repeat = true
+			i++
+		}
+		j := i
+		for j < len(hint) && isDigit(hint[j]) {
+			j++
+		}
+		if j == i {
+			return fmt.Errorf("displayhint: missing octet length at %d in %q", i, hint)
+		}
+		length, err := strconv.Atoi(hint[i:j])
+		if err != nil || length == 0 {
+			return fmt.Errorf("displayhint: invalid octet length at %d in %q", i, hint)
+		}
+		spec.length = length
+		i = j
+		if i == len(hint) {
+			return fmt.Errorf("displayhint: missing display format in %q", hint)
+		}
+		switch hint[i] {
+		case 'x', 'd', 'o', 'a', 't':
+			spec.format = hint[i]
+		default:
+			return fmt.Errorf("displayhint: invalid display format %q in %q", hint[i], hint)
+		}
+		i++
+		if i < len(hint) && !isDigit(hint[i]) && hint[i] != '*' {
+			spec.separator = hint[i]
+			i++
+			if spec.repeat && i < len(hint) && !isDigit(hint[i]) && hint[i] != '*' {
+				spec.terminator = hint[i]
+				i++
+			}
+		}
+		h.octets = append(h.octets, spec)
+	}
+	return nil
+}
+
+// String returns the DISPLAY-HINT.
+func (h *Hint) String() string {
+	return h.text
+}
+
+// IsInteger reports whether h is an integer-format.
+func (h *Hint) IsInteger() bool {
+	return h.format != 0
+}
+
+// spec returns the i-th octet-format specification, the last one applying
+// to the remaining octets.
+func (h *Hint) spec(i int) octetSpec {
+	if i >= len(h.octets) {
+		i = len(h.octets) - 1
+	}
+	return h.octets[i]
+}
+
+// Format returns the value of pdu as per h: integer-formats apply to
+// INTEGER, Counter32, Gauge32, TimeTicks, Counter64 and Uinteger32 values,
+// octet-formats to OCTET STRING and Opaque values.
+func (h *Hint) Format(pdu gosnmp.SnmpPDU) (string, error) {
+	if h.IsInteger() {
+		if !isIntegerType(pdu.Type) {
+			return "", fmt.Errorf("displayhint: integer-format %q applied to %v", h.text, pdu.Type)
+		}
+		return h.FormatInteger(gosnmp.ToBigInt(pdu.Value)), nil
+	}
+	if pdu.Type != gosnmp.OctetString && pdu.Type != gosnmp.Opaque {
+		return "", fmt.Errorf("displayhint: octet-format %q applied to %v", h.text, pdu.Type)
+	}
+	switch v := pdu.Value.(type) {
+	case []byte:
+		return h.FormatOctets(v), nil
+	case string:
+		return h.FormatOctets([]byte(v)), nil
+	}
+	return "", fmt.Errorf("displayhint: unexpected %T value of %v", pdu.Value, pdu.Type)
+}
+
+func isIntegerType(t gosnmp.Asn1BER) bool {
+	switch t {
+	case gosnmp.Integer, gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Counter64, gosnmp.Uinteger32:
+		return true
+	}
+	return false
+}
+
+// FormatInteger returns v as per the integer-format h, e.g. "12.34" for
+// 1234 and "d-2".
+func (h *Hint) FormatInteger(v *big.Int) string {
+	sign := ""
+	if v.Sign() < 0 {
+		sign = "-"
+		v = new(big.Int).Neg(v)
+	}
+	switch h.format {
+	case 'x':
+		return sign + v.Text(16)
+	case 'o':
+		return sign + v.Text(8)
+	case 'b':
+		return sign + v.Text(2)
+	}
+	digits := v.Text(10)
+	if h.decimals == 0 {
+		return sign + digits
+	}
+	if len(digits) <= h.decimals {
+		digits = strings.Repeat("0", h.decimals-len(digits)+1) + digits
+	}
+	point := len(digits) - h.decimals
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// FormatOctets returns b as per the octet-format h, e.g. "00:1a:2b" for
+// "1x:". Separators are only written between octets.
+func (h *Hint) FormatOctets(b []byte) string {
+	var sb strings.Builder
+	for i, pos := 0, 0; pos < len(b); i++ {
+		spec := h.spec(i)
+		count := 1
+		if spec.repeat {
+			count = int(b[pos])
+			pos++
+		}
+		for n := 0; n < count && pos < len(b); n++ {
+			end := pos + spec.length
+			if end > len(b) {
+				end = len(b)
+			}
+			formatOctets(&sb, spec.format, b[pos:end])
+			pos = end
+			if pos == len(b) {
+				break
+			}
+			if spec.repeat && n == count-1 && spec.terminator != 0 {
+				sb.WriteByte(spec.terminator)
+			} else if spec.separator != 0 {
+				sb.WriteByte(spec.separator)
+			}
+		}
+	}
+	return sb.String()
+}
+
+func formatOctets(sb *strings.Builder, format byte, b []byte) {
+	switch format {
+	case 'x':
+		sb.WriteString(hex.EncodeToString(b))
+	case 'd':
+		sb.WriteString(new(big.Int).SetBytes(b).Text(10))
+	case 'o':
+		sb.WriteString(new(big.Int).SetBytes(b).Text(8))
+	default:
+		sb.Write(b)
+	}
+}
+
+// Parse returns the value of type t represented by s as per h, e.g. the
+// []byte of an OCTET STRING, the int of an INTEGER, the uint32 of a Gauge32
+// or the uint64 of a Counter64.
+func (h *Hint) Parse(t gosnmp.Asn1BER, s string) (interface{}, error) {
+	if !h.IsInteger() {
+		if t != gosnmp.OctetString && t != gosnmp.Opaque {
+			return nil, fmt.Errorf("displayhint: octet-format %q applied to %v", h.text, t)
+		}
+		return h.ParseOctets(s)
+	}
+	if !isIntegerType(t) {
+		return nil, fmt.Errorf("displayhint: integer-format %q applied to %v", h.text, t)
+	}
+	v, err := h.ParseInteger(s)
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case gosnmp.Integer:
+		if !v.IsInt64() || v.Int64() < math.MinInt32 || v.Int64() > math.MaxInt32 {
+			return nil, fmt.Errorf("displayhint: %q out of range of %v", s, t)
+		}
+		return int(v.Int64()), nil
+	case gosnmp.Counter64:
+		if v.Sign() < 0 || !v.IsUint64() {
+			return nil, fmt.Errorf("displayhint: %q out of range of %v", s, t)
+		}
+		return v.Uint64(), nil
+	}
+	if v.Sign() < 0 || !v.IsUint64() || v.Uint64() > math.MaxUint32 {
+		return nil, fmt.Errorf("displayhint: %q out of range of %v", s, t)
+	}
+	return uint32(v.Uint64()), nil
+}
+
+// ParseInteger returns the integer represented by s as per the
+// integer-format h, e.g. 1234 for "12.34" and "d-2".
+func (h *Hint) ParseInteger(s string) (*big.Int, error) {
+	digits := s
+	base := 10
+	switch h.format {
+	case 'x':
+		base = 16
+	case 'o':
+		base = 8
+	case 'b':
+		base = 2
+	default:
+		if h.decimals > 0 {
+			var err error
+			if digits, err = shiftDecimals(s, h.decimals); err != nil {
+				return nil, err
+			}
+		}
+	}
+	v, ok := new(big.Int).SetString(digits, base)
+	if !ok {
+		return nil, fmt.Errorf("displayhint: invalid value %q for %q", s, h.text)
+	}
+	return v, nil
+}
+
+// shiftDecimals returns the digits of the decimal number s with its point
+// moved decimals digits to the right, e.g. "1234" for "12.34" and 2.
+func shiftDecimals(s string, decimals int) (string, error) {
+	point := strings.IndexByte(s, '.')
+	if point < 0 {
+		return s + strings.Repeat("0", decimals), nil
+	}
+	fraction := s[point+1:]
+	if len(fraction) > decimals {
+		return "", fmt.Errorf("displayhint: %q has more than %d decimals", s, decimals)
+	}
+	return s[:point] + fraction + strings.Repeat("0", decimals-len(fraction)), nil
+}
+
+// ParseOctets returns the octets represented by s as per the octet-format
+// h, e.g. []byte{0x00, 0x1a, 0x2b} for "00:1a:2b" and "1x:".
+func (h *Hint) ParseOctets(s string) ([]byte, error) {
+	var out []byte
+	for i, pos := 0, 0; pos < len(s); i++ {
+		spec := h.spec(i)
+		if !spec.repeat {
+			b, next, err := parseItem(spec, s, pos)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, b...)
+			pos = next
+			if pos < len(s) && spec.separator != 0 {
+				if s[pos] != spec.separator {
+					return nil, fmt.Errorf("displayhint: expected %q at %d in %q", spec.separator, pos, s)
+				}
+				pos++
+			}
+			continue
+		}
+		countAt := len(out)
+		out = append(out, 0)
+		count := 0
+		for pos < len(s) {
+			if count == math.MaxUint8 {
+				return nil, fmt.Errorf("displayhint: more than %d repetitions in %q", math.MaxUint8, s)
+			}
+			b, next, err := parseItem(spec, s, pos)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, b...)
+			count++
+			pos = next
+			if pos == len(s) {
+				break
+			}
+			if spec.terminator != 0 && s[pos] == spec.terminator {
+				pos++
+				break
+			}
+			if spec.separator == 0 || s[pos] != spec.separator {
+				break
+			}
+			pos++
+		}
+		out[countAt] = byte(count)
+	}
+	return out, nil
+}
+
+// parseItem parses one application of spec at pos of s, returning its
+// octets and the position after it.
+func parseItem(spec octetSpec, s string, pos int) ([]byte, int, error) {
+	end := pos
+	stop := func(c byte) bool {
+		return (spec.separator != 0 && c == spec.separator) || (spec.terminator != 0 && c == spec.terminator)
+	}
+	switch spec.format {
+	case 'a':
+		for end < len(s) && end-pos < spec.length && !stop(s[end]) {
+			end++
+		}
+		return []byte(s[pos:end]), end, nil
+	case 't':
+		for end < len(s) && !stop(s[end]) {
+			_, size := utf8.DecodeRuneInString(s[end:])
+			if end+size-pos > spec.length {
+				break
+			}
+			end += size
+		}
+		return []byte(s[pos:end]), end, nil
+	}
+
+	base, maxDigits := 10, len(s)
+	valid := isDigit
+	switch spec.format {
+	case 'x':
+		base, maxDigits = 16, 2*spec.length
+		valid = func(c byte) bool {
+			return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+		}
+	case 'o':
+		base = 8
+		valid = func(c byte) bool { return c >= '0' && c <= '7' }
+	}
+	for end < len(s) && end-pos < maxDigits && valid(s[end]) && !stop(s[end]) {
+		end++
+	}
+	if end == pos {
+		return nil, end, fmt.Errorf("displayhint: expected a number at %d in %q", pos, s)
+	}
+	v, _ := new(big.Int).SetString(s[pos:end], base)
+	b := v.Bytes()
+	if len(b) > spec.length {
+		return nil, end, fmt.Errorf("displayhint: %s does not fit %d octets", s[pos:end], spec.length)
+	}
+	out := make([]byte, spec.length)
+	copy(out[spec.length-len(b):], b)
+	return out, end, nil
+}
+
+// Hints holds the Formatters of MIB objects, e.g. the DISPLAY-HINT of their
+// textual conventions, applying to the object and its instances. It is safe
+// for concurrent use.
+type Hints struct {
+	mu         sync.RWMutex
+	formatters map[string]Formatter
+}
+
+// NewHints returns Hints without formatters.
+func NewHints() *Hints {
+	return &Hints{formatters: make(map[string]Formatter)}
+}
+
+// Add applies the DISPLAY-HINT hint to the object oid and its instances.
+func (h *Hints) Add(oid, hint string) error {
+	parsed, err := Parse(hint)
+	if err != nil {
+		return err
+	}
+	h.Register(oid, parsed)
+	return nil
+}
+
+// Register applies f to the object oid and its instances, replacing the
+// formatter of oid.
+func (h *Hints) Register(oid string, f Formatter) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.formatters[dottedOID(oid)] = f
+}
+
+// Lookup returns the formatter of the object of oid, the one registered
+// for the longest prefix of oid.
+func (h *Hints) Lookup(oid string) (Formatter, bool) {
+	oid = dottedOID(oid)
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for {
+		if f, ok := h.formatters[oid]; ok {
+			return f, true
+		}
+		i := strings.LastIndexByte(oid, '.')
+		if i <= 0 {
+			return nil, false
+		}
+		oid = oid[:i]
+	}
+}
+
+// Format returns the value of pdu rendered by the formatter of its object,
+// or by pdu.DisplayString if it has none or the formatter fails, e.g. for
+// an exception such as NoSuchInstance.
+func (h *Hints) Format(pdu gosnmp.SnmpPDU) string {
+	if f, ok := h.Lookup(pdu.Name); ok {
+		if s, err := f.Format(pdu); err == nil {
+			return s
+		}
+	}
+	return pdu.DisplayString()
+}
+
+// PDU returns the variable oid of type t with the value s parsed by the
+// formatter of its object, e.g. to be set.
+func (h *Hints) PDU(oid string, t gosnmp.Asn1BER, s string) (gosnmp.SnmpPDU, error) {
+	f, ok := h.Lookup(oid)
+	if !ok {
+		return gosnmp.SnmpPDU{}, fmt.Errorf("displayhint: no hint for %s", oid)
+	}
+	v, err := f.Parse(t, s)
+	if err != nil {
+		return gosnmp.SnmpPDU{}, err
+	}
+	return gosnmp.SnmpPDU{Name: dottedOID(oid), Type: t, Value: v}, nil
+}
+
+// dottedOID returns oid with a leading dot.
+func dottedOID(oid string) string {
+	if oid != "" && oid[0] != '.' {
+		return "." + oid
+	}
+	return oid
+}
@@ -0,0 +1,139 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package displayhint
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOctetFormats(t *testing.T) {
+	for _, tt := range []struct {
+		hint string
+		b    []byte
+		s    string
+	}{
+		{"1x:", []byte{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}, "00:1a:2b:3c:4d:5e"},
+		{"255a", []byte("router-1"), "router-1"},
+		{"1d.1d.1d.1d", []byte{192, 0, 2, 1}, "192.0.2.1"},
+		{"2x:2x:2x:2x:2x:2x:2x:2x", []byte{0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, "fe80:0000:0000:0000:0000:0000:0000:0001"},
+		{"2d-1d-1d,1d:1d:1d.1d,1a1d:1d", []byte{0x07, 0xe8, 10, 16, 13, 30, 15, 0, '+', 2, 0}, "2024-10-16,13:30:15.0,+2:0"},
+		{"2d-1d-1d,1d:1d:1d.1d,1a1d:1d", []byte{0x07, 0xe8, 10, 16, 13, 30, 15, 0}, "2024-10-16,13:30:15.0"},
+		{"*1d.;1x", []byte{3, 10, 20, 30, 0xff}, "10.20.30;ff"},
+		{"1o", []byte{8, 9}, "1011"},
+		{"255t", []byte("Zürich"), "Zürich"},
+	} {
+		h, err := Parse(tt.hint)
+		require.NoError(t, err, tt.hint)
+		assert.False(t, h.IsInteger())
+		assert.Equal(t, tt.s, h.FormatOctets(tt.b), tt.hint)
+
+		if tt.hint == "1o" {
+			// octal without separators is ambiguous
+			continue
+		}
+		b, err := h.ParseOctets(tt.s)
+		require.NoError(t, err, tt.hint)
+		assert.Equal(t, tt.b, b, tt.hint)
+	}
+
+	// values shorter than the hint stop at the last octet
+	assert.Equal(t, "192.0", InetAddressIPv4.FormatOctets([]byte{192, 0}))
+
+	_, err := PhysAddress.ParseOctets("00:1g")
+	assert.Error(t, err)
+	_, err = InetAddressIPv4.ParseOctets("192.0.2.256")
+	assert.Error(t, err)
+	_, err = InetAddressIPv4.ParseOctets("192-0")
+	assert.Error(t, err)
+}
+
+func TestIntegerFormats(t *testing.T) {
+	for _, tt := range []struct {
+		hint string
+		v    int64
+		s    string
+	}{
+		{"d", 1234, "1234"},
+		{"d-2", 1234, "12.34"},
+		{"d-2", -5, "-0.05"},
+		{"d-3", 7, "0.007"},
+		{"x", 255, "ff"},
+		{"o", 8, "10"},
+		{"b", 5, "101"},
+	} {
+		h, err := Parse(tt.hint)
+		require.NoError(t, err, tt.hint)
+		assert.True(t, h.IsInteger())
+		assert.Equal(t, tt.s, h.FormatInteger(big.NewInt(tt.v)), tt.hint)
+
+		v, err := h.ParseInteger(tt.s)
+		require.NoError(t, err, tt.hint)
+		assert.Equal(t, tt.v, v.Int64(), tt.hint)
+	}
+
+	h := MustParse("d-2")
+	v, err := h.ParseInteger("12.3")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1230), v.Int64())
+	_, err = h.ParseInteger("12.345")
+	assert.Error(t, err)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, hint := range []string{"", "x:", "1q", "0x", "d-", "x-1", "*"} {
+		_, err := Parse(hint)
+		assert.Error(t, err, hint)
+	}
+}
+
+func TestHints(t *testing.T) {
+	hints := NewHints()
+	require.NoError(t, hints.Add(".1.3.6.1.2.1.2.2.1.6", "1x:"))
+	require.NoError(t, hints.Add("1.3.6.1.4.1.9999.1", "d-1"))
+
+	mac := gosnmp.SnmpPDU{Name: ".1.3.6.1.2.1.2.2.1.6.1", Type: gosnmp.OctetString, Value: []byte{0, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}}
+	assert.Equal(t, "00:1a:2b:3c:4d:5e", hints.Format(mac))
+
+	temp := gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.9999.1.0", Type: gosnmp.Gauge32, Value: uint(215)}
+	assert.Equal(t, "21.5", hints.Format(temp))
+
+	// without a hint, or for exceptions, the display string
+	descr := gosnmp.SnmpPDU{Name: ".1.3.6.1.2.1.1.1.0", Type: gosnmp.OctetString, Value: []byte("router")}
+	assert.Equal(t, "router", hints.Format(descr))
+	missing := gosnmp.SnmpPDU{Name: ".1.3.6.1.2.1.2.2.1.6.9", Type: gosnmp.NoSuchInstance}
+	assert.Equal(t, missing.DisplayString(), hints.Format(missing))
+
+	pdu, err := hints.PDU(".1.3.6.1.2.1.2.2.1.6.1", gosnmp.OctetString, "00:1a:2b:3c:4d:5f")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 0x1a, 0x2b, 0x3c, 0x4d, 0x5f}, pdu.Value)
+
+	pdu, err = hints.PDU(".1.3.6.1.4.1.9999.1.0", gosnmp.Gauge32, "22")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(220), pdu.Value)
+	pdu, err = hints.PDU(".1.3.6.1.4.1.9999.1.0", gosnmp.Integer, "-1.5")
+	require.NoError(t, err)
+	assert.Equal(t, -15, pdu.Value)
+
+	_, err = hints.PDU(".1.3.6.1.4.1.9999.1.0", gosnmp.Gauge32, "-1.5")
+	assert.Error(t, err)
+	_, err = hints.PDU(".1.3.6.1.4.1.9999.1.0", gosnmp.OctetString, "1.5")
+	assert.Error(t, err)
+	_, err = hints.PDU(".1.3.6.1.2.1.1.1.0", gosnmp.OctetString, "router")
+	assert.Error(t, err)
+
+	// the PDU marshals for a SetRequest
+	_, err = (&gosnmp.SnmpPacket{
+		Version:   gosnmp.Version2c,
+		Community: "private",
+		PDUType:   gosnmp.SetRequest,
+		Variables: []gosnmp.SnmpPDU{pdu},
+	}).MarshalMsg()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,545 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxEndpointPending is the number of requests of a session whose
+// responses an Endpoint routes to it, the attempts of the requests in
+// progress.
+const maxEndpointPending = 32
+
+// DefaultEndpointPendingTTL is the lifetime of the request IDs of the
+// sessions of an Endpoint unless PendingTTL is set.
+const DefaultEndpointPendingTTL = time.Minute
+
+// Endpoint runs managers, an Agent and a TrapListener on one UDP socket,
+// e.g. on port 161 or 162 where NAT lets only one port through:
+//
+//	e := gosnmp.NewEndpoint()
+//	e.Agent = agent
+//	e.TrapListener = listener
+//	go e.Listen("0.0.0.0:161")
+//	<-e.Listening()
+//	x := &gosnmp.GoSNMP{Target: "192.0.2.1", Port: 161, Community: "public", Version: gosnmp.Version2c}
+//	err := e.Connect(x)
+//
+// Messages received are dispatched by request ID: responses to the requests
+// of the sessions connected with Connect go to their session, by the
+// msgID for SNMPv3. Other SNMPv1 and SNMPv2c messages are dispatched by PDU
+// type, requests to the Agent and notifications to the TrapListener. Other
+// SNMPv3 messages, whose PDU may be encrypted, go to the Agent if it has
+// Users and is their authoritative engine, or to the TrapListener. The
+// messages of nobody are dropped.
+type Endpoint struct {
+	// Params holds the Logger of the endpoint.
+	Params *GoSNMP
+
+	// Agent, if set, answers the requests received. It is not started with
+	// its Listen.
+	Agent *Agent
+
+	// TrapListener, if set, receives the notifications and acknowledges
+	// the informs. It is not started with its Listen, its OnNewTrap is
+	// called from the goroutine of Listen.
+	TrapListener *TrapListener
+
+	// PendingTTL is the time the request ID, or SNMPv3 msgID, of a request
+	// written by a session routes responses to it, at least until the read
+	// deadline of the session: the IDs of requests never answered are
+	// forgotten after it and counted as SessionStats.ExpiredCorrelations.
+	// DefaultEndpointPendingTTL if 0.
+	PendingTTL time.Duration
+
+	mu        sync.Mutex
+	conn      *net.UDPConn
+	pending   map[uint32]*endpointConn // by request ID or msgID
+	listening chan bool
+	done      chan bool
+	finish    int32 // set to 1 when closing
+}
+
+// NewEndpoint returns an initialized Endpoint.
+func NewEndpoint() *Endpoint {
+	return &Endpoint{
+		pending:   make(map[uint32]*endpointConn),
+		listening: make(chan bool, 1),
+		done:      make(chan bool, 1),
+	}
+}
+
+// Listening returns a channel receiving once the endpoint is ready.
+func (e *Endpoint) Listening() <-chan bool {
+	return e.listening
+}
+
+// Close stops the endpoint, the sessions connected to it fail to send.
+func (e *Endpoint) Close() {
+	if !atomic.CompareAndSwapInt32(&e.finish, 0, 1) {
+		return
+	}
+	e.mu.Lock()
+	conn := e.conn
+	e.mu.Unlock()
+	if conn == nil {
+		return
+	}
+	conn.Close()
+	<-e.done
+}
+
+// LocalAddr returns the address of the socket, or nil before Listen.
+func (e *Endpoint) LocalAddr() net.Addr {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn == nil {
+		return nil
+	}
+	return e.conn.LocalAddr()
+}
+
+// Connect connects the UDP session x through the endpoint, which must be
+// listening, instead of a socket of its own. Closing x.Conn disconnects it.
+func (e *Endpoint) Connect(x *GoSNMP) error {
+	if x.Transport != "" && x.Transport != udp && x.Transport != "udp4" && x.Transport != "udp6" {
+		return fmt.Errorf("an Endpoint doesn't support the %s transport", x.Transport)
+	}
+	x.endpoint = e
+	return x.Connect()
+}
+
+// pendingTTL returns the lifetime of the request IDs of the sessions.
+func (e *Endpoint) pendingTTL() time.Duration {
+	if e.PendingTTL > 0 {
+		return e.PendingTTL
+	}
+	return DefaultEndpointPendingTTL
+}
+
+// dial returns the connection of x, a session to addr.
+func (e *Endpoint) dial(addr string, x *GoSNMP) (net.Conn, error) {
+	e.mu.Lock()
+	listening := e.conn != nil
+	e.mu.Unlock()
+	if !listening || atomic.LoadInt32(&e.finish) == 1 {
+		return nil, errors.New("the endpoint is not listening")
+	}
+	remote, err := net.ResolveUDPAddr(udp, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &endpointConn{e: e, remote: remote, x: x, in: make(chan []byte, 4), closed: make(chan struct{})}, nil
+}
+
+// Listen receives on the UDP address addr, e.g. "0.0.0.0:161", until Close
+// is called.
+func (e *Endpoint) Listen(addr string) error {
+	if e.Params == nil {
+		e.Params = Default
+	}
+	if e.Agent != nil {
+		if err := e.Agent.init(); err != nil {
+			return err
+		}
+	}
+	if t := e.TrapListener; t != nil {
+		if t.Params == nil {
+			t.Params = Default
+		}
+		if err := t.Params.validateParameters(); err != nil {
+			return err
+		}
+		if t.OnNewTrap == nil {
+			t.OnNewTrap = t.debugTrapHandler
+		}
+	}
+	udpAddr, err := net.ResolveUDPAddr(udp, addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP(udp, udpAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	e.mu.Lock()
+	e.conn = conn
+	e.mu.Unlock()
+	e.listening <- true
+
+	var buf [rxBufSize]byte
+	for {
+		n, remote, err := conn.ReadFromUDP(buf[:])
+		if atomic.LoadInt32(&e.finish) == 1 {
+			e.done <- true
+			return nil
+		}
+		if err != nil {
+			e.Params.Logger.Printf("Endpoint: error in read %s\n", err)
+			continue
+		}
+		e.dispatch(conn, buf[:n], remote)
+	}
+}
+
+// dispatch passes the message msg from remote to its receiver.
+func (e *Endpoint) dispatch(conn *net.UDPConn, msg []byte, remote *net.UDPAddr) {
+	version, pduType, id, err := peekMessage(msg)
+	if err != nil {
+		e.Params.Logger.Printf("Endpoint: message from %s dropped: %s\n", remote, err)
+		return
+	}
+	if version == Version3 || pduType == GetResponse || pduType == Report {
+		e.mu.Lock()
+		c := e.pending[id]
+		ours := c != nil && c.remote.IP.Equal(remote.IP) && c.remote.Port == remote.Port
+		if ours {
+			c.answered(id)
+		}
+		e.mu.Unlock()
+		if ours {
+			c.deliver(append([]byte(nil), msg...))
+			return
+		}
+	}
+
+	switch {
+	case version != Version3 && isAgentRequest(pduType) || version == Version3 && e.forAgent(msg):
+		if e.Agent == nil {
+			return
+		}
+		out, err := e.Agent.answer(msg)
+		if err != nil {
+			e.Params.Logger.Printf("Endpoint: request from %s dropped: %s\n", remote, err)
+			return
+		}
+		if _, err = conn.WriteToUDP(out, remote); err != nil {
+			e.Params.Logger.Printf("Endpoint: error sending response to %s: %s\n", remote, err)
+		}
+	case version == Version3 || isNotification(pduType):
+		t := e.TrapListener
+		if t == nil {
+			return
+		}
+		atomic.AddUint64(&t.received, 1)
+		if !t.admitSource(remote.IP) {
+			return
+		}
+		// decoded values refer to the message, the listener may keep them
+		traps := t.decode(append([]byte(nil), msg...), remote)
+		if traps == nil || !t.admit(traps, remote.IP) {
+			return
+		}
+		if err := t.handleUDP(conn, traps, remote); err != nil {
+			e.Params.Logger.Printf("Endpoint: %s\n", err)
+		}
+	default:
+		e.Params.Logger.Printf("Endpoint: unexpected PDU type 0x%x from %s dropped\n", byte(pduType), remote)
+	}
+}
+
+// forAgent reports whether the SNMPv3 message msg is a request to the
+// Agent: its authoritative engine is that of the agent, or empty for
+// discovery.
+func (e *Endpoint) forAgent(msg []byte) bool {
+	a := e.Agent
+	if a == nil || a.Users == nil || a.Engine == nil {
+		return false
+	}
+	h, err := peekUsmHeader(msg)
+	if err != nil || h.securityModel != UserSecurityModel {
+		return false
+	}
+	return h.engineID == "" || h.engineID == a.Engine.EngineID()
+}
+
+// isAgentRequest reports whether an Agent answers PDUs of type t.
+func isAgentRequest(t PDUType) bool {
+	return t == GetRequest || t == GetNextRequest || t == GetBulkRequest || t == SetRequest
+}
+
+// peekMessage returns the version of msg and, for SNMPv1 and SNMPv2c, its
+// PDU type and request ID, or, for SNMPv3, its msgID.
+func peekMessage(msg []byte) (version SnmpVersion, pduType PDUType, id uint32, err error) {
+	var logger Logger
+	if len(msg) < 2 || PDUType(msg[0]) != Sequence {
+		return 0, 0, 0, errors.New("invalid packet header")
+	}
+	_, cursor, err := parseLength(msg)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	field := func(name string) (interface{}, error) {
+		if cursor >= len(msg) {
+			return nil, fmt.Errorf("truncated before the %s", name)
+		}
+		value, count, err := parseRawField(logger, msg[cursor:], name)
+		cursor += count
+		return value, err
+	}
+	raw, err := field("version")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	v, _ := raw.(int)
+	version = SnmpVersion(v)
+
+	if version == Version3 {
+		// msgID is the first field of msgGlobalData
+		if cursor >= len(msg) || PDUType(msg[cursor]) != Sequence {
+			return 0, 0, 0, errors.New("invalid SNMPv3 header")
+		}
+		_, count, err := parseLength(msg[cursor:])
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		cursor += count
+		if raw, err = field("msgID"); err != nil {
+			return 0, 0, 0, err
+		}
+		msgID, _ := raw.(int)
+		return version, 0, uint32(msgID), nil
+	}
+
+	if cursor >= len(msg) {
+		return 0, 0, 0, errors.New("truncated before the community")
+	}
+	_, count, err := parseCommunity(logger, msg[cursor:])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	cursor += count
+	if cursor >= len(msg) {
+		return 0, 0, 0, ErrMissingPDU
+	}
+	pduType = PDUType(msg[cursor])
+	if pduType == Trap {
+		// an SNMPv1 Trap-PDU has no request ID
+		return version, pduType, 0, nil
+	}
+	_, count, err = parseLength(msg[cursor:])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	cursor += count
+	if raw, err = field("request ID"); err != nil {
+		return 0, 0, 0, err
+	}
+	requestID, _ := raw.(int)
+	return version, pduType, uint32(requestID), nil
+}
+
+// errEndpointConnClosed is returned by the connection of a closed session.
+var errEndpointConnClosed = errors.New("use of closed endpoint connection")
+
+// endpointConn is the connection of a session through an Endpoint, with
+// the responses to its requests.
+type endpointConn struct {
+	e      *Endpoint
+	remote *net.UDPAddr
+	x      *GoSNMP // the session, if any
+	in     chan []byte
+	closed chan struct{}
+	once   sync.Once
+
+	mu       sync.Mutex
+	deadline time.Time
+
+	// ids are the requests written, oldest first, and expiry the timer
+	// forgetting them; guarded by e.mu
+	ids    []endpointPending
+	expiry *time.Timer
+}
+
+// endpointPending is a request written by the session of an endpointConn.
+// Its ID is in the pending table of the Endpoint until it expires or the
+// session writes maxEndpointPending requests after it, so that duplicated
+// responses still reach the session.
+type endpointPending struct {
+	id       uint32
+	expires  time.Time
+	answered bool
+}
+
+// deliver passes a response to the session, dropping it if the session
+// does not read.
+func (c *endpointConn) deliver(msg []byte) {
+	select {
+	case c.in <- msg:
+	default:
+	}
+}
+
+// Read returns the next response.
+func (c *endpointConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	deadline := c.deadline
+	c.mu.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case msg := <-c.in:
+		return copy(b, msg), nil
+	case <-timeout:
+		return 0, endpointTimeout{}
+	case <-c.closed:
+		return 0, errEndpointConnClosed
+	}
+}
+
+// Write sends the request b, routing its responses to c.
+func (c *endpointConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, errEndpointConnClosed
+	default:
+	}
+	if _, _, id, err := peekMessage(b); err == nil {
+		c.mu.Lock()
+		expires := c.deadline
+		c.mu.Unlock()
+		if ttl := time.Now().Add(c.e.pendingTTL()); ttl.After(expires) {
+			expires = ttl
+		}
+		c.e.mu.Lock()
+		if other := c.e.pending[id]; other != nil && other != c {
+			c.e.mu.Unlock()
+			return 0, fmt.Errorf("request ID %d is in use by another session of the endpoint", id)
+		}
+		c.e.pending[id] = c
+		c.forget(id)
+		c.ids = append(c.ids, endpointPending{id: id, expires: expires})
+		if len(c.ids) > maxEndpointPending {
+			if c.e.pending[c.ids[0].id] == c {
+				delete(c.e.pending, c.ids[0].id)
+			}
+			c.ids = c.ids[1:]
+		}
+		if c.expiry == nil {
+			c.expiry = time.AfterFunc(time.Until(expires), c.expire)
+		}
+		c.e.mu.Unlock()
+	}
+	c.e.mu.Lock()
+	conn := c.e.conn
+	c.e.mu.Unlock()
+	return conn.WriteToUDP(b, c.remote)
+}
+
+// Close disconnects the session from the endpoint.
+func (c *endpointConn) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+		c.e.mu.Lock()
+		for _, p := range c.ids {
+			if c.e.pending[p.id] == c {
+				delete(c.e.pending, p.id)
+			}
+		}
+		c.ids = nil
+		if c.expiry != nil {
+			c.expiry.Stop()
+			c.expiry = nil
+		}
+		c.e.mu.Unlock()
+	})
+	return nil
+}
+
+// forget removes the request id, retransmitted, from c.ids. The caller
+// holds e.mu.
+func (c *endpointConn) forget(id uint32) {
+	kept := c.ids[:0]
+	for _, p := range c.ids {
+		if p.id != id {
+			kept = append(kept, p)
+		}
+	}
+	c.ids = kept
+}
+
+// answered marks the request id as answered. The caller holds e.mu.
+func (c *endpointConn) answered(id uint32) {
+	for i := range c.ids {
+		if c.ids[i].id == id {
+			c.ids[i].answered = true
+		}
+	}
+}
+
+// expire forgets the requests past their lifetime, counting those never
+// answered, and waits for the next one to expire.
+func (c *endpointConn) expire() {
+	now := time.Now()
+	expired := 0
+	c.e.mu.Lock()
+	c.expiry = nil
+	var next time.Time
+	kept := c.ids[:0]
+	for _, p := range c.ids {
+		if p.expires.After(now) {
+			kept = append(kept, p)
+			if next.IsZero() || p.expires.Before(next) {
+				next = p.expires
+			}
+			continue
+		}
+		if c.e.pending[p.id] == c {
+			delete(c.e.pending, p.id)
+			if !p.answered {
+				expired++
+			}
+		}
+	}
+	c.ids = kept
+	if len(kept) > 0 {
+		c.expiry = time.AfterFunc(time.Until(next), c.expire)
+	}
+	c.e.mu.Unlock()
+	if c.x != nil {
+		c.x.expired(expired)
+	}
+}
+
+func (c *endpointConn) LocalAddr() net.Addr {
+	return c.e.LocalAddr()
+}
+
+func (c *endpointConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *endpointConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *endpointConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *endpointConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// endpointTimeout is the net.Error of a Read past the deadline.
+type endpointTimeout struct{}
+
+func (endpointTimeout) Error() string   { return "i/o timeout" }
+func (endpointTimeout) Timeout() bool   { return true }
+func (endpointTimeout) Temporary() bool { return true }
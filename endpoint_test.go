@@ -0,0 +1,253 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startEndpoint runs e on an ephemeral port and returns the port.
+func startEndpoint(t *testing.T, e *Endpoint) uint16 {
+	e.Params = &GoSNMP{Logger: NewLogger(log.New(ioutil.Discard, "", 0))}
+	errch := make(chan error, 1)
+	go func() {
+		errch <- e.Listen("127.0.0.1:0")
+	}()
+	select {
+	case <-e.Listening():
+	case err := <-errch:
+		t.Fatalf("error in listen: %v", err)
+	}
+	t.Cleanup(e.Close)
+	return uint16(e.LocalAddr().(*net.UDPAddr).Port)
+}
+
+func endpointAgent(name string) *Agent {
+	a := NewAgent()
+	a.Params = &GoSNMP{Community: "public", Logger: NewLogger(log.New(ioutil.Discard, "", 0))}
+	a.Handler = &testAgentHandler{vars: map[string]SnmpPDU{
+		".1.3.6.1.2.1.1.5.0": {Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: name},
+	}}
+	return a
+}
+
+func TestEndpoint(t *testing.T) {
+	// two peers, each an agent, a manager and a trap receiver on one port
+	var mu sync.Mutex
+	var traps []*SnmpPacket
+	left, right := NewEndpoint(), NewEndpoint()
+	left.Agent = endpointAgent("left")
+	right.Agent = endpointAgent("right")
+	left.TrapListener = NewTrapListener()
+	left.TrapListener.Params = &GoSNMP{Community: "public", Version: Version2c}
+	left.TrapListener.OnNewTrap = func(p *SnmpPacket, _ *net.UDPAddr) {
+		mu.Lock()
+		traps = append(traps, p)
+		mu.Unlock()
+	}
+	leftPort, rightPort := startEndpoint(t, left), startEndpoint(t, right)
+
+	session := func(e *Endpoint, port uint16) *GoSNMP {
+		x := &GoSNMP{
+			Target:    "127.0.0.1",
+			Port:      port,
+			Community: "public",
+			Version:   Version2c,
+			Timeout:   time.Second,
+			Retries:   1,
+		}
+		require.NoError(t, e.Connect(x))
+		t.Cleanup(func() { x.Conn.Close() })
+		return x
+	}
+	toRight := session(left, rightPort)
+	toRight2 := session(left, rightPort)
+	toLeft := session(right, leftPort)
+	assert.Equal(t, left.LocalAddr(), toRight.Conn.LocalAddr(), "the session uses the socket of the endpoint")
+
+	// the sessions of an endpoint get the responses to their own requests
+	var wg sync.WaitGroup
+	for _, x := range []*GoSNMP{toRight, toRight2, toLeft} {
+		x := x
+		want := "right"
+		if x == toLeft {
+			want = "left"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				result, err := x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.Equal(t, []byte(want), result.Variables[0].Value)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// notifications go to the trap listener, informs are acknowledged
+	_, err := toLeft.SendTrap(SnmpTrap{Variables: []SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "trap"}}})
+	require.NoError(t, err)
+	result, err := toLeft.SendInform(SnmpTrap{Variables: []SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "inform"}}})
+	require.NoError(t, err)
+	assert.Equal(t, GetResponse, result.PDUType)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(traps) == 2
+	}, time.Second, time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, SNMPv2Trap, traps[0].PDUType)
+	assert.True(t, traps[1].IsInform)
+	mu.Unlock()
+
+	// right has no trap listener, the trap is dropped
+	_, err = toRight.SendTrap(SnmpTrap{Variables: []SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "trap"}}})
+	require.NoError(t, err)
+
+	// a closed session no longer receives
+	require.NoError(t, toRight2.Conn.Close())
+	_, err = toRight2.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.Error(t, err)
+	_, err = toRight.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+}
+
+func TestEndpointRequestIDs(t *testing.T) {
+	e := NewEndpoint()
+	startEndpoint(t, e)
+	a, err := e.dial("127.0.0.1:161", nil)
+	require.NoError(t, err)
+	b, err := e.dial("127.0.0.1:161", nil)
+	require.NoError(t, err)
+
+	req := &SnmpPacket{Version: Version2c, Community: "public", PDUType: GetRequest, RequestID: 42,
+		Variables: []SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: Null}}}
+	msg, err := req.marshalMsg()
+	require.NoError(t, err)
+	_, err = a.Write(msg)
+	require.NoError(t, err)
+	_, err = b.Write(msg)
+	require.Error(t, err, "the request ID of another session")
+
+	// the ID is free once the session is closed
+	require.NoError(t, a.Close())
+	_, err = b.Write(msg)
+	require.NoError(t, err)
+
+	// the response goes to b
+	resp, err := req.Response(nil).marshalMsg()
+	require.NoError(t, err)
+	e.dispatch(e.conn, resp, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 161})
+	require.NoError(t, b.SetDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 1500)
+	n, err := b.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, resp, buf[:n])
+
+	// and only from the target of b
+	e.dispatch(e.conn, resp, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 162})
+	require.NoError(t, b.SetDeadline(time.Now().Add(10*time.Millisecond)))
+	_, err = b.Read(buf)
+	var netErr net.Error
+	require.Error(t, err)
+	assert.True(t, errors.As(err, &netErr) && netErr.Timeout())
+
+	for _, msg := range [][]byte{nil, {0x30}, {0x30, 0x03, 0x02, 0x01, 0x01}, msg[:10]} {
+		_, _, _, err = peekMessage(msg)
+		assert.Error(t, err)
+	}
+}
+
+func TestEndpointPendingTTL(t *testing.T) {
+	e := NewEndpoint()
+	e.Agent = endpointAgent("right")
+	e.PendingTTL = 10 * time.Millisecond
+	port := startEndpoint(t, e)
+
+	// an agent that never answers
+	silent, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer silent.Close()
+
+	stats := NewSessionStatsCollector()
+	var hooked int64
+	session := func(port uint16) *GoSNMP {
+		x := &GoSNMP{
+			Target:       "127.0.0.1",
+			Port:         port,
+			Community:    "public",
+			Version:      Version2c,
+			Timeout:      20 * time.Millisecond,
+			Retries:      1,
+			SessionStats: stats,
+			OnExpire: func(_ *GoSNMP, n int) {
+				atomic.AddInt64(&hooked, int64(n))
+			},
+		}
+		require.NoError(t, e.Connect(x))
+		t.Cleanup(func() { x.Conn.Close() })
+		return x
+	}
+	answered, unanswered := session(port), session(uint16(silent.LocalAddr().(*net.UDPAddr).Port))
+	_, err = answered.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	_, err = unanswered.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.Error(t, err)
+
+	// the IDs of both sessions are forgotten, only the two attempts never
+	// answered are counted
+	require.Eventually(t, func() bool {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		return len(e.pending) == 0
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(2), stats.Snapshot().ExpiredCorrelations)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&hooked))
+}
+
+func TestEndpointUsm(t *testing.T) {
+	// SNMPv3 requests to the engine of the agent go to the agent
+	users := NewUsmUserTable()
+	require.NoError(t, users.Add(UsmUser{UserName: "admin", AuthenticationProtocol: SHA, AuthenticationPassphrase: "authpassword"}))
+	e := NewEndpoint()
+	e.Agent = endpointAgent("v3")
+	e.Agent.Users = users
+	port := startEndpoint(t, e)
+
+	x := &GoSNMP{
+		Target:        "127.0.0.1",
+		Port:          port,
+		Version:       Version3,
+		Timeout:       time.Second,
+		SecurityModel: UserSecurityModel,
+		MsgFlags:      AuthNoPriv,
+		SecurityParameters: &UsmSecurityParameters{
+			UserName:                 "admin",
+			AuthenticationProtocol:   SHA,
+			AuthenticationPassphrase: "authpassword",
+		},
+	}
+	require.NoError(t, x.Connect())
+	t.Cleanup(func() { x.Conn.Close() })
+	result, err := x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v3"), result.Variables[0].Value)
+}
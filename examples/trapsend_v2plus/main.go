@@ -9,6 +9,7 @@ import (
 	"os"
 
 	g "github.com/gosnmp/gosnmp"
+	"github.com/gosnmp/gosnmp/oids"
 )
 
 func main() {
@@ -27,9 +28,9 @@ func main() {
 	defer g.Default.Conn.Close()
 
 	pdu := g.SnmpPDU{
-		Name:  ".1.3.6.1.6.3.1.1.4.1.0",
+		Name:  oids.SnmpTrapOID,
 		Type:  g.ObjectIdentifier,
-		Value: ".1.3.6.1.6.3.1.1.5.1",
+		Value: oids.ColdStart,
 	}
 
 	trap := g.SnmpTrap{
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	g "github.com/gosnmp/gosnmp"
+	"github.com/gosnmp/gosnmp/oids"
 )
 
 func main() {
@@ -42,9 +43,9 @@ func main() {
 	defer params.Conn.Close()
 
 	pdu := g.SnmpPDU{
-		Name:  ".1.3.6.1.6.3.1.1.4.1.0",
+		Name:  oids.SnmpTrapOID,
 		Type:  g.ObjectIdentifier,
-		Value: ".1.3.6.1.6.3.1.1.5.1",
+		Value: oids.ColdStart,
 	}
 
 	trap := g.SnmpTrap{
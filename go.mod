@@ -5,4 +5,5 @@ go 1.13
 require (
 	github.com/golang/mock v1.6.0
 	github.com/stretchr/testify v1.7.0
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -9,15 +9,22 @@
 package gosnmp
 
 import (
+	"bufio"
 	"context"
 	"crypto/rand"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"math/big"
 	"net"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
+
+	"github.com/gosnmp/gosnmp/oids"
 )
 
 const (
@@ -28,7 +35,7 @@ const (
 	MaxOids = 60
 
 	// Base OID for MIB-2 defined SNMP variables
-	baseOid = ".1.3.6.1.2.1"
+	baseOid = oids.MIB2
 
 	// Max oid sub-identifier value
 	// https://tools.ietf.org/html/rfc2578#section-7.1.3
@@ -37,11 +44,25 @@ const (
 	// Java SNMP uses 50, snmp-net uses 10
 	defaultMaxRepetitions = 50
 
+	// DefaultMaxOidLength is the default limit on the sub-identifiers of a
+	// received OID, the SMI maximum of 128 (RFC 2578).
+	DefaultMaxOidLength = 128
+
+	// DefaultMaxOidEncodedLength is the default limit on the encoded length
+	// of a received OID, enough for 128 sub-identifiers of up to 5 octets.
+	DefaultMaxOidEncodedLength = 640
+
 	// "udp" and "tcp" are used regularly, prevent 'goconst' complaints
-	udp = "udp"
-	tcp = "tcp"
+	udp           = "udp"
+	tcp           = "tcp"
+	tlsTransport  = "tls"
+	dtlsTransport = "dtlsudp"
 )
 
+// errDTLSLocalAddr is returned for a dtlsudp session with LocalAddr set,
+// which DTLSDialer has no way to honour.
+var errDTLSLocalAddr = errors.New("LocalAddr is not supported by the dtlsudp transport")
+
 // GoSNMP represents GoSNMP library state.
 type GoSNMP struct {
 	// Conn is net connection to use, typically established using GoSNMP.Connect().
@@ -53,7 +74,11 @@ type GoSNMP struct {
 	// Port is a port.
 	Port uint16
 
-	// Transport is the transport protocol to use ("udp" or "tcp"); if unset "udp" will be used.
+	// Transport is the transport protocol to use ("udp", "tcp", "tls" or "dtlsudp"); if unset "udp" will be used.
+	// "tcp" frames each message as a single BER encoded message (RFC 3430)
+	// and works with all versions, including SNMPv3.
+	// "tls" is SNMP over TLS and "dtlsudp" SNMP over DTLS (RFC 6353), both
+	// normally on port 10161 and used with the TransportSecurityModel.
 	Transport string
 
 	// Community is an SNMP Community string.
@@ -100,6 +125,32 @@ type GoSNMP struct {
 	// OnFinish is called when the request completed.
 	OnFinish func(*GoSNMP)
 
+	// OnExpire is called with the number of request IDs forgotten without
+	// an answer, see SessionStats.ExpiredCorrelations.
+	OnExpire func(*GoSNMP, int)
+
+	// OnEngineChange is called when an SNMPv3 response shows that the
+	// authoritative engine of the agent changed: a different engine ID, or
+	// an increased engine boots counter after a restart. It is called after
+	// the new parameters are stored, keys localized to the old engine ID
+	// are already replaced; use it to flag device restarts or flush caches
+	// keyed by engine.
+	OnEngineChange func(*GoSNMP, EngineChange)
+
+	// BeforeSend is called with each outgoing packet and its encoding just
+	// before it is written to the wire, and the returned bytes are sent
+	// instead. It allows device specific workarounds such as padding or
+	// nonstandard fields without forking. Note that changing an
+	// authenticated SNMPv3 message invalidates its digest.
+	BeforeSend func(*SnmpPacket, []byte) []byte
+
+	// AfterReceive is called with each incoming message before it is
+	// decoded, and the returned bytes are decoded instead. The packet is the
+	// request the message is expected to answer, or nil for traps and
+	// informs received by a TrapListener and for responses to asynchronous
+	// requests.
+	AfterReceive func(*SnmpPacket, []byte) []byte
+
 	// MaxOids is the maximum number of oids allowed in a Get().
 	// (default: MaxOids)
 	MaxOids int
@@ -114,12 +165,33 @@ type GoSNMP struct {
 	// (default: 0 as per RFC 1905)
 	NonRepeaters int
 
+	// MaxWalkQueue is the maximum number of walks waiting while another
+	// walk of the session is in progress, beyond which walks fail with
+	// ErrBusy. Walks of a session run one at a time in the order they were
+	// started. (default: 0, no limit)
+	MaxWalkQueue int
+
 	// UseUnconnectedUDPSocket if set, changes net.Conn to be unconnected UDP socket.
 	// Some multi-homed network gear isn't smart enough to send SNMP responses
 	// from the address it received the requests on. To work around that,
 	// we open unconnected UDP socket and use sendto/recvfrom.
 	UseUnconnectedUDPSocket bool
 
+	// TLSConfig is the TLS configuration used by the "tls" transport. Set
+	// Certificates for X.509 client authentication and RootCAs to verify the
+	// agent. If nil, a configuration verifying the agent against the system
+	// roots is used.
+	TLSConfig *tls.Config
+
+	// DTLSDialer opens the DTLS 1.2 association for the "dtlsudp" transport;
+	// network is "udp", "udp4" or "udp6". The standard library has no DTLS,
+	// so this is typically an adapter around a DTLS package that presents
+	// the client certificate the agent maps to a securityName. Each Read and
+	// Write on the returned conn must carry one whole SNMP message. ctx ends
+	// after Timeout, bounding the handshake. LocalAddr cannot be passed to
+	// the dialer and is rejected; bind the socket in the dialer instead.
+	DTLSDialer func(ctx context.Context, network, address string) (net.Conn, error)
+
 	// LocalAddr is the local address in the format "address:port" to use when connecting an Target address.
 	// If the port parameter is empty or "0", as in
 	// "127.0.0.1:" or "[::1]:0", a port number is automatically (random) chosen.
@@ -132,12 +204,105 @@ type GoSNMP struct {
 	// - 'p,i,I,t,E' -> pull requests welcome
 	AppOpts map[string]interface{}
 
+	// MaxOidLength limits the number of sub-identifiers of a received OID;
+	// if unset DefaultMaxOidLength is used, negative disables the check.
+	MaxOidLength int
+
+	// MaxOidEncodedLength limits the encoded length in bytes of a received
+	// OID; if unset DefaultMaxOidEncodedLength is used, negative disables
+	// the check.
+	MaxOidEncodedLength int
+
+	// MaxValueSize, if set, limits the size in bytes of the OCTET STRING
+	// and other octet values received: a larger value fails its request
+	// with a ValueSizeError, without retransmission, unless
+	// LargeValueHandler is set.
+	MaxValueSize int
+
+	// LargeValueHandler, if set, takes the values larger than MaxValueSize:
+	// they are written to the writer it returns and the Value of their
+	// SnmpPDU is a StreamedValue. It may be called for responses that are
+	// then discarded, e.g. as out of order.
+	LargeValueHandler LargeValueHandler
+
+	// Rand is the entropy source of the initial request and message IDs,
+	// SNMPv3 privacy salts and KeyChange values. If nil, crypto/rand.Reader
+	// is used. Set it to make tests deterministic or to route entropy through
+	// an approved source; it must be safe for concurrent use if the session
+	// is copied, e.g. by ForEngine.
+	Rand io.Reader
+
 	// Internal - used to sync requests to responses.
 	requestID uint32
 	random    uint32
 
 	rxBuf *[rxBufSize]byte // has to be pointer due to https://github.com/golang/go/issues/11728
 
+	// engines holds per context engine security state for ForEngine views,
+	// engineKey is the context engine of a view.
+	engines   *engineStates
+	engineKey string
+
+	// statsRoots are the roots of the walk in progress, see OIDStats
+	statsRoots []string
+
+	// timeliness tracks the clocks of authoritative engines, see
+	// TimelinessWindow
+	timeliness *timelinessState
+
+	// securityDowngrade records a downgrade, see AllowDowngradeTo
+	securityDowngrade *DowngradeError
+
+	// requestOpts are the options of all calls of a view, see WithOptions.
+	// They are never changed, the options of a call are passed with it.
+	requestOpts *requestOptions
+
+	// connLock serializes the requests of a session and its views, see
+	// WithOptions and WithPriority
+	connLock *priorityLock
+
+	// owner is the session a view was derived from, whose connection and
+	// engine state the view uses; nil for a session, see shared
+	owner *GoSNMP
+
+	// downgradedTo is 1 + the security level requests were downgraded to,
+	// or 0, see AllowDowngradeTo and msgFlags
+	downgradedTo uint32
+
+	// walkLock queues the walks of the session, see MaxWalkQueue
+	walkLock *priorityLock
+
+	// endpoint is the Endpoint the session is connected through, if any
+	endpoint *Endpoint
+
+	// correlationID identifies the operation holding the connection, for
+	// hooks, operationSeq numbers the operations of the session; see
+	// CorrelationID
+	correlationID string
+	operationSeq  uint32
+
+	// recentErrors keeps the last request errors, see DebugSnapshot
+	recentErrors *errorLog
+
+	// wireOp is the operation in progress retained by WireLog
+	wireOp *WireOperation
+
+	// async holds the dispatcher reading the responses of the asynchronous
+	// requests of the session and its views, see GetAsync
+	async *asyncSlot
+
+	// agentMsgMaxSize is the msgMaxSize advertised by the agent, see
+	// AgentMsgMaxSize
+	agentMsgMaxSize uint32
+
+	// pathMaxSize is the largest response that crossed the path to the
+	// target unfragmented, see PathMaxSize
+	pathMaxSize uint32
+
+	// rxStream buffers reads from rxStreamConn on stream transports
+	rxStream     *bufio.Reader
+	rxStreamConn net.Conn
+
 	// MsgFlags is an SNMPV3 MsgFlags.
 	MsgFlags SnmpV3MsgFlags
 
@@ -147,15 +312,117 @@ type GoSNMP struct {
 	// SecurityParameters is an SNMPV3 Security Model parameters struct.
 	SecurityParameters SnmpV3SecurityParameters
 
+	// AccessErrors, if set, makes requests answered with the error status
+	// noAccess, authorizationError or notWritable return an *AccessError
+	// along with the response, and walks fail with it rather than ending
+	// quietly. See AccessError.
+	AccessErrors bool
+
+	// OIDStats, if set, collects per OID statistics of the responses.
+	OIDStats *OIDStatsCollector
+
+	// SessionStats, if set, counts the requests, retries, timeouts and
+	// errors of the session.
+	SessionStats *SessionStatsCollector
+
+	// WireLog, if set, retains the exact bytes of the messages of the last
+	// operations of the session, see WireLog.
+	WireLog *WireLog
+
+	// UsmUsers, if set, supplies the USM credentials of inbound SNMPv3
+	// messages (traps, informs) by engine ID and user name, instead of
+	// SecurityParameters which then may be nil.
+	UsmUsers *UsmUserTable
+
+	// TimelinessWindow, if positive, enables replay protection of inbound
+	// authenticated SNMPv3 messages (responses, traps, informs): a message
+	// whose msgAuthoritativeEngineBoots is below the latest one received from
+	// its engine, or whose msgAuthoritativeEngineTime lags the engine's clock
+	// by more than the window, is rejected with a *TimelinessError. RFC 3414
+	// uses DefaultTimelinessWindow.
+	TimelinessWindow time.Duration
+
+	// ShortResponses selects how Get handles responses with fewer variables
+	// than requested, by default they are returned as received with the
+	// OIDs they lack in SnmpPacket.Missing; see ShortResponsePolicy to align
+	// them with the requested OIDs instead.
+	ShortResponses ShortResponsePolicy
+
+	// StrictAuthentication hardens SNMPv3 USM authentication: digests are
+	// compared in constant time, digests of the wrong length and failures
+	// while authenticating outgoing messages are returned as errors
+	// wrapping ErrWrongDigest or describing the failure, instead of being
+	// printed.
+	StrictAuthentication bool
+
+	// StrictBER rejects received responses and traps that are not encoded
+	// canonically, e.g. with non-minimal lengths or integers, with a
+	// *BERViolation naming the rule broken, see ValidateBER.
+	StrictBER bool
+
+	// AcceptDowngradedResponses disables the rejection of SNMPv3 responses
+	// sent at a lower security level than the request, e.g. unauthenticated
+	// responses to authenticated requests, which fail with a DowngradeError.
+	AcceptDowngradedResponses bool
+
+	// AllowDowngradeTo, if set, is the lowest security level the session may
+	// fall back to when the agent does not support MsgFlags, for lab use
+	// only. Requests the agent reports as unsupported are retransmitted at
+	// lower levels down to AllowDowngradeTo, lowering MsgFlags, and responses
+	// at such levels are accepted. Downgrades are logged and recorded, see
+	// SecurityDowngrade; without AllowDowngradeTo they fail with a
+	// DowngradeError.
+	AllowDowngradeTo *SnmpV3MsgFlags
+
 	// ContextEngineID is SNMPV3 ContextEngineID in ScopedPDU.
 	ContextEngineID string
 
 	// ContextName is SNMPV3 ContextName in ScopedPDU
 	ContextName string
 
+	// EngineCache, if set, is consulted for the authoritative engine
+	// parameters of the target before sending a discovery packet, and is
+	// updated from every SNMPv3 response. Share one cache between sessions
+	// to avoid re-discovering engines.
+	EngineCache EngineCache
+
+	// DiscoveryTimeout, if positive, bounds the SNMPv3 engine discovery
+	// preceding the first request, all its attempts included, so that a
+	// dead target costs at most DiscoveryTimeout rather than Timeout times
+	// Retries before the request even starts.
+	DiscoveryTimeout time.Duration
+
+	// DiscoveryFailureTTL, if positive, makes the EngineCache remember a
+	// failed discovery of the target for that long, if it is a
+	// DiscoveryFailureCache: the requests of the sessions sharing the
+	// cache then fail with ErrDiscoveryFailed without trying again.
+	DiscoveryFailureTTL time.Duration
+
+	// LocalEngine, if set, is the authoritative engine of the SNMPv3 traps
+	// sent by the session: their engine ID, boots and time, and the default
+	// contextEngineID, are those of LocalEngine rather than of
+	// SecurityParameters. Informs are not affected, their receiver is
+	// authoritative.
+	LocalEngine *LocalEngine
+
+	// MTUProbe, if set, attributes GetBulk requests that time out on every
+	// attempt while their response is expected to be larger than a common
+	// path MTU to IP fragmentation loss: the request is retried with
+	// max-repetitions, and the msgMaxSize advertised to SNMPv3 agents,
+	// clamped to the next smaller size, and the learned size is kept for the
+	// session, see PathMaxSize.
+	MTUProbe bool
+
+	// CapabilityCache, if set, shares what was learned about the target,
+	// such as its PathMaxSize, between sessions.
+	CapabilityCache CapabilityCache
+
 	// Internal - used to sync requests to responses - snmpv3.
 	msgID uint32
 
+	// Internal - result of the last engine discovery - snmpv3.
+	discovery *DiscoveryResult
+
 	// Internal - we use to send packets if using unconnected socket.
 	uaddr *net.UDPAddr
 }
@@ -289,7 +556,7 @@ func (x *GoSNMP) connect(networkSuffix string) error {
 	}
 
 	if x.random == 0 {
-		n, err := rand.Int(rand.Reader, big.NewInt(math.MaxInt32)) // returns a uniform random value in [0, 2147483647].
+		n, err := rand.Int(x.randReader(), big.NewInt(math.MaxInt32)) // returns a uniform random value in [0, 2147483647].
 		if err != nil {
 			return fmt.Errorf("error occurred while generating random: %w", err)
 		}
@@ -304,6 +571,7 @@ func (x *GoSNMP) connect(networkSuffix string) error {
 
 	x.rxBuf = new([rxBufSize]byte)
 
+	x.loadCapabilities()
 	return nil
 }
 
@@ -313,6 +581,10 @@ func (x *GoSNMP) netConnect() error {
 	var err error
 	var localAddr net.Addr
 	addr := net.JoinHostPort(x.Target, strconv.Itoa(int(x.Port)))
+	if x.endpoint != nil {
+		x.Conn, err = x.endpoint.dial(addr, x)
+		return err
+	}
 
 	switch x.Transport {
 	case "udp", "udp4", "udp6":
@@ -337,10 +609,76 @@ func (x *GoSNMP) netConnect() error {
 		if addr4 := localAddr.(*net.TCPAddr).IP.To4(); addr4 != nil {
 			x.Transport = "tcp4"
 		}
+	case "tls", "tls4", "tls6":
+		network := tcp + strings.TrimPrefix(x.Transport, tlsTransport)
+		if localAddr, err = net.ResolveTCPAddr(network, x.LocalAddr); err != nil {
+			return err
+		}
+		dialer := &net.Dialer{Timeout: x.Timeout, LocalAddr: localAddr}
+		x.Conn, err = tls.DialWithDialer(dialer, network, addr, x.tlsConfig())
+		return err
+	case "dtlsudp", "dtlsudp4", "dtlsudp6":
+		if x.DTLSDialer == nil {
+			return errors.New("the dtlsudp transport requires a DTLSDialer")
+		}
+		if x.LocalAddr != "" {
+			return errDTLSLocalAddr
+		}
+		ctx := x.Context
+		if x.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, x.Timeout)
+			defer cancel()
+		}
+		x.Conn, err = x.DTLSDialer(ctx, udp+strings.TrimPrefix(x.Transport, dtlsTransport), addr)
+		return err
 	}
 	dialer := net.Dialer{Timeout: x.Timeout, LocalAddr: localAddr}
 	x.Conn, err = dialer.DialContext(x.Context, x.Transport, addr)
-	return err
+	return wrapSocketError("dial", err)
+}
+
+func (x *GoSNMP) isTLSTransport() bool {
+	switch x.Transport {
+	case "tls", "tls4", "tls6":
+		return true
+	}
+	return false
+}
+
+func (x *GoSNMP) isDTLSTransport() bool {
+	return strings.HasPrefix(x.Transport, dtlsTransport)
+}
+
+// isStreamTransport reports whether messages are sent over a byte stream
+// rather than as datagrams.
+func (x *GoSNMP) isStreamTransport() bool {
+	return strings.HasPrefix(x.Transport, tcp) || x.isTLSTransport()
+}
+
+func (x *GoSNMP) tlsConfig() *tls.Config {
+	var config *tls.Config
+	if x.TLSConfig != nil {
+		config = x.TLSConfig.Clone()
+	} else {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" && !config.InsecureSkipVerify {
+		config.ServerName = x.Target
+	}
+	if config.MinVersion == 0 {
+		// RFC 6353 requires TLS 1.2 or later
+		config.MinVersion = tls.VersionTLS12
+	}
+	return config
+}
+
+// randReader returns the entropy source of the session.
+func (x *GoSNMP) randReader() io.Reader {
+	if x.Rand != nil {
+		return x.Rand
+	}
+	return rand.Reader
 }
 
 func (x *GoSNMP) validateParameters() error {
@@ -355,15 +693,22 @@ func (x *GoSNMP) validateParameters() error {
 	}
 
 	if x.Version == Version3 {
-		x.MsgFlags |= Reportable // tell the snmp server that a report PDU MUST be sent
+		x.MsgFlags = x.MsgFlags.WithReportable() // tell the snmp server that a report PDU MUST be sent
 
 		err := x.validateParametersV3()
 		if err != nil {
 			return err
 		}
-		err = x.SecurityParameters.init(x.Logger)
-		if err != nil {
-			return err
+		if usp, ok := x.SecurityParameters.(*UsmSecurityParameters); ok && x.Rand != nil {
+			usp.mu.Lock()
+			usp.rand = x.Rand
+			usp.mu.Unlock()
+		}
+		if x.SecurityParameters != nil {
+			err = x.SecurityParameters.init(x.Logger)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -374,29 +719,44 @@ func (x *GoSNMP) validateParameters() error {
 }
 
 func (x *GoSNMP) mkSnmpPacket(pdutype PDUType, pdus []SnmpPDU, nonRepeaters uint8, maxRepetitions uint32) *SnmpPacket {
+	return x.mkCallPacket(x.requestOpts, pdutype, pdus, nonRepeaters, maxRepetitions)
+}
+
+// mkCallPacket builds a request of a call with options o.
+func (x *GoSNMP) mkCallPacket(o *requestOptions, pdutype PDUType, pdus []SnmpPDU, nonRepeaters uint8, maxRepetitions uint32) *SnmpPacket {
 	var newSecParams SnmpV3SecurityParameters
 	if x.SecurityParameters != nil {
 		newSecParams = x.SecurityParameters.Copy()
 	}
+	if pdutype == GetBulkRequest {
+		maxRepetitions = x.capMaxRepetitions(pdus, nonRepeaters, maxRepetitions)
+	}
 	return &SnmpPacket{
 		Version:            x.Version,
-		Community:          x.Community,
-		MsgFlags:           x.MsgFlags,
+		Community:          x.community(o),
+		MsgFlags:           x.msgFlags(),
 		SecurityModel:      x.SecurityModel,
 		SecurityParameters: newSecParams,
-		ContextEngineID:    x.ContextEngineID,
-		ContextName:        x.ContextName,
+		ContextEngineID:    x.contextEngineID(o),
+		ContextName:        x.contextName(o),
 		Error:              0,
 		ErrorIndex:         0,
 		PDUType:            pdutype,
 		NonRepeaters:       nonRepeaters,
 		MaxRepetitions:     (maxRepetitions & 0x7FFFFFFF),
+		MsgMaxSize:         x.PathMaxSize(),
 		Variables:          pdus,
+		strictAuth:         x.StrictAuthentication,
+		opts:               o,
 	}
 }
 
 // Get sends an SNMP GET request
 func (x *GoSNMP) Get(oids []string) (result *SnmpPacket, err error) {
+	return x.get(x.requestOpts, oids)
+}
+
+func (x *GoSNMP) get(o *requestOptions, oids []string) (result *SnmpPacket, err error) {
 	oidCount := len(oids)
 	if oidCount > x.MaxOids {
 		return nil, fmt.Errorf("oid count (%d) is greater than MaxOids (%d)",
@@ -408,17 +768,25 @@ func (x *GoSNMP) Get(oids []string) (result *SnmpPacket, err error) {
 		pdus = append(pdus, SnmpPDU{Name: oid, Type: Null, Value: nil})
 	}
 	// build up SnmpPacket
-	packetOut := x.mkSnmpPacket(GetRequest, pdus, 0, 0)
-	return x.send(packetOut, true)
+	packetOut := x.mkCallPacket(o, GetRequest, pdus, 0, 0)
+	result, err = x.send(packetOut, true)
+	if err != nil || len(result.Variables) >= oidCount {
+		return result, err
+	}
+	return x.alignShortResponse(o, oids, result)
 }
 
 // Set sends an SNMP SET request
 func (x *GoSNMP) Set(pdus []SnmpPDU) (result *SnmpPacket, err error) {
+	return x.set(x.requestOpts, pdus)
+}
+
+func (x *GoSNMP) set(o *requestOptions, pdus []SnmpPDU) (result *SnmpPacket, err error) {
 	var packetOut *SnmpPacket
 	switch pdus[0].Type {
 	// TODO test Gauge32
 	case Integer, OctetString, Gauge32, IPAddress:
-		packetOut = x.mkSnmpPacket(SetRequest, pdus, 0, 0)
+		packetOut = x.mkCallPacket(o, SetRequest, pdus, 0, 0)
 	default:
 		return nil, fmt.Errorf("ERR:gosnmp currently only supports SNMP SETs for Integers, IPAddress and OctetStrings")
 	}
@@ -427,6 +795,10 @@ func (x *GoSNMP) Set(pdus []SnmpPDU) (result *SnmpPacket, err error) {
 
 // GetNext sends an SNMP GETNEXT request
 func (x *GoSNMP) GetNext(oids []string) (result *SnmpPacket, err error) {
+	return x.getNext(x.requestOpts, oids)
+}
+
+func (x *GoSNMP) getNext(o *requestOptions, oids []string) (result *SnmpPacket, err error) {
 	oidCount := len(oids)
 	if oidCount > x.MaxOids {
 		return nil, fmt.Errorf("oid count (%d) is greater than MaxOids (%d)",
@@ -440,7 +812,7 @@ func (x *GoSNMP) GetNext(oids []string) (result *SnmpPacket, err error) {
 	}
 
 	// Marshal and send the packet
-	packetOut := x.mkSnmpPacket(GetNextRequest, pdus, 0, 0)
+	packetOut := x.mkCallPacket(o, GetNextRequest, pdus, 0, 0)
 
 	return x.send(packetOut, true)
 }
@@ -449,6 +821,10 @@ func (x *GoSNMP) GetNext(oids []string) (result *SnmpPacket, err error) {
 //
 // For maxRepetitions greater than 255, use BulkWalk() or BulkWalkAll()
 func (x *GoSNMP) GetBulk(oids []string, nonRepeaters uint8, maxRepetitions uint32) (result *SnmpPacket, err error) {
+	return x.getBulk(x.requestOpts, oids, nonRepeaters, maxRepetitions)
+}
+
+func (x *GoSNMP) getBulk(o *requestOptions, oids []string, nonRepeaters uint8, maxRepetitions uint32) (result *SnmpPacket, err error) {
 	if x.Version == Version1 {
 		return nil, fmt.Errorf("GETBULK not supported in SNMPv1")
 	}
@@ -465,7 +841,7 @@ func (x *GoSNMP) GetBulk(oids []string, nonRepeaters uint8, maxRepetitions uint3
 	}
 
 	// Marshal and send the packet
-	packetOut := x.mkSnmpPacket(GetBulkRequest, pdus, nonRepeaters, maxRepetitions)
+	packetOut := x.mkCallPacket(o, GetBulkRequest, pdus, nonRepeaters, maxRepetitions)
 	return x.send(packetOut, true)
 }
 
@@ -561,7 +937,9 @@ func (x *GoSNMP) SetMsgID(msgID uint32) {
 //
 
 // WalkFunc is the type of the function called for each data unit visited
-// by the Walk function.  If an error is returned processing stops.
+// by the Walk function.  If an error is returned processing stops. Walks of
+// a session run one at a time, see MaxWalkQueue, so a WalkFunc must not
+// walk the session it is called by.
 type WalkFunc func(dataUnit SnmpPDU) error
 
 // BulkWalk retrieves a subtree of values using GETBULK. As the tree is
@@ -569,7 +947,9 @@ type WalkFunc func(dataUnit SnmpPDU) error
 // an error if either there is an underlaying SNMP error (e.g. GetBulk fails),
 // or if walkFn returns an error.
 func (x *GoSNMP) BulkWalk(rootOid string, walkFn WalkFunc) error {
-	return x.walk(GetBulkRequest, rootOid, walkFn)
+	return x.queueWalk(x.requestOpts, func() error {
+		return x.walk(x.requestOpts, GetBulkRequest, rootOid, walkFn)
+	})
 }
 
 // BulkWalkAll is similar to BulkWalk but returns a filled array of all values
@@ -577,7 +957,46 @@ func (x *GoSNMP) BulkWalk(rootOid string, walkFn WalkFunc) error {
 // have set x.AppOpts to 'c', BulkWalkAll may loop indefinitely and cause an
 // Out Of Memory - use BulkWalk instead.
 func (x *GoSNMP) BulkWalkAll(rootOid string) (results []SnmpPDU, err error) {
-	return x.walkAll(GetBulkRequest, rootOid)
+	err = x.queueWalk(x.requestOpts, func() error {
+		results, err = x.walkAll(x.requestOpts, GetBulkRequest, rootOid)
+		return err
+	})
+	return results, err
+}
+
+// BulkWalkColumns walks several subtrees, typically the columns of one table,
+// combining them as repeaters of shared GETBULK requests instead of walking
+// each column separately. Columns may end at different rows; a column is
+// dropped from later requests once it leaves its subtree. Values are passed
+// to walkFn as they arrive, interleaved between columns. MaxRepetitions is
+// divided between the columns of a request, and more than MaxOids columns are
+// walked in groups.
+func (x *GoSNMP) BulkWalkColumns(rootOids []string, walkFn WalkFunc) error {
+	return x.queueWalk(x.requestOpts, func() error {
+		return x.bulkWalkColumns(x.requestOpts, rootOids, walkFn)
+	})
+}
+
+// BulkWalkColumnsAll is similar to BulkWalkColumns but returns the values
+// of all columns, grouped by column in the order of rootOids.
+func (x *GoSNMP) BulkWalkColumnsAll(rootOids []string) (results []SnmpPDU, err error) {
+	columns := make([][]SnmpPDU, len(rootOids))
+	err = x.queueWalk(x.requestOpts, func() error {
+		return x.bulkWalkColumns(x.requestOpts, rootOids, func(dataUnit SnmpPDU) error {
+			for i, root := range rootOids {
+				root = walkRoot(root)
+				if dataUnit.Name == root || strings.HasPrefix(dataUnit.Name, root+".") {
+					columns[i] = append(columns[i], dataUnit)
+					break
+				}
+			}
+			return nil
+		})
+	})
+	for _, column := range columns {
+		results = append(results, column...)
+	}
+	return results, err
 }
 
 // Walk retrieves a subtree of values using GETNEXT - a request is made for each
@@ -586,7 +1005,9 @@ func (x *GoSNMP) BulkWalkAll(rootOid string) (results []SnmpPDU, err error) {
 // an error if either there is an underlaying SNMP error (e.g. GetNext fails),
 // or if walkFn returns an error.
 func (x *GoSNMP) Walk(rootOid string, walkFn WalkFunc) error {
-	return x.walk(GetNextRequest, rootOid, walkFn)
+	return x.queueWalk(x.requestOpts, func() error {
+		return x.walk(x.requestOpts, GetNextRequest, rootOid, walkFn)
+	})
 }
 
 // WalkAll is similar to Walk but returns a filled array of all values rather
@@ -594,7 +1015,11 @@ func (x *GoSNMP) Walk(rootOid string, walkFn WalkFunc) error {
 // x.AppOpts to 'c', WalkAll may loop indefinitely and cause an Out Of Memory -
 // use Walk instead.
 func (x *GoSNMP) WalkAll(rootOid string) (results []SnmpPDU, err error) {
-	return x.walkAll(GetNextRequest, rootOid)
+	err = x.queueWalk(x.requestOpts, func() error {
+		results, err = x.walkAll(x.requestOpts, GetNextRequest, rootOid)
+		return err
+	})
+	return results, err
 }
 
 //
@@ -671,3 +1096,100 @@ func ToBigInt(value interface{}) *big.Int {
 
 	return big.NewInt(val)
 }
+
+// DisplayString renders the value of the PDU following the display
+// conventions of net-snmp: printable octet strings as text and other octet
+// strings as hex, dotted OIDs, IP addresses as quads, TimeTicks as
+// "(ticks) d days, h:mm:ss.cc" and the exception types as their descriptions.
+// The raw decoded value remains available in Value.
+func (s SnmpPDU) DisplayString() string {
+	switch s.Type {
+	case OctetString, Opaque, BitString, NsapAddress:
+		var b []byte
+		switch v := s.Value.(type) {
+		case []byte:
+			b = v
+		case string:
+			b = []byte(v)
+		default:
+			return fmt.Sprint(s.Value)
+		}
+		if s.Type == OctetString && isPrintable(b) {
+			if b[len(b)-1] == 0 {
+				b = b[:len(b)-1]
+			}
+			return string(b)
+		}
+		return fmt.Sprintf("% X", b)
+	case ObjectIdentifier:
+		oid, ok := s.Value.(string)
+		if !ok {
+			return fmt.Sprint(s.Value)
+		}
+		if oid != "" && oid[0] != '.' {
+			return "." + oid
+		}
+		return oid
+	case IPAddress:
+		if s.Value == nil {
+			return ""
+		}
+		return fmt.Sprint(s.Value)
+	case TimeTicks:
+		ticks := ToBigInt(s.Value).Uint64()
+		return fmt.Sprintf("(%d) %s", ticks, formatTimeTicks(ticks))
+	case Integer, Counter32, Gauge32, Counter64, Uinteger32:
+		return ToBigInt(s.Value).String()
+	case OpaqueFloat:
+		if f, ok := s.Value.(float32); ok {
+			return strconv.FormatFloat(float64(f), 'f', -1, 32)
+		}
+	case OpaqueDouble:
+		if f, ok := s.Value.(float64); ok {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+	case Null:
+		return ""
+	case NoSuchObject:
+		return "No Such Object available on this agent at this OID"
+	case NoSuchInstance:
+		return "No Such Instance currently exists at this OID"
+	case EndOfMibView:
+		return "No more variables left in this MIB View (It is past the end of the MIB tree)"
+	}
+	if s.Value == nil {
+		return ""
+	}
+	return fmt.Sprint(s.Value)
+}
+
+// formatTimeTicks formats hundredths of a second as "d days, h:mm:ss.cc".
+func formatTimeTicks(ticks uint64) string {
+	days := ticks / 8640000
+	ticks %= 8640000
+	hms := fmt.Sprintf("%d:%02d:%02d.%02d", ticks/360000, ticks/6000%60, ticks/100%60, ticks%100)
+	switch days {
+	case 0:
+		return hms
+	case 1:
+		return "1 day, " + hms
+	}
+	return fmt.Sprintf("%d days, %s", days, hms)
+}
+
+// isPrintable reports whether b is non-empty text made of printable ASCII and
+// common whitespace, allowing a single trailing NUL as some agents send.
+func isPrintable(b []byte) bool {
+	if len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	if len(b) == 0 {
+		return false
+	}
+	for _, c := range b {
+		if (c < 0x20 || c > 0x7e) && c != '\t' && c != '\r' && c != '\n' {
+			return false
+		}
+	}
+	return true
+}
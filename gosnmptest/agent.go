@@ -0,0 +1,118 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+// Package gosnmptest provides an SNMP agent for the unit tests of polling
+// code, in the manner of net/http/httptest: it serves a static set of
+// variables on a loopback UDP port, so that tests need neither a device nor
+// a container:
+//
+//	agent := gosnmptest.NewAgent([]gosnmp.SnmpPDU{
+//		{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: []byte("router")},
+//	})
+//	defer agent.Close()
+//
+//	x := agent.Session(gosnmp.Version2c)
+//	if err := x.Connect(); err != nil {
+//		...
+//	}
+//	result, err := x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+package gosnmptest
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// DefaultCommunity is the community of the agents.
+const DefaultCommunity = "public"
+
+// Agent is an SNMP agent listening on a loopback UDP port.
+type Agent struct {
+	// Agent answers the requests. Its Users, Engine and VACM may be set
+	// before Start, e.g. to test SNMPv3 polling.
+	*gosnmp.Agent
+
+	// Vars are the variables served, which may be changed while the agent
+	// runs, e.g. with Vars.Static.
+	Vars *gosnmp.AgentVariables
+
+	// Target and Port are the address of the agent, set by Start.
+	Target string
+	Port   uint16
+
+	errch chan error
+}
+
+// NewAgent starts and returns an Agent serving vars with the community
+// DefaultCommunity. It panics if the agent cannot start. The caller should
+// call Close when finished, to shut it down.
+func NewAgent(vars []gosnmp.SnmpPDU) *Agent {
+	a := NewUnstartedAgent(vars)
+	a.Start()
+	return a
+}
+
+// NewUnstartedAgent returns an Agent serving vars, which is not started:
+// its Agent may be configured before Start is called.
+func NewUnstartedAgent(vars []gosnmp.SnmpPDU) *Agent {
+	v := gosnmp.NewAgentVariables()
+	for _, pdu := range vars {
+		if err := v.Static(pdu); err != nil {
+			panic(fmt.Sprintf("gosnmptest: variable %s: %v", pdu.Name, err))
+		}
+	}
+	a := &Agent{
+		Agent: gosnmp.NewAgent(),
+		Vars:  v,
+		errch: make(chan error, 1),
+	}
+	a.Agent.Params = &gosnmp.GoSNMP{Community: DefaultCommunity}
+	a.Agent.Handler = v
+	return a
+}
+
+// Start starts the agent on a loopback UDP port. It panics if the agent
+// cannot listen.
+func (a *Agent) Start() {
+	if a.Target != "" {
+		panic("gosnmptest: Agent already started")
+	}
+	go func() {
+		a.errch <- a.Agent.Listen("127.0.0.1:0")
+	}()
+	select {
+	case <-a.Agent.Listening():
+	case err := <-a.errch:
+		panic(fmt.Sprintf("gosnmptest: failed to listen: %v", err))
+	}
+	addr := a.Agent.LocalAddr().(*net.UDPAddr)
+	a.Target = addr.IP.String()
+	a.Port = uint16(addr.Port)
+}
+
+// Session returns a session of version querying the agent with its
+// community. It is not connected. SNMPv3 sessions are of the user
+// DefaultCommunity without authentication, which the Users of the Agent must
+// hold, or of the SecurityParameters set by the caller.
+func (a *Agent) Session(version gosnmp.SnmpVersion) *gosnmp.GoSNMP {
+	x := &gosnmp.GoSNMP{
+		Target:    a.Target,
+		Port:      a.Port,
+		Transport: "udp",
+		Community: a.Agent.Params.Community,
+		Version:   version,
+		Timeout:   time.Second,
+		Retries:   1,
+		MaxOids:   gosnmp.MaxOids,
+	}
+	if version == gosnmp.Version3 {
+		x.SecurityModel = gosnmp.UserSecurityModel
+		x.MsgFlags = gosnmp.NoAuthNoPriv
+		x.SecurityParameters = &gosnmp.UsmSecurityParameters{UserName: DefaultCommunity}
+	}
+	return x
+}
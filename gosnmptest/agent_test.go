@@ -0,0 +1,61 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmptest
+
+import (
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent(t *testing.T) {
+	agent := NewAgent([]gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: []byte("router")},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.1", Type: gosnmp.OctetString, Value: []byte("eth0")},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.2", Type: gosnmp.OctetString, Value: []byte("eth1")},
+	})
+	defer agent.Close()
+
+	x := agent.Session(gosnmp.Version2c)
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	result, err := x.Get([]string{".1.3.6.1.2.1.1.5.0", ".1.3.6.1.2.1.1.6.0"})
+	require.NoError(t, err)
+	require.Len(t, result.Variables, 2)
+	assert.Equal(t, []byte("router"), result.Variables[0].Value)
+	assert.Equal(t, gosnmp.NoSuchObject, result.Variables[1].Type)
+
+	pdus, err := x.BulkWalkAll(".1.3.6.1.2.1.2.2.1.2")
+	require.NoError(t, err)
+	require.Len(t, pdus, 2)
+	assert.Equal(t, []byte("eth1"), pdus[1].Value)
+
+	// the variables may change while the agent runs
+	require.NoError(t, agent.Vars.Static(gosnmp.SnmpPDU{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: []byte("switch")}))
+	result, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("switch"), result.Variables[0].Value)
+}
+
+func TestUnstartedAgentV3(t *testing.T) {
+	agent := NewUnstartedAgent([]gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: []byte("router")},
+	})
+	agent.Users = gosnmp.NewUsmUserTable()
+	require.NoError(t, agent.Users.Add(gosnmp.UsmUser{UserName: DefaultCommunity}))
+	agent.Start()
+	defer agent.Close()
+
+	x := agent.Session(gosnmp.Version3)
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	result, err := x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("router"), result.Variables[0].Value)
+}
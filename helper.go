@@ -34,6 +34,7 @@ var (
 	ErrFloatTooLarge           = errors.New("float too large")
 	ErrIntegerTooLarge         = errors.New("integer too large")
 	ErrInvalidOidLength        = errors.New("invalid OID length")
+	ErrOidTooLong              = errors.New("OID exceeds decoder limits")
 	ErrInvalidPacketLength     = errors.New("invalid packet length")
 	ErrZeroByteBuffer          = errors.New("zero byte buffer")
 )
@@ -117,7 +118,7 @@ func (x *GoSNMP) decodeValue(data []byte, retVal *variable) error {
 	case ObjectIdentifier:
 		// 0x06
 		x.Logger.Print("decodeValue: type is ObjectIdentifier")
-		rawOid, _, err := parseRawField(x.Logger, data, "OID")
+		rawOid, _, err := x.parseOIDField(data, "OID")
 		if err != nil {
 			return fmt.Errorf("error parsing OID Value: %w", err)
 		}
@@ -292,7 +293,9 @@ func (x *GoSNMP) decodeValue(data []byte, retVal *variable) error {
 		retVal.Type = UnknownType
 		retVal.Value = nil
 	}
-	x.Logger.Printf("decodeValue: value is %#v", retVal.Value)
+	x.Logger.PrintLazy(func() string {
+		return fmt.Sprintf("decodeValue: value is %#v", retVal.Value)
+	})
 	return nil
 }
 
@@ -368,10 +371,17 @@ func marshalInt32(value int) ([]byte, error) {
 		return rs, nil
 	}
 	if -2147483648 <= value && value < 0 {
-		value = ^value
+		// two's complement, without the redundant leading 0xff octets that
+		// ValidateBER rejects
 		binary.BigEndian.PutUint32(rs, uint32(value))
-		for k, v := range rs {
-			rs[k] = ^v
+		if value >= -0x80 {
+			return rs[3:], nil
+		}
+		if value >= -0x8000 {
+			return rs[2:], nil
+		}
+		if value >= -0x800000 {
+			return rs[1:], nil
 		}
 		return rs, nil
 	}
@@ -650,11 +660,78 @@ func parseObjectIdentifier(src []byte) (string, error) {
 	return out.String(), nil
 }
 
+// OidLimitError is returned when a received OID exceeds MaxOidLength or
+// MaxOidEncodedLength. It wraps ErrOidTooLong.
+type OidLimitError struct {
+	// Encoded is true if the encoded length, rather than the number of
+	// sub-identifiers, exceeded its limit.
+	Encoded bool
+	Length  int
+	Limit   int
+}
+
+func (e *OidLimitError) Error() string {
+	if e.Encoded {
+		return fmt.Sprintf("%s: encoded length %d exceeds %d bytes", ErrOidTooLong, e.Length, e.Limit)
+	}
+	return fmt.Sprintf("%s: %d sub-identifiers exceed %d", ErrOidTooLong, e.Length, e.Limit)
+}
+
+func (e *OidLimitError) Unwrap() error {
+	return ErrOidTooLong
+}
+
+// parseOIDField is parseRawField for an OBJECT IDENTIFIER, checking the
+// decoder limits before the OID string is built.
+func (x *GoSNMP) parseOIDField(data []byte, msg string) (interface{}, int, error) {
+	if len(data) > 0 && Asn1BER(data[0]) == ObjectIdentifier {
+		length, cursor, err := parseLength(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if length > len(data) {
+			return nil, 0, fmt.Errorf("not enough data for OID (%d vs %d): %x", length, len(data), data)
+		}
+		if err = x.checkOIDLimits(data[cursor:length]); err != nil {
+			return nil, 0, err
+		}
+	}
+	return parseRawField(x.Logger, data, msg)
+}
+
+func (x *GoSNMP) checkOIDLimits(src []byte) error {
+	maxEncoded := x.MaxOidEncodedLength
+	if maxEncoded == 0 {
+		maxEncoded = DefaultMaxOidEncodedLength
+	}
+	if maxEncoded > 0 && len(src) > maxEncoded {
+		return &OidLimitError{Encoded: true, Length: len(src), Limit: maxEncoded}
+	}
+	maxLen := x.MaxOidLength
+	if maxLen == 0 {
+		maxLen = DefaultMaxOidLength
+	}
+	if maxLen > 0 {
+		// every sub-identifier ends with an octet without the high bit
+		// set, and the first octet holds two sub-identifiers
+		subIDs := 1
+		for _, b := range src {
+			if b&0x80 == 0 {
+				subIDs++
+			}
+		}
+		if subIDs > maxLen {
+			return &OidLimitError{Length: subIDs, Limit: maxLen}
+		}
+	}
+	return nil
+}
+
 func parseRawField(logger Logger, data []byte, msg string) (interface{}, int, error) {
 	if len(data) == 0 {
 		return nil, 0, fmt.Errorf("empty data passed to parseRawField")
 	}
-	logger.Printf("parseRawField: %s", msg)
+	logger.PrintLazy(func() string { return "parseRawField: " + msg })
 	switch Asn1BER(data[0]) {
 	case Integer:
 		length, cursor, err := parseLength(data)
@@ -99,12 +99,14 @@ var testsMarshalInt32 = []struct {
 	{-2147483648, []byte{0x80, 0x00, 0x00, 0x00}},
 	{-16777217, []byte{0xfe, 0xff, 0xff, 0xff}},
 	{-16777216, []byte{0xff, 0x00, 0x00, 0x00}},
-	{-65537, []byte{0xff, 0xfe, 0xff, 0xff}},
-	{-65536, []byte{0xff, 0xff, 0x00, 0x00}},
-	{-257, []byte{0xff, 0xff, 0xfe, 0xff}},
-	{-256, []byte{0xff, 0xff, 0xff, 0x00}},
-	{-2, []byte{0xff, 0xff, 0xff, 0xfe}},
-	{-1, []byte{0xff, 0xff, 0xff, 0xff}},
+	{-65537, []byte{0xfe, 0xff, 0xff}},
+	{-65536, []byte{0xff, 0x00, 0x00}},
+	{-257, []byte{0xfe, 0xff}},
+	{-256, []byte{0xff, 0x00}},
+	{-129, []byte{0xff, 0x7f}},
+	{-128, []byte{0x80}},
+	{-2, []byte{0xfe}},
+	{-1, []byte{0xff}},
 }
 
 func TestMarshalInt32(t *testing.T) {
@@ -112,6 +114,9 @@ func TestMarshalInt32(t *testing.T) {
 		result, err := marshalInt32(aTest.value)
 		assert.NoErrorf(t, err, "value %d", aTest.value)
 		assert.EqualValues(t, aTest.goodBytes, result, "bad marshalInt32()")
+		parsed, err := parseInt(result)
+		assert.NoError(t, err)
+		assert.Equal(t, aTest.value, parsed, "marshalInt32() does not round trip")
 	}
 }
 
@@ -179,3 +184,80 @@ func checkByteEquality2(a, b []byte) bool {
 
 	return true
 }
+
+func TestDisplayString(t *testing.T) {
+	tests := []struct {
+		pdu      SnmpPDU
+		expected string
+	}{
+		{SnmpPDU{Type: OctetString, Value: []byte("Linux router 5.10")}, "Linux router 5.10"},
+		{SnmpPDU{Type: OctetString, Value: []byte("eth0\x00")}, "eth0"},
+		{SnmpPDU{Type: OctetString, Value: []byte{0x00, 0x50, 0x56, 0xa1, 0xb2, 0xc3}}, "00 50 56 A1 B2 C3"},
+		{SnmpPDU{Type: OctetString, Value: "text"}, "text"},
+		{SnmpPDU{Type: OctetString, Value: []byte{}}, ""},
+		{SnmpPDU{Type: ObjectIdentifier, Value: ".1.3.6.1.4.1.8072.3.2.10"}, ".1.3.6.1.4.1.8072.3.2.10"},
+		{SnmpPDU{Type: ObjectIdentifier, Value: "1.3.6.1"}, ".1.3.6.1"},
+		{SnmpPDU{Type: IPAddress, Value: "192.168.1.1"}, "192.168.1.1"},
+		{SnmpPDU{Type: IPAddress, Value: nil}, ""},
+		{SnmpPDU{Type: TimeTicks, Value: uint32(123456)}, "(123456) 0:20:34.56"},
+		{SnmpPDU{Type: TimeTicks, Value: uint32(8640000)}, "(8640000) 1 day, 0:00:00.00"},
+		{SnmpPDU{Type: TimeTicks, Value: uint32(4294967295)}, "(4294967295) 497 days, 2:27:52.95"},
+		{SnmpPDU{Type: Integer, Value: -42}, "-42"},
+		{SnmpPDU{Type: Counter32, Value: uint(3)}, "3"},
+		{SnmpPDU{Type: Counter64, Value: uint64(18446744073709551615)}, "18446744073709551615"},
+		{SnmpPDU{Type: OpaqueFloat, Value: float32(1.5)}, "1.5"},
+		{SnmpPDU{Type: OpaqueDouble, Value: float64(0.25)}, "0.25"},
+		{SnmpPDU{Type: Null}, ""},
+		{SnmpPDU{Type: NoSuchObject}, "No Such Object available on this agent at this OID"},
+		{SnmpPDU{Type: NoSuchInstance}, "No Such Instance currently exists at this OID"},
+		{SnmpPDU{Type: EndOfMibView}, "No more variables left in this MIB View (It is past the end of the MIB tree)"},
+	}
+	for i, test := range tests {
+		assert.Equal(t, test.expected, test.pdu.DisplayString(), "#%d %v", i, test.pdu.Type)
+	}
+}
+
+func TestOIDLimits(t *testing.T) {
+	// 1.3 followed by 200 sub-identifiers
+	deep := []byte{byte(ObjectIdentifier), 0x81, 201, 43}
+	for i := 0; i < 200; i++ {
+		deep = append(deep, 1)
+	}
+	x := &GoSNMP{Logger: NewLogger(nil)}
+
+	_, _, err := x.parseOIDField(deep, "OID")
+	assert.ErrorIs(t, err, ErrOidTooLong)
+	var limitErr *OidLimitError
+	if assert.ErrorAs(t, err, &limitErr) {
+		assert.False(t, limitErr.Encoded)
+		assert.Equal(t, 202, limitErr.Length)
+		assert.Equal(t, DefaultMaxOidLength, limitErr.Limit)
+	}
+
+	x.MaxOidLength = 256
+	oid, _, err := x.parseOIDField(deep, "OID")
+	assert.NoError(t, err)
+	assert.Len(t, oid, 2*202)
+
+	x.MaxOidEncodedLength = 100
+	_, _, err = x.parseOIDField(deep, "OID")
+	assert.ErrorAs(t, err, &limitErr)
+	assert.True(t, limitErr.Encoded)
+
+	x.MaxOidLength, x.MaxOidEncodedLength = -1, -1
+	_, _, err = x.parseOIDField(deep, "OID")
+	assert.NoError(t, err)
+
+	// a varbind name over the limit fails the whole packet
+	packet := &SnmpPacket{
+		Version:   Version2c,
+		Community: "public",
+		PDUType:   GetResponse,
+		Variables: []SnmpPDU{{Name: ".1.3.6.1.2.1.1.1.0.1.1.1.1.1.1", Type: Null}},
+	}
+	out, err := packet.MarshalMsg()
+	assert.NoError(t, err)
+	x = &GoSNMP{Logger: NewLogger(nil), MaxOidLength: 10}
+	_, err = x.SnmpDecodePacket(out)
+	assert.ErrorIs(t, err, ErrOidTooLong)
+}
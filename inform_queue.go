@@ -0,0 +1,301 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultInformRetryInterval is the time an InformQueue waits before
+	// retrying an unacknowledged inform when RetryInterval is unset.
+	DefaultInformRetryInterval = 10 * time.Second
+
+	// DefaultInformMaxRetryInterval bounds the doubling of the retry
+	// interval when MaxRetryInterval is unset.
+	DefaultInformMaxRetryInterval = 5 * time.Minute
+)
+
+// InformStore persists the informs spooled by an InformQueue until they are
+// acknowledged. Informs are identified by increasing sequence numbers and
+// stored as opaque encoded messages. Implementations must be safe for
+// concurrent use.
+type InformStore interface {
+	// Save stores the inform seq.
+	Save(seq uint64, inform []byte) error
+	// Delete removes the inform seq, which may already be gone.
+	Delete(seq uint64) error
+	// Load returns the stored informs by sequence number.
+	Load() (map[uint64][]byte, error)
+}
+
+// DirInformStore is an InformStore keeping each inform in a file of a
+// directory. Files are written atomically, a crash leaves no partial inform.
+type DirInformStore struct {
+	dir string
+}
+
+// informFileExt is the extension of the files of a DirInformStore.
+const informFileExt = ".inform"
+
+// NewDirInformStore returns an InformStore keeping informs in dir, which is
+// created if needed.
+func NewDirInformStore(dir string) (*DirInformStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &DirInformStore{dir: dir}, nil
+}
+
+func (s *DirInformStore) path(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, informFileExt))
+}
+
+// Save writes the inform seq to its file.
+func (s *DirInformStore) Save(seq uint64, inform []byte) error {
+	tmp, err := ioutil.TempFile(s.dir, ".spool.*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(inform); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(seq))
+}
+
+// Delete removes the file of the inform seq.
+func (s *DirInformStore) Delete(seq uint64) error {
+	err := os.Remove(s.path(seq))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Load reads the informs in the directory, ignoring other files.
+func (s *DirInformStore) Load() (map[uint64][]byte, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	informs := make(map[uint64][]byte)
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, informFileExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, informFileExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(s.dir, name))
+		if err != nil {
+			return nil, err
+		}
+		informs[seq] = data
+	}
+	return informs, nil
+}
+
+// InformQueue delivers informs over unreliable links: Enqueue spools each
+// inform to an InformStore and Run sends them in order with SendInform,
+// retrying until they are acknowledged, across restarts of the process if
+// the store is persistent.
+//
+//	store, err := gosnmp.NewDirInformStore("/var/spool/app/informs")
+//	q, err := gosnmp.NewInformQueue(session, store)
+//	go q.Run(ctx)
+//	err = q.Enqueue(gosnmp.SnmpTrap{TrapOID: linkDownOID, Variables: vars})
+//
+// An inform answered with an error status was received and is not retried.
+type InformQueue struct {
+	// RetryInterval is the wait before the first retry of an inform, doubled
+	// for each further retry up to MaxRetryInterval. Defaults to
+	// DefaultInformRetryInterval and DefaultInformMaxRetryInterval.
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+
+	// OnError, if set, is called with the inform and the error of each
+	// failed attempt.
+	OnError func(inform SnmpTrap, err error)
+
+	session *GoSNMP
+	store   InformStore
+	wake    chan struct{}
+
+	mu      sync.Mutex
+	pending []spooledInform
+	next    uint64
+}
+
+type spooledInform struct {
+	seq    uint64
+	inform SnmpTrap
+}
+
+// NewInformQueue returns a queue sending informs on the connected session
+// x, which must be Version2c or Version3, and loads the informs left
+// undelivered in store.
+func NewInformQueue(x *GoSNMP, store InformStore) (*InformQueue, error) {
+	if x.Version != Version2c && x.Version != Version3 {
+		return nil, fmt.Errorf("an InformQueue doesn't support %s", x.Version)
+	}
+	stored, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("error loading spooled informs: %w", err)
+	}
+	q := &InformQueue{session: x, store: store, wake: make(chan struct{}, 1), next: 1}
+	for seq, data := range stored {
+		inform, err := decodeSpooledInform(data)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding spooled inform %d: %w", seq, err)
+		}
+		q.pending = append(q.pending, spooledInform{seq: seq, inform: inform})
+		if seq >= q.next {
+			q.next = seq + 1
+		}
+	}
+	sort.Slice(q.pending, func(i, j int) bool { return q.pending[i].seq < q.pending[j].seq })
+	return q, nil
+}
+
+// Enqueue spools inform for delivery. The variables are completed as by
+// SendTrap when spooled, so sysUpTime.0 records when the event occurred
+// rather than when the inform was finally delivered.
+func (q *InformQueue) Enqueue(inform SnmpTrap) error {
+	if len(inform.Variables) == 0 && inform.TrapOID == "" {
+		return fmt.Errorf("an inform requires at least 1 PDU")
+	}
+	if inform.TrapOID != "" || inform.Variables[0].Type != TimeTicks {
+		uptime := inform.Uptime
+		if uptime == 0 {
+			uptime = uint32(time.Now().Unix())
+		}
+		vars := []SnmpPDU{{Name: sysUpTimeOID, Type: TimeTicks, Value: uptime}}
+		if inform.TrapOID != "" {
+			vars = append(vars, SnmpPDU{Name: snmpTrapOIDOID, Type: ObjectIdentifier, Value: inform.TrapOID})
+		}
+		inform = SnmpTrap{Variables: append(vars, inform.Variables...)}
+	} else {
+		inform = SnmpTrap{Variables: inform.Variables}
+	}
+	data, err := encodeSpooledInform(inform)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	seq := q.next
+	if err = q.store.Save(seq, data); err != nil {
+		return fmt.Errorf("error spooling inform: %w", err)
+	}
+	q.next++
+	q.pending = append(q.pending, spooledInform{seq: seq, inform: inform})
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Len returns the number of informs waiting for delivery.
+func (q *InformQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Run delivers the spooled informs, one at a time and in the order they
+// were enqueued, until ctx is done, returning ctx.Err(). Run must not be
+// called concurrently with itself or with other requests on the session.
+func (q *InformQueue) Run(ctx context.Context) error {
+	retry := q.RetryInterval
+	if retry <= 0 {
+		retry = DefaultInformRetryInterval
+	}
+	maxRetry := q.MaxRetryInterval
+	if maxRetry <= 0 {
+		maxRetry = DefaultInformMaxRetryInterval
+	}
+	wait := retry
+
+	for {
+		q.mu.Lock()
+		var head *spooledInform
+		if len(q.pending) > 0 {
+			head = &q.pending[0]
+		}
+		q.mu.Unlock()
+		if head == nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-q.wake:
+			}
+			continue
+		}
+
+		result, err := q.session.SendInform(head.inform)
+		if err != nil && q.OnError != nil {
+			q.OnError(head.inform, err)
+		}
+		if err != nil && (result == nil || result.PDUType != GetResponse) {
+			if err = sleepContext(ctx, wait); err != nil {
+				return err
+			}
+			if wait *= 2; wait > maxRetry {
+				wait = maxRetry
+			}
+			continue
+		}
+		wait = retry
+
+		if err = q.store.Delete(head.seq); err != nil && q.OnError != nil {
+			q.OnError(head.inform, fmt.Errorf("error removing delivered inform: %w", err))
+		}
+		q.mu.Lock()
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// encodeSpooledInform encodes the variables of inform as an SNMPv2c
+// InformRequest, keeping their types across restarts.
+func encodeSpooledInform(inform SnmpTrap) ([]byte, error) {
+	packet := &SnmpPacket{Version: Version2c, PDUType: InformRequest, Variables: inform.Variables}
+	data, err := packet.marshalMsg()
+	if err != nil {
+		return nil, fmt.Errorf("error encoding inform: %w", err)
+	}
+	return data, nil
+}
+
+func decodeSpooledInform(data []byte) (SnmpTrap, error) {
+	packet, err := (&GoSNMP{}).SnmpDecodePacket(data)
+	if err != nil {
+		return SnmpTrap{}, err
+	}
+	return SnmpTrap{Variables: packet.Variables}, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || trap
+// +build all trap
+
+package gosnmp
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// deadSession returns a session sending to a port nobody listens on.
+func deadSession(t *testing.T) *GoSNMP {
+	conn, err := net.ListenPacket("udp4", net.JoinHostPort(trapTestAddress, "0"))
+	require.NoError(t, err)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+	x := &GoSNMP{
+		Target:    trapTestAddress,
+		Port:      uint16(port),
+		Community: "public",
+		Version:   Version2c,
+		Timeout:   50 * time.Millisecond,
+		MaxOids:   MaxOids,
+		Logger:    NewLogger(log.New(ioutil.Discard, "", 0)),
+	}
+	require.NoError(t, x.Connect())
+	t.Cleanup(func() { x.Conn.Close() })
+	return x
+}
+
+func TestInformQueueRedelivery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "informs")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	store, err := NewDirInformStore(dir)
+	require.NoError(t, err)
+
+	// informs spooled while the manager is unreachable
+	q, err := NewInformQueue(deadSession(t), store)
+	require.NoError(t, err)
+	q.RetryInterval = 10 * time.Millisecond
+	failures := make(chan error, 10)
+	q.OnError = func(_ SnmpTrap, err error) {
+		select {
+		case failures <- err:
+		default:
+		}
+	}
+	require.NoError(t, q.Enqueue(SnmpTrap{TrapOID: ".1.3.6.1.6.3.1.1.5.3", Uptime: 42,
+		Variables: []SnmpPDU{{Name: ".1.3.6.1.2.1.2.2.1.1.2", Type: Integer, Value: 2}}}))
+	require.NoError(t, q.Enqueue(SnmpTrap{Variables: []SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "router"}}}))
+	assert.Equal(t, 2, q.Len())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- q.Run(ctx) }()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-failures:
+		case <-time.After(5 * time.Second):
+			t.Fatal("inform was not retried")
+		}
+	}
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	assert.Equal(t, 2, q.Len())
+
+	// a restarted process delivers them in order once the manager is back
+	received := make(chan *SnmpPacket, 2)
+	tl := NewTrapListener()
+	tl.OnNewTrap = func(packet *SnmpPacket, _ *net.UDPAddr) { received <- packet }
+	q, err = NewInformQueue(startTrapListener(t, tl), store)
+	require.NoError(t, err)
+	require.Equal(t, 2, q.Len())
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go func() { done <- q.Run(ctx) }()
+
+	first := <-received
+	assert.Equal(t, InformRequest, first.PDUType)
+	require.Len(t, first.Variables, 3)
+	assert.Equal(t, uint32(42), first.Variables[0].Value)
+	assert.Equal(t, ".1.3.6.1.6.3.1.1.5.3", first.Variables[1].Value)
+	assert.Equal(t, 2, first.Variables[2].Value)
+	second := <-received
+	require.Len(t, second.Variables, 2)
+	assert.Equal(t, TimeTicks, second.Variables[0].Type)
+	assert.Equal(t, []byte("router"), second.Variables[1].Value)
+
+	require.Eventually(t, func() bool { return q.Len() == 0 }, 5*time.Second, 10*time.Millisecond)
+	stored, err := store.Load()
+	require.NoError(t, err)
+	assert.Empty(t, stored)
+
+	// new informs wake the queue
+	require.NoError(t, q.Enqueue(SnmpTrap{TrapOID: ".1.3.6.1.6.3.1.1.5.4"}))
+	select {
+	case packet := <-received:
+		assert.Equal(t, ".1.3.6.1.6.3.1.1.5.4", packet.Variables[1].Value)
+	case <-time.After(5 * time.Second):
+		t.Fatal("enqueued inform was not delivered")
+	}
+}
+
+func TestInformQueueVersion(t *testing.T) {
+	_, err := NewInformQueue(&GoSNMP{Version: Version1}, nil)
+	assert.Error(t, err)
+}
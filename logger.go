@@ -11,3 +11,10 @@ func (l *Logger) Print(v ...interface{}) {
 
 func (l *Logger) Printf(format string, v ...interface{}) {
 }
+
+func (l *Logger) PrintLazy(fn func() string) {
+}
+
+func (l *Logger) enabled() bool {
+	return false
+}
@@ -3,14 +3,42 @@
 
 package gosnmp
 
+import (
+	"io/ioutil"
+	"log"
+)
+
 func (l *Logger) Print(v ...interface{}) {
-	if l.logger != nil {
+	if l.enabled() {
 		l.logger.Print(v...)
 	}
 }
 
 func (l *Logger) Printf(format string, v ...interface{}) {
-	if l.logger != nil {
+	if l.enabled() {
 		l.logger.Printf(format, v...)
 	}
 }
+
+// PrintLazy calls fn and logs the returned string only if the logger is
+// enabled. Use it for messages that are expensive to build, eg hex dumps of
+// whole packets, so that nothing is formatted when logging is off.
+func (l *Logger) PrintLazy(fn func() string) {
+	if l.enabled() {
+		l.logger.Print(fn())
+	}
+}
+
+// enabled reports whether anything logged will actually be written somewhere.
+func (l *Logger) enabled() bool {
+	switch logger := l.logger.(type) {
+	case nil:
+		return false
+	case LoggerEnabler:
+		return logger.Enabled()
+	case *log.Logger:
+		// the common log.New(ioutil.Discard, "", 0) idiom
+		return logger.Writer() != ioutil.Discard
+	}
+	return true
+}
@@ -0,0 +1,223 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// ErrManagerClosed is returned by the requests of a closed Manager.
+var ErrManagerClosed = errors.New("manager is closed")
+
+// Manager polls many targets through sessions it creates and connects on
+// first use and keeps, so that a poller of thousands of agents only names
+// them:
+//
+//	m := &gosnmp.Manager{Template: &gosnmp.GoSNMP{Community: "public", Version: gosnmp.Version2c, Port: 161, Timeout: 2 * time.Second, Retries: 1}, MaxConcurrent: 200}
+//	defer m.Close()
+//	for _, host := range hosts {
+//		go func(host string) {
+//			result, err := m.Get(host, []string{sysUpTime})
+//			...
+//		}(host)
+//	}
+//
+// Its methods are safe for concurrent use. Requests to one target are made
+// one at a time on its session, requests to different targets concurrently
+// up to MaxConcurrent. A request waits for its target, then for a global
+// slot, so requests queued behind a slow target never hold global slots,
+// and global slots are granted in the order they are asked for.
+type Manager struct {
+	// Template is copied, with its SecurityParameters, for the session of
+	// each target, its Target and Port replaced by those of the target.
+	// It is never connected.
+	Template *GoSNMP
+
+	// NewSession, if set, returns the unconnected session of target instead
+	// of a copy of Template, e.g. with the credentials of the target.
+	NewSession func(target string) (*GoSNMP, error)
+
+	// MaxConcurrent limits the requests in progress at once, 0 for no
+	// limit. Connecting a session counts as a request.
+	MaxConcurrent int
+
+	// Context, if set, bounds the waits for slots. Sessions keep the
+	// Context of Template.
+	Context context.Context
+
+	mu      sync.Mutex
+	targets map[string]*managedTarget
+	global  *fairSemaphore
+	closed  bool
+}
+
+// managedTarget is the session of a target of a Manager.
+type managedTarget struct {
+	// lock is held by the request using x, and while connecting it.
+	lock chan struct{}
+	x    *GoSNMP
+}
+
+// Do runs fn with the connected session of target, a host or host:port,
+// once it is the turn of target and there is a global slot. fn must not
+// keep the session.
+func (m *Manager) Do(target string, fn func(x *GoSNMP) error) error {
+	t, global, err := m.target(target)
+	if err != nil {
+		return err
+	}
+	ctx := m.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !acquire(ctx, t.lock) {
+		return ctx.Err()
+	}
+	defer release(t.lock)
+	if m.isClosed() {
+		return ErrManagerClosed
+	}
+	if global != nil {
+		if !global.acquire(ctx) {
+			return ctx.Err()
+		}
+		defer global.release()
+	}
+	if t.x == nil {
+		x, err := m.connect(target)
+		if err != nil {
+			return err
+		}
+		t.x = x
+	}
+	return fn(t.x)
+}
+
+// Get reads oids from target, see Do.
+func (m *Manager) Get(target string, oids []string) (result *SnmpPacket, err error) {
+	err = m.Do(target, func(x *GoSNMP) error {
+		result, err = x.Get(oids)
+		return err
+	})
+	return result, err
+}
+
+// Walk returns the subtree rootOid of target, read with BulkWalk, or Walk
+// for Version1, see Do.
+func (m *Manager) Walk(target, rootOid string) (results []SnmpPDU, err error) {
+	err = m.Do(target, func(x *GoSNMP) error {
+		if x.Version == Version1 {
+			results, err = x.WalkAll(rootOid)
+		} else {
+			results, err = x.BulkWalkAll(rootOid)
+		}
+		return err
+	})
+	return results, err
+}
+
+// Close waits for the requests in progress and closes the sessions. Later
+// requests fail with ErrManagerClosed.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	targets := m.targets
+	m.targets = nil
+	m.mu.Unlock()
+
+	var firstErr error
+	for _, t := range targets {
+		t.lock <- struct{}{}
+		if t.x != nil && t.x.Conn != nil {
+			if err := t.x.Conn.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		t.x = nil
+		<-t.lock
+	}
+	return firstErr
+}
+
+func (m *Manager) isClosed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closed
+}
+
+// target returns the entry of target, and the global slots.
+func (m *Manager) target(target string) (*managedTarget, *fairSemaphore, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, nil, ErrManagerClosed
+	}
+	if m.global == nil && m.MaxConcurrent > 0 {
+		m.global = newFairSemaphore(m.MaxConcurrent)
+	}
+	if m.targets == nil {
+		m.targets = make(map[string]*managedTarget)
+	}
+	t := m.targets[target]
+	if t == nil {
+		t = &managedTarget{lock: make(chan struct{}, 1)}
+		m.targets[target] = t
+	}
+	return t, m.global, nil
+}
+
+// connect returns the connected session of target. A failed connection is
+// retried by the next request.
+func (m *Manager) connect(target string) (*GoSNMP, error) {
+	var x *GoSNMP
+	if m.NewSession != nil {
+		var err error
+		if x, err = m.NewSession(target); err != nil {
+			return nil, err
+		}
+	} else {
+		if m.Template == nil {
+			return nil, errors.New("manager has neither Template nor NewSession")
+		}
+		c := *m.Template
+		if m.Template.SecurityParameters != nil {
+			c.SecurityParameters = m.Template.SecurityParameters.Copy()
+		}
+		host, port, err := splitTarget(target)
+		if err != nil {
+			return nil, err
+		}
+		c.Target = host
+		if port != 0 {
+			c.Port = port
+		}
+		x = &c
+	}
+	if x.Port == 0 {
+		x.Port = Default.Port
+	}
+	if err := x.Connect(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// splitTarget returns the host and port of target, port 0 if it has none.
+func splitTarget(target string) (string, uint16, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		// a bare host, or IPv6 address
+		return target, 0, nil
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return "", 0, errors.New("invalid port in target " + target)
+	}
+	return host, uint16(p), nil
+}
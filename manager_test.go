@@ -0,0 +1,144 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager(t *testing.T) {
+	vars := map[string]SnmpPDU{}
+	for _, pdu := range []SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: []byte("router")},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.1", Type: OctetString, Value: []byte("lo")},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.2", Type: OctetString, Value: []byte("eth0")},
+	} {
+		vars[pdu.Name] = pdu
+	}
+	var targets []string
+	for i := 0; i < 4; i++ {
+		a := NewAgent()
+		a.Handler = &testAgentHandler{vars: vars}
+		x := startAgent(t, a, Version2c, "public")
+		targets = append(targets, net.JoinHostPort(x.Target, strconv.Itoa(int(x.Port))))
+	}
+
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+	m := &Manager{
+		Template: &GoSNMP{
+			Community: "public",
+			Version:   Version2c,
+			Timeout:   time.Second,
+			PreSend: func(*GoSNMP) {
+				mu.Lock()
+				defer mu.Unlock()
+				inFlight++
+				if inFlight > maxInFlight {
+					maxInFlight = inFlight
+				}
+				time.Sleep(5 * time.Millisecond)
+			},
+			OnFinish: func(*GoSNMP) {
+				mu.Lock()
+				defer mu.Unlock()
+				inFlight--
+			},
+		},
+		MaxConcurrent: 2,
+	}
+
+	var wg sync.WaitGroup
+	for round := 0; round < 3; round++ {
+		for _, target := range targets {
+			wg.Add(2)
+			go func(target string) {
+				defer wg.Done()
+				result, err := m.Get(target, []string{".1.3.6.1.2.1.1.5.0"})
+				if assert.NoError(t, err) {
+					assert.Equal(t, []byte("router"), result.Variables[0].Value)
+				}
+			}(target)
+			go func(target string) {
+				defer wg.Done()
+				results, err := m.Walk(target, ".1.3.6.1.2.1.2.2.1.2")
+				if assert.NoError(t, err) {
+					assert.Len(t, results, 2)
+				}
+			}(target)
+		}
+	}
+	wg.Wait()
+
+	mu.Lock()
+	assert.Equal(t, 2, maxInFlight, "limited to MaxConcurrent")
+	mu.Unlock()
+	m.mu.Lock()
+	assert.Len(t, m.targets, len(targets), "one session per target")
+	m.mu.Unlock()
+
+	require.NoError(t, m.Close())
+	_, err := m.Get(targets[0], []string{".1.3.6.1.2.1.1.5.0"})
+	assert.True(t, errors.Is(err, ErrManagerClosed))
+}
+
+func TestManagerNewSession(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+	var requests int32
+	go bulkAgent(t, srvr, []SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "router"}}, &requests)
+
+	unavailable := errors.New("credentials unavailable")
+	sessions := 0
+	m := &Manager{NewSession: func(target string) (*GoSNMP, error) {
+		sessions++
+		if sessions == 1 {
+			return nil, unavailable
+		}
+		return &GoSNMP{
+			Target:    "127.0.0.1",
+			Port:      uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+			Community: "public",
+			Version:   Version2c,
+			Timeout:   time.Second,
+		}, nil
+	}}
+	defer m.Close()
+
+	_, err = m.Get("router", []string{".1.3.6.1.2.1.1.5.0"})
+	assert.Equal(t, unavailable, err)
+	for i := 0; i < 2; i++ {
+		_, err = m.Get("router", []string{".1.3.6.1.2.1.1.5.0"})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, sessions, "a failed session is retried, a connected one kept")
+}
+
+func TestSplitTarget(t *testing.T) {
+	host, port, err := splitTarget("192.0.2.1:1161")
+	require.NoError(t, err)
+	assert.Equal(t, "192.0.2.1", host)
+	assert.Equal(t, uint16(1161), port)
+
+	host, port, err = splitTarget("2001:db8::1")
+	require.NoError(t, err)
+	assert.Equal(t, "2001:db8::1", host)
+	assert.Equal(t, uint16(0), port)
+
+	_, _, err = splitTarget("router:snmp")
+	assert.Error(t, err)
+}
@@ -5,6 +5,7 @@
 package gosnmp
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/asn1"
@@ -17,6 +18,8 @@ import (
 	"strings"
 	"sync/atomic"
 	"time"
+
+	"github.com/gosnmp/gosnmp/oids"
 )
 
 //
@@ -56,6 +59,18 @@ type SnmpPacket struct {
 	Variables          []SnmpPDU
 	Logger             Logger
 
+	// Missing lists the requested OIDs a Get response lacked, whatever
+	// GoSNMP.ShortResponses is; it is nil for complete responses.
+	Missing []string
+
+	// strictAuth reports authentication failures as errors, see
+	// GoSNMP.StrictAuthentication
+	strictAuth bool
+
+	// opts are the options of the call sending the packet, see
+	// RequestOption
+	opts *requestOptions
+
 	// v1 traps have a very different format from v2c and v3 traps.
 	//
 	// These fields are set via the SnmpTrap parameter to SendTrap().
@@ -76,6 +91,20 @@ type SnmpTrap struct {
 	GenericTrap  int
 	SpecificTrap int
 	Timestamp    uint
+
+	// Uptime and TrapOID are the sysUpTime.0 and snmpTrapOID.0 of an SNMPv2
+	// notification. When sending, if TrapOID is set they are prepended to
+	// Variables, which must then not hold them.
+	//
+	// In a received trap or inform they are set for every version, along
+	// with Enterprise and AgentAddress from snmpTrapEnterprise.0 and
+	// snmpTrapAddress.0 if present, and SnmpTrap.Variables holds the other
+	// variables, so that the SnmpTrap of a received packet can be sent as
+	// is. The SnmpPacket.Variables of the packet still hold all of them. For
+	// an SNMPv1 Trap-PDU, Uptime is the time-stamp and TrapOID is derived
+	// from the header as per RFC 3584.
+	Uptime  uint32
+	TrapOID string
 }
 
 // VarBind struct represents an SNMP Varbind.
@@ -104,21 +133,23 @@ const (
 // SNMPv3: User-based Security Model Report PDUs and
 // error types as per https://tools.ietf.org/html/rfc3414
 const (
-	usmStatsUnsupportedSecLevels = ".1.3.6.1.6.3.15.1.1.1.0"
-	usmStatsNotInTimeWindows     = ".1.3.6.1.6.3.15.1.1.2.0"
-	usmStatsUnknownUserNames     = ".1.3.6.1.6.3.15.1.1.3.0"
-	usmStatsUnknownEngineIDs     = ".1.3.6.1.6.3.15.1.1.4.0"
-	usmStatsWrongDigests         = ".1.3.6.1.6.3.15.1.1.5.0"
-	usmStatsDecryptionErrors     = ".1.3.6.1.6.3.15.1.1.6.0"
-	snmpUnknownSecurityModels    = ".1.3.6.1.6.3.11.2.1.1.0"
-	snmpInvalidMsgs              = ".1.3.6.1.6.3.11.2.1.2.0"
-	snmpUnknownPDUHandlers       = ".1.3.6.1.6.3.11.2.1.3.0"
+	usmStatsUnsupportedSecLevels = oids.UsmStatsUnsupportedSecLevels
+	usmStatsNotInTimeWindows     = oids.UsmStatsNotInTimeWindows
+	usmStatsUnknownUserNames     = oids.UsmStatsUnknownUserNames
+	usmStatsUnknownEngineIDs     = oids.UsmStatsUnknownEngineIDs
+	usmStatsWrongDigests         = oids.UsmStatsWrongDigests
+	usmStatsDecryptionErrors     = oids.UsmStatsDecryptionErrors
+	snmpUnknownSecurityModels    = oids.SnmpUnknownSecurityModels
+	snmpInvalidMsgs              = oids.SnmpInvalidMsgs
+	snmpUnknownPDUHandlers       = oids.SnmpUnknownPDUHandlers
 )
 
 var (
 	ErrDecryption            = errors.New("decryption error")
 	ErrInvalidMsgs           = errors.New("invalid messages")
+	ErrMissingPDU            = errors.New("message has no pdu")
 	ErrNotInTimeWindow       = errors.New("not in time window")
+	ErrTrailingData          = errors.New("trailing data after message")
 	ErrUnknownEngineID       = errors.New("unknown engine id")
 	ErrUnknownPDUHandlers    = errors.New("unknown pdu handlers")
 	ErrUnknownReportPDU      = errors.New("unknown report pdu")
@@ -128,6 +159,64 @@ var (
 	ErrWrongDigest           = errors.New("wrong digest")
 )
 
+// ReportError is returned when an agent answers a request with a Report PDU,
+// e.g. usmStatsWrongDigests for bad credentials, usmStatsNotInTimeWindows
+// for time skew or usmStatsUnknownUserNames for an unknown user. It wraps
+// the sentinel error for the report, so errors.Is(err, ErrWrongDigest) can be
+// used to distinguish them, and errors.As gives access to the details. The
+// sentinels used to be returned bare: comparisons such as
+// err == ErrUnknownUsername no longer match and must use errors.Is.
+type ReportError struct {
+	// OID is the name of the reported counter.
+	OID string
+
+	// Counter is the value of the reported counter.
+	Counter uint32
+
+	// Err is the sentinel error for OID, e.g. ErrWrongDigest.
+	Err error
+
+	// CorrelationID identifies the operation of the request, see
+	// GoSNMP.CorrelationID.
+	CorrelationID string
+}
+
+func (e *ReportError) Error() string {
+	return fmt.Sprintf("%v (report %s = %d)", e.Err, e.OID, e.Counter)
+}
+
+// Unwrap returns the sentinel error for the report.
+func (e *ReportError) Unwrap() error {
+	return e.Err
+}
+
+// reportErrors maps report OIDs to their sentinel errors
+//nolint:gochecknoglobals
+var reportErrors = map[string]error{
+	usmStatsUnsupportedSecLevels: ErrUnknownSecurityLevel,
+	usmStatsNotInTimeWindows:     ErrNotInTimeWindow,
+	usmStatsUnknownUserNames:     ErrUnknownUsername,
+	usmStatsUnknownEngineIDs:     ErrUnknownEngineID,
+	usmStatsWrongDigests:         ErrWrongDigest,
+	usmStatsDecryptionErrors:     ErrDecryption,
+	snmpUnknownSecurityModels:    ErrUnknownSecurityModels,
+	snmpInvalidMsgs:              ErrInvalidMsgs,
+	snmpUnknownPDUHandlers:       ErrUnknownPDUHandlers,
+}
+
+// newReportError returns the ReportError for a single variable Report PDU.
+func newReportError(packet *SnmpPacket) *ReportError {
+	e := &ReportError{Err: ErrUnknownReportPDU}
+	if len(packet.Variables) > 0 {
+		e.OID = packet.Variables[0].Name
+		e.Counter = uint32(ToBigInt(packet.Variables[0].Value).Uint64())
+		if err, ok := reportErrors[e.OID]; ok {
+			e.Err = err
+		}
+	}
+	return e
+}
+
 const rxBufSize = 65535 // max size of IPv4 & IPv6 packet
 
 // Logger is an interface used for debugging. Both Print and
@@ -144,6 +233,13 @@ type LoggerInterface interface {
 	Printf(format string, v ...interface{})
 }
 
+// LoggerEnabler can optionally be implemented by a LoggerInterface. When
+// Enabled returns false gosnmp skips building log messages altogether, which
+// saves the formatting cost in hot paths for loggers that discard output.
+type LoggerEnabler interface {
+	Enabled() bool
+}
+
 type Logger struct {
 	logger LoggerInterface
 }
@@ -158,10 +254,20 @@ func NewLogger(logger LoggerInterface) Logger {
 // send/receive one snmp request
 func (x *GoSNMP) sendOneRequest(packetOut *SnmpPacket,
 	wait bool) (result *SnmpPacket, err error) {
-	allReqIDs := make([]uint32, 0, x.Retries+1)
-	// allMsgIDs := make([]uint32, 0, x.Retries+1) // unused
-
-	timeout := x.Timeout
+	// The request IDs of all attempts are correlated with responses for the
+	// duration of this call only; late responses to them are discarded by
+	// later calls as out of order.
+	o := packetOut.opts
+	logger := x.callLogger(o)
+	maxRetries := x.retries(o)
+	s := x.shared()
+	allReqIDs := make([]uint32, 0, maxRetries+1)
+	// allMsgIDs := make([]uint32, 0, maxRetries+1) // unused
+	var trace RequestTrace
+	defer func() { x.SessionStats.record(trace, result, err) }()
+	attempt := -1
+
+	timeout := x.timeout(o)
 	withContextDeadline := false
 	for retries := 0; ; retries++ {
 		if retries > 0 {
@@ -169,18 +275,18 @@ func (x *GoSNMP) sendOneRequest(packetOut *SnmpPacket,
 				x.OnRetry(x)
 			}
 
-			x.Logger.Printf("Retry number %d. Last error was: %v", retries, err)
+			logger.Printf("Retry number %d. Last error was: %v", retries, err)
 			if withContextDeadline && strings.Contains(err.Error(), "timeout") {
 				err = context.DeadlineExceeded
 				break
 			}
-			if retries > x.Retries {
+			if retries > maxRetries {
 				if strings.Contains(err.Error(), "timeout") {
 					err = fmt.Errorf("request timeout (after %d retries)", retries-1)
 				}
 				break
 			}
-			if x.ExponentialTimeout {
+			if x.exponentialTimeout(o) {
 				// https://www.webnms.com/snmp/help/snmpapi/snmpv3/v1/timeout.html
 				timeout *= 2
 			}
@@ -188,19 +294,24 @@ func (x *GoSNMP) sendOneRequest(packetOut *SnmpPacket,
 		}
 		err = nil
 
-		if x.Context.Err() != nil {
-			return nil, x.Context.Err()
+		ctx := x.callContext(o)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
 		}
 
 		reqDeadline := time.Now().Add(timeout)
-		if contextDeadline, ok := x.Context.Deadline(); ok {
+		if contextDeadline, ok := ctx.Deadline(); ok {
 			if contextDeadline.Before(reqDeadline) {
 				reqDeadline = contextDeadline
 				withContextDeadline = true
 			}
 		}
+		if callDeadline, ok := o.callDeadline(); ok && callDeadline.Before(reqDeadline) {
+			reqDeadline = callDeadline
+			withContextDeadline = true
+		}
 
-		err = x.Conn.SetDeadline(reqDeadline)
+		err = s.Conn.SetDeadline(reqDeadline)
 		if err != nil {
 			return nil, err
 		}
@@ -234,20 +345,33 @@ func (x *GoSNMP) sendOneRequest(packetOut *SnmpPacket,
 			err = fmt.Errorf("marshal: %w", err)
 			break
 		}
+		if err = x.checkMsgMaxSize(outBuf); err != nil {
+			break
+		}
 
 		if x.PreSend != nil {
 			x.PreSend(x)
 		}
-		x.Logger.Printf("SENDING PACKET: %#+v", *packetOut)
+		if x.BeforeSend != nil {
+			outBuf = x.BeforeSend(packetOut, outBuf)
+		}
+		logger.PrintLazy(func() string {
+			return fmt.Sprintf("SENDING PACKET: %#+v", *packetOut)
+		})
 		// If using UDP and unconnected socket, send packet directly to stored address.
-		if uconn, ok := x.Conn.(net.PacketConn); ok && x.uaddr != nil {
-			_, err = uconn.WriteTo(outBuf, x.uaddr)
+		if uconn, ok := s.Conn.(net.PacketConn); ok && s.uaddr != nil {
+			_, err = uconn.WriteTo(outBuf, s.uaddr)
 		} else {
-			_, err = x.Conn.Write(outBuf)
+			_, err = s.Conn.Write(outBuf)
 		}
+		attempt++
 		if err != nil {
+			err = wrapSocketError("write", err)
+			trace.record(attempt, AttemptSendError, reqID, err)
 			continue
 		}
+		x.recordWireMessage(CaptureSent, outBuf)
+		trace.sent(attempt, reqID, reqDeadline)
 		if x.OnSent != nil {
 			x.OnSent(x)
 		}
@@ -259,17 +383,18 @@ func (x *GoSNMP) sendOneRequest(packetOut *SnmpPacket,
 
 	waitingResponse:
 		for {
-			x.Logger.Print("WAITING RESPONSE...")
+			logger.Print("WAITING RESPONSE...")
 			// Receive response and try receiving again on any decoding error.
 			// Let the deadline abort us if we don't receive a valid response.
 
 			var resp []byte
 			resp, err = x.receive()
-			if err == io.EOF && strings.HasPrefix(x.Transport, tcp) {
+			if err == io.EOF && x.isStreamTransport() {
 				// EOF on TCP: reconnect and retry. Do not count
 				// as retry as socket was broken
-				x.Logger.Printf("ERROR: EOF. Performing reconnect")
-				err = x.netConnect()
+				logger.Printf("ERROR: EOF. Performing reconnect")
+				trace.record(attempt, AttemptReconnect, reqID, err)
+				err = s.netConnect()
 				if err != nil {
 					return nil, err
 				}
@@ -277,53 +402,53 @@ func (x *GoSNMP) sendOneRequest(packetOut *SnmpPacket,
 				break
 			} else if err != nil {
 				// receive error. retrying won't help. abort
+				err = wrapSocketError("read", err)
+				trace.record(attempt, AttemptReceiveError, reqID, err)
+				if x.isStreamTransport() {
+					// a partly read message leaves the stream out of step
+					// with message boundaries, resume on a new connection
+					if cerr := x.reconnectStream(); cerr != nil {
+						return nil, cerr
+					}
+				}
 				break
 			}
+			x.recordWireMessage(CaptureReceived, resp)
 			if x.OnRecv != nil {
 				x.OnRecv(x)
 			}
-			x.Logger.Printf("GET RESPONSE OK: %+v", resp)
+			if x.AfterReceive != nil {
+				resp = x.AfterReceive(packetOut, resp)
+			}
+			logger.PrintLazy(func() string {
+				return fmt.Sprintf("GET RESPONSE OK: %+v", resp)
+			})
 			result = new(SnmpPacket)
-			result.Logger = x.Logger
+			result.Logger = *logger
 
 			result.MsgFlags = packetOut.MsgFlags
 			if packetOut.SecurityParameters != nil {
 				result.SecurityParameters = packetOut.SecurityParameters.Copy()
 			}
 
-			var cursor int
-			cursor, err = x.unmarshalHeader(resp, result)
+			err = x.decodeResponse(resp, result, logger)
 			if err != nil {
-				x.Logger.Printf("ERROR on unmarshall header: %s", err)
+				trace.record(attempt, AttemptDecodeError, reqID, err)
+				if errors.Is(err, ErrValueTooLarge) {
+					// a retransmission would fetch the same value
+					return nil, &RequestError{Err: err, Trace: trace}
+				}
 				break
 			}
-
 			if x.Version == Version3 {
-				useResponseSecurityParameters := false
-				if usp, ok := x.SecurityParameters.(*UsmSecurityParameters); ok {
-					if usp.AuthoritativeEngineID == "" {
-						useResponseSecurityParameters = true
-					}
-				}
-				err = x.testAuthentication(resp, result, useResponseSecurityParameters)
-				if err != nil {
-					x.Logger.Printf("ERROR on Test Authentication on v3: %s", err)
+				if err = x.checkDowngrade(packetOut, result); err != nil {
+					logger.Printf("ERROR on v3 response: %s", err)
+					trace.record(attempt, AttemptDecodeError, reqID, err)
 					break
 				}
-				resp, cursor, err = x.decryptPacket(resp, cursor, result)
-				if err != nil {
-					x.Logger.Printf("ERROR on decryptPacket on v3: %s", err)
-					break
-				}
-			}
-
-			err = x.unmarshalPayload(resp, cursor, result)
-			if err != nil {
-				x.Logger.Printf("ERROR on UnmarshalPayload on v3: %s", err)
-				break
 			}
 			if result.Error == NoError && len(result.Variables) < 1 {
-				x.Logger.Printf("ERROR on UnmarshalPayload on v3: Empty result")
+				logger.Printf("ERROR on UnmarshalPayload on v3: Empty result")
 				break
 			}
 
@@ -346,26 +471,10 @@ func (x *GoSNMP) sendOneRequest(packetOut *SnmpPacket,
 			// and will be retransmitted, for others we return the result with an error.
 			if result.Version == Version3 && result.PDUType == Report && len(result.Variables) == 1 {
 				switch result.Variables[0].Name {
-				case usmStatsUnsupportedSecLevels:
-					return result, ErrUnknownSecurityLevel
-				case usmStatsNotInTimeWindows:
-					break waitingResponse
-				case usmStatsUnknownUserNames:
-					return result, ErrUnknownUsername
-				case usmStatsUnknownEngineIDs:
+				case usmStatsNotInTimeWindows, usmStatsUnknownEngineIDs:
 					break waitingResponse
-				case usmStatsWrongDigests:
-					return result, ErrWrongDigest
-				case usmStatsDecryptionErrors:
-					return result, ErrDecryption
-				case snmpUnknownSecurityModels:
-					return result, ErrUnknownSecurityModels
-				case snmpInvalidMsgs:
-					return result, ErrInvalidMsgs
-				case snmpUnknownPDUHandlers:
-					return result, ErrUnknownPDUHandlers
 				default:
-					return result, ErrUnknownReportPDU
+					return result, newReportError(result)
 				}
 			}
 
@@ -379,7 +488,8 @@ func (x *GoSNMP) sendOneRequest(packetOut *SnmpPacket,
 				validID = true
 			}
 			if !validID {
-				x.Logger.Print("ERROR out of order")
+				logger.Print("ERROR out of order")
+				trace.record(attempt, AttemptOutOfOrder, reqID, fmt.Errorf("unexpected request ID %d", result.RequestID))
 				continue
 			}
 
@@ -397,13 +507,71 @@ func (x *GoSNMP) sendOneRequest(packetOut *SnmpPacket,
 	}
 
 	// Return last error
+	if err != nil {
+		err = &RequestError{Err: err, Trace: trace}
+	}
 	return nil, err
 }
 
+// decodeResponse decodes the response resp into result, whose MsgFlags and
+// SecurityParameters are those of the request, validating its encoding when
+// StrictBER is set and, for SNMPv3, authenticating and decrypting it. It is
+// the decoding shared by synchronous and asynchronous requests.
+func (x *GoSNMP) decodeResponse(resp []byte, result *SnmpPacket, logger *Logger) error {
+	if x.StrictBER {
+		if err := ValidateBER(resp); err != nil {
+			logger.Printf("ERROR on response encoding: %s", err)
+			return err
+		}
+	}
+
+	cursor, err := x.unmarshalHeader(resp, result)
+	if err != nil {
+		logger.Printf("ERROR on unmarshall header: %s", err)
+		return err
+	}
+
+	if x.Version == Version3 {
+		useResponseSecurityParameters := false
+		if usp, ok := x.SecurityParameters.(*UsmSecurityParameters); ok {
+			if usp.getDefaultContextEngineID() == "" {
+				useResponseSecurityParameters = true
+			}
+		}
+		err = x.testAuthentication(resp, result, useResponseSecurityParameters)
+		if err != nil {
+			logger.Printf("ERROR on Test Authentication on v3: %s", err)
+			return err
+		}
+		if err = x.checkTimeliness(result); err != nil {
+			logger.Printf("ERROR on timeliness check on v3: %s", err)
+			return err
+		}
+		resp, cursor, err = x.decryptPacket(resp, cursor, result)
+		if err != nil {
+			logger.Printf("ERROR on decryptPacket on v3: %s", err)
+			return err
+		}
+	}
+
+	if err = x.unmarshalPayload(resp, cursor, result); err != nil {
+		logger.Printf("ERROR on UnmarshalPayload on v3: %s", err)
+		return err
+	}
+	return nil
+}
+
 // generic "sender" that negotiate any version of snmp request
 //
 // all sends wait for the return packet, except for SNMPv2Trap
 func (x *GoSNMP) send(packetOut *SnmpPacket, wait bool) (result *SnmpPacket, err error) {
+	o := x.beginOperation(packetOut.opts)
+	packetOut.opts = o
+	logger := x.callLogger(o)
+	defer x.lockConn(o)()
+	defer x.holdOperation(o)()
+	endWireOperation := x.beginWireOperation(packetOut)
+	defer func() { endWireOperation(err) }()
 	defer func() {
 		if e := recover(); e != nil {
 			var buf = make([]byte, 8192)
@@ -411,68 +579,117 @@ func (x *GoSNMP) send(packetOut *SnmpPacket, wait bool) (result *SnmpPacket, err
 
 			err = fmt.Errorf("recover: %v Stack:%v", e, string(buf))
 		}
+		if err != nil {
+			annotateError(o, err)
+			x.recordError(err)
+		}
 	}()
 
-	if x.Conn == nil {
+	if x.shared().Conn == nil {
 		return nil, fmt.Errorf("&GoSNMP.Conn is missing. Provide a connection or use Connect()")
 	}
-
-	if x.Retries < 0 {
-		x.Retries = 0
+	if x.isAsync() {
+		return nil, ErrAsyncMode
 	}
-	x.Logger.Print("SEND INIT")
+
+	logger.Print("SEND INIT")
 	if packetOut.Version == Version3 {
-		x.Logger.Print("SEND INIT NEGOTIATE SECURITY PARAMS")
+		if x.SecurityParameters == nil {
+			return nil, errors.New("SNMPV3 SecurityParameters must be set to send")
+		}
+		logger.Print("SEND INIT NEGOTIATE SECURITY PARAMS")
 		if err = x.negotiateInitialSecurityParameters(packetOut); err != nil {
 			return &SnmpPacket{}, err
 		}
-		x.Logger.Print("SEND END NEGOTIATE SECURITY PARAMS")
+		logger.Print("SEND END NEGOTIATE SECURITY PARAMS")
+	}
+
+	if x.OIDStats != nil {
+		start := time.Now()
+		defer func() {
+			if err == nil && result != nil && result.PDUType == GetResponse {
+				x.OIDStats.record(x.statsRoots, result.Variables, time.Since(start))
+			}
+		}()
 	}
 
 	// perform request
 	result, err = x.sendOneRequest(packetOut, wait)
+	if err != nil && packetOut.Version == Version3 && errors.Is(err, ErrUnknownSecurityLevel) {
+		result, err = x.downgradeRequest(packetOut, wait, result, err)
+	}
+	if err != nil && x.MTUProbe {
+		result, err = x.probePathMaxSize(packetOut, wait, result, err)
+	}
 	if err != nil {
-		x.Logger.Printf("SEND Error on the first Request Error: %s", err)
+		logger.Printf("SEND Error on the first Request Error: %s", err)
 		return result, err
 	}
 
 	if result.Version == Version3 {
-		x.Logger.Printf("SEND STORE SECURITY PARAMS from result: %+v", result)
-		err = x.storeSecurityParameters(result)
-
-		if result.PDUType == Report && len(result.Variables) == 1 {
-			switch result.Variables[0].Name {
-			case usmStatsNotInTimeWindows:
-				x.Logger.Print("WARNING detected out-of-time-window ERROR")
-				if err = x.updatePktSecurityParameters(packetOut); err != nil {
-					x.Logger.Printf("ERROR updatePktSecurityParameters error: %s", err)
-					return nil, err
-				}
-				// retransmit with updated auth engine params
-				result, err = x.sendOneRequest(packetOut, wait)
-				if err != nil {
-					x.Logger.Printf("ERROR out-of-time-window retransmit error: %s", err)
-					return result, ErrNotInTimeWindow
-				}
+		logger.PrintLazy(func() string {
+			return fmt.Sprintf("SEND STORE SECURITY PARAMS from result: %+v", result)
+		})
+		if err = x.storeSecurityParameters(result); err != nil {
+			return result, err
+		}
+
+		switch reportOID(result) {
+		case usmStatsNotInTimeWindows:
+			// The agent rebooted or our notion of its clock is stale. The
+			// report carries the current boots/time, which were stored
+			// above, so resynchronize and retransmit the original request.
+			logger.Print("WARNING detected out-of-time-window ERROR")
+			if err = x.updatePktSecurityParameters(packetOut); err != nil {
+				logger.Printf("ERROR updatePktSecurityParameters error: %s", err)
+				return nil, err
+			}
+			// retransmit with updated auth engine params
+			result, err = x.sendOneRequest(packetOut, wait)
+			if err != nil {
+				logger.Printf("ERROR out-of-time-window retransmit error: %s", err)
+				return result, ErrNotInTimeWindow
+			}
+			if reportOID(result) == usmStatsNotInTimeWindows {
+				logger.Print("ERROR still out-of-time-window after resynchronization")
+				return result, newReportError(result)
+			}
+			err = x.storeSecurityParameters(result)
 
-			case usmStatsUnknownEngineIDs:
-				x.Logger.Print("WARNING detected unknown engine id ERROR")
-				if err = x.updatePktSecurityParameters(packetOut); err != nil {
-					x.Logger.Printf("ERROR updatePktSecurityParameters error: %s", err)
-					return nil, err
-				}
-				// retransmit with updated engine id
-				result, err = x.sendOneRequest(packetOut, wait)
-				if err != nil {
-					x.Logger.Printf("ERROR unknown engine id retransmit error: %s", err)
-					return result, ErrUnknownEngineID
-				}
+		case usmStatsUnknownEngineIDs:
+			logger.Print("WARNING detected unknown engine id ERROR")
+			if err = x.updatePktSecurityParameters(packetOut); err != nil {
+				logger.Printf("ERROR updatePktSecurityParameters error: %s", err)
+				return nil, err
+			}
+			// retransmit with updated engine id
+			result, err = x.sendOneRequest(packetOut, wait)
+			if err != nil {
+				logger.Printf("ERROR unknown engine id retransmit error: %s", err)
+				return result, ErrUnknownEngineID
+			}
+			if reportOID(result) == usmStatsUnknownEngineIDs {
+				logger.Print("ERROR engine id still unknown after resynchronization")
+				return result, newReportError(result)
 			}
+			err = x.storeSecurityParameters(result)
 		}
 	}
+	if err == nil && x.AccessErrors {
+		err = x.accessError(packetOut, result)
+	}
 	return result, err
 }
 
+// reportOID returns the name of the variable of a single variable Report
+// PDU, or "" for any other packet.
+func reportOID(packet *SnmpPacket) string {
+	if packet == nil || packet.PDUType != Report || len(packet.Variables) != 1 {
+		return ""
+	}
+	return packet.Variables[0].Name
+}
+
 // -- Marshalling Logic --------------------------------------------------------
 
 // MarshalMsg marshalls a snmp packet, ready for sending across the wire
@@ -942,6 +1159,9 @@ func (x *GoSNMP) unmarshalHeader(packet []byte, response *SnmpPacket) (int, erro
 	if err != nil {
 		return 0, err
 	}
+	if len(packet) > length {
+		return 0, fmt.Errorf("%w: %d bytes after a %d byte message", ErrTrailingData, len(packet)-length, length)
+	}
 	if len(packet) != length {
 		return 0, fmt.Errorf("error verifying packet sanity: Got %d Expected: %d", len(packet), length)
 	}
@@ -969,10 +1189,12 @@ func (x *GoSNMP) unmarshalHeader(packet []byte, response *SnmpPacket) (int, erro
 		if err != nil {
 			return 0, err
 		}
-		x.Logger.Printf("UnmarshalV3Header done. [with SecurityParameters]. Header Size %d. Last 4 Bytes=[%v]", cursor-oldcursor, packet[cursor-4:cursor])
+		x.Logger.PrintLazy(func() string {
+			return fmt.Sprintf("UnmarshalV3Header done. [with SecurityParameters]. Header Size %d. Last 4 Bytes=[%v]", cursor-oldcursor, packet[cursor-4:cursor])
+		})
 	} else {
 		// Parse community
-		rawCommunity, count, err := parseRawField(x.Logger, packet[cursor:], "community")
+		rawCommunity, count, err := parseCommunity(x.Logger, packet[cursor:])
 		if err != nil {
 			return 0, fmt.Errorf("error parsing community string: %w", err)
 		}
@@ -989,6 +1211,36 @@ func (x *GoSNMP) unmarshalHeader(packet []byte, response *SnmpPacket) (int, erro
 	return cursor, nil
 }
 
+// parseCommunity parses the community of a v1/v2c message. Besides a plain
+// OCTET STRING it accepts the constructed, multi-segment encoding BER allows
+// and some agents send, joining the segments.
+func parseCommunity(logger Logger, data []byte) (interface{}, int, error) {
+	if len(data) == 0 || Asn1BER(data[0]) != OctetString|0x20 {
+		return parseRawField(logger, data, "community")
+	}
+	length, cursor, err := parseLength(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if length > len(data) {
+		return nil, 0, fmt.Errorf("not enough data for constructed OctetString (%d vs %d): %x", length, len(data), data)
+	}
+	var community strings.Builder
+	for cursor < length {
+		segment, count, err := parseCommunity(logger, data[cursor:length])
+		if err != nil {
+			return nil, 0, fmt.Errorf("community segment: %w", err)
+		}
+		s, ok := segment.(string)
+		if !ok {
+			return nil, 0, fmt.Errorf("community segment of type %T", segment)
+		}
+		community.WriteString(s)
+		cursor += count
+	}
+	return community.String(), length, nil
+}
+
 func (x *GoSNMP) unmarshalPayload(packet []byte, cursor int, response *SnmpPacket) error {
 	if len(packet) == 0 {
 		return errors.New("cannot unmarshal nil or empty payload packet")
@@ -996,6 +1248,9 @@ func (x *GoSNMP) unmarshalPayload(packet []byte, cursor int, response *SnmpPacke
 	if cursor > len(packet) {
 		return fmt.Errorf("cannot unmarshal payload, packet length %d cursor %d", len(packet), cursor)
 	}
+	if cursor == len(packet) {
+		return ErrMissingPDU
+	}
 	if response == nil {
 		return errors.New("cannot unmarshal payload response into nil packet reference")
 	}
@@ -1012,11 +1267,15 @@ func (x *GoSNMP) unmarshalPayload(packet []byte, cursor int, response *SnmpPacke
 		}
 		// If it's an InformRequest, mark the trap.
 		response.IsInform = (requestType == InformRequest)
+		if requestType == SNMPv2Trap || requestType == InformRequest {
+			response.setNotificationFields()
+		}
 	case Trap:
 		response.PDUType = requestType
 		if err := x.unmarshalTrapV1(packet[cursor:], response); err != nil {
 			return fmt.Errorf("error in unmarshalTrapV1: %w", err)
 		}
+		response.setNotificationFields()
 	default:
 		x.Logger.Printf("UnmarshalPayload Meet Unknown PDUType %#x. Offset %v", requestType, cursor)
 		return fmt.Errorf("unknown PDUType %#x", requestType)
@@ -1076,8 +1335,8 @@ func (x *GoSNMP) unmarshalResponse(packet []byte, response *SnmpPacket) error {
 			return fmt.Errorf("error parsing SNMP packet, packet length %d cursor %d", len(packet), cursor)
 		}
 
-		if maxRepetitions, ok := rawMaxRepetitions.(uint32); ok {
-			response.MaxRepetitions = (maxRepetitions & 0x7FFFFFFF)
+		if maxRepetitions, ok := rawMaxRepetitions.(int); ok {
+			response.MaxRepetitions = uint32(maxRepetitions) & 0x7FFFFFFF
 		}
 	} else {
 		// Parse Error-Status
@@ -1127,7 +1386,7 @@ func (x *GoSNMP) unmarshalTrapV1(packet []byte, response *SnmpPacket) error {
 	x.Logger.Printf("getResponseLength: %d", getResponseLength)
 
 	// Parse Enterprise
-	rawEnterprise, count, err := parseRawField(x.Logger, packet[cursor:], "enterprise")
+	rawEnterprise, count, err := x.parseOIDField(packet[cursor:], "enterprise")
 	if err != nil {
 		return fmt.Errorf("error parsing SNMP packet error: %w", err)
 	}
@@ -1207,7 +1466,7 @@ func (x *GoSNMP) unmarshalTrapV1(packet []byte, response *SnmpPacket) error {
 
 // unmarshal a Varbind list
 func (x *GoSNMP) unmarshalVBL(packet []byte, response *SnmpPacket) error {
-	var cursor, cursorInc int
+	var cursor int
 	var vblLength int
 
 	if len(packet) == 0 || cursor > len(packet) {
@@ -1238,63 +1497,80 @@ func (x *GoSNMP) unmarshalVBL(packet []byte, response *SnmpPacket) error {
 
 	// Loop & parse Varbinds
 	for cursor < vblLength {
-		if packet[cursor] != 0x30 {
-			return fmt.Errorf("expected a sequence when unmarshalling a VB, got %x", packet[cursor])
-		}
-
-		_, cursorInc, err = parseLength(packet[cursor:])
+		pdu, count, err := x.unmarshalVarbind(packet[cursor:])
 		if err != nil {
 			return err
 		}
-		cursor += cursorInc
-		if cursor > len(packet) {
-			return fmt.Errorf("error parsing OID Value: packet %d cursor %d", len(packet), cursor)
-		}
+		cursor += count
+		response.Variables = append(response.Variables, pdu)
+	}
+	return nil
+}
 
-		// Parse OID
-		rawOid, oidLength, err := parseRawField(x.Logger, packet[cursor:], "OID")
-		if err != nil {
-			return fmt.Errorf("error parsing OID Value: %w", err)
-		}
-		cursor += oidLength
-		if cursor > len(packet) {
-			return fmt.Errorf("error parsing OID Value: truncated, packet length %d cursor %d", len(packet), cursor)
-		}
-		oid, ok := rawOid.(string)
-		if !ok {
-			return fmt.Errorf("unable to type assert rawOid |%v| to string", rawOid)
-		}
-		x.Logger.Printf("OID: %s", oid)
-		// Parse Value
-		var decodedVal variable
-		if err = x.decodeValue(packet[cursor:], &decodedVal); err != nil {
-			return fmt.Errorf("error decoding value: %w", err)
-		}
+// unmarshalVarbind decodes the varbind at the start of packet, returning it
+// and the number of bytes it used.
+func (x *GoSNMP) unmarshalVarbind(packet []byte) (SnmpPDU, int, error) {
+	if len(packet) == 0 || packet[0] != 0x30 {
+		return SnmpPDU{}, 0, fmt.Errorf("expected a sequence when unmarshalling a VB, got %x", packet[:1])
+	}
 
-		valueLength, _, err := parseLength(packet[cursor:])
-		if err != nil {
-			return err
-		}
-		cursor += valueLength
-		if cursor > len(packet) {
-			return fmt.Errorf("error decoding OID Value: truncated, packet length %d cursor %d", len(packet), cursor)
-		}
+	_, cursor, err := parseLength(packet)
+	if err != nil {
+		return SnmpPDU{}, 0, err
+	}
+	if cursor > len(packet) {
+		return SnmpPDU{}, 0, fmt.Errorf("error parsing OID Value: packet %d cursor %d", len(packet), cursor)
+	}
 
-		response.Variables = append(response.Variables, SnmpPDU{Name: oid, Type: decodedVal.Type, Value: decodedVal.Value})
+	// Parse OID
+	rawOid, oidLength, err := x.parseOIDField(packet[cursor:], "OID")
+	if err != nil {
+		return SnmpPDU{}, 0, fmt.Errorf("error parsing OID Value: %w", err)
 	}
-	return nil
+	cursor += oidLength
+	if cursor > len(packet) {
+		return SnmpPDU{}, 0, fmt.Errorf("error parsing OID Value: truncated, packet length %d cursor %d", len(packet), cursor)
+	}
+	oid, ok := rawOid.(string)
+	if !ok {
+		return SnmpPDU{}, 0, fmt.Errorf("unable to type assert rawOid |%v| to string", rawOid)
+	}
+	x.Logger.PrintLazy(func() string { return "OID: " + oid })
+	// Parse Value
+	var decodedVal variable
+	if err = x.decodeValue(packet[cursor:], &decodedVal); err != nil {
+		return SnmpPDU{}, 0, fmt.Errorf("error decoding value: %w", err)
+	}
+
+	valueLength, _, err := parseLength(packet[cursor:])
+	if err != nil {
+		return SnmpPDU{}, 0, err
+	}
+	cursor += valueLength
+	if cursor > len(packet) {
+		return SnmpPDU{}, 0, fmt.Errorf("error decoding OID Value: truncated, packet length %d cursor %d", len(packet), cursor)
+	}
+	pdu := SnmpPDU{Name: oid, Type: decodedVal.Type, Value: decodedVal.Value}
+	if err = x.limitValueSize(&pdu); err != nil {
+		return SnmpPDU{}, 0, err
+	}
+	return pdu, cursor, nil
 }
 
 // receive response from network and read into a byte array
 func (x *GoSNMP) receive() ([]byte, error) {
 	var n int
 	var err error
+	if x.isStreamTransport() {
+		return x.receiveStream()
+	}
+	s := x.shared()
 	// If we are using UDP and unconnected socket, read the packet and
 	// disregard the source address.
-	if uconn, ok := x.Conn.(net.PacketConn); ok {
-		n, _, err = uconn.ReadFrom(x.rxBuf[:])
+	if uconn, ok := s.Conn.(net.PacketConn); ok {
+		n, _, err = uconn.ReadFrom(s.rxBuf[:])
 	} else {
-		n, err = x.Conn.Read(x.rxBuf[:])
+		n, err = s.Conn.Read(s.rxBuf[:])
 	}
 	if err == io.EOF {
 		return nil, err
@@ -1308,6 +1584,90 @@ func (x *GoSNMP) receive() ([]byte, error) {
 	}
 
 	resp := make([]byte, n)
-	copy(resp, x.rxBuf[:n])
+	copy(resp, s.rxBuf[:n])
 	return resp, nil
 }
+
+// receiveStream reads exactly one BER encoded message from a stream
+// transport, where a single Read may return a partial message or more than
+// one message.
+func (x *GoSNMP) receiveStream() ([]byte, error) {
+	resp, err := readBERMessage(x.streamReader(), rxBufSize)
+	if err == io.EOF {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading from socket: %w", err)
+	}
+	return resp, nil
+}
+
+// streamReader returns the buffered reader of the connection of a stream
+// transport.
+func (x *GoSNMP) streamReader() *bufio.Reader {
+	s := x.shared()
+	if s.rxStream == nil || s.rxStreamConn != s.Conn {
+		s.rxStream = bufio.NewReaderSize(s.Conn, 4096)
+		s.rxStreamConn = s.Conn
+	}
+	return s.rxStream
+}
+
+// reconnectStream replaces the connection of a stream transport, and with it
+// whatever receiveStream buffered from the old one. The session and all its
+// views use the new connection.
+func (x *GoSNMP) reconnectStream() error {
+	s := x.shared()
+	old := s.Conn
+	if err := s.netConnect(); err != nil {
+		return err
+	}
+	if old != nil {
+		_ = old.Close()
+	}
+	return nil
+}
+
+// readBERMessage reads one BER TLV of at most maxLen bytes from r.
+func readBERMessage(r io.Reader, maxLen int) ([]byte, error) {
+	hdr, length, err := readBERHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(hdr)+length > maxLen {
+		return nil, fmt.Errorf("message of %d bytes exceeds %d bytes", len(hdr)+length, maxLen)
+	}
+	msg := make([]byte, len(hdr)+length)
+	copy(msg, hdr)
+	if _, err := io.ReadFull(r, msg[len(hdr):]); err != nil {
+		return nil, noEOF(err)
+	}
+	return msg, nil
+}
+
+// readBERHeader reads the tag and length octets of a BER TLV from r,
+// returning them and the length of the value.
+func readBERHeader(r io.Reader) ([]byte, int, error) {
+	hdr := make([]byte, 2, 6)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, 0, err
+	}
+	length := int(hdr[1])
+	if hdr[1]&0x80 != 0 {
+		n := int(hdr[1] & 0x7f)
+		if n == 0 || n > 4 {
+			return nil, 0, fmt.Errorf("invalid BER length octet %#x", hdr[1])
+		}
+		hdr = hdr[:2+n]
+		if _, err := io.ReadFull(r, hdr[2:]); err != nil {
+			return nil, 0, noEOF(err)
+		}
+		length = 0
+		for _, b := range hdr[2:] {
+			length = length<<8 | int(b)
+		}
+	}
+	if length < 0 {
+		return nil, 0, fmt.Errorf("invalid BER length %d", length)
+	}
+	return hdr, length, nil
+}
@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Tests in alphabetical order of function being tested
@@ -1345,6 +1346,31 @@ func TestUnmarshalEmptyPanic(t *testing.T) {
 	}
 }
 
+func TestUnmarshalGetBulkRequest(t *testing.T) {
+	request := &SnmpPacket{
+		Version:        Version2c,
+		Community:      "public",
+		PDUType:        GetBulkRequest,
+		RequestID:      1,
+		NonRepeaters:   1,
+		MaxRepetitions: 25,
+		Variables:      []SnmpPDU{{Name: ".1.3.6.1.2.1.1.3.0", Type: Null}, {Name: ".1.3.6.1.2.1.2.2.1.2", Type: Null}},
+		Logger:         Default.Logger,
+	}
+	out, err := request.marshalMsg()
+	if err != nil {
+		t.Fatalf("marshalMsg() err returned: %v", err)
+	}
+	engine := GoSNMP{Version: Version2c, Logger: Default.Logger}
+	decoded, err := engine.SnmpDecodePacket(out)
+	if err != nil {
+		t.Fatalf("SnmpDecodePacket() err returned: %v", err)
+	}
+	if decoded.NonRepeaters != 1 || decoded.MaxRepetitions != 25 {
+		t.Errorf("non-repeaters %d max-repetitions %d, want 1 and 25", decoded.NonRepeaters, decoded.MaxRepetitions)
+	}
+}
+
 func TestV3USMInitialPacket(t *testing.T) {
 	logger := NewLogger(log.New(ioutil.Discard, "", 0))
 	var emptyPdus []SnmpPDU
@@ -1777,3 +1803,90 @@ func dumpBytes2(desc string, bb []byte, cursor int) string {
 	}
 	return result
 }
+
+func benchmarkSnmpDecodePacket(b *testing.B, logger Logger) {
+	x := &GoSNMP{Version: Version2c, Logger: logger}
+	in := ciscoResponseBytes()
+	buf := make([]byte, len(in))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		copy(buf, in)
+		if _, err := x.SnmpDecodePacket(buf); err != nil {
+			b.Fatalf("error: %s", err)
+		}
+	}
+}
+
+func BenchmarkSnmpDecodePacketNoLogger(b *testing.B) {
+	benchmarkSnmpDecodePacket(b, Logger{})
+}
+
+func BenchmarkSnmpDecodePacketDiscardLogger(b *testing.B) {
+	benchmarkSnmpDecodePacket(b, NewLogger(log.New(ioutil.Discard, "", 0)))
+}
+
+func TestBeforeSendAfterReceive(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		t.Fatalf("udp4 error listening: %s", err)
+	}
+	defer srvr.Close()
+
+	agent := &GoSNMP{Version: Version2c, Community: "secret", MaxOids: MaxOids}
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, addr, err := srvr.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req, err := agent.SnmpDecodePacket(buf[:n])
+			if err != nil {
+				t.Errorf("agent decode: %s", err)
+				return
+			}
+			if req.Community != "secret" {
+				t.Errorf("BeforeSend not applied, community %q", req.Community)
+			}
+			rsp := agent.mkSnmpPacket(GetResponse, []SnmpPDU{{Name: ".1.2", Type: Integer, Value: 123}}, 0, 0)
+			rsp.RequestID = req.RequestID
+			out, err := rsp.marshalMsg()
+			if err != nil {
+				t.Errorf("agent marshal: %s", err)
+				return
+			}
+			srvr.WriteTo(out, addr)
+		}
+	}()
+
+	var sent, received *SnmpPacket
+	x := &GoSNMP{
+		Version:   Version2c,
+		Community: "public",
+		Target:    srvr.LocalAddr().(*net.UDPAddr).IP.String(),
+		Port:      uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Timeout:   time.Millisecond * 500,
+		MaxOids:   MaxOids,
+		BeforeSend: func(p *SnmpPacket, b []byte) []byte {
+			sent = p
+			return bytes.Replace(b, []byte("public"), []byte("secret"), 1)
+		},
+		AfterReceive: func(p *SnmpPacket, b []byte) []byte {
+			received = p
+			// rewrite the INTEGER 123 value to 124
+			return bytes.Replace(b, []byte{0x02, 0x01, 0x7b}, []byte{0x02, 0x01, 0x7c}, 1)
+		},
+	}
+	if err = x.Connect(); err != nil {
+		t.Fatalf("error connecting: %s", err)
+	}
+	defer x.Conn.Close()
+
+	result, err := x.Get([]string{".1.2"})
+	require.NoError(t, err)
+	assert.Equal(t, 124, result.Variables[0].Value)
+	assert.NotNil(t, sent)
+	assert.Same(t, sent, received)
+}
@@ -0,0 +1,344 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+// Package metrics maps walked SNMP variables to named metrics with labels,
+// the core of an exporter. A Metric names a scalar or table column, how the
+// index of its rows decodes into labels, which other columns add labels and
+// how values are scaled:
+//
+//	m := &metrics.Mapper{Metrics: []metrics.Metric{{
+//		Name:    "if_in_octets",
+//		OID:     ".1.3.6.1.2.1.31.1.1.1.6",
+//		Type:    metrics.Counter,
+//		Indexes: []metrics.Index{{Label: "ifIndex", Type: metrics.IndexInteger}},
+//		Lookups: []metrics.Lookup{{Label: "ifName", OID: ".1.3.6.1.2.1.31.1.1.1.1"}},
+//	}}}
+//	samples, err := m.Map(pdus)
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// ValueType is the kind of a metric.
+type ValueType string
+
+// Value types.
+const (
+	// Gauge is a value that goes up and down, the default.
+	Gauge ValueType = "gauge"
+	// Counter is a monotonically increasing value, e.g. Counter32/64.
+	Counter ValueType = "counter"
+	// Info is a string value, mapped to a sample of value 1 with the string
+	// as label "value".
+	Info ValueType = "info"
+)
+
+// IndexType is how a part of a row index is encoded in the OID.
+type IndexType string
+
+// Index types, see RFC 2578 section 7.7.
+const (
+	// IndexInteger is a single sub-identifier.
+	IndexInteger IndexType = "integer"
+	// IndexString is an OCTET STRING prefixed by its length.
+	IndexString IndexType = "string"
+	// IndexFixedString is an OCTET STRING of Index.Length octets.
+	IndexFixedString IndexType = "fixed"
+	// IndexImpliedString is an IMPLIED OCTET STRING, the rest of the index.
+	IndexImpliedString IndexType = "implied"
+	// IndexIPAddress is an IpAddress, four sub-identifiers.
+	IndexIPAddress IndexType = "ipaddress"
+	// IndexPhysAddress is a length prefixed MAC address, as in
+	// ipNetToMediaPhysAddress.
+	IndexPhysAddress IndexType = "physaddress"
+)
+
+// Index decodes a part of a row index into a label.
+type Index struct {
+	Label string    `yaml:"label" json:"label"`
+	Type  IndexType `yaml:"type" json:"type"`
+	// Length is the number of octets of IndexFixedString.
+	Length int `yaml:"length" json:"length"`
+}
+
+// Lookup adds a label with the value of another column of the same row,
+// e.g. ifName for the counters of ifXTable.
+type Lookup struct {
+	Label string `yaml:"label" json:"label"`
+	OID   string `yaml:"oid" json:"oid"`
+}
+
+// Metric maps the variables of a scalar or table column to samples.
+type Metric struct {
+	Name string `yaml:"name" json:"name"`
+	Help string `yaml:"help" json:"help"`
+	// OID is the column, or the scalar without its ".0".
+	OID  string    `yaml:"oid" json:"oid"`
+	Type ValueType `yaml:"type" json:"type"`
+
+	// Indexes decode the row index in order; the index is labeled "index"
+	// as a whole without them.
+	Indexes []Index  `yaml:"indexes" json:"indexes"`
+	Lookups []Lookup `yaml:"lookups" json:"lookups"`
+
+	// Scale multiplies numeric values, e.g. 0.01 for hundredths; 0 is 1.
+	Scale float64 `yaml:"scale" json:"scale"`
+}
+
+// Sample is a value of a metric.
+type Sample struct {
+	Name   string
+	Type   ValueType
+	Labels map[string]string
+	Value  float64
+}
+
+// Mapper maps variables to samples of its metrics.
+type Mapper struct {
+	Metrics []Metric
+}
+
+// Validate checks the metrics.
+func (m *Mapper) Validate() error {
+	var errs []string
+	for _, metric := range m.Metrics {
+		if metric.Name == "" || metric.OID == "" {
+			errs = append(errs, fmt.Sprintf("metric %q needs a name and an oid", metric.Name))
+		}
+		switch metric.Type {
+		case "", Gauge, Counter, Info:
+		default:
+			errs = append(errs, fmt.Sprintf("metric %q: unknown type %q", metric.Name, metric.Type))
+		}
+		for i, idx := range metric.Indexes {
+			switch idx.Type {
+			case IndexInteger, IndexString, IndexIPAddress, IndexPhysAddress:
+			case IndexFixedString:
+				if idx.Length <= 0 {
+					errs = append(errs, fmt.Sprintf("metric %q: index %q needs a length", metric.Name, idx.Label))
+				}
+			case IndexImpliedString:
+				if i != len(metric.Indexes)-1 {
+					errs = append(errs, fmt.Sprintf("metric %q: implied index %q is not the last", metric.Name, idx.Label))
+				}
+			default:
+				errs = append(errs, fmt.Sprintf("metric %q: index %q has unknown type %q", metric.Name, idx.Label, idx.Type))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New("metrics: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Map returns the samples of the variables, which are typically the result
+// of walking the OIDs of the metrics and their lookups. Samples are sorted by
+// metric, in the order of Metrics, and then by OID. Variables that cannot be
+// mapped are skipped and reported in the error, along with the samples of
+// the others.
+func (m *Mapper) Map(pdus []gosnmp.SnmpPDU) ([]Sample, error) {
+	byOID := make(map[string]gosnmp.SnmpPDU, len(pdus))
+	for _, pdu := range pdus {
+		byOID[normalize(pdu.Name)] = pdu
+	}
+	var samples []Sample
+	var errs []string
+	for _, metric := range m.Metrics {
+		prefix := normalize(metric.OID) + "."
+		var rows []gosnmp.SnmpPDU
+		for _, pdu := range pdus {
+			if strings.HasPrefix(normalize(pdu.Name), prefix) {
+				rows = append(rows, pdu)
+			}
+		}
+		sort.Slice(rows, func(i, j int) bool { return oidLess(normalize(rows[i].Name), normalize(rows[j].Name)) })
+		for _, pdu := range rows {
+			index := strings.TrimPrefix(normalize(pdu.Name), prefix)
+			s, err := metric.sample(pdu, index, byOID)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %s", pdu.Name, err))
+				continue
+			}
+			samples = append(samples, s)
+		}
+	}
+	if len(errs) > 0 {
+		return samples, errors.New("metrics: " + strings.Join(errs, "; "))
+	}
+	return samples, nil
+}
+
+func (metric *Metric) sample(pdu gosnmp.SnmpPDU, index string, byOID map[string]gosnmp.SnmpPDU) (Sample, error) {
+	s := Sample{Name: metric.Name, Type: metric.Type, Labels: make(map[string]string)}
+	if s.Type == "" {
+		s.Type = Gauge
+	}
+	if len(metric.Indexes) == 0 {
+		if index != "0" {
+			s.Labels["index"] = index
+		}
+	} else if err := decodeIndex(metric.Indexes, index, s.Labels); err != nil {
+		return s, err
+	}
+	for _, lookup := range metric.Lookups {
+		if v, ok := byOID[normalize(lookup.OID)+"."+index]; ok {
+			s.Labels[lookup.Label] = stringValue(v)
+		}
+	}
+
+	switch pdu.Type {
+	case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView, gosnmp.Null:
+		return s, fmt.Errorf("no value (%s)", pdu.Type)
+	}
+	if s.Type == Info {
+		s.Labels["value"] = stringValue(pdu)
+		s.Value = 1
+		return s, nil
+	}
+	v, err := numericValue(pdu)
+	if err != nil {
+		return s, err
+	}
+	if metric.Scale != 0 {
+		v *= metric.Scale
+	}
+	s.Value = v
+	return s, nil
+}
+
+// numericValue returns the value of a numeric variable, or of an OCTET
+// STRING holding a decimal number as some agents return.
+func numericValue(pdu gosnmp.SnmpPDU) (float64, error) {
+	switch pdu.Type {
+	case gosnmp.Integer, gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Counter64, gosnmp.Uinteger32:
+		f, _ := new(big.Float).SetInt(gosnmp.ToBigInt(pdu.Value)).Float64()
+		return f, nil
+	case gosnmp.OpaqueFloat:
+		if f, ok := pdu.Value.(float32); ok {
+			return float64(f), nil
+		}
+	case gosnmp.OpaqueDouble:
+		if f, ok := pdu.Value.(float64); ok {
+			return f, nil
+		}
+	case gosnmp.OctetString:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(stringValue(pdu)), 64); err == nil {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("%s value is not numeric", pdu.Type)
+}
+
+func stringValue(pdu gosnmp.SnmpPDU) string {
+	switch v := pdu.Value.(type) {
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// decodeIndex decodes the sub-identifiers of index into labels.
+func decodeIndex(indexes []Index, index string, labels map[string]string) error {
+	var subids []uint64
+	for _, part := range strings.Split(index, ".") {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return fmt.Errorf("bad index %q", index)
+		}
+		subids = append(subids, n)
+	}
+	take := func(n int) ([]uint64, error) {
+		if n > len(subids) {
+			return nil, fmt.Errorf("index %q is too short", index)
+		}
+		out := subids[:n]
+		subids = subids[n:]
+		return out, nil
+	}
+	for _, idx := range indexes {
+		var parts []uint64
+		var err error
+		switch idx.Type {
+		case IndexInteger:
+			if parts, err = take(1); err == nil {
+				labels[idx.Label] = strconv.FormatUint(parts[0], 10)
+			}
+		case IndexFixedString, IndexString, IndexImpliedString:
+			n := idx.Length
+			if idx.Type == IndexString {
+				if parts, err = take(1); err != nil {
+					return err
+				}
+				n = int(parts[0])
+			} else if idx.Type == IndexImpliedString {
+				n = len(subids)
+			}
+			if parts, err = take(n); err == nil {
+				b := make([]byte, len(parts))
+				for i, p := range parts {
+					b[i] = byte(p)
+				}
+				labels[idx.Label] = string(b)
+			}
+		case IndexIPAddress:
+			if parts, err = take(4); err == nil {
+				labels[idx.Label] = net.IPv4(byte(parts[0]), byte(parts[1]), byte(parts[2]), byte(parts[3])).String()
+			}
+		case IndexPhysAddress:
+			if parts, err = take(1); err != nil {
+				return err
+			}
+			if parts, err = take(int(parts[0])); err == nil {
+				hw := make(net.HardwareAddr, len(parts))
+				for i, p := range parts {
+					hw[i] = byte(p)
+				}
+				labels[idx.Label] = hw.String()
+			}
+		default:
+			err = fmt.Errorf("unknown index type %q", idx.Type)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(subids) > 0 {
+		return fmt.Errorf("index %q is longer than its indexes", index)
+	}
+	return nil
+}
+
+func normalize(oid string) string {
+	return "." + strings.TrimPrefix(oid, ".")
+}
+
+// oidLess orders OIDs by their sub-identifiers.
+func oidLess(a, b string) bool {
+	as, bs := strings.Split(a[1:], "."), strings.Split(b[1:], ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		x, errX := strconv.ParseUint(as[i], 10, 64)
+		y, errY := strconv.ParseUint(bs[i], 10, 64)
+		if errX != nil || errY != nil {
+			return as[i] < bs[i]
+		}
+		return x < y
+	}
+	return len(as) < len(bs)
+}
@@ -0,0 +1,110 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package metrics
+
+import (
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapTable(t *testing.T) {
+	pdus := []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.31.1.1.1.1.10", Type: gosnmp.OctetString, Value: []byte("eth1")},
+		{Name: ".1.3.6.1.2.1.31.1.1.1.1.2", Type: gosnmp.OctetString, Value: []byte("eth0")},
+		{Name: ".1.3.6.1.2.1.31.1.1.1.6.10", Type: gosnmp.Counter64, Value: uint64(1) << 40},
+		{Name: ".1.3.6.1.2.1.31.1.1.1.6.2", Type: gosnmp.Counter64, Value: uint64(1000)},
+		{Name: ".1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(12345)},
+		{Name: ".1.3.6.1.2.1.1.1.0", Type: gosnmp.OctetString, Value: []byte("Linux router")},
+	}
+	m := &Mapper{Metrics: []Metric{
+		{
+			Name:    "if_hc_in_octets",
+			OID:     ".1.3.6.1.2.1.31.1.1.1.6",
+			Type:    Counter,
+			Indexes: []Index{{Label: "ifIndex", Type: IndexInteger}},
+			Lookups: []Lookup{{Label: "ifName", OID: "1.3.6.1.2.1.31.1.1.1.1"}},
+		},
+		{Name: "sys_uptime_seconds", OID: ".1.3.6.1.2.1.1.3", Scale: 0.01},
+		{Name: "sys_descr", OID: ".1.3.6.1.2.1.1.1", Type: Info},
+	}}
+	require.NoError(t, m.Validate())
+
+	samples, err := m.Map(pdus)
+	require.NoError(t, err)
+	require.Len(t, samples, 4)
+
+	// rows are ordered numerically
+	assert.Equal(t, Sample{Name: "if_hc_in_octets", Type: Counter,
+		Labels: map[string]string{"ifIndex": "2", "ifName": "eth0"}, Value: 1000}, samples[0])
+	assert.Equal(t, map[string]string{"ifIndex": "10", "ifName": "eth1"}, samples[1].Labels)
+	assert.Equal(t, float64(uint64(1)<<40), samples[1].Value)
+	assert.Equal(t, Sample{Name: "sys_uptime_seconds", Type: Gauge, Labels: map[string]string{}, Value: 123.45}, samples[2])
+	assert.Equal(t, Sample{Name: "sys_descr", Type: Info, Labels: map[string]string{"value": "Linux router"}, Value: 1}, samples[3])
+}
+
+func TestMapIndexes(t *testing.T) {
+	m := &Mapper{Metrics: []Metric{{
+		Name: "entry",
+		OID:  ".1.3.6.1.4.1.9999.1",
+		Indexes: []Index{
+			{Label: "ip", Type: IndexIPAddress},
+			{Label: "mac", Type: IndexPhysAddress},
+			{Label: "code", Type: IndexFixedString, Length: 2},
+			{Label: "name", Type: IndexString},
+			{Label: "rest", Type: IndexImpliedString},
+		},
+	}}}
+	require.NoError(t, m.Validate())
+	samples, err := m.Map([]gosnmp.SnmpPDU{{
+		Name:  ".1.3.6.1.4.1.9999.1.192.0.2.1.6.0.17.34.51.68.85.85.83.3.97.98.99.120.121",
+		Type:  gosnmp.Integer,
+		Value: 7,
+	}})
+	require.NoError(t, err)
+	require.Len(t, samples, 1)
+	assert.Equal(t, map[string]string{
+		"ip":   "192.0.2.1",
+		"mac":  "00:11:22:33:44:55",
+		"code": "US",
+		"name": "abc",
+		"rest": "xy",
+	}, samples[0].Labels)
+	assert.Equal(t, float64(7), samples[0].Value)
+}
+
+func TestMapErrors(t *testing.T) {
+	m := &Mapper{Metrics: []Metric{{
+		Name:    "counter",
+		OID:     ".1.3.6.1.4.1.9999.2",
+		Indexes: []Index{{Label: "id", Type: IndexInteger}},
+	}}}
+	samples, err := m.Map([]gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.4.1.9999.2.1", Type: gosnmp.Gauge32, Value: uint32(5)},
+		{Name: ".1.3.6.1.4.1.9999.2.2.3", Type: gosnmp.Gauge32, Value: uint32(5)},
+		{Name: ".1.3.6.1.4.1.9999.2.3", Type: gosnmp.OctetString, Value: []byte("n/a")},
+		{Name: ".1.3.6.1.4.1.9999.2.4", Type: gosnmp.OctetString, Value: []byte(" 42 ")},
+		{Name: ".1.3.6.1.4.1.9999.2.5", Type: gosnmp.NoSuchInstance},
+	})
+	require.Error(t, err)
+	require.Len(t, samples, 2)
+	assert.Equal(t, float64(42), samples[1].Value)
+	assert.Contains(t, err.Error(), "longer than its indexes")
+	assert.Contains(t, err.Error(), "not numeric")
+	assert.Contains(t, err.Error(), "no value")
+
+	invalid := []Metric{
+		{OID: ".1.3"},
+		{Name: "m", OID: ".1.3", Type: "histogram"},
+		{Name: "m", OID: ".1.3", Indexes: []Index{{Label: "s", Type: IndexFixedString}}},
+		{Name: "m", OID: ".1.3", Indexes: []Index{{Label: "s", Type: IndexImpliedString}, {Label: "i", Type: IndexInteger}}},
+		{Name: "m", OID: ".1.3", Indexes: []Index{{Label: "s", Type: "float"}}},
+	}
+	for i, metric := range invalid {
+		assert.Error(t, (&Mapper{Metrics: []Metric{metric}}).Validate(), "#%d", i)
+	}
+}
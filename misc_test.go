@@ -12,13 +12,17 @@ import (
 	"crypto"
 	_ "crypto/md5"
 	_ "crypto/sha1"
+	"encoding/hex"
 	"errors"
+	"io/ioutil"
+	"log"
 	"math"
 	"math/big"
 	"reflect"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // -----------------------------------------------------------------------------
@@ -187,6 +191,78 @@ func TestSHAHMAC(t *testing.T) {
 	}
 }
 
+// RFC 3414 A.3.1 and A.3.2
+var testLocalizeKey = []struct {
+	authProtocol SnmpV3AuthProtocol
+	password     string
+	engineid     string
+	ku           string
+	kul          string
+}{
+	{MD5, "maplesyrup", string([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2}),
+		"9faf3283884e92834ebc9847d8edd963", "526f5eed9fcce26f8964c2930787d82b"},
+	{SHA, "maplesyrup", string([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2}),
+		"9fb5cc0381497b3793528939ff788d5d79145211", "6695febc9288e36282235fc7151f128497b38f3f"},
+}
+
+func TestLocalizeKey(t *testing.T) {
+	for i, test := range testLocalizeKey {
+		ku, err := PasswordToKey(test.authProtocol, test.password)
+		require.NoError(t, err)
+		assert.Equal(t, test.ku, hex.EncodeToString(ku), "#%d Ku", i)
+
+		kul, err := LocalizeKu(test.authProtocol, ku, test.engineid)
+		require.NoError(t, err)
+		assert.Equal(t, test.kul, hex.EncodeToString(kul), "#%d LocalizeKu", i)
+
+		kul, err = LocalizeKey(test.authProtocol, test.password, test.engineid)
+		require.NoError(t, err)
+		assert.Equal(t, test.kul, hex.EncodeToString(kul), "#%d LocalizeKey", i)
+
+		// the returned key must not alias the password cache
+		ku[0] ^= 0xff
+		again, err := PasswordToKey(test.authProtocol, test.password)
+		require.NoError(t, err)
+		assert.Equal(t, test.ku, hex.EncodeToString(again), "#%d cache", i)
+	}
+
+	_, err := PasswordToKey(NoAuth, "maplesyrup")
+	assert.Error(t, err)
+	_, err = PasswordToKey(MD5, "")
+	assert.Error(t, err)
+	_, err = LocalizeKu(SHA, nil, "engine")
+	assert.Error(t, err)
+	_, err = LocalizePrivKey(NoPriv, SHA, "maplesyrup", "engine")
+	assert.Error(t, err)
+}
+
+func TestLocalizePrivKey(t *testing.T) {
+	engineID := string([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2})
+	for _, privProtocol := range []SnmpV3PrivProtocol{DES, AES, AES192, AES256, AES192C, AES256C} {
+		sp := &UsmSecurityParameters{
+			AuthenticationProtocol:   SHA,
+			AuthenticationPassphrase: "maplesyrup",
+			PrivacyProtocol:          privProtocol,
+			PrivacyPassphrase:        "privpassword",
+			AuthoritativeEngineID:    engineID,
+		}
+		require.NoError(t, sp.initSecurityKeys())
+
+		key, err := LocalizePrivKey(privProtocol, SHA, "privpassword", engineID)
+		require.NoError(t, err)
+		assert.Equal(t, sp.PrivacyKey, key, "%v", privProtocol)
+	}
+}
+
+func TestLocalizePrivKeyDistinctPassphrases(t *testing.T) {
+	engineID := string([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2})
+	a, err := LocalizePrivKey(AES256, SHA, "passphrase-one", engineID)
+	require.NoError(t, err)
+	b, err := LocalizePrivKey(AES256, SHA, "passphrase-two", engineID)
+	require.NoError(t, err)
+	assert.NotEqual(t, a, b)
+}
+
 // ---------------------------------------------------------------------
 
 /*
@@ -229,3 +305,41 @@ func parseBitString(bytes []byte) (ret BitStringValue, err error) {
 }
 
 // ---------------------------------------------------------------------
+
+type testLoggerEnabler struct {
+	enabled bool
+	lines   int
+}
+
+func (l *testLoggerEnabler) Print(v ...interface{})                 { l.lines++ }
+func (l *testLoggerEnabler) Printf(format string, v ...interface{}) { l.lines++ }
+func (l *testLoggerEnabler) Enabled() bool                          { return l.enabled }
+
+func TestLoggerPrintLazy(t *testing.T) {
+	called := 0
+	fn := func() string {
+		called++
+		return "expensive"
+	}
+
+	var nilLogger Logger
+	nilLogger.PrintLazy(fn)
+	assert.Equal(t, 0, called, "nil logger must not build messages")
+
+	discard := NewLogger(log.New(ioutil.Discard, "", 0))
+	discard.PrintLazy(fn)
+	assert.Equal(t, 0, called, "discarding logger must not build messages")
+
+	custom := &testLoggerEnabler{}
+	logger := NewLogger(custom)
+	logger.PrintLazy(fn)
+	logger.Printf("%s", "x")
+	assert.Equal(t, 0, called)
+	assert.Equal(t, 0, custom.lines)
+
+	custom.enabled = true
+	logger.PrintLazy(fn)
+	logger.Printf("%s", "x")
+	assert.Equal(t, 1, called)
+	assert.Equal(t, 2, custom.lines)
+}
@@ -0,0 +1,161 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"encoding/json"
+	"io"
+	"math/bits"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sizeHistogramBuckets covers value sizes up to 64 KiB, larger sizes are
+// counted in the last bucket.
+const sizeHistogramBuckets = 18
+
+// SizeHistogram is an exponential histogram of sizes in bytes. Counts[0]
+// counts empty values and Counts[i] values of 2^(i-1) up to 2^i-1 bytes.
+type SizeHistogram struct {
+	Counts [sizeHistogramBuckets]uint64 `json:"counts"`
+}
+
+func (h *SizeHistogram) add(size int) {
+	i := bits.Len(uint(size))
+	if i >= sizeHistogramBuckets {
+		i = sizeHistogramBuckets - 1
+	}
+	h.Counts[i]++
+}
+
+// UpperBound returns the largest size counted in bucket i.
+func (h *SizeHistogram) UpperBound(i int) int {
+	return 1<<uint(i) - 1
+}
+
+// OIDStats are the statistics collected for one OID, or for the root OID of
+// a walk.
+type OIDStats struct {
+	// Varbinds is the number of values received.
+	Varbinds uint64 `json:"varbinds"`
+	// Requests is the number of responses the values arrived in.
+	Requests uint64 `json:"requests"`
+	// Exceptions counts noSuchObject, noSuchInstance and endOfMibView.
+	Exceptions uint64 `json:"exceptions"`
+	// Bytes is the total size of the values.
+	Bytes uint64        `json:"bytes"`
+	Sizes SizeHistogram `json:"sizes"`
+	// Latency is the share of the response time attributed to the OID: the
+	// latency of each response is divided evenly between its values.
+	Latency time.Duration `json:"latency_ns"`
+}
+
+// OIDStatsCollector collects per OID response statistics, e.g. to size
+// pollers and find OIDs that are expensive for a device. Set it as
+// GoSNMP.OIDStats; a collector may be shared by several sessions. Values
+// returned by walks are counted under the root OID of the walk (the column
+// for BulkWalkColumns), other values under their own OID, including the
+// values past its root that end a walk.
+type OIDStatsCollector struct {
+	mu   sync.Mutex
+	oids map[string]*OIDStats
+}
+
+// NewOIDStatsCollector returns an empty OIDStatsCollector.
+func NewOIDStatsCollector() *OIDStatsCollector {
+	return &OIDStatsCollector{oids: make(map[string]*OIDStats)}
+}
+
+// Snapshot returns a copy of the statistics collected so far.
+func (c *OIDStatsCollector) Snapshot() map[string]OIDStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]OIDStats, len(c.oids))
+	for oid, s := range c.oids {
+		out[oid] = *s
+	}
+	return out
+}
+
+// Reset discards the statistics collected so far.
+func (c *OIDStatsCollector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.oids = make(map[string]*OIDStats)
+}
+
+// MarshalJSON encodes the statistics as an object keyed by OID.
+func (c *OIDStatsCollector) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.Snapshot())
+}
+
+// WriteJSON writes the statistics to w as JSON.
+func (c *OIDStatsCollector) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(c.Snapshot())
+}
+
+// record adds the values of a response that took latency to arrive. Values
+// are counted under the first of roots they fall under, or their own OID.
+func (c *OIDStatsCollector) record(roots []string, vars []SnmpPDU, latency time.Duration) {
+	if len(vars) == 0 {
+		return
+	}
+	share := latency / time.Duration(len(vars))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.oids == nil {
+		c.oids = make(map[string]*OIDStats)
+	}
+	counted := make(map[*OIDStats]bool, 1)
+	for _, pdu := range vars {
+		key := pdu.Name
+		for _, root := range roots {
+			if key == root || strings.HasPrefix(key, root+".") {
+				key = root
+				break
+			}
+		}
+		s := c.oids[key]
+		if s == nil {
+			s = &OIDStats{}
+			c.oids[key] = s
+		}
+		if !counted[s] {
+			counted[s] = true
+			s.Requests++
+		}
+		s.Varbinds++
+		s.Latency += share
+		switch pdu.Type {
+		case NoSuchObject, NoSuchInstance, EndOfMibView:
+			s.Exceptions++
+			continue
+		}
+		size := valueSize(pdu)
+		s.Bytes += uint64(size)
+		s.Sizes.add(size)
+	}
+}
+
+// valueSize returns the size in bytes of the content of a decoded value.
+func valueSize(pdu SnmpPDU) int {
+	switch v := pdu.Value.(type) {
+	case []byte:
+		return len(v)
+	case string:
+		if pdu.Type == ObjectIdentifier {
+			if b, err := marshalObjectIdentifier(v); err == nil {
+				return len(b)
+			}
+		}
+		return len(v)
+	case nil:
+		return 0
+	case uint64, int64, float64:
+		return 8
+	}
+	return 4
+}
@@ -0,0 +1,149 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+// Package oids names well-known OIDs: the objects gosnmp itself uses, such as
+// the usmStats counters of SNMPv3 reports and the varbinds of notifications,
+// the system group and common MIB-2 roots.
+//
+// OIDs are in the dotted form with a leading dot that gosnmp returns.
+// Scalars are given as their instance, with the ".0" suffix, as they appear
+// in variable bindings, for example
+//
+//	result, err := gosnmp.Default.Get([]string{oids.SysName, oids.SysUpTime})
+//
+// while groups, tables and columns are given as the root to walk.
+package oids
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Roots of the registration tree.
+const (
+	Internet     = ".1.3.6.1"
+	MIB2         = ".1.3.6.1.2.1"
+	Experimental = ".1.3.6.1.3"
+	Enterprises  = ".1.3.6.1.4.1"
+	SNMPModules  = ".1.3.6.1.6.3"
+)
+
+// The system group of SNMPv2-MIB, RFC 3418.
+const (
+	System          = ".1.3.6.1.2.1.1"
+	SysDescr        = ".1.3.6.1.2.1.1.1.0"
+	SysObjectID     = ".1.3.6.1.2.1.1.2.0"
+	SysUpTime       = ".1.3.6.1.2.1.1.3.0"
+	SysContact      = ".1.3.6.1.2.1.1.4.0"
+	SysName         = ".1.3.6.1.2.1.1.5.0"
+	SysLocation     = ".1.3.6.1.2.1.1.6.0"
+	SysServices     = ".1.3.6.1.2.1.1.7.0"
+	SysORLastChange = ".1.3.6.1.2.1.1.8.0"
+	SysORTable      = ".1.3.6.1.2.1.1.9"
+)
+
+// Common MIB-2 roots.
+const (
+	Interfaces    = ".1.3.6.1.2.1.2"
+	IfNumber      = ".1.3.6.1.2.1.2.1.0"
+	IfTable       = ".1.3.6.1.2.1.2.2"
+	IP            = ".1.3.6.1.2.1.4"
+	ICMP          = ".1.3.6.1.2.1.5"
+	TCP           = ".1.3.6.1.2.1.6"
+	UDP           = ".1.3.6.1.2.1.7"
+	SNMP          = ".1.3.6.1.2.1.11"
+	RMON          = ".1.3.6.1.2.1.16"
+	HostResources = ".1.3.6.1.2.1.25"
+	IfMIB         = ".1.3.6.1.2.1.31"
+	IfXTable      = ".1.3.6.1.2.1.31.1.1"
+	EntityMIB     = ".1.3.6.1.2.1.47"
+)
+
+// Notification varbinds and the generic notifications of SNMPv2-MIB, see
+// RFC 3418 and RFC 3584 for their SNMPv1 translation.
+const (
+	SnmpTrapOID           = ".1.3.6.1.6.3.1.1.4.1.0"
+	SnmpTrapEnterprise    = ".1.3.6.1.6.3.1.1.4.3.0"
+	SnmpTrapAddress       = ".1.3.6.1.6.3.18.1.3.0"
+	SnmpTraps             = ".1.3.6.1.6.3.1.1.5"
+	ColdStart             = ".1.3.6.1.6.3.1.1.5.1"
+	WarmStart             = ".1.3.6.1.6.3.1.1.5.2"
+	LinkDown              = ".1.3.6.1.6.3.1.1.5.3"
+	LinkUp                = ".1.3.6.1.6.3.1.1.5.4"
+	AuthenticationFailure = ".1.3.6.1.6.3.1.1.5.5"
+)
+
+// The SNMP engine of SNMP-FRAMEWORK-MIB, RFC 3411.
+const (
+	SnmpEngineID             = ".1.3.6.1.6.3.10.2.1.1.0"
+	SnmpEngineBoots          = ".1.3.6.1.6.3.10.2.1.2.0"
+	SnmpEngineTime           = ".1.3.6.1.6.3.10.2.1.3.0"
+	SnmpEngineMaxMessageSize = ".1.3.6.1.6.3.10.2.1.4.0"
+)
+
+// Report counters of the message processing model, RFC 3412, and of the
+// User-based Security Model, RFC 3414.
+const (
+	SnmpUnknownSecurityModels    = ".1.3.6.1.6.3.11.2.1.1.0"
+	SnmpInvalidMsgs              = ".1.3.6.1.6.3.11.2.1.2.0"
+	SnmpUnknownPDUHandlers       = ".1.3.6.1.6.3.11.2.1.3.0"
+	UsmStatsUnsupportedSecLevels = ".1.3.6.1.6.3.15.1.1.1.0"
+	UsmStatsNotInTimeWindows     = ".1.3.6.1.6.3.15.1.1.2.0"
+	UsmStatsUnknownUserNames     = ".1.3.6.1.6.3.15.1.1.3.0"
+	UsmStatsUnknownEngineIDs     = ".1.3.6.1.6.3.15.1.1.4.0"
+	UsmStatsWrongDigests         = ".1.3.6.1.6.3.15.1.1.5.0"
+	UsmStatsDecryptionErrors     = ".1.3.6.1.6.3.15.1.1.6.0"
+)
+
+// Columns of usmUserTable, RFC 3414, used to change keys.
+const (
+	UsmUserTable            = ".1.3.6.1.6.3.15.1.2.2"
+	UsmUserAuthKeyChange    = ".1.3.6.1.6.3.15.1.2.2.1.6"
+	UsmUserOwnAuthKeyChange = ".1.3.6.1.6.3.15.1.2.2.1.7"
+	UsmUserPrivKeyChange    = ".1.3.6.1.6.3.15.1.2.2.1.9"
+	UsmUserOwnPrivKeyChange = ".1.3.6.1.6.3.15.1.2.2.1.10"
+)
+
+// The VRF table of MPLS-L3VPN-STD-MIB, RFC 4382, indexed by VRF name.
+const (
+	MplsL3VpnVrfTable      = ".1.3.6.1.2.1.10.166.11.1.2.2"
+	MplsL3VpnVrfOperStatus = ".1.3.6.1.2.1.10.166.11.1.2.2.1.6"
+)
+
+// Join appends sub-identifiers to oid, e.g. the index of a table row to a
+// column: Join(IfTable+".1.2", 3) is ".1.3.6.1.2.1.2.2.1.2.3".
+func Join(oid string, subids ...uint32) string {
+	var b strings.Builder
+	b.WriteString(oid)
+	for _, id := range subids {
+		b.WriteByte('.')
+		b.WriteString(strconv.FormatUint(uint64(id), 10))
+	}
+	return b.String()
+}
+
+// Under reports whether oid is root or in the subtree of root, comparing
+// whole sub-identifiers: ".1.3.6.1.2.1.10" is not under ".1.3.6.1.2.1.1".
+// A missing leading dot is ignored.
+func Under(oid, root string) bool {
+	oid, root = dotted(oid), dotted(root)
+	return oid == root || strings.HasPrefix(oid, root+".")
+}
+
+// Index returns the sub-identifiers of oid below root, e.g. the index of a
+// table row, or false if oid is not in the subtree of root.
+func Index(oid, root string) (string, bool) {
+	oid, root = dotted(oid), dotted(root)
+	if !strings.HasPrefix(oid, root+".") {
+		return "", false
+	}
+	return oid[len(root)+1:], true
+}
+
+func dotted(oid string) string {
+	if strings.HasPrefix(oid, ".") {
+		return oid
+	}
+	return "." + oid
+}
@@ -0,0 +1,28 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package oids
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHelpers(t *testing.T) {
+	assert.Equal(t, ".1.3.6.1.2.1.2.2.1.2.3", Join(IfTable+".1.2", 3))
+	assert.Equal(t, MIB2, Join(MIB2))
+
+	assert.True(t, Under(SysName, System))
+	assert.True(t, Under(System, System))
+	assert.True(t, Under("1.3.6.1.2.1.1.5.0", System))
+	assert.False(t, Under(".1.3.6.1.2.1.10", System))
+	assert.False(t, Under(Interfaces, IfTable))
+
+	index, ok := Index(".1.3.6.1.2.1.2.2.1.2.3", IfTable+".1.2")
+	assert.True(t, ok)
+	assert.Equal(t, "3", index)
+	_, ok = Index(IfTable, IfTable)
+	assert.False(t, ok)
+}
@@ -0,0 +1,177 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pathMaxSizes are the response sizes tried by MTUProbe, largest first: the
+// UDP payload of an Ethernet frame over IPv4, of the IPv6 minimum MTU, of the
+// IPv4 minimum reassembly size, and the smallest msgMaxSize of RFC 3412.
+//
+//nolint:gochecknoglobals
+var pathMaxSizes = []uint32{1472, 1232, 548, minMsgMaxSize}
+
+// TargetCapabilities is what was learned about an agent and the path to it.
+type TargetCapabilities struct {
+	// AgentMsgMaxSize is the msgMaxSize advertised by an SNMPv3 agent, see
+	// GoSNMP.AgentMsgMaxSize.
+	AgentMsgMaxSize uint32
+
+	// PathMaxSize is the largest response expected to cross the path
+	// unfragmented, 0 if no loss was attributed to the size of responses,
+	// see GoSNMP.PathMaxSize.
+	PathMaxSize uint32
+
+	Updated time.Time
+}
+
+// CapabilityCache shares TargetCapabilities between GoSNMP sessions, keyed by
+// the "host:port" address of the agent. Implementations must be safe for
+// concurrent use.
+type CapabilityCache interface {
+	Get(address string) (TargetCapabilities, bool)
+	Put(address string, capabilities TargetCapabilities)
+}
+
+// MemoryCapabilityCache is an in-memory CapabilityCache.
+type MemoryCapabilityCache struct {
+	mu      sync.RWMutex
+	targets map[string]TargetCapabilities
+}
+
+// NewMemoryCapabilityCache returns an empty MemoryCapabilityCache.
+func NewMemoryCapabilityCache() *MemoryCapabilityCache {
+	return &MemoryCapabilityCache{targets: make(map[string]TargetCapabilities)}
+}
+
+// Get returns the capabilities stored for address.
+func (c *MemoryCapabilityCache) Get(address string) (TargetCapabilities, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	capabilities, ok := c.targets[address]
+	return capabilities, ok
+}
+
+// Put stores the capabilities for address.
+func (c *MemoryCapabilityCache) Put(address string, capabilities TargetCapabilities) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.targets[address] = capabilities
+}
+
+// PathMaxSize returns the largest response size expected to cross the path
+// to the target unfragmented, as learned by MTUProbe, or 0 if no loss was
+// attributed to the size of responses. GetBulk max-repetitions are lowered
+// so that responses are expected to fit, and SNMPv3 requests advertise it as
+// their msgMaxSize.
+func (x *GoSNMP) PathMaxSize() uint32 {
+	return atomic.LoadUint32(&x.shared().pathMaxSize)
+}
+
+// Capabilities returns what the session learned about the target.
+func (x *GoSNMP) Capabilities() TargetCapabilities {
+	return TargetCapabilities{
+		AgentMsgMaxSize: x.AgentMsgMaxSize(),
+		PathMaxSize:     x.PathMaxSize(),
+	}
+}
+
+func (x *GoSNMP) capabilityAddress() string {
+	return net.JoinHostPort(x.Target, strconv.Itoa(int(x.Port)))
+}
+
+// loadCapabilities restores the PathMaxSize learned by other sessions.
+func (x *GoSNMP) loadCapabilities() {
+	if x.CapabilityCache == nil {
+		return
+	}
+	if c, ok := x.CapabilityCache.Get(x.capabilityAddress()); ok && c.PathMaxSize != 0 {
+		atomic.StoreUint32(&x.shared().pathMaxSize, c.PathMaxSize)
+	}
+}
+
+func (x *GoSNMP) storeCapabilities() {
+	if x.CapabilityCache == nil {
+		return
+	}
+	c := x.Capabilities()
+	c.Updated = time.Now()
+	x.CapabilityCache.Put(x.capabilityAddress(), c)
+}
+
+// smallerPathMaxSize returns the largest of pathMaxSizes below both the
+// expected response size and the current limit, or 0 if there is none.
+func smallerPathMaxSize(expected int, limit uint32) uint32 {
+	for _, size := range pathMaxSizes {
+		if int(size) < expected && (limit == 0 || size < limit) {
+			return size
+		}
+	}
+	return 0
+}
+
+// probePathMaxSize retries a GetBulk request that timed out on every attempt
+// with responses clamped to smaller sizes, until one is answered. The size
+// that got a response becomes the PathMaxSize of the session; if none did,
+// the loss was not caused by the size and PathMaxSize is left unchanged.
+func (x *GoSNMP) probePathMaxSize(packetOut *SnmpPacket, wait bool, result *SnmpPacket, err error) (*SnmpPacket, error) {
+	if packetOut.PDUType != GetBulkRequest || !wait || x.isStreamTransport() {
+		return result, err
+	}
+	previous := x.PathMaxSize()
+	maxRepetitions := packetOut.MaxRepetitions
+	for {
+		trace, ok := RequestTraceOf(err)
+		if !ok || !trace.allTimedOut() {
+			break
+		}
+		fixed, perRepetition := bulkResponseSizes(packetOut.Variables, packetOut.NonRepeaters)
+		expected := fixed + perRepetition*int(packetOut.MaxRepetitions)
+		size := smallerPathMaxSize(expected, x.responseSizeLimit())
+		if size == 0 {
+			break
+		}
+		x.Logger.Printf("GetBulk timed out with an expected response of %d bytes, retrying for %d", expected, size)
+		atomic.StoreUint32(&x.shared().pathMaxSize, size)
+		reps := x.capMaxRepetitions(packetOut.Variables, packetOut.NonRepeaters, maxRepetitions)
+		if reps == packetOut.MaxRepetitions && x.Version != Version3 {
+			// nothing would make the response smaller
+			break
+		}
+		packetOut.MaxRepetitions = reps
+		packetOut.MsgMaxSize = size
+		result, err = x.sendOneRequest(packetOut, wait)
+	}
+	if err != nil {
+		atomic.StoreUint32(&x.shared().pathMaxSize, previous)
+		return result, err
+	}
+	if x.PathMaxSize() != previous {
+		x.storeCapabilities()
+	}
+	return result, nil
+}
+
+// allTimedOut reports whether every transmission in the trace timed out,
+// without any other failure.
+func (t RequestTrace) allTimedOut() bool {
+	timeouts := 0
+	for _, ev := range t {
+		switch ev.Kind {
+		case AttemptSent:
+		case AttemptTimeout:
+			timeouts++
+		default:
+			return false
+		}
+	}
+	return timeouts > 0
+}
@@ -0,0 +1,158 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fragmentingPath relays datagrams between a client and the agent at
+// agentAddr, dropping responses larger than maxSize as a path losing
+// fragments would.
+func fragmentingPath(t *testing.T, agentAddr net.Addr, maxSize int) (*net.UDPConn, *int32) {
+	front, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	back, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		front.Close()
+		back.Close()
+	})
+	dropped := new(int32)
+	var client atomic.Value
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := front.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			client.Store(addr)
+			if _, err = back.WriteTo(buf[:n], agentAddr); err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, _, err := back.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n > maxSize {
+				atomic.AddInt32(dropped, 1)
+				continue
+			}
+			if _, err = front.WriteTo(buf[:n], client.Load().(net.Addr)); err != nil {
+				return
+			}
+		}
+	}()
+	return front, dropped
+}
+
+func TestMTUProbe(t *testing.T) {
+	var mib []SnmpPDU
+	for i := 1; i <= 100; i++ {
+		mib = append(mib, SnmpPDU{
+			Name:  fmt.Sprintf(".1.3.6.1.2.1.2.2.1.2.%d", i),
+			Type:  OctetString,
+			Value: fmt.Sprintf("GigabitEthernet0/%d", i),
+		})
+	}
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+	var requests int32
+	go bulkAgent(t, srvr, mib, &requests)
+	path, dropped := fragmentingPath(t, srvr.LocalAddr(), 600)
+
+	cache := NewMemoryCapabilityCache()
+	session := func() *GoSNMP {
+		x := &GoSNMP{
+			Target:          "127.0.0.1",
+			Port:            uint16(path.LocalAddr().(*net.UDPAddr).Port),
+			Version:         Version2c,
+			Community:       "public",
+			Timeout:         100 * time.Millisecond,
+			MaxOids:         MaxOids,
+			MaxRepetitions:  50,
+			MTUProbe:        true,
+			CapabilityCache: cache,
+		}
+		require.NoError(t, x.Connect())
+		t.Cleanup(func() { x.Conn.Close() })
+		return x
+	}
+
+	x := session()
+	results, err := x.BulkWalkAll(".1.3.6.1.2.1.2.2.1.2")
+	require.NoError(t, err)
+	assert.Len(t, results, 100)
+	// responses clamped for 1472 and 1232 bytes are still too large
+	assert.Equal(t, int32(3), atomic.LoadInt32(dropped))
+	assert.Equal(t, uint32(548), x.PathMaxSize())
+	assert.Equal(t, uint32(548), x.DebugSnapshot().PathMaxSize)
+
+	capabilities, ok := cache.Get(net.JoinHostPort(x.Target, fmt.Sprint(x.Port)))
+	require.True(t, ok)
+	assert.Equal(t, uint32(548), capabilities.PathMaxSize)
+
+	// a new session to the target starts from the learned size
+	atomic.StoreInt32(dropped, 0)
+	y := session()
+	assert.Equal(t, uint32(548), y.PathMaxSize())
+	_, err = y.BulkWalkAll(".1.3.6.1.2.1.2.2.1.2")
+	require.NoError(t, err)
+	assert.Zero(t, atomic.LoadInt32(dropped))
+}
+
+func TestMTUProbeSilentAgent(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	x := &GoSNMP{
+		Target:         "127.0.0.1",
+		Port:           uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Version:        Version2c,
+		Community:      "public",
+		Timeout:        50 * time.Millisecond,
+		MaxOids:        MaxOids,
+		MaxRepetitions: 50,
+		MTUProbe:       true,
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	// timeouts at every size are not blamed on the path
+	_, err = x.GetBulk([]string{".1.3.6.1.2.1.2.2.1.2"}, 0, 50)
+	assert.Error(t, err)
+	assert.Zero(t, x.PathMaxSize())
+
+	// nor are those of small requests
+	_, err = x.GetBulk([]string{".1.3.6.1.2.1.2.2.1.2"}, 0, 2)
+	assert.Error(t, err)
+	assert.Zero(t, x.PathMaxSize())
+}
+
+func TestSmallerPathMaxSize(t *testing.T) {
+	assert.Equal(t, uint32(1472), smallerPathMaxSize(3000, 0))
+	assert.Equal(t, uint32(1232), smallerPathMaxSize(1400, 0))
+	assert.Equal(t, uint32(548), smallerPathMaxSize(3000, 1232))
+	assert.Equal(t, uint32(0), smallerPathMaxSize(400, 0))
+	assert.Equal(t, uint32(0), smallerPathMaxSize(3000, minMsgMaxSize))
+}
@@ -0,0 +1,320 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// PollJob is a collection run periodically by a Poller: the values of Get
+// and the subtrees of Walk, read from Target every Interval.
+type PollJob struct {
+	Name string
+
+	// Target is the connected session polled. Jobs may share a session, the
+	// Poller never uses a session for two jobs at once.
+	Target *GoSNMP
+
+	// Get are OIDs read with Get, in requests of at most MaxOids OIDs.
+	Get []string
+	// Walk are subtrees read with BulkWalk, or Walk for Version1.
+	Walk []string
+
+	// CommunityIndexes, if set, poll the OIDs once per community index
+	// in each run, with WithCommunityIndex, e.g. the VLANs of a Cisco
+	// switch for the per VLAN BRIDGE-MIB. Version1 and Version2c only.
+	CommunityIndexes []string
+
+	Interval time.Duration
+
+	// Handler is called with the result of each run, and of each community
+	// index.
+	Handler func(PollResult)
+}
+
+// PollResult is the outcome of one run of a PollJob.
+type PollResult struct {
+	Job      *PollJob
+	Time     time.Time
+	Duration time.Duration
+
+	// Variables are the values read, those of Get first. On error they are
+	// the values read before it.
+	Variables []SnmpPDU
+	Err       error
+
+	// CommunityIndex is the community index polled, if the job has
+	// CommunityIndexes.
+	CommunityIndex string
+}
+
+// Poller runs PollJobs at their intervals until its context is done.
+//
+// A run waits for its session, then for a slot of its target and then for
+// a global slot, so runs queued behind a slow target never hold global
+// slots, and global slots are granted in the order they are asked for.
+type Poller struct {
+	// MaxConcurrent limits the jobs running at once, 0 for no limit.
+	MaxConcurrent int
+
+	// MaxPerTarget limits the jobs running at once against one target,
+	// i.e. agent address and context engine, 0 for no limit. The sessions
+	// of jobs are always used by one job at a time.
+	MaxPerTarget int
+
+	mu       sync.Mutex
+	jobs     []*PollJob
+	sessions map[*GoSNMP]chan struct{}
+	running  bool
+}
+
+// Add adds a job to the poller. Jobs cannot be added while Run runs.
+func (p *Poller) Add(job *PollJob) error {
+	if job.Target == nil {
+		return errors.New("poll job has no Target")
+	}
+	if job.Interval <= 0 {
+		return errors.New("poll job has no Interval")
+	}
+	if len(job.Get) == 0 && len(job.Walk) == 0 {
+		return errors.New("poll job has no OIDs")
+	}
+	if len(job.CommunityIndexes) > 0 && job.Target.Version == Version3 {
+		return errors.New("poll job has CommunityIndexes but its Target is SNMPv3")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running {
+		return errors.New("poller is running")
+	}
+	if p.sessions == nil {
+		p.sessions = make(map[*GoSNMP]chan struct{})
+	}
+	if p.sessions[job.Target] == nil {
+		p.sessions[job.Target] = make(chan struct{}, 1)
+	}
+	p.jobs = append(p.jobs, job)
+	return nil
+}
+
+// Run runs every job right away and then at its interval until ctx is done,
+// and waits for the runs in progress to return. Runs of a job never overlap,
+// a run outlasting the interval delays the next one.
+func (p *Poller) Run(ctx context.Context) error {
+	p.mu.Lock()
+	if p.running {
+		p.mu.Unlock()
+		return errors.New("poller is running")
+	}
+	p.running = true
+	jobs := append([]*PollJob(nil), p.jobs...)
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.running = false
+		p.mu.Unlock()
+	}()
+
+	var global *fairSemaphore
+	if p.MaxConcurrent > 0 {
+		global = newFairSemaphore(p.MaxConcurrent)
+	}
+	targets := make(map[string]chan struct{})
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		var target chan struct{}
+		if p.MaxPerTarget > 0 {
+			key := job.Target.engineCacheAddress()
+			if targets[key] == nil {
+				targets[key] = make(chan struct{}, p.MaxPerTarget)
+			}
+			target = targets[key]
+		}
+		wg.Add(1)
+		go func(job *PollJob, target chan struct{}) {
+			defer wg.Done()
+			p.schedule(ctx, job, target, global)
+		}(job, target)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// schedule runs job at its interval until ctx is done, limited by the slots
+// of its target and the global ones.
+func (p *Poller) schedule(ctx context.Context, job *PollJob, target chan struct{}, global *fairSemaphore) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+	session := p.sessions[job.Target]
+	for {
+		if !acquire(ctx, session) {
+			return
+		}
+		if !acquire(ctx, target) {
+			<-session
+			return
+		}
+		if global != nil && !global.acquire(ctx) {
+			release(target)
+			<-session
+			return
+		}
+		var results []PollResult
+		if len(job.CommunityIndexes) == 0 {
+			results = append(results, p.run(ctx, job, nil))
+		}
+		for i := range job.CommunityIndexes {
+			if ctx.Err() != nil {
+				break
+			}
+			results = append(results, p.run(ctx, job, &job.CommunityIndexes[i]))
+		}
+		if global != nil {
+			global.release()
+		}
+		release(target)
+		<-session
+		for _, result := range results {
+			if job.Handler != nil && ctx.Err() == nil {
+				job.Handler(result)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// run polls job once, through the community index if not nil. The caller
+// holds its session.
+func (p *Poller) run(ctx context.Context, job *PollJob, index *string) (result PollResult) {
+	x := job.Target
+	result = PollResult{Job: job, Time: time.Now()}
+	defer func() { result.Duration = time.Since(result.Time) }()
+
+	opts := []RequestOption{WithContext(ctx)}
+	if index != nil {
+		result.CommunityIndex = *index
+		opts = append(opts, WithCommunityIndex(*index))
+	}
+	result.Err = p.poll(x, callOptions(x.requestOpts, opts), job, &result.Variables)
+	return result
+}
+
+// poll appends the values of job read from x with options o to variables.
+func (p *Poller) poll(x *GoSNMP, o *requestOptions, job *PollJob, variables *[]SnmpPDU) error {
+	maxOids := x.MaxOids
+	if maxOids <= 0 {
+		maxOids = MaxOids
+	}
+	for start := 0; start < len(job.Get); start += maxOids {
+		end := start + maxOids
+		if end > len(job.Get) {
+			end = len(job.Get)
+		}
+		packet, err := x.get(o, job.Get[start:end])
+		if err != nil {
+			return err
+		}
+		*variables = append(*variables, packet.Variables...)
+	}
+	for _, root := range job.Walk {
+		walkFn := func(pdu SnmpPDU) error {
+			*variables = append(*variables, pdu)
+			return nil
+		}
+		getRequestType := GetBulkRequest
+		if x.Version == Version1 {
+			getRequestType = GetNextRequest
+		}
+		err := x.queueWalk(o, func() error {
+			return x.walk(o, getRequestType, root, walkFn)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acquire takes a slot of sem, a nil sem has no limit.
+func acquire(ctx context.Context, sem chan struct{}) bool {
+	if sem == nil {
+		return true
+	}
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release returns a slot taken with acquire.
+func release(sem chan struct{}) {
+	if sem != nil {
+		<-sem
+	}
+}
+
+// fairSemaphore is a counting semaphore granting slots in FIFO order.
+type fairSemaphore struct {
+	mu      sync.Mutex
+	free    int
+	waiters []chan struct{}
+}
+
+func newFairSemaphore(n int) *fairSemaphore {
+	return &fairSemaphore{free: n}
+}
+
+func (s *fairSemaphore) acquire(ctx context.Context) bool {
+	s.mu.Lock()
+	if s.free > 0 && len(s.waiters) == 0 {
+		s.free--
+		s.mu.Unlock()
+		return true
+	}
+	ready := make(chan struct{})
+	s.waiters = append(s.waiters, ready)
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return true
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, w := range s.waiters {
+			if w == ready {
+				s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+				return false
+			}
+		}
+		// the slot was granted while giving up, pass it on
+		s.releaseLocked()
+		return false
+	}
+}
+
+func (s *fairSemaphore) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releaseLocked()
+}
+
+func (s *fairSemaphore) releaseLocked() {
+	if len(s.waiters) > 0 {
+		close(s.waiters[0])
+		s.waiters = s.waiters[1:]
+		return
+	}
+	s.free++
+}
@@ -0,0 +1,305 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoller(t *testing.T) {
+	mib := []SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.3.0", Type: TimeTicks, Value: uint32(100)},
+		{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "router"},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.1", Type: OctetString, Value: "lo"},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.2", Type: OctetString, Value: "eth0"},
+		{Name: ".1.3.6.1.2.1.2.2.1.3.1", Type: Integer, Value: 24},
+	}
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+	var requests int32
+	go bulkAgent(t, srvr, mib, &requests)
+
+	x := &GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Community: "public",
+		Version:   Version2c,
+		Timeout:   time.Second,
+		MaxOids:   1,
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	runs := map[string][]PollResult{}
+	handler := func(r PollResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		runs[r.Job.Name] = append(runs[r.Job.Name], r)
+		if len(runs["system"]) >= 2 && len(runs["ifDescr"]) >= 1 {
+			cancel()
+		}
+	}
+
+	p := &Poller{MaxConcurrent: 1}
+	require.Error(t, p.Add(&PollJob{Name: "empty", Target: x, Interval: time.Second}))
+	require.NoError(t, p.Add(&PollJob{
+		Name:     "system",
+		Target:   x,
+		Get:      []string{".1.3.6.1.2.1.1.3.0", ".1.3.6.1.2.1.1.5.0"},
+		Interval: 10 * time.Millisecond,
+		Handler:  handler,
+	}))
+	require.NoError(t, p.Add(&PollJob{
+		Name:     "ifDescr",
+		Target:   x,
+		Walk:     []string{".1.3.6.1.2.1.2.2.1.2"},
+		Interval: time.Hour,
+		Handler:  handler,
+	}))
+	assert.Equal(t, context.Canceled, p.Run(ctx))
+
+	mu.Lock()
+	defer mu.Unlock()
+	system := runs["system"][0]
+	require.NoError(t, system.Err)
+	require.Len(t, system.Variables, 2, "Get split into requests of MaxOids")
+	assert.Equal(t, "router", string(system.Variables[1].Value.([]byte)))
+	ifDescr := runs["ifDescr"][0]
+	require.NoError(t, ifDescr.Err)
+	require.Len(t, ifDescr.Variables, 2)
+	assert.Equal(t, ".1.3.6.1.2.1.2.2.1.2.2", ifDescr.Variables[1].Name)
+	assert.Len(t, runs["ifDescr"], 1)
+}
+
+func TestPollerPerTargetLimit(t *testing.T) {
+	mib := []SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "fast"}}
+	fast, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer fast.Close()
+	var requests int32
+	go bulkAgent(t, fast, mib, &requests)
+
+	// the slow target never answers
+	slow, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer slow.Close()
+
+	session := func(port int) *GoSNMP {
+		x := &GoSNMP{
+			Target:    "127.0.0.1",
+			Port:      uint16(port),
+			Community: "public",
+			Version:   Version2c,
+			Timeout:   200 * time.Millisecond,
+		}
+		require.NoError(t, x.Connect())
+		return x
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+	var fastRuns []PollResult
+	start := time.Now()
+
+	p := &Poller{MaxConcurrent: 2, MaxPerTarget: 1}
+	for i := 0; i < 4; i++ {
+		x := session(slow.LocalAddr().(*net.UDPAddr).Port)
+		defer x.Conn.Close()
+		x.PreSend = func(*GoSNMP) {
+			mu.Lock()
+			defer mu.Unlock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+		}
+		x.OnFinish = func(*GoSNMP) {
+			mu.Lock()
+			defer mu.Unlock()
+			inFlight--
+		}
+		require.NoError(t, p.Add(&PollJob{
+			Name:     "slow",
+			Target:   x,
+			Get:      []string{".1.3.6.1.2.1.1.5.0"},
+			Interval: time.Hour,
+		}))
+	}
+	x := session(fast.LocalAddr().(*net.UDPAddr).Port)
+	defer x.Conn.Close()
+	require.NoError(t, p.Add(&PollJob{
+		Name:     "fast",
+		Target:   x,
+		Get:      []string{".1.3.6.1.2.1.1.5.0"},
+		Interval: 10 * time.Millisecond,
+		Handler: func(r PollResult) {
+			mu.Lock()
+			defer mu.Unlock()
+			fastRuns = append(fastRuns, r)
+			if len(fastRuns) == 5 {
+				cancel()
+			}
+		},
+	}))
+	assert.Equal(t, context.Canceled, p.Run(ctx))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, fastRuns, 5)
+	for _, r := range fastRuns {
+		require.NoError(t, r.Err)
+	}
+	// the slow target took one global slot, the fast one was never starved
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.Equal(t, 1, maxInFlight)
+}
+
+func TestPollerContext(t *testing.T) {
+	// an agent that never answers
+	silent, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer silent.Close()
+
+	sessionCtx := context.Background()
+	x := &GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(silent.LocalAddr().(*net.UDPAddr).Port),
+		Community: "public",
+		Version:   Version2c,
+		Timeout:   time.Minute,
+		Context:   sessionCtx,
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+	var sends int
+	x.PreSend = func(x *GoSNMP) {
+		sends++
+		assert.Equal(t, sessionCtx, x.Context, "the session is not changed by the poller")
+	}
+
+	// the job is bounded by the context of the poller, not of the session
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	job := &PollJob{Name: "slow", Target: x, Get: []string{".1.3.6.1.2.1.1.5.0"}, Walk: []string{".1.3.6.1.2.1.2"}, Interval: time.Hour}
+	start := time.Now()
+	result := (&Poller{}).run(ctx, job, nil)
+	assert.Error(t, result.Err)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.Equal(t, 1, sends)
+	assert.Equal(t, sessionCtx, x.Context)
+}
+
+func TestFairSemaphoreOrder(t *testing.T) {
+	s := newFairSemaphore(1)
+	ctx := context.Background()
+	require.True(t, s.acquire(ctx))
+
+	var order []int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if !assert.True(t, s.acquire(ctx)) {
+				return
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			s.release()
+		}(i)
+		// wait for the goroutine to queue
+		for {
+			s.mu.Lock()
+			n := len(s.waiters)
+			s.mu.Unlock()
+			if n == i+1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.False(t, s.acquire(cancelled))
+
+	s.release()
+	wg.Wait()
+	assert.Equal(t, []int{0, 1, 2}, order)
+	assert.Equal(t, 1, s.free)
+}
+
+func TestPollerCommunityIndexes(t *testing.T) {
+	mib := []SnmpPDU{{Name: ".1.3.6.1.2.1.17.1.2.0", Type: Integer, Value: 24}}
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+	var requests int32
+	go bulkAgent(t, srvr, mib, &requests)
+
+	x := &GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Community: "public",
+		Version:   Version2c,
+		Timeout:   time.Second,
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+	var communities []string
+	x.BeforeSend = func(p *SnmpPacket, b []byte) []byte {
+		communities = append(communities, p.Community)
+		return b
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var results []PollResult
+	p := &Poller{}
+	require.NoError(t, p.Add(&PollJob{
+		Name:             "dot1dBaseNumPorts",
+		Target:           x,
+		Get:              []string{".1.3.6.1.2.1.17.1.2.0"},
+		CommunityIndexes: []string{"1", "17"},
+		Interval:         time.Hour,
+		Handler: func(r PollResult) {
+			results = append(results, r)
+			if len(results) == 2 {
+				cancel()
+			}
+		},
+	}))
+	assert.Equal(t, context.Canceled, p.Run(ctx))
+
+	require.Len(t, results, 2)
+	assert.Equal(t, "1", results[0].CommunityIndex)
+	assert.Equal(t, "17", results[1].CommunityIndex)
+	for _, r := range results {
+		require.NoError(t, r.Err)
+		require.Len(t, r.Variables, 1)
+	}
+	assert.Equal(t, []string{"public@1", "public@17"}, communities)
+	assert.Equal(t, "public", x.Community)
+
+	v3 := &GoSNMP{Version: Version3}
+	assert.Error(t, p.Add(&PollJob{Target: v3, Get: []string{".1.3.6.1.2.1.1.5.0"}, CommunityIndexes: []string{"1"}, Interval: time.Hour}))
+}
@@ -0,0 +1,13 @@
+module github.com/gosnmp/gosnmp/pollspec
+
+go 1.13
+
+require (
+	github.com/gosnmp/gosnmp v1.32.0
+	github.com/stretchr/testify v1.7.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+// pollspec is developed along with the Poller of the parent module, bump the
+// requirement when tagging both.
+replace github.com/gosnmp/gosnmp => ../
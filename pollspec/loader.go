@@ -0,0 +1,326 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package pollspec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// Record is the result of one run of a job against one target, as written
+// to sinks.
+type Record struct {
+	Job      string        `json:"job"`
+	Target   string        `json:"target"`
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration_ns"`
+	Values   []Value       `json:"values,omitempty"`
+	Error    string        `json:"error,omitempty"`
+
+	// CommunityIndex is the community index polled, for targets with
+	// community_indexes.
+	CommunityIndex string `json:"community_index,omitempty"`
+}
+
+// Value is a polled value.
+type Value struct {
+	OID   string      `json:"oid"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// Sink receives the records of the jobs writing to it. Write may be called
+// concurrently.
+type Sink interface {
+	Write(Record) error
+	Close() error
+}
+
+// SinkFactory creates a sink of a type from its spec.
+type SinkFactory func(SinkSpec) (Sink, error)
+
+// Loader turns a Spec into a running Collector.
+type Loader struct {
+	// Secrets looks up the named secrets of credentials; if nil they are
+	// read from the environment variables of the same name.
+	Secrets func(name string) (string, error)
+
+	// SinkTypes adds sink types to the built-in "jsonl", which writes one
+	// JSON record per line to the file of option "path", or to stdout.
+	SinkTypes map[string]SinkFactory
+
+	// OnError, if set, is called with errors of sinks.
+	OnError func(error)
+}
+
+// Collector runs the jobs of a spec.
+type Collector struct {
+	Poller *gosnmp.Poller
+
+	sessions []*gosnmp.GoSNMP
+	sinks    []Sink
+}
+
+// Run polls until ctx is done.
+func (c *Collector) Run(ctx context.Context) error {
+	return c.Poller.Run(ctx)
+}
+
+// Close closes the sessions and sinks of the collector.
+func (c *Collector) Close() error {
+	var first error
+	for _, x := range c.sessions {
+		if x.Conn != nil {
+			if err := x.Conn.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	for _, s := range c.sinks {
+		if err := s.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Build connects the targets of spec and creates its sinks and jobs, one
+// gosnmp.PollJob per job and target.
+func (l *Loader) Build(spec *Spec) (_ *Collector, err error) {
+	if err = spec.Validate(); err != nil {
+		return nil, err
+	}
+	c := &Collector{Poller: &gosnmp.Poller{MaxConcurrent: spec.MaxConcurrent, MaxPerTarget: spec.MaxPerTarget}}
+	defer func() {
+		if err != nil {
+			_ = c.Close()
+		}
+	}()
+
+	credentials := make(map[string]Credential, len(spec.Credentials))
+	for _, cred := range spec.Credentials {
+		credentials[cred.Name] = cred
+	}
+	sessions := make(map[string]*gosnmp.GoSNMP, len(spec.Targets))
+	indexes := make(map[string][]string, len(spec.Targets))
+	for _, t := range spec.Targets {
+		indexes[t.Name] = t.CommunityIndexes
+		x, err := l.session(t, credentials[t.Credentials])
+		if err != nil {
+			return nil, fmt.Errorf("target %q: %w", t.Name, err)
+		}
+		if err = x.Connect(); err != nil {
+			return nil, fmt.Errorf("target %q: %w", t.Name, err)
+		}
+		c.sessions = append(c.sessions, x)
+		sessions[t.Name] = x
+	}
+	sinks := make(map[string]Sink, len(spec.Sinks))
+	for _, s := range spec.Sinks {
+		sink, err := l.sink(s)
+		if err != nil {
+			return nil, fmt.Errorf("sink %q: %w", s.Name, err)
+		}
+		c.sinks = append(c.sinks, sink)
+		sinks[s.Name] = sink
+	}
+	oidSets := make(map[string]OIDSet, len(spec.OIDSets))
+	for _, set := range spec.OIDSets {
+		oidSets[set.Name] = set
+	}
+
+	for _, j := range spec.Jobs {
+		var get, walk []string
+		for _, ref := range j.OIDSets {
+			get = append(get, oidSets[ref].Get...)
+			walk = append(walk, oidSets[ref].Walk...)
+		}
+		var out []Sink
+		for _, ref := range j.Sinks {
+			out = append(out, sinks[ref])
+		}
+		for _, target := range j.Targets {
+			err = c.Poller.Add(&gosnmp.PollJob{
+				Name:             j.Name,
+				Target:           sessions[target],
+				Get:              get,
+				Walk:             walk,
+				CommunityIndexes: indexes[target],
+				Interval:         time.Duration(j.Interval),
+				Handler:          l.handler(j.Name, target, out),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("job %q: %w", j.Name, err)
+			}
+		}
+	}
+	return c, nil
+}
+
+// handler writes the results of a job and target to sinks.
+func (l *Loader) handler(job, target string, sinks []Sink) func(gosnmp.PollResult) {
+	return func(r gosnmp.PollResult) {
+		rec := Record{Job: job, Target: target, CommunityIndex: r.CommunityIndex, Time: r.Time, Duration: r.Duration}
+		for _, pdu := range r.Variables {
+			v := Value{OID: pdu.Name, Type: pdu.Type.String(), Value: pdu.Value}
+			if b, ok := pdu.Value.([]byte); ok {
+				v.Value = string(b)
+			}
+			rec.Values = append(rec.Values, v)
+		}
+		if r.Err != nil {
+			rec.Error = r.Err.Error()
+		}
+		for _, s := range sinks {
+			if err := s.Write(rec); err != nil && l.OnError != nil {
+				l.OnError(fmt.Errorf("job %q target %q: %w", job, target, err))
+			}
+		}
+	}
+}
+
+// session builds the session of a target.
+func (l *Loader) session(t Target, cred Credential) (*gosnmp.GoSNMP, error) {
+	x := &gosnmp.GoSNMP{
+		Target:             t.Address,
+		Port:               t.Port,
+		Transport:          t.Transport,
+		Timeout:            time.Duration(t.Timeout),
+		Retries:            t.Retries,
+		MaxOids:            gosnmp.MaxOids,
+		ExponentialTimeout: true,
+		ContextName:        cred.ContextName,
+	}
+	if x.Port == 0 {
+		x.Port = 161
+	}
+	if x.Transport == "" {
+		x.Transport = "udp"
+	}
+	if x.Timeout == 0 {
+		x.Timeout = gosnmp.Default.Timeout
+	}
+	var err error
+	switch cred.Version {
+	case "1", "2c":
+		x.Version = gosnmp.Version2c
+		if cred.Version == "1" {
+			x.Version = gosnmp.Version1
+		}
+		if x.Community, err = l.secret(cred.Community, cred.CommunitySecret); err != nil {
+			return nil, err
+		}
+	case "3":
+		sp := &gosnmp.UsmSecurityParameters{UserName: cred.User}
+		x.Version = gosnmp.Version3
+		x.SecurityModel = gosnmp.UserSecurityModel
+		x.SecurityParameters = sp
+		x.MsgFlags = gosnmp.NoAuthNoPriv
+		if cred.AuthProtocol != "" {
+			if sp.AuthenticationProtocol, err = authProtocol(cred.AuthProtocol); err != nil {
+				return nil, err
+			}
+			if sp.AuthenticationPassphrase, err = l.secret(cred.AuthPassphrase, cred.AuthPassphraseSecret); err != nil {
+				return nil, err
+			}
+			x.MsgFlags = gosnmp.AuthNoPriv
+		}
+		if cred.PrivProtocol != "" {
+			if sp.PrivacyProtocol, err = privProtocol(cred.PrivProtocol); err != nil {
+				return nil, err
+			}
+			if sp.PrivacyPassphrase, err = l.secret(cred.PrivPassphrase, cred.PrivPassphraseSecret); err != nil {
+				return nil, err
+			}
+			x.MsgFlags = gosnmp.AuthPriv
+		}
+	}
+	return x, nil
+}
+
+// secret returns value, or the secret named ref.
+func (l *Loader) secret(value, ref string) (string, error) {
+	if ref == "" {
+		return value, nil
+	}
+	if l.Secrets != nil {
+		return l.Secrets(ref)
+	}
+	v, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("secret %q is not set in the environment", ref)
+	}
+	return v, nil
+}
+
+func authProtocol(name string) (gosnmp.SnmpV3AuthProtocol, error) {
+	for p := gosnmp.NoAuth; p <= gosnmp.SHA512; p++ {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown auth_protocol %q", name)
+}
+
+func privProtocol(name string) (gosnmp.SnmpV3PrivProtocol, error) {
+	for p := gosnmp.NoPriv; p <= gosnmp.AES256C; p++ {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown priv_protocol %q", name)
+}
+
+// sink creates the sink of s.
+func (l *Loader) sink(s SinkSpec) (Sink, error) {
+	if f, ok := l.SinkTypes[s.Type]; ok {
+		return f(s)
+	}
+	if s.Type != "jsonl" {
+		return nil, fmt.Errorf("unknown sink type %q", s.Type)
+	}
+	path := s.Options["path"]
+	if path == "" || path == "-" {
+		return &jsonlSink{w: os.Stdout}, nil
+	}
+	f, err := os.OpenFile(filepath.Clean(path), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonlSink{w: f, c: f}, nil
+}
+
+// jsonlSink writes records as JSON lines.
+type jsonlSink struct {
+	mu sync.Mutex
+	w  io.Writer
+	c  io.Closer
+}
+
+func (s *jsonlSink) Write(rec Record) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+func (s *jsonlSink) Close() error {
+	if s.c == nil {
+		return nil
+	}
+	return s.c.Close()
+}
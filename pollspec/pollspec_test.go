@@ -0,0 +1,188 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package pollspec
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const specYAML = `
+max_per_target: 2
+credentials:
+  - name: lab
+    version: 2c
+    community_secret: LAB_COMMUNITY
+  - name: core
+    version: "3"
+    user: monitor
+    auth_protocol: SHA256
+    auth_passphrase: authpassword
+    priv_protocol: AES
+    priv_passphrase_secret: CORE_PRIV
+targets:
+  - name: sw1
+    address: 127.0.0.1
+    port: %d
+    credentials: lab
+    timeout: 500ms
+oid_sets:
+  - name: system
+    get: [.1.3.6.1.2.1.1.3.0, .1.3.6.1.2.1.1.5.0]
+sinks:
+  - name: capture
+    type: memory
+jobs:
+  - name: uptime
+    targets: [sw1]
+    oid_sets: [system]
+    interval: 10ms
+    sinks: [capture]
+`
+
+// getAgent answers Get requests of community public with the OID as value.
+func getAgent(t *testing.T, srvr *net.UDPConn) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := srvr.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req, err := gosnmp.Default.SnmpDecodePacket(buf[:n])
+		if err != nil {
+			t.Errorf("agent decode: %s", err)
+			return
+		}
+		if req.Community != "public" {
+			continue
+		}
+		vars := make([]gosnmp.SnmpPDU, len(req.Variables))
+		for i, v := range req.Variables {
+			vars[i] = gosnmp.SnmpPDU{Name: v.Name, Type: gosnmp.OctetString, Value: "value of " + v.Name}
+		}
+		resp := &gosnmp.SnmpPacket{
+			Version:   gosnmp.Version2c,
+			Community: req.Community,
+			PDUType:   gosnmp.GetResponse,
+			RequestID: req.RequestID,
+			Variables: vars,
+		}
+		out, err := resp.MarshalMsg()
+		if err != nil {
+			t.Errorf("agent marshal: %s", err)
+			return
+		}
+		if _, err = srvr.WriteTo(out, addr); err != nil {
+			return
+		}
+	}
+}
+
+type memorySink struct {
+	mu      sync.Mutex
+	records []Record
+	done    chan struct{}
+}
+
+func (s *memorySink) Write(rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, rec)
+	if len(s.records) == 2 {
+		close(s.done)
+	}
+	return nil
+}
+
+func (s *memorySink) Close() error { return nil }
+
+func TestParse(t *testing.T) {
+	spec, err := Parse([]byte(fmt.Sprintf(specYAML, 161)))
+	require.NoError(t, err)
+	assert.Equal(t, "3", spec.Credentials[1].Version)
+	assert.Equal(t, Duration(10*time.Millisecond), spec.Jobs[0].Interval)
+	assert.Equal(t, Duration(500*time.Millisecond), spec.Targets[0].Timeout)
+	assert.Equal(t, 2, spec.MaxPerTarget)
+
+	json := `{"credentials": [{"name": "lab", "version": "1", "community": "public"}],
+		"targets": [{"name": "sw1", "address": "192.0.2.1", "credentials": "lab"}],
+		"oid_sets": [{"name": "system", "walk": [".1.3.6.1.2.1.1"]}],
+		"jobs": [{"name": "system", "targets": ["sw1"], "oid_sets": ["system"], "interval": "1m"}]}`
+	spec, err = Parse([]byte(json))
+	require.NoError(t, err)
+	assert.Equal(t, Duration(time.Minute), spec.Jobs[0].Interval)
+
+	for _, bad := range []string{
+		`jobs: [{name: j, targets: [nope], oid_sets: [nope], interval: 1s}]`,
+		`targets: [{name: t, address: a, credentials: c}, {name: t, address: a, credentials: c}]`,
+		`credentials: [{name: c, version: 4}]`,
+		`jobs: [{name: j, interval: soon}]`,
+		`unknown: 1`,
+		`{"jobs": [{"name": "j", "interval": 10}]}`,
+	} {
+		_, err = Parse([]byte(bad))
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestCollector(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+	go getAgent(t, srvr)
+
+	spec, err := Parse([]byte(fmt.Sprintf(specYAML, srvr.LocalAddr().(*net.UDPAddr).Port)))
+	require.NoError(t, err)
+
+	sink := &memorySink{done: make(chan struct{})}
+	secrets := map[string]string{"LAB_COMMUNITY": "public", "CORE_PRIV": "privpassword"}
+	l := &Loader{
+		Secrets: func(name string) (string, error) {
+			if v, ok := secrets[name]; ok {
+				return v, nil
+			}
+			return "", fmt.Errorf("no secret %q", name)
+		},
+		SinkTypes: map[string]SinkFactory{
+			"memory": func(SinkSpec) (Sink, error) { return sink, nil },
+		},
+	}
+	c, err := l.Build(spec)
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-sink.done
+		cancel()
+	}()
+	assert.Equal(t, context.Canceled, c.Run(ctx))
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	rec := sink.records[0]
+	assert.Equal(t, "uptime", rec.Job)
+	assert.Equal(t, "sw1", rec.Target)
+	assert.Empty(t, rec.Error)
+	require.Len(t, rec.Values, 2)
+	assert.Equal(t, "value of .1.3.6.1.2.1.1.5.0", rec.Values[1].Value)
+	assert.Equal(t, "OctetString", rec.Values[1].Type)
+
+	// secrets must resolve and sink types exist
+	delete(secrets, "LAB_COMMUNITY")
+	_, err = l.Build(spec)
+	assert.Error(t, err)
+	secrets["LAB_COMMUNITY"] = "public"
+	_, err = (&Loader{Secrets: l.Secrets}).Build(spec)
+	assert.Error(t, err)
+}
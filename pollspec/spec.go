@@ -0,0 +1,260 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+// Package pollspec loads declarative poll jobs from YAML or JSON and runs
+// them on a gosnmp.Poller, so that simple collectors need configuration
+// rather than code:
+//
+//	credentials:
+//	  - name: lab
+//	    version: 2c
+//	    community_secret: SNMP_COMMUNITY
+//	targets:
+//	  - name: sw1
+//	    address: 192.0.2.1
+//	    credentials: lab
+//	oid_sets:
+//	  - name: interfaces
+//	    walk: [.1.3.6.1.2.1.2.2.1.10, .1.3.6.1.2.1.2.2.1.16]
+//	sinks:
+//	  - name: out
+//	    type: jsonl
+//	jobs:
+//	  - name: traffic
+//	    targets: [sw1]
+//	    oid_sets: [interfaces]
+//	    interval: 1m
+//	    sinks: [out]
+package pollspec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is a set of poll jobs and what they refer to by name.
+type Spec struct {
+	Credentials []Credential `yaml:"credentials" json:"credentials"`
+	Targets     []Target     `yaml:"targets" json:"targets"`
+	OIDSets     []OIDSet     `yaml:"oid_sets" json:"oid_sets"`
+	Sinks       []SinkSpec   `yaml:"sinks" json:"sinks"`
+	Jobs        []Job        `yaml:"jobs" json:"jobs"`
+
+	// MaxConcurrent limits the jobs running at once, see
+	// gosnmp.Poller.MaxConcurrent.
+	MaxConcurrent int `yaml:"max_concurrent" json:"max_concurrent"`
+	// MaxPerTarget limits the jobs running at once against one target, see
+	// gosnmp.Poller.MaxPerTarget.
+	MaxPerTarget int `yaml:"max_per_target" json:"max_per_target"`
+}
+
+// Credential holds the SNMP credentials of targets. Secrets are given
+// either inline or, preferably, as the name of a secret looked up with
+// Loader.Secrets.
+type Credential struct {
+	Name string `yaml:"name" json:"name"`
+	// Version is "1", "2c" or "3".
+	Version string `yaml:"version" json:"version"`
+
+	Community       string `yaml:"community" json:"community"`
+	CommunitySecret string `yaml:"community_secret" json:"community_secret"`
+
+	User string `yaml:"user" json:"user"`
+	// AuthProtocol is e.g. "SHA256", PrivProtocol e.g. "AES".
+	AuthProtocol         string `yaml:"auth_protocol" json:"auth_protocol"`
+	AuthPassphrase       string `yaml:"auth_passphrase" json:"auth_passphrase"`
+	AuthPassphraseSecret string `yaml:"auth_passphrase_secret" json:"auth_passphrase_secret"`
+	PrivProtocol         string `yaml:"priv_protocol" json:"priv_protocol"`
+	PrivPassphrase       string `yaml:"priv_passphrase" json:"priv_passphrase"`
+	PrivPassphraseSecret string `yaml:"priv_passphrase_secret" json:"priv_passphrase_secret"`
+	ContextName          string `yaml:"context_name" json:"context_name"`
+}
+
+// Target is an agent to poll.
+type Target struct {
+	Name    string `yaml:"name" json:"name"`
+	Address string `yaml:"address" json:"address"`
+	// Port defaults to 161.
+	Port uint16 `yaml:"port" json:"port"`
+	// Transport is "udp" (the default) or "tcp".
+	Transport   string   `yaml:"transport" json:"transport"`
+	Credentials string   `yaml:"credentials" json:"credentials"`
+	Timeout     Duration `yaml:"timeout" json:"timeout"`
+	Retries     int      `yaml:"retries" json:"retries"`
+	// CommunityIndexes poll the target once per community index, e.g. the
+	// VLANs of a Cisco switch as "public@17". SNMPv1/v2c only.
+	CommunityIndexes []string `yaml:"community_indexes" json:"community_indexes"`
+}
+
+// OIDSet is a named set of OIDs read together.
+type OIDSet struct {
+	Name string   `yaml:"name" json:"name"`
+	Get  []string `yaml:"get" json:"get"`
+	Walk []string `yaml:"walk" json:"walk"`
+}
+
+// SinkSpec configures an output of poll results. Options are specific to
+// the sink type.
+type SinkSpec struct {
+	Name    string            `yaml:"name" json:"name"`
+	Type    string            `yaml:"type" json:"type"`
+	Options map[string]string `yaml:"options" json:"options"`
+}
+
+// Job polls the OID sets of targets at an interval, writing the results to
+// sinks.
+type Job struct {
+	Name     string   `yaml:"name" json:"name"`
+	Targets  []string `yaml:"targets" json:"targets"`
+	OIDSets  []string `yaml:"oid_sets" json:"oid_sets"`
+	Interval Duration `yaml:"interval" json:"interval"`
+	Sinks    []string `yaml:"sinks" json:"sinks"`
+}
+
+// Duration is a time.Duration written as a string such as "30s".
+type Duration time.Duration
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	return d.set(s)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %w", err)
+	}
+	return d.set(s)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Parse parses a spec in YAML or JSON. Unknown fields are errors.
+func Parse(data []byte) (*Spec, error) {
+	spec := &Spec{}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(spec); err != nil {
+			return nil, fmt.Errorf("pollspec: %w", err)
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(spec); err != nil {
+			return nil, fmt.Errorf("pollspec: %w", err)
+		}
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// Load reads and parses the spec in file path.
+func Load(path string) (*Spec, error) {
+	data, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Validate checks that names are unique and every reference resolves.
+func (s *Spec) Validate() error {
+	var errs []string
+	names := func(kind string, n int, name func(int) string) map[string]bool {
+		seen := make(map[string]bool, n)
+		for i := 0; i < n; i++ {
+			switch nm := name(i); {
+			case nm == "":
+				errs = append(errs, fmt.Sprintf("%s #%d has no name", kind, i+1))
+			case seen[nm]:
+				errs = append(errs, fmt.Sprintf("duplicate %s %q", kind, nm))
+			default:
+				seen[nm] = true
+			}
+		}
+		return seen
+	}
+	credentials := names("credentials", len(s.Credentials), func(i int) string { return s.Credentials[i].Name })
+	targets := names("target", len(s.Targets), func(i int) string { return s.Targets[i].Name })
+	oidSets := names("oid set", len(s.OIDSets), func(i int) string { return s.OIDSets[i].Name })
+	sinks := names("sink", len(s.Sinks), func(i int) string { return s.Sinks[i].Name })
+	names("job", len(s.Jobs), func(i int) string { return s.Jobs[i].Name })
+
+	for _, c := range s.Credentials {
+		switch c.Version {
+		case "1", "2c", "3":
+		default:
+			errs = append(errs, fmt.Sprintf("credentials %q: version must be 1, 2c or 3", c.Name))
+		}
+	}
+	for _, t := range s.Targets {
+		if t.Address == "" {
+			errs = append(errs, fmt.Sprintf("target %q has no address", t.Name))
+		}
+		if !credentials[t.Credentials] {
+			errs = append(errs, fmt.Sprintf("target %q: unknown credentials %q", t.Name, t.Credentials))
+		}
+	}
+	for _, j := range s.Jobs {
+		if j.Interval <= 0 {
+			errs = append(errs, fmt.Sprintf("job %q has no interval", j.Name))
+		}
+		if len(j.Targets) == 0 || len(j.OIDSets) == 0 {
+			errs = append(errs, fmt.Sprintf("job %q needs targets and oid_sets", j.Name))
+		}
+		for _, ref := range j.Targets {
+			if !targets[ref] {
+				errs = append(errs, fmt.Sprintf("job %q: unknown target %q", j.Name, ref))
+			}
+		}
+		for _, ref := range j.OIDSets {
+			if !oidSets[ref] {
+				errs = append(errs, fmt.Sprintf("job %q: unknown oid set %q", j.Name, ref))
+			}
+		}
+		for _, ref := range j.Sinks {
+			if !sinks[ref] {
+				errs = append(errs, fmt.Sprintf("job %q: unknown sink %q", j.Name, ref))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New("pollspec: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
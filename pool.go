@@ -0,0 +1,299 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultPoolMaxIdle is the number of idle sessions a Pool keeps per
+// address and credentials unless MaxIdle is set.
+const DefaultPoolMaxIdle = 2
+
+// ErrPoolClosed is returned by Get on a closed Pool.
+var ErrPoolClosed = errors.New("pool is closed")
+
+// Pool keeps connected sessions between uses, so that short bursts of
+// requests to an agent do not pay for Connect and, for SNMPv3, the engine
+// discovery, every time:
+//
+//	pool := &gosnmp.Pool{MaxLifetime: time.Hour}
+//	defer pool.Close()
+//	...
+//	x, err := pool.Get(config)
+//	if err != nil {
+//		return err
+//	}
+//	result, err := x.Get(oids)
+//	pool.Put(x, err)
+//
+// Sessions are kept per address and credentials of the configuration they
+// were made from. Its methods are safe for concurrent use.
+type Pool struct {
+	// MaxIdle limits the idle sessions kept per address and credentials,
+	// DefaultPoolMaxIdle if 0, none if negative.
+	MaxIdle int
+
+	// MaxLifetime, if positive, is the age after which a session is closed
+	// rather than reused, e.g. to pick up DNS changes.
+	MaxLifetime time.Duration
+
+	// IdleTimeout, if positive, is the time after which an idle session is
+	// closed rather than reused.
+	IdleTimeout time.Duration
+
+	// HealthCheck, if set, checks an idle session before it is reused, e.g.
+	// with a Get of sysUpTime; a session failing it is closed. Sessions idle
+	// for less than HealthCheckAfter are not checked.
+	HealthCheck      func(x *GoSNMP) error
+	HealthCheckAfter time.Duration
+
+	mu     sync.Mutex
+	idle   map[string][]*pooledSession // most recently used last
+	inUse  map[*GoSNMP]*pooledSession
+	closed bool
+}
+
+// pooledSession is a session of a Pool.
+type pooledSession struct {
+	x         *GoSNMP
+	key       string
+	created   time.Time
+	idleSince time.Time
+}
+
+// Get returns a connected session of config, an idle one if there is one
+// and a new one otherwise, that the caller uses alone until it returns it
+// with Put. config is copied, with its SecurityParameters, and is not
+// connected.
+//
+// Sessions are reused across configurations that differ only in settings
+// other than address and credentials: an idle session is returned as a
+// view, see WithOptions, with the settings of config that apply to each
+// request, such as Timeout, Retries, ExponentialTimeout, MaxRepetitions,
+// Logger, the hooks and the collectors. Settings of the connection or of
+// the SNMPv3 engine, such as TLSConfig or EngineCache, are those of the
+// configuration the session was made from.
+func (p *Pool) Get(config *GoSNMP) (*GoSNMP, error) {
+	key := poolKey(config)
+	for {
+		s, err := p.takeIdle(key)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			break
+		}
+		if p.HealthCheck != nil && time.Since(s.idleSince) >= p.HealthCheckAfter {
+			if err := p.HealthCheck(s.x); err != nil {
+				p.discard(s)
+				continue
+			}
+		}
+		return s.x.withSettingsOf(config), nil
+	}
+
+	c := *config
+	if config.SecurityParameters != nil {
+		c.SecurityParameters = config.SecurityParameters.Copy()
+	}
+	if err := c.Connect(); err != nil {
+		return nil, err
+	}
+	s := &pooledSession{x: &c, key: key, created: time.Now()}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		c.Conn.Close()
+		return nil, ErrPoolClosed
+	}
+	if p.inUse == nil {
+		p.inUse = make(map[*GoSNMP]*pooledSession)
+	}
+	p.inUse[s.x] = s
+	return s.x, nil
+}
+
+// Put returns x, a session of Get, to the pool. err is the error of its
+// last use: a session that failed is closed rather than kept, as its
+// connection, or its engine, may be gone. Sessions beyond MaxIdle, past
+// MaxLifetime or returned to a closed pool are closed too.
+func (p *Pool) Put(x *GoSNMP, err error) {
+	p.mu.Lock()
+	s := p.inUse[x.shared()]
+	if s == nil {
+		p.mu.Unlock()
+		return
+	}
+	delete(p.inUse, s.x)
+	if err == nil && !p.closed && !p.expired(s, time.Now()) && len(p.idle[s.key]) < p.maxIdle() {
+		if p.idle == nil {
+			p.idle = make(map[string][]*pooledSession)
+		}
+		s.idleSince = time.Now()
+		p.idle[s.key] = append(p.idle[s.key], s)
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+	s.x.Conn.Close()
+}
+
+// Idle returns the number of idle sessions.
+func (p *Pool) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, idle := range p.idle {
+		n += len(idle)
+	}
+	return n
+}
+
+// Close closes the idle sessions, and those in use once they are returned.
+// Get fails with ErrPoolClosed afterwards.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	var firstErr error
+	for _, sessions := range idle {
+		for _, s := range sessions {
+			if err := s.x.Conn.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// takeIdle removes the most recently used idle session of key from the
+// pool, closing those expired, and marks it in use. It returns nil if
+// there is none.
+func (p *Pool) takeIdle(key string) (*pooledSession, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+	now := time.Now()
+	idle := p.idle[key]
+	for len(idle) > 0 {
+		s := idle[len(idle)-1]
+		idle = idle[:len(idle)-1]
+		if p.expired(s, now) || p.IdleTimeout > 0 && now.Sub(s.idleSince) >= p.IdleTimeout {
+			s.x.Conn.Close()
+			continue
+		}
+		p.setIdle(key, idle)
+		if p.inUse == nil {
+			p.inUse = make(map[*GoSNMP]*pooledSession)
+		}
+		p.inUse[s.x] = s
+		return s, nil
+	}
+	p.setIdle(key, nil)
+	return nil, nil
+}
+
+// setIdle sets the idle sessions of key. The caller holds p.mu.
+func (p *Pool) setIdle(key string, idle []*pooledSession) {
+	if len(idle) == 0 {
+		delete(p.idle, key)
+		return
+	}
+	p.idle[key] = idle
+}
+
+// discard closes s, a session in use.
+func (p *Pool) discard(s *pooledSession) {
+	p.mu.Lock()
+	delete(p.inUse, s.x)
+	p.mu.Unlock()
+	s.x.Conn.Close()
+}
+
+// expired reports whether s is past MaxLifetime.
+func (p *Pool) expired(s *pooledSession, now time.Time) bool {
+	return p.MaxLifetime > 0 && now.Sub(s.created) >= p.MaxLifetime
+}
+
+func (p *Pool) maxIdle() int {
+	if p.MaxIdle == 0 {
+		return DefaultPoolMaxIdle
+	}
+	return p.MaxIdle
+}
+
+// withSettingsOf returns a view of x, a pooled session, with the settings of
+// config that apply to each request, see Pool.Get.
+func (x *GoSNMP) withSettingsOf(config *GoSNMP) *GoSNMP {
+	view := x.WithOptions()
+	if config.Context != nil {
+		view.Context = config.Context
+	}
+	view.Timeout = config.Timeout
+	view.Retries = config.Retries
+	view.ExponentialTimeout = config.ExponentialTimeout
+	view.Logger = config.Logger
+	view.PreSend = config.PreSend
+	view.OnSent = config.OnSent
+	view.OnRecv = config.OnRecv
+	view.OnRetry = config.OnRetry
+	view.OnFinish = config.OnFinish
+	view.OnExpire = config.OnExpire
+	view.OnEngineChange = config.OnEngineChange
+	view.BeforeSend = config.BeforeSend
+	view.AfterReceive = config.AfterReceive
+	if config.MaxOids != 0 {
+		view.MaxOids = config.MaxOids
+	}
+	view.MaxRepetitions = config.MaxRepetitions
+	view.NonRepeaters = config.NonRepeaters
+	view.MaxValueSize = config.MaxValueSize
+	view.LargeValueHandler = config.LargeValueHandler
+	view.AccessErrors = config.AccessErrors
+	view.OIDStats = config.OIDStats
+	view.SessionStats = config.SessionStats
+	view.WireLog = config.WireLog
+	view.ShortResponses = config.ShortResponses
+	view.StrictBER = config.StrictBER
+	return view
+}
+
+// poolKey returns the key of the sessions of config, a digest of its
+// address and credentials: for USM also the passphrases and localized keys,
+// for TLS the server name and client certificates.
+func poolKey(config *GoSNMP) string {
+	h := sha256.New()
+	var credentials string
+	if config.SecurityParameters != nil {
+		credentials = config.SecurityParameters.Description()
+	}
+	fmt.Fprintf(h, "%s|%s|%d|%s|%s|%s|%d|%d|%s|%s|%s",
+		config.Transport, config.Target, config.Port, config.LocalAddr, config.Version, config.Community,
+		config.SecurityModel, config.MsgFlags, config.ContextEngineID, config.ContextName, credentials)
+	if usp, ok := config.SecurityParameters.(*UsmSecurityParameters); ok {
+		usp.mu.Lock()
+		fmt.Fprintf(h, "|%q|%q|%x|%x", usp.AuthenticationPassphrase, usp.PrivacyPassphrase, usp.SecretKey, usp.PrivacyKey)
+		usp.mu.Unlock()
+	}
+	if config.TLSConfig != nil {
+		fmt.Fprintf(h, "|%q", config.TLSConfig.ServerName)
+		for _, cert := range config.TLSConfig.Certificates {
+			if len(cert.Certificate) > 0 {
+				fmt.Fprintf(h, "|%x", sha256.Sum256(cert.Certificate[0]))
+			}
+		}
+	}
+	return string(h.Sum(nil))
+}
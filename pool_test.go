@@ -0,0 +1,177 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool(t *testing.T) {
+	a := NewAgent()
+	a.Handler = &testAgentHandler{vars: testAgentVars()}
+	agent := startAgent(t, a, Version2c, "public")
+	config := &GoSNMP{
+		Target:    agent.Target,
+		Port:      agent.Port,
+		Community: "public",
+		Version:   Version2c,
+		Timeout:   time.Second,
+	}
+
+	p := &Pool{}
+	x, err := p.Get(config)
+	require.NoError(t, err)
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.1.0"})
+	require.NoError(t, err)
+	assert.Nil(t, config.Conn, "the configuration is not connected")
+	p.Put(x, err)
+	assert.Equal(t, 1, p.Idle())
+
+	reused, err := p.Get(config)
+	require.NoError(t, err)
+	assert.Same(t, x, reused.shared(), "idle session reused")
+	other := *config
+	other.Community = "private"
+	y, err := p.Get(&other)
+	require.NoError(t, err)
+	assert.NotSame(t, x, y, "sessions are kept per credentials")
+	p.Put(y, nil)
+	p.Put(reused, errors.New("request timeout"))
+	assert.Equal(t, 1, p.Idle(), "a failed session is closed")
+
+	// health checks
+	checks := 0
+	p.HealthCheck = func(x *GoSNMP) error {
+		checks++
+		return errors.New("agent restarted")
+	}
+	z, err := p.Get(&other)
+	require.NoError(t, err)
+	assert.NotSame(t, y, z, "a session failing its health check is replaced")
+	assert.Equal(t, 1, checks)
+	p.HealthCheck = nil
+
+	// lifetime
+	p.Put(z, nil)
+	p.MaxLifetime = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	w, err := p.Get(&other)
+	require.NoError(t, err)
+	assert.NotSame(t, z, w, "an expired session is replaced")
+	p.Put(w, nil)
+	assert.Equal(t, 0, p.Idle(), "an expired session is not kept")
+
+	p.MaxLifetime = 0
+	v, err := p.Get(config)
+	require.NoError(t, err)
+	require.NoError(t, p.Close())
+	_, err = p.Get(config)
+	assert.True(t, errors.Is(err, ErrPoolClosed))
+	p.Put(v, nil)
+	assert.Equal(t, 0, p.Idle(), "returned to a closed pool")
+}
+
+func TestPoolMaxIdle(t *testing.T) {
+	a := NewAgent()
+	a.Handler = &testAgentHandler{vars: testAgentVars()}
+	agent := startAgent(t, a, Version2c, "public")
+	config := &GoSNMP{Target: agent.Target, Port: agent.Port, Community: "public", Version: Version2c, Timeout: time.Second}
+
+	p := &Pool{}
+	defer p.Close()
+	var sessions []*GoSNMP
+	for i := 0; i < 3; i++ {
+		x, err := p.Get(config)
+		require.NoError(t, err)
+		sessions = append(sessions, x)
+	}
+	for _, x := range sessions {
+		p.Put(x, nil)
+	}
+	assert.Equal(t, DefaultPoolMaxIdle, p.Idle())
+}
+
+func TestPoolSettings(t *testing.T) {
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer silent.Close()
+	slow := &GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(silent.LocalAddr().(*net.UDPAddr).Port),
+		Community: "public",
+		Version:   Version2c,
+		Timeout:   time.Minute,
+	}
+	fast := *slow
+	fast.Timeout = 50 * time.Millisecond
+
+	p := &Pool{}
+	defer p.Close()
+	x, err := p.Get(slow)
+	require.NoError(t, err)
+	p.Put(x, nil)
+
+	// the session is reused with the Timeout of the configuration
+	y, err := p.Get(&fast)
+	require.NoError(t, err)
+	assert.Same(t, x, y.shared())
+	start := time.Now()
+	_, err = y.Get([]string{".1.3.6.1.2.1.1.1.0"})
+	assert.Error(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(5*time.Second))
+	p.Put(y, nil)
+	assert.Equal(t, 1, p.Idle())
+	assert.Equal(t, time.Minute, x.Timeout, "the pooled session keeps its settings")
+}
+
+func TestPoolKey(t *testing.T) {
+	usm := &GoSNMP{
+		Target:        "192.0.2.1",
+		Port:          161,
+		Version:       Version3,
+		SecurityModel: UserSecurityModel,
+		MsgFlags:      AuthPriv,
+		SecurityParameters: &UsmSecurityParameters{
+			UserName:               "alice",
+			AuthenticationProtocol: SHA,
+			PrivacyProtocol:        AES,
+			SecretKey:              []byte("secret key one"),
+			PrivacyKey:             []byte("privacy key one"),
+		},
+	}
+	other := *usm
+	other.SecurityParameters = usm.SecurityParameters.Copy()
+	assert.Equal(t, poolKey(usm), poolKey(&other))
+	other.SecurityParameters.(*UsmSecurityParameters).PrivacyKey = []byte("privacy key two")
+	assert.NotEqual(t, poolKey(usm), poolKey(&other), "sessions are kept per localized key")
+
+	tsm := &GoSNMP{
+		Target:             "192.0.2.1",
+		Port:               10161,
+		Transport:          "tls",
+		Version:            Version3,
+		SecurityModel:      TransportSecurityModel,
+		MsgFlags:           AuthPriv,
+		SecurityParameters: &TsmSecurityParameters{SecurityName: "alice"},
+		TLSConfig:          &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{[]byte("certificate one")}}}},
+	}
+	other = *tsm
+	other.TLSConfig = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{[]byte("certificate two")}}}}
+	assert.NotEqual(t, poolKey(tsm), poolKey(&other), "sessions are kept per client certificate")
+	other.TLSConfig = tsm.TLSConfig.Clone()
+	assert.Equal(t, poolKey(tsm), poolKey(&other))
+	other.TLSConfig.ServerName = "agent.example.com"
+	assert.NotEqual(t, poolKey(tsm), poolKey(&other), "sessions are kept per server name")
+}
@@ -0,0 +1,414 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RequestOption overrides a setting of the session for a single call, e.g.
+// GetWithOptions, without modifying the GoSNMP struct.
+type RequestOption func(*requestOptions)
+
+// requestOptions are the overrides of a call, unset fields use the session
+// settings.
+type requestOptions struct {
+	contextName     *string
+	contextEngineID *string
+	correlationID   *string
+	timeout         *time.Duration
+	retries         *int
+	community       *string
+	communityIndex  *string
+	exponential     *bool
+	maxRepetitions  *uint32
+	nonRepeaters    *uint8
+	priority        *RequestPriority
+
+	// deadline, if set, ends the attempts of the call
+	deadline time.Time
+
+	// ctx, if set, replaces GoSNMP.Context for the call, see WithContext
+	ctx context.Context
+
+	// walkLimit, walkByteBudget and walkCursor bound the walks of the
+	// call, see WithWalkLimit
+	walkLimit      int
+	walkByteBudget int
+	walkCursor     string
+
+	// operationID and logger are the correlation ID and the logger of the
+	// operation of the call, see beginOperation
+	operationID string
+	logger      Logger
+}
+
+// WithContextName sends the requests of a call to the SNMPv3 context name,
+// e.g. "vlan-10" for the per VLAN BRIDGE-MIB of Cisco devices.
+func WithContextName(name string) RequestOption {
+	return func(o *requestOptions) {
+		o.contextName = &name
+	}
+}
+
+// WithContextEngineID sends the requests of a call to the SNMPv3 context
+// engine contextEngineID. Use ForEngine for engines behind a proxy that need
+// security state of their own.
+func WithContextEngineID(contextEngineID string) RequestOption {
+	return func(o *requestOptions) {
+		o.contextEngineID = &contextEngineID
+	}
+}
+
+// WithTimeout waits timeout for each response of a call instead of
+// GoSNMP.Timeout, e.g. a short one for a liveness probe and a long one for
+// a heavyweight table walk on the same session.
+func WithTimeout(timeout time.Duration) RequestOption {
+	return func(o *requestOptions) {
+		o.timeout = &timeout
+	}
+}
+
+// WithRetries retransmits the requests of a call up to retries times
+// instead of GoSNMP.Retries; 0 sends each request once.
+func WithRetries(retries int) RequestOption {
+	return func(o *requestOptions) {
+		o.retries = &retries
+	}
+}
+
+// WithContext bounds the requests of a call by ctx instead of
+// GoSNMP.Context: no attempt outlasts its deadline, and the call fails with
+// its error once it is done.
+func WithContext(ctx context.Context) RequestOption {
+	return func(o *requestOptions) {
+		o.ctx = ctx
+	}
+}
+
+// WithExponentialTimeout doubles the timeout of each retransmission of a
+// call, or keeps it, instead of following GoSNMP.ExponentialTimeout.
+func WithExponentialTimeout(enabled bool) RequestOption {
+	return func(o *requestOptions) {
+		o.exponential = &enabled
+	}
+}
+
+// WithMaxRepetitions sets the GetBulk max-repetitions of the bulk walks of
+// a call instead of GoSNMP.MaxRepetitions, e.g. a small value for a sparse
+// table and a large one for a dense table on the same session. It also
+// overrides the maxRepetitions of GetBulkWithOptions.
+func WithMaxRepetitions(maxRepetitions uint32) RequestOption {
+	return func(o *requestOptions) {
+		o.maxRepetitions = &maxRepetitions
+	}
+}
+
+// WithNonRepeaters sets the GetBulk non-repeaters of the bulk walks of a call
+// instead of GoSNMP.NonRepeaters. It also overrides the nonRepeaters of
+// GetBulkWithOptions.
+func WithNonRepeaters(nonRepeaters uint8) RequestOption {
+	return func(o *requestOptions) {
+		o.nonRepeaters = &nonRepeaters
+	}
+}
+
+// WithCommunity sends the requests of a call with the SNMPv1/v2c community
+// instead of GoSNMP.Community.
+func WithCommunity(community string) RequestOption {
+	return func(o *requestOptions) {
+		o.community = &community
+	}
+}
+
+// WithCommunityIndex sends the SNMPv1/v2c requests of a call with the
+// community indexed by index, "public@17" for community "public" and index
+// "17", the convention by which Cisco and other devices select a context
+// such as the BRIDGE-MIB of VLAN 17. SNMPv3 requests, which carry a context
+// name instead, are not affected.
+func WithCommunityIndex(index string) RequestOption {
+	return func(o *requestOptions) {
+		o.communityIndex = &index
+	}
+}
+
+// IndexedCommunity returns community indexed by index, e.g. "public@17".
+func IndexedCommunity(community, index string) string {
+	return community + "@" + index
+}
+
+// viewLockMu guards the creation of the connection lock and the dispatcher
+// slot shared by a session and its views, and of the walk queue of a
+// session.
+var viewLockMu sync.Mutex //nolint:gochecknoglobals
+
+// WithOptions returns a view of the session with opts applied to all of its
+// calls, e.g. a longer timeout for a slow table or another community, rather
+// than changing the fields of a session shared by goroutines. The view uses
+// the connection, SNMPv3 security state and engine cache of x, and what any
+// of them learns about the agent, such as a security downgrade or its
+// msgMaxSize, applies to all; a stream reconnected by one is reconnected
+// for all.
+//
+// Once x has a view, the requests of x and of all its views are serialized
+// on the connection, so they may be used from different goroutines; derive
+// the views before x is used concurrently. Hooks must not send requests on
+// x or its views. A view must not be closed separately, and changing its
+// fields does not affect x.
+func (x *GoSNMP) WithOptions(opts ...RequestOption) *GoSNMP {
+	viewLockMu.Lock()
+	if x.connLock == nil {
+		x.connLock = &priorityLock{}
+	}
+	if s := x.shared(); s.async == nil {
+		s.async = &asyncSlot{}
+	}
+	viewLockMu.Unlock()
+
+	o := &requestOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	view := *x
+	if o.contextName != nil {
+		view.ContextName = *o.contextName
+	}
+	if o.contextEngineID != nil {
+		view.ContextEngineID = *o.contextEngineID
+	}
+	if o.timeout != nil {
+		view.Timeout = *o.timeout
+	}
+	if o.retries != nil {
+		view.Retries = *o.retries
+	}
+	if o.community != nil {
+		view.Community = *o.community
+	}
+	if o.maxRepetitions != nil {
+		view.MaxRepetitions = *o.maxRepetitions
+	}
+	if o.nonRepeaters != nil {
+		view.NonRepeaters = int(*o.nonRepeaters)
+	}
+	if o.communityIndex != nil {
+		view.Community = IndexedCommunity(view.Community, *o.communityIndex)
+	}
+	if o.ctx != nil {
+		view.Context = o.ctx
+	}
+	view.requestOpts = nil
+	view.walkLock = nil
+	if o.correlationID != nil || o.priority != nil {
+		view.requestOpts = &requestOptions{correlationID: o.correlationID, priority: o.priority}
+	}
+	view.owner = x.shared()
+	view.requestID = atomic.AddUint32(&x.requestID, engineViewIDStride)
+	view.msgID = atomic.AddUint32(&x.msgID, engineViewIDStride)
+	return &view
+}
+
+// shared returns the session whose connection and engine state x uses: the
+// session x is a view of, or x itself.
+func (x *GoSNMP) shared() *GoSNMP {
+	if x.owner != nil {
+		return x.owner
+	}
+	return x
+}
+
+// lockConn serializes the requests of a session and its views, and returns
+// the function releasing the connection. o are the options of the call.
+func (x *GoSNMP) lockConn(o *requestOptions) func() {
+	viewLockMu.Lock()
+	lock := x.connLock
+	viewLockMu.Unlock()
+	if lock == nil {
+		return func() {}
+	}
+	lock.lock(x.priority(o))
+	return lock.unlock
+}
+
+// callOptions returns the options of a call, opts applied on top of base,
+// the options of the view or of an enclosing call, which are not modified.
+func callOptions(base *requestOptions, opts []RequestOption) *requestOptions {
+	o := &requestOptions{}
+	if base != nil {
+		*o = *base
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// contextName returns the context name of the requests of a call with
+// options o.
+func (x *GoSNMP) contextName(o *requestOptions) string {
+	if o != nil && o.contextName != nil {
+		return *o.contextName
+	}
+	return x.ContextName
+}
+
+// contextEngineID returns the context engine ID of the requests of a call
+// with options o.
+func (x *GoSNMP) contextEngineID(o *requestOptions) string {
+	if o != nil && o.contextEngineID != nil {
+		return *o.contextEngineID
+	}
+	return x.ContextEngineID
+}
+
+// timeout returns the response timeout of a call with options o.
+func (x *GoSNMP) timeout(o *requestOptions) time.Duration {
+	if o != nil && o.timeout != nil {
+		return *o.timeout
+	}
+	return x.Timeout
+}
+
+// retries returns the retransmissions allowed to each request of a call
+// with options o.
+func (x *GoSNMP) retries(o *requestOptions) int {
+	retries := x.Retries
+	if o != nil && o.retries != nil {
+		retries = *o.retries
+	}
+	if retries < 0 {
+		return 0
+	}
+	return retries
+}
+
+// callDeadline returns the time the attempts of a call with options o end,
+// if bounded.
+func (o *requestOptions) callDeadline() (time.Time, bool) {
+	if o != nil && !o.deadline.IsZero() {
+		return o.deadline, true
+	}
+	return time.Time{}, false
+}
+
+// callContext returns the context of a call with options o.
+func (x *GoSNMP) callContext(o *requestOptions) context.Context {
+	if o != nil && o.ctx != nil {
+		return o.ctx
+	}
+	if x.Context != nil {
+		return x.Context
+	}
+	return context.Background()
+}
+
+// exponentialTimeout reports whether a call with options o doubles its
+// timeout on retransmission.
+func (x *GoSNMP) exponentialTimeout(o *requestOptions) bool {
+	if o != nil && o.exponential != nil {
+		return *o.exponential
+	}
+	return x.ExponentialTimeout
+}
+
+// maxRepetitions returns the GetBulk max-repetitions of the walks of a call
+// with options o.
+func (x *GoSNMP) maxRepetitions(o *requestOptions) uint32 {
+	if o != nil && o.maxRepetitions != nil {
+		return *o.maxRepetitions
+	}
+	if x.MaxRepetitions == 0 {
+		return defaultMaxRepetitions
+	}
+	return x.MaxRepetitions
+}
+
+// nonRepeaters returns the GetBulk non-repeaters of the walks of a call with
+// options o.
+func (x *GoSNMP) nonRepeaters(o *requestOptions) uint8 {
+	if o != nil && o.nonRepeaters != nil {
+		return *o.nonRepeaters
+	}
+	return uint8(x.NonRepeaters)
+}
+
+// community returns the community of the requests of a call with options o.
+func (x *GoSNMP) community(o *requestOptions) string {
+	community := x.Community
+	if o != nil && o.community != nil {
+		community = *o.community
+	}
+	if o != nil && o.communityIndex != nil {
+		community = IndexedCommunity(community, *o.communityIndex)
+	}
+	return community
+}
+
+// GetWithOptions is Get with per call options.
+func (x *GoSNMP) GetWithOptions(oids []string, opts ...RequestOption) (result *SnmpPacket, err error) {
+	return x.get(callOptions(x.requestOpts, opts), oids)
+}
+
+// GetNextWithOptions is GetNext with per call options.
+func (x *GoSNMP) GetNextWithOptions(oids []string, opts ...RequestOption) (result *SnmpPacket, err error) {
+	return x.getNext(callOptions(x.requestOpts, opts), oids)
+}
+
+// GetBulkWithOptions is GetBulk with per call options.
+func (x *GoSNMP) GetBulkWithOptions(oids []string, nonRepeaters uint8, maxRepetitions uint32,
+	opts ...RequestOption) (result *SnmpPacket, err error) {
+	o := callOptions(x.requestOpts, opts)
+	if o.maxRepetitions != nil {
+		maxRepetitions = *o.maxRepetitions
+	}
+	if o.nonRepeaters != nil {
+		nonRepeaters = *o.nonRepeaters
+	}
+	return x.getBulk(o, oids, nonRepeaters, maxRepetitions)
+}
+
+// SetWithOptions is Set with per call options.
+func (x *GoSNMP) SetWithOptions(pdus []SnmpPDU, opts ...RequestOption) (result *SnmpPacket, err error) {
+	return x.set(callOptions(x.requestOpts, opts), pdus)
+}
+
+// WalkWithOptions is Walk with per call options.
+func (x *GoSNMP) WalkWithOptions(rootOid string, walkFn WalkFunc, opts ...RequestOption) error {
+	o := callOptions(x.requestOpts, opts)
+	return x.queueWalk(o, func() error {
+		return x.walk(o, GetNextRequest, rootOid, walkFn)
+	})
+}
+
+// WalkAllWithOptions is WalkAll with per call options.
+func (x *GoSNMP) WalkAllWithOptions(rootOid string, opts ...RequestOption) (results []SnmpPDU, err error) {
+	o := callOptions(x.requestOpts, opts)
+	err = x.queueWalk(o, func() error {
+		results, err = x.walkAll(o, GetNextRequest, rootOid)
+		return err
+	})
+	return results, err
+}
+
+// BulkWalkWithOptions is BulkWalk with per call options.
+func (x *GoSNMP) BulkWalkWithOptions(rootOid string, walkFn WalkFunc, opts ...RequestOption) error {
+	o := callOptions(x.requestOpts, opts)
+	return x.queueWalk(o, func() error {
+		return x.walk(o, GetBulkRequest, rootOid, walkFn)
+	})
+}
+
+// BulkWalkAllWithOptions is BulkWalkAll with per call options.
+func (x *GoSNMP) BulkWalkAllWithOptions(rootOid string, opts ...RequestOption) (results []SnmpPDU, err error) {
+	o := callOptions(x.requestOpts, opts)
+	err = x.queueWalk(o, func() error {
+		results, err = x.walkAll(o, GetBulkRequest, rootOid)
+		return err
+	})
+	return results, err
+}
@@ -0,0 +1,230 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestOptionsContext(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	engineID := "\x80\x00\x00\x09\x03proxy"
+	go contextAgent(t, srvr, engineID)
+
+	x := &GoSNMP{
+		Version:         Version3,
+		Target:          srvr.LocalAddr().(*net.UDPAddr).IP.String(),
+		Port:            uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Timeout:         time.Millisecond * 500,
+		MaxOids:         MaxOids,
+		SecurityModel:   UserSecurityModel,
+		MsgFlags:        NoAuthNoPriv,
+		ContextName:     "default",
+		ContextEngineID: engineID,
+		SecurityParameters: &UsmSecurityParameters{
+			UserName:                 "user",
+			AuthoritativeEngineID:    engineID,
+			AuthoritativeEngineBoots: 1,
+			AuthoritativeEngineTime:  10,
+		},
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	value := func(pdu SnmpPDU) string { return string(pdu.Value.([]byte)) }
+
+	result, err := x.GetWithOptions([]string{".1.3.6.1.2.1.1.5.0"}, WithContextName("vlan-10"))
+	require.NoError(t, err)
+	assert.Equal(t, "vlan-10@"+engineID, value(result.Variables[0]))
+
+	results, err := x.WalkAllWithOptions(".1.3.6.1.2.1.1.5", WithContextName("vlan-20"), WithContextEngineID("\x80\x00\x00\x09\x03sw2"))
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "vlan-20@\x80\x00\x00\x09\x03sw2", value(results[0]))
+
+	// the session settings are untouched
+	assert.Equal(t, "default", x.ContextName)
+	assert.Equal(t, engineID, x.ContextEngineID)
+	result, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, "default@"+engineID, value(result.Variables[0]))
+}
+
+func TestWithOptionsView(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	engineID := "\x80\x00\x00\x09\x03proxy"
+	go contextAgent(t, srvr, engineID)
+
+	x := &GoSNMP{
+		Version:         Version3,
+		Target:          srvr.LocalAddr().(*net.UDPAddr).IP.String(),
+		Port:            uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Timeout:         time.Millisecond * 500,
+		MaxOids:         MaxOids,
+		SecurityModel:   UserSecurityModel,
+		MsgFlags:        NoAuthNoPriv,
+		ContextName:     "default",
+		ContextEngineID: engineID,
+		Community:       "public",
+		SecurityParameters: &UsmSecurityParameters{
+			UserName:                 "user",
+			AuthoritativeEngineID:    engineID,
+			AuthoritativeEngineBoots: 1,
+			AuthoritativeEngineTime:  10,
+		},
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	value := func(pdu SnmpPDU) string { return string(pdu.Value.([]byte)) }
+
+	view := x.WithOptions(WithContextName("vlan-10"), WithTimeout(2*time.Second), WithCommunity("private"))
+	assert.Equal(t, "vlan-10", view.ContextName)
+	assert.Equal(t, 2*time.Second, view.Timeout)
+	assert.Equal(t, "private", view.Community)
+	assert.Equal(t, "default", x.ContextName)
+	assert.Equal(t, time.Millisecond*500, x.Timeout)
+	assert.Equal(t, "public", x.Community)
+
+	var community string
+	view.BeforeSend = func(p *SnmpPacket, b []byte) []byte {
+		community = p.Community
+		return b
+	}
+	result, err := view.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, "vlan-10@"+engineID, value(result.Variables[0]))
+	assert.Equal(t, "private", community)
+
+	// per call options apply on top of those of the view
+	result, err = view.GetWithOptions([]string{".1.3.6.1.2.1.1.5.0"}, WithContextName("vlan-20"), WithCommunity("other"))
+	require.NoError(t, err)
+	assert.Equal(t, "vlan-20@"+engineID, value(result.Variables[0]))
+	assert.Equal(t, "other", community)
+
+	// the session and its views can be used concurrently
+	views := []*GoSNMP{x, view, x.WithOptions(WithContextName("vlan-30"))}
+	want := []string{"default", "vlan-10", "vlan-30"}
+	var wg sync.WaitGroup
+	for i := range views {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; n < 20; n++ {
+				result, err := views[i].Get([]string{".1.3.6.1.2.1.1.5.0"})
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.Equal(t, want[i]+"@"+engineID, value(result.Variables[0]))
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestWithCommunityIndex(t *testing.T) {
+	x := &GoSNMP{Community: "public"}
+	o := callOptions(x.requestOpts, []RequestOption{WithCommunityIndex("17")})
+	assert.Equal(t, "public@17", x.community(o))
+	o = callOptions(x.requestOpts, []RequestOption{WithCommunity("private"), WithCommunityIndex("5")})
+	assert.Equal(t, "private@5", x.community(o))
+	assert.Equal(t, "public", x.community(x.requestOpts))
+
+	view := x.WithOptions(WithCommunityIndex("17"))
+	assert.Equal(t, "public@17", view.Community)
+	assert.Equal(t, "public", x.Community)
+}
+
+func TestWithMaxRepetitions(t *testing.T) {
+	x := &GoSNMP{MaxRepetitions: 50, NonRepeaters: 1}
+	o := callOptions(x.requestOpts, []RequestOption{WithMaxRepetitions(5), WithNonRepeaters(0)})
+	assert.Equal(t, uint32(5), x.maxRepetitions(o))
+	assert.Equal(t, uint8(0), x.nonRepeaters(o))
+	assert.Equal(t, uint32(50), x.maxRepetitions(x.requestOpts))
+	assert.Equal(t, uint8(1), x.nonRepeaters(x.requestOpts))
+
+	view := x.WithOptions(WithMaxRepetitions(200))
+	assert.Equal(t, uint32(200), view.maxRepetitions(view.requestOpts))
+	assert.Equal(t, uint32(50), x.MaxRepetitions)
+}
+
+func TestWithRetries(t *testing.T) {
+	// the agent never answers
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	sent := 0
+	x := &GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Community: "public",
+		Version:   Version2c,
+		Timeout:   time.Second,
+		Retries:   3,
+		MaxOids:   MaxOids,
+		OnSent:    func(*GoSNMP) { sent++ },
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	probe := []RequestOption{WithTimeout(10 * time.Millisecond), WithRetries(0)}
+	_, err = x.GetWithOptions([]string{".1.3.6.1.2.1.1.3.0"}, probe...)
+	require.Error(t, err)
+	assert.Equal(t, 1, sent, "a probe is sent once")
+
+	sent = 0
+	_, err = x.WithOptions(WithTimeout(10*time.Millisecond), WithRetries(2)).Get([]string{".1.3.6.1.2.1.1.3.0"})
+	require.Error(t, err)
+	assert.Equal(t, 3, sent, "sent and retried twice")
+	assert.Equal(t, 3, x.Retries)
+	assert.Equal(t, time.Second, x.Timeout)
+
+	x.Retries = -1
+	assert.Equal(t, 0, x.retries(x.requestOpts))
+}
+
+func TestRequestOptionsPerCall(t *testing.T) {
+	a := NewAgent()
+	a.Handler = &testAgentHandler{vars: testAgentVars()}
+	x := startAgent(t, a, Version2c, "public")
+	view := x.WithOptions(WithPriority(PriorityInteractive))
+
+	var seen []*requestOptions
+	view.BeforeSend = func(packet *SnmpPacket, msg []byte) []byte {
+		// the options go with the request, not on the session
+		assert.Nil(t, x.requestOpts)
+		seen = append(seen, packet.opts)
+		return msg
+	}
+	_, err := view.GetWithOptions([]string{".1.3.6.1.2.1.1.1.0"}, WithTimeout(2*time.Second), WithRetries(0))
+	require.NoError(t, err)
+	_, err = view.Get([]string{".1.3.6.1.2.1.1.1.0"})
+	require.NoError(t, err)
+
+	require.Len(t, seen, 2)
+	assert.Equal(t, 2*time.Second, view.timeout(seen[0]))
+	assert.Equal(t, 0, view.retries(seen[0]))
+	assert.Equal(t, PriorityInteractive, view.priority(seen[0]), "on top of the options of the view")
+	assert.Equal(t, time.Second, view.timeout(seen[1]))
+	assert.Equal(t, PriorityInteractive, view.priority(seen[1]))
+	assert.Equal(t, PriorityInteractive, view.priority(view.requestOpts))
+	assert.Nil(t, view.requestOpts.timeout, "the options of the view are not modified")
+}
@@ -0,0 +1,169 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// RequestPriority orders the requests waiting for a connection shared by a
+// session and its views, see WithOptions.
+type RequestPriority int
+
+const (
+	// PriorityBackground is for bulk collection, e.g. long walks, which
+	// yield to the other requests between their requests.
+	PriorityBackground RequestPriority = -1
+	// PriorityNormal is the priority of requests without WithPriority.
+	PriorityNormal RequestPriority = 0
+	// PriorityInteractive is for requests a user waits for, e.g. a Get
+	// triggered by a UI, which go before the other requests waiting.
+	PriorityInteractive RequestPriority = 1
+)
+
+func (p RequestPriority) String() string {
+	switch p {
+	case PriorityBackground:
+		return "Background"
+	case PriorityNormal:
+		return "Normal"
+	case PriorityInteractive:
+		return "Interactive"
+	}
+	return fmt.Sprintf("RequestPriority(%d)", int(p))
+}
+
+// maxPriorityBypass is the number of times in a row requests of a higher
+// priority may go before a waiting request of lower priority, after which
+// the request waiting longest goes first.
+const maxPriorityBypass = 8
+
+// WithPriority queues the requests of a call with priority p when waiting
+// for the connection of the session, which is shared with its views. Give
+// an interactive view of a session priority over the background walks of
+// another view of it with
+//
+//	ui := session.WithOptions(gosnmp.WithPriority(gosnmp.PriorityInteractive))
+//	bulk := session.WithOptions(gosnmp.WithPriority(gosnmp.PriorityBackground))
+//
+// Requests are never interrupted, a request waits at most for the one in
+// progress. So that lower priorities are not starved, a request waiting
+// while maxPriorityBypass requests of higher priority went before it goes
+// next. Without views the requests of a session are not queued.
+// Asynchronous requests waiting to be written, see GetAsync, are queued by
+// priority too; views derived from a session once it is asynchronous share
+// its queue.
+func WithPriority(p RequestPriority) RequestOption {
+	return func(o *requestOptions) {
+		o.priority = &p
+	}
+}
+
+// priority returns the priority of a call with options o.
+func (x *GoSNMP) priority(o *requestOptions) RequestPriority {
+	if o != nil && o.priority != nil {
+		return *o.priority
+	}
+	return PriorityNormal
+}
+
+// priorityLock is a mutual exclusion lock granted by priority, with the
+// starvation protection described by WithPriority.
+type priorityLock struct {
+	mu      sync.Mutex
+	held    bool
+	waiting []*priorityWaiter
+	bypass  int
+}
+
+type priorityWaiter struct {
+	priority RequestPriority
+	granted  chan struct{}
+}
+
+// lock waits for the lock with priority p.
+func (l *priorityLock) lock(p RequestPriority) {
+	l.mu.Lock()
+	if !l.held {
+		l.held = true
+		l.mu.Unlock()
+		return
+	}
+	w := &priorityWaiter{priority: p, granted: make(chan struct{})}
+	l.waiting = append(l.waiting, w)
+	l.mu.Unlock()
+	<-w.granted
+}
+
+// wait is lock failing with ErrBusy if maxWaiting requests are already
+// waiting, unless maxWaiting is 0, and with the error of ctx if it is done
+// before the lock is granted.
+func (l *priorityLock) wait(ctx context.Context, p RequestPriority, maxWaiting int) error {
+	l.mu.Lock()
+	if !l.held {
+		l.held = true
+		l.mu.Unlock()
+		return nil
+	}
+	if maxWaiting > 0 && len(l.waiting) >= maxWaiting {
+		n := len(l.waiting)
+		l.mu.Unlock()
+		return fmt.Errorf("%w: %d waiting", ErrBusy, n)
+	}
+	w := &priorityWaiter{priority: p, granted: make(chan struct{})}
+	l.waiting = append(l.waiting, w)
+	l.mu.Unlock()
+
+	select {
+	case <-w.granted:
+		return nil
+	case <-ctx.Done():
+	}
+	l.mu.Lock()
+	for i, other := range l.waiting {
+		if other == w {
+			l.waiting = append(l.waiting[:i], l.waiting[i+1:]...)
+			l.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+	l.mu.Unlock()
+	// granted meanwhile, pass it on
+	l.unlock()
+	return ctx.Err()
+}
+
+// unlock hands the lock to the next waiter, if any.
+func (l *priorityLock) unlock() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.waiting) == 0 {
+		l.held = false
+		l.bypass = 0
+		return
+	}
+	// waiters are in arrival order: the first of the highest priority
+	// goes next, unless it already went before others too often
+	next := 0
+	for i, w := range l.waiting {
+		if w.priority > l.waiting[next].priority {
+			next = i
+		}
+	}
+	if next != 0 && l.waiting[0].priority < l.waiting[next].priority {
+		l.bypass++
+		if l.bypass > maxPriorityBypass {
+			next = 0
+		}
+	}
+	if next == 0 {
+		l.bypass = 0
+	}
+	w := l.waiting[next]
+	l.waiting = append(l.waiting[:next], l.waiting[next+1:]...)
+	close(w.granted)
+}
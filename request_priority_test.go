@@ -0,0 +1,88 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// queueWaiter makes name wait for l with priority p, sending name on
+// granted once it holds the lock.
+func queueWaiter(t *testing.T, l *priorityLock, name string, p RequestPriority, granted chan<- string) {
+	l.mu.Lock()
+	queued := len(l.waiting)
+	l.mu.Unlock()
+	go func() {
+		l.lock(p)
+		granted <- name
+	}()
+	require.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return len(l.waiting) == queued+1
+	}, time.Second, time.Millisecond)
+}
+
+func TestPriorityLockOrder(t *testing.T) {
+	l := &priorityLock{}
+	granted := make(chan string, 10)
+	l.lock(PriorityNormal)
+	queueWaiter(t, l, "walk1", PriorityBackground, granted)
+	queueWaiter(t, l, "poll", PriorityNormal, granted)
+	queueWaiter(t, l, "walk2", PriorityBackground, granted)
+	queueWaiter(t, l, "ui", PriorityInteractive, granted)
+
+	var order []string
+	for i := 0; i < 4; i++ {
+		l.unlock()
+		order = append(order, <-granted)
+	}
+	assert.Equal(t, []string{"ui", "poll", "walk1", "walk2"}, order)
+	l.unlock()
+	assert.False(t, l.held)
+}
+
+func TestPriorityLockStarvation(t *testing.T) {
+	l := &priorityLock{}
+	granted := make(chan string, 20)
+	l.lock(PriorityNormal)
+	queueWaiter(t, l, "walk", PriorityBackground, granted)
+
+	var order []string
+	for i := 0; i <= maxPriorityBypass; i++ {
+		queueWaiter(t, l, "ui", PriorityInteractive, granted)
+		l.unlock()
+		order = append(order, <-granted)
+	}
+	assert.Equal(t, "walk", order[maxPriorityBypass], "the background request went after %d interactive ones", maxPriorityBypass)
+	for _, name := range order[:maxPriorityBypass] {
+		assert.Equal(t, "ui", name)
+	}
+	l.unlock()
+	assert.Equal(t, "ui", <-granted)
+	l.unlock()
+}
+
+func TestWithPriorityView(t *testing.T) {
+	x := &GoSNMP{}
+	ui := x.WithOptions(WithPriority(PriorityInteractive), WithCorrelationID("ui-1"))
+	bulk := x.WithOptions(WithPriority(PriorityBackground))
+	assert.Equal(t, PriorityInteractive, ui.priority(ui.requestOpts))
+	assert.Equal(t, PriorityBackground, bulk.priority(bulk.requestOpts))
+	assert.Equal(t, PriorityNormal, x.priority(x.requestOpts))
+	assert.Same(t, x.connLock, ui.connLock)
+	assert.Equal(t, "Interactive", PriorityInteractive.String())
+
+	o := callOptions(bulk.requestOpts, []RequestOption{WithPriority(PriorityInteractive)})
+	assert.Equal(t, PriorityInteractive, bulk.priority(o))
+	assert.Equal(t, PriorityBackground, bulk.priority(bulk.requestOpts))
+}
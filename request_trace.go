@@ -0,0 +1,164 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// AttemptEventKind describes what happened during one attempt of a request.
+type AttemptEventKind uint8
+
+// Attempt event kinds.
+const (
+	// AttemptSent: the request was written to the socket.
+	AttemptSent AttemptEventKind = iota
+	// AttemptSendError: writing the request failed.
+	AttemptSendError
+	// AttemptTimeout: no valid response arrived before the deadline.
+	AttemptTimeout
+	// AttemptReceiveError: reading failed, e.g. an ICMP port unreachable
+	// reported as "connection refused".
+	AttemptReceiveError
+	// AttemptDecodeError: a message arrived but could not be decoded or
+	// authenticated.
+	AttemptDecodeError
+	// AttemptOutOfOrder: a response with an unknown request ID was dropped.
+	AttemptOutOfOrder
+	// AttemptReconnect: the stream was closed by the agent and reopened.
+	AttemptReconnect
+)
+
+func (k AttemptEventKind) String() string {
+	switch k {
+	case AttemptSent:
+		return "sent"
+	case AttemptSendError:
+		return "send error"
+	case AttemptTimeout:
+		return "timeout"
+	case AttemptReceiveError:
+		return "receive error"
+	case AttemptDecodeError:
+		return "decode error"
+	case AttemptOutOfOrder:
+		return "out of order"
+	case AttemptReconnect:
+		return "reconnect"
+	}
+	return fmt.Sprintf("AttemptEventKind(%d)", uint8(k))
+}
+
+// AttemptEvent is one entry in the timeline of a request.
+type AttemptEvent struct {
+	// Attempt is the transmission the event belongs to, 0 for the first.
+	Attempt int
+	Kind    AttemptEventKind
+	Time    time.Time
+
+	// Timeout is the wait for a response, set on AttemptSent.
+	Timeout time.Duration
+
+	// RequestID is the request ID of the transmission.
+	RequestID uint32
+
+	Err error
+}
+
+// RequestTrace is the per-attempt timeline of a request.
+type RequestTrace []AttemptEvent
+
+// String formats the trace with times relative to the first event, e.g.
+// "#0 +0s sent (timeout 1s); #0 +1s timeout; #1 +1s sent (timeout 1s); ...".
+func (t RequestTrace) String() string {
+	if len(t) == 0 {
+		return ""
+	}
+	start := t[0].Time
+	parts := make([]string, 0, len(t))
+	for _, ev := range t {
+		s := fmt.Sprintf("#%d +%s %s", ev.Attempt, ev.Time.Sub(start).Round(time.Millisecond), ev.Kind)
+		if ev.Kind == AttemptSent {
+			s += fmt.Sprintf(" (timeout %s)", ev.Timeout)
+		}
+		if ev.Err != nil && ev.Kind != AttemptTimeout {
+			s += ": " + ev.Err.Error()
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// RequestError is returned when a request fails after all attempts. It
+// carries the timeline of the attempts so that packet loss, a slow agent
+// and a silent agent can be told apart; the message is that of Err.
+type RequestError struct {
+	Err   error
+	Trace RequestTrace
+	// CorrelationID identifies the operation of the request, see
+	// GoSNMP.CorrelationID.
+	CorrelationID string
+}
+
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// Attempts returns the number of times the request was transmitted.
+func (e *RequestError) Attempts() int {
+	n := 0
+	for _, ev := range e.Trace {
+		if ev.Kind == AttemptSent {
+			n++
+		}
+	}
+	return n
+}
+
+// RequestTraceOf returns the attempt timeline attached to err, if any.
+func RequestTraceOf(err error) (RequestTrace, bool) {
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.Trace, true
+	}
+	return nil, false
+}
+
+// record appends an event to the trace, classifying socket deadline errors
+// as timeouts.
+func (t *RequestTrace) record(attempt int, kind AttemptEventKind, reqID uint32, err error) {
+	if kind == AttemptReceiveError || kind == AttemptSendError {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			kind = AttemptTimeout
+		}
+	}
+	*t = append(*t, AttemptEvent{
+		Attempt:   attempt,
+		Kind:      kind,
+		Time:      time.Now(),
+		RequestID: reqID,
+		Err:       err,
+	})
+}
+
+func (t *RequestTrace) sent(attempt int, reqID uint32, deadline time.Time) {
+	now := time.Now()
+	*t = append(*t, AttemptEvent{
+		Attempt:   attempt,
+		Kind:      AttemptSent,
+		Time:      now,
+		Timeout:   deadline.Sub(now),
+		RequestID: reqID,
+	})
+}
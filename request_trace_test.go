@@ -0,0 +1,76 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestTrace(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	// answer the first transmission with garbage, then stay silent
+	go func() {
+		buf := make([]byte, 1500)
+		_, addr, err := srvr.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		_, _ = srvr.WriteTo([]byte{0x30, 0x03, 0x02, 0x01, 0x07}, addr)
+		for {
+			if _, _, err := srvr.ReadFrom(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	x := &GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Version:   Version2c,
+		Community: "public",
+		Timeout:   50 * time.Millisecond,
+		Retries:   1,
+		MaxOids:   MaxOids,
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.1.0"})
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "timeout"), err.Error())
+
+	var reqErr *RequestError
+	require.True(t, errors.As(err, &reqErr))
+	assert.Equal(t, 2, reqErr.Attempts())
+	trace, ok := RequestTraceOf(err)
+	require.True(t, ok)
+
+	var kinds []AttemptEventKind
+	for _, ev := range trace {
+		kinds = append(kinds, ev.Kind)
+	}
+	assert.Equal(t, []AttemptEventKind{AttemptSent, AttemptDecodeError, AttemptSent, AttemptTimeout}, kinds)
+	assert.Equal(t, 0, trace[0].Attempt)
+	assert.Equal(t, 1, trace[3].Attempt)
+	assert.NotEqual(t, trace[0].RequestID, trace[2].RequestID)
+	assert.True(t, trace[0].Timeout > 0 && trace[0].Timeout <= x.Timeout)
+	assert.True(t, strings.HasPrefix(trace.String(), "#0 +0s sent (timeout "), trace.String())
+
+	_, ok = RequestTraceOf(errors.New("other"))
+	assert.False(t, ok)
+}
@@ -0,0 +1,49 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import "fmt"
+
+// Response returns the Response PDU answering the request packet with
+// variables. The message parameters are those of the request: version,
+// community, security model and a copy of the security parameters, message
+// and request IDs and context, with the reportable flag cleared (RFC 3412
+// section 7.1). Agents answering SNMPv3 requests set their authoritative
+// engine parameters on the copy.
+func (packet *SnmpPacket) Response(variables []SnmpPDU) *SnmpPacket {
+	resp := &SnmpPacket{
+		Version:         packet.Version,
+		MsgFlags:        packet.MsgFlags &^ Reportable,
+		SecurityModel:   packet.SecurityModel,
+		ContextEngineID: packet.ContextEngineID,
+		ContextName:     packet.ContextName,
+		Community:       packet.Community,
+		PDUType:         GetResponse,
+		MsgID:           packet.MsgID,
+		RequestID:       packet.RequestID,
+		Variables:       variables,
+		Logger:          packet.Logger,
+		strictAuth:      packet.strictAuth,
+	}
+	if packet.SecurityParameters != nil {
+		resp.SecurityParameters = packet.SecurityParameters.Copy()
+	}
+	return resp
+}
+
+// ErrorResponse returns the Response PDU answering the request packet with
+// the error status, e.g. NoSuchName or NotWritable. As RFC 3416 requires for
+// errors, the variable bindings are those of the request. index is the
+// position of the variable in error, starting at 1, or 0 when no single
+// variable is at fault.
+func (packet *SnmpPacket) ErrorResponse(status SNMPError, index int) (*SnmpPacket, error) {
+	if index < 0 || index > len(packet.Variables) || index > 255 {
+		return nil, fmt.Errorf("error index %d out of range for %d variables", index, len(packet.Variables))
+	}
+	resp := packet.Response(append([]SnmpPDU(nil), packet.Variables...))
+	resp.Error = status
+	resp.ErrorIndex = uint8(index)
+	return resp, nil
+}
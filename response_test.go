@@ -0,0 +1,83 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || marshal
+// +build all marshal
+
+package gosnmp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorResponseEchoesVariables(t *testing.T) {
+	request := &SnmpPacket{
+		Version:   Version2c,
+		Community: "public",
+		PDUType:   SetRequest,
+		RequestID: 42,
+		Variables: []SnmpPDU{
+			{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "name"},
+			{Name: ".1.3.6.1.2.1.1.3.0", Type: TimeTicks, Value: uint32(5)},
+		},
+	}
+	resp, err := request.ErrorResponse(NotWritable, 2)
+	require.NoError(t, err)
+
+	msg, err := resp.MarshalMsg()
+	require.NoError(t, err)
+	decoded, err := (&GoSNMP{Version: Version2c}).SnmpDecodePacket(msg)
+	require.NoError(t, err)
+	assert.Equal(t, GetResponse, decoded.PDUType)
+	assert.Equal(t, "public", decoded.Community)
+	assert.Equal(t, uint32(42), decoded.RequestID)
+	assert.Equal(t, NotWritable, decoded.Error)
+	assert.Equal(t, uint8(2), decoded.ErrorIndex)
+	require.Len(t, decoded.Variables, 2)
+	assert.Equal(t, ".1.3.6.1.2.1.1.3.0", decoded.Variables[1].Name)
+	assert.Equal(t, uint32(5), decoded.Variables[1].Value)
+
+	// the request is left untouched
+	assert.Equal(t, SetRequest, request.PDUType)
+	resp.Variables[0].Name = ".1.3"
+	assert.Equal(t, ".1.3.6.1.2.1.1.5.0", request.Variables[0].Name)
+
+	_, err = request.ErrorResponse(GenErr, 3)
+	assert.Error(t, err)
+	_, err = request.ErrorResponse(GenErr, -1)
+	assert.Error(t, err)
+}
+
+func TestResponseV3(t *testing.T) {
+	request := &SnmpPacket{
+		Version:            Version3,
+		MsgFlags:           NoAuthNoPriv | Reportable,
+		SecurityModel:      UserSecurityModel,
+		SecurityParameters: &UsmSecurityParameters{UserName: "user", AuthoritativeEngineID: "engine"},
+		MsgID:              7,
+		RequestID:          8,
+		ContextEngineID:    "engine",
+		ContextName:        "vlan-10",
+		PDUType:            GetRequest,
+		Variables:          []SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: Null}},
+	}
+	resp := request.Response([]SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "agent"}})
+	assert.Equal(t, NoAuthNoPriv, resp.MsgFlags)
+	assert.Equal(t, uint32(7), resp.MsgID)
+	assert.Equal(t, uint32(8), resp.RequestID)
+	assert.Equal(t, "vlan-10", resp.ContextName)
+	assert.NotSame(t, request.SecurityParameters, resp.SecurityParameters)
+	assert.Equal(t, "user", resp.SecurityParameters.(*UsmSecurityParameters).UserName)
+
+	msg, err := resp.MarshalMsg()
+	require.NoError(t, err)
+	x := &GoSNMP{Version: Version3, SecurityModel: UserSecurityModel}
+	decoded, err := x.SnmpDecodePacket(msg)
+	require.NoError(t, err)
+	assert.Equal(t, GetResponse, decoded.PDUType)
+	assert.Equal(t, "agent", string(decoded.Variables[0].Value.([]byte)))
+}
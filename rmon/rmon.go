@@ -0,0 +1,548 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+// Package rmon collects the RMON alarm and event groups of RFC 2819: the
+// alarmTable, which samples a variable and compares it with thresholds, the
+// eventTable of the events triggered and the logTable of events logged. The
+// rows are decoded into Go types, e.g. intervals as time.Duration, and
+// AlarmState evaluates the threshold hysteresis the way agents do, for
+// tooling that tunes thresholds:
+//
+//	tables, err := rmon.Collect(x)
+//	for _, alarm := range tables.Alarms {
+//		event, _ := tables.Event(alarm.RisingEventIndex)
+//		...
+//	}
+//	_, err = x.Set(rmon.ThresholdPDUs(alarm.Index, 90, 70))
+package rmon
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// Tables of the RMON-MIB alarm and event groups.
+const (
+	AlarmTable = ".1.3.6.1.2.1.16.3.1"
+	EventTable = ".1.3.6.1.2.1.16.9.1"
+	LogTable   = ".1.3.6.1.2.1.16.9.2"
+
+	alarmEntry = AlarmTable + ".1"
+	eventEntry = EventTable + ".1"
+	logEntry   = LogTable + ".1"
+)
+
+// SampleType is alarmSampleType.
+type SampleType int
+
+// Sample types.
+const (
+	// AbsoluteValue compares the value of the variable with the
+	// thresholds.
+	AbsoluteValue SampleType = 1
+	// DeltaValue compares the change of the variable over the interval.
+	DeltaValue SampleType = 2
+)
+
+func (t SampleType) String() string {
+	switch t {
+	case AbsoluteValue:
+		return "absoluteValue"
+	case DeltaValue:
+		return "deltaValue"
+	}
+	return "SampleType(" + strconv.Itoa(int(t)) + ")"
+}
+
+// StartupAlarm is alarmStartupAlarm, the alarms the first sample may
+// trigger.
+type StartupAlarm int
+
+// Startup alarms.
+const (
+	RisingAlarm          StartupAlarm = 1
+	FallingAlarm         StartupAlarm = 2
+	RisingOrFallingAlarm StartupAlarm = 3
+)
+
+func (a StartupAlarm) String() string {
+	switch a {
+	case RisingAlarm:
+		return "risingAlarm"
+	case FallingAlarm:
+		return "fallingAlarm"
+	case RisingOrFallingAlarm:
+		return "risingOrFallingAlarm"
+	}
+	return "StartupAlarm(" + strconv.Itoa(int(a)) + ")"
+}
+
+// EntryStatus is the RMON EntryStatus of a row.
+type EntryStatus int
+
+// Entry statuses.
+const (
+	Valid         EntryStatus = 1
+	CreateRequest EntryStatus = 2
+	UnderCreation EntryStatus = 3
+	Invalid       EntryStatus = 4
+)
+
+func (s EntryStatus) String() string {
+	switch s {
+	case Valid:
+		return "valid"
+	case CreateRequest:
+		return "createRequest"
+	case UnderCreation:
+		return "underCreation"
+	case Invalid:
+		return "invalid"
+	}
+	return "EntryStatus(" + strconv.Itoa(int(s)) + ")"
+}
+
+// EventType is eventType, what an event does when triggered.
+type EventType int
+
+// Event types.
+const (
+	EventNone       EventType = 1
+	EventLog        EventType = 2
+	EventTrap       EventType = 3
+	EventLogAndTrap EventType = 4
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventNone:
+		return "none"
+	case EventLog:
+		return "log"
+	case EventTrap:
+		return "snmptrap"
+	case EventLogAndTrap:
+		return "logandtrap"
+	}
+	return "EventType(" + strconv.Itoa(int(t)) + ")"
+}
+
+// Logs reports whether the event adds an entry to the logTable.
+func (t EventType) Logs() bool {
+	return t == EventLog || t == EventLogAndTrap
+}
+
+// Traps reports whether the event sends a trap.
+func (t EventType) Traps() bool {
+	return t == EventTrap || t == EventLogAndTrap
+}
+
+// Alarm is a row of the alarmTable.
+type Alarm struct {
+	Index int
+	// Interval is the time between two samples.
+	Interval time.Duration
+	// Variable is the OID of the sampled variable.
+	Variable   string
+	SampleType SampleType
+	// Value is the last sample.
+	Value             int64
+	StartupAlarm      StartupAlarm
+	RisingThreshold   int64
+	FallingThreshold  int64
+	RisingEventIndex  int
+	FallingEventIndex int
+	Owner             string
+	Status            EntryStatus
+}
+
+// Event is a row of the eventTable.
+type Event struct {
+	Index       int
+	Description string
+	Type        EventType
+	// Community is the community of the traps sent.
+	Community string
+	// LastTimeSent is the sysUpTime at which the event was last triggered.
+	LastTimeSent time.Duration
+	Owner        string
+	Status       EntryStatus
+}
+
+// LogEntry is a row of the logTable, an event logged.
+type LogEntry struct {
+	EventIndex int
+	Index      int
+	// Time is the sysUpTime at which the entry was created.
+	Time        time.Duration
+	Description string
+}
+
+// Tables are the alarm, event and log tables of an agent. The tables an
+// agent does not implement are empty.
+type Tables struct {
+	Alarms []Alarm
+	Events []Event
+	Logs   []LogEntry
+}
+
+// Event returns the event of index, e.g. Alarm.RisingEventIndex.
+func (t *Tables) Event(index int) (Event, bool) {
+	for _, e := range t.Events {
+		if e.Index == index {
+			return e, true
+		}
+	}
+	return Event{}, false
+}
+
+// LogsOf returns the log entries of the event of index.
+func (t *Tables) LogsOf(index int) []LogEntry {
+	var out []LogEntry
+	for _, l := range t.Logs {
+		if l.EventIndex == index {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// Collect walks the alarm, event and log tables of the agent of x.
+func Collect(x *gosnmp.GoSNMP) (*Tables, error) {
+	walk := x.BulkWalkAll
+	if x.Version == gosnmp.Version1 {
+		walk = x.WalkAll
+	}
+	tables := &Tables{}
+	pdus, err := walk(AlarmTable)
+	if err == nil {
+		tables.Alarms, err = DecodeAlarms(pdus)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("alarmTable: %w", err)
+	}
+	pdus, err = walk(EventTable)
+	if err == nil {
+		tables.Events, err = DecodeEvents(pdus)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("eventTable: %w", err)
+	}
+	pdus, err = walk(LogTable)
+	if err == nil {
+		tables.Logs, err = DecodeLogs(pdus)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("logTable: %w", err)
+	}
+	return tables, nil
+}
+
+// DecodeAlarms decodes the rows of alarmTable variables, ordered by index.
+// Variables outside the table are ignored.
+func DecodeAlarms(pdus []gosnmp.SnmpPDU) ([]Alarm, error) {
+	rows := make(map[string]*Alarm)
+	err := decodeRows(pdus, alarmEntry, 1, func(column int, index []int, pdu gosnmp.SnmpPDU) error {
+		key := indexKey(index)
+		a := rows[key]
+		if a == nil {
+			a = &Alarm{Index: index[0]}
+			rows[key] = a
+		}
+		var err error
+		switch column {
+		case 2:
+			var v int64
+			v, err = integer(pdu)
+			a.Interval = time.Duration(v) * time.Second
+		case 3:
+			a.Variable, err = objectIdentifier(pdu)
+		case 4:
+			var v int
+			v, err = intValue(pdu)
+			a.SampleType = SampleType(v)
+		case 5:
+			a.Value, err = integer(pdu)
+		case 6:
+			var v int
+			v, err = intValue(pdu)
+			a.StartupAlarm = StartupAlarm(v)
+		case 7:
+			a.RisingThreshold, err = integer(pdu)
+		case 8:
+			a.FallingThreshold, err = integer(pdu)
+		case 9:
+			a.RisingEventIndex, err = intValue(pdu)
+		case 10:
+			a.FallingEventIndex, err = intValue(pdu)
+		case 11:
+			a.Owner, err = str(pdu)
+		case 12:
+			var v int
+			v, err = intValue(pdu)
+			a.Status = EntryStatus(v)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Alarm, 0, len(rows))
+	for _, a := range rows {
+		out = append(out, *a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Index < out[j].Index })
+	return out, nil
+}
+
+// DecodeEvents decodes the rows of eventTable variables, ordered by index.
+func DecodeEvents(pdus []gosnmp.SnmpPDU) ([]Event, error) {
+	rows := make(map[string]*Event)
+	err := decodeRows(pdus, eventEntry, 1, func(column int, index []int, pdu gosnmp.SnmpPDU) error {
+		key := indexKey(index)
+		e := rows[key]
+		if e == nil {
+			e = &Event{Index: index[0]}
+			rows[key] = e
+		}
+		var err error
+		switch column {
+		case 2:
+			e.Description, err = str(pdu)
+		case 3:
+			var v int
+			v, err = intValue(pdu)
+			e.Type = EventType(v)
+		case 4:
+			e.Community, err = str(pdu)
+		case 5:
+			e.LastTimeSent, err = timeTicks(pdu)
+		case 6:
+			e.Owner, err = str(pdu)
+		case 7:
+			var v int
+			v, err = intValue(pdu)
+			e.Status = EntryStatus(v)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Event, 0, len(rows))
+	for _, e := range rows {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Index < out[j].Index })
+	return out, nil
+}
+
+// DecodeLogs decodes the rows of logTable variables, ordered by event and
+// log index.
+func DecodeLogs(pdus []gosnmp.SnmpPDU) ([]LogEntry, error) {
+	rows := make(map[string]*LogEntry)
+	err := decodeRows(pdus, logEntry, 2, func(column int, index []int, pdu gosnmp.SnmpPDU) error {
+		key := indexKey(index)
+		l := rows[key]
+		if l == nil {
+			l = &LogEntry{EventIndex: index[0], Index: index[1]}
+			rows[key] = l
+		}
+		var err error
+		switch column {
+		case 3:
+			l.Time, err = timeTicks(pdu)
+		case 4:
+			l.Description, err = str(pdu)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]LogEntry, 0, len(rows))
+	for _, l := range rows {
+		out = append(out, *l)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].EventIndex != out[j].EventIndex {
+			return out[i].EventIndex < out[j].EventIndex
+		}
+		return out[i].Index < out[j].Index
+	})
+	return out, nil
+}
+
+// Crossing is the alarm a sample triggers.
+type Crossing int
+
+// Crossings.
+const (
+	NoCrossing Crossing = iota
+	RisingCrossing
+	FallingCrossing
+)
+
+func (c Crossing) String() string {
+	switch c {
+	case NoCrossing:
+		return "none"
+	case RisingCrossing:
+		return "rising"
+	case FallingCrossing:
+		return "falling"
+	}
+	return "Crossing(" + strconv.Itoa(int(c)) + ")"
+}
+
+// AlarmState evaluates the samples of an alarm as RFC 2819 specifies, e.g.
+// to replay samples against new thresholds before setting them. After a
+// rising alarm, another one is only triggered once the samples have fallen
+// to the falling threshold, and conversely, so that a value hovering around
+// a threshold does not trigger a flood of events.
+type AlarmState struct {
+	Alarm Alarm
+
+	last    Crossing
+	sampled bool
+}
+
+// Sample returns the alarm triggered by the next sample, the value of the
+// variable for AbsoluteValue alarms or its change over the interval for
+// DeltaValue alarms.
+func (s *AlarmState) Sample(value int64) Crossing {
+	a := &s.Alarm
+	rising := value >= a.RisingThreshold
+	falling := value <= a.FallingThreshold
+	if !s.sampled {
+		// the first sample only triggers the startup alarm, but arms the
+		// thresholds as if it had triggered the others
+		s.sampled = true
+		switch {
+		case rising:
+			s.last = RisingCrossing
+			if a.StartupAlarm == RisingAlarm || a.StartupAlarm == RisingOrFallingAlarm {
+				return RisingCrossing
+			}
+		case falling:
+			s.last = FallingCrossing
+			if a.StartupAlarm == FallingAlarm || a.StartupAlarm == RisingOrFallingAlarm {
+				return FallingCrossing
+			}
+		}
+		return NoCrossing
+	}
+	switch {
+	case rising && s.last != RisingCrossing:
+		s.last = RisingCrossing
+		return RisingCrossing
+	case falling && s.last != FallingCrossing:
+		s.last = FallingCrossing
+		return FallingCrossing
+	}
+	return NoCrossing
+}
+
+// ThresholdPDUs returns the variables setting the thresholds of the alarm
+// of index, for GoSNMP.Set. Agents may require the alarm to be under
+// creation, see StatusPDU.
+func ThresholdPDUs(index int, rising, falling int32) []gosnmp.SnmpPDU {
+	return []gosnmp.SnmpPDU{
+		{Name: alarmColumn(7, index), Type: gosnmp.Integer, Value: int(rising)},
+		{Name: alarmColumn(8, index), Type: gosnmp.Integer, Value: int(falling)},
+	}
+}
+
+// StatusPDU returns the variable setting the alarmStatus of the alarm of
+// index.
+func StatusPDU(index int, status EntryStatus) gosnmp.SnmpPDU {
+	return gosnmp.SnmpPDU{Name: alarmColumn(12, index), Type: gosnmp.Integer, Value: int(status)}
+}
+
+func alarmColumn(column, index int) string {
+	return alarmEntry + "." + strconv.Itoa(column) + "." + strconv.Itoa(index)
+}
+
+// decodeRows calls row for the variables below entry with their column
+// and the indexLen integers of their index.
+func decodeRows(pdus []gosnmp.SnmpPDU, entry string, indexLen int,
+	row func(column int, index []int, pdu gosnmp.SnmpPDU) error) error {
+	for _, pdu := range pdus {
+		name := "." + strings.TrimPrefix(pdu.Name, ".")
+		if !strings.HasPrefix(name, entry+".") {
+			continue
+		}
+		switch pdu.Type {
+		case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView:
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(name, entry+"."), ".")
+		if len(parts) != indexLen+1 {
+			return fmt.Errorf("%s: unexpected index", pdu.Name)
+		}
+		ints := make([]int, len(parts))
+		for i, p := range parts {
+			v, err := strconv.Atoi(p)
+			if err != nil {
+				return fmt.Errorf("%s: %w", pdu.Name, err)
+			}
+			ints[i] = v
+		}
+		if err := row(ints[0], ints[1:], pdu); err != nil {
+			return fmt.Errorf("%s: %w", pdu.Name, err)
+		}
+	}
+	return nil
+}
+
+func indexKey(index []int) string {
+	parts := make([]string, len(index))
+	for i, v := range index {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ".")
+}
+
+func integer(pdu gosnmp.SnmpPDU) (int64, error) {
+	switch pdu.Type {
+	case gosnmp.Integer, gosnmp.Gauge32, gosnmp.Counter32, gosnmp.Uinteger32, gosnmp.TimeTicks:
+		return gosnmp.ToBigInt(pdu.Value).Int64(), nil
+	}
+	return 0, fmt.Errorf("expected an integer, got %v", pdu.Type)
+}
+
+func intValue(pdu gosnmp.SnmpPDU) (int, error) {
+	v, err := integer(pdu)
+	return int(v), err
+}
+
+func timeTicks(pdu gosnmp.SnmpPDU) (time.Duration, error) {
+	if pdu.Type != gosnmp.TimeTicks {
+		return 0, fmt.Errorf("expected TimeTicks, got %v", pdu.Type)
+	}
+	return time.Duration(gosnmp.ToBigInt(pdu.Value).Int64()) * 10 * time.Millisecond, nil
+}
+
+func objectIdentifier(pdu gosnmp.SnmpPDU) (string, error) {
+	s, ok := pdu.Value.(string)
+	if pdu.Type != gosnmp.ObjectIdentifier || !ok {
+		return "", fmt.Errorf("expected an OBJECT IDENTIFIER, got %v", pdu.Type)
+	}
+	return s, nil
+}
+
+func str(pdu gosnmp.SnmpPDU) (string, error) {
+	switch v := pdu.Value.(type) {
+	case []byte:
+		return string(v), nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("expected an OCTET STRING, got %v", pdu.Type)
+}
@@ -0,0 +1,115 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package rmon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeTables(t *testing.T) {
+	pdus := []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.16.3.1.1.1.2", Type: gosnmp.Integer, Value: 2},
+		{Name: ".1.3.6.1.2.1.16.3.1.1.1.1", Type: gosnmp.Integer, Value: 1},
+		{Name: ".1.3.6.1.2.1.16.3.1.1.2.1", Type: gosnmp.Integer, Value: 30},
+		{Name: ".1.3.6.1.2.1.16.3.1.1.3.1", Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.2.1.2.2.1.14.3"},
+		{Name: ".1.3.6.1.2.1.16.3.1.1.4.1", Type: gosnmp.Integer, Value: 2},
+		{Name: ".1.3.6.1.2.1.16.3.1.1.5.1", Type: gosnmp.Integer, Value: 17},
+		{Name: ".1.3.6.1.2.1.16.3.1.1.6.1", Type: gosnmp.Integer, Value: 3},
+		{Name: ".1.3.6.1.2.1.16.3.1.1.7.1", Type: gosnmp.Integer, Value: 100},
+		{Name: ".1.3.6.1.2.1.16.3.1.1.8.1", Type: gosnmp.Integer, Value: -10},
+		{Name: ".1.3.6.1.2.1.16.3.1.1.9.1", Type: gosnmp.Integer, Value: 5},
+		{Name: ".1.3.6.1.2.1.16.3.1.1.10.1", Type: gosnmp.Integer, Value: 0},
+		{Name: ".1.3.6.1.2.1.16.3.1.1.11.1", Type: gosnmp.OctetString, Value: []byte("noc")},
+		{Name: ".1.3.6.1.2.1.16.3.1.1.12.1", Type: gosnmp.Integer, Value: 1},
+		{Name: ".1.3.6.1.2.1.16.9.1.1.1.5", Type: gosnmp.Integer, Value: 5},
+		{Name: ".1.3.6.1.2.1.16.9.1.1.2.5", Type: gosnmp.OctetString, Value: []byte("input errors")},
+		{Name: ".1.3.6.1.2.1.16.9.1.1.3.5", Type: gosnmp.Integer, Value: 4},
+		{Name: ".1.3.6.1.2.1.16.9.1.1.4.5", Type: gosnmp.OctetString, Value: []byte("public")},
+		{Name: ".1.3.6.1.2.1.16.9.1.1.5.5", Type: gosnmp.TimeTicks, Value: uint32(12345)},
+		{Name: ".1.3.6.1.2.1.16.9.1.1.7.5", Type: gosnmp.Integer, Value: 1},
+		{Name: ".1.3.6.1.2.1.16.9.2.1.3.5.2", Type: gosnmp.TimeTicks, Value: uint32(200)},
+		{Name: ".1.3.6.1.2.1.16.9.2.1.4.5.2", Type: gosnmp.OctetString, Value: []byte("rising 120")},
+		{Name: ".1.3.6.1.2.1.16.9.2.1.3.5.1", Type: gosnmp.TimeTicks, Value: uint32(100)},
+		{Name: ".1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(1)},
+	}
+
+	alarms, err := DecodeAlarms(pdus)
+	require.NoError(t, err)
+	require.Len(t, alarms, 2)
+	assert.Equal(t, Alarm{
+		Index:             1,
+		Interval:          30 * time.Second,
+		Variable:          ".1.3.6.1.2.1.2.2.1.14.3",
+		SampleType:        DeltaValue,
+		Value:             17,
+		StartupAlarm:      RisingOrFallingAlarm,
+		RisingThreshold:   100,
+		FallingThreshold:  -10,
+		RisingEventIndex:  5,
+		FallingEventIndex: 0,
+		Owner:             "noc",
+		Status:            Valid,
+	}, alarms[0])
+	assert.Equal(t, 2, alarms[1].Index)
+
+	events, err := DecodeEvents(pdus)
+	require.NoError(t, err)
+	logs, err := DecodeLogs(pdus)
+	require.NoError(t, err)
+	tables := &Tables{Alarms: alarms, Events: events, Logs: logs}
+
+	event, ok := tables.Event(alarms[0].RisingEventIndex)
+	require.True(t, ok)
+	assert.Equal(t, "input errors", event.Description)
+	assert.True(t, event.Type.Logs())
+	assert.True(t, event.Type.Traps())
+	assert.Equal(t, "logandtrap", event.Type.String())
+	assert.Equal(t, 123450*time.Millisecond, event.LastTimeSent)
+	_, ok = tables.Event(alarms[0].FallingEventIndex)
+	assert.False(t, ok)
+
+	assert.Equal(t, []LogEntry{
+		{EventIndex: 5, Index: 1, Time: time.Second},
+		{EventIndex: 5, Index: 2, Time: 2 * time.Second, Description: "rising 120"},
+	}, tables.LogsOf(5))
+
+	_, err = DecodeAlarms([]gosnmp.SnmpPDU{{Name: ".1.3.6.1.2.1.16.3.1.1.3.1", Type: gosnmp.Integer, Value: 1}})
+	assert.Error(t, err)
+	_, err = DecodeLogs([]gosnmp.SnmpPDU{{Name: ".1.3.6.1.2.1.16.9.2.1.3.5", Type: gosnmp.TimeTicks, Value: uint32(1)}})
+	assert.Error(t, err)
+}
+
+func TestAlarmState(t *testing.T) {
+	alarm := Alarm{RisingThreshold: 100, FallingThreshold: 50, StartupAlarm: RisingAlarm}
+
+	s := &AlarmState{Alarm: alarm}
+	var got []Crossing
+	for _, v := range []int64{120, 130, 90, 40, 45, 110, 60, 100} {
+		got = append(got, s.Sample(v))
+	}
+	assert.Equal(t, []Crossing{
+		RisingCrossing, NoCrossing, NoCrossing, FallingCrossing, NoCrossing, RisingCrossing, NoCrossing, NoCrossing,
+	}, got)
+
+	// a first sample below the falling threshold triggers no falling alarm
+	// with a rising startup alarm, but arms the rising threshold
+	s = &AlarmState{Alarm: alarm}
+	assert.Equal(t, NoCrossing, s.Sample(10))
+	assert.Equal(t, NoCrossing, s.Sample(20))
+	assert.Equal(t, RisingCrossing, s.Sample(100))
+}
+
+func TestSetPDUs(t *testing.T) {
+	assert.Equal(t, []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.16.3.1.1.7.4", Type: gosnmp.Integer, Value: 90},
+		{Name: ".1.3.6.1.2.1.16.3.1.1.8.4", Type: gosnmp.Integer, Value: 70},
+	}, ThresholdPDUs(4, 90, 70))
+	assert.Equal(t, gosnmp.SnmpPDU{Name: ".1.3.6.1.2.1.16.3.1.1.12.4", Type: gosnmp.Integer, Value: 3}, StatusPDU(4, UnderCreation))
+}
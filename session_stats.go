@@ -0,0 +1,154 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// SessionStats are the counters of a SessionStatsCollector. They only
+// grow, so that collectors can monitor sessions by their rates.
+type SessionStats struct {
+	// Requests counts the requests sent, each once however many attempts
+	// it took.
+	Requests uint64
+
+	// Retries counts the attempts after the first of each request.
+	Retries uint64
+
+	// Timeouts counts the attempts that got no response in time.
+	Timeouts uint64
+
+	// DecodeErrors counts the responses that could not be decoded,
+	// authenticated or that were not timely.
+	DecodeErrors uint64
+
+	// Reports counts the SNMPv3 Report PDUs returned to requests.
+	Reports uint64
+
+	// Failures counts the requests that returned an error.
+	Failures uint64
+
+	// Discoveries counts the SNMPv3 engine discoveries, which are also
+	// counted as requests, DiscoveryFailures those that failed and
+	// DiscoveryTime the time they took, to budget for cold targets.
+	Discoveries       uint64
+	DiscoveryFailures uint64
+	DiscoveryTime     time.Duration
+
+	// ExpiredCorrelations counts the request IDs, msgIDs for SNMPv3,
+	// forgotten unanswered at the end of their lifetime: those of the
+	// asynchronous requests whose last attempt timed out and, through an
+	// Endpoint, those of the attempts older than its PendingTTL.
+	ExpiredCorrelations uint64
+}
+
+// SessionStatsCollector counts the requests of sessions, e.g. to monitor a
+// collector with a StatsMIB. Set it as GoSNMP.SessionStats; a collector may
+// be shared by several sessions.
+type SessionStatsCollector struct {
+	requests     uint64
+	retries      uint64
+	timeouts     uint64
+	decodeErrors uint64
+	reports      uint64
+	failures     uint64
+
+	discoveries       uint64
+	discoveryFailures uint64
+	discoveryTime     int64 // nanoseconds
+
+	expiredCorrelations uint64
+}
+
+// NewSessionStatsCollector returns a SessionStatsCollector counting from 0.
+func NewSessionStatsCollector() *SessionStatsCollector {
+	return &SessionStatsCollector{}
+}
+
+// Snapshot returns the counters so far.
+func (c *SessionStatsCollector) Snapshot() SessionStats {
+	return SessionStats{
+		Requests:     atomic.LoadUint64(&c.requests),
+		Retries:      atomic.LoadUint64(&c.retries),
+		Timeouts:     atomic.LoadUint64(&c.timeouts),
+		DecodeErrors: atomic.LoadUint64(&c.decodeErrors),
+		Reports:      atomic.LoadUint64(&c.reports),
+		Failures:     atomic.LoadUint64(&c.failures),
+
+		Discoveries:       atomic.LoadUint64(&c.discoveries),
+		DiscoveryFailures: atomic.LoadUint64(&c.discoveryFailures),
+		DiscoveryTime:     time.Duration(atomic.LoadInt64(&c.discoveryTime)),
+
+		ExpiredCorrelations: atomic.LoadUint64(&c.expiredCorrelations),
+	}
+}
+
+// record counts a request from the trace of its attempts, its result and
+// its error. A nil collector counts nothing.
+func (c *SessionStatsCollector) record(trace RequestTrace, result *SnmpPacket, err error) {
+	if c == nil {
+		return
+	}
+	var sent, timeouts, decodeErrors uint64
+	for _, ev := range trace {
+		switch ev.Kind {
+		case AttemptSent:
+			sent++
+		case AttemptTimeout:
+			timeouts++
+		case AttemptDecodeError:
+			decodeErrors++
+		}
+	}
+	if sent == 0 {
+		return
+	}
+	atomic.AddUint64(&c.requests, 1)
+	atomic.AddUint64(&c.retries, sent-1)
+	atomic.AddUint64(&c.timeouts, timeouts)
+	atomic.AddUint64(&c.decodeErrors, decodeErrors)
+	if result != nil && result.PDUType == Report {
+		atomic.AddUint64(&c.reports, 1)
+	}
+	if err != nil {
+		atomic.AddUint64(&c.failures, 1)
+	}
+}
+
+// recordDiscovery counts an engine discovery that took latency and failed
+// with err if set. A nil collector counts nothing.
+func (c *SessionStatsCollector) recordDiscovery(latency time.Duration, err error) {
+	if c == nil {
+		return
+	}
+	atomic.AddUint64(&c.discoveries, 1)
+	atomic.AddInt64(&c.discoveryTime, int64(latency))
+	if err != nil {
+		atomic.AddUint64(&c.discoveryFailures, 1)
+	}
+}
+
+// recordExpired counts n correlation entries forgotten unanswered. A nil
+// collector counts nothing.
+func (c *SessionStatsCollector) recordExpired(n int) {
+	if c == nil || n == 0 {
+		return
+	}
+	atomic.AddUint64(&c.expiredCorrelations, uint64(n))
+}
+
+// expired counts n request IDs of x forgotten unanswered and calls the
+// OnExpire hook.
+func (x *GoSNMP) expired(n int) {
+	if n == 0 {
+		return
+	}
+	x.SessionStats.recordExpired(n)
+	if x.OnExpire != nil {
+		x.OnExpire(x, n)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrShortResponse is returned when an agent answers a Get with fewer
+// variables than requested and ShortResponses is ShortResponseError.
+var ErrShortResponse = errors.New("response has fewer variables than requested")
+
+// ShortResponsePolicy selects how Get handles a response with fewer
+// variables than OIDs requested, as sent by agents that silently drop
+// variables they cannot serve.
+type ShortResponsePolicy int
+
+const (
+	// ShortResponseAsIs returns the response as received, the default. The
+	// requested OIDs it lacks are listed in SnmpPacket.Missing, so that
+	// callers can tell a short response before indexing its variables by
+	// position.
+	ShortResponseAsIs ShortResponsePolicy = iota
+	// ShortResponseMark aligns the variables of the response with the
+	// requested OIDs. Each dropped OID is returned as a variable of type
+	// Null and listed in SnmpPacket.Missing.
+	ShortResponseMark
+	// ShortResponseError aligns the response like ShortResponseMark and
+	// also returns an error wrapping ErrShortResponse.
+	ShortResponseError
+	// ShortResponseRetry requests each dropped OID individually, OIDs still
+	// missing afterwards are marked like ShortResponseMark.
+	ShortResponseRetry
+)
+
+// alignShortResponse applies the ShortResponses policy to a Get of oids
+// with options o answered by result with fewer variables. The variables
+// received are matched to the OIDs in order, so an OID requested twice is
+// matched by position; the values of an agent that also reorders variables
+// may be matched to the wrong OIDs.
+func (x *GoSNMP) alignShortResponse(o *requestOptions, oids []string, result *SnmpPacket) (*SnmpPacket, error) {
+	if x.ShortResponses == ShortResponseAsIs {
+		result.Missing = missingOIDs(oids, result.Variables)
+		return result, nil
+	}
+	vars := make([]SnmpPDU, len(oids))
+	var missing []int
+	next := 0
+	for i, oid := range oids {
+		if next < len(result.Variables) && normalizeOID(result.Variables[next].Name) == normalizeOID(oid) {
+			vars[i] = result.Variables[next]
+			next++
+			continue
+		}
+		missing = append(missing, i)
+		vars[i] = SnmpPDU{Name: normalizeOID(oid), Type: Null}
+	}
+	if next < len(result.Variables) {
+		return result, fmt.Errorf("%w: cannot align %d variables with %d requested OIDs",
+			ErrShortResponse, len(result.Variables), len(oids))
+	}
+
+	if x.ShortResponses == ShortResponseRetry {
+		var still []int
+		for _, i := range missing {
+			single, err := x.send(x.mkCallPacket(o, GetRequest, []SnmpPDU{{Name: oids[i], Type: Null}}, 0, 0), true)
+			if err != nil {
+				return result, err
+			}
+			if len(single.Variables) != 1 || normalizeOID(single.Variables[0].Name) != normalizeOID(oids[i]) {
+				still = append(still, i)
+				continue
+			}
+			vars[i] = single.Variables[0]
+		}
+		missing = still
+	}
+
+	result.Variables = vars
+	result.Missing = nil
+	for _, i := range missing {
+		result.Missing = append(result.Missing, oids[i])
+	}
+	if x.ShortResponses == ShortResponseError && len(missing) > 0 {
+		return result, fmt.Errorf("%w: %d of %d variables, missing %v",
+			ErrShortResponse, len(oids)-len(missing), len(oids), result.Missing)
+	}
+	return result, nil
+}
+
+// missingOIDs returns the oids that none of vars is named after, each OID
+// requested n times being missing as often as it was answered fewer times.
+func missingOIDs(oids []string, vars []SnmpPDU) []string {
+	received := make(map[string]int, len(vars))
+	for _, v := range vars {
+		received[normalizeOID(v.Name)]++
+	}
+	var missing []string
+	for _, oid := range oids {
+		if received[normalizeOID(oid)] > 0 {
+			received[normalizeOID(oid)]--
+			continue
+		}
+		missing = append(missing, oid)
+	}
+	return missing
+}
@@ -0,0 +1,141 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	sysDescr    = ".1.3.6.1.2.1.1.1.0"
+	sysContact  = ".1.3.6.1.2.1.1.4.0"
+	sysName     = ".1.3.6.1.2.1.1.5.0"
+	sysLocation = ".1.3.6.1.2.1.1.6.0"
+)
+
+// droppingAgent answers Gets with the value of each OID, except that it
+// drops sysContact from requests for several OIDs and sysLocation always.
+func droppingAgent(t *testing.T, srvr *net.UDPConn, requests *int32) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := srvr.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(requests, 1)
+		req, err := Default.SnmpDecodePacket(buf[:n])
+		if err != nil {
+			t.Errorf("agent decode: %s", err)
+			return
+		}
+		var vars []SnmpPDU
+		for _, v := range req.Variables {
+			if v.Name == sysLocation || v.Name == sysContact && len(req.Variables) > 1 {
+				continue
+			}
+			vars = append(vars, SnmpPDU{Name: v.Name, Type: OctetString, Value: v.Name})
+		}
+		resp := &SnmpPacket{
+			Version:   Version2c,
+			Community: "public",
+			PDUType:   GetResponse,
+			RequestID: req.RequestID,
+			Variables: vars,
+		}
+		out, err := resp.MarshalMsg()
+		if err != nil {
+			t.Errorf("agent marshal: %s", err)
+			return
+		}
+		if _, err = srvr.WriteTo(out, addr); err != nil {
+			return
+		}
+	}
+}
+
+func TestShortResponses(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+	var requests int32
+	go droppingAgent(t, srvr, &requests)
+
+	x := &GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Version:   Version2c,
+		Community: "public",
+		Timeout:   time.Second,
+		MaxOids:   MaxOids,
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+	oids := []string{sysDescr, sysContact, sysName, sysLocation}
+
+	// returned as received by default, listing what is missing
+	result, err := x.Get(oids)
+	require.NoError(t, err)
+	assert.Len(t, result.Variables, 2)
+	assert.Equal(t, []string{sysContact, sysLocation}, result.Missing)
+
+	x.ShortResponses = ShortResponseMark
+	result, err = x.Get(oids)
+	require.NoError(t, err)
+	require.Len(t, result.Variables, 4)
+	for i, oid := range oids {
+		assert.Equal(t, oid, result.Variables[i].Name)
+	}
+	assert.Equal(t, Null, result.Variables[1].Type)
+	assert.Equal(t, []string{sysContact, sysLocation}, result.Missing)
+
+	x.ShortResponses = ShortResponseError
+	result, err = x.Get(oids)
+	assert.True(t, errors.Is(err, ErrShortResponse))
+	require.NotNil(t, result)
+	assert.Equal(t, []string{sysContact, sysLocation}, result.Missing)
+
+	x.ShortResponses = ShortResponseRetry
+	atomic.StoreInt32(&requests, 0)
+	result, err = x.Get(oids)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	assert.Equal(t, OctetString, result.Variables[1].Type)
+	assert.Equal(t, sysContact, result.Variables[1].Name)
+	assert.Equal(t, Null, result.Variables[3].Type)
+	assert.Equal(t, []string{sysLocation}, result.Missing)
+
+	// an OID requested twice is matched by position
+	x.ShortResponses = ShortResponseMark
+	result, err = x.Get([]string{sysDescr, sysContact, sysDescr, sysLocation})
+	require.NoError(t, err)
+	require.Len(t, result.Variables, 4)
+	assert.Equal(t, OctetString, result.Variables[0].Type)
+	assert.Equal(t, Null, result.Variables[1].Type)
+	assert.Equal(t, OctetString, result.Variables[2].Type)
+	assert.Equal(t, sysDescr, result.Variables[2].Name)
+	assert.Equal(t, []string{sysContact, sysLocation}, result.Missing)
+
+	x.ShortResponses = ShortResponseAsIs
+	result, err = x.Get([]string{sysDescr, sysContact, sysDescr, sysLocation})
+	require.NoError(t, err)
+	assert.Len(t, result.Variables, 2)
+	assert.Equal(t, []string{sysContact, sysLocation}, result.Missing)
+
+	// complete responses are untouched
+	result, err = x.Get([]string{sysDescr, sysName})
+	require.NoError(t, err)
+	assert.Len(t, result.Variables, 2)
+	assert.Nil(t, result.Missing)
+}
@@ -0,0 +1,136 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// SocketErrorClass is the portable classification of a socket error, so that
+// applications handling poll failures can tell a host that is down from a
+// local resource shortage without matching GOOS-specific error strings.
+type SocketErrorClass uint8
+
+// Socket error classes.
+const (
+	// SocketErrorNone: no error.
+	SocketErrorNone SocketErrorClass = iota
+	// SocketErrorOther: an error of no other class.
+	SocketErrorOther
+	// SocketErrorTimeout: the socket deadline expired.
+	SocketErrorTimeout
+	// SocketErrorConnectionRefused: nothing listens on the port of the
+	// target, e.g. an ICMP port unreachable for UDP.
+	SocketErrorConnectionRefused
+	// SocketErrorConnectionReset: the connection was reset or aborted by the
+	// peer, or on Windows by an ICMP port unreachable for UDP.
+	SocketErrorConnectionReset
+	// SocketErrorHostUnreachable: there is no route to the target host.
+	SocketErrorHostUnreachable
+	// SocketErrorNetworkUnreachable: there is no route to the network of the
+	// target.
+	SocketErrorNetworkUnreachable
+	// SocketErrorBufferFull: the local socket or interface buffers are full.
+	SocketErrorBufferFull
+	// SocketErrorMessageTooLong: the message exceeds what the socket can send
+	// in one datagram.
+	SocketErrorMessageTooLong
+	// SocketErrorPermissionDenied: the operation was forbidden locally, e.g.
+	// by a firewall rule or a broadcast address.
+	SocketErrorPermissionDenied
+)
+
+func (c SocketErrorClass) String() string {
+	switch c {
+	case SocketErrorNone:
+		return "none"
+	case SocketErrorOther:
+		return "other"
+	case SocketErrorTimeout:
+		return "timeout"
+	case SocketErrorConnectionRefused:
+		return "connection refused"
+	case SocketErrorConnectionReset:
+		return "connection reset"
+	case SocketErrorHostUnreachable:
+		return "host unreachable"
+	case SocketErrorNetworkUnreachable:
+		return "network unreachable"
+	case SocketErrorBufferFull:
+		return "buffer full"
+	case SocketErrorMessageTooLong:
+		return "message too long"
+	case SocketErrorPermissionDenied:
+		return "permission denied"
+	}
+	return fmt.Sprintf("SocketErrorClass(%d)", uint8(c))
+}
+
+// SocketError wraps the errors of the socket of a session with their class.
+// The message is that of Err, which it unwraps to, so that errors.Is and
+// errors.As still find the underlying *net.OpError and syscall.Errno.
+type SocketError struct {
+	Class SocketErrorClass
+
+	// Op is the socket operation that failed: "dial", "write" or "read".
+	Op string
+
+	Err error
+}
+
+func (e *SocketError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SocketError) Unwrap() error {
+	return e.Err
+}
+
+// ClassifySocketError returns the class of err, which may be or wrap a
+// SocketError or an error of the net package. For a RequestError whose error
+// is not classified, e.g. after the last retry timed out, it is the class of
+// the last error of its attempts.
+func ClassifySocketError(err error) SocketErrorClass {
+	if err == nil {
+		return SocketErrorNone
+	}
+	var sockErr *SocketError
+	if errors.As(err, &sockErr) {
+		return sockErr.Class
+	}
+	if class := classifyOSError(err); class != SocketErrorOther {
+		return class
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return SocketErrorTimeout
+	}
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) {
+		for i := len(reqErr.Trace) - 1; i >= 0; i-- {
+			if ev := reqErr.Trace[i]; ev.Err != nil {
+				if class := ClassifySocketError(ev.Err); class != SocketErrorOther {
+					return class
+				}
+				break
+			}
+		}
+	}
+	return SocketErrorOther
+}
+
+// wrapSocketError returns err of the socket operation op as a SocketError.
+func wrapSocketError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var sockErr *SocketError
+	if errors.As(err, &sockErr) {
+		return err
+	}
+	return &SocketError{Class: ClassifySocketError(err), Op: op, Err: err}
+}
@@ -0,0 +1,40 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package gosnmp
+
+import (
+	"errors"
+	"syscall"
+)
+
+// classifyOSError returns the class of the errno wrapped by err.
+func classifyOSError(err error) SocketErrorClass {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return SocketErrorOther
+	}
+	switch errno {
+	case syscall.ETIMEDOUT:
+		return SocketErrorTimeout
+	case syscall.ECONNREFUSED:
+		return SocketErrorConnectionRefused
+	case syscall.ECONNRESET, syscall.ECONNABORTED, syscall.EPIPE:
+		return SocketErrorConnectionReset
+	case syscall.EHOSTUNREACH, syscall.EHOSTDOWN:
+		return SocketErrorHostUnreachable
+	case syscall.ENETUNREACH, syscall.ENETDOWN:
+		return SocketErrorNetworkUnreachable
+	case syscall.ENOBUFS, syscall.EAGAIN:
+		return SocketErrorBufferFull
+	case syscall.EMSGSIZE:
+		return SocketErrorMessageTooLong
+	case syscall.EACCES, syscall.EPERM:
+		return SocketErrorPermissionDenied
+	}
+	return SocketErrorOther
+}
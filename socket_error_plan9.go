@@ -0,0 +1,14 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build plan9
+// +build plan9
+
+package gosnmp
+
+// classifyOSError returns SocketErrorOther: Plan 9 reports socket errors as
+// strings, classified only as timeouts.
+func classifyOSError(err error) SocketErrorClass {
+	return SocketErrorOther
+}
@@ -0,0 +1,91 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifySocketError(t *testing.T) {
+	assert.Equal(t, SocketErrorNone, ClassifySocketError(nil))
+	assert.Equal(t, SocketErrorOther, ClassifySocketError(errors.New("boom")))
+
+	if runtime.GOOS != "windows" && runtime.GOOS != "plan9" {
+		for errno, class := range map[syscall.Errno]SocketErrorClass{
+			syscall.ECONNREFUSED: SocketErrorConnectionRefused,
+			syscall.ECONNRESET:   SocketErrorConnectionReset,
+			syscall.EHOSTUNREACH: SocketErrorHostUnreachable,
+			syscall.ENETUNREACH:  SocketErrorNetworkUnreachable,
+			syscall.ENOBUFS:      SocketErrorBufferFull,
+			syscall.EMSGSIZE:     SocketErrorMessageTooLong,
+			syscall.EPERM:        SocketErrorPermissionDenied,
+		} {
+			err := &net.OpError{Op: "write", Net: "udp", Err: os.NewSyscallError("sendto", errno)}
+			assert.Equal(t, class, ClassifySocketError(err), errno.Error())
+
+			wrapped := wrapSocketError("write", err)
+			assert.Equal(t, err.Error(), wrapped.Error())
+			assert.True(t, errors.Is(wrapped, errno))
+			assert.Equal(t, class, ClassifySocketError(fmt.Errorf("poll: %w", wrapped)))
+		}
+	}
+
+	timeout := &net.OpError{Op: "read", Net: "udp", Err: os.ErrDeadlineExceeded}
+	assert.Equal(t, SocketErrorTimeout, ClassifySocketError(timeout))
+
+	// a RequestError takes the class of its last attempt
+	reqErr := &RequestError{
+		Err: errors.New("request timeout (after 1 retries)"),
+		Trace: RequestTrace{
+			{Kind: AttemptSent},
+			{Kind: AttemptTimeout, Err: wrapSocketError("read", timeout)},
+		},
+	}
+	assert.Equal(t, SocketErrorTimeout, ClassifySocketError(reqErr))
+
+	assert.Equal(t, "host unreachable", SocketErrorHostUnreachable.String())
+	assert.Equal(t, "SocketErrorClass(200)", SocketErrorClass(200).String())
+}
+
+func TestSocketErrorFromRequest(t *testing.T) {
+	// find a closed port: ICMP port unreachable is reported as connection
+	// refused, or as connection reset on Windows
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	port := srvr.LocalAddr().(*net.UDPAddr).Port
+	srvr.Close()
+
+	x := &GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(port),
+		Community: "public",
+		Version:   Version2c,
+		Timeout:   time.Second,
+		Retries:   0,
+		MaxOids:   MaxOids,
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.1.0"})
+	require.Error(t, err)
+	var sockErr *SocketError
+	require.True(t, errors.As(err, &sockErr), err.Error())
+	assert.Equal(t, "read", sockErr.Op)
+	assert.Contains(t, []SocketErrorClass{SocketErrorConnectionRefused, SocketErrorConnectionReset}, ClassifySocketError(err))
+}
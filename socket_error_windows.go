@@ -0,0 +1,57 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build windows
+// +build windows
+
+package gosnmp
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Winsock error codes, returned by the net package as syscall.Errno.
+const (
+	wsaeacces       syscall.Errno = 10013
+	wsaewouldblock  syscall.Errno = 10035
+	wsaemsgsize     syscall.Errno = 10040
+	wsaenetdown     syscall.Errno = 10050
+	wsaenetunreach  syscall.Errno = 10051
+	wsaenetreset    syscall.Errno = 10052
+	wsaeconnaborted syscall.Errno = 10053
+	wsaeconnreset   syscall.Errno = 10054
+	wsaenobufs      syscall.Errno = 10055
+	wsaetimedout    syscall.Errno = 10060
+	wsaeconnrefused syscall.Errno = 10061
+	wsaehostdown    syscall.Errno = 10064
+	wsaehostunreach syscall.Errno = 10065
+)
+
+// classifyOSError returns the class of the Winsock error wrapped by err.
+func classifyOSError(err error) SocketErrorClass {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return SocketErrorOther
+	}
+	switch errno {
+	case wsaetimedout:
+		return SocketErrorTimeout
+	case wsaeconnrefused:
+		return SocketErrorConnectionRefused
+	case wsaeconnreset, wsaeconnaborted, wsaenetreset:
+		return SocketErrorConnectionReset
+	case wsaehostunreach, wsaehostdown:
+		return SocketErrorHostUnreachable
+	case wsaenetunreach, wsaenetdown:
+		return SocketErrorNetworkUnreachable
+	case wsaenobufs, wsaewouldblock:
+		return SocketErrorBufferFull
+	case wsaemsgsize:
+		return SocketErrorMessageTooLong
+	case wsaeacces:
+		return SocketErrorPermissionDenied
+	}
+	return SocketErrorOther
+}
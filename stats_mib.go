@@ -0,0 +1,127 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// StatsMIB is an AgentHandler serving the counters of gosnmp itself below
+// an enterprise subtree, so that a collector can be monitored over SNMP
+// like the devices it polls:
+//
+//	stats := gosnmp.NewSessionStatsCollector()
+//	x.SessionStats = stats // for each session
+//	mib, err := gosnmp.NewStatsMIB(".1.3.6.1.4.1.99999.1")
+//	mib.Sessions = stats
+//	mib.TrapListener = listener
+//	mib.Agent = agent
+//	err = mux.Register(".1.3.6.1.4.1.99999.1", mib)
+//
+// The counters of the sources that are set are served as Counter64
+// scalars, the usmStats of the agent as Counter32:
+//
+//	root.1.1.0 - root.1.6.0   sessions: requests, retries, timeouts,
+//	                          decode errors, reports, failures
+//	root.2.1.0 - root.2.8.0   trap listener: received, parse errors,
+//	                          auth failures, SNMPv1, SNMPv2c and SNMPv3
+//	                          notifications, dropped as the queue was
+//	                          full, rate limited
+//	root.3.1.0 - root.3.6.0   agent usmStats, numbered as in RFC 3414:
+//	                          unsupportedSecLevels, notInTimeWindows,
+//	                          unknownUserNames, unknownEngineIDs,
+//	                          wrongDigests, decryptionErrors
+//
+// The counters of a request are read once, when it begins.
+type StatsMIB struct {
+	// Sessions, if set, counts the requests of the sessions monitored.
+	Sessions *SessionStatsCollector
+
+	// TrapListener, if set, is the listener monitored.
+	TrapListener *TrapListener
+
+	// Agent, if set, is the agent monitored, whose usmStats are served.
+	Agent *Agent
+
+	root string
+
+	mu       sync.Mutex
+	snapshot []SnmpPDU // sorted, nil when to be read
+}
+
+// NewStatsMIB returns a StatsMIB serving below root.
+func NewStatsMIB(root string) (*StatsMIB, error) {
+	root = dottedOID(root)
+	if _, err := marshalObjectIdentifier(root); err != nil {
+		return nil, fmt.Errorf("invalid root %q: %w", root, err)
+	}
+	return &StatsMIB{root: root}, nil
+}
+
+// BeginRequest makes the next variable read the counters again.
+func (m *StatsMIB) BeginRequest() {
+	m.mu.Lock()
+	m.snapshot = nil
+	m.mu.Unlock()
+}
+
+// variables returns the counters, sorted. The caller holds m.mu.
+func (m *StatsMIB) variables() []SnmpPDU {
+	if m.snapshot != nil {
+		return m.snapshot
+	}
+	vars := []SnmpPDU{}
+	counters := func(group int, t Asn1BER, values ...interface{}) {
+		for i, v := range values {
+			name := fmt.Sprintf("%s.%d.%d.0", m.root, group, i+1)
+			vars = append(vars, SnmpPDU{Name: name, Type: t, Value: v})
+		}
+	}
+	if m.Sessions != nil {
+		s := m.Sessions.Snapshot()
+		counters(1, Counter64, s.Requests, s.Retries, s.Timeouts, s.DecodeErrors, s.Reports, s.Failures)
+	}
+	if m.TrapListener != nil {
+		s := m.TrapListener.Stats()
+		counters(2, Counter64, s.Received, s.ParseErrors, s.AuthFailures, s.V1, s.V2c, s.V3,
+			s.Dropped.QueueFull, s.Dropped.RateLimited)
+	}
+	if m.Agent != nil {
+		s := m.Agent.UsmStats()
+		counters(3, Counter32, uint(s.UnsupportedSecLevels), uint(s.NotInTimeWindows), uint(s.UnknownUserNames),
+			uint(s.UnknownEngineIDs), uint(s.WrongDigests), uint(s.DecryptionErrors))
+	}
+	sort.Slice(vars, func(i, j int) bool { return oidLess(vars[i].Name, vars[j].Name) })
+	m.snapshot = vars
+	return vars
+}
+
+// Get returns the variable oid.
+func (m *StatsMIB) Get(oid string) (SnmpPDU, error) {
+	oid = dottedOID(oid)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	vars := m.variables()
+	i := sort.Search(len(vars), func(i int) bool { return !oidLess(vars[i].Name, oid) })
+	if i < len(vars) && vars[i].Name == oid {
+		return vars[i], nil
+	}
+	return SnmpPDU{Name: oid, Type: NoSuchObject}, nil
+}
+
+// GetNext returns the first variable after oid.
+func (m *StatsMIB) GetNext(oid string) (SnmpPDU, error) {
+	oid = dottedOID(oid)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	vars := m.variables()
+	i := sort.Search(len(vars), func(i int) bool { return oidLess(oid, vars[i].Name) })
+	if i < len(vars) {
+		return vars[i], nil
+	}
+	return SnmpPDU{Name: oid, Type: EndOfMibView}, nil
+}
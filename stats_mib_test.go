@@ -0,0 +1,82 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsMIB(t *testing.T) {
+	stats := NewSessionStatsCollector()
+	mib, err := NewStatsMIB("1.3.6.1.4.1.99999.1")
+	require.NoError(t, err)
+	mib.Sessions = stats
+	mib.TrapListener = NewTrapListener()
+	a := NewAgent()
+	a.Handler = mib
+	mib.Agent = a
+	x := startAgent(t, a, Version2c, "public")
+	x.SessionStats = stats
+
+	// the session monitors itself
+	result, err := x.Get([]string{".1.3.6.1.4.1.99999.1.1.1.0"})
+	require.NoError(t, err)
+	assert.Equal(t, Counter64, result.Variables[0].Type)
+	assert.Equal(t, uint64(0), result.Variables[0].Value, "read when the request begins")
+	result, err = x.Get([]string{".1.3.6.1.4.1.99999.1.1.1.0", ".1.3.6.1.4.1.99999.1.1.7.0"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), result.Variables[0].Value)
+	assert.Equal(t, NoSuchObject, result.Variables[1].Type)
+
+	all, err := x.WalkAll(".1.3.6.1.4.1.99999.1")
+	require.NoError(t, err)
+	names := make([]string, len(all))
+	for i, v := range all {
+		names[i] = v.Name
+	}
+	require.Len(t, names, 6+8+6)
+	assert.Equal(t, ".1.3.6.1.4.1.99999.1.1.1.0", names[0])
+	assert.Equal(t, ".1.3.6.1.4.1.99999.1.2.1.0", names[6])
+	assert.Equal(t, ".1.3.6.1.4.1.99999.1.3.6.0", names[19])
+	assert.Equal(t, Counter32, all[19].Type)
+
+	_, err = NewStatsMIB("1.3.x")
+	assert.Error(t, err)
+}
+
+func TestSessionStats(t *testing.T) {
+	// an agent that never answers
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	stats := NewSessionStatsCollector()
+	x := &GoSNMP{
+		Target:       "127.0.0.1",
+		Port:         uint16(conn.LocalAddr().(*net.UDPAddr).Port),
+		Community:    "public",
+		Version:      Version2c,
+		Timeout:      20 * time.Millisecond,
+		Retries:      2,
+		SessionStats: stats,
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.Error(t, err)
+	assert.Equal(t, SessionStats{Requests: 1, Retries: 2, Timeouts: 3, Failures: 1}, stats.Snapshot())
+
+	var nobody *SessionStatsCollector
+	nobody.record(RequestTrace{{Kind: AttemptSent}}, nil, nil)
+	nobody.recordExpired(1)
+}
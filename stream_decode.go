@@ -0,0 +1,282 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// streamFieldMaxSize bounds the integer fields of a message header read by
+// a StreamDecoder.
+const streamFieldMaxSize = 16
+
+// StreamDecoder decodes an SNMPv1 or v2c message read from a stream, such as
+// an SNMP over TCP connection, returning its variables one at a time as they
+// arrive rather than buffering the whole message. Memory use is bounded by
+// the largest variable rather than by the message, so multi-megabyte
+// responses can be processed as they are received. SNMPv3 messages are
+// authenticated and encrypted as a whole and cannot be decoded this way, nor
+// can SNMPv1 Trap PDUs.
+type StreamDecoder struct {
+	x      *GoSNMP
+	r      io.Reader
+	header *SnmpPacket
+
+	// remaining is the size of the variable bindings not read yet
+	remaining int
+	err       error
+}
+
+// NewStreamDecoder reads the header of the next message from r, up to its
+// first variable. The OID limits and Logger of x apply to the decoding.
+func (x *GoSNMP) NewStreamDecoder(r io.Reader) (*StreamDecoder, error) {
+	d := &StreamDecoder{x: x, r: r, header: &SnmpPacket{Logger: x.Logger}}
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Header returns the message without its variables.
+func (d *StreamDecoder) Header() *SnmpPacket {
+	return d.header
+}
+
+// Next returns the next variable of the message, or io.EOF after the last
+// one.
+func (d *StreamDecoder) Next() (SnmpPDU, error) {
+	if d.err != nil {
+		return SnmpPDU{}, d.err
+	}
+	if d.remaining == 0 {
+		return SnmpPDU{}, io.EOF
+	}
+	maxLen := d.remaining
+	if maxLen > rxBufSize {
+		maxLen = rxBufSize
+	}
+	vb, err := readBERMessage(d.r, maxLen)
+	if err != nil {
+		d.err = fmt.Errorf("error reading varbind: %w", noEOF(err))
+		return SnmpPDU{}, d.err
+	}
+	d.remaining -= len(vb)
+	pdu, count, err := d.x.unmarshalVarbind(vb)
+	if err == nil && count != len(vb) {
+		err = fmt.Errorf("varbind of %d bytes holds %d bytes", len(vb), count)
+	}
+	if err != nil {
+		d.err = err
+		return SnmpPDU{}, err
+	}
+	return pdu, nil
+}
+
+// Skip discards the variables not read yet, leaving r at the start of the
+// next message.
+func (d *StreamDecoder) Skip() error {
+	for {
+		if _, err := d.Next(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (d *StreamDecoder) readHeader() error {
+	hdr, msgLength, err := readBERHeader(d.r)
+	if err != nil {
+		return err
+	}
+	if PDUType(hdr[0]) != Sequence {
+		return fmt.Errorf("invalid packet header")
+	}
+
+	version, versionSize, err := d.readField("version")
+	if err != nil {
+		return err
+	}
+	d.header.Version = SnmpVersion(version)
+	if d.header.Version == Version3 {
+		return errors.New("SNMPv3 messages cannot be decoded as a stream")
+	}
+
+	rawCommunity, err := readBERMessage(d.r, rxBufSize)
+	if err != nil {
+		return fmt.Errorf("error reading community string: %w", noEOF(err))
+	}
+	community, _, err := parseCommunity(d.x.Logger, rawCommunity)
+	if err != nil {
+		return fmt.Errorf("error parsing community string: %w", err)
+	}
+	if c, ok := community.(string); ok {
+		d.header.Community = c
+	}
+
+	pduHdr, pduLength, err := readBERHeader(d.r)
+	if err != nil {
+		return fmt.Errorf("error reading PDU: %w", noEOF(err))
+	}
+	d.header.PDUType = PDUType(pduHdr[0])
+	if d.header.PDUType == Trap {
+		return errors.New("SNMPv1 Trap PDUs cannot be decoded as a stream")
+	}
+	if msgLength != versionSize+len(rawCommunity)+len(pduHdr)+pduLength {
+		return fmt.Errorf("error verifying packet sanity: PDU of %d bytes in a %d byte message", pduLength, msgLength)
+	}
+
+	fields := [3]int{}
+	names := [3]string{"request id", "error-status", "error index"}
+	if d.header.PDUType == GetBulkRequest {
+		names[1], names[2] = "non repeaters", "max repetitions"
+	}
+	used := 0
+	for i, name := range names {
+		var size int
+		if fields[i], size, err = d.readField(name); err != nil {
+			return err
+		}
+		used += size
+	}
+	d.header.RequestID = uint32(fields[0])
+	if d.header.PDUType == GetBulkRequest {
+		d.header.NonRepeaters = uint8(fields[1])
+		d.header.MaxRepetitions = uint32(fields[2]) & 0x7FFFFFFF
+	} else {
+		d.header.Error = SNMPError(fields[1])
+		d.header.ErrorIndex = uint8(fields[2])
+	}
+	d.header.IsInform = d.header.PDUType == InformRequest
+
+	vblHdr, vblLength, err := readBERHeader(d.r)
+	if err != nil {
+		return fmt.Errorf("error reading VBL: %w", noEOF(err))
+	}
+	if vblHdr[0] != 0x30 {
+		return fmt.Errorf("expected a sequence when unmarshalling a VBL, got %x", vblHdr[0])
+	}
+	if pduLength != used+len(vblHdr)+vblLength {
+		return fmt.Errorf("error verifying Response sanity: VBL of %d bytes in a %d byte PDU", vblLength, pduLength)
+	}
+	d.remaining = vblLength
+	return nil
+}
+
+// readField reads an integer field of the header, returning its value and
+// encoded size.
+func (d *StreamDecoder) readField(name string) (int, int, error) {
+	field, err := readBERMessage(d.r, streamFieldMaxSize)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error reading %s: %w", name, noEOF(err))
+	}
+	raw, _, err := parseRawField(d.x.Logger, field, name)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error parsing %s: %w", name, err)
+	}
+	value, ok := raw.(int)
+	if !ok {
+		return 0, 0, fmt.Errorf("%s of type %T", name, raw)
+	}
+	return value, len(field), nil
+}
+
+// GetBulkStream sends an SNMP GETBULK request over a stream transport and
+// passes the variables of the response to fn as they are decoded, see
+// StreamDecoder. It returns the response without its variables. The timeout
+// applies to the wait for each variable rather than to the whole response.
+// An error from fn stops the decoding and is returned; the connection is
+// then reopened, as the rest of the response is left unread. SNMPv3 is not
+// supported.
+func (x *GoSNMP) GetBulkStream(oids []string, nonRepeaters uint8, maxRepetitions uint32, fn func(SnmpPDU) error) (*SnmpPacket, error) {
+	switch {
+	case x.Version == Version1:
+		return nil, fmt.Errorf("GETBULK not supported in SNMPv1")
+	case x.Version == Version3:
+		return nil, errors.New("SNMPv3 responses cannot be decoded as a stream")
+	case !x.isStreamTransport():
+		return nil, fmt.Errorf("decoding responses as a stream requires a stream transport, not %s", x.Transport)
+	case len(oids) > x.MaxOids:
+		return nil, fmt.Errorf("oid count (%d) is greater than MaxOids (%d)", len(oids), x.MaxOids)
+	}
+	pdus := make([]SnmpPDU, 0, len(oids))
+	for _, oid := range oids {
+		pdus = append(pdus, SnmpPDU{Name: oid, Type: Null, Value: nil})
+	}
+	packetOut := x.mkSnmpPacket(GetBulkRequest, pdus, nonRepeaters, maxRepetitions)
+	return x.sendStream(packetOut, fn)
+}
+
+// sendStream sends packetOut and decodes the response with a StreamDecoder,
+// skipping late responses to earlier requests.
+func (x *GoSNMP) sendStream(packetOut *SnmpPacket, fn func(SnmpPDU) error) (*SnmpPacket, error) {
+	o := x.beginOperation(packetOut.opts)
+	packetOut.opts = o
+	defer x.lockConn(o)()
+	defer x.holdOperation(o)()
+	s := x.shared()
+	if s.Conn == nil {
+		return nil, fmt.Errorf("&GoSNMP.Conn is missing. Provide a connection or use Connect()")
+	}
+
+	reqID := atomic.AddUint32(&(x.requestID), 1) & 0x7FFFFFFF
+	packetOut.RequestID = reqID
+	outBuf, err := packetOut.marshalMsg()
+	if err != nil {
+		return nil, fmt.Errorf("marshal: %w", err)
+	}
+	timeout := x.timeout(o)
+	if err = s.Conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	if _, err = s.Conn.Write(outBuf); err != nil {
+		return nil, x.abortStream(err)
+	}
+
+	for {
+		if err = s.Conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			return nil, err
+		}
+		d, err := x.NewStreamDecoder(x.streamReader())
+		if err != nil {
+			return nil, x.abortStream(err)
+		}
+		if d.Header().RequestID != reqID {
+			x.callLogger(o).Print("ERROR out of order")
+			if err = d.Skip(); err != nil {
+				return nil, x.abortStream(err)
+			}
+			continue
+		}
+		for {
+			if err = s.Conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+				return nil, err
+			}
+			pdu, err := d.Next()
+			if err == io.EOF {
+				return d.Header(), nil
+			}
+			if err != nil {
+				return nil, x.abortStream(err)
+			}
+			if err = fn(pdu); err != nil {
+				return d.Header(), x.abortStream(err)
+			}
+		}
+	}
+}
+
+// abortStream reopens a stream left in the middle of a message and returns
+// err.
+func (x *GoSNMP) abortStream(err error) error {
+	if cerr := x.reconnectStream(); cerr != nil {
+		x.Logger.Printf("ERROR reconnecting: %s", cerr)
+	}
+	return err
+}
@@ -0,0 +1,184 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || marshal
+// +build all marshal
+
+package gosnmp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func streamTestResponse(requestID uint32, rows int) *SnmpPacket {
+	vars := make([]SnmpPDU, 0, rows)
+	for i := 1; i <= rows; i++ {
+		vars = append(vars, SnmpPDU{
+			Name:  fmt.Sprintf(".1.3.6.1.2.1.31.1.1.1.1.%d", i),
+			Type:  OctetString,
+			Value: []byte(fmt.Sprintf("GigabitEthernet1/0/%d", i)),
+		})
+	}
+	return &SnmpPacket{
+		Version:   Version2c,
+		Community: "public",
+		PDUType:   GetResponse,
+		RequestID: requestID,
+		Variables: vars,
+	}
+}
+
+func TestStreamDecoder(t *testing.T) {
+	x := &GoSNMP{}
+	first, err := streamTestResponse(7, 300).marshalMsg()
+	require.NoError(t, err)
+	second, err := streamTestResponse(8, 1).marshalMsg()
+	require.NoError(t, err)
+	want, err := x.SnmpDecodePacket(append([]byte(nil), first...))
+	require.NoError(t, err)
+
+	// messages are decoded one byte at a time, back to back
+	r := bufio.NewReader(iotest.OneByteReader(bytes.NewReader(append(append([]byte(nil), first...), second...))))
+	d, err := x.NewStreamDecoder(r)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(7), d.Header().RequestID)
+	assert.Equal(t, "public", d.Header().Community)
+	assert.Equal(t, GetResponse, d.Header().PDUType)
+	var got []SnmpPDU
+	for {
+		pdu, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		got = append(got, pdu)
+	}
+	assert.Equal(t, want.Variables, got)
+
+	d, err = x.NewStreamDecoder(r)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(8), d.Header().RequestID)
+	require.NoError(t, d.Skip())
+	_, err = x.NewStreamDecoder(r)
+	assert.Equal(t, io.EOF, err)
+
+	// a truncated message fails once its end is reached
+	d, err = x.NewStreamDecoder(bytes.NewReader(first[:len(first)-3]))
+	require.NoError(t, err)
+	assert.ErrorIs(t, d.Skip(), io.ErrUnexpectedEOF)
+
+	// as does a message whose lengths disagree
+	bad := append([]byte(nil), second...)
+	bad[1]++
+	_, err = x.NewStreamDecoder(bytes.NewReader(bad))
+	assert.Error(t, err)
+
+	v3 := v2cMessage([]byte{0x04, 0x00}, nil, nil)
+	v3[4] = 3
+	_, err = x.NewStreamDecoder(bytes.NewReader(v3))
+	assert.Error(t, err)
+}
+
+// streamAgent answers each GetBulk received on l with a stale response to an
+// earlier request, then with a response of rows variables.
+func streamAgent(t *testing.T, l net.Listener, rows int) {
+	decoder := &GoSNMP{}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			for {
+				msg, err := readBERMessage(r, rxBufSize)
+				if err != nil {
+					return
+				}
+				req, err := decoder.SnmpDecodePacket(msg)
+				if err != nil {
+					t.Errorf("agent decode: %s", err)
+					return
+				}
+				for _, resp := range []*SnmpPacket{streamTestResponse(req.RequestID-1, 2), streamTestResponse(req.RequestID, rows)} {
+					out, err := resp.marshalMsg()
+					if err != nil {
+						t.Errorf("agent marshal: %s", err)
+						return
+					}
+					if _, err = conn.Write(out); err != nil {
+						return
+					}
+				}
+			}
+		}()
+	}
+}
+
+func TestGetBulkStream(t *testing.T) {
+	l, err := net.Listen(tcp, "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	// a response of about 250 kB, beyond what GetBulk can receive
+	const rows = 5000
+	go streamAgent(t, l, rows)
+
+	x := &GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(l.Addr().(*net.TCPAddr).Port),
+		Transport: tcp,
+		Community: "public",
+		Version:   Version2c,
+		Timeout:   time.Second,
+		MaxOids:   MaxOids,
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	var names []string
+	header, err := x.GetBulkStream([]string{".1.3.6.1.2.1.31.1.1.1.1"}, 0, rows, func(pdu SnmpPDU) error {
+		names = append(names, pdu.Name)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, NoError, header.Error)
+	require.Len(t, names, rows)
+	assert.Equal(t, ".1.3.6.1.2.1.31.1.1.1.1.5000", names[rows-1])
+
+	// an error from the callback stops the decoding, the next request uses
+	// a new connection
+	errStop := errors.New("stop")
+	n := 0
+	_, err = x.GetBulkStream([]string{".1.3.6.1.2.1.31.1.1.1.1"}, 0, rows, func(pdu SnmpPDU) error {
+		n++
+		if n == 10 {
+			return errStop
+		}
+		return nil
+	})
+	assert.Equal(t, errStop, err)
+	n = 0
+	_, err = x.GetBulkStream([]string{".1.3.6.1.2.1.31.1.1.1.1"}, 0, rows, func(pdu SnmpPDU) error {
+		n++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, rows, n)
+
+	x.Transport = udp
+	_, err = x.GetBulkStream([]string{".1.3.6.1.2.1.31.1.1.1.1"}, 0, rows, func(SnmpPDU) error { return nil })
+	assert.Error(t, err)
+}
@@ -0,0 +1,112 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"sort"
+
+	"github.com/gosnmp/gosnmp/oids"
+)
+
+// TableJoin merges the columns of tables sharing the same row index, e.g.
+// ifTable, ifXTable and vendor extensions of ifEntry, into rows:
+//
+//	ifTable, err := x.BulkWalkAll(oids.IfTable)
+//	ifXTable, err := x.BulkWalkAll(oids.IfXTable)
+//	join := gosnmp.NewTableJoin([]string{ifDescr, ifHCInOctets, ifAlias}, ifTable, ifXTable)
+//	for join.Next() {
+//		row := join.Row()
+//		...
+//	}
+//
+// Rows are produced one at a time in the order of their indexes. A row is
+// produced if any of the columns has a value for its index, the other
+// columns are of type NoSuchInstance in it, so rows missing from a table
+// are told apart from rows of other tables.
+type TableJoin struct {
+	columns []string
+	values  [][]joinValue // by column, sorted by index
+	row     TableRow
+}
+
+type joinValue struct {
+	index string
+	pdu   SnmpPDU
+}
+
+// TableRow is a row of a TableJoin.
+type TableRow struct {
+	// Index is the row index, the sub-identifiers after the columns.
+	Index string
+	// Values are the variables of the row, one per column in the order of
+	// the columns of the join.
+	Values []SnmpPDU
+}
+
+// Has reports whether the row has a value for column i.
+func (r TableRow) Has(i int) bool {
+	t := r.Values[i].Type
+	return t != NoSuchInstance && t != NoSuchObject && t != EndOfMibView
+}
+
+// NewTableJoin joins the columns found in the walks, e.g. the results of
+// BulkWalkAll for each table. Variables outside the columns are ignored.
+func NewTableJoin(columns []string, walks ...[]SnmpPDU) *TableJoin {
+	j := &TableJoin{columns: make([]string, len(columns)), values: make([][]joinValue, len(columns))}
+	for i, column := range columns {
+		j.columns[i] = walkRoot(column)
+	}
+	for _, walk := range walks {
+		for _, pdu := range walk {
+			// the longest column, as one may be below another
+			c, index := -1, ""
+			for i, column := range j.columns {
+				if idx, ok := oids.Index(pdu.Name, column); ok && (c < 0 || len(column) > len(j.columns[c])) {
+					c, index = i, idx
+				}
+			}
+			if c >= 0 {
+				j.values[c] = append(j.values[c], joinValue{index: index, pdu: pdu})
+			}
+		}
+	}
+	for _, values := range j.values {
+		sort.SliceStable(values, func(a, b int) bool { return oidLess(values[a].index, values[b].index) })
+	}
+	return j
+}
+
+// Next advances to the next row, returning false after the last row.
+func (j *TableJoin) Next() bool {
+	// the lowest index at the head of the columns
+	index, found := "", false
+	for _, values := range j.values {
+		if len(values) > 0 && (!found || oidLess(values[0].index, index)) {
+			index, found = values[0].index, true
+		}
+	}
+	if !found {
+		j.row = TableRow{}
+		return false
+	}
+	j.row = TableRow{Index: index, Values: make([]SnmpPDU, len(j.columns))}
+	for c, values := range j.values {
+		j.row.Values[c] = SnmpPDU{Name: j.columns[c] + "." + index, Type: NoSuchInstance}
+		// a duplicate index, e.g. from walks overlapping, is skipped
+		for len(values) > 0 && values[0].index == index {
+			if !j.row.Has(c) {
+				j.row.Values[c] = values[0].pdu
+			}
+			values = values[1:]
+		}
+		j.values[c] = values
+	}
+	return true
+}
+
+// Row returns the current row.
+func (j *TableJoin) Row() TableRow {
+	return j.row
+}
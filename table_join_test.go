@@ -0,0 +1,64 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || helper
+// +build all helper
+
+package gosnmp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableJoin(t *testing.T) {
+	const (
+		ifDescr      = ".1.3.6.1.2.1.2.2.1.2"
+		ifHCInOctets = ".1.3.6.1.2.1.31.1.1.1.6"
+		vendorSpeed  = ".1.3.6.1.4.1.99999.1.1.1"
+	)
+	ifTable := []SnmpPDU{
+		{Name: ifDescr + ".1", Type: OctetString, Value: "lo"},
+		{Name: ifDescr + ".2", Type: OctetString, Value: "eth0"},
+		{Name: ifDescr + ".10", Type: OctetString, Value: "eth1"},
+		{Name: ".1.3.6.1.2.1.2.2.1.3.1", Type: Integer, Value: 24}, // not joined
+	}
+	ifXTable := []SnmpPDU{
+		{Name: ifHCInOctets + ".10", Type: Counter64, Value: uint64(100)},
+		{Name: ifHCInOctets + ".2", Type: Counter64, Value: uint64(20)},
+	}
+	vendor := []SnmpPDU{
+		{Name: vendorSpeed + ".2", Type: Gauge32, Value: uint(1000)},
+		{Name: vendorSpeed + ".3", Type: Gauge32, Value: uint(10)}, // only in the vendor table
+	}
+
+	join := NewTableJoin([]string{ifDescr, ifHCInOctets, "1.3.6.1.4.1.99999.1.1.1"}, ifTable, ifXTable, vendor)
+	var indexes []string
+	var rows []TableRow
+	for join.Next() {
+		indexes = append(indexes, join.Row().Index)
+		rows = append(rows, join.Row())
+	}
+	assert.False(t, join.Next())
+	assert.Equal(t, []string{"1", "2", "3", "10"}, indexes)
+
+	assert.Equal(t, "lo", rows[0].Values[0].Value)
+	assert.False(t, rows[0].Has(1))
+	assert.Equal(t, SnmpPDU{Name: ifHCInOctets + ".1", Type: NoSuchInstance}, rows[0].Values[1])
+
+	assert.True(t, rows[1].Has(0) && rows[1].Has(1) && rows[1].Has(2))
+	assert.Equal(t, uint64(20), rows[1].Values[1].Value)
+	assert.Equal(t, uint(1000), rows[1].Values[2].Value)
+
+	assert.False(t, rows[2].Has(0))
+	assert.Equal(t, uint(10), rows[2].Values[2].Value)
+
+	assert.Equal(t, "eth1", rows[3].Values[0].Value)
+	assert.Equal(t, uint64(100), rows[3].Values[1].Value)
+	assert.False(t, rows[3].Has(2))
+
+	// nothing to join
+	assert.False(t, NewTableJoin([]string{ifDescr}).Next())
+}
@@ -5,7 +5,10 @@
 package gosnmp
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"net"
 	"strings"
 	"sync"
@@ -22,21 +25,30 @@ import (
 // pdus[0] can a pdu of Type TimeTicks (with the desired uint32 epoch
 // time).  Otherwise a TimeTicks pdu will be prepended, with time set to
 // now. This mirrors the behaviour of the Net-SNMP command-line tools.
+// Alternatively set trap.TrapOID, and optionally trap.Uptime, to have
+// sysUpTime.0 and snmpTrapOID.0 prepended to the variables.
+//
+// The sender of an SNMPv3 trap is its authoritative engine: set
+// x.LocalEngine, or the engine ID, boots and time of x.SecurityParameters.
 //
 // SendTrap doesn't wait for a return packet from the NMS (Network
 // Management Station).
 //
-// See also Listen() and examples for creating an NMS.
+// See also Listen() and examples for creating an NMS, and SendV1Trap.
 //
 // NOTE: the trap code is currently unreliable when working with snmpv3 - pull requests welcome
 func (x *GoSNMP) SendTrap(trap SnmpTrap) (result *SnmpPacket, err error) {
+	return x.sendTrap(x.requestOpts, trap)
+}
+
+func (x *GoSNMP) sendTrap(o *requestOptions, trap SnmpTrap) (result *SnmpPacket, err error) {
 	var pdutype PDUType
 
-	if len(trap.Variables) == 0 {
+	if len(trap.Variables) == 0 && trap.TrapOID == "" {
 		return nil, fmt.Errorf("function SendTrap requires at least 1 PDU")
 	}
 
-	if trap.Variables[0].Type == TimeTicks {
+	if len(trap.Variables) > 0 && trap.Variables[0].Type == TimeTicks {
 		// check is uint32
 		if _, ok := trap.Variables[0].Value.(uint32); !ok {
 			return nil, fmt.Errorf("function SendTrap TimeTick must be uint32")
@@ -53,7 +65,16 @@ func (x *GoSNMP) SendTrap(trap SnmpTrap) (result *SnmpPacket, err error) {
 			pdutype = InformRequest
 		}
 
-		if trap.Variables[0].Type != TimeTicks {
+		if trap.TrapOID != "" {
+			uptime := trap.Uptime
+			if uptime == 0 {
+				uptime = uint32(time.Now().Unix())
+			}
+			trap.Variables = append([]SnmpPDU{
+				{Name: sysUpTimeOID, Type: TimeTicks, Value: uptime},
+				{Name: snmpTrapOIDOID, Type: ObjectIdentifier, Value: trap.TrapOID},
+			}, trap.Variables...)
+		} else if trap.Variables[0].Type != TimeTicks {
 			now := uint32(time.Now().Unix())
 			timetickPDU := SnmpPDU{Name: "1.3.6.1.2.1.1.3.0", Type: TimeTicks, Value: now}
 			// prepend timetickPDU
@@ -74,7 +95,7 @@ func (x *GoSNMP) SendTrap(trap SnmpTrap) (result *SnmpPacket, err error) {
 		return nil, err
 	}
 
-	packetOut := x.mkSnmpPacket(pdutype, trap.Variables, 0, 0)
+	packetOut := x.mkCallPacket(o, pdutype, trap.Variables, 0, 0)
 	if x.Version == Version1 {
 		packetOut.Enterprise = trap.Enterprise
 		packetOut.AgentAddress = trap.AgentAddress
@@ -82,12 +103,82 @@ func (x *GoSNMP) SendTrap(trap SnmpTrap) (result *SnmpPacket, err error) {
 		packetOut.SpecificTrap = trap.SpecificTrap
 		packetOut.Timestamp = trap.Timestamp
 	}
+	if x.Version == Version3 && !trap.IsInform {
+		// RFC 3412 7.1: the reportableFlag is clear for unconfirmed PDUs
+		packetOut.MsgFlags &^= Reportable
+		if x.LocalEngine != nil {
+			if err = x.LocalEngine.authorTrap(packetOut); err != nil {
+				return nil, err
+			}
+		}
+	}
 
 	// all sends wait for the return packet, except for SNMPv2Trap
 	// -> wait is only for informs
 	return x.send(packetOut, trap.IsInform)
 }
 
+// SendInform sends an InformRequest (v2c/v3) and waits for its
+// acknowledgement, retransmitting up to Retries times with the timeout
+// doubled each time unless opts say otherwise. Variables are handled as by
+// SendTrap. The returned Response tells that the inform was delivered; a
+// Response with an error status is returned along with an error.
+func (x *GoSNMP) SendInform(inform SnmpTrap, opts ...RequestOption) (result *SnmpPacket, err error) {
+	if x.Version != Version2c && x.Version != Version3 {
+		return nil, fmt.Errorf("function SendInform doesn't support %s", x.Version)
+	}
+	inform.IsInform = true
+	opts = append([]RequestOption{WithExponentialTimeout(true)}, opts...)
+	result, err = x.sendTrap(callOptions(x.requestOpts, opts), inform)
+	if err != nil {
+		return result, err
+	}
+	if result.PDUType != GetResponse {
+		return result, fmt.Errorf("inform answered with PDU type 0x%x instead of a Response", byte(result.PDUType))
+	}
+	if result.Error != NoError {
+		return result, fmt.Errorf("inform rejected: %s at index %d", result.Error, result.ErrorIndex)
+	}
+	return result, nil
+}
+
+// SendV1Trap sends an SNMPv1 Trap PDU, for managers and devices that only
+// accept v1 traps; the session must be Version1. Unlike SendTrap it accepts
+// traps without variables, such as coldStart, and it checks the v1 header
+// first: Enterprise must be an OID, AgentAddress an IPv4 address and
+// GenericTrap between 0 (coldStart) and 6 (enterpriseSpecific), the latter
+// qualified by SpecificTrap. Timestamp is the sysUpTime of the sender in
+// hundredths of a second.
+func (x *GoSNMP) SendV1Trap(trap SnmpTrap) (result *SnmpPacket, err error) {
+	return x.sendV1Trap(x.requestOpts, trap)
+}
+
+func (x *GoSNMP) sendV1Trap(o *requestOptions, trap SnmpTrap) (result *SnmpPacket, err error) {
+	if x.Version != Version1 {
+		return nil, fmt.Errorf("function SendV1Trap requires a SNMPV1 session, not %s", x.Version)
+	}
+	if _, err = marshalObjectIdentifier(trap.Enterprise); err != nil || trap.Enterprise == "" {
+		return nil, fmt.Errorf("function SendV1Trap requires an Enterprise OID, got %q", trap.Enterprise)
+	}
+	if ip := net.ParseIP(trap.AgentAddress); ip == nil || ip.To4() == nil {
+		return nil, fmt.Errorf("function SendV1Trap requires an IPv4 Agent Address, got %q", trap.AgentAddress)
+	}
+	if trap.GenericTrap < 0 || trap.GenericTrap > 6 {
+		return nil, fmt.Errorf("function SendV1Trap GenericTrap %d is not between 0 and 6", trap.GenericTrap)
+	}
+	if trap.SpecificTrap < 0 {
+		return nil, fmt.Errorf("function SendV1Trap SpecificTrap %d is negative", trap.SpecificTrap)
+	}
+
+	packetOut := x.mkCallPacket(o, Trap, trap.Variables, 0, 0)
+	packetOut.Enterprise = trap.Enterprise
+	packetOut.AgentAddress = trap.AgentAddress
+	packetOut.GenericTrap = trap.GenericTrap
+	packetOut.SpecificTrap = trap.SpecificTrap
+	packetOut.Timestamp = trap.Timestamp
+	return x.send(packetOut, false)
+}
+
 //
 // Receiving Traps ie GoSNMP acting as an NMS (Network Management
 // Station).
@@ -105,14 +196,71 @@ type TrapListener struct {
 	// Params is a reference to the TrapListener's "parent" GoSNMP instance.
 	Params *GoSNMP
 
-	// OnNewTrap handles incoming Trap and Inform PDUs.
+	// OnNewTrap handles incoming Trap, SNMPv2-Trap and Inform PDUs, other
+	// PDU types are dropped.
 	OnNewTrap TrapHandlerFunc
 
+	// Workers, if positive, is the number of goroutines calling OnNewTrap
+	// for UDP traps, so that a slow handler does not hold up the socket.
+	// OnNewTrap must then be safe for concurrent use. By default traps are
+	// handled one at a time by the goroutine reading them.
+	Workers int
+
+	// QueueSize is the number of UDP traps waiting for a worker, Workers if
+	// unset. Traps arriving while the queue is full are dropped, informs
+	// are then not acknowledged so that their sender retransmits them.
+	QueueSize int
+
+	// SourceRate, if positive, limits the UDP traps handled per source
+	// address to SourceRate per second, with bursts of SourceBurst traps
+	// (at least 1). Traps over the limit are dropped before being decoded.
+	SourceRate  float64
+	SourceBurst int
+
+	// ACL, if set, restricts the sources, communities and SNMPv3 users
+	// traps are accepted from; rejected traps are counted by Dropped.
+	ACL *TrapACL
+
+	// TCP, if set, makes a UDP listener also accept SNMP over TCP
+	// connections (RFC 3430) on the same address and port.
+	TCP bool
+
+	// MulticastGroups are IPv4 or IPv6 multicast groups a UDP listener
+	// joins, on MulticastInterface or, if nil, on the interface chosen by
+	// the system. To receive the traps sent to the groups the listener must
+	// be bound to the unspecified address, e.g. ":162" or "[::]:162".
+	// IPv6 groups of link-local scope need MulticastInterface.
+	MulticastGroups    []net.IP
+	MulticastInterface *net.Interface
+
 	// These unexported fields are for letting test cases
 	// know we are ready.
 	conn  *net.UDPConn
 	proto string
 
+	// tcpListener accepts the connections of a TCP listener, handlers
+	// counts their handlers in flight and stopped is closed once Listen has
+	// returned and the handlers are done.
+	tcpListener net.Listener
+	tcpConns    map[net.Conn]struct{}
+	handlers    sync.WaitGroup
+	stopped     chan struct{}
+	stopOnce    sync.Once
+
+	limiter    *sourceLimiter
+	queueFull  uint64
+	rateLimits uint64
+	rejected   uint64
+
+	// counters of Stats
+	received         uint64
+	parseErrors      uint64
+	authFailures     uint64
+	notNotifications uint64
+	v1Traps          uint64
+	v2cTraps         uint64
+	v3Traps          uint64
+
 	finish int32 // Atomic flag; set to 1 when closing connection
 }
 
@@ -136,7 +284,10 @@ type TrapHandlerFunc func(s *SnmpPacket, u *net.UDPAddr)
 func NewTrapListener() *TrapListener {
 	tl := &TrapListener{
 		finish: 0,
-		done:   make(chan bool),
+		// Buffered so that a listener closed before it was ready does not
+		// block.
+		done:    make(chan bool, 1),
+		stopped: make(chan struct{}),
 		// Buffered because one doesn't have to block on it.
 		listening: make(chan bool, 1),
 	}
@@ -154,23 +305,69 @@ func (t *TrapListener) Listening() <-chan bool {
 	return t.listening
 }
 
-// Close terminates the listening on TrapListener socket
+// Close terminates the listening on TrapListener socket, closes the TCP
+// connections and waits for the handler of a UDP trap in progress. It must
+// not be called from OnNewTrap. Use Wait to also wait for the handlers of
+// TCP connections.
 //
 // NOTE: the trap code is currently unreliable when working with snmpv3 - pull requests welcome
 func (t *TrapListener) Close() {
 	// Prevent concurrent calls to Close
 	if atomic.CompareAndSwapInt32(&t.finish, 0, 1) {
-		// TODO there's bugs here
-		if t.conn == nil {
+		t.Lock()
+		conn, tcpListener := t.conn, t.tcpListener
+		for c := range t.tcpConns {
+			// the handlers return once their connection is closed
+			c.Close()
+		}
+		t.Unlock()
+		if conn == nil && tcpListener == nil {
 			return
 		}
-		if t.conn.LocalAddr().Network() == udp {
-			t.conn.Close()
+		if conn != nil {
+			conn.Close()
+		}
+		if tcpListener != nil {
+			tcpListener.Close()
 		}
 		<-t.done
 	}
 }
 
+// Wait blocks until Listen has returned and the handlers of received traps
+// are done.
+func (t *TrapListener) Wait() {
+	<-t.stopped
+}
+
+// ListenContext is Listen until ctx is done: the listener is then closed,
+// in-flight handlers are drained and ctx.Err() is returned.
+func (t *TrapListener) ListenContext(ctx context.Context, addr string) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			t.Close()
+		case <-stop:
+		}
+	}()
+	err := t.Listen(addr)
+	t.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// stop marks the listener stopped once its handlers are done.
+func (t *TrapListener) stop() {
+	t.handlers.Wait()
+	if t.stopped != nil {
+		t.stopOnce.Do(func() { close(t.stopped) })
+	}
+}
+
 func (t *TrapListener) listenUDP(addr string) error {
 	// udp
 
@@ -178,25 +375,76 @@ func (t *TrapListener) listenUDP(addr string) error {
 	if err != nil {
 		return err
 	}
-	t.conn, err = net.ListenUDP(udp, udpAddr)
+	conn, err := net.ListenUDP(t.proto, udpAddr)
 	if err != nil {
 		return err
 	}
+	defer conn.Close()
 
-	defer t.conn.Close()
+	for _, group := range t.MulticastGroups {
+		if err = joinGroup(conn, t.MulticastInterface, group); err != nil {
+			return fmt.Errorf("error joining multicast group %s: %w", group, err)
+		}
+	}
+
+	var l *net.TCPListener
+	if t.TCP {
+		local := conn.LocalAddr().(*net.UDPAddr)
+		network := tcp + strings.TrimPrefix(t.proto, udp)
+		l, err = net.ListenTCP(network, &net.TCPAddr{IP: local.IP, Port: local.Port, Zone: local.Zone})
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+	}
+
+	// Close waits for the loop below once it sees the connection, which is
+	// only published when nothing can fail before the loop
+	t.Lock()
+	t.conn = conn
+	if l != nil {
+		t.tcpListener = l
+	}
+	t.Unlock()
+
+	if l != nil {
+		t.handlers.Add(1)
+		go func() {
+			defer t.handlers.Done()
+			if err := t.acceptTCP(l); err != nil {
+				t.Params.Logger.Printf("TrapListener: stopped accepting TCP connections: %s\n", err)
+			}
+		}()
+	}
+
+	if t.SourceRate > 0 {
+		t.limiter = newSourceLimiter(t.SourceRate, t.SourceBurst)
+	}
+	queue, workers := t.startWorkers(conn)
+	// drain hands the queued traps to the workers and waits for them,
+	// before the connection their inform responses use is closed
+	drain := func() {
+		if queue != nil {
+			close(queue)
+			workers.Wait()
+			queue = nil
+		}
+	}
+	defer drain()
 
 	// Mark that we are listening now.
 	t.listening <- true
 
+	buf := make([]byte, rxBufSize)
 	for {
 		switch {
 		case atomic.LoadInt32(&t.finish) == 1:
+			drain()
 			t.done <- true
 			return nil
 
 		default:
-			var buf [4096]byte
-			rlen, remote, err := t.conn.ReadFromUDP(buf[:])
+			rlen, remote, err := conn.ReadFromUDP(buf)
 			if err != nil {
 				if atomic.LoadInt32(&t.finish) == 1 {
 					// err most likely comes from reading from a closed connection
@@ -206,78 +454,174 @@ func (t *TrapListener) listenUDP(addr string) error {
 				continue
 			}
 
-			msg := buf[:rlen]
-			traps := t.Params.UnmarshalTrap(msg, false)
-
-			if traps != nil {
-				// Here we assume that t.OnNewTrap will not alter the contents
-				// of the PDU (per documentation, because Go does not have
-				// compile-time const checking).  We don't pass a copy because
-				// the SnmpPacket type is somewhat large, but we could without
-				// violating any implicit or explicit spec.
-				t.OnNewTrap(traps, remote)
-
-				// If it was an Inform request, we need to send a response.
-				if traps.PDUType == InformRequest { //nolint:whitespace
-
-					// Reuse the packet, since we're supposed to send it back
-					// with the exact same variables unless there's an error.
-					// Change the PDUType to the response, though.
-					traps.PDUType = GetResponse
-
-					// If the response can be sent, the error-status is
-					// supposed to be set to noError and the error-index set to
-					// zero.
-					traps.Error = NoError
-					traps.ErrorIndex = 0
-
-					// TODO: Check that the message marshalled is not too large
-					// for the originator to accept and if so, send a tooBig
-					// error PDU per RFC3416 section 4.2.7.  This maximum size,
-					// however, does not have a well-defined mechanism in the
-					// RFC other than using the path MTU (which is difficult to
-					// determine), so it's left to future implementations.
-					ob, err := traps.marshalMsg()
-					if err != nil {
-						return fmt.Errorf("error marshaling INFORM response: %w", err)
-					}
-
-					// Send the return packet back.
-					count, err := t.conn.WriteTo(ob, remote)
-					if err != nil {
-						return fmt.Errorf("error sending INFORM response: %w", err)
-					}
-
-					// This isn't fatal, but should be logged.
-					if count != len(ob) {
-						t.Params.Logger.Printf("Failed to send all bytes of INFORM response!\n")
-					}
+			atomic.AddUint64(&t.received, 1)
+			if !t.admitSource(remote.IP) {
+				continue
+			}
+			if t.limiter != nil && !t.limiter.allow(remote.IP, time.Now()) {
+				atomic.AddUint64(&t.rateLimits, 1)
+				continue
+			}
+
+			// decoded values refer to the message, which outlives the
+			// next read when queued or kept by OnNewTrap
+			traps := t.decode(append([]byte(nil), buf[:rlen]...), remote)
+			if traps == nil || !t.admit(traps, remote.IP) {
+				continue
+			}
+
+			if queue != nil {
+				select {
+				case queue <- receivedTrap{packet: traps, remote: remote}:
+				default:
+					atomic.AddUint64(&t.queueFull, 1)
 				}
+				continue
+			}
+			if err := t.handleUDP(conn, traps, remote); err != nil {
+				return err
 			}
 		}
 	}
 }
 
-func (t *TrapListener) handleTCPRequest(conn net.Conn) {
-	// Make a buffer to hold incoming data.
-	buf := make([]byte, 4096)
-	// Read the incoming connection into the buffer.
-	reqLen, err := conn.Read(buf)
+// handleUDP passes a trap received on conn to OnNewTrap and acknowledges
+// informs.
+func (t *TrapListener) handleUDP(conn *net.UDPConn, traps *SnmpPacket, remote *net.UDPAddr) error {
+	// Here we assume that t.OnNewTrap will not alter the contents
+	// of the PDU (per documentation, because Go does not have
+	// compile-time const checking).  We don't pass a copy because
+	// the SnmpPacket type is somewhat large, but we could without
+	// violating any implicit or explicit spec.
+	t.OnNewTrap(traps, remote)
+
+	// If it was an Inform request, we need to send a response.
+	if traps.PDUType != InformRequest {
+		return nil
+	}
+
+	ob, err := informResponse(traps)
+	if err != nil {
+		return err
+	}
+
+	// Send the return packet back.
+	count, err := conn.WriteTo(ob, remote)
 	if err != nil {
-		t.Params.Logger.Printf("TrapListener: error in read %s\n", err)
+		return fmt.Errorf("error sending INFORM response: %w", err)
+	}
+
+	// This isn't fatal, but should be logged.
+	if count != len(ob) {
+		t.Params.Logger.Printf("Failed to send all bytes of INFORM response!\n")
+	}
+	return nil
+}
+
+// udpAddrOf returns the UDP address with the IP, port and zone of addr, or
+// nil.
+func udpAddrOf(addr net.Addr) *net.UDPAddr {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a
+	case *net.TCPAddr:
+		return &net.UDPAddr{IP: a.IP, Port: a.Port, Zone: a.Zone}
+	}
+	r, _ := net.ResolveUDPAddr(udp, addr.String())
+	return r
+}
+
+// informResponse encodes the response to an inform.
+func informResponse(inform *SnmpPacket) ([]byte, error) {
+	// The response echoes the variables with noError and a
+	// zero error-index.
+	//
+	// TODO: Check that the message marshalled is not too large
+	// for the originator to accept and if so, send a tooBig
+	// error PDU per RFC3416 section 4.2.7.  This maximum size,
+	// however, does not have a well-defined mechanism in the
+	// RFC other than using the path MTU (which is difficult to
+	// determine), so it's left to future implementations.
+	ob, err := inform.Response(inform.Variables).marshalMsg()
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling INFORM response: %w", err)
+	}
+	return ob, nil
+}
+
+// handleTCPRequest handles the messages of a TCP connection until it is
+// closed. As per RFC 3430 each message is a BER encoded SNMP message sent
+// back to back with the previous one, and informs are acknowledged on the
+// connection.
+func (t *TrapListener) handleTCPRequest(conn net.Conn) {
+	// Close the connection when you're done with it.
+	defer conn.Close()
+	if !t.trackConn(conn) {
 		return
 	}
+	defer t.untrackConn(conn)
 
-	msg := buf[:reqLen]
-	traps := t.Params.UnmarshalTrap(msg, false)
+	// handlers are given a UDP address for backward compatibility
+	r := udpAddrOf(conn.RemoteAddr())
+	var ip net.IP
+	if r != nil {
+		ip = r.IP
+	}
+	if !t.admitSource(ip) {
+		return
+	}
+
+	rd := bufio.NewReader(conn)
+	for {
+		msg, err := readBERMessage(rd, rxBufSize)
+		if err != nil {
+			if err != io.EOF && atomic.LoadInt32(&t.finish) == 0 {
+				t.Params.Logger.Printf("TrapListener: error in read %s\n", err)
+			}
+			return
+		}
+
+		atomic.AddUint64(&t.received, 1)
+		traps := t.decode(msg, conn.RemoteAddr())
+		if traps == nil || !t.admit(traps, ip) {
+			continue
+		}
 
-	if traps != nil {
-		// TODO: lying for backward compatibility reason - create UDP Address ... not nice
-		r, _ := net.ResolveUDPAddr("", conn.RemoteAddr().String())
 		t.OnNewTrap(traps, r)
+		if traps.PDUType != InformRequest {
+			continue
+		}
+		ob, err := informResponse(traps)
+		if err != nil {
+			t.Params.Logger.Printf("TrapListener: %s\n", err)
+			continue
+		}
+		if _, err = conn.Write(ob); err != nil {
+			t.Params.Logger.Printf("TrapListener: error sending INFORM response: %s\n", err)
+			return
+		}
 	}
-	// Close the connection when you're done with it.
-	conn.Close()
+}
+
+// trackConn registers a TCP connection for Close, returning false if the
+// listener is already closing.
+func (t *TrapListener) trackConn(conn net.Conn) bool {
+	t.Lock()
+	defer t.Unlock()
+	if atomic.LoadInt32(&t.finish) == 1 {
+		return false
+	}
+	if t.tcpConns == nil {
+		t.tcpConns = make(map[net.Conn]struct{})
+	}
+	t.tcpConns[conn] = struct{}{}
+	return true
+}
+
+func (t *TrapListener) untrackConn(conn net.Conn) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.tcpConns, conn)
 }
 
 func (t *TrapListener) listenTCP(addr string) error {
@@ -286,41 +630,62 @@ func (t *TrapListener) listenTCP(addr string) error {
 		return err
 	}
 
-	l, err := net.ListenTCP(tcp, tcpAddr)
+	l, err := net.ListenTCP(t.proto, tcpAddr)
 	if err != nil {
 		return err
 	}
+	t.Lock()
+	t.tcpListener = l
+	t.Unlock()
 
 	defer l.Close()
 
 	// Mark that we are listening now.
 	t.listening <- true
 
-	for {
-		switch {
-		case atomic.LoadInt32(&t.finish) == 1:
-			t.done <- true
-			return nil
-		default:
+	err = t.acceptTCP(l)
+	if err != nil {
+		return err
+	}
+	t.done <- true
+	return nil
+}
 
-			// Listen for an incoming connection.
-			conn, err := l.Accept()
-			fmt.Printf("ACCEPT: %s", conn)
-			if err != nil {
-				fmt.Println("error accepting: ", err.Error())
-				return err
+// acceptTCP handles the connections accepted by l until the listener is
+// closed.
+func (t *TrapListener) acceptTCP(l net.Listener) error {
+	for {
+		// Listen for an incoming connection.
+		conn, err := l.Accept()
+		if err != nil {
+			if atomic.LoadInt32(&t.finish) == 1 {
+				// the listener was closed by Close
+				return nil
 			}
-			// Handle connections in a new goroutine.
-			go t.handleTCPRequest(conn)
+			t.Params.Logger.Printf("TrapListener: error accepting: %s\n", err)
+			return err
 		}
+		// Handle connections in a new goroutine.
+		t.handlers.Add(1)
+		go func() {
+			defer t.handlers.Done()
+			t.handleTCPRequest(conn)
+		}()
 	}
 }
 
 // Listen listens on the UDP address addr and calls the OnNewTrap
-// function specified in *TrapListener for every trap received.
+// function specified in *TrapListener for every trap received. An addr of
+// the form "tcp://host:port" listens for SNMP over TCP instead, see also
+// TrapListener.TCP to listen on both; "udp4://", "udp6://", "tcp4://" and
+// "tcp6://" restrict the listener to IPv4 or IPv6. IPv6 addresses are
+// given in brackets, with the zone of link-local addresses, e.g.
+// "udp6://[fe80::1%eth0]:162". OnNewTrap gets the source address of each
+// trap, including its zone.
 //
 // NOTE: the trap code is currently unreliable when working with snmpv3 - pull requests welcome
 func (t *TrapListener) Listen(addr string) error {
+	defer t.stop()
 	if t.Params == nil {
 		t.Params = Default
 	}
@@ -334,6 +699,11 @@ func (t *TrapListener) Listen(addr string) error {
 	if t.OnNewTrap == nil {
 		t.OnNewTrap = t.debugTrapHandler
 	}
+	if t.ACL != nil {
+		if err := t.ACL.Validate(); err != nil {
+			return err
+		}
+	}
 
 	splitted := strings.SplitN(addr, "://", 2)
 	t.proto = udp
@@ -343,15 +713,22 @@ func (t *TrapListener) Listen(addr string) error {
 	}
 
 	switch t.proto {
-	case tcp:
+	case tcp, "tcp4", "tcp6":
 		return t.listenTCP(addr)
-	case udp:
+	case udp, "udp4", "udp6":
 		return t.listenUDP(addr)
 	default:
 		return fmt.Errorf("not implemented network protocol: %s [use: tcp/udp]", t.proto)
 	}
 }
 
+// isNotification reports whether a TrapListener passes PDUs of type t to
+// OnNewTrap: SNMPv1 Trap, SNMPv2-Trap and InformRequest. Others, such as
+// requests sent to the trap port by mistake, are dropped.
+func isNotification(t PDUType) bool {
+	return t == Trap || t == SNMPv2Trap || t == InformRequest
+}
+
 // Default trap handler
 func (t *TrapListener) debugTrapHandler(s *SnmpPacket, u *net.UDPAddr) {
 	t.Params.Logger.Printf("got trapdata from %+v: %+v\n", u, s)
@@ -361,12 +738,25 @@ func (t *TrapListener) debugTrapHandler(s *SnmpPacket, u *net.UDPAddr) {
 //
 // NOTE: the trap code is currently unreliable when working with snmpv3 - pull requests welcome
 func (x *GoSNMP) UnmarshalTrap(trap []byte, useResponseSecurityParameters bool) (result *SnmpPacket) {
+	result, _ = x.unmarshalTrap(trap, useResponseSecurityParameters)
+	return result
+}
+
+// unmarshalTrap is UnmarshalTrap, also reporting whether an SNMPv3 trap
+// failed authentication, timeliness or decryption.
+func (x *GoSNMP) unmarshalTrap(trap []byte, useResponseSecurityParameters bool) (result *SnmpPacket, authFailure bool) {
+	if x.StrictBER {
+		if err := ValidateBER(trap); err != nil {
+			x.Logger.Printf("UnmarshalTrap: %s\n", err)
+			return nil, false
+		}
+	}
 	result = new(SnmpPacket)
 
 	if x.SecurityParameters != nil {
 		err := x.SecurityParameters.initSecurityKeys()
 		if err != nil {
-			return nil
+			return nil, false
 		}
 		result.SecurityParameters = x.SecurityParameters.Copy()
 	}
@@ -374,28 +764,34 @@ func (x *GoSNMP) UnmarshalTrap(trap []byte, useResponseSecurityParameters bool)
 	cursor, err := x.unmarshalHeader(trap, result)
 	if err != nil {
 		x.Logger.Printf("UnmarshalTrap: %s\n", err)
-		return nil
+		return nil, false
 	}
 
 	if result.Version == Version3 {
-		if result.SecurityModel == UserSecurityModel {
-			err = x.testAuthentication(trap, result, useResponseSecurityParameters)
-			if err != nil {
-				x.Logger.Printf("UnmarshalTrap v3 auth: %s\n", err)
-				return nil
-			}
+		if x.UsmUsers != nil {
+			// the credentials were looked up for the message
+			useResponseSecurityParameters = true
+		}
+		err = x.testAuthentication(trap, result, useResponseSecurityParameters)
+		if err != nil {
+			x.Logger.Printf("UnmarshalTrap v3 auth: %s\n", err)
+			return nil, true
+		}
+		if err = x.checkTimeliness(result); err != nil {
+			x.Logger.Printf("UnmarshalTrap v3 timeliness: %s\n", err)
+			return nil, true
 		}
 
 		trap, cursor, err = x.decryptPacket(trap, cursor, result)
 		if err != nil {
 			x.Logger.Printf("UnmarshalTrap v3 decrypt: %s\n", err)
-			return nil
+			return nil, true
 		}
 	}
 	err = x.unmarshalPayload(trap, cursor, result)
 	if err != nil {
 		x.Logger.Printf("UnmarshalTrap: %s\n", err)
-		return nil
+		return nil, false
 	}
-	return result
+	return result, false
 }
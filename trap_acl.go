@@ -0,0 +1,140 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+)
+
+// TrapACLAny accepts any community or user in a TrapACLRule.
+const TrapACLAny = "*"
+
+// TrapACL restricts the traps a TrapListener accepts by source address,
+// community and SNMPv3 user, see TrapListener.ACL. A trap is accepted if a
+// rule whose Network contains its source accepts its community (SNMPv1 and
+// v2c) or user (SNMPv3). For example, to accept v2c traps with community
+// "public" from 10.0.0.0/8 and v3 traps of user "nms" from one host:
+//
+//	acl := &gosnmp.TrapACL{Rules: []gosnmp.TrapACLRule{
+//		{Network: "10.0.0.0/8", Communities: []string{"public"}},
+//		{Network: "192.0.2.10/32", Users: []string{"nms"}},
+//	}}
+type TrapACL struct {
+	Rules []TrapACLRule
+
+	// LogRejected logs the rejected traps with the Logger of the listener.
+	LogRejected bool
+
+	nets []*net.IPNet
+}
+
+// TrapACLRule accepts traps from the sources in Network.
+type TrapACLRule struct {
+	// Network is the source range in CIDR notation, e.g. "10.0.0.0/8" or
+	// "2001:db8::/32".
+	Network string
+
+	// Communities are the SNMPv1 and v2c communities accepted, TrapACLAny
+	// for any. Without communities the rule accepts no v1 and v2c traps.
+	Communities []string
+
+	// Users are the SNMPv3 user names accepted, TrapACLAny for any. Without
+	// users the rule accepts no v3 traps.
+	Users []string
+}
+
+// Validate parses the networks of the rules.
+func (a *TrapACL) Validate() error {
+	nets := make([]*net.IPNet, len(a.Rules))
+	for i, rule := range a.Rules {
+		_, ipnet, err := net.ParseCIDR(rule.Network)
+		if err != nil {
+			return fmt.Errorf("trap ACL rule %d: %w", i, err)
+		}
+		nets[i] = ipnet
+	}
+	a.nets = nets
+	return nil
+}
+
+// allowsSource reports whether a rule covers ip, so that traps from other
+// sources can be rejected before being decoded.
+func (a *TrapACL) allowsSource(ip net.IP) bool {
+	for _, ipnet := range a.nets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns why the trap in packet, received from ip, is rejected, or
+// "" if it is accepted.
+func (a *TrapACL) check(packet *SnmpPacket, ip net.IP) string {
+	var credential string
+	var kind string
+	if packet.Version == Version3 {
+		kind = "user"
+		if usp, ok := packet.SecurityParameters.(*UsmSecurityParameters); ok {
+			credential = usp.UserName
+		}
+	} else {
+		kind = "community"
+		credential = packet.Community
+	}
+	covered := false
+	for i, rule := range a.Rules {
+		if !a.nets[i].Contains(ip) {
+			continue
+		}
+		covered = true
+		accepted := rule.Communities
+		if packet.Version == Version3 {
+			accepted = rule.Users
+		}
+		for _, c := range accepted {
+			if c == TrapACLAny || c == credential {
+				return ""
+			}
+		}
+	}
+	if !covered {
+		return "source not allowed"
+	}
+	return fmt.Sprintf("%s %q not allowed from source", kind, credential)
+}
+
+// admitSource counts and logs a trap from ip rejected by the ACL before
+// being decoded, returning false.
+func (t *TrapListener) admitSource(ip net.IP) bool {
+	if t.ACL == nil || t.ACL.allowsSource(ip) {
+		return true
+	}
+	t.reject(ip, "source not allowed")
+	return false
+}
+
+// admit counts and logs a decoded trap from ip rejected by the ACL,
+// returning false.
+func (t *TrapListener) admit(packet *SnmpPacket, ip net.IP) bool {
+	if t.ACL == nil {
+		return true
+	}
+	reason := t.ACL.check(packet, ip)
+	if reason == "" {
+		return true
+	}
+	t.reject(ip, reason)
+	return false
+}
+
+func (t *TrapListener) reject(ip net.IP, reason string) {
+	atomic.AddUint64(&t.rejected, 1)
+	if t.ACL.LogRejected {
+		t.Params.Logger.Printf("TrapListener: rejected trap from %s: %s\n", ip, reason)
+	}
+}
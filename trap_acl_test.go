@@ -0,0 +1,94 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || trap
+// +build all trap
+
+package gosnmp
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrapACLCheck(t *testing.T) {
+	acl := &TrapACL{Rules: []TrapACLRule{
+		{Network: "10.0.0.0/8", Communities: []string{"public"}},
+		{Network: "10.1.0.0/16", Communities: []string{"ops"}, Users: []string{TrapACLAny}},
+		{Network: "192.0.2.10/32", Users: []string{"nms"}},
+		{Network: "2001:db8::/32", Communities: []string{TrapACLAny}},
+	}}
+	require.NoError(t, acl.Validate())
+
+	v2c := func(community string) *SnmpPacket {
+		return &SnmpPacket{Version: Version2c, Community: community}
+	}
+	v3 := func(user string) *SnmpPacket {
+		return &SnmpPacket{Version: Version3, SecurityParameters: &UsmSecurityParameters{UserName: user}}
+	}
+	tests := []struct {
+		packet *SnmpPacket
+		ip     string
+		reason string
+	}{
+		{v2c("public"), "10.2.3.4", ""},
+		{v2c("ops"), "10.2.3.4", `community "ops" not allowed from source`},
+		{v2c("ops"), "10.1.3.4", ""},
+		{v2c("public"), "10.1.3.4", ""},
+		{v2c("public"), "172.16.0.1", "source not allowed"},
+		{v3("nms"), "10.2.3.4", `user "nms" not allowed from source`},
+		{v3("admin"), "10.1.0.1", ""},
+		{v3("nms"), "192.0.2.10", ""},
+		{v3("admin"), "192.0.2.10", `user "admin" not allowed from source`},
+		{v2c("public"), "192.0.2.10", `community "public" not allowed from source`},
+		{v2c("anything"), "2001:db8::1", ""},
+	}
+	for _, tt := range tests {
+		ip := net.ParseIP(tt.ip)
+		assert.Equal(t, tt.reason, acl.check(tt.packet, ip), "%s from %s", tt.packet.Community, tt.ip)
+		assert.Equal(t, tt.reason != "source not allowed", acl.allowsSource(ip), tt.ip)
+	}
+
+	assert.Error(t, (&TrapACL{Rules: []TrapACLRule{{Network: "10.0.0.0"}}}).Validate())
+}
+
+func TestTrapListenerACL(t *testing.T) {
+	var handled int32
+	tl := NewTrapListener()
+	tl.ACL = &TrapACL{
+		Rules:       []TrapACLRule{{Network: "127.0.0.0/8", Communities: []string{"public"}}},
+		LogRejected: true,
+	}
+	tl.OnNewTrap = func(s *SnmpPacket, u *net.UDPAddr) {
+		atomic.AddInt32(&handled, 1)
+	}
+	var logged bytes.Buffer
+	tl.Params = &GoSNMP{Version: Version2c, Logger: NewLogger(log.New(&logged, "", 0))}
+	ts := startTrapListener(t, tl)
+
+	trap := SnmpTrap{Variables: []SnmpPDU{{Name: trapTestOid, Type: OctetString, Value: trapTestPayload}}}
+	_, err := ts.SendTrap(trap)
+	require.NoError(t, err)
+	ts.Community = "private"
+	_, err = ts.SendTrap(trap)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool { return tl.Dropped().Rejected == 1 }, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&handled) == 1 }, time.Second, time.Millisecond)
+	tl.Close()
+	assert.Contains(t, logged.String(), `rejected trap from 127.0.0.1: community "private" not allowed from source`)
+
+	// an invalid ACL fails Listen
+	tl = NewTrapListener()
+	tl.Params = &GoSNMP{Version: Version2c, Logger: NewLogger(nil)}
+	tl.ACL = &TrapACL{Rules: []TrapACLRule{{Network: "localhost"}}}
+	assert.Error(t, tl.Listen(net.JoinHostPort(trapTestAddress, "0")))
+}
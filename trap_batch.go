@@ -0,0 +1,136 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DefaultTrapBatchSize is the batch size of SendTrapBatch when
+// TrapBatchOptions.BatchSize is unset.
+const DefaultTrapBatchSize = 100
+
+// TrapBatchOptions controls the pacing of SendTrapBatch.
+type TrapBatchOptions struct {
+	// BatchSize is the number of traps sent between progress reports and
+	// pauses, DefaultTrapBatchSize if unset.
+	BatchSize int
+
+	// Interval is the minimum time between two traps, limiting the rate at
+	// which receivers are sent notifications.
+	Interval time.Duration
+
+	// Pause is the time waited after each batch.
+	Pause time.Duration
+
+	// StopOnError ends the batch at the first trap that cannot be sent,
+	// otherwise failed traps are collected and the rest are sent.
+	StopOnError bool
+
+	// Progress, if set, is called after each batch.
+	Progress func(TrapBatchProgress)
+}
+
+// TrapBatchProgress reports how far SendTrapBatch got.
+type TrapBatchProgress struct {
+	Total   int
+	Sent    int
+	Failed  int
+	Elapsed time.Duration
+}
+
+// TrapBatchError is returned by SendTrapBatch when traps could not be sent.
+type TrapBatchError struct {
+	// Errors holds the error of each failed trap by its index.
+	Errors map[int]error
+}
+
+func (e *TrapBatchError) Error() string {
+	first := -1
+	for i := range e.Errors {
+		if first < 0 || i < first {
+			first = i
+		}
+	}
+	return fmt.Sprintf("%d traps failed, first trap %d: %s", len(e.Errors), first, e.Errors[first])
+}
+
+// Indexes returns the indexes of the failed traps in ascending order, e.g.
+// to resend them.
+func (e *TrapBatchError) Indexes() []int {
+	out := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		out = append(out, i)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// SendTrapBatch sends traps with SendTrap, paced by opts, e.g. to replay the
+// notifications of an outage. Informs wait for their response as usual. The
+// batch ends early when ctx is done, returning ctx.Err(). The returned
+// progress covers the traps attempted.
+func (x *GoSNMP) SendTrapBatch(ctx context.Context, traps []SnmpTrap, opts TrapBatchOptions) (TrapBatchProgress, error) {
+	size := opts.BatchSize
+	if size <= 0 {
+		size = DefaultTrapBatchSize
+	}
+	progress := TrapBatchProgress{Total: len(traps)}
+	failed := &TrapBatchError{Errors: make(map[int]error)}
+	start := time.Now()
+	var last time.Time
+
+	for i, trap := range traps {
+		if i > 0 {
+			wait := opts.Interval - time.Since(last)
+			if i%size == 0 && opts.Pause > wait {
+				wait = opts.Pause
+			}
+			if err := sleepContext(ctx, wait); err != nil {
+				progress.Elapsed = time.Since(start)
+				return progress, err
+			}
+		}
+		last = time.Now()
+		_, err := x.SendTrap(trap)
+		if err != nil {
+			progress.Failed++
+			failed.Errors[i] = err
+		} else {
+			progress.Sent++
+		}
+		stop := err != nil && opts.StopOnError
+		if opts.Progress != nil && (stop || (i+1)%size == 0 || i == len(traps)-1) {
+			progress.Elapsed = time.Since(start)
+			opts.Progress(progress)
+		}
+		if stop {
+			break
+		}
+	}
+	progress.Elapsed = time.Since(start)
+	if len(failed.Errors) > 0 {
+		return progress, failed
+	}
+	return progress, nil
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || trap
+// +build all trap
+
+package gosnmp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendTrapBatch(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+	var received int32
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := srvr.ReadFrom(buf); err != nil {
+				return
+			}
+			atomic.AddInt32(&received, 1)
+		}
+	}()
+
+	x := &GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Version:   Version2c,
+		Community: "public",
+		Timeout:   time.Second,
+		MaxOids:   MaxOids,
+		Logger:    NewLogger(nil),
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	trap := SnmpTrap{Variables: []SnmpPDU{{Name: trapTestOid, Type: OctetString, Value: trapTestPayload}}}
+	traps := make([]SnmpTrap, 10)
+	for i := range traps {
+		traps[i] = trap
+	}
+	traps[4] = SnmpTrap{} // no variables
+
+	var reports []TrapBatchProgress
+	start := time.Now()
+	progress, err := x.SendTrapBatch(context.Background(), traps, TrapBatchOptions{
+		BatchSize: 4,
+		Pause:     20 * time.Millisecond,
+		Progress:  func(p TrapBatchProgress) { reports = append(reports, p) },
+	})
+	var berr *TrapBatchError
+	require.True(t, errors.As(err, &berr))
+	assert.Equal(t, []int{4}, berr.Indexes())
+	assert.Equal(t, 9, progress.Sent)
+	assert.Equal(t, 1, progress.Failed)
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(40*time.Millisecond), "two pauses")
+	require.Len(t, reports, 3)
+	assert.Equal(t, 10, reports[0].Total)
+	assert.Equal(t, 4, reports[0].Sent)
+	assert.Equal(t, 7, reports[1].Sent)
+	assert.Equal(t, 1, reports[1].Failed)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&received) == 9 }, time.Second, 5*time.Millisecond)
+
+	progress, err = x.SendTrapBatch(context.Background(), traps, TrapBatchOptions{StopOnError: true})
+	assert.Error(t, err)
+	assert.Equal(t, 4, progress.Sent)
+	assert.Equal(t, 1, progress.Failed)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	progress, err = x.SendTrapBatch(ctx, traps, TrapBatchOptions{Interval: 20 * time.Millisecond})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, progress.Sent, 5)
+}
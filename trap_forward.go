@@ -0,0 +1,143 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+)
+
+// TrapForwarder relays the notifications received by a TrapListener to a
+// list of upstream managers, e.g. to fan traps out from one collector:
+//
+//	f := &gosnmp.TrapForwarder{Destinations: []*gosnmp.GoSNMP{nms1, nms2}}
+//	tl := gosnmp.NewTrapListener()
+//	tl.OnNewTrap = f.Handler()
+//
+// Each destination is a connected session whose Version selects the trap
+// sent: SNMPv1 traps are translated for Version2c and Version3 destinations
+// as per RFC 3584 section 3.1 and SNMPv2 notifications for Version1
+// destinations with V1Translator. Informs are forwarded as SNMPv2-Traps,
+// since the listener has already acknowledged them.
+type TrapForwarder struct {
+	// Destinations are the sessions the traps are re-emitted on.
+	Destinations []*GoSNMP
+
+	// V1Translator converts SNMPv2 notifications for Version1 destinations.
+	V1Translator V1TrapTranslator
+
+	// KeepCommunity sends v1 and v2c traps with the community they were
+	// received with instead of the destination's Community.
+	KeepCommunity bool
+
+	// OnError, if set, is called by Handler for each failed forward.
+	OnError func(destination *GoSNMP, err error)
+
+	mu sync.Mutex
+}
+
+// TrapForwardError is returned by Forward when traps could not be sent to
+// some of the destinations.
+type TrapForwardError struct {
+	// Errors holds the error of each failed destination by its index.
+	Errors map[int]error
+}
+
+func (e *TrapForwardError) Error() string {
+	first := -1
+	for i := range e.Errors {
+		if first < 0 || i < first {
+			first = i
+		}
+	}
+	return fmt.Sprintf("forwarding to %d destinations failed, destination %d: %s", len(e.Errors), first, e.Errors[first])
+}
+
+// Indexes returns the indexes of the failed destinations in ascending order.
+func (e *TrapForwardError) Indexes() []int {
+	out := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		out = append(out, i)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// Handler returns a TrapHandlerFunc forwarding every trap received, to be
+// used as the OnNewTrap of a TrapListener.
+func (f *TrapForwarder) Handler() TrapHandlerFunc {
+	return func(packet *SnmpPacket, source *net.UDPAddr) {
+		err := f.Forward(packet, source)
+		ferr, ok := err.(*TrapForwardError)
+		if !ok || f.OnError == nil {
+			return
+		}
+		for _, i := range ferr.Indexes() {
+			f.OnError(f.Destinations[i], ferr.Errors[i])
+		}
+	}
+}
+
+// Forward sends the notification in packet, received from source, to every
+// destination. Destinations are tried in order, a failure does not stop the
+// others.
+func (f *TrapForwarder) Forward(packet *SnmpPacket, source *net.UDPAddr) error {
+	if packet == nil || !isNotification(packet.PDUType) {
+		return fmt.Errorf("forwarding requires a notification")
+	}
+	// Handlers of TCP connections run concurrently and a destination
+	// session sends one request at a time.
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	failed := &TrapForwardError{Errors: make(map[int]error)}
+	for i, dst := range f.Destinations {
+		if err := f.forward(dst, packet, source); err != nil {
+			failed.Errors[i] = err
+		}
+	}
+	if len(failed.Errors) > 0 {
+		return failed
+	}
+	return nil
+}
+
+func (f *TrapForwarder) forward(dst *GoSNMP, packet *SnmpPacket, source *net.UDPAddr) error {
+	var opts []RequestOption
+	if f.KeepCommunity && packet.Version != Version3 && dst.Version != Version3 {
+		opts = append(opts, WithCommunity(packet.Community))
+	}
+
+	if dst.Version == Version1 {
+		trap := SnmpTrap{
+			Variables:    packet.Variables,
+			Enterprise:   packet.Enterprise,
+			AgentAddress: packet.AgentAddress,
+			GenericTrap:  packet.GenericTrap,
+			SpecificTrap: packet.SpecificTrap,
+			Timestamp:    packet.Timestamp,
+		}
+		if packet.PDUType != Trap {
+			var err error
+			if trap, err = f.V1Translator.Translate(packet, source); err != nil {
+				return err
+			}
+		}
+		_, err := dst.sendV1Trap(callOptions(dst.requestOpts, opts), trap)
+		return err
+	}
+
+	trap := SnmpTrap{Variables: packet.Variables}
+	if packet.PDUType == Trap {
+		var err error
+		if trap, err = TranslateV1Trap(packet); err != nil {
+			return err
+		}
+	}
+	_, err := dst.sendTrap(callOptions(dst.requestOpts, opts), trap)
+	return err
+}
@@ -0,0 +1,144 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || trap
+// +build all trap
+
+package gosnmp
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// forwardDestination returns a session of version to a UDP socket and a
+// function reading the next trap it receives.
+func forwardDestination(t *testing.T, version SnmpVersion) (*GoSNMP, func() *SnmpPacket) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { srvr.Close() })
+
+	x := &GoSNMP{
+		Target:    trapTestAddress,
+		Port:      uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Version:   version,
+		Community: "upstream",
+		Timeout:   time.Second,
+		MaxOids:   MaxOids,
+		Logger:    NewLogger(nil),
+	}
+	require.NoError(t, x.Connect())
+	t.Cleanup(func() { x.Conn.Close() })
+
+	decoder := &GoSNMP{Version: version, Logger: NewLogger(nil)}
+	return x, func() *SnmpPacket {
+		buf := make([]byte, rxBufSize)
+		require.NoError(t, srvr.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := srvr.ReadFromUDP(buf)
+		require.NoError(t, err)
+		packet := decoder.UnmarshalTrap(buf[:n], false)
+		require.NotNil(t, packet)
+		return packet
+	}
+}
+
+func TestTrapForwarder(t *testing.T) {
+	v2, recvV2 := forwardDestination(t, Version2c)
+	v1, recvV1 := forwardDestination(t, Version1)
+	f := &TrapForwarder{
+		Destinations: []*GoSNMP{v2, v1},
+		V1Translator: V1TrapTranslator{AgentAddrPolicy: AgentAddrOriginalSource},
+	}
+	source := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 7), Port: 162}
+
+	// an SNMPv1 linkDown is translated for the v2c manager
+	v1Trap := &SnmpPacket{
+		Version:   Version1,
+		Community: "device",
+		PDUType:   Trap,
+		Variables: []SnmpPDU{{Name: ".1.3.6.1.2.1.2.2.1.1.3", Type: Integer, Value: 3}},
+		SnmpTrap: SnmpTrap{
+			Enterprise:   ".1.3.6.1.4.1.9",
+			AgentAddress: "192.0.2.7",
+			GenericTrap:  2,
+			Timestamp:    300,
+		},
+	}
+	require.NoError(t, f.Forward(v1Trap, source))
+
+	got := recvV2()
+	assert.Equal(t, SNMPv2Trap, got.PDUType)
+	assert.Equal(t, "upstream", got.Community)
+	require.Len(t, got.Variables, 5)
+	assert.Equal(t, uint32(300), got.Variables[0].Value)
+	assert.Equal(t, ".1.3.6.1.6.3.1.1.5.3", got.Variables[1].Value)
+	assert.Equal(t, 3, got.Variables[2].Value)
+	assert.Equal(t, snmpTrapAddressOID, got.Variables[3].Name)
+	assert.Equal(t, "192.0.2.7", got.Variables[3].Value)
+	assert.Equal(t, ".1.3.6.1.4.1.9", got.Variables[4].Value)
+
+	got = recvV1()
+	assert.Equal(t, Trap, got.PDUType)
+	assert.Equal(t, ".1.3.6.1.4.1.9", got.Enterprise)
+	assert.Equal(t, 2, got.GenericTrap)
+	assert.Equal(t, uint(300), got.Timestamp)
+
+	// an SNMPv2 notification is translated for the v1 manager, keeping the
+	// community it was received with
+	f.KeepCommunity = true
+	v2Trap := v2Notification(".1.3.6.1.4.1.9.0.5", SnmpPDU{Name: ".1.3.6.1.4.1.9.1", Type: OctetString, Value: "fan"})
+	v2Trap.Community = "device"
+	require.NoError(t, f.Forward(v2Trap, source))
+
+	got = recvV2()
+	assert.Equal(t, "device", got.Community)
+	require.Len(t, got.Variables, 3)
+	assert.Equal(t, ".1.3.6.1.4.1.9.0.5", got.Variables[1].Value)
+
+	got = recvV1()
+	assert.Equal(t, "device", got.Community)
+	assert.Equal(t, ".1.3.6.1.4.1.9", got.Enterprise)
+	assert.Equal(t, 6, got.GenericTrap)
+	assert.Equal(t, 5, got.SpecificTrap)
+	assert.Equal(t, "192.0.2.7", got.AgentAddress)
+	require.Len(t, got.Variables, 1)
+	assert.Equal(t, []byte("fan"), got.Variables[0].Value)
+
+	// the destination's own community is back for later calls
+	assert.Equal(t, "upstream", v2.community(v2.requestOpts))
+}
+
+func TestTrapForwarderErrors(t *testing.T) {
+	v2, recvV2 := forwardDestination(t, Version2c)
+	v1, _ := forwardDestination(t, Version1)
+	var failed []*GoSNMP
+	f := &TrapForwarder{
+		Destinations: []*GoSNMP{v1, v2},
+		OnError:      func(dst *GoSNMP, err error) { failed = append(failed, dst) },
+	}
+
+	// without snmpTrapOID.0 the notification cannot be translated for v1,
+	// but it still reaches the v2c manager
+	packet := &SnmpPacket{
+		Version:   Version2c,
+		PDUType:   SNMPv2Trap,
+		Variables: []SnmpPDU{{Name: ".1.3.6.1.4.1.9.1", Type: Integer, Value: 1}},
+	}
+	err := f.Forward(packet, nil)
+	var ferr *TrapForwardError
+	require.True(t, errors.As(err, &ferr))
+	assert.Equal(t, []int{0}, ferr.Indexes())
+	recvV2()
+
+	f.Handler()(packet, nil)
+	assert.Equal(t, []*GoSNMP{v1}, failed)
+	recvV2()
+
+	assert.Error(t, f.Forward(&SnmpPacket{PDUType: GetRequest}, nil))
+}
@@ -0,0 +1,50 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"fmt"
+	"net"
+)
+
+// joinGroup makes conn a member of the multicast group on ifi, or on the
+// interface chosen by the system if ifi is nil.
+func joinGroup(conn *net.UDPConn, ifi *net.Interface, group net.IP) error {
+	if !group.IsMulticast() {
+		return fmt.Errorf("%s is not a multicast address", group)
+	}
+	if ip4 := group.To4(); ip4 != nil {
+		var local net.IP
+		if ifi != nil {
+			var err error
+			if local, err = interfaceIPv4(ifi); err != nil {
+				return err
+			}
+		}
+		return joinIPv4Group(conn, local, ip4)
+	}
+	index := 0
+	if ifi != nil {
+		index = ifi.Index
+	}
+	return joinIPv6Group(conn, index, group)
+}
+
+// interfaceIPv4 returns the first IPv4 address of ifi, which identifies the
+// interface of IPv4 multicast memberships.
+func interfaceIPv4(ifi *net.Interface) (net.IP, error) {
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok {
+			if ip4 := ipnet.IP.To4(); ip4 != nil {
+				return ip4, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no IPv4 address", ifi.Name)
+}
@@ -0,0 +1,23 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package gosnmp
+
+import (
+	"errors"
+	"net"
+)
+
+var errMulticastUnsupported = errors.New("multicast groups are not supported on this platform")
+
+func joinIPv4Group(conn *net.UDPConn, local, group net.IP) error {
+	return errMulticastUnsupported
+}
+
+func joinIPv6Group(conn *net.UDPConn, index int, group net.IP) error {
+	return errMulticastUnsupported
+}
@@ -0,0 +1,46 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gosnmp
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+func joinIPv4Group(conn *net.UDPConn, local, group net.IP) error {
+	mreq := &syscall.IPMreq{}
+	copy(mreq.Multiaddr[:], group)
+	copy(mreq.Interface[:], local)
+	return setsockopt(conn, func(fd int) error {
+		return syscall.SetsockoptIPMreq(fd, syscall.IPPROTO_IP, syscall.IP_ADD_MEMBERSHIP, mreq)
+	})
+}
+
+func joinIPv6Group(conn *net.UDPConn, index int, group net.IP) error {
+	mreq := &syscall.IPv6Mreq{Interface: uint32(index)}
+	copy(mreq.Multiaddr[:], group.To16())
+	return setsockopt(conn, func(fd int) error {
+		return syscall.SetsockoptIPv6Mreq(fd, syscall.IPPROTO_IPV6, syscall.IPV6_JOIN_GROUP, mreq)
+	})
+}
+
+// setsockopt calls set with the socket of conn.
+func setsockopt(conn *net.UDPConn, set func(fd int) error) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err = raw.Control(func(fd uintptr) {
+		serr = set(int(fd))
+	}); err != nil {
+		return err
+	}
+	return os.NewSyscallError("setsockopt", serr)
+}
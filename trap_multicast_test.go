@@ -0,0 +1,151 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || trap
+// +build all trap
+
+package gosnmp
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listenTraps starts tl on addr and returns the sources of the traps it
+// receives.
+func listenTraps(t *testing.T, tl *TrapListener, addr string) (<-chan *net.UDPAddr, int) {
+	sources := make(chan *net.UDPAddr, 1)
+	tl.OnNewTrap = func(s *SnmpPacket, u *net.UDPAddr) {
+		sources <- u
+	}
+	tl.Params = &GoSNMP{Version: Version2c, Logger: NewLogger(log.New(ioutil.Discard, "", 0))}
+	errch := make(chan error, 1)
+	go func() {
+		errch <- tl.Listen(addr)
+	}()
+	select {
+	case <-tl.Listening():
+	case err := <-errch:
+		t.Fatalf("error in listen: %v", err)
+	}
+	t.Cleanup(tl.Close)
+	tl.Lock()
+	defer tl.Unlock()
+	return sources, tl.conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func sendTestTrap(t *testing.T, target string, port int) {
+	ts := &GoSNMP{
+		Target:    target,
+		Port:      uint16(port),
+		Community: "public",
+		Version:   Version2c,
+		Timeout:   time.Second,
+		MaxOids:   MaxOids,
+	}
+	require.NoError(t, ts.Connect())
+	defer ts.Conn.Close()
+	_, err := ts.SendTrap(SnmpTrap{TrapOID: ".1.3.6.1.6.3.1.1.5.1"})
+	require.NoError(t, err)
+}
+
+func receiveSource(t *testing.T, sources <-chan *net.UDPAddr) *net.UDPAddr {
+	select {
+	case u := <-sources:
+		return u
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for trap")
+	}
+	return nil
+}
+
+// multicastInterface returns an interface that is up and multicast capable
+// with an IPv6 link-local address, or nil.
+func multicastInterface() (*net.Interface, net.IP) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, nil
+	}
+	for i := range ifaces {
+		ifi := &ifaces[i]
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagMulticast == 0 || ifi.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, _ := ifi.Addrs()
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.IsLinkLocalUnicast() && ipnet.IP.To4() == nil {
+				return ifi, ipnet.IP
+			}
+		}
+	}
+	return nil, nil
+}
+
+func TestTrapListenerIPv6(t *testing.T) {
+	sources, port := listenTraps(t, NewTrapListener(), "udp6://[::1]:0")
+	sendTestTrap(t, "::1", port)
+	assert.Equal(t, "::1", receiveSource(t, sources).IP.String())
+
+	// and over TCP
+	tl := NewTrapListener()
+	tl.TCP = true
+	sources, port = listenTraps(t, tl, "udp6://[::1]:0")
+	ts := &GoSNMP{Target: "::1", Port: uint16(port), Transport: tcp, Community: "public", Version: Version2c, Timeout: time.Second, MaxOids: MaxOids}
+	require.NoError(t, ts.Connect())
+	defer ts.Conn.Close()
+	_, err := ts.SendTrap(SnmpTrap{TrapOID: ".1.3.6.1.6.3.1.1.5.1"})
+	require.NoError(t, err)
+	assert.Equal(t, "::1", receiveSource(t, sources).IP.String())
+
+	ifi, linkLocal := multicastInterface()
+	if ifi == nil {
+		t.Skip("no interface with an IPv6 link-local address")
+	}
+	// the zone of link-local addresses is kept
+	sources, port = listenTraps(t, NewTrapListener(), "udp6://[::%"+ifi.Name+"]:0")
+	sendTestTrap(t, linkLocal.String()+"%"+ifi.Name, port)
+	source := receiveSource(t, sources)
+	assert.Equal(t, linkLocal.String(), source.IP.String())
+	assert.Equal(t, ifi.Name, source.Zone)
+}
+
+func TestTrapListenerMulticast(t *testing.T) {
+	ifi, linkLocal := multicastInterface()
+	if ifi == nil {
+		t.Skip("no multicast capable interface")
+	}
+	tl := NewTrapListener()
+	tl.MulticastGroups = []net.IP{net.ParseIP("ff02::1:162")}
+	tl.MulticastInterface = ifi
+	sources, port := listenTraps(t, tl, "udp6://[::]:0")
+	sendTestTrap(t, "ff02::1:162%"+ifi.Name, port)
+	source := receiveSource(t, sources)
+	assert.Equal(t, linkLocal.String(), source.IP.String())
+	assert.Equal(t, ifi.Name, source.Zone)
+}
+
+func TestTrapListenerMulticastJoinFailure(t *testing.T) {
+	tl := NewTrapListener()
+	tl.MulticastGroups = []net.IP{net.ParseIP("192.0.2.1")}
+	tl.Params = &GoSNMP{Version: Version2c, Logger: NewLogger(log.New(ioutil.Discard, "", 0))}
+	assert.Error(t, tl.Listen("udp4://0.0.0.0:0"))
+
+	// Close does not wait for a listener that never started
+	closed := make(chan struct{})
+	go func() {
+		tl.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close blocked after joining a group failed")
+	}
+}
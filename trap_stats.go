@@ -0,0 +1,77 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// TrapStats are the counters of a TrapListener, see Stats. They only grow,
+// so that collectors can monitor the listener by their rates.
+type TrapStats struct {
+	// Received counts the messages read from the sockets, including those
+	// dropped later.
+	Received uint64
+
+	// ParseErrors counts the messages that could not be decoded.
+	ParseErrors uint64
+
+	// AuthFailures counts the SNMPv3 messages that failed authentication,
+	// timeliness or decryption.
+	AuthFailures uint64
+
+	// V1, V2c and V3 count the decoded messages by SNMP version.
+	V1  uint64
+	V2c uint64
+	V3  uint64
+
+	Dropped TrapDrops
+}
+
+// Stats returns the counters of the listener. It is safe to call while the
+// listener runs.
+func (t *TrapListener) Stats() TrapStats {
+	return TrapStats{
+		Received:     atomic.LoadUint64(&t.received),
+		ParseErrors:  atomic.LoadUint64(&t.parseErrors),
+		AuthFailures: atomic.LoadUint64(&t.authFailures),
+		V1:           atomic.LoadUint64(&t.v1Traps),
+		V2c:          atomic.LoadUint64(&t.v2cTraps),
+		V3:           atomic.LoadUint64(&t.v3Traps),
+		Dropped:      t.Dropped(),
+	}
+}
+
+// decode decodes a message received from addr, counting it, and returns the
+// notification it holds or nil.
+func (t *TrapListener) decode(msg []byte, addr net.Addr) *SnmpPacket {
+	if t.Params.AfterReceive != nil {
+		msg = t.Params.AfterReceive(nil, msg)
+	}
+	traps, authFailure := t.Params.unmarshalTrap(msg, false)
+	switch {
+	case authFailure:
+		atomic.AddUint64(&t.authFailures, 1)
+		return nil
+	case traps == nil:
+		atomic.AddUint64(&t.parseErrors, 1)
+		return nil
+	}
+	switch traps.Version {
+	case Version1:
+		atomic.AddUint64(&t.v1Traps, 1)
+	case Version2c:
+		atomic.AddUint64(&t.v2cTraps, 1)
+	case Version3:
+		atomic.AddUint64(&t.v3Traps, 1)
+	}
+	if !isNotification(traps.PDUType) {
+		t.Params.Logger.Printf("TrapListener: dropped PDU type 0x%x from %s\n", byte(traps.PDUType), addr)
+		atomic.AddUint64(&t.notNotifications, 1)
+		return nil
+	}
+	return traps
+}
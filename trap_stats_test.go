@@ -0,0 +1,94 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || trap
+// +build all trap
+
+package gosnmp
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrapListenerStats(t *testing.T) {
+	usm := func(passphrase string) *UsmSecurityParameters {
+		return &UsmSecurityParameters{
+			UserName:                 "test",
+			AuthenticationProtocol:   SHA,
+			AuthenticationPassphrase: passphrase,
+			AuthoritativeEngineBoots: 1,
+			AuthoritativeEngineTime:  1,
+			AuthoritativeEngineID:    string([]byte{0x80, 0x00, 0x00, 0x00, 0x01, 0x02, 0x03, 0x04}),
+		}
+	}
+	logger := NewLogger(log.New(ioutil.Discard, "", 0))
+
+	var handled int32
+	tl := NewTrapListener()
+	tl.OnNewTrap = func(s *SnmpPacket, u *net.UDPAddr) {
+		atomic.AddInt32(&handled, 1)
+	}
+	tl.Params = &GoSNMP{
+		Version:            Version3,
+		SecurityModel:      UserSecurityModel,
+		MsgFlags:           AuthNoPriv,
+		SecurityParameters: usm("password"),
+		Logger:             logger,
+	}
+	ts := startTrapListener(t, tl)
+
+	trap := SnmpTrap{Variables: []SnmpPDU{{Name: trapTestOid, Type: OctetString, Value: trapTestPayload}}}
+	_, err := ts.SendTrap(trap)
+	require.NoError(t, err)
+	ts.Version = Version1
+	_, err = ts.SendV1Trap(SnmpTrap{Variables: trap.Variables, Enterprise: ".1.3.6.1.4.1.8072", AgentAddress: "127.0.0.1"})
+	require.NoError(t, err)
+	_, err = ts.Conn.Write([]byte{0x30, 0x03, 0x02, 0x01})
+	require.NoError(t, err)
+	ts.Version = Version2c
+	get, err := ts.mkSnmpPacket(GetRequest, trap.Variables, 0, 0).marshalMsg()
+	require.NoError(t, err)
+	_, err = ts.Conn.Write(get)
+	require.NoError(t, err)
+
+	v3 := func(passphrase string) {
+		sender := &GoSNMP{
+			Target:             ts.Target,
+			Port:               ts.Port,
+			Version:            Version3,
+			Timeout:            time.Second,
+			MaxOids:            MaxOids,
+			SecurityModel:      UserSecurityModel,
+			MsgFlags:           AuthNoPriv,
+			SecurityParameters: usm(passphrase),
+			Logger:             logger,
+		}
+		require.NoError(t, sender.Connect())
+		defer sender.Conn.Close()
+		_, err := sender.SendTrap(trap)
+		require.NoError(t, err)
+	}
+	v3("password")
+	v3("wrongpassword")
+
+	want := TrapStats{
+		Received:     6,
+		ParseErrors:  1,
+		AuthFailures: 1,
+		V1:           1,
+		V2c:          2,
+		V3:           1,
+		Dropped:      TrapDrops{NotNotification: 1},
+	}
+	assert.Eventually(t, func() bool { return tl.Stats() == want }, time.Second, time.Millisecond, "%+v", tl.Stats())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&handled))
+}
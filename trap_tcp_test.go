@@ -0,0 +1,111 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || trap
+// +build all trap
+
+package gosnmp
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrapListenerTCP(t *testing.T) {
+	var handled, informs int32
+	tl := NewTrapListener()
+	tl.TCP = true
+	tl.OnNewTrap = func(s *SnmpPacket, u *net.UDPAddr) {
+		atomic.AddInt32(&handled, 1)
+		if s.PDUType == InformRequest {
+			atomic.AddInt32(&informs, 1)
+		}
+	}
+	udpSender := startTrapListener(t, tl)
+
+	trap := SnmpTrap{Variables: []SnmpPDU{{Name: trapTestOid, Type: OctetString, Value: trapTestPayload}}}
+	_, err := udpSender.SendTrap(trap)
+	require.NoError(t, err)
+
+	ts := &GoSNMP{
+		Target:    trapTestAddress,
+		Port:      udpSender.Port,
+		Transport: tcp,
+		Community: "public",
+		Version:   Version2c,
+		Timeout:   time.Second,
+		MaxOids:   MaxOids,
+		Logger:    NewLogger(log.New(ioutil.Discard, "", 0)),
+	}
+	require.NoError(t, ts.Connect())
+	defer ts.Conn.Close()
+
+	// several messages share the connection, informs are acknowledged on it
+	for i := 0; i < 3; i++ {
+		_, err = ts.SendTrap(trap)
+		require.NoError(t, err)
+	}
+	resp, err := ts.SendInform(trap)
+	require.NoError(t, err)
+	assert.Equal(t, GetResponse, resp.PDUType)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&handled) == 5 }, time.Second, time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&informs))
+
+	// messages split and merged across segments are framed by their length
+	msg, err := ts.mkSnmpPacket(SNMPv2Trap, trap.Variables, 0, 0).marshalMsg()
+	require.NoError(t, err)
+	raw, err := net.Dial(tcp, ts.capabilityAddress())
+	require.NoError(t, err)
+	defer raw.Close()
+	stream := append(append([]byte{}, msg...), msg...)
+	_, err = raw.Write(stream[:5])
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	_, err = raw.Write(stream[5:])
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&handled) == 7 }, time.Second, time.Millisecond)
+
+	// Close ends the open connections
+	closed := make(chan struct{})
+	go func() {
+		tl.Close()
+		tl.Wait()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not end the TCP connections")
+	}
+}
+
+func TestTrapListenerTCPPortTaken(t *testing.T) {
+	taken, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer taken.Close()
+
+	tl := NewTrapListener()
+	tl.TCP = true
+	tl.Params = &GoSNMP{Version: Version2c, Logger: NewLogger(log.New(ioutil.Discard, "", 0))}
+	assert.Error(t, tl.Listen("udp4://"+taken.Addr().String()))
+
+	// Close does not wait for a listener that never started
+	closed := make(chan struct{})
+	go func() {
+		tl.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close blocked after Listen failed")
+	}
+}
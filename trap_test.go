@@ -8,10 +8,12 @@
 package gosnmp
 
 import (
+	"context"
 	"io/ioutil"
 	"log"
 	"net"
 	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -223,6 +225,81 @@ func TestSendTrapBasic(t *testing.T) {
 	}
 }
 
+// test that the listener drops requests and receives traps larger than a
+// small read buffer, with the address of the sender
+func TestTrapListenerV2cDispatch(t *testing.T) {
+	received := make(chan *SnmpPacket, 4)
+	var from *net.UDPAddr
+
+	tl := NewTrapListener()
+	defer tl.Close()
+	tl.OnNewTrap = func(s *SnmpPacket, u *net.UDPAddr) {
+		from = u
+		received <- s
+	}
+	tl.Params = Default
+
+	errch := make(chan error)
+	go func() {
+		err := tl.Listen(net.JoinHostPort(trapTestAddress, trapTestPortString))
+		if err != nil {
+			errch <- err
+		}
+	}()
+	select {
+	case <-tl.Listening():
+	case err := <-errch:
+		t.Fatalf("error in listen: %v", err)
+	}
+	ts := &GoSNMP{
+		Target:    trapTestAddress,
+		Port:      trapTestPort,
+		Community: "public",
+		Version:   Version2c,
+		Timeout:   100 * time.Millisecond,
+		MaxOids:   MaxOids,
+		Logger:    NewLogger(log.New(ioutil.Discard, "", 0)),
+	}
+	if err := ts.Connect(); err != nil {
+		t.Fatalf("Connect() err: %v", err)
+	}
+	defer ts.Conn.Close()
+
+	// a request sent to the trap port is not a trap
+	if _, err := ts.Get([]string{trapTestOid}); err == nil {
+		t.Fatal("Get() to the trap port got a response")
+	}
+
+	var vars []SnmpPDU
+	for i := 0; i < 200; i++ {
+		vars = append(vars, SnmpPDU{Name: trapTestOid, Type: OctetString, Value: trapTestPayload})
+	}
+	if _, err := ts.SendTrap(SnmpTrap{Variables: vars}); err != nil {
+		t.Fatalf("SendTrap() err: %v", err)
+	}
+
+	select {
+	case s := <-received:
+		if s.PDUType != SNMPv2Trap {
+			t.Fatalf("got PDU type 0x%x, want SNMPv2Trap", byte(s.PDUType))
+		}
+		// sysUpTime is prepended to the variables
+		if len(s.Variables) != len(vars)+1 {
+			t.Fatalf("got %d variables, want %d", len(s.Variables), len(vars)+1)
+		}
+		if from == nil || !from.IP.Equal(net.ParseIP(trapTestAddress)) {
+			t.Fatalf("got trap from %v", from)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for trap to be received")
+	}
+	select {
+	case s := <-received:
+		t.Fatalf("unexpected PDU type 0x%x", byte(s.PDUType))
+	default:
+	}
+}
+
 // test sending a basic SNMP inform and receiving the response
 func TestSendInformBasic(t *testing.T) {
 	done := make(chan int)
@@ -452,6 +529,213 @@ func TestSendV1Trap(t *testing.T) {
 	}
 }
 
+// informAgent acknowledges the informs it receives after dropping the
+// first drop ones, with status, and records when they arrived.
+func informAgent(t *testing.T, srvr *net.UDPConn, drop int, status SNMPError, arrivals chan<- time.Time) {
+	decoder := &GoSNMP{Version: Version2c, Logger: NewLogger(log.New(ioutil.Discard, "", 0))}
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := srvr.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		arrivals <- time.Now()
+		req, err := decoder.SnmpDecodePacket(buf[:n])
+		if err != nil {
+			t.Errorf("agent decode: %s", err)
+			return
+		}
+		if drop > 0 {
+			drop--
+			continue
+		}
+		resp, err := req.ErrorResponse(status, 0)
+		if err != nil {
+			t.Errorf("agent response: %s", err)
+			return
+		}
+		out, err := resp.MarshalMsg()
+		if err != nil {
+			t.Errorf("agent marshal: %s", err)
+			return
+		}
+		if _, err = srvr.WriteTo(out, addr); err != nil {
+			return
+		}
+	}
+}
+
+func TestSendInformRetries(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srvr.Close()
+	arrivals := make(chan time.Time, 10)
+	go informAgent(t, srvr, 2, NoError, arrivals)
+
+	ts := &GoSNMP{
+		Target:    trapTestAddress,
+		Port:      uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Community: "public",
+		Version:   Version2c,
+		Timeout:   50 * time.Millisecond,
+		Retries:   3,
+		Logger:    NewLogger(log.New(ioutil.Discard, "", 0)),
+	}
+	if err = ts.Connect(); err != nil {
+		t.Fatalf("Connect() err: %v", err)
+	}
+	defer ts.Conn.Close()
+
+	inform := SnmpTrap{Variables: []SnmpPDU{{Name: trapTestOid, Type: OctetString, Value: trapTestPayload}}}
+	result, err := ts.SendInform(inform)
+	if err != nil {
+		t.Fatalf("SendInform() err: %v", err)
+	}
+	if result.PDUType != GetResponse || len(result.Variables) != 2 {
+		t.Fatalf("got response %+v", result)
+	}
+	var times []time.Time
+	for len(arrivals) > 0 {
+		times = append(times, <-arrivals)
+	}
+	if len(times) != 3 {
+		t.Fatalf("got %d transmissions, want 3", len(times))
+	}
+	// the second retransmission waited twice as long as the first
+	if first, second := times[1].Sub(times[0]), times[2].Sub(times[1]); second < first*3/2 {
+		t.Fatalf("retransmissions after %s and %s, want backoff", first, second)
+	}
+
+	// an inform that is never acknowledged times out
+	ts.Retries = 1
+	srvr2, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srvr2.Close()
+	go informAgent(t, srvr2, 10, NoError, make(chan time.Time, 10))
+	ts2 := *ts
+	ts2.Port = uint16(srvr2.LocalAddr().(*net.UDPAddr).Port)
+	if err = ts2.Connect(); err != nil {
+		t.Fatalf("Connect() err: %v", err)
+	}
+	defer ts2.Conn.Close()
+	if _, err = ts2.SendInform(inform); err == nil {
+		t.Fatal("SendInform() to an agent not acknowledging succeeded")
+	}
+
+	ts.Version = Version1
+	if _, err = ts.SendInform(inform); err == nil {
+		t.Fatal("SendInform() accepted a SNMPv1 session")
+	}
+}
+
+func TestSendInformRejected(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srvr.Close()
+	go informAgent(t, srvr, 0, ResourceUnavailable, make(chan time.Time, 10))
+
+	ts := &GoSNMP{
+		Target:    trapTestAddress,
+		Port:      uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Community: "public",
+		Version:   Version2c,
+		Timeout:   time.Second,
+		Logger:    NewLogger(log.New(ioutil.Discard, "", 0)),
+	}
+	if err = ts.Connect(); err != nil {
+		t.Fatalf("Connect() err: %v", err)
+	}
+	defer ts.Conn.Close()
+
+	result, err := ts.SendInform(SnmpTrap{Variables: []SnmpPDU{{Name: trapTestOid, Type: OctetString, Value: trapTestPayload}}})
+	if err == nil || result == nil || result.Error != ResourceUnavailable {
+		t.Fatalf("SendInform() = %+v, %v", result, err)
+	}
+}
+
+// test sending a v1 coldStart trap without variables with SendV1Trap
+func TestSendV1TrapHelper(t *testing.T) {
+	received := make(chan *SnmpPacket, 1)
+
+	tl := NewTrapListener()
+	defer tl.Close()
+	tl.OnNewTrap = func(s *SnmpPacket, u *net.UDPAddr) { received <- s }
+	tl.Params = Default
+
+	errch := make(chan error)
+	go func() {
+		err := tl.Listen(net.JoinHostPort(trapTestAddress, trapTestPortString))
+		if err != nil {
+			errch <- err
+		}
+	}()
+	select {
+	case <-tl.Listening():
+	case err := <-errch:
+		t.Fatalf("error in listen: %v", err)
+	}
+
+	ts := &GoSNMP{
+		Target:    trapTestAddress,
+		Port:      trapTestPort,
+		Community: "public",
+		Version:   Version1,
+		Timeout:   time.Duration(2) * time.Second,
+		MaxOids:   MaxOids,
+	}
+	if err := ts.Connect(); err != nil {
+		t.Fatalf("Connect() err: %v", err)
+	}
+	defer ts.Conn.Close()
+
+	invalid := []SnmpTrap{
+		{AgentAddress: trapTestAgentAddress},
+		{Enterprise: "1.3.x", AgentAddress: trapTestAgentAddress},
+		{Enterprise: trapTestEnterpriseOid},
+		{Enterprise: trapTestEnterpriseOid, AgentAddress: "2001:db8::1"},
+		{Enterprise: trapTestEnterpriseOid, AgentAddress: trapTestAgentAddress, GenericTrap: 7},
+		{Enterprise: trapTestEnterpriseOid, AgentAddress: trapTestAgentAddress, SpecificTrap: -1},
+	}
+	for i, trap := range invalid {
+		if _, err := ts.SendV1Trap(trap); err == nil {
+			t.Errorf("#%d: SendV1Trap() accepted %+v", i, trap)
+		}
+	}
+
+	_, err := ts.SendV1Trap(SnmpTrap{
+		Enterprise:   trapTestEnterpriseOid,
+		AgentAddress: trapTestAgentAddress,
+		Timestamp:    trapTestTimestamp,
+	})
+	if err != nil {
+		t.Fatalf("SendV1Trap() err: %v", err)
+	}
+
+	select {
+	case s := <-received:
+		if s.PDUType != Trap || s.Enterprise != trapTestEnterpriseOid || s.AgentAddress != trapTestAgentAddress ||
+			s.GenericTrap != 0 || s.SpecificTrap != 0 || s.Timestamp != trapTestTimestamp {
+			t.Fatalf("got trap %+v", s.SnmpTrap)
+		}
+		if len(s.Variables) != 0 {
+			t.Fatalf("got %d variables, want none", len(s.Variables))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for trap to be received")
+	}
+
+	ts.Version = Version2c
+	if _, err = ts.SendV1Trap(SnmpTrap{Enterprise: trapTestEnterpriseOid, AgentAddress: trapTestAgentAddress}); err == nil {
+		t.Fatal("SendV1Trap() accepted a SNMPv2c session")
+	}
+}
+
 func TestSendV3TrapNoAuthNoPriv(t *testing.T) {
 	done := make(chan int)
 
@@ -1230,3 +1514,87 @@ func TestSendV3TrapSHAAuthAES256CPriv(t *testing.T) {
 	}
 
 }
+
+// test that ListenContext drains the handler in flight when its context is
+// cancelled, for UDP and TCP
+func TestTrapListenerContextShutdown(t *testing.T) {
+	for _, transport := range []string{udp, tcp} {
+		t.Run(transport, func(t *testing.T) {
+			entered := make(chan struct{})
+			release := make(chan struct{})
+			var handled int32
+
+			tl := NewTrapListener()
+			tl.Params = &GoSNMP{Version: Version2c, Logger: NewLogger(log.New(ioutil.Discard, "", 0))}
+			tl.OnNewTrap = func(s *SnmpPacket, u *net.UDPAddr) {
+				close(entered)
+				<-release
+				atomic.StoreInt32(&handled, 1)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			errch := make(chan error, 1)
+			go func() {
+				errch <- tl.ListenContext(ctx, transport+"://"+net.JoinHostPort(trapTestAddress, trapTestPortString))
+			}()
+			select {
+			case <-tl.Listening():
+			case err := <-errch:
+				t.Fatalf("error in listen: %v", err)
+			}
+
+			ts := &GoSNMP{
+				Target:    trapTestAddress,
+				Port:      trapTestPort,
+				Transport: transport,
+				Community: "public",
+				Version:   Version2c,
+				Timeout:   time.Second,
+				MaxOids:   MaxOids,
+				Logger:    NewLogger(log.New(ioutil.Discard, "", 0)),
+			}
+			if err := ts.Connect(); err != nil {
+				t.Fatalf("Connect() err: %v", err)
+			}
+			defer ts.Conn.Close()
+			if _, err := ts.SendTrap(SnmpTrap{Variables: []SnmpPDU{{Name: trapTestOid, Type: OctetString, Value: trapTestPayload}}}); err != nil {
+				t.Fatalf("SendTrap() err: %v", err)
+			}
+			select {
+			case <-entered:
+			case <-time.After(2 * time.Second):
+				t.Fatal("timed out waiting for trap to be received")
+			}
+
+			cancel()
+			select {
+			case err := <-errch:
+				t.Fatalf("ListenContext returned with a handler in flight: %v", err)
+			case <-time.After(50 * time.Millisecond):
+			}
+			close(release)
+			select {
+			case err := <-errch:
+				if err != context.Canceled {
+					t.Fatalf("ListenContext() = %v, want context.Canceled", err)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("ListenContext did not return")
+			}
+			if atomic.LoadInt32(&handled) != 1 {
+				t.Fatal("handler did not complete")
+			}
+			tl.Wait()
+
+			// the socket is closed
+			if transport == tcp {
+				l, err := net.Listen(tcp, net.JoinHostPort(trapTestAddress, trapTestPortString))
+				if err != nil {
+					t.Fatalf("port still in use: %v", err)
+				}
+				l.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/gosnmp/gosnmp/oids"
+)
+
+// Notification OIDs used when translating between SNMPv2 notifications and
+// SNMPv1 Trap-PDUs, see RFC 3584 section 3.
+const (
+	sysUpTimeOID          = oids.SysUpTime
+	snmpTrapOIDOID        = oids.SnmpTrapOID
+	snmpTrapEnterpriseOID = oids.SnmpTrapEnterprise
+	snmpTrapAddressOID    = oids.SnmpTrapAddress
+	snmpTrapsOID          = oids.SnmpTraps
+)
+
+// AgentAddrPolicy selects the agent-addr of an SNMPv1 Trap-PDU produced by
+// translating an SNMPv2 notification.
+type AgentAddrPolicy int
+
+const (
+	// AgentAddrTrapAddress uses the snmpTrapAddress.0 variable of the
+	// notification, or 0.0.0.0 when it is absent, as per RFC 3584.
+	AgentAddrTrapAddress AgentAddrPolicy = iota
+
+	// AgentAddrOriginalSource uses the address the notification was
+	// received from, so the trap appears to come from the original agent.
+	AgentAddrOriginalSource
+
+	// AgentAddrForwarder uses V1TrapTranslator.ForwarderAddress.
+	AgentAddrForwarder
+)
+
+func (p AgentAddrPolicy) String() string {
+	switch p {
+	case AgentAddrTrapAddress:
+		return "TrapAddress"
+	case AgentAddrOriginalSource:
+		return "OriginalSource"
+	case AgentAddrForwarder:
+		return "Forwarder"
+	}
+	return "AgentAddrPolicy(" + strconv.Itoa(int(p)) + ")"
+}
+
+// V1TrapTranslator translates SNMPv2 notifications into SNMPv1 Trap-PDUs
+// following RFC 3584 section 3.2, for bridging v2c/v3 traps to v1 managers.
+type V1TrapTranslator struct {
+	// AgentAddrPolicy selects how the agent-addr field is filled in.
+	AgentAddrPolicy AgentAddrPolicy
+
+	// ForwarderAddress is the IPv4 agent-addr used by AgentAddrForwarder.
+	ForwarderAddress string
+
+	// EnterpriseMap overrides the enterprise derived from snmpTrapOID.0 for
+	// enterprise specific notifications, keyed by the snmpTrapOID.0 value.
+	EnterpriseMap map[string]string
+}
+
+// Validate checks that the translator configuration is consistent.
+func (t *V1TrapTranslator) Validate() error {
+	switch t.AgentAddrPolicy {
+	case AgentAddrTrapAddress, AgentAddrOriginalSource:
+		if t.ForwarderAddress != "" {
+			return fmt.Errorf("ForwarderAddress is only used with AgentAddrForwarder, policy is %v", t.AgentAddrPolicy)
+		}
+	case AgentAddrForwarder:
+		if ip := net.ParseIP(t.ForwarderAddress); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("AgentAddrForwarder requires an IPv4 ForwarderAddress, got %q", t.ForwarderAddress)
+		}
+	default:
+		return fmt.Errorf("invalid AgentAddrPolicy %v", t.AgentAddrPolicy)
+	}
+	for trapOID, enterprise := range t.EnterpriseMap {
+		if !isNumericOID(trapOID) {
+			return fmt.Errorf("EnterpriseMap: invalid notification OID %q", trapOID)
+		}
+		if !isNumericOID(enterprise) {
+			return fmt.Errorf("EnterpriseMap: invalid enterprise OID %q for %s", enterprise, trapOID)
+		}
+	}
+	return nil
+}
+
+// Translate converts the SNMPv2 notification in packet, received from
+// source, into an SNMPv1 trap suitable for SendTrap on a Version1
+// connection. source may be nil unless AgentAddrOriginalSource is used.
+//
+// As required by RFC 3584, Counter64 variables are dropped, as are
+// sysUpTime.0 and snmpTrapOID.0, whose values are carried in the time-stamp,
+// generic-trap, specific-trap and enterprise fields instead.
+func (t *V1TrapTranslator) Translate(packet *SnmpPacket, source *net.UDPAddr) (SnmpTrap, error) {
+	var trap SnmpTrap
+	if err := t.Validate(); err != nil {
+		return trap, err
+	}
+	if packet == nil || (packet.PDUType != SNMPv2Trap && packet.PDUType != InformRequest) {
+		return trap, fmt.Errorf("translation requires an SNMPv2 notification")
+	}
+
+	var trapOID, trapEnterprise, trapAddress string
+	for _, v := range packet.Variables {
+		switch normalizeOID(v.Name) {
+		case sysUpTimeOID:
+			trap.Timestamp = uint(ToBigInt(v.Value).Uint64())
+			continue
+		case snmpTrapOIDOID:
+			trapOID, _ = v.Value.(string)
+			continue
+		case snmpTrapEnterpriseOID:
+			trapEnterprise, _ = v.Value.(string)
+		case snmpTrapAddressOID:
+			trapAddress, _ = v.Value.(string)
+		}
+		if v.Type != Counter64 {
+			trap.Variables = append(trap.Variables, v)
+		}
+	}
+	if trapOID == "" {
+		return trap, fmt.Errorf("notification has no snmpTrapOID.0")
+	}
+	trapOID = normalizeOID(trapOID)
+
+	// RFC 3584 section 3.2 (1)
+	if parent, last := splitOID(trapOID); parent == snmpTrapsOID && last >= 1 && last <= 6 {
+		trap.GenericTrap = last - 1
+		trap.Enterprise = snmpTrapsOID
+		if trapEnterprise != "" {
+			trap.Enterprise = normalizeOID(trapEnterprise)
+		}
+	} else {
+		trap.GenericTrap = 6
+		trap.SpecificTrap = last
+		trap.Enterprise = parent
+		if p, l := splitOID(parent); l == 0 {
+			trap.Enterprise = p
+		}
+		if enterprise, ok := t.lookupEnterprise(trapOID); ok {
+			trap.Enterprise = enterprise
+		}
+	}
+
+	switch t.AgentAddrPolicy {
+	case AgentAddrTrapAddress:
+		trap.AgentAddress = "0.0.0.0"
+		if ip := net.ParseIP(trapAddress); ip != nil && ip.To4() != nil {
+			trap.AgentAddress = ip.To4().String()
+		}
+	case AgentAddrOriginalSource:
+		if source == nil || source.IP.To4() == nil {
+			return trap, fmt.Errorf("AgentAddrOriginalSource requires an IPv4 source, got %v", source)
+		}
+		trap.AgentAddress = source.IP.To4().String()
+	case AgentAddrForwarder:
+		trap.AgentAddress = net.ParseIP(t.ForwarderAddress).To4().String()
+	}
+	return trap, nil
+}
+
+// TranslateV1Trap converts the SNMPv1 Trap-PDU in packet into an SNMPv2
+// notification following RFC 3584 section 3.1, for SendTrap on a Version2c or
+// Version3 connection. The variables are sysUpTime.0 and snmpTrapOID.0 derived
+// from the v1 header, the variables of the trap, then snmpTrapAddress.0 and
+// snmpTrapEnterprise.0 unless the trap already carries them.
+func TranslateV1Trap(packet *SnmpPacket) (SnmpTrap, error) {
+	var trap SnmpTrap
+	if packet == nil || packet.PDUType != Trap {
+		return trap, fmt.Errorf("translation requires an SNMPv1 Trap-PDU")
+	}
+	if packet.GenericTrap < 0 || packet.GenericTrap > 6 {
+		return trap, fmt.Errorf("invalid generic-trap %d", packet.GenericTrap)
+	}
+	enterprise := normalizeOID(packet.Enterprise)
+
+	trap.Variables = []SnmpPDU{
+		{Name: sysUpTimeOID, Type: TimeTicks, Value: uint32(packet.Timestamp)},
+		{Name: snmpTrapOIDOID, Type: ObjectIdentifier, Value: v1TrapOID(enterprise, packet.GenericTrap, packet.SpecificTrap)},
+	}
+
+	hasAddress, hasEnterprise := false, false
+	for _, v := range packet.Variables {
+		switch normalizeOID(v.Name) {
+		case snmpTrapAddressOID:
+			hasAddress = true
+		case snmpTrapEnterpriseOID:
+			hasEnterprise = true
+		}
+		trap.Variables = append(trap.Variables, v)
+	}
+	if !hasAddress && packet.AgentAddress != "" {
+		trap.Variables = append(trap.Variables, SnmpPDU{Name: snmpTrapAddressOID, Type: IPAddress, Value: packet.AgentAddress})
+	}
+	if !hasEnterprise && enterprise != "" {
+		trap.Variables = append(trap.Variables, SnmpPDU{Name: snmpTrapEnterpriseOID, Type: ObjectIdentifier, Value: enterprise})
+	}
+	return trap, nil
+}
+
+// v1TrapOID returns the snmpTrapOID.0 of an SNMPv1 trap, RFC 3584 section
+// 3.1 (2).
+func v1TrapOID(enterprise string, genericTrap, specificTrap int) string {
+	if genericTrap >= 0 && genericTrap < 6 {
+		return snmpTrapsOID + "." + strconv.Itoa(genericTrap+1)
+	}
+	return enterprise + ".0." + strconv.Itoa(specificTrap)
+}
+
+// setNotificationFields sets the Uptime, TrapOID, Enterprise, AgentAddress
+// and SnmpTrap.Variables of a received notification, see SnmpTrap.
+func (packet *SnmpPacket) setNotificationFields() {
+	if packet.PDUType == Trap {
+		packet.Uptime = uint32(packet.Timestamp)
+		packet.TrapOID = v1TrapOID(normalizeOID(packet.Enterprise), packet.GenericTrap, packet.SpecificTrap)
+		packet.SnmpTrap.Variables = packet.Variables
+		return
+	}
+	rest := make([]SnmpPDU, 0, len(packet.Variables))
+	for _, v := range packet.Variables {
+		switch normalizeOID(v.Name) {
+		case sysUpTimeOID:
+			packet.Uptime = uint32(ToBigInt(v.Value).Uint64())
+			continue
+		case snmpTrapOIDOID:
+			oid, _ := v.Value.(string)
+			packet.TrapOID = normalizeOID(oid)
+			continue
+		case snmpTrapEnterpriseOID:
+			oid, _ := v.Value.(string)
+			packet.Enterprise = normalizeOID(oid)
+		case snmpTrapAddressOID:
+			packet.AgentAddress, _ = v.Value.(string)
+		}
+		rest = append(rest, v)
+	}
+	packet.SnmpTrap.Variables = rest
+}
+
+func (t *V1TrapTranslator) lookupEnterprise(trapOID string) (string, bool) {
+	for k, v := range t.EnterpriseMap {
+		if normalizeOID(k) == trapOID {
+			return normalizeOID(v), true
+		}
+	}
+	return "", false
+}
+
+// normalizeOID returns oid with a leading dot
+func normalizeOID(oid string) string {
+	if oid != "" && oid[0] != '.' {
+		return "." + oid
+	}
+	return oid
+}
+
+// splitOID splits oid into its parent and last sub-identifier
+func splitOID(oid string) (string, int) {
+	i := strings.LastIndexByte(oid, '.')
+	if i < 0 {
+		return "", 0
+	}
+	last, err := strconv.Atoi(oid[i+1:])
+	if err != nil {
+		return oid, 0
+	}
+	return oid[:i], last
+}
+
+func isNumericOID(oid string) bool {
+	oid = strings.TrimPrefix(oid, ".")
+	if oid == "" {
+		return false
+	}
+	for _, s := range strings.Split(oid, ".") {
+		if _, err := strconv.ParseUint(s, 10, 32); err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,175 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || trap
+// +build all trap
+
+package gosnmp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func v2Notification(trapOID string, extra ...SnmpPDU) *SnmpPacket {
+	vars := []SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.3.0", Type: TimeTicks, Value: uint32(4242)},
+		{Name: ".1.3.6.1.6.3.1.1.4.1.0", Type: ObjectIdentifier, Value: trapOID},
+	}
+	return &SnmpPacket{
+		Version:   Version2c,
+		PDUType:   SNMPv2Trap,
+		Variables: append(vars, extra...),
+	}
+}
+
+func TestV1TrapTranslatorGeneric(t *testing.T) {
+	tr := &V1TrapTranslator{}
+	packet := v2Notification(".1.3.6.1.6.3.1.1.5.3",
+		SnmpPDU{Name: ".1.3.6.1.2.1.2.2.1.1.2", Type: Integer, Value: 2},
+		SnmpPDU{Name: ".1.3.6.1.2.1.31.1.1.1.6.2", Type: Counter64, Value: uint64(1)},
+		SnmpPDU{Name: ".1.3.6.1.6.3.18.1.3.0", Type: IPAddress, Value: "10.0.0.9"},
+	)
+
+	trap, err := tr.Translate(packet, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, trap.GenericTrap) // linkDown
+	assert.Equal(t, 0, trap.SpecificTrap)
+	assert.Equal(t, ".1.3.6.1.6.3.1.1.5", trap.Enterprise)
+	assert.Equal(t, uint(4242), trap.Timestamp)
+	assert.Equal(t, "10.0.0.9", trap.AgentAddress)
+	require.Len(t, trap.Variables, 2, "sysUpTime, snmpTrapOID and Counter64 are dropped")
+	assert.Equal(t, ".1.3.6.1.2.1.2.2.1.1.2", trap.Variables[0].Name)
+
+	// snmpTrapEnterprise.0 overrides the enterprise of generic traps
+	packet = v2Notification("1.3.6.1.6.3.1.1.5.1",
+		SnmpPDU{Name: ".1.3.6.1.6.3.1.1.4.3.0", Type: ObjectIdentifier, Value: ".1.3.6.1.4.1.9"})
+	trap, err = tr.Translate(packet, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, trap.GenericTrap)
+	assert.Equal(t, ".1.3.6.1.4.1.9", trap.Enterprise)
+	assert.Equal(t, "0.0.0.0", trap.AgentAddress)
+}
+
+func TestV1TrapTranslatorEnterpriseSpecific(t *testing.T) {
+	tr := &V1TrapTranslator{}
+
+	trap, err := tr.Translate(v2Notification(".1.3.6.1.4.1.9.9.41.2.0.1"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 6, trap.GenericTrap)
+	assert.Equal(t, 1, trap.SpecificTrap)
+	assert.Equal(t, ".1.3.6.1.4.1.9.9.41.2", trap.Enterprise)
+
+	trap, err = tr.Translate(v2Notification(".1.3.6.1.4.1.8072.4.17"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 17, trap.SpecificTrap)
+	assert.Equal(t, ".1.3.6.1.4.1.8072.4", trap.Enterprise)
+
+	tr.EnterpriseMap = map[string]string{"1.3.6.1.4.1.8072.4.17": "1.3.6.1.4.1.8072"}
+	trap, err = tr.Translate(v2Notification(".1.3.6.1.4.1.8072.4.17"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, ".1.3.6.1.4.1.8072", trap.Enterprise)
+}
+
+func TestV1TrapTranslatorAgentAddr(t *testing.T) {
+	source := &net.UDPAddr{IP: net.ParseIP("192.0.2.7"), Port: 162}
+	packet := v2Notification(".1.3.6.1.6.3.1.1.5.1",
+		SnmpPDU{Name: ".1.3.6.1.6.3.18.1.3.0", Type: IPAddress, Value: "10.0.0.9"})
+
+	tr := &V1TrapTranslator{AgentAddrPolicy: AgentAddrOriginalSource}
+	trap, err := tr.Translate(packet, source)
+	require.NoError(t, err)
+	assert.Equal(t, "192.0.2.7", trap.AgentAddress)
+
+	_, err = tr.Translate(packet, &net.UDPAddr{IP: net.ParseIP("2001:db8::1")})
+	assert.Error(t, err)
+	_, err = tr.Translate(packet, nil)
+	assert.Error(t, err)
+
+	tr = &V1TrapTranslator{AgentAddrPolicy: AgentAddrForwarder, ForwarderAddress: "198.51.100.1"}
+	trap, err = tr.Translate(packet, source)
+	require.NoError(t, err)
+	assert.Equal(t, "198.51.100.1", trap.AgentAddress)
+}
+
+func TestV1TrapTranslatorValidate(t *testing.T) {
+	invalid := []*V1TrapTranslator{
+		{AgentAddrPolicy: AgentAddrForwarder},
+		{AgentAddrPolicy: AgentAddrForwarder, ForwarderAddress: "2001:db8::1"},
+		{AgentAddrPolicy: AgentAddrTrapAddress, ForwarderAddress: "198.51.100.1"},
+		{AgentAddrPolicy: AgentAddrPolicy(42)},
+		{EnterpriseMap: map[string]string{"1.3.6.x": "1.3.6.1"}},
+		{EnterpriseMap: map[string]string{"1.3.6.1.4.1.1.0.1": ""}},
+	}
+	for i, tr := range invalid {
+		assert.Error(t, tr.Validate(), "#%d", i)
+	}
+	assert.NoError(t, (&V1TrapTranslator{}).Validate())
+
+	_, err := (&V1TrapTranslator{}).Translate(&SnmpPacket{PDUType: GetRequest}, nil)
+	assert.Error(t, err)
+	_, err = (&V1TrapTranslator{}).Translate(&SnmpPacket{PDUType: SNMPv2Trap}, nil)
+	assert.Error(t, err)
+}
+
+func TestNotificationFields(t *testing.T) {
+	received := make(chan *SnmpPacket, 2)
+	tl := NewTrapListener()
+	tl.OnNewTrap = func(s *SnmpPacket, u *net.UDPAddr) {
+		received <- s
+	}
+	ts := startTrapListener(t, tl)
+	next := func() *SnmpPacket {
+		select {
+		case packet := <-received:
+			return packet
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for trap")
+		}
+		return nil
+	}
+
+	ifIndex := SnmpPDU{Name: ".1.3.6.1.2.1.2.2.1.1.2", Type: Integer, Value: 2}
+	_, err := ts.SendTrap(SnmpTrap{
+		TrapOID: ".1.3.6.1.6.3.1.1.5.3",
+		Uptime:  4242,
+		Variables: []SnmpPDU{
+			ifIndex,
+			{Name: ".1.3.6.1.6.3.18.1.3.0", Type: IPAddress, Value: "192.0.2.7"},
+		},
+	})
+	require.NoError(t, err)
+	packet := next()
+	assert.Len(t, packet.Variables, 4)
+	assert.Equal(t, uint32(4242), packet.Uptime)
+	assert.Equal(t, ".1.3.6.1.6.3.1.1.5.3", packet.TrapOID)
+	assert.Equal(t, "192.0.2.7", packet.AgentAddress)
+	assert.Equal(t, []SnmpPDU{ifIndex, {Name: ".1.3.6.1.6.3.18.1.3.0", Type: IPAddress, Value: "192.0.2.7"}}, packet.SnmpTrap.Variables)
+
+	// the structured trap of a received packet can be sent again
+	_, err = ts.SendTrap(packet.SnmpTrap)
+	require.NoError(t, err)
+	again := next()
+	assert.Equal(t, packet.Variables, again.Variables)
+
+	// SNMPv1 traps get the fields of their SNMPv2 translation
+	ts.Version = Version1
+	_, err = ts.SendV1Trap(SnmpTrap{
+		Enterprise:   ".1.3.6.1.4.1.8072",
+		AgentAddress: "192.0.2.1",
+		GenericTrap:  6,
+		SpecificTrap: 17,
+		Timestamp:    300,
+		Variables:    []SnmpPDU{ifIndex},
+	})
+	require.NoError(t, err)
+	packet = next()
+	assert.Equal(t, uint32(300), packet.Uptime)
+	assert.Equal(t, ".1.3.6.1.4.1.8072.0.17", packet.TrapOID)
+	assert.Equal(t, []SnmpPDU{ifIndex}, packet.SnmpTrap.Variables)
+}
@@ -0,0 +1,142 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxLimitedSources bounds the number of source addresses whose rate a
+// TrapListener tracks; idle sources are forgotten beyond it.
+const maxLimitedSources = 4096
+
+// TrapDrops counts the traps a TrapListener dropped, to keep up, by its ACL
+// or as they were not notifications.
+type TrapDrops struct {
+	// QueueFull counts traps dropped because all workers were busy and the
+	// queue was full.
+	QueueFull uint64
+
+	// RateLimited counts traps dropped because their source exceeded
+	// SourceRate.
+	RateLimited uint64
+
+	// Rejected counts traps rejected by the ACL.
+	Rejected uint64
+
+	// NotNotification counts messages dropped as their PDU was not a Trap,
+	// SNMPv2-Trap or InformRequest.
+	NotNotification uint64
+}
+
+// Dropped returns the number of traps dropped so far.
+func (t *TrapListener) Dropped() TrapDrops {
+	return TrapDrops{
+		QueueFull:   atomic.LoadUint64(&t.queueFull),
+		RateLimited: atomic.LoadUint64(&t.rateLimits),
+		Rejected:    atomic.LoadUint64(&t.rejected),
+
+		NotNotification: atomic.LoadUint64(&t.notNotifications),
+	}
+}
+
+// receivedTrap is a decoded UDP trap waiting for a worker.
+type receivedTrap struct {
+	packet *SnmpPacket
+	remote *net.UDPAddr
+}
+
+// startWorkers starts the Workers of a UDP listener on conn and returns
+// their queue, or nil if traps are handled by the reading goroutine. The
+// workers return once the queue is closed and emptied.
+func (t *TrapListener) startWorkers(conn *net.UDPConn) (chan receivedTrap, *sync.WaitGroup) {
+	if t.Workers <= 0 {
+		return nil, nil
+	}
+	size := t.QueueSize
+	if size <= 0 {
+		size = t.Workers
+	}
+	queue := make(chan receivedTrap, size)
+	workers := &sync.WaitGroup{}
+	workers.Add(t.Workers)
+	for i := 0; i < t.Workers; i++ {
+		go func() {
+			defer workers.Done()
+			for r := range queue {
+				if err := t.handleUDP(conn, r.packet, r.remote); err != nil {
+					t.Params.Logger.Printf("TrapListener: %s\n", err)
+				}
+			}
+		}()
+	}
+	return queue, workers
+}
+
+// sourceLimiter is a token bucket per source address.
+type sourceLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newSourceLimiter(rate float64, burst int) *sourceLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &sourceLimiter{rate: rate, burst: float64(burst), buckets: make(map[string]*tokenBucket)}
+}
+
+// allow reports whether a trap from ip received at now is within the rate.
+func (l *sourceLimiter) allow(ip net.IP, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := string(ip.To16())
+	b := l.buckets[key]
+	if b == nil {
+		if len(l.buckets) >= maxLimitedSources {
+			l.forgetIdle(now)
+		}
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// forgetIdle removes the sources whose bucket has refilled, they start
+// again with a full bucket. If all sources are busy, some are forgotten
+// anyway to bound the memory used under a storm from many sources.
+func (l *sourceLimiter) forgetIdle(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	for key := range l.buckets {
+		if len(l.buckets) < maxLimitedSources {
+			break
+		}
+		delete(l.buckets, key)
+	}
+}
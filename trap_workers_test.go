@@ -0,0 +1,123 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || trap
+// +build all trap
+
+package gosnmp
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startTrapListener runs tl on an ephemeral UDP port and returns a session
+// sending traps to it.
+func startTrapListener(t *testing.T, tl *TrapListener) *GoSNMP {
+	if tl.Params == nil {
+		tl.Params = &GoSNMP{Version: Version2c, Logger: NewLogger(log.New(ioutil.Discard, "", 0))}
+	}
+	errch := make(chan error, 1)
+	go func() {
+		errch <- tl.Listen(net.JoinHostPort(trapTestAddress, "0"))
+	}()
+	select {
+	case <-tl.Listening():
+	case err := <-errch:
+		t.Fatalf("error in listen: %v", err)
+	}
+	t.Cleanup(tl.Close)
+
+	tl.Lock()
+	port := tl.conn.LocalAddr().(*net.UDPAddr).Port
+	tl.Unlock()
+	ts := &GoSNMP{
+		Target:    trapTestAddress,
+		Port:      uint16(port),
+		Community: "public",
+		Version:   Version2c,
+		Timeout:   time.Second,
+		MaxOids:   MaxOids,
+		Logger:    NewLogger(log.New(ioutil.Discard, "", 0)),
+	}
+	require.NoError(t, ts.Connect())
+	t.Cleanup(func() { ts.Conn.Close() })
+	return ts
+}
+
+func TestTrapListenerWorkers(t *testing.T) {
+	release := make(chan struct{})
+	var entered, handled int32
+	tl := NewTrapListener()
+	tl.Workers = 2
+	tl.QueueSize = 1
+	tl.OnNewTrap = func(s *SnmpPacket, u *net.UDPAddr) {
+		atomic.AddInt32(&entered, 1)
+		<-release
+		atomic.AddInt32(&handled, 1)
+	}
+	ts := startTrapListener(t, tl)
+
+	trap := SnmpTrap{Variables: []SnmpPDU{{Name: trapTestOid, Type: OctetString, Value: trapTestPayload}}}
+	for i := 0; i < 2; i++ {
+		_, err := ts.SendTrap(trap)
+		require.NoError(t, err)
+	}
+	// both workers are busy, the next trap waits in the queue and the
+	// others are dropped without blocking the socket
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&entered) == 2 }, time.Second, time.Millisecond)
+	for i := 0; i < 5; i++ {
+		_, err := ts.SendTrap(trap)
+		require.NoError(t, err)
+	}
+	assert.Eventually(t, func() bool { return tl.Dropped().QueueFull == 4 }, time.Second, time.Millisecond)
+
+	close(release)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&handled) == 3 }, time.Second, time.Millisecond)
+	assert.Equal(t, TrapDrops{QueueFull: 4}, tl.Dropped())
+}
+
+func TestTrapListenerSourceRate(t *testing.T) {
+	var handled int32
+	tl := NewTrapListener()
+	tl.SourceRate = 0.01
+	tl.SourceBurst = 2
+	tl.OnNewTrap = func(s *SnmpPacket, u *net.UDPAddr) {
+		atomic.AddInt32(&handled, 1)
+	}
+	ts := startTrapListener(t, tl)
+
+	trap := SnmpTrap{Variables: []SnmpPDU{{Name: trapTestOid, Type: OctetString, Value: trapTestPayload}}}
+	for i := 0; i < 5; i++ {
+		_, err := ts.SendTrap(trap)
+		require.NoError(t, err)
+	}
+	assert.Eventually(t, func() bool { return tl.Dropped().RateLimited == 3 }, time.Second, time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&handled))
+}
+
+func TestSourceLimiter(t *testing.T) {
+	l := newSourceLimiter(2, 1)
+	now := time.Now()
+	a, b := net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")
+	assert.True(t, l.allow(a, now))
+	assert.False(t, l.allow(a, now))
+	assert.True(t, l.allow(b, now), "sources are limited separately")
+	assert.True(t, l.allow(a, now.Add(500*time.Millisecond)))
+
+	// idle sources are forgotten once too many are tracked
+	for i := 0; i < maxLimitedSources; i++ {
+		l.allow(net.IPv4(10, byte(i>>16), byte(i>>8), byte(i)), now)
+	}
+	assert.LessOrEqual(t, len(l.buckets), maxLimitedSources)
+	l.allow(net.ParseIP("192.0.2.3"), now.Add(time.Second))
+	assert.Len(t, l.buckets, 1)
+}
@@ -27,12 +27,107 @@ const (
 	Reportable   SnmpV3MsgFlags = 0x4 // Report PDU must be sent.
 )
 
+// privacyFlag is the privacy bit of SnmpV3MsgFlags, only valid with the
+// authentication bit.
+const privacyFlag SnmpV3MsgFlags = 0x2
+
+// ErrInvalidMsgFlags is returned for SnmpV3MsgFlags requesting privacy
+// without authentication, which RFC 3412 section 6.4 forbids.
+var ErrInvalidMsgFlags = errors.New("invalid msgFlags: privacy without authentication")
+
+// SecurityLevel is the security level of SNMPv3 messages, with the values of
+// the SnmpSecurityLevel textual convention of RFC 3411. It is set in the
+// message by SnmpV3MsgFlags, see SecurityLevel.Flags.
+type SecurityLevel uint8
+
+// SecurityLevel values, the zero value being none.
+const (
+	SecurityLevelNoAuthNoPriv SecurityLevel = 1
+	SecurityLevelAuthNoPriv   SecurityLevel = 2
+	SecurityLevelAuthPriv     SecurityLevel = 3
+)
+
+// Flags returns the SnmpV3MsgFlags of level, without the Reportable flag.
+func (l SecurityLevel) Flags() SnmpV3MsgFlags {
+	switch l {
+	case SecurityLevelAuthPriv:
+		return AuthPriv
+	case SecurityLevelAuthNoPriv:
+		return AuthNoPriv
+	}
+	return NoAuthNoPriv
+}
+
+func (l SecurityLevel) String() string {
+	switch l {
+	case SecurityLevelNoAuthNoPriv:
+		return "noAuthNoPriv"
+	case SecurityLevelAuthNoPriv:
+		return "authNoPriv"
+	case SecurityLevelAuthPriv:
+		return "authPriv"
+	}
+	return fmt.Sprintf("SecurityLevel(%d)", uint8(l))
+}
+
+// SecurityLevel returns the security level of flags, or zero if they request
+// privacy without authentication.
+func (f SnmpV3MsgFlags) SecurityLevel() SecurityLevel {
+	switch f & AuthPriv {
+	case AuthPriv:
+		return SecurityLevelAuthPriv
+	case AuthNoPriv:
+		return SecurityLevelAuthNoPriv
+	case NoAuthNoPriv:
+		return SecurityLevelNoAuthNoPriv
+	}
+	return 0
+}
+
+// WithSecurityLevel returns flags with the security level level, keeping the
+// Reportable flag.
+func (f SnmpV3MsgFlags) WithSecurityLevel(level SecurityLevel) SnmpV3MsgFlags {
+	return f&^AuthPriv | level.Flags()
+}
+
+// WithReportable returns flags with the Reportable flag set.
+func (f SnmpV3MsgFlags) WithReportable() SnmpV3MsgFlags {
+	return f | Reportable
+}
+
+// IsReportable reports whether the Reportable flag is set.
+func (f SnmpV3MsgFlags) IsReportable() bool {
+	return f&Reportable != 0
+}
+
+// Validate returns ErrInvalidMsgFlags if flags request privacy without
+// authentication, or set bits not defined by RFC 3412.
+func (f SnmpV3MsgFlags) Validate() error {
+	if f&^(AuthPriv|Reportable) != 0 {
+		return fmt.Errorf("invalid msgFlags 0x%x: undefined bits set", uint8(f))
+	}
+	if f.SecurityLevel() == 0 {
+		return ErrInvalidMsgFlags
+	}
+	return nil
+}
+
+func (f SnmpV3MsgFlags) String() string {
+	s := f.SecurityLevel().String()
+	if f.IsReportable() {
+		s += "|reportable"
+	}
+	return s
+}
+
 // SnmpV3SecurityModel describes the security model used by a SnmpV3 connection
 type SnmpV3SecurityModel uint8
 
-// UserSecurityModel is the only SnmpV3SecurityModel currently implemented.
+// SnmpV3SecurityModel values, see RFC 3411 and RFC 5591. Further models
+// can be added with RegisterSecurityModel.
 const (
-	UserSecurityModel SnmpV3SecurityModel = 3
+	UserSecurityModel      SnmpV3SecurityModel = 3
+	TransportSecurityModel SnmpV3SecurityModel = 4
 )
 
 // SnmpV3SecurityParameters is a generic interface type to contain various implementations of SnmpV3SecurityParameters
@@ -50,17 +145,37 @@ type SnmpV3SecurityParameters interface {
 	unmarshal(flags SnmpV3MsgFlags, packet []byte, cursor int) (int, error)
 	authenticate(packet []byte) error
 	isAuthentic(packetBytes []byte, packet *SnmpPacket) (bool, error)
-	encryptPacket(scopedPdu []byte) ([]byte, error)
-	decryptPacket(packet []byte, cursor int) ([]byte, error)
+	encryptPacket(flags SnmpV3MsgFlags, scopedPdu []byte) ([]byte, error)
+	decryptPacket(flags SnmpV3MsgFlags, packet []byte, cursor int) ([]byte, error)
 	initSecurityKeys() error
 }
 
 func (x *GoSNMP) validateParametersV3() error {
-	// update following code if you implement a new security model
-	if x.SecurityModel != UserSecurityModel {
-		return errors.New("the SNMPV3 User Security Model is the only SNMPV3 security model currently implemented")
+	if err := x.MsgFlags.Validate(); err != nil {
+		return err
+	}
+	if x.AllowDowngradeTo != nil {
+		if err := x.AllowDowngradeTo.Validate(); err != nil {
+			return fmt.Errorf("AllowDowngradeTo: %w", err)
+		}
+	}
+	plugin, ok := lookupSecurityModel(x.SecurityModel)
+	if !ok {
+		return fmt.Errorf("SNMPV3 security model %d is not implemented", x.SecurityModel)
+	}
+	if err := plugin.Configure(x); err != nil {
+		return err
 	}
 	if x.SecurityParameters == nil {
+		if x.UsmUsers != nil && x.SecurityModel == UserSecurityModel {
+			// receiving only, the credentials come from the user table
+			return nil
+		}
+		if x.SecurityModel == UserSecurityModel && x.MsgFlags&AuthPriv == NoAuthNoPriv {
+			// unauthenticated messages are decoded without credentials,
+			// sending checks for a UserName
+			return nil
+		}
 		return errors.New("SNMPV3 SecurityParameters must be set")
 	}
 
@@ -68,9 +183,13 @@ func (x *GoSNMP) validateParametersV3() error {
 }
 
 // authenticate the marshalled result of a snmp version 3 packet
-func (packet *SnmpPacket) authenticate(msg []byte) ([]byte, error) {
+func (packet *SnmpPacket) authenticate(msg []byte) (out []byte, err error) {
 	defer func() {
 		if e := recover(); e != nil {
+			if packet.strictAuth {
+				out, err = nil, fmt.Errorf("authenticate: %v", e)
+				return
+			}
 			var buf = make([]byte, 8192)
 			runtime.Stack(buf, true)
 			fmt.Printf("[v3::authenticate]recover: %v. Stack=%v\n", e, string(buf))
@@ -93,7 +212,7 @@ func (x *GoSNMP) testAuthentication(packet []byte, result *SnmpPacket, useRespon
 	if x.Version != Version3 {
 		return fmt.Errorf("testAuthentication called with non Version3 connection")
 	}
-	msgFlags := x.MsgFlags
+	msgFlags := x.msgFlags()
 	if useResponseSecurityParameters {
 		msgFlags = result.MsgFlags
 	}
@@ -101,15 +220,22 @@ func (x *GoSNMP) testAuthentication(packet []byte, result *SnmpPacket, useRespon
 	if msgFlags&AuthNoPriv > 0 {
 		var authentic bool
 		var err error
+		sp := x.SecurityParameters
 		if useResponseSecurityParameters {
-			authentic, err = result.SecurityParameters.isAuthentic(packet, result)
+			sp = result.SecurityParameters
+		}
+		if usp, ok := sp.(*UsmSecurityParameters); ok && x.StrictAuthentication {
+			authentic, err = usp.verifyDigest(packet, result, true)
 		} else {
-			authentic, err = x.SecurityParameters.isAuthentic(packet, result)
+			authentic, err = sp.isAuthentic(packet, result)
 		}
 		if err != nil {
 			return err
 		}
 		if !authentic {
+			if x.StrictAuthentication {
+				return fmt.Errorf("%w: incoming packet is not authentic, discarding", ErrWrongDigest)
+			}
 			return fmt.Errorf("incoming packet is not authentic, discarding")
 		}
 	}
@@ -118,18 +244,18 @@ func (x *GoSNMP) testAuthentication(packet []byte, result *SnmpPacket, useRespon
 }
 
 func (x *GoSNMP) initPacket(packetOut *SnmpPacket) error {
-	if x.MsgFlags&AuthPriv > AuthNoPriv {
+	if x.msgFlags()&AuthPriv > AuthNoPriv {
 		return x.SecurityParameters.initPacket(packetOut)
 	}
 
 	return nil
 }
 
-// http://tools.ietf.org/html/rfc2574#section-2.2.3 This code does not
-// check if the last message received was more than 150 seconds ago The
-// snmpds that this code was tested on emit an 'out of time window'
-// error with the new time and this code will retransmit when that is
-// received.
+// http://tools.ietf.org/html/rfc2574#section-2.2.3 The time window of
+// received messages is checked when TimelinessWindow is set, see
+// checkTimeliness. The snmpds that this code was tested on emit an 'out of
+// time window' error with the new time and this code will retransmit when
+// that is received.
 func (x *GoSNMP) negotiateInitialSecurityParameters(packetOut *SnmpPacket) error {
 	if x.Version != Version3 || packetOut.Version != Version3 {
 		return fmt.Errorf("negotiateInitialSecurityParameters called with non Version3 connection or packet")
@@ -140,13 +266,33 @@ func (x *GoSNMP) negotiateInitialSecurityParameters(packetOut *SnmpPacket) error
 	}
 
 	if discoveryPacket := packetOut.SecurityParameters.discoveryRequired(); discoveryPacket != nil {
-		discoveryPacket.ContextName = x.ContextName
-		result, err := x.sendOneRequest(discoveryPacket, true)
+		if cached, ok := x.cachedSecurityParameters(); ok {
+			x.Logger.Print("SEND USING CACHED ENGINE PARAMS")
+			if err := x.SecurityParameters.setSecurityParameters(cached); err != nil {
+				return err
+			}
+			if x.ContextEngineID == "" {
+				x.ContextEngineID = cached.AuthoritativeEngineID
+			}
+			return x.updatePktSecurityParameters(packetOut)
+		}
 
+		discoveryPacket.ContextName = x.contextName(packetOut.opts)
+		discoveryPacket.opts = packetOut.opts
+		if x.engineKey != "" {
+			// lets a middlebox route the discovery to the engine
+			discoveryPacket.ContextEngineID = x.engineKey
+		}
+		result, latency, err := x.discover(discoveryPacket)
 		if err != nil {
 			return err
 		}
 
+		if d, derr := ParseDiscoveryResult(result); derr == nil {
+			d.Latency = latency
+			x.shared().discovery = d
+		}
+
 		err = x.storeSecurityParameters(result)
 		if err != nil {
 			return err
@@ -157,6 +303,10 @@ func (x *GoSNMP) negotiateInitialSecurityParameters(packetOut *SnmpPacket) error
 			return err
 		}
 	} else {
+		if packetOut.ContextEngineID == "" {
+			// a view of a session that discovered the engine before it
+			packetOut.ContextEngineID = x.SecurityParameters.getDefaultContextEngineID()
+		}
 		err := packetOut.SecurityParameters.initSecurityKeys()
 		if err == nil {
 			return err
@@ -180,7 +330,20 @@ func (x *GoSNMP) storeSecurityParameters(result *SnmpPacket) error {
 		x.ContextEngineID = result.SecurityParameters.getDefaultContextEngineID()
 	}
 
-	return x.SecurityParameters.setSecurityParameters(result.SecurityParameters)
+	var change EngineChange
+	changed := false
+	if x.OnEngineChange != nil {
+		change, changed = engineChange(x.SecurityParameters, result.SecurityParameters)
+	}
+	if err := x.SecurityParameters.setSecurityParameters(result.SecurityParameters); err != nil {
+		return err
+	}
+	x.recordAgentMsgMaxSize(result)
+	x.updateEngineCache(result.SecurityParameters)
+	if changed {
+		x.OnEngineChange(x, change)
+	}
+	return nil
 }
 
 // update packet security parameters to match connection security parameters
@@ -213,7 +376,9 @@ func (packet *SnmpPacket) marshalV3(buf *bytes.Buffer) (*bytes.Buffer, error) {
 		return emptyBuffer, err
 	}
 	buf.Write([]byte{byte(Sequence), byte(len(header))})
-	packet.Logger.Printf("Marshal V3 Header len=%d. Eaten Last 4 Bytes=%v", len(header), header[len(header)-4:])
+	packet.Logger.PrintLazy(func() string {
+		return fmt.Sprintf("Marshal V3 Header len=%d. Eaten Last 4 Bytes=%v", len(header), lastBytes(header, 4))
+	})
 	buf.Write(header)
 
 	var securityParameters []byte
@@ -221,8 +386,10 @@ func (packet *SnmpPacket) marshalV3(buf *bytes.Buffer) (*bytes.Buffer, error) {
 	if err != nil {
 		return emptyBuffer, err
 	}
-	packet.Logger.Printf("Marshal V3 SecurityParameters len=%d. Eaten Last 4 Bytes=%v",
-		len(securityParameters), securityParameters[len(securityParameters)-4:])
+	packet.Logger.PrintLazy(func() string {
+		return fmt.Sprintf("Marshal V3 SecurityParameters len=%d. Eaten Last 4 Bytes=%v",
+			len(securityParameters), lastBytes(securityParameters, 4))
+	})
 
 	buf.Write([]byte{byte(OctetString)})
 	secParamLen, err := marshalLength(len(securityParameters))
@@ -293,7 +460,7 @@ func (packet *SnmpPacket) marshalV3ScopedPDU() ([]byte, error) {
 	b = append([]byte{byte(Sequence)}, pduLen...)
 	scopedPdu = append(b, scopedPdu...)
 	if packet.MsgFlags&AuthPriv > AuthNoPriv {
-		scopedPdu, err = packet.SecurityParameters.encryptPacket(scopedPdu)
+		scopedPdu, err = packet.SecurityParameters.encryptPacket(packet.MsgFlags, scopedPdu)
 		if err != nil {
 			return nil, err
 		}
@@ -302,6 +469,14 @@ func (packet *SnmpPacket) marshalV3ScopedPDU() ([]byte, error) {
 	return scopedPdu, nil
 }
 
+// lastBytes returns up to the last n bytes of b, for logging.
+func lastBytes(b []byte, n int) []byte {
+	if len(b) < n {
+		return b
+	}
+	return b[len(b)-n:]
+}
+
 // prepare the plain text of a snmp version 3 Scoped PDU
 func (packet *SnmpPacket) prepareV3ScopedPDU() ([]byte, error) {
 	var buf bytes.Buffer
@@ -414,7 +589,14 @@ func (x *GoSNMP) unmarshalV3Header(packet []byte,
 		return 0, errors.New("error parsing SNMPV3 message ID: truncted packet")
 	}
 	if response.SecurityParameters == nil {
-		response.SecurityParameters = &UsmSecurityParameters{Logger: x.Logger}
+		plugin, ok := lookupSecurityModel(response.SecurityModel)
+		if !ok {
+			return 0, fmt.Errorf("%w: %d", ErrUnknownSecurityModels, response.SecurityModel)
+		}
+		response.SecurityParameters = plugin.NewSecurityParameters(x.Logger)
+	}
+	if usp, ok := response.SecurityParameters.(*UsmSecurityParameters); ok && x.UsmUsers != nil {
+		usp.users = x.UsmUsers
 	}
 
 	cursor, err = response.SecurityParameters.unmarshal(response.MsgFlags, packet, cursor)
@@ -437,7 +619,7 @@ func (x *GoSNMP) decryptPacket(packet []byte, cursor int, response *SnmpPacket)
 	switch PDUType(packet[cursor]) {
 	case PDUType(OctetString):
 		// pdu is encrypted
-		packet, err = response.SecurityParameters.decryptPacket(packet, cursor)
+		packet, err = response.SecurityParameters.decryptPacket(response.MsgFlags, packet, cursor)
 		if err != nil {
 			return nil, 0, err
 		}
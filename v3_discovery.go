@@ -0,0 +1,310 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Discovery errors.
+var (
+	// ErrDiscoveryTimeout is returned when the engine discovery does not
+	// complete within GoSNMP.DiscoveryTimeout.
+	ErrDiscoveryTimeout = errors.New("engine discovery timeout")
+
+	// ErrDiscoveryFailed is returned without trying for a target whose
+	// discovery failed within GoSNMP.DiscoveryFailureTTL.
+	ErrDiscoveryFailed = errors.New("engine discovery failed recently")
+)
+
+// EngineIDFormat is the format octet of an RFC 3411 snmpEngineID, describing
+// how the octets following it were derived.
+type EngineIDFormat uint8
+
+// EngineIDFormat values defined by RFC 3411 section 5. Values 6-127 are
+// reserved and values 128-255 are enterprise specific.
+const (
+	EngineIDFormatNone   EngineIDFormat = 0 // pre RFC 3411 engine ID, see RFC 1910
+	EngineIDFormatIPv4   EngineIDFormat = 1
+	EngineIDFormatIPv6   EngineIDFormat = 2
+	EngineIDFormatMAC    EngineIDFormat = 3
+	EngineIDFormatText   EngineIDFormat = 4
+	EngineIDFormatOctets EngineIDFormat = 5
+)
+
+func (f EngineIDFormat) String() string {
+	switch f {
+	case EngineIDFormatNone:
+		return "None"
+	case EngineIDFormatIPv4:
+		return "IPv4"
+	case EngineIDFormatIPv6:
+		return "IPv6"
+	case EngineIDFormatMAC:
+		return "MAC"
+	case EngineIDFormatText:
+		return "Text"
+	case EngineIDFormatOctets:
+		return "Octets"
+	}
+	if f >= 128 {
+		return fmt.Sprintf("Enterprise(%d)", uint8(f))
+	}
+	return fmt.Sprintf("Reserved(%d)", uint8(f))
+}
+
+// EngineIDInfo is the decoded form of an snmpEngineID.
+type EngineIDInfo struct {
+	// Conformant is true when the engine ID uses the RFC 3411 layout (the
+	// first bit is set). Otherwise it uses the older RFC 1910 layout of an
+	// enterprise number followed by 8 opaque octets and Format is
+	// EngineIDFormatNone.
+	Conformant bool
+
+	// Enterprise is the IANA private enterprise number of the vendor.
+	Enterprise uint32
+
+	// Format describes how Data was derived.
+	Format EngineIDFormat
+
+	// Data is the remainder of the engine ID following the format octet, or
+	// following the enterprise number for non-conformant engine IDs.
+	Data []byte
+}
+
+// ParseEngineID decodes an snmpEngineID as found in AuthoritativeEngineID or
+// ContextEngineID. RFC 3411 limits engine IDs to 5-32 octets.
+func ParseEngineID(engineID string) (EngineIDInfo, error) {
+	var info EngineIDInfo
+	if len(engineID) < 5 || len(engineID) > 32 {
+		return info, fmt.Errorf("engine ID length %d is outside the range 5-32", len(engineID))
+	}
+	b := []byte(engineID)
+	info.Conformant = b[0]&0x80 != 0
+	info.Enterprise = binary.BigEndian.Uint32(b[:4]) &^ 0x80000000
+	if !info.Conformant {
+		info.Data = b[4:]
+		return info, nil
+	}
+	info.Format = EngineIDFormat(b[4])
+	info.Data = b[5:]
+	return info, nil
+}
+
+// IP returns the address embedded in an IPv4 or IPv6 format engine ID, or nil.
+func (e EngineIDInfo) IP() net.IP {
+	switch {
+	case e.Format == EngineIDFormatIPv4 && len(e.Data) == net.IPv4len:
+		return net.IP(e.Data).To16()
+	case e.Format == EngineIDFormatIPv6 && len(e.Data) == net.IPv6len:
+		return net.IP(e.Data)
+	}
+	return nil
+}
+
+// MAC returns the hardware address embedded in a MAC format engine ID, or nil.
+func (e EngineIDInfo) MAC() net.HardwareAddr {
+	if e.Format == EngineIDFormatMAC && len(e.Data) == 6 {
+		return net.HardwareAddr(e.Data)
+	}
+	return nil
+}
+
+func (e EngineIDInfo) String() string {
+	if !e.Conformant {
+		return fmt.Sprintf("enterprise=%d data=%s", e.Enterprise, hex.EncodeToString(e.Data))
+	}
+	var data string
+	switch e.Format {
+	case EngineIDFormatIPv4, EngineIDFormatIPv6:
+		if ip := e.IP(); ip != nil {
+			data = ip.String()
+		}
+	case EngineIDFormatMAC:
+		if mac := e.MAC(); mac != nil {
+			data = mac.String()
+		}
+	case EngineIDFormatText:
+		data = string(e.Data)
+	}
+	if data == "" {
+		data = hex.EncodeToString(e.Data)
+	}
+	return fmt.Sprintf("enterprise=%d format=%s data=%s", e.Enterprise, e.Format, data)
+}
+
+// UsmStats holds the usmStats counters of RFC 3414 section 5 as reported by
+// an agent. Counters the agent did not report are zero.
+type UsmStats struct {
+	UnsupportedSecLevels uint32
+	NotInTimeWindows     uint32
+	UnknownUserNames     uint32
+	UnknownEngineIDs     uint32
+	WrongDigests         uint32
+	DecryptionErrors     uint32
+}
+
+// DiscoveryResult describes the reply of an agent to the USM discovery
+// exchange of RFC 3414 section 4.
+type DiscoveryResult struct {
+	// EngineID is the raw authoritative engine ID, use ParseEngineID or
+	// EngineIDInfo to decode it.
+	EngineID    string
+	EngineBoots uint32
+	EngineTime  uint32
+
+	// Stats are the usmStats counters carried in the Report PDU.
+	Stats UsmStats
+
+	// Report holds the variables of the Report PDU as received.
+	Report []SnmpPDU
+
+	// Latency is the time the discovery took, its attempts included.
+	Latency time.Duration
+}
+
+// EngineIDInfo decodes the authoritative engine ID of the discovery result.
+func (d *DiscoveryResult) EngineIDInfo() (EngineIDInfo, error) {
+	return ParseEngineID(d.EngineID)
+}
+
+// ParseDiscoveryResult extracts the discovery details from a USM response
+// or report packet.
+func ParseDiscoveryResult(packet *SnmpPacket) (*DiscoveryResult, error) {
+	if packet == nil || packet.Version != Version3 {
+		return nil, fmt.Errorf("discovery result requires a Version3 packet")
+	}
+	sp, ok := packet.SecurityParameters.(*UsmSecurityParameters)
+	if !ok || sp == nil {
+		return nil, fmt.Errorf("discovery result requires UsmSecurityParameters, got %T", packet.SecurityParameters)
+	}
+
+	sp.mu.Lock()
+	d := &DiscoveryResult{
+		EngineID:    sp.AuthoritativeEngineID,
+		EngineBoots: sp.AuthoritativeEngineBoots,
+		EngineTime:  sp.AuthoritativeEngineTime,
+	}
+	sp.mu.Unlock()
+
+	if packet.PDUType != Report {
+		return d, nil
+	}
+	d.Report = append([]SnmpPDU(nil), packet.Variables...)
+	for _, v := range packet.Variables {
+		counter := uint32(ToBigInt(v.Value).Uint64())
+		switch v.Name {
+		case usmStatsUnsupportedSecLevels:
+			d.Stats.UnsupportedSecLevels = counter
+		case usmStatsNotInTimeWindows:
+			d.Stats.NotInTimeWindows = counter
+		case usmStatsUnknownUserNames:
+			d.Stats.UnknownUserNames = counter
+		case usmStatsUnknownEngineIDs:
+			d.Stats.UnknownEngineIDs = counter
+		case usmStatsWrongDigests:
+			d.Stats.WrongDigests = counter
+		case usmStatsDecryptionErrors:
+			d.Stats.DecryptionErrors = counter
+		}
+	}
+	return d, nil
+}
+
+// Discover performs the SNMPv3 engine discovery exchange of RFC 3414
+// section 4 and returns the authoritative engine ID, boots and time reported
+// by the agent. Unlike the implicit discovery done on the first request it
+// always probes the agent, even when the engine ID is already known, unless
+// its discovery failed within DiscoveryFailureTTL. The
+// learned parameters are stored on the connection, so later requests skip
+// implicit discovery.
+func (x *GoSNMP) Discover() (*DiscoveryResult, error) {
+	if x.Version != Version3 {
+		return nil, fmt.Errorf("discovery requires Version3, got %v", x.Version)
+	}
+	if x.shared().Conn == nil {
+		return nil, fmt.Errorf("&GoSNMP.Conn is missing. Provide a connection or use Connect()")
+	}
+	if x.SecurityModel != UserSecurityModel || x.SecurityParameters == nil {
+		return nil, fmt.Errorf("discovery requires UserSecurityModel SecurityParameters")
+	}
+
+	discoveryPacket := (&UsmSecurityParameters{Logger: x.Logger}).discoveryRequired()
+	discoveryPacket.ContextName = x.ContextName
+	result, latency, err := x.discover(discoveryPacket)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := ParseDiscoveryResult(result)
+	if err != nil {
+		return nil, err
+	}
+	d.Latency = latency
+	if d.EngineID == "" {
+		return d, fmt.Errorf("agent did not report an authoritative engine ID")
+	}
+	x.shared().discovery = d
+
+	if err = x.storeSecurityParameters(result); err != nil {
+		return nil, err
+	}
+	return x.LastDiscovery(), nil
+}
+
+// LastDiscovery returns the result of the most recent engine discovery
+// performed on this connection, or nil if none was performed.
+func (x *GoSNMP) LastDiscovery() *DiscoveryResult {
+	s := x.shared()
+	if s.discovery == nil {
+		return nil
+	}
+	d := *s.discovery
+	return &d
+}
+
+// discover sends the discovery request packet within DiscoveryTimeout, and
+// returns the answer and the time it took. The failures are remembered for
+// DiscoveryFailureTTL and counted in SessionStats.
+func (x *GoSNMP) discover(packet *SnmpPacket) (*SnmpPacket, time.Duration, error) {
+	failures, _ := x.EngineCache.(DiscoveryFailureCache)
+	if x.DiscoveryFailureTTL <= 0 {
+		failures = nil
+	}
+	if failures != nil {
+		if until, ok := failures.DiscoveryFailure(x.engineCacheAddress()); ok {
+			return nil, 0, fmt.Errorf("%w, retrying after %s", ErrDiscoveryFailed, until.Format(time.RFC3339))
+		}
+	}
+
+	start := time.Now()
+	var result *SnmpPacket
+	var err error
+	if x.DiscoveryTimeout > 0 {
+		o := callOptions(packet.opts, nil)
+		if deadline := start.Add(x.DiscoveryTimeout); o.deadline.IsZero() || deadline.Before(o.deadline) {
+			o.deadline = deadline
+		}
+		packet.opts = o
+		result, err = x.sendOneRequest(packet, true)
+		if errors.Is(err, context.DeadlineExceeded) && x.callContext(o).Err() == nil {
+			err = fmt.Errorf("%w after %s", ErrDiscoveryTimeout, x.DiscoveryTimeout)
+		}
+	} else {
+		result, err = x.sendOneRequest(packet, true)
+	}
+	latency := time.Since(start)
+	x.SessionStats.recordDiscovery(latency, err)
+	if err != nil && failures != nil && x.callContext(packet.opts).Err() == nil {
+		failures.PutDiscoveryFailure(x.engineCacheAddress(), time.Now().Add(x.DiscoveryFailureTTL))
+	}
+	return result, latency, err
+}
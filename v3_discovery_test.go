@@ -0,0 +1,304 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustDecodeEngineID(t *testing.T, s string) string {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestParseEngineID(t *testing.T) {
+	// demo.snmplabs.com, enterprise 20408 with enterprise specific format 5
+	info, err := ParseEngineID(authorativeEngineID(t))
+	require.NoError(t, err)
+	assert.True(t, info.Conformant)
+	assert.Equal(t, uint32(20408), info.Enterprise)
+	assert.Equal(t, EngineIDFormatOctets, info.Format)
+	assert.Equal(t, "enterprise=20408 format=Octets data=636c6f75644dab22cc", info.String())
+
+	// net-snmp, MAC format
+	info, err = ParseEngineID(mustDecodeEngineID(t, "80001f8803005056a1b2c3"))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(8072), info.Enterprise)
+	assert.Equal(t, EngineIDFormatMAC, info.Format)
+	assert.Equal(t, net.HardwareAddr{0x00, 0x50, 0x56, 0xa1, 0xb2, 0xc3}, info.MAC())
+	assert.Nil(t, info.IP())
+
+	// Cisco, IPv4 format
+	info, err = ParseEngineID(mustDecodeEngineID(t, "800000090108080808"))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(9), info.Enterprise)
+	assert.Equal(t, "8.8.8.8", info.IP().String())
+	assert.Equal(t, "enterprise=9 format=IPv4 data=8.8.8.8", info.String())
+
+	// text format
+	info, err = ParseEngineID(mustDecodeEngineID(t, "80001f880472747231"))
+	require.NoError(t, err)
+	assert.Equal(t, EngineIDFormatText, info.Format)
+	assert.Equal(t, "enterprise=8072 format=Text data=rtr1", info.String())
+
+	// RFC 1910 layout
+	info, err = ParseEngineID(mustDecodeEngineID(t, "000000090102030405060708"))
+	require.NoError(t, err)
+	assert.False(t, info.Conformant)
+	assert.Equal(t, uint32(9), info.Enterprise)
+	assert.Equal(t, EngineIDFormatNone, info.Format)
+	assert.Len(t, info.Data, 8)
+
+	_, err = ParseEngineID("")
+	assert.Error(t, err)
+	_, err = ParseEngineID(string(make([]byte, 33)))
+	assert.Error(t, err)
+
+	assert.Equal(t, "Enterprise(128)", EngineIDFormat(128).String())
+	assert.Equal(t, "Reserved(6)", EngineIDFormat(6).String())
+}
+
+func TestParseDiscoveryResult(t *testing.T) {
+	packet := &SnmpPacket{
+		Version:       Version3,
+		SecurityModel: UserSecurityModel,
+		PDUType:       Report,
+		SecurityParameters: &UsmSecurityParameters{
+			AuthoritativeEngineID:    authorativeEngineID(t),
+			AuthoritativeEngineBoots: 43,
+			AuthoritativeEngineTime:  2113189,
+		},
+		Variables: []SnmpPDU{
+			{Name: usmStatsUnknownEngineIDs, Type: Counter32, Value: uint(17)},
+		},
+	}
+
+	d, err := ParseDiscoveryResult(packet)
+	require.NoError(t, err)
+	assert.Equal(t, authorativeEngineID(t), d.EngineID)
+	assert.Equal(t, uint32(43), d.EngineBoots)
+	assert.Equal(t, uint32(2113189), d.EngineTime)
+	assert.Equal(t, UsmStats{UnknownEngineIDs: 17}, d.Stats)
+	assert.Len(t, d.Report, 1)
+
+	info, err := d.EngineIDInfo()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(20408), info.Enterprise)
+
+	_, err = ParseDiscoveryResult(&SnmpPacket{Version: Version2c})
+	assert.Error(t, err)
+
+	x := &GoSNMP{}
+	assert.Nil(t, x.LastDiscovery())
+	x.discovery = d
+	last := x.LastDiscovery()
+	last.EngineBoots = 0
+	assert.Equal(t, uint32(43), x.LastDiscovery().EngineBoots)
+}
+
+// discoveryAgent answers every request with a usmStatsUnknownEngineIDs report
+func discoveryAgent(t *testing.T, srvr *net.UDPConn, engineID string) {
+	decoder := &GoSNMP{
+		Version:            Version3,
+		SecurityModel:      UserSecurityModel,
+		SecurityParameters: &UsmSecurityParameters{UserName: "agent"},
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := srvr.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req, err := decoder.SnmpDecodePacket(buf[:n])
+		if err != nil {
+			t.Errorf("agent decode: %s", err)
+			return
+		}
+		report := &SnmpPacket{
+			Version:       Version3,
+			MsgFlags:      NoAuthNoPriv,
+			SecurityModel: UserSecurityModel,
+			SecurityParameters: &UsmSecurityParameters{
+				AuthoritativeEngineID:    engineID,
+				AuthoritativeEngineBoots: 7,
+				AuthoritativeEngineTime:  1234,
+			},
+			MsgID:           req.MsgID,
+			RequestID:       req.RequestID,
+			ContextEngineID: engineID,
+			PDUType:         Report,
+			Variables: []SnmpPDU{
+				{Name: usmStatsUnknownEngineIDs, Type: Counter32, Value: uint32(5)},
+			},
+		}
+		out, err := report.MarshalMsg()
+		if err != nil {
+			t.Errorf("agent marshal: %s", err)
+			return
+		}
+		if _, err = srvr.WriteTo(out, addr); err != nil {
+			return
+		}
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	engineID := authorativeEngineID(t)
+	go discoveryAgent(t, srvr, engineID)
+
+	x := &GoSNMP{
+		Version:            Version3,
+		Target:             srvr.LocalAddr().(*net.UDPAddr).IP.String(),
+		Port:               uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Timeout:            time.Millisecond * 500,
+		Retries:            1,
+		MaxOids:            MaxOids,
+		SecurityModel:      UserSecurityModel,
+		MsgFlags:           NoAuthNoPriv,
+		SecurityParameters: &UsmSecurityParameters{UserName: "probe"},
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	d, err := x.Discover()
+	require.NoError(t, err)
+	assert.Equal(t, engineID, d.EngineID)
+	assert.Equal(t, uint32(7), d.EngineBoots)
+	assert.Equal(t, uint32(1234), d.EngineTime)
+	assert.Equal(t, uint32(5), d.Stats.UnknownEngineIDs)
+	assert.Equal(t, d, x.LastDiscovery())
+
+	// the learned parameters are stored on the connection
+	sp := x.SecurityParameters.(*UsmSecurityParameters)
+	assert.Equal(t, engineID, sp.AuthoritativeEngineID)
+	assert.Equal(t, engineID, x.ContextEngineID)
+
+	// discovery always probes, even when the engine ID is known
+	_, err = x.Discover()
+	require.NoError(t, err)
+
+	_, err = (&GoSNMP{Version: Version2c}).Discover()
+	assert.Error(t, err)
+}
+
+func TestEngineCache(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	engineID := authorativeEngineID(t)
+	go discoveryAgent(t, srvr, engineID)
+
+	cache := NewMemoryEngineCache()
+	newSession := func() *GoSNMP {
+		return &GoSNMP{
+			Version:            Version3,
+			Target:             srvr.LocalAddr().(*net.UDPAddr).IP.String(),
+			Port:               uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+			Timeout:            time.Millisecond * 500,
+			MaxOids:            MaxOids,
+			SecurityModel:      UserSecurityModel,
+			MsgFlags:           NoAuthNoPriv,
+			SecurityParameters: &UsmSecurityParameters{UserName: "probe"},
+			EngineCache:        cache,
+		}
+	}
+
+	x := newSession()
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+	_, err = x.Discover()
+	require.NoError(t, err)
+
+	info, ok := cache.Get(x.engineCacheAddress())
+	require.True(t, ok)
+	assert.Equal(t, engineID, info.EngineID)
+	assert.Equal(t, uint32(7), info.EngineBoots)
+
+	// a cache hit must not send a discovery packet; the session has no
+	// connection so any send would fail
+	info.Updated = time.Now().Add(-10 * time.Second)
+	cache.Put(x.engineCacheAddress(), info)
+	y := newSession()
+	packet := y.mkSnmpPacket(GetRequest, []SnmpPDU{{Name: ".1.3.6.1.2.1.1.1.0", Type: Null}}, 0, 0)
+	require.NoError(t, y.negotiateInitialSecurityParameters(packet))
+	sp := packet.SecurityParameters.(*UsmSecurityParameters)
+	assert.Equal(t, engineID, sp.AuthoritativeEngineID)
+	assert.Equal(t, uint32(7), sp.AuthoritativeEngineBoots)
+	assert.GreaterOrEqual(t, sp.AuthoritativeEngineTime, uint32(1244))
+	assert.Equal(t, engineID, y.ContextEngineID)
+	assert.Equal(t, engineID, packet.ContextEngineID)
+
+	cache.Delete(x.engineCacheAddress())
+	_, ok = cache.Get(x.engineCacheAddress())
+	assert.False(t, ok)
+}
+
+func TestDiscoveryTimeoutAndFailureCache(t *testing.T) {
+	// a dead target: the socket is open but nothing answers
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	cache := NewMemoryEngineCache()
+	stats := NewSessionStatsCollector()
+	newSession := func() *GoSNMP {
+		return &GoSNMP{
+			Version:             Version3,
+			Target:              srvr.LocalAddr().(*net.UDPAddr).IP.String(),
+			Port:                uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+			Timeout:             time.Second,
+			Retries:             3,
+			MaxOids:             MaxOids,
+			SecurityModel:       UserSecurityModel,
+			MsgFlags:            NoAuthNoPriv,
+			SecurityParameters:  &UsmSecurityParameters{UserName: "probe"},
+			EngineCache:         cache,
+			SessionStats:        stats,
+			DiscoveryTimeout:    100 * time.Millisecond,
+			DiscoveryFailureTTL: time.Minute,
+		}
+	}
+
+	x := newSession()
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+	start := time.Now()
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.1.0"})
+	assert.ErrorIs(t, err, ErrDiscoveryTimeout)
+	assert.Less(t, time.Since(start), time.Second)
+
+	until, ok := cache.DiscoveryFailure(x.engineCacheAddress())
+	require.True(t, ok)
+	assert.True(t, until.After(time.Now()))
+
+	// sessions sharing the cache fail without probing
+	y := newSession()
+	require.NoError(t, y.Connect())
+	defer y.Conn.Close()
+	_, err = y.Discover()
+	assert.ErrorIs(t, err, ErrDiscoveryFailed)
+
+	s := stats.Snapshot()
+	assert.Equal(t, uint64(1), s.Discoveries)
+	assert.Equal(t, uint64(1), s.DiscoveryFailures)
+	assert.GreaterOrEqual(t, s.DiscoveryTime, 100*time.Millisecond)
+
+	// a successful discovery clears the failure
+	cache.Put(x.engineCacheAddress(), EngineInfo{EngineID: authorativeEngineID(t)})
+	_, ok = cache.DiscoveryFailure(x.engineCacheAddress())
+	assert.False(t, ok)
+}
@@ -0,0 +1,141 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrSecurityDowngrade is matched by DowngradeError.
+var ErrSecurityDowngrade = errors.New("security level downgraded")
+
+// DowngradeError is returned when an SNMPv3 agent does not communicate at the
+// security level requested: a response arrived at a lower level, e.g. an
+// unauthenticated response to an authPriv request, or the agent reported
+// that it does not support the level (usmStatsUnsupportedSecLevels). It
+// matches ErrSecurityDowngrade with errors.Is.
+type DowngradeError struct {
+	Requested SnmpV3MsgFlags
+	Received  SnmpV3MsgFlags
+
+	// Err is the report of the agent, if any.
+	Err error
+}
+
+func (e *DowngradeError) Error() string {
+	msg := fmt.Sprintf("%s: requested %s, received %s", ErrSecurityDowngrade,
+		e.Requested.SecurityLevel(), e.Received.SecurityLevel())
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Is reports whether target is ErrSecurityDowngrade.
+func (e *DowngradeError) Is(target error) bool {
+	return target == ErrSecurityDowngrade
+}
+
+// Unwrap returns the report of the agent.
+func (e *DowngradeError) Unwrap() error {
+	return e.Err
+}
+
+// downgradeAllowed reports whether AllowDowngradeTo permits level.
+func (x *GoSNMP) downgradeAllowed(level SnmpV3MsgFlags) bool {
+	return x.AllowDowngradeTo != nil && level&AuthPriv >= *x.AllowDowngradeTo&AuthPriv
+}
+
+// recordDowngrade records that the session communicates at a lower level
+// than configured, see SecurityDowngrade.
+func (x *GoSNMP) recordDowngrade(requested, received SnmpV3MsgFlags, report error) {
+	s := x.shared()
+	if s.securityDowngrade != nil {
+		requested = s.securityDowngrade.Requested
+	}
+	s.securityDowngrade = &DowngradeError{Requested: requested & AuthPriv, Received: received & AuthPriv, Err: report}
+}
+
+// SecurityDowngrade returns the downgrade permitted by AllowDowngradeTo
+// that took place on the session, or nil. Received is the effective security
+// level, which MsgFlags has been lowered to.
+func (x *GoSNMP) SecurityDowngrade() *DowngradeError {
+	s := x.shared()
+	if s.securityDowngrade == nil {
+		return nil
+	}
+	d := *s.securityDowngrade
+	return &d
+}
+
+// checkDowngrade rejects a response at a lower security level than the
+// request it answers, unless AcceptDowngradedResponses is set or
+// AllowDowngradeTo permits its level. Reports are exempt: RFC 3412 section
+// 7.1 lets them be sent at noAuthNoPriv.
+func (x *GoSNMP) checkDowngrade(request, response *SnmpPacket) error {
+	if x.AcceptDowngradedResponses || response.PDUType == Report {
+		return nil
+	}
+	if response.MsgFlags&AuthPriv < request.MsgFlags&AuthPriv {
+		if x.downgradeAllowed(response.MsgFlags) {
+			x.Logger.Printf("WARNING response downgraded from %s to %s",
+				request.MsgFlags.SecurityLevel(), response.MsgFlags.SecurityLevel())
+			x.recordDowngrade(request.MsgFlags, response.MsgFlags, nil)
+			return nil
+		}
+		return &DowngradeError{Requested: request.MsgFlags & AuthPriv, Received: response.MsgFlags & AuthPriv}
+	}
+	return nil
+}
+
+// msgFlags returns MsgFlags lowered to the security level requests of the
+// session or any of its views were downgraded to.
+func (x *GoSNMP) msgFlags() SnmpV3MsgFlags {
+	flags := x.MsgFlags
+	if to := atomic.LoadUint32(&x.shared().downgradedTo); to != 0 {
+		if level := SnmpV3MsgFlags(to-1) & AuthPriv; flags&AuthPriv > level {
+			flags = flags&^AuthPriv | level
+		}
+	}
+	return flags
+}
+
+// lowerSecurityLevel returns the next lower security level.
+func lowerSecurityLevel(level SnmpV3MsgFlags) SnmpV3MsgFlags {
+	if level&AuthPriv == AuthPriv {
+		return AuthNoPriv
+	}
+	return NoAuthNoPriv
+}
+
+// downgradeRequest handles an agent reporting that it does not support the
+// security level of packetOut: the request is retransmitted at lower levels
+// permitted by AllowDowngradeTo, otherwise a DowngradeError is returned.
+func (x *GoSNMP) downgradeRequest(packetOut *SnmpPacket, wait bool, result *SnmpPacket, err error) (*SnmpPacket, error) {
+	for {
+		requested := packetOut.MsgFlags & AuthPriv
+		received := NoAuthNoPriv
+		if result != nil {
+			received = result.MsgFlags & AuthPriv
+		}
+		lower := lowerSecurityLevel(requested)
+		if requested == NoAuthNoPriv || !x.downgradeAllowed(lower) {
+			return result, &DowngradeError{Requested: requested, Received: received, Err: err}
+		}
+		x.Logger.Printf("WARNING agent does not support %s, downgrading to %s",
+			requested.SecurityLevel(), lower.SecurityLevel())
+		x.recordDowngrade(requested, lower, err)
+		x.MsgFlags = x.MsgFlags&^AuthPriv | lower
+		atomic.StoreUint32(&x.shared().downgradedTo, uint32(lower)+1)
+		packetOut.MsgFlags = packetOut.MsgFlags&^AuthPriv | lower
+
+		result, err = x.sendOneRequest(packetOut, wait)
+		if err == nil || !errors.Is(err, ErrUnknownSecurityLevel) {
+			return result, err
+		}
+	}
+}
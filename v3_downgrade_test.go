@@ -0,0 +1,230 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// downgradingAgent answers every request with an unauthenticated response.
+func downgradingAgent(t *testing.T, srvr *net.UDPConn, engineID string) {
+	decoder := &GoSNMP{
+		Version:       Version3,
+		SecurityModel: UserSecurityModel,
+		MsgFlags:      AuthNoPriv,
+		SecurityParameters: &UsmSecurityParameters{
+			UserName:                 "user",
+			AuthenticationProtocol:   SHA,
+			AuthenticationPassphrase: "authpassword",
+			AuthoritativeEngineID:    engineID,
+		},
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := srvr.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req, err := decoder.SnmpDecodePacket(buf[:n])
+		if err != nil {
+			t.Errorf("agent decode: %s", err)
+			return
+		}
+		resp := &SnmpPacket{
+			Version:       Version3,
+			MsgFlags:      NoAuthNoPriv,
+			SecurityModel: UserSecurityModel,
+			SecurityParameters: &UsmSecurityParameters{
+				AuthoritativeEngineID:    engineID,
+				AuthoritativeEngineBoots: 1,
+				AuthoritativeEngineTime:  10,
+				UserName:                 "user",
+			},
+			MsgID:           req.MsgID,
+			RequestID:       req.RequestID,
+			ContextEngineID: engineID,
+			PDUType:         GetResponse,
+			Variables:       []SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "spoofed"}},
+		}
+		out, err := resp.MarshalMsg()
+		if err != nil {
+			t.Errorf("agent marshal: %s", err)
+			return
+		}
+		if _, err = srvr.WriteTo(out, addr); err != nil {
+			return
+		}
+	}
+}
+
+func TestRejectDowngradedResponses(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	engineID := authorativeEngineID(t)
+	go downgradingAgent(t, srvr, engineID)
+
+	x := &GoSNMP{
+		Version:       Version3,
+		Target:        srvr.LocalAddr().(*net.UDPAddr).IP.String(),
+		Port:          uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Timeout:       time.Millisecond * 200,
+		MaxOids:       MaxOids,
+		SecurityModel: UserSecurityModel,
+		MsgFlags:      AuthNoPriv,
+		SecurityParameters: &UsmSecurityParameters{
+			UserName:                 "user",
+			AuthenticationProtocol:   SHA,
+			AuthenticationPassphrase: "authpassword",
+			AuthoritativeEngineID:    engineID,
+			AuthoritativeEngineBoots: 1,
+			AuthoritativeEngineTime:  10,
+		},
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.Error(t, err)
+	var derr *DowngradeError
+	require.True(t, errors.As(err, &derr))
+	assert.True(t, errors.Is(err, ErrSecurityDowngrade))
+	assert.Equal(t, AuthNoPriv, derr.Requested)
+	assert.Equal(t, NoAuthNoPriv, derr.Received)
+	assert.Contains(t, err.Error(), "requested authNoPriv, received noAuthNoPriv")
+
+	x.AcceptDowngradedResponses = true
+	result, err := x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, "spoofed", string(result.Variables[0].Value.([]byte)))
+}
+
+// authNoPrivAgent reports usmStatsUnsupportedSecLevels for authPriv requests
+// and answers authNoPriv requests.
+func authNoPrivAgent(t *testing.T, srvr *net.UDPConn, engineID string) {
+	decoder := &GoSNMP{
+		Version:       Version3,
+		SecurityModel: UserSecurityModel,
+		MsgFlags:      AuthPriv,
+		SecurityParameters: &UsmSecurityParameters{
+			UserName:                 "user",
+			AuthenticationProtocol:   SHA,
+			AuthenticationPassphrase: "authpassword",
+			PrivacyProtocol:          AES,
+			PrivacyPassphrase:        "privpassword",
+			AuthoritativeEngineID:    engineID,
+		},
+	}
+	require.NoError(t, decoder.SecurityParameters.(*UsmSecurityParameters).initSecurityKeys())
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := srvr.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req, err := decoder.SnmpDecodePacket(buf[:n])
+		if err != nil {
+			t.Errorf("agent decode: %s", err)
+			return
+		}
+		sp := &UsmSecurityParameters{
+			AuthoritativeEngineID:    engineID,
+			AuthoritativeEngineBoots: 1,
+			AuthoritativeEngineTime:  10,
+			UserName:                 "user",
+			AuthenticationProtocol:   SHA,
+			AuthenticationPassphrase: "authpassword",
+		}
+		require.NoError(t, sp.initSecurityKeys())
+		resp := &SnmpPacket{
+			Version:            Version3,
+			MsgFlags:           AuthNoPriv,
+			SecurityModel:      UserSecurityModel,
+			SecurityParameters: sp,
+			MsgID:              req.MsgID,
+			RequestID:          req.RequestID,
+			ContextEngineID:    engineID,
+			PDUType:            GetResponse,
+			Variables:          []SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "agent"}},
+		}
+		if req.MsgFlags&AuthPriv == AuthPriv {
+			resp.MsgFlags = NoAuthNoPriv
+			resp.PDUType = Report
+			resp.Variables = []SnmpPDU{{Name: usmStatsUnsupportedSecLevels, Type: Counter32, Value: uint32(1)}}
+		}
+		out, err := resp.MarshalMsg()
+		if err != nil {
+			t.Errorf("agent marshal: %s", err)
+			return
+		}
+		if _, err = srvr.WriteTo(out, addr); err != nil {
+			return
+		}
+	}
+}
+
+func TestAllowDowngradeTo(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	engineID := authorativeEngineID(t)
+	go authNoPrivAgent(t, srvr, engineID)
+
+	x := &GoSNMP{
+		Version:       Version3,
+		Target:        srvr.LocalAddr().(*net.UDPAddr).IP.String(),
+		Port:          uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Timeout:       time.Millisecond * 200,
+		MaxOids:       MaxOids,
+		SecurityModel: UserSecurityModel,
+		MsgFlags:      AuthPriv,
+		SecurityParameters: &UsmSecurityParameters{
+			UserName:                 "user",
+			AuthenticationProtocol:   SHA,
+			AuthenticationPassphrase: "authpassword",
+			PrivacyProtocol:          AES,
+			PrivacyPassphrase:        "privpassword",
+			AuthoritativeEngineID:    engineID,
+			AuthoritativeEngineBoots: 1,
+			AuthoritativeEngineTime:  10,
+		},
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	var derr *DowngradeError
+	require.True(t, errors.As(err, &derr))
+	assert.True(t, errors.Is(err, ErrSecurityDowngrade))
+	assert.True(t, errors.Is(err, ErrUnknownSecurityLevel))
+	assert.Equal(t, AuthPriv, derr.Requested)
+	assert.Nil(t, x.SecurityDowngrade())
+	assert.Equal(t, AuthPriv, x.MsgFlags&AuthPriv)
+
+	// the agent answers at authNoPriv, within the allowed levels
+	level := NoAuthNoPriv
+	x.AllowDowngradeTo = &level
+	result, err := x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, "agent", string(result.Variables[0].Value.([]byte)))
+	assert.Equal(t, AuthNoPriv, x.MsgFlags&AuthPriv)
+	d := x.SecurityDowngrade()
+	require.NotNil(t, d)
+	assert.Equal(t, AuthPriv, d.Requested)
+	assert.Equal(t, AuthNoPriv, d.Received)
+	assert.True(t, errors.Is(d, ErrUnknownSecurityLevel))
+
+	// later requests use the effective level right away
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+}
@@ -0,0 +1,156 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// EngineInfo holds the authoritative engine parameters learned from an
+// SNMPv3 agent.
+type EngineInfo struct {
+	EngineID    string
+	EngineBoots uint32
+	EngineTime  uint32
+
+	// Updated is when EngineTime was learned, it is used to advance
+	// EngineTime when the entry is reused.
+	Updated time.Time
+}
+
+// EngineCache shares learned SNMPv3 engine parameters between GoSNMP
+// sessions, keyed by the "host:port" address of the agent, followed by "/"
+// and the hex context engine ID for sessions returned by ForEngine. When
+// GoSNMP.EngineCache is set, a cache hit replaces the discovery exchange and
+// every response updates the cache. Implementations must be safe for
+// concurrent use.
+type EngineCache interface {
+	Get(address string) (EngineInfo, bool)
+	Put(address string, info EngineInfo)
+}
+
+// DiscoveryFailureCache is implemented by EngineCaches remembering the
+// failed discoveries of targets, see GoSNMP.DiscoveryFailureTTL.
+type DiscoveryFailureCache interface {
+	// PutDiscoveryFailure records that the discovery of address failed, not
+	// to be tried again before until.
+	PutDiscoveryFailure(address string, until time.Time)
+
+	// DiscoveryFailure returns until when the discovery of address is not
+	// to be tried again, if it failed recently.
+	DiscoveryFailure(address string) (until time.Time, ok bool)
+}
+
+// MemoryEngineCache is an in-memory EngineCache and DiscoveryFailureCache.
+type MemoryEngineCache struct {
+	mu       sync.RWMutex
+	engines  map[string]EngineInfo
+	failures map[string]time.Time
+}
+
+// NewMemoryEngineCache returns an empty MemoryEngineCache.
+func NewMemoryEngineCache() *MemoryEngineCache {
+	return &MemoryEngineCache{engines: make(map[string]EngineInfo), failures: make(map[string]time.Time)}
+}
+
+// Get returns the engine parameters stored for address.
+func (c *MemoryEngineCache) Get(address string) (EngineInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	info, ok := c.engines[address]
+	return info, ok
+}
+
+// Put stores the engine parameters for address.
+func (c *MemoryEngineCache) Put(address string, info EngineInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.engines[address] = info
+	delete(c.failures, address)
+}
+
+// Delete removes the engine parameters stored for address.
+func (c *MemoryEngineCache) Delete(address string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.engines, address)
+	delete(c.failures, address)
+}
+
+// PutDiscoveryFailure records that the discovery of address failed until
+// until.
+func (c *MemoryEngineCache) PutDiscoveryFailure(address string, until time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failures == nil {
+		c.failures = make(map[string]time.Time)
+	}
+	c.failures[address] = until
+}
+
+// DiscoveryFailure returns until when the discovery of address is not to be
+// tried again.
+func (c *MemoryEngineCache) DiscoveryFailure(address string) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	until, ok := c.failures[address]
+	if ok && !time.Now().Before(until) {
+		delete(c.failures, address)
+		return time.Time{}, false
+	}
+	return until, ok
+}
+
+func (x *GoSNMP) engineCacheAddress() string {
+	return net.JoinHostPort(x.Target, strconv.Itoa(int(x.Port))) + x.engineKeySuffix()
+}
+
+// cachedSecurityParameters returns the engine parameters cached for the
+// target, with the engine time advanced by the time spent in the cache.
+func (x *GoSNMP) cachedSecurityParameters() (*UsmSecurityParameters, bool) {
+	if x.EngineCache == nil || x.SecurityModel != UserSecurityModel {
+		return nil, false
+	}
+	info, ok := x.EngineCache.Get(x.engineCacheAddress())
+	if !ok || info.EngineID == "" {
+		return nil, false
+	}
+	engineTime := info.EngineTime
+	if !info.Updated.IsZero() {
+		if elapsed := time.Since(info.Updated); elapsed > 0 {
+			engineTime += uint32(elapsed / time.Second)
+		}
+	}
+	return &UsmSecurityParameters{
+		AuthoritativeEngineID:    info.EngineID,
+		AuthoritativeEngineBoots: info.EngineBoots,
+		AuthoritativeEngineTime:  engineTime,
+	}, true
+}
+
+func (x *GoSNMP) updateEngineCache(in SnmpV3SecurityParameters) {
+	if x.EngineCache == nil {
+		return
+	}
+	sp, ok := in.(*UsmSecurityParameters)
+	if !ok || sp == nil {
+		return
+	}
+	sp.mu.Lock()
+	info := EngineInfo{
+		EngineID:    sp.AuthoritativeEngineID,
+		EngineBoots: sp.AuthoritativeEngineBoots,
+		EngineTime:  sp.AuthoritativeEngineTime,
+		Updated:     time.Now(),
+	}
+	sp.mu.Unlock()
+	if info.EngineID == "" {
+		return
+	}
+	x.EngineCache.Put(x.engineCacheAddress(), info)
+}
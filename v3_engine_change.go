@@ -0,0 +1,82 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import "time"
+
+// EngineChangeReason tells why the authoritative engine of an agent is
+// considered changed.
+type EngineChangeReason int
+
+const (
+	// EngineReplaced means the agent answered with a different
+	// authoritative engine ID, the device was replaced or reconfigured.
+	EngineReplaced EngineChangeReason = iota + 1
+	// EngineRebooted means the engine boots counter increased, the agent
+	// restarted.
+	EngineRebooted
+)
+
+func (r EngineChangeReason) String() string {
+	switch r {
+	case EngineReplaced:
+		return "replaced"
+	case EngineRebooted:
+		return "rebooted"
+	default:
+		return "unknown"
+	}
+}
+
+// EngineChange describes a change of the authoritative engine of an agent,
+// as passed to GoSNMP.OnEngineChange.
+type EngineChange struct {
+	Reason EngineChangeReason
+	Old    EngineInfo
+	New    EngineInfo
+}
+
+// usmEngineInfo returns the engine parameters of sp, or false when the
+// security model is not USM or no engine has been learned yet.
+func usmEngineInfo(in SnmpV3SecurityParameters) (EngineInfo, bool) {
+	sp, ok := in.(*UsmSecurityParameters)
+	if !ok || sp == nil {
+		return EngineInfo{}, false
+	}
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.AuthoritativeEngineID == "" {
+		return EngineInfo{}, false
+	}
+	return EngineInfo{
+		EngineID:    sp.AuthoritativeEngineID,
+		EngineBoots: sp.AuthoritativeEngineBoots,
+		EngineTime:  sp.AuthoritativeEngineTime,
+	}, true
+}
+
+// engineChange compares the engine parameters known before a response with
+// those of the response. The first discovery of an engine is not a change.
+func engineChange(old SnmpV3SecurityParameters, in SnmpV3SecurityParameters) (EngineChange, bool) {
+	before, ok := usmEngineInfo(old)
+	if !ok {
+		return EngineChange{}, false
+	}
+	after, ok := usmEngineInfo(in)
+	if !ok {
+		return EngineChange{}, false
+	}
+	after.Updated = time.Now()
+	change := EngineChange{Old: before, New: after}
+	switch {
+	case before.EngineID != after.EngineID:
+		change.Reason = EngineReplaced
+	case after.EngineBoots > before.EngineBoots:
+		change.Reason = EngineRebooted
+	default:
+		return EngineChange{}, false
+	}
+	return change, true
+}
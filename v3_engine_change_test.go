@@ -0,0 +1,109 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnEngineChangeRebooted(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	engineID := authorativeEngineID(t)
+	var reports int32
+	startRebootedAgent(t, srvr, engineID, 2, false, &reports)
+
+	var changes []EngineChange
+	x := &GoSNMP{
+		Version:       Version3,
+		Target:        srvr.LocalAddr().(*net.UDPAddr).IP.String(),
+		Port:          uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Timeout:       time.Millisecond * 500,
+		MaxOids:       MaxOids,
+		SecurityModel: UserSecurityModel,
+		MsgFlags:      AuthNoPriv,
+		SecurityParameters: &UsmSecurityParameters{
+			UserName:                 "user",
+			AuthenticationProtocol:   SHA,
+			AuthenticationPassphrase: "authpassword",
+			PrivacyProtocol:          NoPriv,
+			AuthoritativeEngineID:    engineID,
+			AuthoritativeEngineBoots: 1,
+			AuthoritativeEngineTime:  5000,
+		},
+		OnEngineChange: func(_ *GoSNMP, c EngineChange) {
+			changes = append(changes, c)
+		},
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, EngineRebooted, changes[0].Reason)
+	assert.Equal(t, uint32(1), changes[0].Old.EngineBoots)
+	assert.Equal(t, uint32(2), changes[0].New.EngineBoots)
+	assert.Equal(t, engineID, changes[0].New.EngineID)
+
+	// an unchanged engine is not reported again
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Len(t, changes, 1)
+}
+
+func TestOnEngineChangeReplaced(t *testing.T) {
+	response := func(engineID string, boots uint32) *SnmpPacket {
+		return &SnmpPacket{
+			Version:       Version3,
+			SecurityModel: UserSecurityModel,
+			SecurityParameters: &UsmSecurityParameters{
+				AuthoritativeEngineID:    engineID,
+				AuthoritativeEngineBoots: boots,
+				AuthoritativeEngineTime:  100,
+			},
+		}
+	}
+	var changes []EngineChange
+	x := &GoSNMP{
+		Version:       Version3,
+		SecurityModel: UserSecurityModel,
+		MsgFlags:      AuthNoPriv,
+		SecurityParameters: &UsmSecurityParameters{
+			UserName:                 "user",
+			AuthenticationProtocol:   SHA,
+			AuthenticationPassphrase: "authpassword",
+		},
+		OnEngineChange: func(_ *GoSNMP, c EngineChange) {
+			changes = append(changes, c)
+		},
+	}
+
+	// discovery of the first engine is not a change
+	require.NoError(t, x.storeSecurityParameters(response("engine-a", 5)))
+	assert.Empty(t, changes)
+	oldKey := append([]byte(nil), x.SecurityParameters.(*UsmSecurityParameters).SecretKey...)
+
+	// a lower boots counter from the same engine is not a reboot
+	require.NoError(t, x.storeSecurityParameters(response("engine-a", 4)))
+	assert.Empty(t, changes)
+
+	require.NoError(t, x.storeSecurityParameters(response("engine-b", 1)))
+	require.Len(t, changes, 1)
+	assert.Equal(t, EngineReplaced, changes[0].Reason)
+	assert.Equal(t, "engine-a", changes[0].Old.EngineID)
+	assert.Equal(t, "engine-b", changes[0].New.EngineID)
+	assert.Equal(t, "replaced", changes[0].Reason.String())
+
+	// keys are localized to the new engine before the callback
+	assert.NotEqual(t, oldKey, x.SecurityParameters.(*UsmSecurityParameters).SecretKey)
+}
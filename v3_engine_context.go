@@ -0,0 +1,83 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+)
+
+// engineViewIDStride separates the request and message IDs of a view from
+// those of its parent session.
+const engineViewIDStride = 1 << 20
+
+// engineStates holds the SNMPv3 security state of each context engine
+// addressed through ForEngine, shared by a session and its views.
+type engineStates struct {
+	mu     sync.Mutex
+	params map[string]SnmpV3SecurityParameters
+}
+
+// get returns the security state for contextEngineID, seeded from seed the
+// first time the engine is used.
+func (e *engineStates) get(contextEngineID string, seed SnmpV3SecurityParameters) SnmpV3SecurityParameters {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if sp, ok := e.params[contextEngineID]; ok {
+		return sp
+	}
+	sp := seed.Copy()
+	e.params[contextEngineID] = sp
+	return sp
+}
+
+// ForEngine returns a view of the session for requests to the context engine
+// contextEngineID, e.g. one of many devices behind an SNMPv3 proxy agent
+// that share its address. The view uses the connection of x.
+//
+// SNMPv3 security state is kept per context engine: the first view of an
+// engine starts from the state of x, and whatever it learns (the
+// authoritative engine ID, boots and time) is shared by later views of the
+// same engine without affecting x. This covers both proxies that are
+// authoritative themselves (RFC 3413) and middleboxes that pass each device's
+// engine through. A view must not be used concurrently with x or other views
+// of x, and must not be closed separately.
+func (x *GoSNMP) ForEngine(contextEngineID string) *GoSNMP {
+	view := *x
+	view.ContextEngineID = contextEngineID
+	view.engineKey = contextEngineID
+	view.walkLock = nil
+	view.requestID = atomic.AddUint32(&x.requestID, engineViewIDStride)
+	view.msgID = atomic.AddUint32(&x.msgID, engineViewIDStride)
+	if x.engines == nil {
+		x.engines = &engineStates{params: make(map[string]SnmpV3SecurityParameters)}
+		view.engines = x.engines
+	}
+	if x.Version == Version3 && x.SecurityParameters != nil {
+		view.SecurityParameters = x.engines.get(contextEngineID, x.SecurityParameters)
+	}
+	return &view
+}
+
+// EngineSecurityParameters returns the security state kept for a context
+// engine addressed with ForEngine.
+func (x *GoSNMP) EngineSecurityParameters(contextEngineID string) (SnmpV3SecurityParameters, bool) {
+	if x.engines == nil {
+		return nil, false
+	}
+	x.engines.mu.Lock()
+	defer x.engines.mu.Unlock()
+	sp, ok := x.engines.params[contextEngineID]
+	return sp, ok
+}
+
+// engineKeySuffix distinguishes the engine cache entries of views.
+func (x *GoSNMP) engineKeySuffix() string {
+	if x.engineKey == "" {
+		return ""
+	}
+	return "/" + hex.EncodeToString([]byte(x.engineKey))
+}
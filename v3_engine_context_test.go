@@ -0,0 +1,167 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// middleboxAgent fronts several devices, each its own authoritative engine
+// selected by the contextEngineID of the request.
+func middleboxAgent(t *testing.T, srvr *net.UDPConn, boots map[string]uint32, requests *int32) {
+	decoder := &GoSNMP{
+		Version:            Version3,
+		SecurityModel:      UserSecurityModel,
+		MsgFlags:           NoAuthNoPriv,
+		SecurityParameters: &UsmSecurityParameters{UserName: "user"},
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := srvr.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(requests, 1)
+		req, err := decoder.SnmpDecodePacket(buf[:n])
+		if err != nil {
+			t.Errorf("agent decode: %s", err)
+			return
+		}
+		engineID := req.ContextEngineID
+		resp := &SnmpPacket{
+			Version:       Version3,
+			MsgFlags:      NoAuthNoPriv,
+			SecurityModel: UserSecurityModel,
+			SecurityParameters: &UsmSecurityParameters{
+				AuthoritativeEngineID:    engineID,
+				AuthoritativeEngineBoots: boots[engineID],
+				AuthoritativeEngineTime:  100,
+				UserName:                 "user",
+			},
+			MsgID:           req.MsgID,
+			RequestID:       req.RequestID,
+			ContextEngineID: engineID,
+			PDUType:         GetResponse,
+			Variables:       []SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: engineID}},
+		}
+		if req.SecurityParameters.(*UsmSecurityParameters).AuthoritativeEngineID != engineID {
+			resp.PDUType = Report
+			resp.Variables = []SnmpPDU{{Name: usmStatsUnknownEngineIDs, Type: Counter32, Value: uint32(1)}}
+		}
+		out, err := resp.MarshalMsg()
+		if err != nil {
+			t.Errorf("agent marshal: %s", err)
+			return
+		}
+		if _, err = srvr.WriteTo(out, addr); err != nil {
+			return
+		}
+	}
+}
+
+func TestForEngine(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	dev1 := "\x80\x00\x1f\x88\x04dev1"
+	dev2 := "\x80\x00\x1f\x88\x04dev2"
+	var requests int32
+	go middleboxAgent(t, srvr, map[string]uint32{dev1: 5, dev2: 9}, &requests)
+
+	x := &GoSNMP{
+		Target:             "127.0.0.1",
+		Port:               uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Version:            Version3,
+		SecurityModel:      UserSecurityModel,
+		MsgFlags:           NoAuthNoPriv,
+		SecurityParameters: &UsmSecurityParameters{UserName: "user"},
+		Timeout:            time.Second,
+		MaxOids:            MaxOids,
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	get := func(engineID string) {
+		result, err := x.ForEngine(engineID).Get([]string{".1.3.6.1.2.1.1.5.0"})
+		require.NoError(t, err)
+		require.Len(t, result.Variables, 1)
+		assert.Equal(t, []byte(engineID), result.Variables[0].Value)
+	}
+
+	get(dev1)
+	get(dev2)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&requests), "a discovery and a get per engine")
+	get(dev1)
+	assert.Equal(t, int32(5), atomic.LoadInt32(&requests), "engine state is reused")
+
+	for engineID, boots := range map[string]uint32{dev1: 5, dev2: 9} {
+		sp, ok := x.EngineSecurityParameters(engineID)
+		require.True(t, ok)
+		usp := sp.(*UsmSecurityParameters)
+		assert.Equal(t, engineID, usp.AuthoritativeEngineID)
+		assert.Equal(t, boots, usp.AuthoritativeEngineBoots)
+	}
+	assert.Equal(t, "", x.SecurityParameters.(*UsmSecurityParameters).AuthoritativeEngineID)
+	assert.Equal(t, "", x.ContextEngineID)
+}
+
+// contextAgent answers sysName.0 with the context name and engine ID of the
+// request.
+func contextAgent(t *testing.T, srvr *net.UDPConn, engineID string) {
+	decoder := &GoSNMP{
+		Version:            Version3,
+		SecurityModel:      UserSecurityModel,
+		MsgFlags:           NoAuthNoPriv,
+		SecurityParameters: &UsmSecurityParameters{UserName: "user", AuthoritativeEngineID: engineID},
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := srvr.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req, err := decoder.SnmpDecodePacket(buf[:n])
+		if err != nil {
+			t.Errorf("agent decode: %s", err)
+			return
+		}
+		name := ".1.3.6.1.2.1.1.5.0"
+		if req.PDUType == GetNextRequest && req.Variables[0].Name == name {
+			name = ".1.3.6.1.2.1.1.6.0"
+		}
+		resp := &SnmpPacket{
+			Version:       Version3,
+			MsgFlags:      NoAuthNoPriv,
+			SecurityModel: UserSecurityModel,
+			SecurityParameters: &UsmSecurityParameters{
+				AuthoritativeEngineID:    engineID,
+				AuthoritativeEngineBoots: 1,
+				AuthoritativeEngineTime:  10,
+				UserName:                 "user",
+			},
+			MsgID:           req.MsgID,
+			RequestID:       req.RequestID,
+			ContextEngineID: req.ContextEngineID,
+			ContextName:     req.ContextName,
+			PDUType:         GetResponse,
+			Variables:       []SnmpPDU{{Name: name, Type: OctetString, Value: req.ContextName + "@" + req.ContextEngineID}},
+		}
+		out, err := resp.MarshalMsg()
+		if err != nil {
+			t.Errorf("agent marshal: %s", err)
+			return
+		}
+		if _, err = srvr.WriteTo(out, addr); err != nil {
+			return
+		}
+	}
+}
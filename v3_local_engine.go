@@ -0,0 +1,221 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// maxEngineTime is the snmpEngineTime after which the engine time restarts
+// at zero and snmpEngineBoots is incremented, RFC 3414 section 2.2.1.
+const maxEngineTime = 2147483647
+
+// EngineBootsStore persists the snmpEngineBoots of a LocalEngine across
+// restarts of the application. Implementations must be safe for concurrent
+// use.
+type EngineBootsStore interface {
+	// LoadBoots returns the boots last stored for engineID, or 0 if none
+	// were.
+	LoadBoots(engineID string) (uint32, error)
+	StoreBoots(engineID string, boots uint32) error
+}
+
+// FileEngineBootsStore is an EngineBootsStore keeping the boots of each
+// engine in a JSON file, keyed by the hex engine ID. The file is replaced
+// atomically on every update.
+type FileEngineBootsStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileEngineBootsStore returns an EngineBootsStore backed by the file at
+// path, which is created on the first update.
+func NewFileEngineBootsStore(path string) *FileEngineBootsStore {
+	return &FileEngineBootsStore{path: path}
+}
+
+// LoadBoots returns the boots stored for engineID.
+func (s *FileEngineBootsStore) LoadBoots(engineID string) (uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	boots, err := s.read()
+	if err != nil {
+		return 0, err
+	}
+	return boots[hex.EncodeToString([]byte(engineID))], nil
+}
+
+// StoreBoots stores the boots of engineID, keeping those of other engines.
+func (s *FileEngineBootsStore) StoreBoots(engineID string, boots uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.read()
+	if err != nil {
+		return err
+	}
+	all[hex.EncodeToString([]byte(engineID))] = boots
+	data, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (s *FileEngineBootsStore) read() (map[string]uint32, error) {
+	boots := make(map[string]uint32)
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return boots, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &boots); err != nil {
+		return nil, fmt.Errorf("error parsing engine boots file %s: %w", s.path, err)
+	}
+	return boots, nil
+}
+
+// LocalEngine is the SNMPv3 engine of the application itself, for messages
+// it is authoritative for. RFC 3412 makes the sender of a Trap PDU, unlike
+// that of an InformRequest, the authoritative engine: set
+// GoSNMP.LocalEngine to author the engine ID, boots and time of the SNMPv3
+// traps sent by SendTrap instead of setting them in SecurityParameters.
+//
+// The engine time counts the seconds since NewLocalEngine, and the boots
+// are incremented on each NewLocalEngine and whenever the engine time wraps,
+// as RFC 3414 section 2.2.1 requires. Receivers reject messages whose boots
+// go backwards, so the boots must be persisted with an EngineBootsStore for
+// traps to be accepted after the application restarts.
+type LocalEngine struct {
+	engineID string
+	store    EngineBootsStore
+
+	mu    sync.Mutex
+	boots uint32
+	start time.Time
+}
+
+// NewLocalEngine returns the local engine engineID, whose boots are one more
+// than those found in store. A nil store starts the boots at 1 without
+// persisting them, for tests.
+func NewLocalEngine(engineID string, store EngineBootsStore) (*LocalEngine, error) {
+	if _, err := ParseEngineID(engineID); err != nil {
+		return nil, err
+	}
+	e := &LocalEngine{engineID: engineID, store: store, start: time.Now()}
+	if store != nil {
+		boots, err := store.LoadBoots(engineID)
+		if err != nil {
+			return nil, fmt.Errorf("error loading engine boots: %w", err)
+		}
+		e.boots = boots
+	}
+	if err := e.reboot(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// EngineID returns the snmpEngineID of the engine.
+func (e *LocalEngine) EngineID() string {
+	return e.engineID
+}
+
+// Clock returns the snmpEngineBoots and snmpEngineTime of the engine.
+func (e *LocalEngine) Clock() (boots, engineTime uint32, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	elapsed := time.Since(e.start) / time.Second
+	if elapsed > maxEngineTime {
+		e.start = e.start.Add(elapsed * time.Second)
+		if err = e.reboot(); err != nil {
+			return 0, 0, err
+		}
+		elapsed = 0
+	}
+	return e.boots, uint32(elapsed), nil
+}
+
+// reboot increments the boots, which latch at maxEngineBoots, and persists
+// them.
+func (e *LocalEngine) reboot() error {
+	if e.boots < maxEngineBoots {
+		e.boots++
+	}
+	if e.store == nil {
+		return nil
+	}
+	if err := e.store.StoreBoots(e.engineID, e.boots); err != nil {
+		return fmt.Errorf("error storing engine boots: %w", err)
+	}
+	return nil
+}
+
+// authorTrap sets the security parameters of an SNMPv3 Trap PDU to the
+// engine, localizing the keys to it, and defaults its contextEngineID to
+// the engine ID.
+func (e *LocalEngine) authorTrap(packet *SnmpPacket) error {
+	if packet.SecurityModel != UserSecurityModel || packet.SecurityParameters == nil {
+		return fmt.Errorf("a LocalEngine requires UserSecurityModel SecurityParameters")
+	}
+	boots, engineTime, err := e.Clock()
+	if err != nil {
+		return err
+	}
+	if err = packet.SecurityParameters.setSecurityParameters(&UsmSecurityParameters{
+		AuthoritativeEngineID:    e.engineID,
+		AuthoritativeEngineBoots: boots,
+		AuthoritativeEngineTime:  engineTime,
+	}); err != nil {
+		return err
+	}
+	if packet.ContextEngineID == "" {
+		packet.ContextEngineID = e.engineID
+	}
+	return nil
+}
+
+// RandomEngineID returns an RFC 3411 engine ID of the IANA private
+// enterprise number enterprise, in the octets format with 8 random octets,
+// e.g. for an agent without an engine ID of its own.
+func RandomEngineID(enterprise uint32) (string, error) {
+	return Default.RandomEngineID(enterprise)
+}
+
+// RandomEngineID is RandomEngineID with the octets read from the Rand of
+// the session.
+func (x *GoSNMP) RandomEngineID(enterprise uint32) (string, error) {
+	b := make([]byte, 13)
+	binary.BigEndian.PutUint32(b, enterprise|0x80000000)
+	b[4] = byte(EngineIDFormatOctets)
+	if _, err := io.ReadFull(x.randReader(), b[5:]); err != nil {
+		return "", fmt.Errorf("error creating a random engine ID: %w", err)
+	}
+	return string(b), nil
+}
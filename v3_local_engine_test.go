@@ -0,0 +1,134 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalEngineBoots(t *testing.T) {
+	engineID := "\x80\x00\x1f\x88\x04gosnmp"
+	dir, err := ioutil.TempDir("", "gosnmp")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store := NewFileEngineBootsStore(filepath.Join(dir, "boots.json"))
+
+	for want := uint32(1); want <= 3; want++ {
+		e, err := NewLocalEngine(engineID, store)
+		require.NoError(t, err)
+		boots, engineTime, err := e.Clock()
+		require.NoError(t, err)
+		assert.Equal(t, want, boots)
+		assert.Equal(t, uint32(0), engineTime)
+	}
+	other, err := NewLocalEngine("\x80\x00\x1f\x88\x04other", store)
+	require.NoError(t, err)
+	boots, _, err := other.Clock()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), boots)
+
+	// the engine time wraps into the next boot
+	e, err := NewLocalEngine(engineID, store)
+	require.NoError(t, err)
+	e.start = time.Now().Add(-(maxEngineTime + 10) * time.Second)
+	boots, engineTime, err := e.Clock()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(5), boots)
+	assert.Less(t, engineTime, uint32(2))
+	stored, err := store.LoadBoots(engineID)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(5), stored)
+
+	_, err = NewLocalEngine("abc", nil)
+	assert.Error(t, err)
+}
+
+func TestLocalEngineTrap(t *testing.T) {
+	engineID := "\x80\x00\x1f\x88\x04gosnmp"
+	e, err := NewLocalEngine(engineID, nil)
+	require.NoError(t, err)
+	users := NewUsmUserTable()
+	require.NoError(t, users.Add(UsmUser{
+		EngineID:                 engineID,
+		UserName:                 "alice",
+		AuthenticationProtocol:   SHA,
+		AuthenticationPassphrase: "alicepass",
+		PrivacyProtocol:          AES,
+		PrivacyPassphrase:        "alicepriv",
+	}))
+	receiver := &GoSNMP{
+		Version:          Version3,
+		SecurityModel:    UserSecurityModel,
+		MsgFlags:         AuthPriv,
+		UsmUsers:         users,
+		TimelinessWindow: DefaultTimelinessWindow,
+		Logger:           NewLogger(nil),
+	}
+
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+	x := &GoSNMP{
+		Target:        "127.0.0.1",
+		Port:          uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Version:       Version3,
+		Timeout:       time.Second,
+		MaxOids:       MaxOids,
+		SecurityModel: UserSecurityModel,
+		MsgFlags:      AuthPriv,
+		SecurityParameters: &UsmSecurityParameters{
+			UserName:                 "alice",
+			AuthenticationProtocol:   SHA,
+			AuthenticationPassphrase: "alicepass",
+			PrivacyProtocol:          AES,
+			PrivacyPassphrase:        "alicepriv",
+		},
+		LocalEngine: e,
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	_, err = x.SendTrap(SnmpTrap{TrapOID: ".1.3.6.1.6.3.1.1.5.1"})
+	require.NoError(t, err)
+	buf := make([]byte, rxBufSize)
+	require.NoError(t, srvr.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := srvr.ReadFrom(buf)
+	require.NoError(t, err)
+
+	trap := receiver.UnmarshalTrap(buf[:n], false)
+	require.NotNil(t, trap)
+	assert.Equal(t, ".1.3.6.1.6.3.1.1.5.1", trap.TrapOID)
+	assert.Equal(t, engineID, trap.ContextEngineID)
+	assert.False(t, trap.MsgFlags.IsReportable(), "traps are unconfirmed")
+	sp := trap.SecurityParameters.(*UsmSecurityParameters)
+	assert.Equal(t, engineID, sp.AuthoritativeEngineID)
+	assert.Equal(t, uint32(1), sp.AuthoritativeEngineBoots)
+
+	// the session itself is left to the engines it talks to
+	assert.Empty(t, x.SecurityParameters.(*UsmSecurityParameters).AuthoritativeEngineID)
+}
+
+func TestRandomEngineID(t *testing.T) {
+	id, err := RandomEngineID(8072)
+	require.NoError(t, err)
+	require.Len(t, id, 13)
+	assert.Equal(t, "\x80\x00\x1f\x88\x05", id[:5])
+	other, err := RandomEngineID(8072)
+	require.NoError(t, err)
+	assert.NotEqual(t, id, other)
+
+	x := &GoSNMP{Rand: constReader(7)}
+	id, err = x.RandomEngineID(8072)
+	require.NoError(t, err)
+	assert.Equal(t, "\x80\x00\x1f\x88\x05\x07\x07\x07\x07\x07\x07\x07\x07", id, "read from the Rand of the session")
+}
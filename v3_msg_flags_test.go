@@ -0,0 +1,75 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMsgFlagsSecurityLevel(t *testing.T) {
+	for _, tt := range []struct {
+		flags SnmpV3MsgFlags
+		level SecurityLevel
+		str   string
+	}{
+		{NoAuthNoPriv, SecurityLevelNoAuthNoPriv, "noAuthNoPriv"},
+		{AuthNoPriv | Reportable, SecurityLevelAuthNoPriv, "authNoPriv|reportable"},
+		{AuthPriv, SecurityLevelAuthPriv, "authPriv"},
+		{privacyFlag, 0, "SecurityLevel(0)"},
+	} {
+		if got := tt.flags.SecurityLevel(); got != tt.level {
+			t.Errorf("%#x: SecurityLevel() = %v, want %v", uint8(tt.flags), got, tt.level)
+		}
+		if got := tt.flags.String(); got != tt.str {
+			t.Errorf("%#x: String() = %q, want %q", uint8(tt.flags), got, tt.str)
+		}
+		if tt.level != 0 && tt.level.Flags() != tt.flags&AuthPriv {
+			t.Errorf("%v: Flags() = %#x", tt.level, uint8(tt.level.Flags()))
+		}
+	}
+
+	flags := AuthPriv.WithReportable()
+	if !flags.IsReportable() || flags.SecurityLevel() != SecurityLevelAuthPriv {
+		t.Errorf("WithReportable() = %v", flags)
+	}
+	flags = flags.WithSecurityLevel(SecurityLevelAuthNoPriv)
+	if flags != AuthNoPriv|Reportable {
+		t.Errorf("WithSecurityLevel() = %v", flags)
+	}
+}
+
+func TestMsgFlagsValidate(t *testing.T) {
+	for _, flags := range []SnmpV3MsgFlags{NoAuthNoPriv, AuthNoPriv, AuthPriv | Reportable} {
+		if err := flags.Validate(); err != nil {
+			t.Errorf("%v: %v", flags, err)
+		}
+	}
+	if err := (privacyFlag | Reportable).Validate(); !errors.Is(err, ErrInvalidMsgFlags) {
+		t.Errorf("privacy without authentication: %v", err)
+	}
+	if err := SnmpV3MsgFlags(0x8).Validate(); err == nil {
+		t.Error("undefined bits accepted")
+	}
+
+	// rejected when connecting rather than by the agent
+	x := &GoSNMP{
+		Target:        "127.0.0.1",
+		Port:          161,
+		Version:       Version3,
+		SecurityModel: UserSecurityModel,
+		MsgFlags:      privacyFlag,
+		Timeout:       Default.Timeout,
+		MaxOids:       MaxOids,
+		SecurityParameters: &UsmSecurityParameters{
+			UserName:          "user",
+			PrivacyProtocol:   AES,
+			PrivacyPassphrase: "privpassword",
+		},
+	}
+	if err := x.Connect(); !errors.Is(err, ErrInvalidMsgFlags) {
+		t.Errorf("Connect() = %v, want ErrInvalidMsgFlags", err)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+const (
+	// minMsgMaxSize is the smallest msgMaxSize allowed by RFC 3412, smaller
+	// advertised sizes are ignored.
+	minMsgMaxSize = 484
+
+	// bulkMsgOverhead estimates the size of a GetBulk response without its
+	// variables: message header, security parameters and PDU header.
+	bulkMsgOverhead = 160
+
+	// bulkVarbindEstimate estimates the size of a returned variable beyond
+	// the encoding of the requested OID: the instance sub-identifiers, the
+	// value and the BER headers.
+	bulkVarbindEstimate = 48
+)
+
+// ErrMessageTooLarge is wrapped by MessageTooLargeError.
+var ErrMessageTooLarge = errors.New("message exceeds the msgMaxSize of the agent")
+
+// MessageTooLargeError is returned for a request that does not fit the
+// msgMaxSize advertised by an SNMPv3 agent, see AgentMsgMaxSize.
+type MessageTooLargeError struct {
+	Size    int
+	MaxSize int
+}
+
+func (e *MessageTooLargeError) Error() string {
+	return fmt.Sprintf("%s: %d bytes, agent accepts %d", ErrMessageTooLarge, e.Size, e.MaxSize)
+}
+
+func (e *MessageTooLargeError) Unwrap() error {
+	return ErrMessageTooLarge
+}
+
+// AgentMsgMaxSize returns the msgMaxSize the SNMPv3 agent advertised in its
+// last message, or 0 if unknown. Requests larger than it fail with a
+// MessageTooLargeError, and GetBulk max-repetitions are lowered so that
+// responses are expected to fit.
+func (x *GoSNMP) AgentMsgMaxSize() uint32 {
+	return atomic.LoadUint32(&x.shared().agentMsgMaxSize)
+}
+
+// recordAgentMsgMaxSize keeps the msgMaxSize of a message from the agent.
+func (x *GoSNMP) recordAgentMsgMaxSize(result *SnmpPacket) {
+	if result.MsgMaxSize >= minMsgMaxSize {
+		atomic.StoreUint32(&x.shared().agentMsgMaxSize, result.MsgMaxSize)
+	}
+}
+
+// checkMsgMaxSize rejects an encoded request the agent cannot accept.
+func (x *GoSNMP) checkMsgMaxSize(out []byte) error {
+	if max := x.AgentMsgMaxSize(); max != 0 && uint32(len(out)) > max {
+		return &MessageTooLargeError{Size: len(out), MaxSize: int(max)}
+	}
+	return nil
+}
+
+// capMaxRepetitions lowers maxRepetitions so that a GetBulk response for
+// pdus is expected to fit the msgMaxSize of the agent and the PathMaxSize of
+// the target. At least one repetition is kept.
+func (x *GoSNMP) capMaxRepetitions(pdus []SnmpPDU, nonRepeaters uint8, maxRepetitions uint32) uint32 {
+	limit := x.responseSizeLimit()
+	repeaters := len(pdus) - int(nonRepeaters)
+	if limit == 0 || maxRepetitions <= 1 || repeaters <= 0 {
+		return maxRepetitions
+	}
+	fixed, perRepetition := bulkResponseSizes(pdus, nonRepeaters)
+	fit := (int(limit) - fixed) / perRepetition
+	if fit < 1 {
+		fit = 1
+	}
+	if uint32(fit) < maxRepetitions {
+		x.Logger.Printf("GetBulk max-repetitions lowered from %d to %d for msgMaxSize %d",
+			maxRepetitions, fit, limit)
+		return uint32(fit)
+	}
+	return maxRepetitions
+}
+
+// responseSizeLimit is the size responses are expected to fit, the smaller
+// of AgentMsgMaxSize and PathMaxSize, or 0 if neither is known.
+func (x *GoSNMP) responseSizeLimit() uint32 {
+	limit := x.AgentMsgMaxSize()
+	if path := x.PathMaxSize(); path != 0 && (limit == 0 || path < limit) {
+		limit = path
+	}
+	return limit
+}
+
+// bulkResponseSizes estimates the size of a GetBulk response for pdus as a
+// fixed part, including the non-repeaters, and a part per repetition.
+func bulkResponseSizes(pdus []SnmpPDU, nonRepeaters uint8) (fixed, perRepetition int) {
+	size := func(pdu SnmpPDU) int {
+		oid, err := marshalObjectIdentifier(pdu.Name)
+		if err != nil {
+			return bulkVarbindEstimate
+		}
+		return len(oid) + bulkVarbindEstimate
+	}
+	fixed = bulkMsgOverhead
+	for i, pdu := range pdus {
+		if i < int(nonRepeaters) {
+			fixed += size(pdu)
+		} else {
+			perRepetition += size(pdu)
+		}
+	}
+	return fixed, perRepetition
+}
@@ -0,0 +1,112 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smallAgent advertises the minimum msgMaxSize and records the
+// max-repetitions of GetBulk requests.
+func smallAgent(t *testing.T, srvr *net.UDPConn, engineID string, maxRepetitions *uint32) {
+	decoder := &GoSNMP{
+		Version:            Version3,
+		SecurityModel:      UserSecurityModel,
+		MsgFlags:           NoAuthNoPriv,
+		SecurityParameters: &UsmSecurityParameters{UserName: "user", AuthoritativeEngineID: engineID},
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := srvr.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req, err := decoder.SnmpDecodePacket(buf[:n])
+		if err != nil {
+			t.Errorf("agent decode: %s", err)
+			return
+		}
+		if req.PDUType == GetBulkRequest {
+			atomic.StoreUint32(maxRepetitions, req.MaxRepetitions)
+		}
+		resp := &SnmpPacket{
+			Version:       Version3,
+			MsgFlags:      NoAuthNoPriv,
+			MsgMaxSize:    minMsgMaxSize,
+			SecurityModel: UserSecurityModel,
+			SecurityParameters: &UsmSecurityParameters{
+				AuthoritativeEngineID:    engineID,
+				AuthoritativeEngineBoots: 1,
+				AuthoritativeEngineTime:  10,
+				UserName:                 "user",
+			},
+			MsgID:           req.MsgID,
+			RequestID:       req.RequestID,
+			ContextEngineID: engineID,
+			PDUType:         GetResponse,
+			Variables:       []SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "agent"}},
+		}
+		out, err := resp.MarshalMsg()
+		if err != nil {
+			t.Errorf("agent marshal: %s", err)
+			return
+		}
+		if _, err = srvr.WriteTo(out, addr); err != nil {
+			return
+		}
+	}
+}
+
+func TestAgentMsgMaxSize(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	engineID := authorativeEngineID(t)
+	var maxRepetitions uint32
+	go smallAgent(t, srvr, engineID, &maxRepetitions)
+
+	x := &GoSNMP{
+		Version:            Version3,
+		Target:             srvr.LocalAddr().(*net.UDPAddr).IP.String(),
+		Port:               uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Timeout:            time.Millisecond * 500,
+		MaxOids:            MaxOids,
+		SecurityModel:      UserSecurityModel,
+		MsgFlags:           NoAuthNoPriv,
+		SecurityParameters: &UsmSecurityParameters{UserName: "user"},
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	// learned on discovery
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(minMsgMaxSize), x.AgentMsgMaxSize())
+
+	_, err = x.GetBulk([]string{".1.3.6.1.2.1.2.2.1.2"}, 0, 50)
+	require.NoError(t, err)
+	got := atomic.LoadUint32(&maxRepetitions)
+	assert.Less(t, got, uint32(50))
+	assert.GreaterOrEqual(t, got, uint32(1))
+
+	oids := make([]string, MaxOids)
+	for i := range oids {
+		oids[i] = ".1.3.6.1.4.1.9.9.999.1.2.3.4.5.6.7.8.9.10.11.12.13.14.15"
+	}
+	_, err = x.Get(oids)
+	var tooLarge *MessageTooLargeError
+	require.True(t, errors.As(err, &tooLarge))
+	assert.True(t, errors.Is(err, ErrMessageTooLarge))
+	assert.Equal(t, minMsgMaxSize, tooLarge.MaxSize)
+	assert.Greater(t, tooLarge.Size, minMsgMaxSize)
+}
@@ -0,0 +1,94 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNoAuthNoPrivValidation(t *testing.T) {
+	// protocols without passphrases are ignored below their level
+	sp := &UsmSecurityParameters{UserName: "user", AuthenticationProtocol: SHA, PrivacyProtocol: AES}
+	require.NoError(t, sp.validate(NoAuthNoPriv))
+	require.NoError(t, sp.initSecurityKeys())
+	assert.Empty(t, sp.SecretKey)
+	assert.Empty(t, sp.PrivacyKey)
+	assert.Error(t, sp.validate(AuthNoPriv))
+	assert.Error(t, sp.validate(AuthPriv))
+
+	sp.AuthenticationPassphrase = "authpassword"
+	assert.NoError(t, sp.validate(AuthNoPriv))
+	assert.Error(t, sp.validate(AuthPriv))
+
+	assert.Error(t, (&UsmSecurityParameters{}).validate(NoAuthNoPriv))
+}
+
+func TestNoAuthNoPrivUserNameOnly(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	engineID := "\x80\x00\x00\x09\x03agent"
+	go contextAgent(t, srvr, engineID)
+
+	// no engine parameters, the first request discovers them
+	x := &GoSNMP{
+		Version:            Version3,
+		Target:             srvr.LocalAddr().(*net.UDPAddr).IP.String(),
+		Port:               uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Timeout:            time.Millisecond * 500,
+		SecurityModel:      UserSecurityModel,
+		MsgFlags:           NoAuthNoPriv,
+		SecurityParameters: &UsmSecurityParameters{UserName: "user"},
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	result, err := x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, GetResponse, result.PDUType)
+	assert.Equal(t, "@"+engineID, string(result.Variables[0].Value.([]byte)))
+	sp := x.SecurityParameters.(*UsmSecurityParameters)
+	assert.Equal(t, engineID, sp.AuthoritativeEngineID)
+	assert.Empty(t, sp.SecretKey)
+}
+
+func TestNoAuthNoPrivDecodeWithoutSecurityParameters(t *testing.T) {
+	msg, err := (&SnmpPacket{
+		Version:       Version3,
+		MsgFlags:      NoAuthNoPriv,
+		SecurityModel: UserSecurityModel,
+		SecurityParameters: &UsmSecurityParameters{
+			UserName:                 "user",
+			AuthoritativeEngineID:    "\x80\x00\x00\x09\x03agent",
+			AuthoritativeEngineBoots: 3,
+		},
+		MsgID:     7,
+		RequestID: 8,
+		PDUType:   SNMPv2Trap,
+		Variables: []SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "agent"}},
+	}).MarshalMsg()
+	require.NoError(t, err)
+
+	x := &GoSNMP{Version: Version3, SecurityModel: UserSecurityModel}
+	packet, err := x.SnmpDecodePacket(msg)
+	require.NoError(t, err)
+	assert.Equal(t, SNMPv2Trap, packet.PDUType)
+	assert.Equal(t, "user", packet.SecurityParameters.(*UsmSecurityParameters).UserName)
+	require.Len(t, packet.Variables, 1)
+
+	// sending still needs a UserName
+	x.Target = "127.0.0.1"
+	x.Port = 161
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,76 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSecurityParametersConcurrentUpdate stores engine updates while other
+// goroutines build, marshal and inspect packets from the same security
+// parameters; run with -race. ContextEngineID is preset since GoSNMP's own
+// fields are not synchronized, only its security parameters.
+func TestSecurityParametersConcurrentUpdate(t *testing.T) {
+	x := &GoSNMP{
+		Version:         Version3,
+		SecurityModel:   UserSecurityModel,
+		MsgFlags:        AuthPriv,
+		ContextEngineID: "engine-a",
+		SecurityParameters: &UsmSecurityParameters{
+			UserName:                 "user",
+			AuthenticationProtocol:   SHA,
+			AuthenticationPassphrase: "authpassword",
+			PrivacyProtocol:          AES,
+			PrivacyPassphrase:        "privpassword",
+			AuthoritativeEngineID:    "engine-a",
+		},
+	}
+	require.NoError(t, x.validateParameters())
+	require.NoError(t, x.SecurityParameters.initSecurityKeys())
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			engineID := "engine-a"
+			if i%50 == 49 {
+				engineID = "engine-b"
+			}
+			err := x.storeSecurityParameters(&SnmpPacket{
+				Version:       Version3,
+				SecurityModel: UserSecurityModel,
+				SecurityParameters: &UsmSecurityParameters{
+					AuthoritativeEngineID:    engineID,
+					AuthoritativeEngineBoots: uint32(i),
+					AuthoritativeEngineTime:  uint32(i),
+				},
+			})
+			assert.NoError(t, err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			packet := x.mkSnmpPacket(GetRequest, []SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: Null}}, 0, 0)
+			assert.NoError(t, x.updatePktSecurityParameters(packet))
+			_, err := packet.marshalMsg()
+			assert.NoError(t, err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			_ = x.SecurityParameters.Description()
+			_ = x.SecurityParameters.getDefaultContextEngineID()
+			x.updateEngineCache(x.SecurityParameters)
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,208 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// SecurityModelPlugin is an SNMPv3 security model registered with
+// RegisterSecurityModel. The per message processing is done by the
+// SnmpV3SecurityParameters of the model.
+type SecurityModelPlugin interface {
+	// Configure validates, and may complete, the configuration of x before
+	// it is used with the security model.
+	Configure(x *GoSNMP) error
+
+	// NewSecurityParameters returns empty security parameters, used to
+	// decode messages of the model when none are configured.
+	NewSecurityParameters(log Logger) SnmpV3SecurityParameters
+}
+
+// securityModels maps msgSecurityModel values to their implementation
+//
+//nolint:gochecknoglobals
+var securityModels = struct {
+	sync.RWMutex
+	m map[SnmpV3SecurityModel]SecurityModelPlugin
+}{m: map[SnmpV3SecurityModel]SecurityModelPlugin{
+	UserSecurityModel:      usmPlugin{},
+	TransportSecurityModel: tsmPlugin{},
+}}
+
+// RegisterSecurityModel makes a security model available to all GoSNMP
+// sessions, replacing any implementation registered for model before. It
+// is typically called from an init function.
+func RegisterSecurityModel(model SnmpV3SecurityModel, plugin SecurityModelPlugin) {
+	securityModels.Lock()
+	defer securityModels.Unlock()
+	securityModels.m[model] = plugin
+}
+
+func lookupSecurityModel(model SnmpV3SecurityModel) (SecurityModelPlugin, bool) {
+	securityModels.RLock()
+	defer securityModels.RUnlock()
+	plugin, ok := securityModels.m[model]
+	return plugin, ok
+}
+
+type usmPlugin struct{}
+
+func (usmPlugin) Configure(x *GoSNMP) error {
+	return nil
+}
+
+func (usmPlugin) NewSecurityParameters(log Logger) SnmpV3SecurityParameters {
+	return &UsmSecurityParameters{Logger: log}
+}
+
+type tsmPlugin struct{}
+
+func (tsmPlugin) Configure(x *GoSNMP) error {
+	if !x.isTLSTransport() && !x.isDTLSTransport() {
+		return errors.New("the SNMPV3 Transport Security Model requires the tls or dtlsudp transport")
+	}
+	if x.ContextEngineID == "" {
+		x.ContextEngineID = localEngineID
+	}
+	return nil
+}
+
+func (tsmPlugin) NewSecurityParameters(log Logger) SnmpV3SecurityParameters {
+	return &TsmSecurityParameters{Logger: log}
+}
+
+// SecurityParametersPlugin is implemented by the security parameters of a
+// security model outside this package, and adapted to
+// SnmpV3SecurityParameters with WrapSecurityParameters. The methods match
+// those of SnmpV3SecurityParameters.
+type SecurityParametersPlugin interface {
+	Log()
+	Copy() SecurityParametersPlugin
+	Description() string
+
+	// Validate checks the parameters for use with the message flags.
+	Validate(flags SnmpV3MsgFlags) error
+	// Init sets the logger and prepares the parameters for use.
+	Init(log Logger) error
+	// InitSecurityKeys derives any keys from the configured secrets.
+	InitSecurityKeys() error
+	// InitPacket prepares the parameters of an outgoing packet, e.g.
+	// choosing a salt.
+	InitPacket(packet *SnmpPacket) error
+	// DiscoveryRequired returns a discovery request to send before the
+	// first request, or nil.
+	DiscoveryRequired() *SnmpPacket
+	// DefaultContextEngineID is used when no ContextEngineID is set.
+	DefaultContextEngineID() string
+	// SetSecurityParameters updates the parameters from those of a
+	// received message.
+	SetSecurityParameters(in SecurityParametersPlugin) error
+
+	// Marshal returns the content of msgSecurityParameters.
+	Marshal(flags SnmpV3MsgFlags) ([]byte, error)
+	// Unmarshal decodes msgSecurityParameters, starting at cursor which
+	// points past the OCTET STRING header, and returns the new cursor.
+	Unmarshal(flags SnmpV3MsgFlags, packet []byte, cursor int) (int, error)
+	// Authenticate signs a marshalled message in place.
+	Authenticate(packet []byte) error
+	// IsAuthentic verifies a received message.
+	IsAuthentic(packetBytes []byte, packet *SnmpPacket) (bool, error)
+	// EncryptPacket encrypts a marshalled scopedPDU.
+	EncryptPacket(scopedPdu []byte) ([]byte, error)
+	// DecryptPacket decrypts the scopedPDU of packet at cursor and returns
+	// the whole message with the plain text scopedPDU.
+	DecryptPacket(packet []byte, cursor int) ([]byte, error)
+}
+
+// WrapSecurityParameters adapts the parameters of an external security
+// model for use as GoSNMP.SecurityParameters.
+func WrapSecurityParameters(p SecurityParametersPlugin) SnmpV3SecurityParameters {
+	return &pluginSecurityParameters{p: p}
+}
+
+// UnwrapSecurityParameters returns the parameters wrapped by
+// WrapSecurityParameters, e.g. from a decoded SnmpPacket.
+func UnwrapSecurityParameters(sp SnmpV3SecurityParameters) (SecurityParametersPlugin, bool) {
+	w, ok := sp.(*pluginSecurityParameters)
+	if !ok {
+		return nil, false
+	}
+	return w.p, true
+}
+
+type pluginSecurityParameters struct {
+	p SecurityParametersPlugin
+}
+
+func (w *pluginSecurityParameters) Log() {
+	w.p.Log()
+}
+
+func (w *pluginSecurityParameters) Copy() SnmpV3SecurityParameters {
+	return &pluginSecurityParameters{p: w.p.Copy()}
+}
+
+func (w *pluginSecurityParameters) Description() string {
+	return w.p.Description()
+}
+
+func (w *pluginSecurityParameters) validate(flags SnmpV3MsgFlags) error {
+	return w.p.Validate(flags)
+}
+
+func (w *pluginSecurityParameters) init(log Logger) error {
+	return w.p.Init(log)
+}
+
+func (w *pluginSecurityParameters) initPacket(packet *SnmpPacket) error {
+	return w.p.InitPacket(packet)
+}
+
+func (w *pluginSecurityParameters) discoveryRequired() *SnmpPacket {
+	return w.p.DiscoveryRequired()
+}
+
+func (w *pluginSecurityParameters) getDefaultContextEngineID() string {
+	return w.p.DefaultContextEngineID()
+}
+
+func (w *pluginSecurityParameters) setSecurityParameters(in SnmpV3SecurityParameters) error {
+	other, ok := in.(*pluginSecurityParameters)
+	if !ok {
+		return fmt.Errorf("param SnmpV3SecurityParameters is not a wrapped SecurityParametersPlugin")
+	}
+	return w.p.SetSecurityParameters(other.p)
+}
+
+func (w *pluginSecurityParameters) marshal(flags SnmpV3MsgFlags) ([]byte, error) {
+	return w.p.Marshal(flags)
+}
+
+func (w *pluginSecurityParameters) unmarshal(flags SnmpV3MsgFlags, packet []byte, cursor int) (int, error) {
+	return w.p.Unmarshal(flags, packet, cursor)
+}
+
+func (w *pluginSecurityParameters) authenticate(packet []byte) error {
+	return w.p.Authenticate(packet)
+}
+
+func (w *pluginSecurityParameters) isAuthentic(packetBytes []byte, packet *SnmpPacket) (bool, error) {
+	return w.p.IsAuthentic(packetBytes, packet)
+}
+
+func (w *pluginSecurityParameters) encryptPacket(flags SnmpV3MsgFlags, scopedPdu []byte) ([]byte, error) {
+	return w.p.EncryptPacket(scopedPdu)
+}
+
+func (w *pluginSecurityParameters) decryptPacket(flags SnmpV3MsgFlags, packet []byte, cursor int) ([]byte, error) {
+	return w.p.DecryptPacket(packet, cursor)
+}
+
+func (w *pluginSecurityParameters) initSecurityKeys() error {
+	return w.p.InitSecurityKeys()
+}
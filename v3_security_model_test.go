@@ -0,0 +1,117 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tokenSecurityModel SnmpV3SecurityModel = 200
+
+// tokenParams is a toy security model sending a shared token as its
+// msgSecurityParameters, standing in for a third party implementation.
+type tokenParams struct {
+	Token    string
+	received string
+}
+
+func (p *tokenParams) Log()                                     {}
+func (p *tokenParams) Copy() SecurityParametersPlugin           { c := *p; return &c }
+func (p *tokenParams) Description() string                      { return "token" }
+func (p *tokenParams) Validate(flags SnmpV3MsgFlags) error      { return nil }
+func (p *tokenParams) Init(log Logger) error                    { return nil }
+func (p *tokenParams) InitSecurityKeys() error                  { return nil }
+func (p *tokenParams) InitPacket(packet *SnmpPacket) error      { return nil }
+func (p *tokenParams) DiscoveryRequired() *SnmpPacket           { return nil }
+func (p *tokenParams) DefaultContextEngineID() string           { return "" }
+func (p *tokenParams) Authenticate(packet []byte) error         { return nil }
+func (p *tokenParams) EncryptPacket(pdu []byte) ([]byte, error) { return pdu, nil }
+
+func (p *tokenParams) DecryptPacket(packet []byte, cursor int) ([]byte, error) {
+	return packet, nil
+}
+
+func (p *tokenParams) SetSecurityParameters(in SecurityParametersPlugin) error {
+	return nil
+}
+
+func (p *tokenParams) Marshal(flags SnmpV3MsgFlags) ([]byte, error) {
+	return []byte(p.Token), nil
+}
+
+func (p *tokenParams) Unmarshal(flags SnmpV3MsgFlags, packet []byte, cursor int) (int, error) {
+	// the OCTET STRING length precedes cursor, single octet in this test
+	n := int(packet[cursor-1])
+	p.received = string(packet[cursor : cursor+n])
+	return cursor + n, nil
+}
+
+func (p *tokenParams) IsAuthentic(packetBytes []byte, packet *SnmpPacket) (bool, error) {
+	in, ok := UnwrapSecurityParameters(packet.SecurityParameters)
+	if !ok {
+		return false, errors.New("not token parameters")
+	}
+	return in.(*tokenParams).received == p.Token, nil
+}
+
+type tokenModel struct{}
+
+func (tokenModel) Configure(x *GoSNMP) error {
+	if _, ok := UnwrapSecurityParameters(x.SecurityParameters); !ok {
+		return errors.New("token model needs token parameters")
+	}
+	return nil
+}
+
+func (tokenModel) NewSecurityParameters(log Logger) SnmpV3SecurityParameters {
+	return WrapSecurityParameters(&tokenParams{})
+}
+
+func TestRegisterSecurityModel(t *testing.T) {
+	x := &GoSNMP{
+		Version:            Version3,
+		SecurityModel:      tokenSecurityModel,
+		MsgFlags:           AuthNoPriv,
+		SecurityParameters: WrapSecurityParameters(&tokenParams{Token: "s3cret"}),
+	}
+	_, err := x.SnmpEncodePacket(GetRequest, []SnmpPDU{{Name: ".1.3.6.1.2.1.1.1.0", Type: Null}}, 0, 0)
+	require.Error(t, err, "unregistered model")
+
+	RegisterSecurityModel(tokenSecurityModel, tokenModel{})
+	defer func() {
+		securityModels.Lock()
+		delete(securityModels.m, tokenSecurityModel)
+		securityModels.Unlock()
+	}()
+
+	out, err := x.SnmpEncodePacket(GetRequest, []SnmpPDU{{Name: ".1.3.6.1.2.1.1.1.0", Type: Null}}, 0, 0)
+	require.NoError(t, err)
+
+	packet, err := x.SnmpDecodePacket(out)
+	require.NoError(t, err)
+	assert.Equal(t, tokenSecurityModel, packet.SecurityModel)
+	assert.Equal(t, ".1.3.6.1.2.1.1.1.0", packet.Variables[0].Name)
+	sp, ok := UnwrapSecurityParameters(packet.SecurityParameters)
+	require.True(t, ok)
+	assert.Equal(t, "s3cret", sp.(*tokenParams).received)
+
+	// the trap path authenticates messages of any model
+	assert.NotNil(t, x.UnmarshalTrap(out, false))
+	wrong := &GoSNMP{
+		Version:            Version3,
+		SecurityModel:      tokenSecurityModel,
+		MsgFlags:           AuthNoPriv,
+		SecurityParameters: WrapSecurityParameters(&tokenParams{Token: "other"}),
+	}
+	assert.Nil(t, wrong.UnmarshalTrap(out, false))
+
+	x.SecurityParameters = &UsmSecurityParameters{}
+	_, err = x.SnmpEncodePacket(GetRequest, nil, 0, 0)
+	assert.Error(t, err, "Configure rejects foreign parameters")
+}
@@ -0,0 +1,170 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tcpAgent answers SNMPv3 requests of user over TCP, one connection at a
+// time. The first stall responses only send their first bytes.
+func tcpAgent(t *testing.T, ln net.Listener, user *UsmSecurityParameters, stall int) {
+	decoder := &GoSNMP{Version: Version3, SecurityModel: UserSecurityModel, MsgFlags: AuthPriv, SecurityParameters: user.Copy()}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		for {
+			msg, err := readBERMessage(conn, rxBufSize)
+			if err != nil {
+				conn.Close()
+				break
+			}
+			req, err := decoder.SnmpDecodePacket(msg)
+			if err != nil {
+				t.Errorf("agent decode: %s", err)
+				conn.Close()
+				return
+			}
+			vars := make([]SnmpPDU, len(req.Variables))
+			for i, v := range req.Variables {
+				vars[i] = SnmpPDU{Name: v.Name, Type: OctetString, Value: []byte("over tcp")}
+			}
+			resp := &SnmpPacket{
+				Version:            Version3,
+				MsgFlags:           AuthPriv,
+				SecurityModel:      UserSecurityModel,
+				SecurityParameters: user.Copy(),
+				MsgID:              req.MsgID,
+				RequestID:          req.RequestID,
+				ContextEngineID:    user.AuthoritativeEngineID,
+				PDUType:            GetResponse,
+				Variables:          vars,
+			}
+			require.NoError(t, resp.SecurityParameters.initPacket(resp))
+			out, err := resp.MarshalMsg()
+			if err != nil {
+				t.Errorf("agent marshal: %s", err)
+				conn.Close()
+				return
+			}
+			if stall > 0 {
+				stall--
+				_, _ = conn.Write(out[:10])
+				continue
+			}
+			// split the message across segments
+			for len(out) > 0 {
+				n := 7
+				if n > len(out) {
+					n = len(out)
+				}
+				if _, err = conn.Write(out[:n]); err != nil {
+					break
+				}
+				out = out[n:]
+			}
+		}
+	}
+}
+
+func TestV3OverTCP(t *testing.T) {
+	for _, stall := range []int{0, 1} {
+		ln, err := net.Listen("tcp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		user := &UsmSecurityParameters{
+			UserName:                 "user",
+			AuthenticationProtocol:   SHA,
+			AuthenticationPassphrase: "authpassword",
+			PrivacyProtocol:          AES,
+			PrivacyPassphrase:        "privpassword",
+			AuthoritativeEngineID:    authorativeEngineID(t),
+			AuthoritativeEngineBoots: 1,
+			AuthoritativeEngineTime:  10,
+		}
+		require.NoError(t, user.initSecurityKeys())
+		go tcpAgent(t, ln, user, stall)
+
+		x := &GoSNMP{
+			Target:             "127.0.0.1",
+			Port:               uint16(ln.Addr().(*net.TCPAddr).Port),
+			Transport:          "tcp",
+			Version:            Version3,
+			Timeout:            200 * time.Millisecond,
+			Retries:            1,
+			MaxOids:            MaxOids,
+			SecurityModel:      UserSecurityModel,
+			MsgFlags:           AuthPriv,
+			SecurityParameters: user.Copy(),
+		}
+		require.NoError(t, x.Connect())
+
+		// a stalled, partial response is dropped with its connection
+		for i := 0; i < 2; i++ {
+			result, err := x.Get([]string{".1.3.6.1.2.1.1.1.0"})
+			require.NoError(t, err, "stall %d request %d", stall, i)
+			require.Len(t, result.Variables, 1)
+			assert.Equal(t, []byte("over tcp"), result.Variables[0].Value)
+		}
+		x.Conn.Close()
+		ln.Close()
+	}
+}
+
+func TestV3OverTCPViewReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	user := &UsmSecurityParameters{
+		UserName:                 "user",
+		AuthenticationProtocol:   SHA,
+		AuthenticationPassphrase: "authpassword",
+		PrivacyProtocol:          AES,
+		PrivacyPassphrase:        "privpassword",
+		AuthoritativeEngineID:    authorativeEngineID(t),
+		AuthoritativeEngineBoots: 1,
+		AuthoritativeEngineTime:  10,
+	}
+	require.NoError(t, user.initSecurityKeys())
+	go tcpAgent(t, ln, user, 1)
+
+	x := &GoSNMP{
+		Target:             "127.0.0.1",
+		Port:               uint16(ln.Addr().(*net.TCPAddr).Port),
+		Transport:          "tcp",
+		Version:            Version3,
+		Timeout:            200 * time.Millisecond,
+		Retries:            1,
+		MaxOids:            MaxOids,
+		SecurityModel:      UserSecurityModel,
+		MsgFlags:           AuthPriv,
+		SecurityParameters: user.Copy(),
+	}
+	require.NoError(t, x.Connect())
+	defer func() { x.Conn.Close() }()
+	first := x.Conn
+	view := x.WithOptions(WithTimeout(300 * time.Millisecond))
+
+	// the view drops the stalled connection, the session uses the new one
+	_, err = view.Get([]string{".1.3.6.1.2.1.1.1.0"})
+	require.NoError(t, err)
+	assert.NotEqual(t, first, x.Conn)
+	result, err := x.Get([]string{".1.3.6.1.2.1.1.1.0"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("over tcp"), result.Variables[0].Value)
+
+	// what the view learns about the agent applies to the session
+	view.recordAgentMsgMaxSize(&SnmpPacket{MsgMaxSize: 1500})
+	assert.Equal(t, uint32(1500), x.AgentMsgMaxSize())
+	atomic.StoreUint32(&view.shared().downgradedTo, uint32(AuthNoPriv)+1)
+	assert.Equal(t, AuthNoPriv, x.msgFlags()&AuthPriv)
+}
@@ -0,0 +1,109 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultTimelinessWindow is the USM time window of RFC 3414 section 3.2.
+const DefaultTimelinessWindow = 150 * time.Second
+
+// maxEngineBoots is the snmpEngineBoots value after which an engine must be
+// reconfigured, messages carrying it are never timely.
+const maxEngineBoots = 2147483647
+
+// TimelinessError is returned for an authenticated message outside the time
+// window of its authoritative engine, e.g. a replayed message. It wraps
+// ErrNotInTimeWindow.
+type TimelinessError struct {
+	EngineID string
+	Boots    uint32
+	Time     uint32
+
+	// LatestBoots and EstimatedTime are the local notion of the engine's
+	// clock the message was checked against.
+	LatestBoots   uint32
+	EstimatedTime uint32
+}
+
+func (e *TimelinessError) Error() string {
+	return fmt.Sprintf("%s: engine %x sent boots %d time %d, expected boots %d time around %d",
+		ErrNotInTimeWindow, []byte(e.EngineID), e.Boots, e.Time, e.LatestBoots, e.EstimatedTime)
+}
+
+func (e *TimelinessError) Unwrap() error {
+	return ErrNotInTimeWindow
+}
+
+// engineClock is the latest boots and time received from an engine, and
+// when they were received.
+type engineClock struct {
+	boots    uint32
+	time     uint32
+	received time.Time
+}
+
+// timelinessState tracks the clocks of the authoritative engines messages
+// were received from.
+type timelinessState struct {
+	mu      sync.Mutex
+	engines map[string]engineClock
+}
+
+//nolint:gochecknoglobals
+var timelinessInit sync.Mutex
+
+// checkTimeliness applies the timeliness check of RFC 3414 section 3.2 step
+// 7b, as a non-authoritative engine, to an authenticated message: it must
+// not be older than the latest message of its engine by more than
+// TimelinessWindow. Timely messages advance the local notion of the engine's
+// clock.
+func (x *GoSNMP) checkTimeliness(result *SnmpPacket) error {
+	if x.TimelinessWindow <= 0 || result.MsgFlags&AuthNoPriv == 0 {
+		return nil
+	}
+	sp, ok := result.SecurityParameters.(*UsmSecurityParameters)
+	if !ok {
+		return nil
+	}
+	sp.mu.Lock()
+	engineID, boots, engineTime := sp.AuthoritativeEngineID, sp.AuthoritativeEngineBoots, sp.AuthoritativeEngineTime
+	sp.mu.Unlock()
+
+	timelinessInit.Lock()
+	s := x.shared()
+	if s.timeliness == nil {
+		s.timeliness = &timelinessState{engines: make(map[string]engineClock)}
+	}
+	state := s.timeliness
+	timelinessInit.Unlock()
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	now := time.Now()
+	clock, known := state.engines[engineID]
+	var estimated int64
+	if known {
+		estimated = int64(clock.time) + int64(now.Sub(clock.received)/time.Second)
+	}
+	if boots >= maxEngineBoots ||
+		known && (boots < clock.boots ||
+			boots == clock.boots && int64(engineTime) < estimated-int64(x.TimelinessWindow/time.Second)) {
+		return &TimelinessError{
+			EngineID:      engineID,
+			Boots:         boots,
+			Time:          engineTime,
+			LatestBoots:   clock.boots,
+			EstimatedTime: uint32(estimated),
+		}
+	}
+	if !known || boots > clock.boots || int64(engineTime) > estimated {
+		state.engines[engineID] = engineClock{boots: boots, time: engineTime, received: now}
+	}
+	return nil
+}
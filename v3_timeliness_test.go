@@ -0,0 +1,63 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimelinessWindow(t *testing.T) {
+	engine := "\x80\x00\x1f\x88\x04sw1"
+	alice := UsmUser{UserName: "alice", AuthenticationProtocol: SHA, AuthenticationPassphrase: "alicepass"}
+	users := NewUsmUserTable()
+	require.NoError(t, users.Add(alice))
+
+	x := &GoSNMP{
+		Version:          Version3,
+		SecurityModel:    UserSecurityModel,
+		MsgFlags:         AuthNoPriv,
+		UsmUsers:         users,
+		TimelinessWindow: DefaultTimelinessWindow,
+		Logger:           NewLogger(nil),
+	}
+
+	first := func() []byte { return v3TrapAt(t, engine, alice, AuthNoPriv, 3, 1000) }
+	require.NotNil(t, x.UnmarshalTrap(first(), false))
+	assert.NotNil(t, x.UnmarshalTrap(first(), false), "replay within the window")
+	assert.NotNil(t, x.UnmarshalTrap(v3TrapAt(t, engine, alice, AuthNoPriv, 3, 900), false), "late within the window")
+	assert.Nil(t, x.UnmarshalTrap(v3TrapAt(t, engine, alice, AuthNoPriv, 3, 800), false), "older than the window")
+	assert.Nil(t, x.UnmarshalTrap(v3TrapAt(t, engine, alice, AuthNoPriv, 2, 5000), false), "earlier boots")
+	assert.Nil(t, x.UnmarshalTrap(v3TrapAt(t, engine, alice, AuthNoPriv, maxEngineBoots, 1), false), "latched boots")
+
+	// a reboot moves the clock forward, old messages are now out of window
+	require.NotNil(t, x.UnmarshalTrap(v3TrapAt(t, engine, alice, AuthNoPriv, 4, 10), false))
+	assert.Nil(t, x.UnmarshalTrap(first(), false))
+
+	// engines are tracked separately
+	assert.NotNil(t, x.UnmarshalTrap(v3TrapAt(t, "\x80\x00\x1f\x88\x04sw2", alice, AuthNoPriv, 1, 1), false))
+
+	// unauthenticated messages and disabled checks are not affected
+	noAuth := UsmUser{UserName: "alice"}
+	x.MsgFlags = NoAuthNoPriv
+	assert.NotNil(t, x.UnmarshalTrap(v3TrapAt(t, engine, noAuth, NoAuthNoPriv, 1, 1), false))
+	x.MsgFlags = AuthNoPriv
+	x.TimelinessWindow = 0
+	assert.NotNil(t, x.UnmarshalTrap(first(), false))
+
+	x.TimelinessWindow = DefaultTimelinessWindow
+	packet, err := x.SnmpDecodePacket(first())
+	require.NoError(t, err)
+	err = x.checkTimeliness(packet)
+	var terr *TimelinessError
+	require.True(t, errors.As(err, &terr))
+	assert.True(t, errors.Is(err, ErrNotInTimeWindow))
+	assert.Equal(t, engine, terr.EngineID)
+	assert.Equal(t, uint32(3), terr.Boots)
+	assert.Equal(t, uint32(4), terr.LatestBoots)
+}
@@ -0,0 +1,107 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"fmt"
+)
+
+// localEngineID is the contextEngineID a command generator may use to
+// address the local context of an agent without discovering its engine ID,
+// see RFC 5343.
+const localEngineID = "\x80\x00\x00\x00\x06"
+
+// TsmSecurityParameters is an implementation of SnmpV3SecurityParameters for
+// the TransportSecurityModel of RFC 5591. Authentication and privacy are
+// provided by the secure transport, e.g. TLS (RFC 6353), so the messages
+// themselves carry no security parameters. The agent derives the
+// securityName from the client certificate.
+type TsmSecurityParameters struct {
+	// SecurityName is the securityName the certificate is expected to map
+	// to. It is informational only and not sent on the wire.
+	SecurityName string
+
+	Logger Logger
+}
+
+// Description logs security parameter information to the provided GoSNMP Logger
+func (sp *TsmSecurityParameters) Description() string {
+	return "tsm,securityName=" + sp.SecurityName
+}
+
+// Log logs security parameter information to the provided GoSNMP Logger
+func (sp *TsmSecurityParameters) Log() {
+	sp.Logger.PrintLazy(func() string {
+		return fmt.Sprintf("SECURITY PARAMETERS:%+v", sp)
+	})
+}
+
+// Copy method for TsmSecurityParameters used to copy a SnmpV3SecurityParameters without knowing it's implementation
+func (sp *TsmSecurityParameters) Copy() SnmpV3SecurityParameters {
+	return &TsmSecurityParameters{
+		SecurityName: sp.SecurityName,
+		Logger:       sp.Logger,
+	}
+}
+
+func (sp *TsmSecurityParameters) getDefaultContextEngineID() string {
+	return ""
+}
+
+func (sp *TsmSecurityParameters) initSecurityKeys() error {
+	return nil
+}
+
+func (sp *TsmSecurityParameters) setSecurityParameters(in SnmpV3SecurityParameters) error {
+	if _, ok := in.(*TsmSecurityParameters); !ok {
+		return fmt.Errorf("param SnmpV3SecurityParameters is not of type *TsmSecurityParameters")
+	}
+	return nil
+}
+
+func (sp *TsmSecurityParameters) validate(flags SnmpV3MsgFlags) error {
+	// any security level is provided by the secure transport
+	return nil
+}
+
+func (sp *TsmSecurityParameters) init(log Logger) error {
+	sp.Logger = log
+	return nil
+}
+
+func (sp *TsmSecurityParameters) initPacket(packet *SnmpPacket) error {
+	return nil
+}
+
+func (sp *TsmSecurityParameters) discoveryRequired() *SnmpPacket {
+	return nil
+}
+
+// marshal returns the empty msgSecurityParameters of RFC 5591 section 4.2
+func (sp *TsmSecurityParameters) marshal(flags SnmpV3MsgFlags) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (sp *TsmSecurityParameters) unmarshal(flags SnmpV3MsgFlags, packet []byte, cursor int) (int, error) {
+	// the msgSecurityParameters octet string is empty, cursor already
+	// points past its header
+	return cursor, nil
+}
+
+func (sp *TsmSecurityParameters) authenticate(packet []byte) error {
+	return nil
+}
+
+func (sp *TsmSecurityParameters) isAuthentic(packetBytes []byte, packet *SnmpPacket) (bool, error) {
+	return true, nil
+}
+
+func (sp *TsmSecurityParameters) encryptPacket(flags SnmpV3MsgFlags, scopedPdu []byte) ([]byte, error) {
+	return scopedPdu, nil
+}
+
+func (sp *TsmSecurityParameters) decryptPacket(flags SnmpV3MsgFlags, packet []byte, cursor int) ([]byte, error) {
+	return packet, nil
+}
@@ -0,0 +1,240 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCert issues a certificate for cn signed by parent, or a self-signed CA
+// certificate when parent is nil.
+func testCert(t *testing.T, cn string, parent *tls.Certificate, serial int64) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	signer, signerKey := tmpl, interface{}(key)
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		signer = parent.Leaf
+		signerKey = parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// tsmResponse decodes a SNMPv3 TSM request and returns the encoded response.
+func tsmResponse(t *testing.T, msg []byte) []byte {
+	decoder := &GoSNMP{
+		Transport:          "tls",
+		Version:            Version3,
+		SecurityModel:      TransportSecurityModel,
+		SecurityParameters: &TsmSecurityParameters{},
+	}
+	req, err := decoder.SnmpDecodePacket(msg)
+	if err != nil {
+		t.Errorf("agent decode: %s", err)
+		return nil
+	}
+	resp := &SnmpPacket{
+		Version:            Version3,
+		MsgFlags:           req.MsgFlags &^ Reportable,
+		SecurityModel:      TransportSecurityModel,
+		SecurityParameters: &TsmSecurityParameters{},
+		MsgID:              req.MsgID,
+		RequestID:          req.RequestID,
+		ContextEngineID:    req.ContextEngineID,
+		PDUType:            GetResponse,
+		Variables:          []SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "agent"}},
+	}
+	out, err := resp.MarshalMsg()
+	if err != nil {
+		t.Errorf("agent marshal: %s", err)
+		return nil
+	}
+	return out
+}
+
+// tlsAgent answers one SNMPv3 TSM request per connection, writing the
+// response in two parts to exercise stream reassembly.
+func tlsAgent(t *testing.T, ln net.Listener, clients chan<- string) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		tlsConn := conn.(*tls.Conn)
+		msg, err := readBERMessage(tlsConn, rxBufSize)
+		if err != nil {
+			t.Errorf("agent read: %s", err)
+			conn.Close()
+			return
+		}
+		clients <- tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName
+
+		out := tsmResponse(t, msg)
+		if out == nil {
+			conn.Close()
+			return
+		}
+		_, _ = conn.Write(out[:5])
+		_, _ = conn.Write(out[5:])
+		conn.Close()
+	}
+}
+
+func TestTransportSecurityModelTLS(t *testing.T) {
+	ca := testCert(t, "ca", nil, 1)
+	server := testCert(t, "agent", &ca, 2)
+	client := testCert(t, "operator", &ca, 3)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+
+	ln, err := tls.Listen("tcp4", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{server},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    roots,
+		MinVersion:   tls.VersionTLS12,
+	})
+	require.NoError(t, err)
+	defer ln.Close()
+	clients := make(chan string, 1)
+	go tlsAgent(t, ln, clients)
+
+	x := &GoSNMP{
+		Target:             "127.0.0.1",
+		Port:               uint16(ln.Addr().(*net.TCPAddr).Port),
+		Transport:          "tls",
+		Version:            Version3,
+		SecurityModel:      TransportSecurityModel,
+		MsgFlags:           AuthPriv,
+		SecurityParameters: &TsmSecurityParameters{SecurityName: "operator"},
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{client},
+			RootCAs:      roots,
+		},
+		Timeout: time.Second,
+		Retries: 1,
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+	assert.Equal(t, localEngineID, x.ContextEngineID)
+
+	result, err := x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	require.Len(t, result.Variables, 1)
+	assert.Equal(t, []byte("agent"), result.Variables[0].Value)
+	assert.Equal(t, "operator", <-clients)
+}
+
+func TestTransportSecurityModelDTLS(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := srvr.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if out := tsmResponse(t, buf[:n]); out != nil {
+				_, _ = srvr.WriteTo(out, addr)
+			}
+		}
+	}()
+
+	// stands in for a DTLS client, which presents one message per record
+	var dialed string
+	x := &GoSNMP{
+		Target:             "127.0.0.1",
+		Port:               uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Transport:          "dtlsudp",
+		Version:            Version3,
+		SecurityModel:      TransportSecurityModel,
+		MsgFlags:           AuthPriv,
+		SecurityParameters: &TsmSecurityParameters{},
+		DTLSDialer: func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialed = network + " " + address
+			if _, ok := ctx.Deadline(); !ok {
+				return nil, errors.New("no handshake deadline")
+			}
+			var d net.Dialer
+			return d.DialContext(ctx, network, address)
+		},
+		Timeout: time.Second,
+	}
+	require.NoError(t, x.ConnectIPv4())
+	defer x.Conn.Close()
+	assert.Equal(t, "udp4 "+srvr.LocalAddr().String(), dialed)
+
+	result, err := x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	require.Len(t, result.Variables, 1)
+	assert.Equal(t, []byte("agent"), result.Variables[0].Value)
+
+	x.LocalAddr = "127.0.0.1:0"
+	assert.Error(t, x.Connect(), "LocalAddr is rejected")
+	x.LocalAddr = ""
+	x.DTLSDialer = nil
+	assert.Error(t, x.Connect())
+}
+
+func TestTransportSecurityModelRequiresTLS(t *testing.T) {
+	x := &GoSNMP{
+		Target:             "127.0.0.1",
+		Port:               161,
+		Transport:          "udp",
+		Version:            Version3,
+		SecurityModel:      TransportSecurityModel,
+		SecurityParameters: &TsmSecurityParameters{},
+	}
+	assert.Error(t, x.Connect())
+}
+
+func TestReadBERMessage(t *testing.T) {
+	long := append([]byte{0x30, 0x82, 0x01, 0x00}, make([]byte, 256)...)
+	stream := append([]byte{0x30, 0x02, 0x01, 0x02}, long...)
+	r := bytes.NewReader(stream)
+
+	msg, err := readBERMessage(r, rxBufSize)
+	require.NoError(t, err)
+	assert.Equal(t, stream[:4], msg)
+	msg, err = readBERMessage(r, rxBufSize)
+	require.NoError(t, err)
+	assert.Equal(t, long, msg)
+
+	_, err = readBERMessage(bytes.NewReader(long[:100]), rxBufSize)
+	assert.Error(t, err)
+	_, err = readBERMessage(bytes.NewReader(long), 100)
+	assert.Error(t, err)
+}
@@ -11,7 +11,6 @@ package gosnmp
 import (
 	"bytes"
 	"crypto"
-	"crypto/aes"
 	"crypto/cipher"
 	"crypto/des" //nolint:gosec
 	"crypto/hmac"
@@ -25,6 +24,7 @@ import (
 	"errors"
 	"fmt"
 	"hash"
+	"io"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -124,6 +124,13 @@ const (
 	AES256  SnmpV3PrivProtocol = 5 // Blumenthal-AES256
 	AES192C SnmpV3PrivProtocol = 6 // Reeder-AES192
 	AES256C SnmpV3PrivProtocol = 7 // Reeder-AES256
+
+	// AESGCM is a nonstandard privacy protocol for links between gosnmp
+	// endpoints only, e.g. a collector and a proxy, that must both be
+	// configured with it: the scopedPDU is encrypted and authenticated with
+	// AES-256-GCM instead of AES-CFB. Other SNMP engines do not implement
+	// it and fail to decrypt such messages.
+	AESGCM SnmpV3PrivProtocol = 8
 )
 
 //go:generate stringer -type=SnmpV3PrivProtocol
@@ -152,10 +159,21 @@ type UsmSecurityParameters struct {
 	PrivacyKey []byte
 
 	Logger Logger
+
+	// users, if set, supplies the credentials of inbound messages
+	users *UsmUserTable
+
+	// CryptoProvider, if set, supplies the MACs and ciphers of messages.
+	CryptoProvider CryptoProvider
+
+	// rand is the entropy source of the salts, see GoSNMP.Rand
+	rand io.Reader
 }
 
 // Description logs authentication paramater information to the provided GoSNMP Logger
 func (sp *UsmSecurityParameters) Description() string {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
 	var sb strings.Builder
 	sb.WriteString("user=")
 	sb.WriteString(sp.UserName)
@@ -199,6 +217,8 @@ func (sp *UsmSecurityParameters) Description() string {
 		sb.WriteString(",priv=AES192C")
 	case AES256C:
 		sb.WriteString(",priv=AES256C")
+	case AESGCM:
+		sb.WriteString(",priv=AESGCM")
 	}
 	sb.WriteString(",privPass=")
 	sb.WriteString(sp.PrivacyPassphrase)
@@ -208,9 +228,11 @@ func (sp *UsmSecurityParameters) Description() string {
 
 // Log logs security paramater information to the provided GoSNMP Logger
 func (sp *UsmSecurityParameters) Log() {
-	sp.mu.Lock()
-	defer sp.mu.Unlock()
-	sp.Logger.Printf("SECURITY PARAMETERS:%+v", sp)
+	sp.Logger.PrintLazy(func() string {
+		sp.mu.Lock()
+		defer sp.mu.Unlock()
+		return fmt.Sprintf("SECURITY PARAMETERS:%+v", sp)
+	})
 }
 
 // Copy method for UsmSecurityParameters used to copy a SnmpV3SecurityParameters without knowing it's implementation
@@ -232,10 +254,14 @@ func (sp *UsmSecurityParameters) Copy() SnmpV3SecurityParameters {
 		localDESSalt:             sp.localDESSalt,
 		localAESSalt:             sp.localAESSalt,
 		Logger:                   sp.Logger,
+		CryptoProvider:           sp.CryptoProvider,
+		rand:                     sp.rand,
 	}
 }
 
 func (sp *UsmSecurityParameters) getDefaultContextEngineID() string {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
 	return sp.AuthoritativeEngineID
 }
 func (sp *UsmSecurityParameters) initSecurityKeys() error {
@@ -248,7 +274,9 @@ func (sp *UsmSecurityParameters) initSecurityKeys() error {
 func (sp *UsmSecurityParameters) initSecurityKeysNoLock() error {
 	var err error
 
-	if sp.AuthenticationProtocol > NoAuth && len(sp.SecretKey) == 0 {
+	// keys are only localized from passphrases that are set, unused
+	// protocols of NoAuthNoPriv and AuthNoPriv sessions need none
+	if sp.AuthenticationProtocol > NoAuth && len(sp.SecretKey) == 0 && sp.AuthenticationPassphrase != "" {
 		sp.SecretKey, err = genlocalkey(sp.AuthenticationProtocol,
 			sp.AuthenticationPassphrase,
 			sp.AuthoritativeEngineID)
@@ -256,24 +284,13 @@ func (sp *UsmSecurityParameters) initSecurityKeysNoLock() error {
 			return err
 		}
 	}
-	if sp.PrivacyProtocol > NoPriv && len(sp.PrivacyKey) == 0 {
-		switch sp.PrivacyProtocol {
-		// Changed: The Output of SHA1 is a 20 octets array, therefore for AES128 (16 octets) either key extension algorithm can be used.
-		case AES, AES192, AES256, AES192C, AES256C:
-			// Use abstract AES key localization algorithms.
-			sp.PrivacyKey, err = genlocalPrivKey(sp.PrivacyProtocol, sp.AuthenticationProtocol,
-				sp.PrivacyPassphrase,
-				sp.AuthoritativeEngineID)
-			if err != nil {
-				return err
-			}
-		default:
-			sp.PrivacyKey, err = genlocalkey(sp.AuthenticationProtocol,
-				sp.PrivacyPassphrase,
-				sp.AuthoritativeEngineID)
-			if err != nil {
-				return err
-			}
+	if sp.PrivacyProtocol > NoPriv && len(sp.PrivacyKey) == 0 && sp.PrivacyPassphrase != "" &&
+		sp.AuthenticationProtocol > NoAuth {
+		sp.PrivacyKey, err = genPrivKey(sp.PrivacyProtocol, sp.AuthenticationProtocol,
+			sp.PrivacyPassphrase,
+			sp.AuthoritativeEngineID)
+		if err != nil {
+			return err
 		}
 	}
 	return nil
@@ -283,15 +300,26 @@ func (sp *UsmSecurityParameters) setSecurityParameters(in SnmpV3SecurityParamete
 	var insp *UsmSecurityParameters
 	var err error
 
-	sp.mu.Lock()
-	defer sp.mu.Unlock()
-
 	if insp, err = castUsmSecParams(in); err != nil {
 		return err
 	}
+	if insp == sp {
+		return nil
+	}
+
+	// snapshot the incoming engine state before taking our own lock, so that
+	// the two locks are never held together
+	insp.mu.Lock()
+	engineID := insp.AuthoritativeEngineID
+	boots := insp.AuthoritativeEngineBoots
+	engineTime := insp.AuthoritativeEngineTime
+	insp.mu.Unlock()
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
 
-	if sp.AuthoritativeEngineID != insp.AuthoritativeEngineID {
-		sp.AuthoritativeEngineID = insp.AuthoritativeEngineID
+	if sp.AuthoritativeEngineID != engineID {
+		sp.AuthoritativeEngineID = engineID
 		sp.SecretKey = nil
 		sp.PrivacyKey = nil
 
@@ -300,8 +328,8 @@ func (sp *UsmSecurityParameters) setSecurityParameters(in SnmpV3SecurityParamete
 			return err
 		}
 	}
-	sp.AuthoritativeEngineBoots = insp.AuthoritativeEngineBoots
-	sp.AuthoritativeEngineTime = insp.AuthoritativeEngineTime
+	sp.AuthoritativeEngineBoots = boots
+	sp.AuthoritativeEngineTime = engineTime
 
 	return nil
 }
@@ -309,16 +337,24 @@ func (sp *UsmSecurityParameters) setSecurityParameters(in SnmpV3SecurityParamete
 func (sp *UsmSecurityParameters) validate(flags SnmpV3MsgFlags) error {
 	securityLevel := flags & AuthPriv // isolate flags that determine security level
 
+	// the protocols and passphrases of a level above the one in use are
+	// ignored, so that NoAuthNoPriv only needs a UserName
 	switch securityLevel {
 	case AuthPriv:
 		if sp.PrivacyProtocol <= NoPriv {
 			return fmt.Errorf("securityParameters.PrivacyProtocol is required")
 		}
+		if len(sp.PrivacyKey) == 0 && sp.PrivacyPassphrase == "" {
+			return fmt.Errorf("securityParameters.PrivacyPassphrase is required when a privacy protocol is specified")
+		}
 		fallthrough
 	case AuthNoPriv:
 		if sp.AuthenticationProtocol <= NoAuth {
 			return fmt.Errorf("securityParameters.AuthenticationProtocol is required")
 		}
+		if len(sp.SecretKey) == 0 && sp.AuthenticationPassphrase == "" {
+			return fmt.Errorf("securityParameters.AuthenticationPassphrase is required when an authentication protocol is specified")
+		}
 		fallthrough
 	case NoAuthNoPriv:
 		if sp.UserName == "" {
@@ -328,18 +364,6 @@ func (sp *UsmSecurityParameters) validate(flags SnmpV3MsgFlags) error {
 		return fmt.Errorf("validate: MsgFlags must be populated with an appropriate security level")
 	}
 
-	if sp.PrivacyProtocol > NoPriv && len(sp.PrivacyKey) == 0 {
-		if sp.PrivacyPassphrase == "" {
-			return fmt.Errorf("securityParameters.PrivacyPassphrase is required when a privacy protocol is specified")
-		}
-	}
-
-	if sp.AuthenticationProtocol > NoAuth && len(sp.SecretKey) == 0 {
-		if sp.AuthenticationPassphrase == "" {
-			return fmt.Errorf("securityParameters.AuthenticationPassphrase is required when an authentication protocol is specified")
-		}
-	}
-
 	return nil
 }
 
@@ -347,18 +371,22 @@ func (sp *UsmSecurityParameters) init(log Logger) error {
 	var err error
 
 	sp.Logger = log
+	random := sp.rand
+	if random == nil {
+		random = crand.Reader
+	}
 
 	switch sp.PrivacyProtocol {
-	case AES, AES192, AES256, AES192C, AES256C:
+	case AES, AES192, AES256, AES192C, AES256C, AESGCM:
 		salt := make([]byte, 8)
-		_, err = crand.Read(salt)
+		_, err = io.ReadFull(random, salt)
 		if err != nil {
 			return fmt.Errorf("error creating a cryptographically secure salt: %w", err)
 		}
 		sp.localAESSalt = binary.BigEndian.Uint64(salt)
 	case DES:
 		salt := make([]byte, 4)
-		_, err = crand.Read(salt)
+		_, err = io.ReadFull(random, salt)
 		if err != nil {
 			return fmt.Errorf("error creating a cryptographically secure salt: %w", err)
 		}
@@ -428,8 +456,13 @@ func hMAC(hash crypto.Hash, cacheKey string, password string, engineID string) (
 		return []byte{}, nil
 	}
 
+	return localizeKey(hash, hashed, engineID)
+}
+
+// localizeKey computes Kul = H(Ku | engineID | Ku), see RFC 3414 section 2.6
+func localizeKey(hash crypto.Hash, ku []byte, engineID string) ([]byte, error) {
 	local := hash.New()
-	_, err = local.Write(hashed)
+	_, err := local.Write(ku)
 	if err != nil {
 		return []byte{}, err
 	}
@@ -439,7 +472,7 @@ func hMAC(hash crypto.Hash, cacheKey string, password string, engineID string) (
 		return []byte{}, err
 	}
 
-	_, err = local.Write(hashed)
+	_, err = local.Write(ku)
 	if err != nil {
 		return []byte{}, err
 	}
@@ -484,7 +517,7 @@ func extendKeyBlumenthal(authProtocol SnmpV3AuthProtocol, password string, engin
 	var key []byte
 	var err error
 
-	key, err = hMAC(authProtocol.HashType(), cacheKey(authProtocol, ""), password, engineID)
+	key, err = hMAC(authProtocol.HashType(), cacheKey(authProtocol, password), password, engineID)
 
 	if err != nil {
 		return nil, err
@@ -506,7 +539,7 @@ func genlocalPrivKey(privProtocol SnmpV3PrivProtocol, authProtocol SnmpV3AuthPro
 		keylen = 16
 	case AES192, AES192C:
 		keylen = 24
-	case AES256, AES256C:
+	case AES256, AES256C, AESGCM:
 		keylen = 32
 	}
 
@@ -514,7 +547,7 @@ func genlocalPrivKey(privProtocol SnmpV3PrivProtocol, authProtocol SnmpV3AuthPro
 	case AES, AES192C, AES256C:
 		localPrivKey, err = extendKeyReeder(authProtocol, password, engineID)
 
-	case AES192, AES256:
+	case AES192, AES256, AESGCM:
 		localPrivKey, err = extendKeyBlumenthal(authProtocol, password, engineID)
 
 	default:
@@ -546,6 +579,75 @@ func genlocalkey(authProtocol SnmpV3AuthProtocol, passphrase string, engineID st
 	return secretKey, nil
 }
 
+// PasswordToKey converts passphrase into the non-localized key Ku using the
+// password to key algorithm of RFC 3414 (A.2) and RFC 7860, hashing with the
+// digest of authProtocol.
+func PasswordToKey(authProtocol SnmpV3AuthProtocol, passphrase string) ([]byte, error) {
+	if authProtocol <= NoAuth || authProtocol > SHA512 {
+		return nil, fmt.Errorf("PasswordToKey: unsupported authentication protocol %v", authProtocol)
+	}
+	ku, err := cachedPasswordToKey(authProtocol.HashType().New(), cacheKey(authProtocol, passphrase), passphrase)
+	if err != nil {
+		return nil, err
+	}
+	// never hand out the cached slice itself
+	return append([]byte(nil), ku...), nil
+}
+
+// LocalizeKu localizes a key produced by PasswordToKey to engineID, returning
+// Kul as used for USM authentication.
+func LocalizeKu(authProtocol SnmpV3AuthProtocol, ku []byte, engineID string) ([]byte, error) {
+	if authProtocol <= NoAuth || authProtocol > SHA512 {
+		return nil, fmt.Errorf("LocalizeKu: unsupported authentication protocol %v", authProtocol)
+	}
+	if len(ku) == 0 {
+		return nil, errors.New("LocalizeKu: key is empty")
+	}
+	return localizeKey(authProtocol.HashType(), ku, engineID)
+}
+
+// LocalizeKey derives the localized authentication key for passphrase and
+// engineID, exactly as UsmSecurityParameters does when SecretKey is unset.
+// It is equivalent to PasswordToKey followed by LocalizeKu.
+func LocalizeKey(authProtocol SnmpV3AuthProtocol, passphrase string, engineID string) ([]byte, error) {
+	ku, err := PasswordToKey(authProtocol, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return LocalizeKu(authProtocol, ku, engineID)
+}
+
+// LocalizePrivKey derives the localized privacy key for passphrase and
+// engineID, exactly as UsmSecurityParameters does when PrivacyKey is unset.
+// For the AES variants this includes the Reeder or Blumenthal key extension.
+func LocalizePrivKey(privProtocol SnmpV3PrivProtocol, authProtocol SnmpV3AuthProtocol, passphrase string, engineID string) ([]byte, error) {
+	if privProtocol <= NoPriv || privProtocol > AESGCM {
+		return nil, fmt.Errorf("LocalizePrivKey: unsupported privacy protocol %v", privProtocol)
+	}
+	if authProtocol <= NoAuth || authProtocol > SHA512 {
+		return nil, fmt.Errorf("LocalizePrivKey: unsupported authentication protocol %v", authProtocol)
+	}
+	if passphrase == "" {
+		return nil, errors.New("LocalizePrivKey: passphrase is empty")
+	}
+	key, err := genPrivKey(privProtocol, authProtocol, passphrase, engineID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), key...), nil
+}
+
+func genPrivKey(privProtocol SnmpV3PrivProtocol, authProtocol SnmpV3AuthProtocol, passphrase string, engineID string) ([]byte, error) {
+	switch privProtocol {
+	// Changed: The Output of SHA1 is a 20 octets array, therefore for AES128 (16 octets) either key extension algorithm can be used.
+	case AES, AES192, AES256, AES192C, AES256C, AESGCM:
+		// Use abstract AES key localization algorithms.
+		return genlocalPrivKey(privProtocol, authProtocol, passphrase, engineID)
+	default:
+		return genlocalkey(authProtocol, passphrase, engineID)
+	}
+}
+
 // http://tools.ietf.org/html/rfc2574#section-8.1.1.1
 // localDESSalt needs to be incremented on every packet.
 func (sp *UsmSecurityParameters) usmAllocateNewSalt() interface{} {
@@ -554,7 +656,7 @@ func (sp *UsmSecurityParameters) usmAllocateNewSalt() interface{} {
 	var newSalt interface{}
 
 	switch sp.PrivacyProtocol {
-	case AES, AES192, AES256, AES192C, AES256C:
+	case AES, AES192, AES256, AES192C, AES256C, AESGCM:
 		newSalt = atomic.AddUint64(&(sp.localAESSalt), 1)
 	default:
 		newSalt = atomic.AddUint32(&(sp.localDESSalt), 1)
@@ -566,7 +668,7 @@ func (sp *UsmSecurityParameters) usmSetSalt(newSalt interface{}) error {
 	sp.mu.Lock()
 	defer sp.mu.Unlock()
 	switch sp.PrivacyProtocol {
-	case AES, AES192, AES256, AES192C, AES256C:
+	case AES, AES192, AES256, AES192C, AES256C, AESGCM:
 		aesSalt, ok := newSalt.(uint64)
 		if !ok {
 			return fmt.Errorf("salt provided to usmSetSalt is not the correct type for the AES privacy protocol")
@@ -632,6 +734,14 @@ func calcPacketDigest(packetBytes []byte, secParams *UsmSecurityParameters) ([]b
 	var digest []byte
 	var err error
 
+	if secParams.CryptoProvider != nil {
+		switch secParams.AuthenticationProtocol {
+		case MD5, SHA, SHA224, SHA256, SHA384, SHA512:
+			return digestProvider(secParams.CryptoProvider, secParams.AuthenticationProtocol, packetBytes, secParams.SecretKey)
+		}
+		return digest, nil
+	}
+
 	switch secParams.AuthenticationProtocol {
 	case MD5, SHA:
 		digest, err = digestRFC3414(
@@ -729,6 +839,13 @@ func (sp *UsmSecurityParameters) authenticate(packet []byte) error {
 
 // determine whether a message is authentic
 func (sp *UsmSecurityParameters) isAuthentic(packetBytes []byte, packet *SnmpPacket) (bool, error) {
+	return sp.verifyDigest(packetBytes, packet, false)
+}
+
+// verifyDigest determines whether a message is authentic. In strict mode a
+// digest not of the length of the authentication protocol is an error, and
+// digests are compared in constant time.
+func (sp *UsmSecurityParameters) verifyDigest(packetBytes []byte, packet *SnmpPacket, strict bool) (bool, error) {
 	var msgDigest []byte
 	var packetSecParams *UsmSecurityParameters
 	var err error
@@ -741,7 +858,20 @@ func (sp *UsmSecurityParameters) isAuthentic(packetBytes []byte, packet *SnmpPac
 		return false, err
 	}
 
-	for k, v := range []byte(packetSecParams.AuthenticationParameters) {
+	received := []byte(packetSecParams.AuthenticationParameters)
+	if strict {
+		proto := packetSecParams.AuthenticationProtocol
+		if proto <= NoAuth || int(proto) >= len(macVarbinds) {
+			return false, fmt.Errorf("%w: no digest for authentication protocol %s", ErrWrongDigest, proto)
+		}
+		size := len(macVarbinds[proto]) - 2
+		if len(received) != size || len(msgDigest) < size {
+			return false, fmt.Errorf("%w: %d byte digest, %s uses %d bytes", ErrWrongDigest, len(received), proto, size)
+		}
+		return hmac.Equal(msgDigest[:size], received), nil
+	}
+
+	for k, v := range received {
 		if msgDigest[k] != v {
 			return false, nil
 		}
@@ -749,17 +879,28 @@ func (sp *UsmSecurityParameters) isAuthentic(packetBytes []byte, packet *SnmpPac
 	return true, nil
 }
 
-func (sp *UsmSecurityParameters) encryptPacket(scopedPdu []byte) ([]byte, error) {
+func (sp *UsmSecurityParameters) encryptPacket(flags SnmpV3MsgFlags, scopedPdu []byte) ([]byte, error) {
 	var b []byte
 
 	switch sp.PrivacyProtocol {
+	case AESGCM:
+		ciphertext, err := sp.sealGCM(flags, scopedPdu)
+		if err != nil {
+			return nil, err
+		}
+		pduLen, err := marshalLength(len(ciphertext))
+		if err != nil {
+			return nil, err
+		}
+		b = append([]byte{byte(OctetString)}, pduLen...)
+		scopedPdu = append(b, ciphertext...) //nolint:gocritic
 	case AES, AES192, AES256, AES192C, AES256C:
 		var iv [16]byte
 		binary.BigEndian.PutUint32(iv[:], sp.AuthoritativeEngineBoots)
 		binary.BigEndian.PutUint32(iv[4:], sp.AuthoritativeEngineTime)
 		copy(iv[8:], sp.PrivacyParameters)
 		// aes.NewCipher(sp.PrivacyKey[:16]) changed to aes.NewCipher(sp.PrivacyKey)
-		block, err := aes.NewCipher(sp.PrivacyKey)
+		block, err := sp.cryptoProvider().NewAESCipher(sp.PrivacyKey)
 		if err != nil {
 			return nil, err
 		}
@@ -778,7 +919,7 @@ func (sp *UsmSecurityParameters) encryptPacket(scopedPdu []byte) ([]byte, error)
 		for i := 0; i < len(iv); i++ {
 			iv[i] = preiv[i] ^ sp.PrivacyParameters[i]
 		}
-		block, err := des.NewCipher(sp.PrivacyKey[:8]) //nolint:gosec
+		block, err := sp.cryptoProvider().NewDESCipher(sp.PrivacyKey[:8])
 		if err != nil {
 			return nil, err
 		}
@@ -800,7 +941,7 @@ func (sp *UsmSecurityParameters) encryptPacket(scopedPdu []byte) ([]byte, error)
 	return scopedPdu, nil
 }
 
-func (sp *UsmSecurityParameters) decryptPacket(packet []byte, cursor int) ([]byte, error) {
+func (sp *UsmSecurityParameters) decryptPacket(flags SnmpV3MsgFlags, packet []byte, cursor int) ([]byte, error) {
 	_, cursorTmp, err := parseLength(packet[cursor:])
 	if err != nil {
 		return nil, err
@@ -811,13 +952,20 @@ func (sp *UsmSecurityParameters) decryptPacket(packet []byte, cursor int) ([]byt
 	}
 
 	switch sp.PrivacyProtocol {
+	case AESGCM:
+		plaintext, err := sp.openGCM(flags, packet[cursorTmp:])
+		if err != nil {
+			return nil, err
+		}
+		copy(packet[cursor:], plaintext)
+		packet = packet[:cursor+len(plaintext)]
 	case AES, AES192, AES256, AES192C, AES256C:
 		var iv [16]byte
 		binary.BigEndian.PutUint32(iv[:], sp.AuthoritativeEngineBoots)
 		binary.BigEndian.PutUint32(iv[4:], sp.AuthoritativeEngineTime)
 		copy(iv[8:], sp.PrivacyParameters)
 
-		block, err := aes.NewCipher(sp.PrivacyKey)
+		block, err := sp.cryptoProvider().NewAESCipher(sp.PrivacyKey)
 		if err != nil {
 			return nil, err
 		}
@@ -835,7 +983,7 @@ func (sp *UsmSecurityParameters) decryptPacket(packet []byte, cursor int) ([]byt
 		for i := 0; i < len(iv); i++ {
 			iv[i] = preiv[i] ^ sp.PrivacyParameters[i]
 		}
-		block, err := des.NewCipher(sp.PrivacyKey[:8]) //nolint:gosec
+		block, err := sp.cryptoProvider().NewDESCipher(sp.PrivacyKey[:8])
 		if err != nil {
 			return nil, err
 		}
@@ -930,7 +1078,9 @@ func (sp *UsmSecurityParameters) unmarshal(flags SnmpV3MsgFlags, packet []byte,
 			sp.SecretKey = nil
 			sp.PrivacyKey = nil
 
-			sp.Logger.Printf("Parsed authoritativeEngineID %0x", []byte(AuthoritativeEngineID))
+			sp.Logger.PrintLazy(func() string {
+				return fmt.Sprintf("Parsed authoritativeEngineID %0x", []byte(AuthoritativeEngineID))
+			})
 			err = sp.initSecurityKeysNoLock()
 			if err != nil {
 				return 0, err
@@ -967,6 +1117,11 @@ func (sp *UsmSecurityParameters) unmarshal(flags SnmpV3MsgFlags, packet []byte,
 		sp.UserName = msgUserName
 		sp.Logger.Printf("Parsed userName %s", msgUserName)
 	}
+	if sp.users != nil {
+		if err = sp.applyUserTableNoLock(flags); err != nil {
+			return 0, err
+		}
+	}
 
 	rawMsgAuthParameters, count, err := parseRawField(sp.Logger, packet[cursor:], "msgAuthenticationParameters")
 	if err != nil {
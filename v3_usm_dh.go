@@ -0,0 +1,239 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// SNMP-USM-DH-OBJECTS-MIB of RFC 2786.
+const (
+	usmDHParameters             = ".1.3.6.1.3.101.1.1.1.0"
+	usmDHUserAuthKeyChange      = ".1.3.6.1.3.101.1.1.2.1.1"
+	usmDHUserOwnAuthKeyChange   = ".1.3.6.1.3.101.1.1.2.1.2"
+	usmDHUserPrivKeyChange      = ".1.3.6.1.3.101.1.1.2.1.3"
+	usmDHUserOwnPrivKeyChange   = ".1.3.6.1.3.101.1.1.2.1.4"
+	dhDefaultPrivateValueLength = 256
+)
+
+// DHParameters are the Diffie-Hellman parameters an agent publishes in
+// usmDHParameters, the DER encoded DHParameter of PKCS #3.
+type DHParameters struct {
+	Prime *big.Int
+	Base  *big.Int
+	// PrivateValueLength is the length in bits of private values, 0 if the
+	// agent did not specify one.
+	PrivateValueLength int
+}
+
+type dhParameter struct {
+	Prime              *big.Int
+	Base               *big.Int
+	PrivateValueLength int `asn1:"optional"`
+}
+
+// ParseDHParameters decodes the value of usmDHParameters.
+func ParseDHParameters(der []byte) (*DHParameters, error) {
+	var p dhParameter
+	rest, err := asn1.Unmarshal(der, &p)
+	if err != nil {
+		return nil, fmt.Errorf("usmDHParameters: %w", err)
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("usmDHParameters: trailing data")
+	}
+	if p.Prime == nil || p.Base == nil || p.Prime.Cmp(big.NewInt(3)) < 0 || p.Base.Sign() <= 0 {
+		return nil, errors.New("usmDHParameters: invalid prime or base")
+	}
+	return &DHParameters{Prime: p.Prime, Base: p.Base, PrivateValueLength: p.PrivateValueLength}, nil
+}
+
+// Marshal returns the DER encoding of the parameters.
+func (p *DHParameters) Marshal() ([]byte, error) {
+	return asn1.Marshal(dhParameter{Prime: p.Prime, Base: p.Base, PrivateValueLength: p.PrivateValueLength})
+}
+
+// GenerateKey returns a random private value read from r and the public
+// value base^private mod prime.
+func (p *DHParameters) GenerateKey(r io.Reader) (private, public *big.Int, err error) {
+	bits := p.PrivateValueLength
+	if bits <= 0 || bits >= p.Prime.BitLen() {
+		bits = dhDefaultPrivateValueLength
+		if bits >= p.Prime.BitLen() {
+			bits = p.Prime.BitLen() - 1
+		}
+	}
+	buf := make([]byte, (bits+7)/8)
+	if _, err = io.ReadFull(r, buf); err != nil {
+		return nil, nil, err
+	}
+	private = new(big.Int).SetBytes(buf)
+	private.SetBit(private, bits-1, 1)
+	for i := private.BitLen() - 1; i >= bits; i-- {
+		private.SetBit(private, i, 0)
+	}
+	public = new(big.Int).Exp(p.Base, private, p.Prime)
+	return private, public, nil
+}
+
+// SharedSecret returns peerPublic^private mod prime, left padded to the
+// length of the prime. Public values outside 2..prime-2 are rejected.
+func (p *DHParameters) SharedSecret(private, peerPublic *big.Int) ([]byte, error) {
+	limit := new(big.Int).Sub(p.Prime, big.NewInt(1))
+	if peerPublic.Cmp(big.NewInt(1)) <= 0 || peerPublic.Cmp(limit) >= 0 {
+		return nil, errors.New("Diffie-Hellman public value out of range")
+	}
+	return p.publicBytes(new(big.Int).Exp(peerPublic, private, p.Prime)), nil
+}
+
+// publicBytes encodes a value modulo the prime as a DHKeyChange value.
+func (p *DHParameters) publicBytes(v *big.Int) []byte {
+	out := make([]byte, (p.Prime.BitLen()+7)/8)
+	b := v.Bytes()
+	copy(out[len(out)-len(b):], b)
+	return out
+}
+
+// DHDeriveKey derives a key of keyLen octets from a Diffie-Hellman shared
+// secret as the DHKeyChange textual convention does: the least significant
+// keyLen octets.
+func DHDeriveKey(sharedSecret []byte, keyLen int) ([]byte, error) {
+	if keyLen <= 0 || keyLen > len(sharedSecret) {
+		return nil, fmt.Errorf("cannot derive a %d octet key from a %d octet shared secret", keyLen, len(sharedSecret))
+	}
+	return append([]byte(nil), sharedSecret[len(sharedSecret)-keyLen:]...), nil
+}
+
+// UsmDHKeyChange describes a USM user whose keys are changed by
+// Diffie-Hellman key agreement, see ChangeUsmUserKeysDH.
+type UsmDHKeyChange struct {
+	// EngineID is the authoritative engine of the user, the engine of the
+	// agent if empty.
+	EngineID string
+	UserName string
+
+	AuthenticationProtocol SnmpV3AuthProtocol
+	// The privacy key is changed if PrivacyProtocol is set.
+	PrivacyProtocol SnmpV3PrivProtocol
+
+	// Own uses the usmDHUserOwn*KeyChange objects.
+	Own bool
+}
+
+// ChangeUsmUserKeysDH establishes new keys for a USM user of an agent
+// implementing the usmDHUserKeyTable of RFC 2786: it reads usmDHParameters
+// and the public values of the agent, writes fresh public values of its own
+// in one request, and returns the localized keys both sides derived. The
+// random private values are read from Rand.
+//
+// When the user is the one of the session, its SecurityParameters switch to
+// the new keys, which no longer correspond to its passphrases.
+func (x *GoSNMP) ChangeUsmUserKeysDH(change UsmDHKeyChange) (authKey, privKey []byte, err error) {
+	if x.Version != Version3 {
+		return nil, nil, fmt.Errorf("USM key change requires Version3, got %v", x.Version)
+	}
+	sp, ok := x.SecurityParameters.(*UsmSecurityParameters)
+	if !ok {
+		return nil, nil, errors.New("USM key change requires UsmSecurityParameters")
+	}
+	if change.UserName == "" || change.AuthenticationProtocol <= NoAuth {
+		return nil, nil, errors.New("USM key change requires UserName and AuthenticationProtocol")
+	}
+	engineID := change.EngineID
+	if engineID == "" {
+		if sp.AuthoritativeEngineID == "" {
+			if _, err = x.Discover(); err != nil {
+				return nil, nil, err
+			}
+		}
+		sp.mu.Lock()
+		engineID = sp.AuthoritativeEngineID
+		sp.mu.Unlock()
+	}
+	index := usmUserIndex(engineID, change.UserName)
+	authColumn, privColumn := usmDHUserAuthKeyChange, usmDHUserPrivKeyChange
+	if change.Own {
+		authColumn, privColumn = usmDHUserOwnAuthKeyChange, usmDHUserOwnPrivKeyChange
+	}
+	columns := []string{authColumn + index}
+	keyLens := []int{change.AuthenticationProtocol.HashType().Size()}
+	if change.PrivacyProtocol > NoPriv {
+		columns = append(columns, privColumn+index)
+		keyLens = append(keyLens, usmPrivKeyLength(change.PrivacyProtocol))
+	}
+
+	result, err := x.Get(append([]string{usmDHParameters}, columns...))
+	if err != nil {
+		return nil, nil, err
+	}
+	values := make(map[string][]byte, len(result.Variables))
+	for _, v := range result.Variables {
+		if b, ok := v.Value.([]byte); ok {
+			values[normalizeOID(v.Name)] = b
+		}
+	}
+	params, err := ParseDHParameters(values[usmDHParameters])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pdus := make([]SnmpPDU, len(columns))
+	keys := make([][]byte, len(columns))
+	for i, column := range columns {
+		private, public, err := params.GenerateKey(x.randReader())
+		if err != nil {
+			return nil, nil, err
+		}
+		agentPublic, ok := values[column]
+		if !ok {
+			return nil, nil, fmt.Errorf("agent returned no public value for %s", column)
+		}
+		secret, err := params.SharedSecret(private, new(big.Int).SetBytes(agentPublic))
+		if err != nil {
+			return nil, nil, err
+		}
+		if keys[i], err = DHDeriveKey(secret, keyLens[i]); err != nil {
+			return nil, nil, err
+		}
+		pdus[i] = SnmpPDU{Name: column, Type: OctetString, Value: params.publicBytes(public)}
+	}
+
+	result, err = x.Set(pdus)
+	if err != nil {
+		return nil, nil, err
+	}
+	if result.Error != NoError {
+		return nil, nil, fmt.Errorf("USM key change of %q failed: %s at index %d", change.UserName, result.Error, result.ErrorIndex)
+	}
+	authKey = keys[0]
+	if len(keys) > 1 {
+		privKey = keys[1]
+	}
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.UserName == change.UserName && sp.AuthoritativeEngineID == engineID {
+		sp.SecretKey = authKey
+		if privKey != nil {
+			sp.PrivacyKey = privKey
+		}
+	}
+	return authKey, privKey, nil
+}
+
+// usmPrivKeyLength returns the length of the localized privacy key.
+func usmPrivKeyLength(privProtocol SnmpV3PrivProtocol) int {
+	switch privProtocol {
+	case AES192, AES192C:
+		return 24
+	case AES256, AES256C, AESGCM:
+		return 32
+	}
+	return 16
+}
@@ -0,0 +1,179 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"crypto/rand"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDHParameters(t *testing.T) {
+	prime, err := rand.Prime(rand.Reader, 512)
+	require.NoError(t, err)
+	params := &DHParameters{Prime: prime, Base: big.NewInt(2), PrivateValueLength: 160}
+	der, err := params.Marshal()
+	require.NoError(t, err)
+	parsed, err := ParseDHParameters(der)
+	require.NoError(t, err)
+	assert.Equal(t, 0, parsed.Prime.Cmp(prime))
+	assert.Equal(t, 160, parsed.PrivateValueLength)
+
+	a, pubA, err := parsed.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	assert.Equal(t, 160, a.BitLen())
+	b, pubB, err := parsed.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	s1, err := parsed.SharedSecret(a, pubB)
+	require.NoError(t, err)
+	s2, err := parsed.SharedSecret(b, pubA)
+	require.NoError(t, err)
+	assert.Equal(t, s1, s2)
+	assert.Len(t, s1, 64)
+
+	_, err = parsed.SharedSecret(a, big.NewInt(1))
+	assert.Error(t, err, "degenerate public value")
+	_, err = ParseDHParameters([]byte{0x30, 0x00})
+	assert.Error(t, err)
+
+	key, err := DHDeriveKey([]byte{1, 2, 3, 4, 5}, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{3, 4, 5}, key)
+	_, err = DHDeriveKey([]byte{1, 2}, 3)
+	assert.Error(t, err)
+}
+
+func TestChangeUsmUserKeysDH(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	prime, err := rand.Prime(rand.Reader, 512)
+	require.NoError(t, err)
+	params := &DHParameters{Prime: prime, Base: big.NewInt(2)}
+	der, err := params.Marshal()
+	require.NoError(t, err)
+
+	engineID := authorativeEngineID(t)
+	user := &UsmSecurityParameters{
+		UserName:                 "user",
+		AuthenticationProtocol:   SHA,
+		AuthenticationPassphrase: "authpassword",
+		PrivacyProtocol:          AES,
+		PrivacyPassphrase:        "privpassword",
+		AuthoritativeEngineID:    engineID,
+		AuthoritativeEngineBoots: 1,
+		AuthoritativeEngineTime:  10,
+	}
+	require.NoError(t, user.initSecurityKeys())
+
+	index := usmUserIndex(engineID, "user")
+	columns := []string{usmDHUserOwnAuthKeyChange + index, usmDHUserOwnPrivKeyChange + index}
+	agentPrivate := map[string]*big.Int{}
+	agentKeys := map[string][]byte{}
+	for _, column := range columns {
+		private, _, err := params.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		agentPrivate[column] = private
+	}
+	keyLens := map[string]int{columns[0]: 20, columns[1]: 16}
+
+	agentDone := make(chan struct{})
+	go func() {
+		defer close(agentDone)
+		decoder := &GoSNMP{Version: Version3, SecurityModel: UserSecurityModel, MsgFlags: AuthPriv, SecurityParameters: user.Copy()}
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := srvr.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req, err := decoder.SnmpDecodePacket(buf[:n])
+			if err != nil {
+				t.Errorf("agent decode: %s", err)
+				return
+			}
+			vars := make([]SnmpPDU, len(req.Variables))
+			for i, v := range req.Variables {
+				vars[i] = v
+				switch {
+				case v.Name == usmDHParameters:
+					vars[i] = SnmpPDU{Name: v.Name, Type: OctetString, Value: der}
+				case req.PDUType == GetRequest:
+					public := new(big.Int).Exp(params.Base, agentPrivate[v.Name], prime)
+					vars[i] = SnmpPDU{Name: v.Name, Type: OctetString, Value: params.publicBytes(public)}
+				case req.PDUType == SetRequest:
+					secret, err := params.SharedSecret(agentPrivate[v.Name], new(big.Int).SetBytes(v.Value.([]byte)))
+					if err != nil {
+						t.Errorf("agent secret: %s", err)
+						return
+					}
+					agentKeys[v.Name], _ = DHDeriveKey(secret, keyLens[v.Name])
+				}
+			}
+			resp := &SnmpPacket{
+				Version:            Version3,
+				MsgFlags:           AuthPriv,
+				SecurityModel:      UserSecurityModel,
+				SecurityParameters: user.Copy(),
+				MsgID:              req.MsgID,
+				RequestID:          req.RequestID,
+				ContextEngineID:    engineID,
+				PDUType:            GetResponse,
+				Variables:          vars,
+			}
+			if err := resp.SecurityParameters.initPacket(resp); err != nil {
+				t.Errorf("agent init packet: %s", err)
+				return
+			}
+			out, err := resp.MarshalMsg()
+			if err != nil {
+				t.Errorf("agent marshal: %s", err)
+				return
+			}
+			if _, err = srvr.WriteTo(out, addr); err != nil {
+				return
+			}
+		}
+	}()
+
+	x := &GoSNMP{
+		Version:            Version3,
+		Target:             srvr.LocalAddr().(*net.UDPAddr).IP.String(),
+		Port:               uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Timeout:            time.Millisecond * 500,
+		MaxOids:            MaxOids,
+		SecurityModel:      UserSecurityModel,
+		MsgFlags:           AuthPriv,
+		SecurityParameters: user.Copy(),
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	authKey, privKey, err := x.ChangeUsmUserKeysDH(UsmDHKeyChange{
+		UserName:               "user",
+		AuthenticationProtocol: SHA,
+		PrivacyProtocol:        AES,
+		Own:                    true,
+	})
+	require.NoError(t, err)
+	// the keys of the agent are read once it has stopped
+	srvr.Close()
+	<-agentDone
+	assert.Len(t, authKey, 20)
+	assert.Len(t, privKey, 16)
+	assert.Equal(t, agentKeys[columns[0]], authKey)
+	assert.Equal(t, agentKeys[columns[1]], privKey)
+
+	// the session switched to the new keys
+	sp := x.SecurityParameters.(*UsmSecurityParameters)
+	assert.Equal(t, authKey, sp.SecretKey)
+	assert.Equal(t, privKey, sp.PrivacyKey)
+}
@@ -0,0 +1,80 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+)
+
+// The AESGCM privacy protocol encrypts the scopedPDU with AES-256-GCM under
+// the privacy key localized as for AES256. The 12 byte nonce is the
+// msgAuthoritativeEngineBoots followed by the 8 byte salt sent as
+// msgPrivacyParameters, which is a counter as for AES. Both ends of a link
+// count salts under the same key, so the top bit of the boots, which RFC
+// 3414 keeps below 2^31, is set in the nonces of messages sent by the
+// authoritative engine: those without the reportableFlag, RFC 3412 setting
+// it exactly for the requests and informs of the other end. The additional
+// data binds the ciphertext to the engine ID, boots, time and user name of
+// the message. The encryptedPDU holds the ciphertext followed by the 16
+// byte tag.
+
+// gcm returns the AEAD of the privacy key and the nonce of the message
+// with flags.
+func (sp *UsmSecurityParameters) gcm(flags SnmpV3MsgFlags) (cipher.AEAD, []byte, error) {
+	if len(sp.PrivacyParameters) != 8 {
+		return nil, nil, fmt.Errorf("AESGCM: %d byte privacy parameters, want 8", len(sp.PrivacyParameters))
+	}
+	block, err := sp.cryptoProvider().NewAESCipher(sp.PrivacyKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint32(nonce, sp.AuthoritativeEngineBoots)
+	if !flags.IsReportable() {
+		nonce[0] |= 0x80
+	}
+	copy(nonce[4:], sp.PrivacyParameters)
+	return aead, nonce, nil
+}
+
+// gcmAdditionalData returns the data authenticated along with the
+// scopedPDU.
+func (sp *UsmSecurityParameters) gcmAdditionalData() []byte {
+	ad := make([]byte, 0, 2+len(sp.AuthoritativeEngineID)+8+len(sp.UserName))
+	ad = append(ad, byte(len(sp.AuthoritativeEngineID)))
+	ad = append(ad, sp.AuthoritativeEngineID...)
+	var clock [8]byte
+	binary.BigEndian.PutUint32(clock[:], sp.AuthoritativeEngineBoots)
+	binary.BigEndian.PutUint32(clock[4:], sp.AuthoritativeEngineTime)
+	ad = append(ad, clock[:]...)
+	ad = append(ad, byte(len(sp.UserName)))
+	return append(ad, sp.UserName...)
+}
+
+func (sp *UsmSecurityParameters) sealGCM(flags SnmpV3MsgFlags, scopedPdu []byte) ([]byte, error) {
+	aead, nonce, err := sp.gcm(flags)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nil, nonce, scopedPdu, sp.gcmAdditionalData()), nil
+}
+
+func (sp *UsmSecurityParameters) openGCM(flags SnmpV3MsgFlags, encryptedPdu []byte) ([]byte, error) {
+	aead, nonce, err := sp.gcm(flags)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, nonce, encryptedPdu, sp.gcmAdditionalData())
+	if err != nil {
+		return nil, fmt.Errorf("AESGCM: %w", err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAESGCMPrivacy(t *testing.T) {
+	engine := "\x80\x00\x1f\x88\x04proxy"
+	alice := UsmUser{UserName: "alice", AuthenticationProtocol: SHA256, AuthenticationPassphrase: "alicepass",
+		PrivacyProtocol: AESGCM, PrivacyPassphrase: "aliceprivpass"}
+	users := NewUsmUserTable()
+	require.NoError(t, users.Add(alice))
+	x := &GoSNMP{
+		Version:       Version3,
+		SecurityModel: UserSecurityModel,
+		MsgFlags:      AuthPriv,
+		UsmUsers:      users,
+		Logger:        NewLogger(nil),
+	}
+
+	msg := v3TrapAt(t, engine, alice, AuthPriv, 2, 100)
+	assert.False(t, bytes.Contains(msg, []byte{0x2b, 6, 1, 6, 3, 1, 1, 5, 1}), "scopedPDU sent in clear")
+	trap := x.UnmarshalTrap(append([]byte(nil), msg...), false)
+	require.NotNil(t, trap)
+	assert.Equal(t, ".1.3.6.1.6.3.1.1.5.1", trap.TrapOID)
+
+	// an endpoint configured for AES cannot decrypt it
+	aes := alice
+	aes.PrivacyProtocol = AES
+	users = NewUsmUserTable()
+	require.NoError(t, users.Add(aes))
+	x.UsmUsers = users
+	assert.Nil(t, x.UnmarshalTrap(msg, false))
+
+	key, err := LocalizePrivKey(AESGCM, SHA256, "aliceprivpass", engine)
+	require.NoError(t, err)
+	assert.Len(t, key, 32)
+	sp := &UsmSecurityParameters{
+		AuthoritativeEngineID:    engine,
+		AuthoritativeEngineBoots: 2,
+		AuthoritativeEngineTime:  100,
+		UserName:                 "alice",
+		PrivacyProtocol:          AESGCM,
+		PrivacyKey:               key,
+		PrivacyParameters:        []byte{0, 0, 0, 0, 0, 0, 0, 1},
+	}
+	sealed, err := sp.sealGCM(AuthPriv, []byte("scoped pdu"))
+	require.NoError(t, err)
+	opened, err := sp.openGCM(AuthPriv, sealed)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("scoped pdu"), opened)
+
+	// a request of the other end with the same salt has another nonce
+	request, err := sp.sealGCM(AuthPriv|Reportable, []byte("scoped pdu"))
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, request)
+	_, err = sp.openGCM(AuthPriv, request)
+	assert.Error(t, err)
+	_, err = sp.openGCM(AuthPriv|Reportable, request)
+	assert.NoError(t, err)
+
+	// the engine clock is authenticated
+	sp.AuthoritativeEngineTime = 101
+	_, err = sp.openGCM(AuthPriv, sealed)
+	assert.Error(t, err)
+	sp.AuthoritativeEngineTime = 100
+	sealed[0] ^= 1
+	_, err = sp.openGCM(AuthPriv, sealed)
+	assert.Error(t, err)
+}
@@ -0,0 +1,194 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gosnmp/gosnmp/oids"
+)
+
+// usmUserEntry columns of RFC 3414 section 5.
+const (
+	usmUserAuthKeyChange    = oids.UsmUserAuthKeyChange
+	usmUserOwnAuthKeyChange = oids.UsmUserOwnAuthKeyChange
+	usmUserPrivKeyChange    = oids.UsmUserPrivKeyChange
+	usmUserOwnPrivKeyChange = oids.UsmUserOwnPrivKeyChange
+)
+
+// KeyChange computes the value of the KeyChange textual convention of RFC
+// 3414 section 5 that changes oldKey to newKey, both localized keys of the
+// same length, using the hash of authProtocol and random, a random value of
+// the key length. The agent derives newKey from it and oldKey.
+func KeyChange(authProtocol SnmpV3AuthProtocol, oldKey, newKey, random []byte) ([]byte, error) {
+	if authProtocol <= NoAuth {
+		return nil, errors.New("KeyChange requires an authentication protocol")
+	}
+	if len(oldKey) != len(newKey) || len(random) != len(newKey) || len(newKey) == 0 {
+		return nil, fmt.Errorf("KeyChange: key lengths %d and %d and random length %d differ",
+			len(oldKey), len(newKey), len(random))
+	}
+	h := authProtocol.HashType().New()
+	temp := oldKey
+	delta := make([]byte, 0, len(newKey))
+	for len(delta) < len(newKey) {
+		h.Reset()
+		h.Write(temp)
+		h.Write(random)
+		temp = h.Sum(nil)
+		for i := 0; i < len(temp) && len(delta) < len(newKey); i++ {
+			delta = append(delta, temp[i]^newKey[len(delta)])
+		}
+	}
+	return append(append([]byte(nil), random...), delta...), nil
+}
+
+// UsmKeyChange describes new passphrases for a USM user of an agent, see
+// ChangeUsmUserKeys.
+type UsmKeyChange struct {
+	// EngineID is the authoritative engine of the user, the engine of the
+	// agent if empty.
+	EngineID string
+	UserName string
+
+	AuthenticationProtocol      SnmpV3AuthProtocol
+	OldAuthenticationPassphrase string
+	NewAuthenticationPassphrase string
+
+	// The privacy key is changed if PrivacyProtocol is set.
+	PrivacyProtocol      SnmpV3PrivProtocol
+	OldPrivacyPassphrase string
+	NewPrivacyPassphrase string
+
+	// Own uses the usmUserOwn*KeyChange objects, which a user may write to
+	// change its own keys without access to the keys of other users.
+	Own bool
+}
+
+// ChangeUsmUserKeys rotates the authentication, and optionally privacy, key
+// of a USM user of the agent as described in RFC 3414 section 11.2: the
+// KeyChange values are computed from the old and new passphrases and set in
+// a single request. The agent localizes the keys to EngineID.
+//
+// When the user is the one of the session, its SecurityParameters are
+// updated to the new passphrases once the agent accepted them.
+func (x *GoSNMP) ChangeUsmUserKeys(change UsmKeyChange) (*SnmpPacket, error) {
+	if x.Version != Version3 {
+		return nil, fmt.Errorf("USM key change requires Version3, got %v", x.Version)
+	}
+	sp, ok := x.SecurityParameters.(*UsmSecurityParameters)
+	if !ok {
+		return nil, errors.New("USM key change requires UsmSecurityParameters")
+	}
+	if change.UserName == "" || change.AuthenticationProtocol <= NoAuth {
+		return nil, errors.New("USM key change requires UserName and AuthenticationProtocol")
+	}
+	engineID := change.EngineID
+	if engineID == "" {
+		if sp.AuthoritativeEngineID == "" {
+			if _, err := x.Discover(); err != nil {
+				return nil, err
+			}
+		}
+		sp.mu.Lock()
+		engineID = sp.AuthoritativeEngineID
+		sp.mu.Unlock()
+	}
+	index := usmUserIndex(engineID, change.UserName)
+	authColumn, privColumn := usmUserAuthKeyChange, usmUserPrivKeyChange
+	if change.Own {
+		authColumn, privColumn = usmUserOwnAuthKeyChange, usmUserOwnPrivKeyChange
+	}
+
+	oldKey, err := genlocalkey(change.AuthenticationProtocol, change.OldAuthenticationPassphrase, engineID)
+	if err != nil {
+		return nil, err
+	}
+	newKey, err := genlocalkey(change.AuthenticationProtocol, change.NewAuthenticationPassphrase, engineID)
+	if err != nil {
+		return nil, err
+	}
+	value, err := keyChangeValue(x.randReader(), change.AuthenticationProtocol, oldKey, newKey)
+	if err != nil {
+		return nil, err
+	}
+	pdus := []SnmpPDU{{Name: authColumn + index, Type: OctetString, Value: value}}
+
+	if change.PrivacyProtocol > NoPriv {
+		oldKey, err = usmPrivKey(change.PrivacyProtocol, change.AuthenticationProtocol, change.OldPrivacyPassphrase, engineID)
+		if err != nil {
+			return nil, err
+		}
+		newKey, err = usmPrivKey(change.PrivacyProtocol, change.AuthenticationProtocol, change.NewPrivacyPassphrase, engineID)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = keyChangeValue(x.randReader(), change.AuthenticationProtocol, oldKey, newKey); err != nil {
+			return nil, err
+		}
+		pdus = append(pdus, SnmpPDU{Name: privColumn + index, Type: OctetString, Value: value})
+	}
+
+	result, err := x.Set(pdus)
+	if err != nil {
+		return result, err
+	}
+	if result.Error != NoError {
+		return result, fmt.Errorf("USM key change of %q failed: %s at index %d", change.UserName, result.Error, result.ErrorIndex)
+	}
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.UserName == change.UserName && sp.AuthoritativeEngineID == engineID {
+		sp.AuthenticationPassphrase = change.NewAuthenticationPassphrase
+		sp.SecretKey = nil
+		if change.PrivacyProtocol > NoPriv {
+			sp.PrivacyPassphrase = change.NewPrivacyPassphrase
+			sp.PrivacyKey = nil
+		}
+		if err = sp.initSecurityKeysNoLock(); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// keyChangeValue computes a KeyChange value with a fresh random component
+// read from r.
+func keyChangeValue(r io.Reader, authProtocol SnmpV3AuthProtocol, oldKey, newKey []byte) ([]byte, error) {
+	random := make([]byte, len(newKey))
+	if _, err := io.ReadFull(r, random); err != nil {
+		return nil, err
+	}
+	return KeyChange(authProtocol, oldKey, newKey, random)
+}
+
+// usmPrivKey returns the localized privacy key as stored by the agent.
+func usmPrivKey(privProtocol SnmpV3PrivProtocol, authProtocol SnmpV3AuthProtocol, passphrase, engineID string) ([]byte, error) {
+	key, err := genPrivKey(privProtocol, authProtocol, passphrase, engineID)
+	if err != nil {
+		return nil, err
+	}
+	if privProtocol == DES && len(key) > 16 {
+		key = key[:16]
+	}
+	return key, nil
+}
+
+// usmUserIndex returns the usmUserTable index of a user: the engine ID and
+// user name, each prefixed by its length.
+func usmUserIndex(engineID, userName string) string {
+	var b strings.Builder
+	for _, s := range []string{engineID, userName} {
+		fmt.Fprintf(&b, ".%d", len(s))
+		for i := 0; i < len(s); i++ {
+			fmt.Fprintf(&b, ".%d", s[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,164 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// applyKeyChange is the agent side of the KeyChange textual convention.
+func applyKeyChange(authProtocol SnmpV3AuthProtocol, oldKey, value []byte) []byte {
+	random, delta := value[:len(oldKey)], value[len(oldKey):]
+	h := authProtocol.HashType().New()
+	temp := oldKey
+	newKey := make([]byte, 0, len(delta))
+	for len(newKey) < len(delta) {
+		h.Reset()
+		h.Write(temp)
+		h.Write(random)
+		temp = h.Sum(nil)
+		for i := 0; i < len(temp) && len(newKey) < len(delta); i++ {
+			newKey = append(newKey, temp[i]^delta[len(newKey)])
+		}
+	}
+	return newKey
+}
+
+func TestKeyChange(t *testing.T) {
+	for _, proto := range []SnmpV3AuthProtocol{MD5, SHA, SHA256, SHA512} {
+		for _, size := range []int{16, 24, 32, 64} {
+			oldKey := bytes.Repeat([]byte{1}, size)
+			newKey := bytes.Repeat([]byte{2}, size)
+			random := bytes.Repeat([]byte{3}, size)
+			value, err := KeyChange(proto, oldKey, newKey, random)
+			require.NoError(t, err)
+			assert.Len(t, value, 2*size)
+			assert.Equal(t, newKey, applyKeyChange(proto, oldKey, value), "%s %d", proto, size)
+		}
+	}
+	_, err := KeyChange(SHA, make([]byte, 20), make([]byte, 16), make([]byte, 16))
+	assert.Error(t, err)
+	_, err = KeyChange(NoAuth, make([]byte, 16), make([]byte, 16), make([]byte, 16))
+	assert.Error(t, err)
+
+	assert.Equal(t, ".5.128.0.0.9.3.3.98.111.98", usmUserIndex("\x80\x00\x00\x09\x03", "bob"))
+}
+
+func TestChangeUsmUserKeys(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	engineID := authorativeEngineID(t)
+	user := &UsmSecurityParameters{
+		UserName:                 "user",
+		AuthenticationProtocol:   SHA,
+		AuthenticationPassphrase: "authpassword",
+		PrivacyProtocol:          AES,
+		PrivacyPassphrase:        "privpassword",
+		AuthoritativeEngineID:    engineID,
+		AuthoritativeEngineBoots: 1,
+		AuthoritativeEngineTime:  10,
+	}
+	require.NoError(t, user.initSecurityKeys())
+	agentKeys := map[string][]byte{
+		usmUserOwnAuthKeyChange: user.SecretKey,
+		usmUserOwnPrivKeyChange: user.PrivacyKey,
+	}
+	agentDone := make(chan struct{})
+	go func() {
+		defer close(agentDone)
+		decoder := &GoSNMP{Version: Version3, SecurityModel: UserSecurityModel, MsgFlags: AuthPriv, SecurityParameters: user.Copy()}
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := srvr.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req, err := decoder.SnmpDecodePacket(buf[:n])
+			if err != nil {
+				t.Errorf("agent decode: %s", err)
+				return
+			}
+			for _, v := range req.Variables {
+				for column, key := range agentKeys {
+					if v.Name == column+usmUserIndex(engineID, "user") {
+						agentKeys[column] = applyKeyChange(SHA, key, v.Value.([]byte))
+					}
+				}
+			}
+			resp := &SnmpPacket{
+				Version:            Version3,
+				MsgFlags:           AuthPriv,
+				SecurityModel:      UserSecurityModel,
+				SecurityParameters: user.Copy(),
+				MsgID:              req.MsgID,
+				RequestID:          req.RequestID,
+				ContextEngineID:    engineID,
+				PDUType:            GetResponse,
+				Variables:          req.Variables,
+			}
+			if err := resp.SecurityParameters.initPacket(resp); err != nil {
+				t.Errorf("agent init packet: %s", err)
+				return
+			}
+			out, err := resp.MarshalMsg()
+			if err != nil {
+				t.Errorf("agent marshal: %s", err)
+				return
+			}
+			if _, err = srvr.WriteTo(out, addr); err != nil {
+				return
+			}
+		}
+	}()
+
+	x := &GoSNMP{
+		Version:            Version3,
+		Target:             srvr.LocalAddr().(*net.UDPAddr).IP.String(),
+		Port:               uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Timeout:            time.Millisecond * 500,
+		MaxOids:            MaxOids,
+		SecurityModel:      UserSecurityModel,
+		MsgFlags:           AuthPriv,
+		SecurityParameters: user.Copy(),
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	_, err = x.ChangeUsmUserKeys(UsmKeyChange{
+		UserName:                    "user",
+		AuthenticationProtocol:      SHA,
+		OldAuthenticationPassphrase: "authpassword",
+		NewAuthenticationPassphrase: "newauthpassword",
+		PrivacyProtocol:             AES,
+		OldPrivacyPassphrase:        "privpassword",
+		NewPrivacyPassphrase:        "newprivpassword",
+		Own:                         true,
+	})
+	require.NoError(t, err)
+
+	newAuth, err := genlocalkey(SHA, "newauthpassword", engineID)
+	require.NoError(t, err)
+	newPriv, err := genPrivKey(AES, SHA, "newprivpassword", engineID)
+	require.NoError(t, err)
+	// the keys of the agent are read once it has stopped
+	srvr.Close()
+	<-agentDone
+	assert.Equal(t, newAuth, agentKeys[usmUserOwnAuthKeyChange])
+	assert.Equal(t, newPriv, agentKeys[usmUserOwnPrivKeyChange])
+
+	// the session switched to the new keys
+	sp := x.SecurityParameters.(*UsmSecurityParameters)
+	assert.Equal(t, "newauthpassword", sp.AuthenticationPassphrase)
+	assert.Equal(t, newAuth, sp.SecretKey)
+	assert.Equal(t, newPriv, sp.PrivacyKey)
+}
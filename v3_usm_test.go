@@ -1,11 +1,17 @@
 package gosnmp
 
 import (
+	"bytes"
 	"encoding/hex"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -123,6 +129,95 @@ func TestIsAuthenticaSHA224(t *testing.T) {
 	require.True(t, authentic, "Packet was not considered to be authentic")
 }
 
+func TestStrictAuthentication(t *testing.T) {
+	sp := &UsmSecurityParameters{
+		AuthoritativeEngineBoots: 43,
+		AuthoritativeEngineID:    authorativeEngineID(t),
+		AuthoritativeEngineTime:  2113189,
+		UserName:                 "usr-sha224-none",
+		AuthenticationParameters: packetSHA224AuthenticationParams(t),
+		AuthenticationProtocol:   SHA224,
+		SecretKey:                correctKeySHA224(t),
+		Logger:                   NewLogger(log.New(ioutil.Discard, "", 0)),
+	}
+	packet := &SnmpPacket{MsgFlags: AuthNoPriv, SecurityParameters: sp}
+	x := &GoSNMP{Version: Version3, MsgFlags: AuthNoPriv, SecurityParameters: sp, StrictAuthentication: true}
+
+	authentic, err := sp.verifyDigest(packetSHA224NoAuthentication(t), packet, true)
+	require.NoError(t, err)
+	assert.True(t, authentic)
+	require.NoError(t, x.testAuthentication(packetSHA224NoAuthentication(t), packet, false))
+
+	// a truncated digest fails closed
+	sp.AuthenticationParameters = packetSHA224AuthenticationParams(t)[:4]
+	authentic, err = sp.verifyDigest(packetSHA224NoAuthentication(t), packet, true)
+	assert.ErrorIs(t, err, ErrWrongDigest)
+	assert.False(t, authentic)
+	sp.AuthenticationParameters = ""
+	assert.ErrorIs(t, x.testAuthentication(packetSHA224NoAuthentication(t), packet, false), ErrWrongDigest)
+
+	tampered := []byte(packetSHA224AuthenticationParams(t))
+	tampered[len(tampered)-1] ^= 1
+	sp.AuthenticationParameters = string(tampered)
+	authentic, err = sp.verifyDigest(packetSHA224NoAuthentication(t), packet, true)
+	require.NoError(t, err)
+	assert.False(t, authentic)
+	assert.ErrorIs(t, x.testAuthentication(packetSHA224NoAuthentication(t), packet, false), ErrWrongDigest)
+
+	// failures authenticating outgoing messages are returned
+	out := &SnmpPacket{Version: Version3, MsgFlags: AuthNoPriv, strictAuth: true}
+	_, err = out.authenticate([]byte{0x30, 0})
+	assert.Error(t, err)
+}
+
+// constReader is an entropy source returning the same byte forever.
+type constReader byte
+
+func (r constReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+func TestRandSource(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	newSession := func(priv SnmpV3PrivProtocol) *GoSNMP {
+		x := &GoSNMP{
+			Target:        "127.0.0.1",
+			Port:          uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+			Version:       Version3,
+			SecurityModel: UserSecurityModel,
+			MsgFlags:      AuthPriv,
+			Rand:          constReader(1),
+			SecurityParameters: &UsmSecurityParameters{
+				UserName:                 "user",
+				AuthenticationProtocol:   SHA,
+				AuthenticationPassphrase: "authpassword",
+				PrivacyProtocol:          priv,
+				PrivacyPassphrase:        "privpassword",
+			},
+		}
+		require.NoError(t, x.Connect())
+		x.Conn.Close()
+		return x
+	}
+
+	x := newSession(AES)
+	assert.Equal(t, uint32(0x01010101), x.requestID)
+	assert.Equal(t, uint32(0x01010101), x.msgID)
+	assert.Equal(t, uint64(0x0101010101010101), x.SecurityParameters.(*UsmSecurityParameters).localAESSalt)
+	x = newSession(DES)
+	assert.Equal(t, uint32(0x01010101), x.SecurityParameters.(*UsmSecurityParameters).localDESSalt)
+
+	value, err := keyChangeValue(constReader(7), SHA, make([]byte, 20), make([]byte, 20))
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte{7}, 20), value[:20])
+}
+
 func correctKeySHA512(t *testing.T) []byte {
 	correctKey, err := hex.DecodeString("c336e5e6396926813d623984610e8f0cd7f419da75c82ac50927c84fd92027f7cdd849ce983036dca67bfb1e8fde2a8c2d45cd2f0d3e0b0b929f7dda462a58cf")
 	require.NoError(t, err, "Correct key initialization failed.")
@@ -224,3 +319,201 @@ func TestIsAuthenticaSHA512(t *testing.T) {
 	require.NoError(t, err, "Authentication check of key failed")
 	require.True(t, authentic, "Packet was not considered to be authentic")
 }
+
+// rebootedAgent answers requests carrying stale engine boots with an
+// authenticated usmStatsNotInTimeWindows report, and all others with a
+// response. reports counts the reports sent. A flapping agent reboots after
+// every report. The agent runs until srvr is closed, its error is checked
+// once the test ends.
+func startRebootedAgent(t *testing.T, srvr *net.UDPConn, engineID string, boots uint32, flapping bool, reports *int32) {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- rebootedAgent(srvr, engineID, boots, flapping, reports)
+	}()
+	t.Cleanup(func() {
+		srvr.Close()
+		require.NoError(t, <-errc)
+	})
+}
+
+func rebootedAgent(srvr *net.UDPConn, engineID string, boots uint32, flapping bool, reports *int32) error {
+	decoder := &GoSNMP{
+		Version:       Version3,
+		SecurityModel: UserSecurityModel,
+		MsgFlags:      AuthNoPriv,
+		SecurityParameters: &UsmSecurityParameters{
+			UserName:                 "user",
+			AuthenticationProtocol:   SHA,
+			AuthenticationPassphrase: "authpassword",
+			PrivacyProtocol:          NoPriv,
+			AuthoritativeEngineID:    engineID,
+		},
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := srvr.ReadFrom(buf)
+		if err != nil {
+			return nil
+		}
+		req, err := decoder.SnmpDecodePacket(buf[:n])
+		if err != nil {
+			return fmt.Errorf("agent decode: %w", err)
+		}
+		reqSp := req.SecurityParameters.(*UsmSecurityParameters)
+		sp := &UsmSecurityParameters{
+			AuthoritativeEngineID:    engineID,
+			AuthoritativeEngineBoots: boots,
+			AuthoritativeEngineTime:  10,
+			UserName:                 reqSp.UserName,
+			AuthenticationProtocol:   SHA,
+			AuthenticationPassphrase: "authpassword",
+			PrivacyProtocol:          NoPriv,
+		}
+		if err := sp.initSecurityKeys(); err != nil {
+			return err
+		}
+		resp := &SnmpPacket{
+			Version:            Version3,
+			MsgFlags:           AuthNoPriv,
+			SecurityModel:      UserSecurityModel,
+			SecurityParameters: sp,
+			MsgID:              req.MsgID,
+			RequestID:          req.RequestID,
+			ContextEngineID:    engineID,
+			PDUType:            GetResponse,
+			Variables:          []SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "agent"}},
+		}
+		if reqSp.AuthoritativeEngineBoots != boots {
+			atomic.AddInt32(reports, 1)
+			resp.PDUType = Report
+			resp.Variables = []SnmpPDU{{Name: usmStatsNotInTimeWindows, Type: Counter32, Value: uint32(1)}}
+			if flapping {
+				boots++
+			}
+		}
+		out, err := resp.MarshalMsg()
+		if err != nil {
+			return fmt.Errorf("agent marshal: %w", err)
+		}
+		if _, err = srvr.WriteTo(out, addr); err != nil {
+			return nil
+		}
+	}
+}
+
+func TestNotInTimeWindowResync(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	engineID := authorativeEngineID(t)
+	var reports int32
+	startRebootedAgent(t, srvr, engineID, 2, false, &reports)
+
+	x := &GoSNMP{
+		Version:       Version3,
+		Target:        srvr.LocalAddr().(*net.UDPAddr).IP.String(),
+		Port:          uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Timeout:       time.Millisecond * 500,
+		MaxOids:       MaxOids,
+		SecurityModel: UserSecurityModel,
+		MsgFlags:      AuthNoPriv,
+		SecurityParameters: &UsmSecurityParameters{
+			UserName:                 "user",
+			AuthenticationProtocol:   SHA,
+			AuthenticationPassphrase: "authpassword",
+			PrivacyProtocol:          NoPriv,
+			AuthoritativeEngineID:    engineID,
+			AuthoritativeEngineBoots: 1,
+			AuthoritativeEngineTime:  5000,
+		},
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	result, err := x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, GetResponse, result.PDUType)
+	assert.Equal(t, "agent", string(result.Variables[0].Value.([]byte)))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&reports))
+
+	sp := x.SecurityParameters.(*UsmSecurityParameters)
+	assert.Equal(t, uint32(2), sp.AuthoritativeEngineBoots)
+
+	// the refreshed parameters are used for subsequent requests
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&reports))
+}
+
+func TestNotInTimeWindowResyncFails(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	engineID := authorativeEngineID(t)
+	var reports int32
+	startRebootedAgent(t, srvr, engineID, 2, true, &reports)
+
+	x := &GoSNMP{
+		Version:       Version3,
+		Target:        srvr.LocalAddr().(*net.UDPAddr).IP.String(),
+		Port:          uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Timeout:       time.Millisecond * 500,
+		MaxOids:       MaxOids,
+		SecurityModel: UserSecurityModel,
+		MsgFlags:      AuthNoPriv,
+		SecurityParameters: &UsmSecurityParameters{
+			UserName:                 "user",
+			AuthenticationProtocol:   SHA,
+			AuthenticationPassphrase: "authpassword",
+			PrivacyProtocol:          NoPriv,
+			AuthoritativeEngineID:    engineID,
+			AuthoritativeEngineBoots: 1,
+		},
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	// the request is retransmitted once, then the report is surfaced as an
+	// error rather than returned as if it were a response
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	assert.ErrorIs(t, err, ErrNotInTimeWindow)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&reports))
+
+	var reportErr *ReportError
+	require.ErrorAs(t, err, &reportErr)
+	assert.Equal(t, usmStatsNotInTimeWindows, reportErr.OID)
+	assert.Equal(t, uint32(1), reportErr.Counter)
+}
+
+func TestReportError(t *testing.T) {
+	tests := []struct {
+		oid      string
+		expected error
+	}{
+		{".1.3.6.1.6.3.15.1.1.1.0", ErrUnknownSecurityLevel},
+		{".1.3.6.1.6.3.15.1.1.2.0", ErrNotInTimeWindow},
+		{".1.3.6.1.6.3.15.1.1.3.0", ErrUnknownUsername},
+		{".1.3.6.1.6.3.15.1.1.4.0", ErrUnknownEngineID},
+		{".1.3.6.1.6.3.15.1.1.5.0", ErrWrongDigest},
+		{".1.3.6.1.6.3.15.1.1.6.0", ErrDecryption},
+		{".1.3.6.1.6.3.11.2.1.1.0", ErrUnknownSecurityModels},
+		{".1.3.6.1.6.3.11.2.1.2.0", ErrInvalidMsgs},
+		{".1.3.6.1.6.3.11.2.1.3.0", ErrUnknownPDUHandlers},
+		{".1.3.6.1.4.1.9.9.999.0", ErrUnknownReportPDU},
+	}
+	for _, test := range tests {
+		packet := &SnmpPacket{
+			PDUType:   Report,
+			Variables: []SnmpPDU{{Name: test.oid, Type: Counter32, Value: uint(9)}},
+		}
+		var err error = newReportError(packet)
+		assert.ErrorIs(t, err, test.expected, test.oid)
+		assert.Contains(t, err.Error(), test.oid)
+
+		var reportErr *ReportError
+		require.ErrorAs(t, err, &reportErr)
+		assert.Equal(t, uint32(9), reportErr.Counter)
+	}
+}
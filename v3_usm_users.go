@@ -0,0 +1,172 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// UsmUser holds the credentials of a USM user, see RFC 3414 section 2.1.
+type UsmUser struct {
+	// EngineID is the authoritative engine the user belongs to, e.g. the
+	// engine ID of a device sending traps. An empty EngineID matches any
+	// engine, with keys localized to the engine of each message.
+	EngineID string
+	UserName string
+
+	AuthenticationProtocol   SnmpV3AuthProtocol
+	AuthenticationPassphrase string
+	PrivacyProtocol          SnmpV3PrivProtocol
+	PrivacyPassphrase        string
+}
+
+type usmUserKey struct {
+	engineID string
+	userName string
+}
+
+type usmUserEntry struct {
+	user UsmUser
+	// keys localized per engine ID, shared by all messages of the engine
+	keys map[string]usmLocalizedKeys
+}
+
+type usmLocalizedKeys struct {
+	auth []byte
+	priv []byte
+}
+
+// UsmUserTable is the set of USM users known to the receiving side, consulted
+// through GoSNMP.UsmUsers when decoding inbound SNMPv3 messages such as
+// traps and informs. It is safe for concurrent use.
+type UsmUserTable struct {
+	mu    sync.RWMutex
+	users map[usmUserKey]*usmUserEntry
+}
+
+// NewUsmUserTable returns an empty UsmUserTable.
+func NewUsmUserTable() *UsmUserTable {
+	return &UsmUserTable{users: make(map[usmUserKey]*usmUserEntry)}
+}
+
+// Add adds user to the table, replacing a user with the same engine ID and
+// name.
+func (t *UsmUserTable) Add(user UsmUser) error {
+	if user.UserName == "" {
+		return errors.New("UsmUserTable: UserName is required")
+	}
+	if user.AuthenticationProtocol > NoAuth && user.AuthenticationPassphrase == "" {
+		return fmt.Errorf("UsmUserTable: user %q has no AuthenticationPassphrase", user.UserName)
+	}
+	if user.PrivacyProtocol > NoPriv {
+		if user.AuthenticationProtocol <= NoAuth {
+			return fmt.Errorf("UsmUserTable: user %q has privacy without authentication", user.UserName)
+		}
+		if user.PrivacyPassphrase == "" {
+			return fmt.Errorf("UsmUserTable: user %q has no PrivacyPassphrase", user.UserName)
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.users[usmUserKey{user.EngineID, user.UserName}] = &usmUserEntry{
+		user: user,
+		keys: make(map[string]usmLocalizedKeys),
+	}
+	return nil
+}
+
+// Remove removes the user with exactly this engine ID and name, and reports
+// whether it was present.
+func (t *UsmUserTable) Remove(engineID, userName string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := usmUserKey{engineID, userName}
+	_, ok := t.users[key]
+	delete(t.users, key)
+	return ok
+}
+
+// Lookup returns the user userName of engineID, falling back to a user
+// added for any engine.
+func (t *UsmUserTable) Lookup(engineID, userName string) (UsmUser, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	entry := t.lookupNoLock(engineID, userName)
+	if entry == nil {
+		return UsmUser{}, false
+	}
+	return entry.user, true
+}
+
+// Len returns the number of users in the table.
+func (t *UsmUserTable) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.users)
+}
+
+func (t *UsmUserTable) lookupNoLock(engineID, userName string) *usmUserEntry {
+	if entry, ok := t.users[usmUserKey{engineID, userName}]; ok {
+		return entry
+	}
+	return t.users[usmUserKey{"", userName}]
+}
+
+// localized returns the user and its keys localized to engineID.
+func (t *UsmUserTable) localized(engineID, userName string) (UsmUser, usmLocalizedKeys, error) {
+	t.mu.RLock()
+	entry := t.lookupNoLock(engineID, userName)
+	var keys usmLocalizedKeys
+	var cached bool
+	if entry != nil {
+		keys, cached = entry.keys[engineID]
+	}
+	t.mu.RUnlock()
+	if entry == nil {
+		return UsmUser{}, keys, fmt.Errorf("%w: %q", ErrUnknownUsername, userName)
+	}
+	if cached {
+		return entry.user, keys, nil
+	}
+
+	user := entry.user
+	var err error
+	if user.AuthenticationProtocol > NoAuth {
+		if keys.auth, err = genlocalkey(user.AuthenticationProtocol, user.AuthenticationPassphrase, engineID); err != nil {
+			return user, keys, err
+		}
+	}
+	if user.PrivacyProtocol > NoPriv {
+		if keys.priv, err = genPrivKey(user.PrivacyProtocol, user.AuthenticationProtocol, user.PrivacyPassphrase, engineID); err != nil {
+			return user, keys, err
+		}
+	}
+	t.mu.Lock()
+	entry.keys[engineID] = keys
+	t.mu.Unlock()
+	return user, keys, nil
+}
+
+// applyUserTableNoLock sets the credentials of the parsed user name and
+// engine ID from the user table.
+func (sp *UsmSecurityParameters) applyUserTableNoLock(flags SnmpV3MsgFlags) error {
+	if sp.UserName == "" && flags&AuthNoPriv == 0 {
+		// discovery and unauthenticated reports carry no user
+		return nil
+	}
+	user, keys, err := sp.users.localized(sp.AuthoritativeEngineID, sp.UserName)
+	if err != nil {
+		return err
+	}
+	sp.AuthenticationProtocol = user.AuthenticationProtocol
+	sp.AuthenticationPassphrase = user.AuthenticationPassphrase
+	sp.PrivacyProtocol = user.PrivacyProtocol
+	sp.PrivacyPassphrase = user.PrivacyPassphrase
+	sp.SecretKey = keys.auth
+	sp.PrivacyKey = keys.priv
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// v3Trap returns an SNMPv3 trap sent by engineID as userName.
+func v3Trap(t *testing.T, engineID string, user UsmUser, flags SnmpV3MsgFlags) []byte {
+	return v3TrapAt(t, engineID, user, flags, 1, 1)
+}
+
+// v3TrapAt builds a trap of engineID at the given engine boots and time.
+func v3TrapAt(t *testing.T, engineID string, user UsmUser, flags SnmpV3MsgFlags, boots, engineTime uint32) []byte {
+	sp := &UsmSecurityParameters{
+		AuthoritativeEngineID:    engineID,
+		AuthoritativeEngineBoots: boots,
+		AuthoritativeEngineTime:  engineTime,
+		UserName:                 user.UserName,
+		AuthenticationProtocol:   user.AuthenticationProtocol,
+		AuthenticationPassphrase: user.AuthenticationPassphrase,
+		PrivacyProtocol:          user.PrivacyProtocol,
+		PrivacyPassphrase:        user.PrivacyPassphrase,
+		Logger:                   NewLogger(nil),
+	}
+	require.NoError(t, sp.initSecurityKeys())
+	packet := &SnmpPacket{
+		Version:            Version3,
+		MsgFlags:           flags,
+		SecurityModel:      UserSecurityModel,
+		SecurityParameters: sp,
+		ContextEngineID:    engineID,
+		PDUType:            SNMPv2Trap,
+		RequestID:          1,
+		MsgID:              1,
+		Variables:          []SnmpPDU{{Name: ".1.3.6.1.6.3.1.1.4.1.0", Type: ObjectIdentifier, Value: ".1.3.6.1.6.3.1.1.5.1"}},
+	}
+	require.NoError(t, sp.initPacket(packet))
+	out, err := packet.MarshalMsg()
+	require.NoError(t, err)
+	return out
+}
+
+func TestUsmUserTable(t *testing.T) {
+	engine1 := "\x80\x00\x1f\x88\x04sw1"
+	engine2 := "\x80\x00\x1f\x88\x04sw2"
+	alice := UsmUser{EngineID: engine1, UserName: "alice", AuthenticationProtocol: SHA, AuthenticationPassphrase: "alicepass",
+		PrivacyProtocol: AES, PrivacyPassphrase: "aliceprivpass"}
+	bob := UsmUser{UserName: "bob", AuthenticationProtocol: MD5, AuthenticationPassphrase: "bobpassword"}
+
+	users := NewUsmUserTable()
+	require.NoError(t, users.Add(alice))
+	require.NoError(t, users.Add(bob))
+	assert.Error(t, users.Add(UsmUser{UserName: "nopass", AuthenticationProtocol: SHA}))
+	assert.Error(t, users.Add(UsmUser{UserName: "privonly", PrivacyProtocol: AES, PrivacyPassphrase: "x"}))
+	assert.Equal(t, 2, users.Len())
+
+	got, ok := users.Lookup(engine1, "alice")
+	assert.True(t, ok)
+	assert.Equal(t, alice, got)
+	_, ok = users.Lookup(engine2, "alice")
+	assert.False(t, ok, "alice is only known for engine1")
+	got, ok = users.Lookup(engine2, "bob")
+	assert.True(t, ok, "bob matches any engine")
+	assert.Equal(t, bob, got)
+
+	receiver := &GoSNMP{
+		Version:       Version3,
+		SecurityModel: UserSecurityModel,
+		UsmUsers:      users,
+		Logger:        NewLogger(nil),
+	}
+	trap := receiver.UnmarshalTrap(v3Trap(t, engine1, alice, AuthPriv), false)
+	require.NotNil(t, trap)
+	assert.Equal(t, ".1.3.6.1.6.3.1.1.5.1", trap.Variables[0].Value)
+	assert.Equal(t, "alice", trap.SecurityParameters.(*UsmSecurityParameters).UserName)
+
+	for _, engineID := range []string{engine1, engine2} {
+		trap = receiver.UnmarshalTrap(v3Trap(t, engineID, bob, AuthNoPriv), false)
+		require.NotNil(t, trap)
+	}
+
+	// wrong passphrase, unknown engine for alice, unknown user
+	mallory := bob
+	mallory.AuthenticationPassphrase = "guessedpassword"
+	assert.Nil(t, receiver.UnmarshalTrap(v3Trap(t, engine1, mallory, AuthNoPriv), false))
+	assert.Nil(t, receiver.UnmarshalTrap(v3Trap(t, engine2, alice, AuthPriv), false))
+	carol := UsmUser{UserName: "carol", AuthenticationProtocol: SHA, AuthenticationPassphrase: "carolpass"}
+	assert.Nil(t, receiver.UnmarshalTrap(v3Trap(t, engine1, carol, AuthNoPriv), false))
+
+	_, err := receiver.SnmpDecodePacket(v3Trap(t, engine1, carol, AuthNoPriv))
+	assert.ErrorIs(t, err, ErrUnknownUsername)
+
+	assert.True(t, users.Remove("", "bob"))
+	assert.False(t, users.Remove("", "bob"))
+	assert.Nil(t, receiver.UnmarshalTrap(v3Trap(t, engine1, bob, AuthNoPriv), false))
+}
@@ -0,0 +1,258 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// VACM errors, RFC 3415 section 3.2.
+var (
+	// ErrVACMNoGroup is returned for a community or user of no group.
+	ErrVACMNoGroup = errors.New("no group of the principal")
+
+	// ErrVACMNoAccess is returned for a group without access at the
+	// security level of a request.
+	ErrVACMNoAccess = errors.New("no access entry of the group")
+)
+
+// VACMViewType is the kind of access to a view.
+type VACMViewType uint8
+
+// VACM view types.
+const (
+	// VACMRead is the access of GetRequest, GetNextRequest and
+	// GetBulkRequest.
+	VACMRead VACMViewType = iota
+	// VACMWrite is the access of SetRequest.
+	VACMWrite
+	// VACMNotify is the access of the variables of notifications.
+	VACMNotify
+)
+
+func (t VACMViewType) String() string {
+	switch t {
+	case VACMRead:
+		return "read"
+	case VACMWrite:
+		return "write"
+	case VACMNotify:
+		return "notify"
+	}
+	return fmt.Sprintf("VACMViewType(%d)", uint8(t))
+}
+
+// ViewSubtree is a view tree family of RFC 3415: the variables below OID,
+// where the sub-identifiers whose bit of Mask is 0 may be anything, e.g.
+// OID ".1.3.6.1.2.1.2.2.1.1.3" and Mask 0xff, 0xa0 for the columns of the
+// row 3 of ifTable. Bits are taken from the most significant bit of the
+// first octet, and missing bits are 1.
+type ViewSubtree struct {
+	OID  string
+	Mask []byte
+
+	// Excluded removes the family from the view rather than adding it.
+	Excluded bool
+}
+
+// VACMAccess are the views of a group. A view name left empty gives no
+// access.
+type VACMAccess struct {
+	// Level is the lowest security level of the SNMPv3 requests of the
+	// group, NoAuthNoPriv, AuthNoPriv or AuthPriv. Community requests are
+	// of level NoAuthNoPriv.
+	Level SnmpV3MsgFlags
+
+	ReadView   string
+	WriteView  string
+	NotifyView string
+}
+
+// VACM is the view-based access control of RFC 3415 of an Agent: the
+// communities and USM users belong to groups, whose access is a set of
+// views, each view a set of subtrees:
+//
+//	v := gosnmp.NewVACM()
+//	err := v.AddView("system", gosnmp.ViewSubtree{OID: oids.System})
+//	err = v.AddView("all", gosnmp.ViewSubtree{OID: ".1"})
+//	err = v.AddCommunity("public", "monitoring")
+//	err = v.AddUser("admin", "admins")
+//	err = v.SetAccess("monitoring", gosnmp.VACMAccess{ReadView: "system"})
+//	err = v.SetAccess("admins", gosnmp.VACMAccess{Level: gosnmp.AuthPriv, ReadView: "all", WriteView: "all"})
+//	agent.VACM = v
+//
+// Contexts are not distinguished. It is safe for concurrent use.
+type VACM struct {
+	mu     sync.RWMutex
+	groups map[vacmPrincipal]string
+	access map[string]VACMAccess
+	views  map[string][]vacmFamily
+}
+
+// vacmPrincipal is a community, or a USM user if user is set.
+type vacmPrincipal struct {
+	user bool
+	name string
+}
+
+type vacmFamily struct {
+	subids   []uint32
+	mask     []byte
+	excluded bool
+}
+
+// NewVACM returns a VACM without groups, which gives no access.
+func NewVACM() *VACM {
+	return &VACM{
+		groups: make(map[vacmPrincipal]string),
+		access: make(map[string]VACMAccess),
+		views:  make(map[string][]vacmFamily),
+	}
+}
+
+// AddCommunity makes the SNMPv1 and SNMPv2c requests with community members
+// of group, replacing its earlier group.
+func (v *VACM) AddCommunity(community, group string) error {
+	return v.addMember(vacmPrincipal{name: community}, group)
+}
+
+// AddUser makes the SNMPv3 requests of the USM user userName members of
+// group, replacing its earlier group.
+func (v *VACM) AddUser(userName, group string) error {
+	return v.addMember(vacmPrincipal{user: true, name: userName}, group)
+}
+
+func (v *VACM) addMember(p vacmPrincipal, group string) error {
+	if group == "" {
+		return errors.New("empty group name")
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.groups[p] = group
+	return nil
+}
+
+// SetAccess sets the access of group.
+func (v *VACM) SetAccess(group string, access VACMAccess) error {
+	switch access.Level {
+	case NoAuthNoPriv, AuthNoPriv, AuthPriv:
+	default:
+		return fmt.Errorf("invalid security level 0x%x", byte(access.Level))
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.access[group] = access
+	return nil
+}
+
+// AddView adds subtrees to the view name.
+func (v *VACM) AddView(name string, subtrees ...ViewSubtree) error {
+	families := make([]vacmFamily, 0, len(subtrees))
+	for _, s := range subtrees {
+		subids, err := parseSubids(s.OID)
+		if err != nil {
+			return err
+		}
+		if len(s.Mask) > 16 {
+			return fmt.Errorf("mask of %s longer than 16 octets", s.OID)
+		}
+		families = append(families, vacmFamily{subids: subids, mask: append([]byte(nil), s.Mask...), excluded: s.Excluded})
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.views[name] = append(v.views[name], families...)
+	return nil
+}
+
+// CommunityAllowed reports whether the requests with community may access
+// the variable oid.
+func (v *VACM) CommunityAllowed(community string, t VACMViewType, oid string) bool {
+	access, err := v.accessOf(vacmPrincipal{name: community}, NoAuthNoPriv)
+	return err == nil && v.InView(access.view(t), oid)
+}
+
+// UserAllowed reports whether the USM user userName may access the variable
+// oid with requests of the security level.
+func (v *VACM) UserAllowed(userName string, level SnmpV3MsgFlags, t VACMViewType, oid string) bool {
+	access, err := v.accessOf(vacmPrincipal{user: true, name: userName}, level)
+	return err == nil && v.InView(access.view(t), oid)
+}
+
+// accessOf returns the access of the requests of p at level.
+func (v *VACM) accessOf(p vacmPrincipal, level SnmpV3MsgFlags) (VACMAccess, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	group, ok := v.groups[p]
+	if !ok {
+		return VACMAccess{}, ErrVACMNoGroup
+	}
+	access, ok := v.access[group]
+	if !ok || level&AuthPriv < access.Level {
+		return VACMAccess{}, fmt.Errorf("%w: %s", ErrVACMNoAccess, group)
+	}
+	return access, nil
+}
+
+func (a VACMAccess) view(t VACMViewType) string {
+	switch t {
+	case VACMRead:
+		return a.ReadView
+	case VACMWrite:
+		return a.WriteView
+	}
+	return a.NotifyView
+}
+
+// InView reports whether the variable oid is in the view name, RFC 3415
+// section 5: of the families of the view oid belongs to, the one of the
+// longest subtree, or the lexicographically greatest of those, decides.
+func (v *VACM) InView(name, oid string) bool {
+	if name == "" {
+		return false
+	}
+	subids, err := parseSubids(oid)
+	if err != nil {
+		return false
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	var best *vacmFamily
+	for i, f := range v.views[name] {
+		if !f.contains(subids) {
+			continue
+		}
+		if best == nil || len(f.subids) > len(best.subids) ||
+			len(f.subids) == len(best.subids) && subidsLess(best.subids, f.subids) {
+			best = &v.views[name][i]
+		}
+	}
+	return best != nil && !best.excluded
+}
+
+// contains reports whether subids are in the family f.
+func (f vacmFamily) contains(subids []uint32) bool {
+	if len(subids) < len(f.subids) {
+		return false
+	}
+	for i, s := range f.subids {
+		wildcard := i/8 < len(f.mask) && f.mask[i/8]&(0x80>>uint(i%8)) == 0
+		if !wildcard && subids[i] != s {
+			return false
+		}
+	}
+	return true
+}
+
+// subidsLess reports whether a is before b in lexicographic order.
+func subidsLess(a, b []uint32) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
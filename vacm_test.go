@@ -0,0 +1,133 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVACMView(t *testing.T) {
+	v := NewVACM()
+	require.NoError(t, v.AddView("view",
+		ViewSubtree{OID: ".1.3.6.1.2.1"},
+		ViewSubtree{OID: ".1.3.6.1.2.1.1.4", Excluded: true},
+		// the columns of row 3 of ifTable
+		ViewSubtree{OID: ".1.3.6.1.2.1.2.2.1.1.3", Mask: []byte{0xff, 0xa0}, Excluded: true},
+		ViewSubtree{OID: ".1.3.6.1.2.1.2.2.1.1.3.5", Mask: []byte{0xff, 0xa0}},
+	))
+	for oid, in := range map[string]bool{
+		".1.3.6.1.2.1":             true,
+		"1.3.6.1.2.1.1.5.0":        true,
+		".1.3.6.1.2.1.1.4.0":       false,
+		".1.3.6.1.2.1.2.2.1.2.3":   false,
+		".1.3.6.1.2.1.2.2.1.2.4":   true,
+		".1.3.6.1.2.1.2.2.1.2.3.5": true,
+		".1.3.6.1.2":               false,
+		".1.3.6.1.4.1":             false,
+	} {
+		assert.Equal(t, in, v.InView("view", oid), oid)
+	}
+	assert.False(t, v.InView("other", ".1.3.6.1.2.1"))
+	assert.False(t, v.InView("", ".1.3.6.1.2.1"))
+	assert.Error(t, v.AddView("bad", ViewSubtree{OID: ".1.x"}))
+}
+
+func TestVACMAccess(t *testing.T) {
+	v := NewVACM()
+	require.NoError(t, v.AddView("system", ViewSubtree{OID: ".1.3.6.1.2.1.1"}))
+	require.NoError(t, v.AddCommunity("public", "monitoring"))
+	require.NoError(t, v.AddUser("admin", "admins"))
+	require.NoError(t, v.SetAccess("monitoring", VACMAccess{ReadView: "system"}))
+	require.NoError(t, v.SetAccess("admins", VACMAccess{Level: AuthPriv, ReadView: "system", WriteView: "system", NotifyView: "system"}))
+	assert.Error(t, v.SetAccess("admins", VACMAccess{Level: Reportable}))
+	assert.Error(t, v.AddUser("nobody", ""))
+
+	sysName := ".1.3.6.1.2.1.1.5.0"
+	assert.True(t, v.CommunityAllowed("public", VACMRead, sysName))
+	assert.False(t, v.CommunityAllowed("public", VACMWrite, sysName))
+	assert.False(t, v.CommunityAllowed("private", VACMRead, sysName))
+	assert.True(t, v.UserAllowed("admin", AuthPriv, VACMNotify, sysName))
+	assert.False(t, v.UserAllowed("admin", AuthNoPriv, VACMRead, sysName), "below the level of the group")
+	assert.False(t, v.UserAllowed("public", AuthPriv, VACMRead, sysName), "communities are not users")
+
+	_, err := v.accessOf(vacmPrincipal{name: "private"}, NoAuthNoPriv)
+	assert.ErrorIs(t, err, ErrVACMNoGroup)
+	_, err = v.accessOf(vacmPrincipal{user: true, name: "admin"}, NoAuthNoPriv)
+	assert.ErrorIs(t, err, ErrVACMNoAccess)
+}
+
+func TestAgentVACM(t *testing.T) {
+	v := NewVACM()
+	require.NoError(t, v.AddView("system", ViewSubtree{OID: ".1.3.6.1.2.1.1"}, ViewSubtree{OID: ".1.3.6.1.2.1.1.4", Excluded: true}))
+	require.NoError(t, v.AddView("sysName", ViewSubtree{OID: ".1.3.6.1.2.1.1.5"}))
+	require.NoError(t, v.AddCommunity("public", "monitoring"))
+	require.NoError(t, v.AddCommunity("private", "operators"))
+	require.NoError(t, v.SetAccess("monitoring", VACMAccess{ReadView: "system"}))
+	require.NoError(t, v.SetAccess("operators", VACMAccess{ReadView: "system", WriteView: "sysName"}))
+	h := &testAgentHandler{vars: testAgentVars()}
+	a := NewAgent()
+	a.Handler = h
+	a.VACM = v
+	x := startAgent(t, a, Version2c, "public")
+
+	result, err := x.Get([]string{".1.3.6.1.2.1.1.5.0", ".1.3.6.1.2.1.1.4.0", ".1.3.6.1.2.1.2.1.0"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("router"), result.Variables[0].Value)
+	assert.Equal(t, NoSuchObject, result.Variables[1].Type)
+	assert.Equal(t, NoSuchObject, result.Variables[2].Type)
+
+	// walks skip the variables outside the view
+	all, err := x.BulkWalkAll(".1.3")
+	require.NoError(t, err)
+	names := make([]string, len(all))
+	for i, v := range all {
+		names[i] = v.Name
+	}
+	assert.Equal(t, []string{".1.3.6.1.2.1.1.1.0", ".1.3.6.1.2.1.1.5.0", ".1.3.6.1.2.1.1.7.0"}, names)
+
+	result, err = x.Set([]SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "core"}})
+	require.NoError(t, err)
+	assert.Equal(t, NoAccess, result.Error)
+
+	x.Community = "private"
+	result, err = x.Set([]SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "core"}})
+	require.NoError(t, err)
+	assert.Equal(t, NoError, result.Error)
+	result, err = x.Set([]SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "edge"}, {Name: ".1.3.6.1.2.1.1.7.0", Type: Integer, Value: 4}})
+	require.NoError(t, err)
+	assert.Equal(t, NoAccess, result.Error)
+	assert.Equal(t, uint8(2), result.ErrorIndex)
+
+	// communities of no group are dropped
+	x.Community = "other"
+	x.Timeout = 100 * time.Millisecond
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	assert.Error(t, err)
+}
+
+func TestAgentVACMUsm(t *testing.T) {
+	users := NewUsmUserTable()
+	require.NoError(t, users.Add(UsmUser{UserName: "reader"}))
+	v := NewVACM()
+	require.NoError(t, v.AddView("all", ViewSubtree{OID: ".1"}))
+	require.NoError(t, v.AddUser("reader", "readers"))
+	require.NoError(t, v.SetAccess("readers", VACMAccess{Level: AuthNoPriv, ReadView: "all"}))
+	a := NewAgent()
+	a.Users = users
+	a.VACM = v
+	a.Handler = &testAgentHandler{vars: testAgentVars()}
+	x := startAgent(t, a, Version3, "reader")
+
+	result, err := x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, AuthorizationError, result.Error)
+}
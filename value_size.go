@@ -0,0 +1,81 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrValueTooLarge is matched by the ValueSizeError of a value larger than
+// MaxValueSize.
+var ErrValueTooLarge = errors.New("value exceeds MaxValueSize")
+
+// ValueSizeError is returned when a received OCTET STRING, or other value of
+// octets, is larger than MaxValueSize and no LargeValueHandler takes it. It
+// wraps ErrValueTooLarge.
+type ValueSizeError struct {
+	// Name and Type are those of the variable.
+	Name string
+	Type Asn1BER
+
+	Size  int
+	Limit int
+
+	// Err is the error of the LargeValueHandler, if it failed to take the
+	// value.
+	Err error
+}
+
+func (e *ValueSizeError) Error() string {
+	msg := fmt.Sprintf("%s: %s is %d bytes, limit %d", ErrValueTooLarge, e.Name, e.Size, e.Limit)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ValueSizeError) Unwrap() error {
+	return ErrValueTooLarge
+}
+
+// LargeValueHandler returns the writer the value of the variable name, of
+// size bytes and larger than MaxValueSize, is written to rather than held
+// in the SnmpPDU, e.g. a file for a configuration blob. An error fails the
+// request.
+type LargeValueHandler func(name string, size int) (io.Writer, error)
+
+// StreamedValue is the Value of a variable whose octets were written to the
+// LargeValueHandler of the session.
+type StreamedValue struct {
+	// Size is the number of octets written.
+	Size int
+}
+
+// limitValueSize applies MaxValueSize to the decoded value of pdu.
+func (x *GoSNMP) limitValueSize(pdu *SnmpPDU) error {
+	if x.MaxValueSize <= 0 {
+		return nil
+	}
+	b, ok := pdu.Value.([]byte)
+	if !ok || len(b) <= x.MaxValueSize {
+		return nil
+	}
+	sizeErr := &ValueSizeError{Name: pdu.Name, Type: pdu.Type, Size: len(b), Limit: x.MaxValueSize}
+	if x.LargeValueHandler == nil {
+		return sizeErr
+	}
+	w, err := x.LargeValueHandler(pdu.Name, len(b))
+	if err == nil {
+		_, err = w.Write(b)
+	}
+	if err != nil {
+		sizeErr.Err = err
+		return sizeErr
+	}
+	pdu.Value = StreamedValue{Size: len(b)}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxValueSize(t *testing.T) {
+	blob := bytes.Repeat([]byte("config "), 1000)
+	vars := testAgentVars()
+	vars[".1.3.6.1.2.1.1.4.0"] = SnmpPDU{Name: ".1.3.6.1.2.1.1.4.0", Type: OctetString, Value: blob}
+	a := NewAgent()
+	a.Handler = &testAgentHandler{vars: vars}
+	a.MaxMsgSize = 65000
+	x := startAgent(t, a, Version2c, "public")
+	x.Retries = 3
+	x.MaxValueSize = 1000
+
+	start := time.Now()
+	_, err := x.Get([]string{".1.3.6.1.2.1.1.4.0", ".1.3.6.1.2.1.1.5.0"})
+	var sizeErr *ValueSizeError
+	require.True(t, errors.As(err, &sizeErr), "%v", err)
+	assert.ErrorIs(t, err, ErrValueTooLarge)
+	assert.Equal(t, ".1.3.6.1.2.1.1.4.0", sizeErr.Name)
+	assert.Equal(t, len(blob), sizeErr.Size)
+	assert.Less(t, int64(time.Since(start)), int64(x.Timeout), "not retransmitted")
+
+	// values within the limit are unaffected
+	result, err := x.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("router"), result.Variables[0].Value)
+
+	var buf bytes.Buffer
+	var streamed []string
+	x.LargeValueHandler = func(name string, size int) (io.Writer, error) {
+		streamed = append(streamed, name)
+		assert.Equal(t, len(blob), size)
+		return &buf, nil
+	}
+	all, err := x.BulkWalkAll(".1.3.6.1.2.1.1")
+	require.NoError(t, err)
+	require.Len(t, all, 4)
+	assert.Equal(t, StreamedValue{Size: len(blob)}, all[1].Value)
+	assert.Equal(t, []byte("router"), all[2].Value)
+	assert.Equal(t, []string{".1.3.6.1.2.1.1.4.0"}, streamed)
+	assert.Equal(t, blob, buf.Bytes())
+
+	x.LargeValueHandler = func(string, int) (io.Writer, error) {
+		return nil, errors.New("disk full")
+	}
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.4.0"})
+	require.True(t, errors.As(err, &sizeErr))
+	assert.EqualError(t, sizeErr.Err, "disk full")
+}
@@ -0,0 +1,111 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gosnmp/gosnmp/oids"
+)
+
+// ContextResult is the collection of one context by ForEachContext.
+type ContextResult struct {
+	// VRF is the name the context was made from.
+	VRF string
+
+	// Context is the SNMPv3 context name, or the SNMPv1/v2c community,
+	// the collection used.
+	Context string
+
+	Values []SnmpPDU
+
+	// Err is the error the collection of the context failed with.
+	Err error
+}
+
+// ContextCollector collects the values of one context on view, a view of
+// the session addressing that context, see ForEachContext.
+type ContextCollector func(view *GoSNMP) ([]SnmpPDU, error)
+
+// ContextName returns the context of vrf made from template, in which "%s"
+// stands for the VRF name, e.g. "vrf-%s". A template without "%s" has the
+// name appended.
+func ContextName(template, vrf string) string {
+	if !strings.Contains(template, "%s") {
+		return template + vrf
+	}
+	return strings.Replace(template, "%s", vrf, -1)
+}
+
+// ForEachContext runs collect in the context of each of vrfs, as polling a
+// router's virtual routing and forwarding instances requires, and returns
+// the results tagged with their VRF, in the order of vrfs. Contexts are
+// made from template, see ContextName: for SNMPv3 it gives the context
+// name, e.g. "vrf-%s", and for SNMPv1/v2c, which carry no context, the
+// community, e.g. "public@%s" by the Cisco convention. An error in one
+// context does not stop the others; it is returned in its result. Use
+// DiscoverVRFs for the VRFs of the agent.
+//
+//	vrfs, err := x.DiscoverVRFs()
+//	...
+//	for _, r := range x.ForEachContext("vrf-%s", vrfs, func(view *gosnmp.GoSNMP) ([]gosnmp.SnmpPDU, error) {
+//		return view.BulkWalkAll(ipCidrRouteTable)
+//	}) {
+//		...
+//	}
+func (x *GoSNMP) ForEachContext(template string, vrfs []string, collect ContextCollector) []ContextResult {
+	results := make([]ContextResult, 0, len(vrfs))
+	for _, vrf := range vrfs {
+		r := ContextResult{VRF: vrf, Context: ContextName(template, vrf)}
+		opt := WithContextName(r.Context)
+		if x.Version != Version3 {
+			opt = WithCommunity(r.Context)
+		}
+		r.Values, r.Err = collect(x.WithOptions(opt))
+		results = append(results, r)
+	}
+	return results
+}
+
+// DiscoverVRFs returns the names of the VRFs of the agent, the rows of the
+// mplsL3VpnVrfTable of MPLS-L3VPN-STD-MIB (RFC 4382). The table is walked in
+// the default context.
+func (x *GoSNMP) DiscoverVRFs() ([]string, error) {
+	var vrfs []string
+	err := x.BulkWalk(oids.MplsL3VpnVrfOperStatus, func(pdu SnmpPDU) error {
+		index, ok := oids.Index(pdu.Name, oids.MplsL3VpnVrfOperStatus)
+		if !ok {
+			return nil
+		}
+		name, err := parseOctetStringIndex(index)
+		if err != nil {
+			return fmt.Errorf("VRF index %s: %w", index, err)
+		}
+		vrfs = append(vrfs, name)
+		return nil
+	})
+	return vrfs, err
+}
+
+// parseOctetStringIndex returns the OCTET STRING of variable size of the
+// table index index, its length followed by its octets.
+func parseOctetStringIndex(index string) (string, error) {
+	subids := strings.Split(index, ".")
+	n, err := strconv.Atoi(subids[0])
+	if err != nil || n != len(subids)-1 {
+		return "", fmt.Errorf("not an octet string of length %s", subids[0])
+	}
+	b := make([]byte, n)
+	for i, subid := range subids[1:] {
+		c, err := strconv.ParseUint(subid, 10, 8)
+		if err != nil {
+			return "", fmt.Errorf("sub-identifier %s out of range", subid)
+		}
+		b[i] = byte(c)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp/oids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextName(t *testing.T) {
+	assert.Equal(t, "vrf-red", ContextName("vrf-%s", "red"))
+	assert.Equal(t, "public@red", ContextName("public@", "red"))
+
+	name, err := parseOctetStringIndex("3.114.101.100")
+	require.NoError(t, err)
+	assert.Equal(t, "red", name)
+	_, err = parseOctetStringIndex("4.114.101.100")
+	assert.Error(t, err)
+	_, err = parseOctetStringIndex("1.256")
+	assert.Error(t, err)
+}
+
+func TestForEachContext(t *testing.T) {
+	// a router whose VRFs are the communities of a proxy
+	routes := func(name string) *GoSNMP {
+		vars := testAgentVars()
+		vars[".1.3.6.1.2.1.1.5.0"] = SnmpPDU{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: []byte(name)}
+		a := NewAgent()
+		a.Handler = &testAgentHandler{vars: vars}
+		return startAgent(t, a, Version2c, "public")
+	}
+	vrfTable := map[string]SnmpPDU{}
+	for _, vrf := range []string{"red", "blue"} {
+		name := oids.Join(oids.MplsL3VpnVrfOperStatus, RowIndex{}.OctetString(vrf).subids...)
+		vrfTable[name] = SnmpPDU{Name: name, Type: Integer, Value: 1}
+	}
+	router := NewAgent()
+	router.Handler = &testAgentHandler{vars: vrfTable}
+	router.ProxyTargets = []ProxyTarget{
+		{Community: "public@red", Session: routes("red")},
+		{Community: "public@blue", Session: routes("blue")},
+	}
+	x := startAgent(t, router, Version2c, "public")
+	x.Timeout = 200 * time.Millisecond
+
+	vrfs, err := x.DiscoverVRFs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"red", "blue"}, vrfs, "in index order, by length")
+
+	results := x.ForEachContext("public@%s", append(vrfs, "green"), func(view *GoSNMP) ([]SnmpPDU, error) {
+		result, err := view.Get([]string{".1.3.6.1.2.1.1.5.0"})
+		if err != nil {
+			return nil, err
+		}
+		return result.Variables, nil
+	})
+	require.Len(t, results, 3)
+	for i, vrf := range vrfs {
+		assert.Equal(t, vrf, results[i].VRF)
+		assert.Equal(t, "public@"+vrf, results[i].Context)
+		require.NoError(t, results[i].Err)
+		assert.Equal(t, []byte(vrf), results[i].Values[0].Value)
+	}
+	assert.Error(t, results[2].Err, "unknown context")
+	assert.Equal(t, "public", x.Community, "the session is not changed")
+}
@@ -5,11 +5,34 @@
 package gosnmp
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
 
-func (x *GoSNMP) walk(getRequestType PDUType, rootOid string, walkFn WalkFunc) error {
+// ErrBusy is returned by the walks of a session when MaxWalkQueue walks
+// are already waiting for it.
+var ErrBusy = errors.New("session busy")
+
+// queueWalk runs the walk f of a call with options o once the walks of x
+// started before it are done, see MaxWalkQueue. A walk waits until the
+// context of its call is done.
+func (x *GoSNMP) queueWalk(o *requestOptions, f func() error) error {
+	viewLockMu.Lock()
+	if x.walkLock == nil {
+		x.walkLock = &priorityLock{}
+	}
+	lock := x.walkLock
+	viewLockMu.Unlock()
+
+	if err := lock.wait(x.callContext(o), PriorityNormal, x.MaxWalkQueue); err != nil {
+		return err
+	}
+	defer lock.unlock()
+	return f()
+}
+
+func (x *GoSNMP) walk(o *requestOptions, getRequestType PDUType, rootOid string, walkFn WalkFunc) error {
 	if rootOid == "" || rootOid == "." {
 		rootOid = baseOid
 	}
@@ -19,11 +42,20 @@ func (x *GoSNMP) walk(getRequestType PDUType, rootOid string, walkFn WalkFunc) e
 	}
 
 	oid := rootOid
-	requests := 0
-	maxReps := x.MaxRepetitions
-	if maxReps == 0 {
-		maxReps = defaultMaxRepetitions
+	cursor, resuming, err := walkCursor(o, rootOid)
+	if err != nil {
+		return err
 	}
+	if resuming {
+		oid = cursor
+	}
+	walkFn = limitWalk(o, walkFn)
+	requests := 0
+	o = x.beginOperation(o)
+	logger := x.callLogger(o)
+	x.statsRoots = []string{rootOid}
+	defer func() { x.statsRoots = nil }()
+	maxReps := x.maxRepetitions(o)
 
 	// AppOpt 'c: do not check returned OIDs are increasing'
 	checkIncreasing := true
@@ -44,11 +76,11 @@ RequestLoop:
 
 		switch getRequestType {
 		case GetBulkRequest:
-			response, err = x.GetBulk([]string{oid}, uint8(x.NonRepeaters), maxReps)
+			response, err = x.getBulk(o, []string{oid}, x.nonRepeaters(o), maxReps)
 		case GetNextRequest:
-			response, err = x.GetNext([]string{oid})
+			response, err = x.getNext(o, []string{oid})
 		case GetRequest:
-			response, err = x.Get([]string{oid})
+			response, err = x.get(o, []string{oid})
 		default:
 			response, err = nil, fmt.Errorf("unsupported request type: %d", getRequestType)
 		}
@@ -62,66 +94,66 @@ RequestLoop:
 
 		switch response.Error {
 		case TooBig:
-			x.Logger.Print("Walk terminated with TooBig")
+			logger.Print("Walk terminated with TooBig")
 			break RequestLoop
 		case NoSuchName:
-			x.Logger.Print("Walk terminated with NoSuchName")
+			logger.Print("Walk terminated with NoSuchName")
 			break RequestLoop
 		case BadValue:
-			x.Logger.Print("Walk terminated with BadValue")
+			logger.Print("Walk terminated with BadValue")
 			break RequestLoop
 		case ReadOnly:
-			x.Logger.Print("Walk terminated with ReadOnly")
+			logger.Print("Walk terminated with ReadOnly")
 			break RequestLoop
 		case GenErr:
-			x.Logger.Print("Walk terminated with GenErr")
+			logger.Print("Walk terminated with GenErr")
 			break RequestLoop
 		case NoAccess:
-			x.Logger.Print("Walk terminated with NoAccess")
+			logger.Print("Walk terminated with NoAccess")
 			break RequestLoop
 		case WrongType:
-			x.Logger.Print("Walk terminated with WrongType")
+			logger.Print("Walk terminated with WrongType")
 			break RequestLoop
 		case WrongLength:
-			x.Logger.Print("Walk terminated with WrongLength")
+			logger.Print("Walk terminated with WrongLength")
 			break RequestLoop
 		case WrongEncoding:
-			x.Logger.Print("Walk terminated with WrongEncoding")
+			logger.Print("Walk terminated with WrongEncoding")
 			break RequestLoop
 		case WrongValue:
-			x.Logger.Print("Walk terminated with WrongValue")
+			logger.Print("Walk terminated with WrongValue")
 			break RequestLoop
 		case NoCreation:
-			x.Logger.Print("Walk terminated with NoCreation")
+			logger.Print("Walk terminated with NoCreation")
 			break RequestLoop
 		case InconsistentValue:
-			x.Logger.Print("Walk terminated with InconsistentValue")
+			logger.Print("Walk terminated with InconsistentValue")
 			break RequestLoop
 		case ResourceUnavailable:
-			x.Logger.Print("Walk terminated with ResourceUnavailable")
+			logger.Print("Walk terminated with ResourceUnavailable")
 			break RequestLoop
 		case CommitFailed:
-			x.Logger.Print("Walk terminated with CommitFailed")
+			logger.Print("Walk terminated with CommitFailed")
 			break RequestLoop
 		case UndoFailed:
-			x.Logger.Print("Walk terminated with UndoFailed")
+			logger.Print("Walk terminated with UndoFailed")
 			break RequestLoop
 		case AuthorizationError:
-			x.Logger.Print("Walk terminated with AuthorizationError")
+			logger.Print("Walk terminated with AuthorizationError")
 			break RequestLoop
 		case NotWritable:
-			x.Logger.Print("Walk terminated with NotWritable")
+			logger.Print("Walk terminated with NotWritable")
 			break RequestLoop
 		case InconsistentName:
-			x.Logger.Print("Walk terminated with InconsistentName")
+			logger.Print("Walk terminated with InconsistentName")
 			break RequestLoop
 		case NoError:
-			x.Logger.Print("Walk completed with NoError")
+			logger.Print("Walk completed with NoError")
 		}
 
 		for i, pdu := range response.Variables {
 			if pdu.Type == EndOfMibView || pdu.Type == NoSuchObject || pdu.Type == NoSuchInstance {
-				x.Logger.Printf("BulkWalk terminated with type 0x%x", pdu.Type)
+				logger.Printf("BulkWalk terminated with type 0x%x", pdu.Type)
 				break RequestLoop
 			}
 			if !strings.HasPrefix(pdu.Name, rootOid+".") {
@@ -131,7 +163,7 @@ RequestLoop:
 				// need to perform a regular get request
 				// this request has been too narrowly defined to be found with a getNext
 				// Issue #78 #93
-				if requests == 1 && i == 0 {
+				if requests == 1 && i == 0 && !resuming {
 					getRequestType = GetRequest
 					continue RequestLoop
 				} else if pdu.Name == rootOid && pdu.Type != NoSuchInstance {
@@ -156,14 +188,159 @@ RequestLoop:
 		// Save last oid for next request
 		oid = response.Variables[len(response.Variables)-1].Name
 	}
-	x.Logger.Printf("BulkWalk completed in %d requests", requests)
+	logger.Printf("BulkWalk completed in %d requests", requests)
 	return nil
 }
 
-func (x *GoSNMP) walkAll(getRequestType PDUType, rootOid string) (results []SnmpPDU, err error) {
-	err = x.walk(getRequestType, rootOid, func(dataUnit SnmpPDU) error {
+func (x *GoSNMP) walkAll(o *requestOptions, getRequestType PDUType, rootOid string) (results []SnmpPDU, err error) {
+	err = x.walk(o, getRequestType, rootOid, func(dataUnit SnmpPDU) error {
 		results = append(results, dataUnit)
 		return nil
 	})
 	return results, err
 }
+
+// bulkWalkColumns walks several column roots with shared GetBulk requests,
+// one repeater per column that has not yet ended.
+func (x *GoSNMP) bulkWalkColumns(o *requestOptions, rootOids []string, walkFn WalkFunc) error {
+	if len(rootOids) == 0 {
+		return nil
+	}
+	o = x.beginOperation(o)
+	maxOids := x.MaxOids
+	if maxOids <= 0 {
+		maxOids = MaxOids
+	}
+	for start := 0; start < len(rootOids); start += maxOids {
+		end := start + maxOids
+		if end > len(rootOids) {
+			end = len(rootOids)
+		}
+		if err := x.bulkWalkColumnGroup(o, rootOids[start:end], walkFn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type walkColumn struct {
+	root    string
+	oid     string
+	started bool
+}
+
+func (x *GoSNMP) bulkWalkColumnGroup(o *requestOptions, rootOids []string, walkFn WalkFunc) error {
+	active := make([]*walkColumn, 0, len(rootOids))
+	for _, root := range rootOids {
+		root = walkRoot(root)
+		active = append(active, &walkColumn{root: root, oid: root})
+	}
+	maxReps := x.maxRepetitions(o)
+	logger := x.callLogger(o)
+	checkIncreasing := true
+	if x.AppOpts != nil {
+		if _, ok := x.AppOpts["c"]; ok {
+			checkIncreasing = false
+		}
+	}
+
+	x.statsRoots = make([]string, len(active))
+	for i, col := range active {
+		x.statsRoots[i] = col.root
+	}
+	defer func() { x.statsRoots = nil }()
+
+	// roots that turned out to be leaves, fetched with a Get at the end
+	var leaves []string
+	requests := 0
+	for len(active) > 0 {
+		requests++
+		oids := make([]string, len(active))
+		for i, col := range active {
+			oids[i] = col.oid
+		}
+		// keep the response about as large as a single column walk
+		reps := maxReps / uint32(len(active))
+		if reps == 0 {
+			reps = 1
+		}
+		response, err := x.getBulk(o, oids, 0, reps)
+		if err != nil {
+			return err
+		}
+		if response.Error != NoError {
+			logger.Printf("BulkWalk terminated with %s", response.Error)
+			break
+		}
+		if len(response.Variables) == 0 {
+			break
+		}
+
+		// repeaters are returned row by row, so variable i belongs to
+		// column i modulo the number of columns requested
+		done := make([]bool, len(active))
+		progress := false
+		for i, pdu := range response.Variables {
+			c := i % len(active)
+			col := active[c]
+			if done[c] {
+				continue
+			}
+			if pdu.Type == EndOfMibView || pdu.Type == NoSuchObject || pdu.Type == NoSuchInstance ||
+				!strings.HasPrefix(pdu.Name, col.root+".") {
+				if !col.started {
+					leaves = append(leaves, col.root)
+				}
+				done[c] = true
+				continue
+			}
+			if checkIncreasing && pdu.Name == col.oid {
+				return fmt.Errorf("OID not increasing: %s", pdu.Name)
+			}
+			col.oid = pdu.Name
+			col.started = true
+			progress = true
+			if err := walkFn(pdu); err != nil {
+				return err
+			}
+		}
+
+		remaining := active[:0]
+		for c, col := range active {
+			if !done[c] {
+				remaining = append(remaining, col)
+			}
+		}
+		active = remaining
+		if len(active) > 0 && !progress {
+			// a truncated response that advanced no column
+			return fmt.Errorf("BulkWalk made no progress after %d requests", requests)
+		}
+	}
+	logger.Printf("BulkWalk of %d columns completed in %d requests", len(rootOids), requests)
+
+	if len(leaves) == 0 {
+		return nil
+	}
+	response, err := x.get(o, leaves)
+	if err != nil {
+		return err
+	}
+	for _, pdu := range response.Variables {
+		if pdu.Type == EndOfMibView || pdu.Type == NoSuchObject || pdu.Type == NoSuchInstance {
+			continue
+		}
+		if err := walkFn(pdu); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkRoot returns rootOid with a leading dot, or the default root if empty
+func walkRoot(rootOid string) string {
+	if rootOid == "" || rootOid == "." {
+		return baseOid
+	}
+	return normalizeOID(rootOid)
+}
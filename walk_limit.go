@@ -0,0 +1,109 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gosnmp/gosnmp/oids"
+)
+
+// ErrWalkLimit is matched by the WalkLimitError of a walk stopped by
+// WithWalkLimit or WithWalkByteBudget.
+var ErrWalkLimit = errors.New("walk limit reached")
+
+// WalkLimitError is returned by a walk stopped by its limit. The values of
+// the walk up to Cursor have been passed to the WalkFunc, or are returned
+// by WalkAll and BulkWalkAll along with the error.
+type WalkLimitError struct {
+	// Cursor is the name of the last value walked, WithWalkCursor resumes
+	// the walk after it.
+	Cursor string
+
+	// Values and Bytes are the values walked and their size.
+	Values int
+	Bytes  int
+}
+
+func (e *WalkLimitError) Error() string {
+	return fmt.Sprintf("%s after %d values (%d bytes), resume after %s", ErrWalkLimit, e.Values, e.Bytes, e.Cursor)
+}
+
+// Unwrap returns ErrWalkLimit.
+func (e *WalkLimitError) Unwrap() error {
+	return ErrWalkLimit
+}
+
+// WithWalkLimit stops the walks of a call after n values with a
+// WalkLimitError, so that an enormous subtree is paged through:
+//
+//	var cursor string
+//	for {
+//		page, err := x.BulkWalkAllWithOptions(root, gosnmp.WithWalkLimit(1000), gosnmp.WithWalkCursor(cursor))
+//		... page ...
+//		var limit *gosnmp.WalkLimitError
+//		if !errors.As(err, &limit) {
+//			break // err is nil at the end of the subtree
+//		}
+//		cursor = limit.Cursor
+//	}
+//
+// It applies to Walk, BulkWalk and their variants.
+func WithWalkLimit(n int) RequestOption {
+	return func(o *requestOptions) {
+		o.walkLimit = n
+	}
+}
+
+// WithWalkByteBudget stops the walks of a call with a WalkLimitError once
+// the names and values walked reach bytes, see WithWalkLimit. The value
+// reaching the budget is walked.
+func WithWalkByteBudget(bytes int) RequestOption {
+	return func(o *requestOptions) {
+		o.walkByteBudget = bytes
+	}
+}
+
+// WithWalkCursor starts the walks of a call after cursor, the Cursor of the
+// WalkLimitError of a previous walk of the same root, instead of at the root.
+// An empty cursor starts at the root.
+func WithWalkCursor(cursor string) RequestOption {
+	return func(o *requestOptions) {
+		o.walkCursor = cursor
+	}
+}
+
+// walkCursor returns the name a walk with options o resumes after, if any.
+func walkCursor(o *requestOptions, rootOid string) (string, bool, error) {
+	if o == nil || o.walkCursor == "" {
+		return "", false, nil
+	}
+	cursor := o.walkCursor
+	if !oids.Under(cursor, rootOid) {
+		return "", false, fmt.Errorf("walk cursor %s is not under %s", cursor, rootOid)
+	}
+	return walkRoot(cursor), true, nil
+}
+
+// limitWalk returns walkFn stopping a walk with options o at its limits.
+func limitWalk(o *requestOptions, walkFn WalkFunc) WalkFunc {
+	if o == nil || o.walkLimit <= 0 && o.walkByteBudget <= 0 {
+		return walkFn
+	}
+	limit, budget := o.walkLimit, o.walkByteBudget
+	var values, bytes int
+	return func(pdu SnmpPDU) error {
+		if err := walkFn(pdu); err != nil {
+			return err
+		}
+		values++
+		bytes += len(pdu.Name) + valueSize(pdu)
+		if limit > 0 && values >= limit || budget > 0 && bytes >= budget {
+			return &WalkLimitError{Cursor: pdu.Name, Values: values, Bytes: bytes}
+		}
+		return nil
+	}
+}
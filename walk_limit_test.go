@@ -0,0 +1,58 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalkLimitPagination(t *testing.T) {
+	a := NewAgent()
+	a.Handler = &testAgentHandler{vars: testAgentVars()}
+	x := startAgent(t, a, Version2c, "public")
+
+	all, err := x.BulkWalkAll(".1.3.6.1.2.1")
+	require.NoError(t, err)
+	require.Len(t, all, 5)
+
+	for _, walk := range []func(string, ...RequestOption) ([]SnmpPDU, error){x.WalkAllWithOptions, x.BulkWalkAllWithOptions} {
+		var paged []SnmpPDU
+		var cursor string
+		pages := 0
+		for {
+			page, err := walk(".1.3.6.1.2.1", WithWalkLimit(2), WithWalkCursor(cursor))
+			pages++
+			assert.LessOrEqual(t, len(page), 2)
+			paged = append(paged, page...)
+			var limit *WalkLimitError
+			if !errors.As(err, &limit) {
+				require.NoError(t, err)
+				break
+			}
+			assert.ErrorIs(t, err, ErrWalkLimit)
+			assert.Equal(t, 2, limit.Values)
+			cursor = limit.Cursor
+		}
+		assert.Equal(t, 3, pages)
+		assert.Equal(t, all, paged)
+	}
+
+	// the value reaching the byte budget is walked
+	page, err := x.BulkWalkAllWithOptions(".1.3.6.1.2.1", WithWalkByteBudget(len(all[0].Name)+1))
+	var limit *WalkLimitError
+	require.True(t, errors.As(err, &limit))
+	assert.Equal(t, all[:1], page)
+	assert.Equal(t, all[0].Name, limit.Cursor)
+
+	_, err = x.WalkAllWithOptions(".1.3.6.1.2.1.2", WithWalkCursor(".1.3.6.1.2.1.1.5.0"))
+	assert.Error(t, err, "cursor outside the root")
+}
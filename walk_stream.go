@@ -0,0 +1,111 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// errStreamClosed stops the walk of a PDUStream closed by its consumer.
+var errStreamClosed = errors.New("stream closed")
+
+// PDUStream is a walk in progress delivering its values on a channel, see
+// WalkStream. The walk only requests more values as they are received, so
+// that a huge table, e.g. a full BGP RIB, is never held in memory.
+type PDUStream struct {
+	// C delivers the values of the walk in order. It is closed when the
+	// walk ends, after which Err returns its error.
+	C <-chan SnmpPDU
+
+	ctx    context.Context
+	stop   chan struct{}
+	once   sync.Once
+	done   chan struct{}
+	err    error
+	values chan SnmpPDU
+}
+
+// Err returns the error the walk ended with, nil if it completed or was
+// closed by Close, or the error of its context if that was done. It is only
+// valid once C is closed.
+func (s *PDUStream) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Close stops the walk, if it has not ended, and waits for it: the request
+// in flight, if any, completes first. It is safe to call Close more than
+// once, and without receiving the rest of C.
+func (s *PDUStream) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	<-s.done
+	return s.err
+}
+
+// send delivers pdu to the consumer, waiting until it is received, the
+// stream closed or its context done.
+func (s *PDUStream) send(pdu SnmpPDU) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case s.values <- pdu:
+		return nil
+	case <-s.stop:
+		return errStreamClosed
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+// WalkStream walks the subtree rootOid using GETNEXT, as Walk does, but
+// delivers the values on the channel of the returned stream rather than to
+// a callback. Each value is sent once the previous one was received, so a
+// slow consumer slows the walk rather than values piling up in memory. The
+// walk ends early when the stream is closed or ctx is done; ctx is checked
+// between values, the Context of the session bounding the requests. The
+// walk holds the session as Walk does, so the caller must receive C until
+// it is closed, or call Close, before walking the session again.
+func (x *GoSNMP) WalkStream(ctx context.Context, rootOid string) *PDUStream {
+	return x.walkStream(ctx, GetNextRequest, rootOid)
+}
+
+// BulkWalkStream is similar to WalkStream but uses GETBULK, as BulkWalk
+// does.
+func (x *GoSNMP) BulkWalkStream(ctx context.Context, rootOid string) *PDUStream {
+	return x.walkStream(ctx, GetBulkRequest, rootOid)
+}
+
+func (x *GoSNMP) walkStream(ctx context.Context, getRequestType PDUType, rootOid string) *PDUStream {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	values := make(chan SnmpPDU)
+	s := &PDUStream{
+		C:      values,
+		ctx:    ctx,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		values: values,
+	}
+	go func() {
+		err := x.queueWalk(x.requestOpts, func() error {
+			return x.walk(x.requestOpts, getRequestType, rootOid, s.send)
+		})
+		if errors.Is(err, errStreamClosed) {
+			err = nil
+		}
+		s.err = err
+		close(s.done)
+		close(values)
+	}()
+	return s
+}
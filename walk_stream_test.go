@@ -0,0 +1,62 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalkStream(t *testing.T) {
+	a := NewAgent()
+	a.Handler = &testAgentHandler{vars: testAgentVars()}
+	x := startAgent(t, a, Version2c, "public")
+
+	want, err := x.WalkAll(".1.3.6.1.2.1")
+	require.NoError(t, err)
+
+	// one at a time: a stream holds the session until it ends
+	for _, walk := range []func(context.Context, string) *PDUStream{x.WalkStream, x.BulkWalkStream} {
+		stream := walk(context.Background(), ".1.3.6.1.2.1")
+		var got []SnmpPDU
+		for pdu := range stream.C {
+			got = append(got, pdu)
+		}
+		assert.NoError(t, stream.Err())
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestWalkStreamEarlyTermination(t *testing.T) {
+	a := NewAgent()
+	a.Handler = &testAgentHandler{vars: testAgentVars()}
+	x := startAgent(t, a, Version2c, "public")
+
+	stream := x.WalkStream(context.Background(), ".1.3.6.1.2.1")
+	pdu := <-stream.C
+	assert.Equal(t, ".1.3.6.1.2.1.1.1.0", pdu.Name)
+	assert.NoError(t, stream.Close())
+	assert.NoError(t, stream.Close())
+	_, ok := <-stream.C
+	assert.False(t, ok)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream = x.BulkWalkStream(ctx, ".1.3.6.1.2.1")
+	<-stream.C
+	cancel()
+	for range stream.C {
+	}
+	assert.ErrorIs(t, stream.Err(), context.Canceled)
+
+	// the walks released the session
+	_, err := x.WalkAll(".1.3.6.1.2.1.1")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,320 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bulkAgent is a SNMPv2c agent answering Get, GetNext and GetBulk requests
+// from mib, which must be sorted.
+func bulkAgent(t *testing.T, srvr *net.UDPConn, mib []SnmpPDU, requests *int32) {
+	next := func(oid string) SnmpPDU {
+		for _, pdu := range mib {
+			if oidLess(oid, pdu.Name) {
+				return pdu
+			}
+		}
+		return SnmpPDU{Name: oid, Type: EndOfMibView}
+	}
+	// decoding sets defaults on the decoder, agents must not share one
+	decoder := &GoSNMP{Version: Version2c, Logger: Default.Logger}
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := srvr.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(requests, 1)
+		req, err := decoder.SnmpDecodePacket(buf[:n])
+		if err != nil {
+			t.Errorf("agent decode: %s", err)
+			return
+		}
+		var vars []SnmpPDU
+		switch req.PDUType {
+		case GetRequest:
+			for _, v := range req.Variables {
+				pdu := SnmpPDU{Name: v.Name, Type: NoSuchObject}
+				for _, m := range mib {
+					if m.Name == v.Name {
+						pdu = m
+					}
+				}
+				vars = append(vars, pdu)
+			}
+		case GetNextRequest:
+			for _, v := range req.Variables {
+				vars = append(vars, next(v.Name))
+			}
+		case GetBulkRequest:
+			cursors := make([]string, len(req.Variables))
+			for i, v := range req.Variables {
+				cursors[i] = v.Name
+			}
+			nonRepeaters := int(req.NonRepeaters)
+			if nonRepeaters > len(cursors) {
+				nonRepeaters = len(cursors)
+			}
+			for _, oid := range cursors[:nonRepeaters] {
+				vars = append(vars, next(oid))
+			}
+			for r := uint32(0); r < req.MaxRepetitions; r++ {
+				for i := nonRepeaters; i < len(cursors); i++ {
+					pdu := next(cursors[i])
+					cursors[i] = pdu.Name
+					vars = append(vars, pdu)
+				}
+			}
+		}
+		resp := &SnmpPacket{
+			Version:   Version2c,
+			Community: "public",
+			PDUType:   GetResponse,
+			RequestID: req.RequestID,
+			Variables: vars,
+		}
+		out, err := resp.MarshalMsg()
+		if err != nil {
+			t.Errorf("agent marshal: %s", err)
+			return
+		}
+		if _, err = srvr.WriteTo(out, addr); err != nil {
+			return
+		}
+	}
+}
+
+func TestBulkWalkColumns(t *testing.T) {
+	// ifDescr has three rows, ifType two and ifMtu four
+	mib := []SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "router"},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.1", Type: OctetString, Value: "lo"},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.2", Type: OctetString, Value: "eth0"},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.3", Type: OctetString, Value: "eth1"},
+		{Name: ".1.3.6.1.2.1.2.2.1.3.1", Type: Integer, Value: 24},
+		{Name: ".1.3.6.1.2.1.2.2.1.3.2", Type: Integer, Value: 6},
+		{Name: ".1.3.6.1.2.1.2.2.1.4.1", Type: Integer, Value: 65536},
+		{Name: ".1.3.6.1.2.1.2.2.1.4.2", Type: Integer, Value: 1500},
+		{Name: ".1.3.6.1.2.1.2.2.1.4.3", Type: Integer, Value: 1500},
+		{Name: ".1.3.6.1.2.1.2.2.1.4.4", Type: Integer, Value: 9000},
+	}
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+	var requests int32
+	go bulkAgent(t, srvr, mib, &requests)
+
+	x := &GoSNMP{
+		Target:         "127.0.0.1",
+		Port:           uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Version:        Version2c,
+		Community:      "public",
+		Timeout:        time.Second,
+		MaxOids:        MaxOids,
+		MaxRepetitions: 6,
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	roots := []string{".1.3.6.1.2.1.2.2.1.2", "1.3.6.1.2.1.2.2.1.3", ".1.3.6.1.2.1.2.2.1.4", ".1.3.6.1.2.1.1.5.0"}
+	results, err := x.BulkWalkColumnsAll(roots)
+	require.NoError(t, err)
+	var names []string
+	for _, pdu := range results {
+		names = append(names, pdu.Name)
+	}
+	assert.Equal(t, []string{
+		".1.3.6.1.2.1.2.2.1.2.1", ".1.3.6.1.2.1.2.2.1.2.2", ".1.3.6.1.2.1.2.2.1.2.3",
+		".1.3.6.1.2.1.2.2.1.3.1", ".1.3.6.1.2.1.2.2.1.3.2",
+		".1.3.6.1.2.1.2.2.1.4.1", ".1.3.6.1.2.1.2.2.1.4.2", ".1.3.6.1.2.1.2.2.1.4.3", ".1.3.6.1.2.1.2.2.1.4.4",
+		".1.3.6.1.2.1.1.5.0",
+	}, names)
+	// the shared walk needs 3 bulk requests, as repetitions are shared out
+	// again when sysName.0 and ifType end, plus the Get of the leaf
+	assert.Equal(t, int32(4), atomic.LoadInt32(&requests))
+
+	// walking the columns in groups still returns every value
+	atomic.StoreInt32(&requests, 0)
+	x.MaxOids = 2
+	grouped, err := x.BulkWalkColumnsAll(roots)
+	require.NoError(t, err)
+	assert.Equal(t, results, grouped)
+}
+
+func TestOIDStats(t *testing.T) {
+	mib := []SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.5.0", Type: OctetString, Value: "router"},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.1", Type: OctetString, Value: "lo"},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.2", Type: OctetString, Value: "GigabitEthernet0/0/1"},
+		{Name: ".1.3.6.1.2.1.2.2.1.3.1", Type: Integer, Value: 24},
+	}
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+	var requests int32
+	go bulkAgent(t, srvr, mib, &requests)
+
+	stats := NewOIDStatsCollector()
+	x := &GoSNMP{
+		Target:         "127.0.0.1",
+		Port:           uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Version:        Version2c,
+		Community:      "public",
+		Timeout:        time.Second,
+		MaxOids:        MaxOids,
+		MaxRepetitions: 10,
+		OIDStats:       stats,
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	_, err = x.BulkWalkAll(".1.3.6.1.2.1.2.2.1.2")
+	require.NoError(t, err)
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.5.0", ".1.3.6.1.2.1.1.6.0"})
+	require.NoError(t, err)
+
+	snap := stats.Snapshot()
+	walk := snap[".1.3.6.1.2.1.2.2.1.2"]
+	assert.Equal(t, uint64(1), walk.Requests)
+	assert.Equal(t, uint64(2), walk.Varbinds)
+	assert.Equal(t, uint64(22), walk.Bytes)
+	assert.Equal(t, uint64(1), walk.Sizes.Counts[2], "2 bytes")
+	assert.Equal(t, uint64(1), walk.Sizes.Counts[5], "20 bytes")
+	assert.Equal(t, 31, walk.Sizes.UpperBound(5))
+	assert.True(t, walk.Latency > 0)
+
+	// the bulk response continued past the walk root, to ifType.1 and
+	// then endOfMibView
+	past := snap[".1.3.6.1.2.1.2.2.1.3.1"]
+	assert.Equal(t, uint64(8), past.Varbinds)
+	assert.Equal(t, uint64(7), past.Exceptions)
+
+	assert.Equal(t, uint64(6), snap[".1.3.6.1.2.1.1.5.0"].Bytes)
+	assert.Equal(t, uint64(1), snap[".1.3.6.1.2.1.1.6.0"].Exceptions)
+
+	var buf bytes.Buffer
+	require.NoError(t, stats.WriteJSON(&buf))
+	var decoded map[string]OIDStats
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, snap, decoded)
+
+	stats.Reset()
+	assert.Empty(t, stats.Snapshot())
+}
+
+func TestWalkQueue(t *testing.T) {
+	mib := []SnmpPDU{
+		{Name: ".1.3.6.1.2.1.2.2.1.2.1", Type: OctetString, Value: "lo"},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.2", Type: OctetString, Value: "eth0"},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.3", Type: OctetString, Value: "eth1"},
+	}
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+	var requests int32
+	go bulkAgent(t, srvr, mib, &requests)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	x := &GoSNMP{
+		Target:       "127.0.0.1",
+		Port:         uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Version:      Version2c,
+		Community:    "public",
+		Timeout:      time.Second,
+		MaxOids:      MaxOids,
+		MaxWalkQueue: 1,
+		Context:      ctx,
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	waiting := func() int {
+		x.walkLock.mu.Lock()
+		defer x.walkLock.mu.Unlock()
+		return len(x.walkLock.waiting)
+	}
+	root := ".1.3.6.1.2.1.2.2.1.2"
+
+	// the first walk holds the session while blocked in its WalkFunc
+	started, release := make(chan struct{}), make(chan struct{})
+	first := make(chan error, 1)
+	go func() {
+		first <- x.Walk(root, func(SnmpPDU) error {
+			select {
+			case <-started:
+			default:
+				close(started)
+				<-release
+			}
+			return nil
+		})
+	}()
+	<-started
+
+	type walkResult struct {
+		results []SnmpPDU
+		err     error
+	}
+	second := make(chan walkResult, 1)
+	go func() {
+		results, err := x.BulkWalkAll(root)
+		second <- walkResult{results, err}
+	}()
+	require.Eventually(t, func() bool { return waiting() == 1 }, time.Second, time.Millisecond)
+
+	// the queue is full
+	_, err = x.WalkAll(root)
+	assert.True(t, errors.Is(err, ErrBusy), "got %v", err)
+
+	close(release)
+	require.NoError(t, <-first)
+	r := <-second
+	require.NoError(t, r.err)
+	require.Len(t, r.results, len(mib))
+	for i, pdu := range r.results {
+		assert.Equal(t, mib[i].Name, pdu.Name)
+	}
+
+	// a waiting walk ends with the context of the session
+	started, release = make(chan struct{}), make(chan struct{})
+	go func() {
+		first <- x.Walk(root, func(SnmpPDU) error {
+			select {
+			case <-started:
+			default:
+				close(started)
+				<-release
+			}
+			return nil
+		})
+	}()
+	<-started
+	go func() {
+		results, err := x.WalkAll(root)
+		second <- walkResult{results, err}
+	}()
+	require.Eventually(t, func() bool { return waiting() == 1 }, time.Second, time.Millisecond)
+	cancel()
+	r = <-second
+	assert.Equal(t, context.Canceled, r.err)
+	assert.Equal(t, 0, waiting())
+	close(release)
+	<-first
+}
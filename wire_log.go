@@ -0,0 +1,145 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gosnmp
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WireOperation is an operation of a session as retained by a WireLog: the
+// exact bytes of the messages it sent and received.
+type WireOperation struct {
+	// CorrelationID identifies the operation, see GoSNMP.CorrelationID.
+	CorrelationID string
+
+	// Target is the "host:port" address of the agent.
+	Target string
+
+	// PDUType is the type of the request, e.g. GetBulkRequest.
+	PDUType PDUType
+
+	Start    time.Time
+	Duration time.Duration
+
+	// Messages are the messages of the operation in order: the
+	// retransmissions of the request, engine discovery included, the
+	// responses, and the messages dropped as undecodable or out of order.
+	// Sent messages are those written after BeforeSend, received ones
+	// those read before AfterReceive.
+	Messages []CaptureRecord
+
+	// Err is the error the operation failed with, nil if it succeeded.
+	Err error
+}
+
+// WireLog retains the messages of the most recent operations of the
+// sessions sharing it, see GoSNMP.WireLog, so that intermittent interop
+// failures in production can be examined after the fact without capturing
+// every message. It is safe for concurrent use.
+type WireLog struct {
+	mu   sync.Mutex
+	size int
+	ops  []WireOperation
+}
+
+// NewWireLog returns a WireLog retaining the last n operations.
+func NewWireLog(n int) *WireLog {
+	if n < 1 {
+		n = 1
+	}
+	return &WireLog{size: n}
+}
+
+// Operations returns the retained operations, oldest first.
+func (l *WireLog) Operations() []WireOperation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]WireOperation(nil), l.ops...)
+}
+
+// WriteCapture writes the messages of the retained operations to w as a
+// capture file, see NewCaptureWriter.
+func (l *WireLog) WriteCapture(w io.Writer) error {
+	cw, err := NewCaptureWriter(w)
+	if err != nil {
+		return err
+	}
+	for _, op := range l.Operations() {
+		for _, rec := range op.Messages {
+			if err = cw.Write(rec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *WireLog) add(op WireOperation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.ops) == l.size {
+		copy(l.ops, l.ops[1:])
+		l.ops = l.ops[:l.size-1]
+	}
+	l.ops = append(l.ops, op)
+}
+
+// beginWireOperation starts retaining the messages of the operation sending
+// packetOut, unless one is in progress, and returns the function ending it
+// with the error of the operation.
+func (x *GoSNMP) beginWireOperation(packetOut *SnmpPacket) func(err error) {
+	if x.WireLog == nil || x.wireOp != nil {
+		return func(error) {}
+	}
+	x.wireOp = x.newWireOperation(packetOut)
+	return func(err error) {
+		op := x.wireOp
+		x.wireOp = nil
+		x.endWireOperation(op, err)
+	}
+}
+
+// newWireOperation returns the operation sending packetOut.
+func (x *GoSNMP) newWireOperation(packetOut *SnmpPacket) *WireOperation {
+	var id string
+	if packetOut.opts != nil {
+		id = packetOut.opts.operationID
+	}
+	return &WireOperation{
+		CorrelationID: id,
+		Target:        net.JoinHostPort(x.Target, strconv.Itoa(int(x.Port))),
+		PDUType:       packetOut.PDUType,
+		Start:         time.Now(),
+	}
+}
+
+// endWireOperation retains op, which failed with err if set.
+func (x *GoSNMP) endWireOperation(op *WireOperation, err error) {
+	op.Duration = time.Since(op.Start)
+	op.Err = err
+	x.WireLog.add(*op)
+}
+
+// recordWireMessage retains msg in the operation in progress.
+func (x *GoSNMP) recordWireMessage(direction CaptureDirection, msg []byte) {
+	if x.wireOp == nil {
+		return
+	}
+	x.wireOp.record(direction, msg)
+}
+
+// record retains msg in op.
+func (op *WireOperation) record(direction CaptureDirection, msg []byte) {
+	op.Messages = append(op.Messages, CaptureRecord{
+		Time:      time.Now(),
+		Direction: direction,
+		Addr:      op.Target,
+		Data:      append([]byte(nil), msg...),
+	})
+}
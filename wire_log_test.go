@@ -0,0 +1,90 @@
+// Copyright 2012 The GoSNMP Authors. All rights reserved.  Use of this
+// source code is governed by a BSD-style license that can be found in the
+// LICENSE file.
+
+//go:build all || misc
+// +build all misc
+
+package gosnmp
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWireLog(t *testing.T) {
+	a := NewAgent()
+	a.Handler = &testAgentHandler{vars: testAgentVars()}
+	x := startAgent(t, a, Version2c, "public")
+	x.WireLog = NewWireLog(2)
+
+	_, err := x.Get([]string{".1.3.6.1.2.1.1.1.0"})
+	require.NoError(t, err)
+	_, err = x.GetNext([]string{".1.3.6.1.2.1.1.1.0"})
+	require.NoError(t, err)
+	_, err = x.WithOptions(WithCorrelationID("poll-7")).Get([]string{".1.3.6.1.2.1.1.5.0"})
+	require.NoError(t, err)
+
+	// only the last two operations are retained
+	ops := x.WireLog.Operations()
+	require.Len(t, ops, 2)
+	assert.Equal(t, GetNextRequest, ops[0].PDUType)
+	assert.Equal(t, "poll-7", ops[1].CorrelationID)
+	assert.Equal(t, net.JoinHostPort(x.Target, strconv.Itoa(int(x.Port))), ops[1].Target)
+	require.Len(t, ops[1].Messages, 2)
+	assert.Equal(t, CaptureSent, ops[1].Messages[0].Direction)
+	assert.Equal(t, CaptureReceived, ops[1].Messages[1].Direction)
+	assert.NoError(t, ops[1].Err)
+
+	resp, err := x.SnmpDecodePacket(ops[1].Messages[1].Data)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("router"), resp.Variables[0].Value)
+
+	var buf bytes.Buffer
+	require.NoError(t, x.WireLog.WriteCapture(&buf))
+	r, err := NewCaptureReader(&buf)
+	require.NoError(t, err)
+	n := 0
+	for {
+		if _, err = r.Next(); err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		n++
+	}
+	assert.Equal(t, 4, n)
+}
+
+func TestWireLogFailure(t *testing.T) {
+	srvr, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer srvr.Close()
+
+	x := &GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(srvr.LocalAddr().(*net.UDPAddr).Port),
+		Community: "public",
+		Version:   Version2c,
+		Timeout:   50 * time.Millisecond,
+		Retries:   1,
+		MaxOids:   MaxOids,
+		WireLog:   NewWireLog(4),
+	}
+	require.NoError(t, x.Connect())
+	defer x.Conn.Close()
+
+	_, err = x.Get([]string{".1.3.6.1.2.1.1.1.0"})
+	require.Error(t, err)
+	ops := x.WireLog.Operations()
+	require.Len(t, ops, 1)
+	assert.Equal(t, err, ops[0].Err)
+	assert.Len(t, ops[0].Messages, 2, "the request and its retransmission")
+	assert.NotEqual(t, ops[0].Messages[0].Data, ops[0].Messages[1].Data, "new request ID")
+}